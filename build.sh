@@ -13,6 +13,10 @@ fi
 
 output="out"
 
+commit=$(git rev-parse --short HEAD 2>/dev/null || echo unknown)
+build_date=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+buildinfo="-X main.Version=$version -X github.com/phpc0de/ctpango/internal/config.BuildCommit=$commit -X github.com/phpc0de/ctpango/internal/config.BuildDate=$build_date"
+
 default_golang() {
   export GOROOT=/usr/local/go
   go=$GOROOT/bin/go
@@ -30,10 +34,10 @@ Build() {
   if [ $2 = "windows" ]; then
     goversioninfo -o=resource_windows_386.syso
     goversioninfo -64 -o=resource_windows_amd64.syso
-    $go build -ldflags "-X main.Version=$version -s -w" -o "$output/$1/$name.exe"
+    $go build -ldflags "$buildinfo -s -w" -o "$output/$1/$name.exe"
     RicePack $1 $name.exe
   else
-    $go build -ldflags "-X main.Version=$version -s -w" -o "$output/$1/$name"
+    $go build -ldflags "$buildinfo -s -w" -o "$output/$1/$name"
     RicePack $1 $name
   fi
 
@@ -44,7 +48,7 @@ AndroidBuild() {
   default_golang
   echo "Building $1..."
   export GOOS=$2 GOARCH=$3 GOARM=$4 CGO_ENABLED=1
-  $go build -ldflags "-X main.Version=$version -s -w -linkmode=external -extldflags=-pie" -o "$output/$1/$name"
+  $go build -ldflags "$buildinfo -s -w -linkmode=external -extldflags=-pie" -o "$output/$1/$name"
 
   RicePack $1 $name
   Pack $1 $2
@@ -56,7 +60,7 @@ IOSBuild() {
   mkdir -p "$output/$1"
   cd "$output/$1"
   export CC=/usr/local/go/misc/ios/clangwrap.sh GOOS=ios GOARCH=arm64 GOARM=7 CGO_ENABLED=1
-  $go build -ldflags "-X main.Version=$version -s -w" -o $name github.com/phpc0de/ctpango
+  $go build -ldflags "$buildinfo -s -w" -o $name github.com/phpc0de/ctpango
   jtool --sign --inplace --ent ../../entitlements.xml $name
   cd ../..
   RicePack $1 $name
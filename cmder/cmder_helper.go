@@ -14,6 +14,8 @@ import (
 var (
 	appInstance *cli.App
 
+	interactive bool
+
 	saveConfigMutex *sync.Mutex = new(sync.Mutex)
 
 	ReloadConfigFunc = func(c *cli.Context) error {
@@ -39,6 +41,16 @@ func SetApp(app *cli.App) {
 	appInstance = app
 }
 
+// SetInteractive 设置是否处于交互命令行模式
+func SetInteractive(b bool) {
+	interactive = b
+}
+
+// IsInteractive 是否处于交互命令行模式, 交互模式下命令不能直接退出进程
+func IsInteractive() bool {
+	return interactive
+}
+
 func App() *cli.App {
 	return appInstance
 }
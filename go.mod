@@ -3,7 +3,9 @@ module github.com/phpc0de/ctpango
 go 1.16
 
 require (
+	bazil.org/fuse v0.0.0-20230120002735-62a210ff1fd5
 	github.com/GeertJohan/go.incremental v1.0.0
+	github.com/fsnotify/fsnotify v1.5.4
 	github.com/json-iterator/go v1.1.10
 	github.com/kardianos/osext v0.0.0-20170510131534-ae77be60afb1
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
@@ -13,8 +15,9 @@ require (
 	github.com/phpc0de/bolt v1.3.4
 	github.com/phpc0de/ctapi v0.0.8
 	github.com/phpc0de/ctlibgo v0.0.5
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/urfave/cli v1.21.1-0.20190817182405-23c83030263f
-	golang.org/x/sys v0.0.0-20200202164722-d101bd2416d5 // indirect
+	github.com/zalando/go-keyring v0.2.2
 )
 
 //replace github.com/phpc0de/bolt => /Users/tickstep/Documents/Workspace/go/projects/bolt
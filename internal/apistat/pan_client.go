@@ -0,0 +1,622 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package apistat
+
+import (
+	"sync"
+	"time"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctapi/cloudpan/apierror"
+)
+
+// PanClient 统计接口调用次数的 cloudpan.PanClient 代理.
+// 只统计通过代理调用的方法, 方法内部发出的多个请求 (例如分页获取文件列表) 记为一次调用.
+// 设置了 TokenRefresher 后, 接口返回登录凭证过期时会自动刷新凭证并重试一次
+type PanClient struct {
+	*cloudpan.PanClient
+
+	mu        sync.RWMutex
+	refreshMu sync.Mutex
+	refresher TokenRefresher
+}
+
+// TokenRefresher 重新登录并返回使用新凭证的 cloudpan.PanClient
+type TokenRefresher func() (*cloudpan.PanClient, error)
+
+// NewPanClient 创建 PanClient 代理
+func NewPanClient(p *cloudpan.PanClient) *PanClient {
+	return &PanClient{PanClient: p}
+}
+
+// SetTokenRefresher 设置登录凭证过期时使用的刷新函数, 为 nil 时不自动刷新
+func (p *PanClient) SetTokenRefresher(refresher TokenRefresher) {
+	p.refreshMu.Lock()
+	defer p.refreshMu.Unlock()
+	p.refresher = refresher
+}
+
+// current 返回当前使用的 cloudpan.PanClient
+func (p *PanClient) current() *cloudpan.PanClient {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.PanClient
+}
+
+// withTokenRefresh 调用 call, 若返回登录凭证过期则刷新凭证后重试一次.
+// 刷新失败时返回原始的错误
+func (p *PanClient) withTokenRefresh(call func(c *cloudpan.PanClient) *apierror.ApiError) *apierror.ApiError {
+	client := p.current()
+	apierr := call(client)
+	if apierr == nil || apierr.Code != apierror.ApiCodeTokenExpiredCode {
+		return apierr
+	}
+
+	p.refreshMu.Lock()
+	if p.refresher == nil {
+		p.refreshMu.Unlock()
+		return apierr
+	}
+	// 其他调用已经刷新过凭证时直接使用新的 client 重试
+	if p.current() == client {
+		newClient, err := p.refresher()
+		if err != nil || newClient == nil {
+			p.refreshMu.Unlock()
+			return apierr
+		}
+		p.mu.Lock()
+		p.PanClient = newClient
+		p.mu.Unlock()
+	}
+	p.refreshMu.Unlock()
+	return call(p.current())
+}
+
+// AppCheckBatchTask 参见 cloudpan.PanClient.AppCheckBatchTask
+func (p *PanClient) AppCheckBatchTask(typeFlag cloudpan.BatchTaskType, taskId string) (r *cloudpan.CheckTaskResult, apierr *apierror.ApiError) {
+	defer Record("AppCheckBatchTask", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppCheckBatchTask(typeFlag, taskId)
+		return apierr
+	})
+	return
+}
+
+// AppCopyFile 参见 cloudpan.PanClient.AppCopyFile
+func (p *PanClient) AppCopyFile(param *cloudpan.AppCopyFileParam) (r *cloudpan.AppFileEntity, apierr *apierror.ApiError) {
+	defer Record("AppCopyFile", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppCopyFile(param)
+		return apierr
+	})
+	return
+}
+
+// AppCreateBatchTask 参见 cloudpan.PanClient.AppCreateBatchTask
+func (p *PanClient) AppCreateBatchTask(familyId int64, param *cloudpan.BatchTaskParam) (r string, apierr *apierror.ApiError) {
+	defer Record("AppCreateBatchTask", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppCreateBatchTask(familyId, param)
+		return apierr
+	})
+	return
+}
+
+// AppCreateUploadFile 参见 cloudpan.PanClient.AppCreateUploadFile
+func (p *PanClient) AppCreateUploadFile(param *cloudpan.AppCreateUploadFileParam) (r *cloudpan.AppCreateUploadFileResult, apierr *apierror.ApiError) {
+	defer Record("AppCreateUploadFile", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppCreateUploadFile(param)
+		return apierr
+	})
+	return
+}
+
+// AppDeleteFile 参见 cloudpan.PanClient.AppDeleteFile
+func (p *PanClient) AppDeleteFile(fileIdList []string) (r bool, apierr *apierror.ApiError) {
+	defer Record("AppDeleteFile", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppDeleteFile(fileIdList)
+		return apierr
+	})
+	return
+}
+
+// AppDownloadFileData 参见 cloudpan.PanClient.AppDownloadFileData
+func (p *PanClient) AppDownloadFileData(downloadFileUrl string, fileRange cloudpan.AppFileDownloadRange, downloadFunc cloudpan.DownloadFuncCallback) *apierror.ApiError {
+	defer Record("AppDownloadFileData", time.Now())
+	return p.current().AppDownloadFileData(downloadFileUrl, fileRange, downloadFunc)
+}
+
+// AppFamilyCreateUploadFile 参见 cloudpan.PanClient.AppFamilyCreateUploadFile
+func (p *PanClient) AppFamilyCreateUploadFile(param *cloudpan.AppCreateUploadFileParam) (r *cloudpan.AppCreateUploadFileResult, apierr *apierror.ApiError) {
+	defer Record("AppFamilyCreateUploadFile", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppFamilyCreateUploadFile(param)
+		return apierr
+	})
+	return
+}
+
+// AppFamilyDownloadFileData 参见 cloudpan.PanClient.AppFamilyDownloadFileData
+func (p *PanClient) AppFamilyDownloadFileData(downloadFileUrl string, fileRange cloudpan.AppFileDownloadRange, downloadFunc cloudpan.DownloadFuncCallback) *apierror.ApiError {
+	defer Record("AppFamilyDownloadFileData", time.Now())
+	return p.current().AppFamilyDownloadFileData(downloadFileUrl, fileRange, downloadFunc)
+}
+
+// AppFamilyGetFamilyList 参见 cloudpan.PanClient.AppFamilyGetFamilyList
+func (p *PanClient) AppFamilyGetFamilyList() (r *cloudpan.AppFamilyInfoListResult, apierr *apierror.ApiError) {
+	defer Record("AppFamilyGetFamilyList", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppFamilyGetFamilyList()
+		return apierr
+	})
+	return
+}
+
+// AppFamilyGetFileDownloadUrl 参见 cloudpan.PanClient.AppFamilyGetFileDownloadUrl
+func (p *PanClient) AppFamilyGetFileDownloadUrl(familyId int64, fileId string) (r string, apierr *apierror.ApiError) {
+	defer Record("AppFamilyGetFileDownloadUrl", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppFamilyGetFileDownloadUrl(familyId, fileId)
+		return apierr
+	})
+	return
+}
+
+// AppFamilyGetUploadFileStatus 参见 cloudpan.PanClient.AppFamilyGetUploadFileStatus
+func (p *PanClient) AppFamilyGetUploadFileStatus(familyId int64, uploadFileId string) (r *cloudpan.AppGetUploadFileStatusResult, apierr *apierror.ApiError) {
+	defer Record("AppFamilyGetUploadFileStatus", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppFamilyGetUploadFileStatus(familyId, uploadFileId)
+		return apierr
+	})
+	return
+}
+
+// AppFamilyMoveFile 参见 cloudpan.PanClient.AppFamilyMoveFile
+func (p *PanClient) AppFamilyMoveFile(familyId int64, fileId string, destParentId string) (r *cloudpan.AppFileEntity, apierr *apierror.ApiError) {
+	defer Record("AppFamilyMoveFile", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppFamilyMoveFile(familyId, fileId, destParentId)
+		return apierr
+	})
+	return
+}
+
+// AppFamilyRenameFile 参见 cloudpan.PanClient.AppFamilyRenameFile
+func (p *PanClient) AppFamilyRenameFile(familyId int64, renameFileId string, newName string) (r *cloudpan.AppFileEntity, apierr *apierror.ApiError) {
+	defer Record("AppFamilyRenameFile", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppFamilyRenameFile(familyId, renameFileId, newName)
+		return apierr
+	})
+	return
+}
+
+// AppFamilySaveFileToPersonCloud 参见 cloudpan.PanClient.AppFamilySaveFileToPersonCloud
+func (p *PanClient) AppFamilySaveFileToPersonCloud(familyId int64, familyFileIdList []string) (r bool, apierr *apierror.ApiError) {
+	defer Record("AppFamilySaveFileToPersonCloud", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppFamilySaveFileToPersonCloud(familyId, familyFileIdList)
+		return apierr
+	})
+	return
+}
+
+// AppFamilyUploadFileCommit 参见 cloudpan.PanClient.AppFamilyUploadFileCommit
+func (p *PanClient) AppFamilyUploadFileCommit(familyId int64, uploadCommitUrl string, uploadFileId string, xRequestId string) (r *cloudpan.AppUploadFileCommitResult, apierr *apierror.ApiError) {
+	defer Record("AppFamilyUploadFileCommit", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppFamilyUploadFileCommit(familyId, uploadCommitUrl, uploadFileId, xRequestId)
+		return apierr
+	})
+	return
+}
+
+// AppFamilyUploadFileData 参见 cloudpan.PanClient.AppFamilyUploadFileData
+func (p *PanClient) AppFamilyUploadFileData(familyId int64, uploadUrl string, uploadFileId string, xRequestId string, fileRange *cloudpan.AppFileUploadRange, uploadFunc cloudpan.UploadFunc) *apierror.ApiError {
+	defer Record("AppFamilyUploadFileData", time.Now())
+	return p.current().AppFamilyUploadFileData(familyId, uploadUrl, uploadFileId, xRequestId, fileRange, uploadFunc)
+}
+
+// AppFileInfoById 参见 cloudpan.PanClient.AppFileInfoById
+func (p *PanClient) AppFileInfoById(familyId int64, fileId string) (r *cloudpan.AppFileEntity, apierr *apierror.ApiError) {
+	defer Record("AppFileInfoById", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppFileInfoById(familyId, fileId)
+		return apierr
+	})
+	return
+}
+
+// AppFileInfoByPath 参见 cloudpan.PanClient.AppFileInfoByPath
+func (p *PanClient) AppFileInfoByPath(familyId int64, pathStr string) (r *cloudpan.AppFileEntity, apierr *apierror.ApiError) {
+	defer Record("AppFileInfoByPath", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppFileInfoByPath(familyId, pathStr)
+		return apierr
+	})
+	return
+}
+
+// AppFileList 参见 cloudpan.PanClient.AppFileList
+func (p *PanClient) AppFileList(param *cloudpan.AppFileListParam) (r *cloudpan.AppFileListResult, apierr *apierror.ApiError) {
+	defer Record("AppFileList", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppFileList(param)
+		return apierr
+	})
+	return
+}
+
+// AppFilePathById 参见 cloudpan.PanClient.AppFilePathById
+func (p *PanClient) AppFilePathById(familyId int64, fileId string) (r string, apierr *apierror.ApiError) {
+	defer Record("AppFilePathById", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppFilePathById(familyId, fileId)
+		return apierr
+	})
+	return
+}
+
+// AppFilesDirectoriesRecurseList 参见 cloudpan.PanClient.AppFilesDirectoriesRecurseList
+func (p *PanClient) AppFilesDirectoriesRecurseList(familyId int64, path string, handleAppFileDirectoryFunc cloudpan.HandleAppFileDirectoryFunc) cloudpan.AppFileList {
+	defer Record("AppFilesDirectoriesRecurseList", time.Now())
+	return p.current().AppFilesDirectoriesRecurseList(familyId, path, handleAppFileDirectoryFunc)
+}
+
+// AppGetAllFileList 参见 cloudpan.PanClient.AppGetAllFileList
+func (p *PanClient) AppGetAllFileList(param *cloudpan.AppFileListParam) (r *cloudpan.AppFileListResult, apierr *apierror.ApiError) {
+	defer Record("AppGetAllFileList", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppGetAllFileList(param)
+		return apierr
+	})
+	return
+}
+
+// AppGetBasicFileInfo 参见 cloudpan.PanClient.AppGetBasicFileInfo
+func (p *PanClient) AppGetBasicFileInfo(param *cloudpan.AppGetFileInfoParam) (r *cloudpan.AppGetFileInfoResult, apierr *apierror.ApiError) {
+	defer Record("AppGetBasicFileInfo", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppGetBasicFileInfo(param)
+		return apierr
+	})
+	return
+}
+
+// AppGetFileDownloadUrl 参见 cloudpan.PanClient.AppGetFileDownloadUrl
+func (p *PanClient) AppGetFileDownloadUrl(fileId string) (r string, apierr *apierror.ApiError) {
+	defer Record("AppGetFileDownloadUrl", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppGetFileDownloadUrl(fileId)
+		return apierr
+	})
+	return
+}
+
+// AppGetUploadFileStatus 参见 cloudpan.PanClient.AppGetUploadFileStatus
+func (p *PanClient) AppGetUploadFileStatus(uploadFileId string) (r *cloudpan.AppGetUploadFileStatusResult, apierr *apierror.ApiError) {
+	defer Record("AppGetUploadFileStatus", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppGetUploadFileStatus(uploadFileId)
+		return apierr
+	})
+	return
+}
+
+// AppMkdir 参见 cloudpan.PanClient.AppMkdir
+func (p *PanClient) AppMkdir(familyId int64, parentFileId string, dirName string) (r *cloudpan.AppMkdirResult, apierr *apierror.ApiError) {
+	defer Record("AppMkdir", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppMkdir(familyId, parentFileId, dirName)
+		return apierr
+	})
+	return
+}
+
+// AppMkdirRecursive 参见 cloudpan.PanClient.AppMkdirRecursive
+func (p *PanClient) AppMkdirRecursive(familyId int64, parentFileId string, fullPath string, index int, pathSlice []string) (r *cloudpan.AppMkdirResult, apierr *apierror.ApiError) {
+	defer Record("AppMkdirRecursive", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppMkdirRecursive(familyId, parentFileId, fullPath, index, pathSlice)
+		return apierr
+	})
+	return
+}
+
+// AppMoveFile 参见 cloudpan.PanClient.AppMoveFile
+func (p *PanClient) AppMoveFile(fileIdList []string, targetFolderId string) (r *cloudpan.AppMoveFileResult, apierr *apierror.ApiError) {
+	defer Record("AppMoveFile", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppMoveFile(fileIdList, targetFolderId)
+		return apierr
+	})
+	return
+}
+
+// AppRenameFile 参见 cloudpan.PanClient.AppRenameFile
+func (p *PanClient) AppRenameFile(renameFileId string, newName string) (r *cloudpan.AppFileEntity, apierr *apierror.ApiError) {
+	defer Record("AppRenameFile", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppRenameFile(renameFileId, newName)
+		return apierr
+	})
+	return
+}
+
+// AppSaveFileToFamilyCloud 参见 cloudpan.PanClient.AppSaveFileToFamilyCloud
+func (p *PanClient) AppSaveFileToFamilyCloud(familyId int64, personFileIdList []string) (r bool, apierr *apierror.ApiError) {
+	defer Record("AppSaveFileToFamilyCloud", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppSaveFileToFamilyCloud(familyId, personFileIdList)
+		return apierr
+	})
+	return
+}
+
+// AppUploadFileCommit 参见 cloudpan.PanClient.AppUploadFileCommit
+func (p *PanClient) AppUploadFileCommit(uploadCommitUrl string, uploadFileId string, xRequestId string) (r *cloudpan.AppUploadFileCommitResult, apierr *apierror.ApiError) {
+	defer Record("AppUploadFileCommit", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppUploadFileCommit(uploadCommitUrl, uploadFileId, xRequestId)
+		return apierr
+	})
+	return
+}
+
+// AppUploadFileCommitOverwrite 参见 cloudpan.PanClient.AppUploadFileCommitOverwrite
+func (p *PanClient) AppUploadFileCommitOverwrite(uploadCommitUrl string, uploadFileId string, xRequestId string, overwrite bool) (r *cloudpan.AppUploadFileCommitResult, apierr *apierror.ApiError) {
+	defer Record("AppUploadFileCommitOverwrite", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppUploadFileCommitOverwrite(uploadCommitUrl, uploadFileId, xRequestId, overwrite)
+		return apierr
+	})
+	return
+}
+
+// AppUploadFileData 参见 cloudpan.PanClient.AppUploadFileData
+func (p *PanClient) AppUploadFileData(uploadUrl string, uploadFileId string, xRequestId string, fileRange *cloudpan.AppFileUploadRange, uploadFunc cloudpan.UploadFunc) *apierror.ApiError {
+	defer Record("AppUploadFileData", time.Now())
+	return p.current().AppUploadFileData(uploadUrl, uploadFileId, xRequestId, fileRange, uploadFunc)
+}
+
+// AppUserSign 参见 cloudpan.PanClient.AppUserSign
+func (p *PanClient) AppUserSign() (r *cloudpan.AppUserSignResult, apierr *apierror.ApiError) {
+	defer Record("AppUserSign", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.AppUserSign()
+		return apierr
+	})
+	return
+}
+
+// CheckBatchTask 参见 cloudpan.PanClient.CheckBatchTask
+func (p *PanClient) CheckBatchTask(typeFlag cloudpan.BatchTaskType, taskId string) (r *cloudpan.CheckTaskResult, apierr *apierror.ApiError) {
+	defer Record("CheckBatchTask", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.CheckBatchTask(typeFlag, taskId)
+		return apierr
+	})
+	return
+}
+
+// CreateBatchTask 参见 cloudpan.PanClient.CreateBatchTask
+func (p *PanClient) CreateBatchTask(param *cloudpan.BatchTaskParam) (r string, apierr *apierror.ApiError) {
+	defer Record("CreateBatchTask", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.CreateBatchTask(param)
+		return apierr
+	})
+	return
+}
+
+// FileInfoById 参见 cloudpan.PanClient.FileInfoById
+func (p *PanClient) FileInfoById(fileId string) (r *cloudpan.FileEntity, apierr *apierror.ApiError) {
+	defer Record("FileInfoById", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.FileInfoById(fileId)
+		return apierr
+	})
+	return
+}
+
+// FileInfoByPath 参见 cloudpan.PanClient.FileInfoByPath
+func (p *PanClient) FileInfoByPath(pathStr string) (r *cloudpan.FileEntity, apierr *apierror.ApiError) {
+	defer Record("FileInfoByPath", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.FileInfoByPath(pathStr)
+		return apierr
+	})
+	return
+}
+
+// FileList 参见 cloudpan.PanClient.FileList
+func (p *PanClient) FileList(param *cloudpan.FileListParam) (r *cloudpan.FileSearchResult, apierr *apierror.ApiError) {
+	defer Record("FileList", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.FileList(param)
+		return apierr
+	})
+	return
+}
+
+// FileSearch 参见 cloudpan.PanClient.FileSearch
+func (p *PanClient) FileSearch(param *cloudpan.FileSearchParam) (r *cloudpan.FileSearchResult, apierr *apierror.ApiError) {
+	defer Record("FileSearch", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.FileSearch(param)
+		return apierr
+	})
+	return
+}
+
+// FilesDirectoriesRecurseList 参见 cloudpan.PanClient.FilesDirectoriesRecurseList
+func (p *PanClient) FilesDirectoriesRecurseList(path string, handleFileDirectoryFunc cloudpan.HandleFileDirectoryFunc) cloudpan.FileList {
+	defer Record("FilesDirectoriesRecurseList", time.Now())
+	return p.current().FilesDirectoriesRecurseList(path, handleFileDirectoryFunc)
+}
+
+// GetUserDetailInfo 参见 cloudpan.PanClient.GetUserDetailInfo
+func (p *PanClient) GetUserDetailInfo() (r *cloudpan.UserDetailInfo, apierr *apierror.ApiError) {
+	defer Record("GetUserDetailInfo", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.GetUserDetailInfo()
+		return apierr
+	})
+	return
+}
+
+// GetUserInfo 参见 cloudpan.PanClient.GetUserInfo
+func (p *PanClient) GetUserInfo() (r *cloudpan.UserInfo, apierr *apierror.ApiError) {
+	defer Record("GetUserInfo", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.GetUserInfo()
+		return apierr
+	})
+	return
+}
+
+// Heartbeat 参见 cloudpan.PanClient.Heartbeat
+func (p *PanClient) Heartbeat() bool {
+	defer Record("Heartbeat", time.Now())
+	return p.current().Heartbeat()
+}
+
+// Mkdir 参见 cloudpan.PanClient.Mkdir
+func (p *PanClient) Mkdir(parentFileId string, dirName string) (r *cloudpan.MkdirResult, apierr *apierror.ApiError) {
+	defer Record("Mkdir", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.Mkdir(parentFileId, dirName)
+		return apierr
+	})
+	return
+}
+
+// MkdirRecursive 参见 cloudpan.PanClient.MkdirRecursive
+func (p *PanClient) MkdirRecursive(parentFileId string, fullPath string, index int, pathSlice []string) (r *cloudpan.MkdirResult, apierr *apierror.ApiError) {
+	defer Record("MkdirRecursive", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.MkdirRecursive(parentFileId, fullPath, index, pathSlice)
+		return apierr
+	})
+	return
+}
+
+// RecycleClear 参见 cloudpan.PanClient.RecycleClear
+func (p *PanClient) RecycleClear(familyId int64) *apierror.ApiError {
+	defer Record("RecycleClear", time.Now())
+	return p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		return c.RecycleClear(familyId)
+	})
+}
+
+// RecycleDelete 参见 cloudpan.PanClient.RecycleDelete
+func (p *PanClient) RecycleDelete(familyId int64, fileIdList []string) *apierror.ApiError {
+	defer Record("RecycleDelete", time.Now())
+	return p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		return c.RecycleDelete(familyId, fileIdList)
+	})
+}
+
+// RecycleList 参见 cloudpan.PanClient.RecycleList
+func (p *PanClient) RecycleList(pageNum int, pageSize int) (r *cloudpan.RecycleFileListResult, apierr *apierror.ApiError) {
+	defer Record("RecycleList", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.RecycleList(pageNum, pageSize)
+		return apierr
+	})
+	return
+}
+
+// RecycleRestore 参见 cloudpan.PanClient.RecycleRestore
+func (p *PanClient) RecycleRestore(fileList []*cloudpan.RecycleFileInfo) (r string, apierr *apierror.ApiError) {
+	defer Record("RecycleRestore", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.RecycleRestore(fileList)
+		return apierr
+	})
+	return
+}
+
+// Rename 参见 cloudpan.PanClient.Rename
+func (p *PanClient) Rename(renameFileId string, newName string) (r bool, apierr *apierror.ApiError) {
+	defer Record("Rename", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.Rename(renameFileId, newName)
+		return apierr
+	})
+	return
+}
+
+// ShareCancel 参见 cloudpan.PanClient.ShareCancel
+func (p *PanClient) ShareCancel(shareIdList []int64) (r bool, apierr *apierror.ApiError) {
+	defer Record("ShareCancel", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.ShareCancel(shareIdList)
+		return apierr
+	})
+	return
+}
+
+// ShareList 参见 cloudpan.PanClient.ShareList
+func (p *PanClient) ShareList(param *cloudpan.ShareListParam) (r *cloudpan.ShareListResult, apierr *apierror.ApiError) {
+	defer Record("ShareList", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.ShareList(param)
+		return apierr
+	})
+	return
+}
+
+// SharePrivate 参见 cloudpan.PanClient.SharePrivate
+func (p *PanClient) SharePrivate(fileId string, expiredTime cloudpan.ShareExpiredTime) (r *cloudpan.PrivateShareResult, apierr *apierror.ApiError) {
+	defer Record("SharePrivate", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.SharePrivate(fileId, expiredTime)
+		return apierr
+	})
+	return
+}
+
+// SharePublic 参见 cloudpan.PanClient.SharePublic
+func (p *PanClient) SharePublic(fileId string, expiredTime cloudpan.ShareExpiredTime) (r *cloudpan.PublicShareResult, apierr *apierror.ApiError) {
+	defer Record("SharePublic", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.SharePublic(fileId, expiredTime)
+		return apierr
+	})
+	return
+}
+
+// ShareSave 参见 cloudpan.PanClient.ShareSave
+func (p *PanClient) ShareSave(accessUrl string, accessCode string, savePanDirId string) (r bool, apierr *apierror.ApiError) {
+	defer Record("ShareSave", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.ShareSave(accessUrl, accessCode, savePanDirId)
+		return apierr
+	})
+	return
+}
+
+// UserDrawPrize 参见 cloudpan.PanClient.UserDrawPrize
+func (p *PanClient) UserDrawPrize(taskId cloudpan.ActivityTaskId) (r *cloudpan.UserDrawPrizeResult, apierr *apierror.ApiError) {
+	defer Record("UserDrawPrize", time.Now())
+	apierr = p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError {
+		r, apierr = c.UserDrawPrize(taskId)
+		return apierr
+	})
+	return
+}
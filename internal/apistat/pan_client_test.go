@@ -0,0 +1,89 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package apistat
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctapi/cloudpan/apierror"
+)
+
+func TestWithTokenRefresh(t *testing.T) {
+	oldClient := cloudpan.NewPanClient(cloudpan.WebLoginToken{}, cloudpan.AppLoginToken{SessionKey: "old"})
+	newClient := cloudpan.NewPanClient(cloudpan.WebLoginToken{}, cloudpan.AppLoginToken{SessionKey: "new"})
+	expired := apierror.NewApiError(apierror.ApiCodeTokenExpiredCode, "token expired")
+	call := func(c *cloudpan.PanClient) *apierror.ApiError {
+		if c == oldClient {
+			return expired
+		}
+		return nil
+	}
+
+	// 未设置刷新函数时返回原始错误
+	p := NewPanClient(oldClient)
+	if err := p.withTokenRefresh(call); err != expired {
+		t.Fatalf("err: %v", err)
+	}
+
+	// 刷新成功后使用新的 client 重试
+	refreshCount := 0
+	p.SetTokenRefresher(func() (*cloudpan.PanClient, error) {
+		refreshCount++
+		return newClient, nil
+	})
+	if err := p.withTokenRefresh(call); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if refreshCount != 1 || p.current() != newClient {
+		t.Fatalf("refresh count: %d", refreshCount)
+	}
+
+	// 已经使用新的凭证, 不再刷新
+	if err := p.withTokenRefresh(call); err != nil || refreshCount != 1 {
+		t.Fatalf("err: %v, refresh count: %d", err, refreshCount)
+	}
+}
+
+func TestWithTokenRefreshFailed(t *testing.T) {
+	oldClient := cloudpan.NewPanClient(cloudpan.WebLoginToken{}, cloudpan.AppLoginToken{})
+	expired := apierror.NewApiError(apierror.ApiCodeTokenExpiredCode, "token expired")
+	callCount := 0
+	call := func(c *cloudpan.PanClient) *apierror.ApiError {
+		callCount++
+		return expired
+	}
+
+	p := NewPanClient(oldClient)
+	p.SetTokenRefresher(func() (*cloudpan.PanClient, error) {
+		return nil, errors.New("login failed")
+	})
+	if err := p.withTokenRefresh(call); err != expired {
+		t.Fatalf("err: %v", err)
+	}
+	if callCount != 1 || p.current() != oldClient {
+		t.Fatalf("call count: %d", callCount)
+	}
+
+	// 其他错误不刷新
+	other := apierror.NewFailedApiError("failed")
+	p.SetTokenRefresher(func() (*cloudpan.PanClient, error) {
+		t.Fatal("unexpected refresh")
+		return nil, nil
+	})
+	if err := p.withTokenRefresh(func(c *cloudpan.PanClient) *apierror.ApiError { return other }); err != other {
+		t.Fatalf("err: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package apistat
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/phpc0de/ctlibgo/logger"
+)
+
+const (
+	// EnvShowAPICalls 是否统计网盘接口调用次数的环境变量, 交互模式下每条命令都会重新解析全局参数
+	EnvShowAPICalls = "CLOUD189_SHOW_API_CALLS"
+)
+
+var (
+	// ShowAPICalls 是否统计网盘接口调用次数, 由全局参数 --show-api-calls 设置
+	ShowAPICalls bool
+
+	// Out 输出统计信息的位置, 默认为标准错误
+	Out io.Writer = os.Stderr
+
+	count int64
+)
+
+// Record 记录一次网盘接口调用, start 为调用开始的时间, 调试模式下输出每次调用的耗时
+func Record(name string, start time.Time) {
+	if !ShowAPICalls {
+		return
+	}
+	n := atomic.AddInt64(&count, 1)
+	if logger.IsVerbose {
+		fmt.Fprintf(Out, "API 调用 #%d: %s, 耗时: %s\n", n, name, time.Since(start))
+	}
+}
+
+// Count 返回记录的调用次数
+func Count() int64 {
+	return atomic.LoadInt64(&count)
+}
+
+// PrintAndReset 输出调用次数并清零, 未开启统计时不输出
+func PrintAndReset() {
+	if !ShowAPICalls {
+		return
+	}
+	fmt.Fprintf(Out, "API 调用次数: %d\n", atomic.SwapInt64(&count, 0))
+}
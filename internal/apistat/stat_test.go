@@ -0,0 +1,59 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package apistat
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phpc0de/ctlibgo/logger"
+)
+
+func TestRecord(t *testing.T) {
+	buf := &bytes.Buffer{}
+	Out = buf
+	defer func() {
+		ShowAPICalls = false
+		logger.IsVerbose = false
+	}()
+
+	// 未开启统计
+	Record("AppFileList", time.Now())
+	PrintAndReset()
+	if Count() != 0 || buf.Len() != 0 {
+		t.Fatalf("count: %d, output: %s", Count(), buf)
+	}
+
+	ShowAPICalls = true
+	Record("AppFileList", time.Now())
+	Record("AppFileInfoByPath", time.Now())
+	if Count() != 2 {
+		t.Fatalf("count: %d", Count())
+	}
+	PrintAndReset()
+	if buf.String() != "API 调用次数: 2\n" || Count() != 0 {
+		t.Fatalf("output: %s", buf)
+	}
+
+	// 调试模式下输出每次调用
+	buf.Reset()
+	logger.IsVerbose = true
+	Record("AppFileList", time.Now())
+	if !strings.HasPrefix(buf.String(), "API 调用 #1: AppFileList, 耗时: ") {
+		t.Fatalf("output: %s", buf)
+	}
+	PrintAndReset()
+}
@@ -0,0 +1,362 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/cmder/cmdtable"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/phpc0de/ctpango/internal/file/downloader"
+	"github.com/phpc0de/ctpango/internal/functions/pandownload"
+	"github.com/phpc0de/ctpango/internal/logfile"
+	"github.com/urfave/cli"
+)
+
+const (
+	// AlbumDefaultRoot 默认的相册根目录, 根目录下每个包含照片的子目录为一个相册
+	AlbumDefaultRoot = "/我的图片"
+)
+
+type (
+	// AlbumEntity 相册信息.
+	// 天翼云盘的接口没有提供相册功能, 相册根目录和其中每个包含照片的子目录都作为一个相册
+	AlbumEntity struct {
+		Id       string // 相册目录的文件ID
+		Name     string // 相册名称, 即目录名
+		Path     string // 相册目录的网盘路径
+		Count    int    // 照片数量
+		CoverURL string // 封面的下载链接, 为第一张照片
+
+		photos cloudpan.AppFileList
+	}
+
+	// albumCoverFunc 获取相册封面照片的下载链接
+	albumCoverFunc func(cover *cloudpan.AppFileEntity) (string, error)
+)
+
+var (
+	// ErrAlbumNotFound 相册不存在
+	ErrAlbumNotFound = errors.New("相册不存在")
+	// ErrAlbumRootNotDir 相册根目录不是目录
+	ErrAlbumRootNotDir = errors.New("相册根目录不是目录")
+
+	// albumPhotoExtensions 作为照片的文件扩展名
+	albumPhotoExtensions = []string{"jpg", "jpeg", "png", "gif", "bmp", "webp", "heic", "heif", "tif", "tiff", "dng", "cr2", "nef", "arw"}
+)
+
+func CmdAlbum() cli.Command {
+	return cli.Command{
+		Name:      "album",
+		Usage:     "查看和下载相册",
+		UsageText: cmder.App().Name + " album <list|download>",
+		Description: `
+	天翼云盘的接口没有提供相册功能, 相册根目录(默认为 ` + AlbumDefaultRoot + `)和其中每个包含照片的子目录都作为一个相册,
+	照片为扩展名是 jpg, png, heic 等图片格式的文件, 使用 -root 参数指定其他的相册根目录.
+
+	示例:
+
+	列出所有相册
+	cloudpan189-go album list
+
+	列出 /相册 目录中的相册
+	cloudpan189-go album list -root /相册
+
+	列出所有相册, 并显示封面照片的下载链接
+	cloudpan189-go album list -cover
+
+	下载 旅行 相册中的所有照片到本地 D:/photos/旅行 目录
+	cloudpan189-go album download 旅行 D:/photos/旅行
+`,
+		Category: "天翼云盘",
+		Before:   cmder.ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			cli.ShowCommandHelp(c, c.Command.Name)
+			return nil
+		},
+		Subcommands: []cli.Command{
+			{
+				Name:      "list",
+				Usage:     "列出所有相册",
+				UsageText: cmder.App().Name + " album list [-root <相册根目录>] [-cover]",
+				Action: func(c *cli.Context) error {
+					if config.Config.ActiveUser() == nil {
+						fmt.Println("未登录账号")
+						return nil
+					}
+					familyId, err := parseFamilyId(c)
+					if err != nil {
+						fmt.Println(err)
+						return nil
+					}
+					RunAlbumList(familyId, c.String("root"), c.Bool("cover"))
+					return nil
+				},
+				Flags: append(albumFlags(),
+					cli.BoolFlag{
+						Name:  "cover",
+						Usage: "显示封面照片的下载链接, 每个相册需要额外请求一次下载链接",
+					},
+				),
+			},
+			{
+				Name:      "download",
+				Usage:     "下载相册中的所有照片",
+				UsageText: cmder.App().Name + " album download [-root <相册根目录>] <相册名称> [本地目录]",
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 1 || c.NArg() > 2 {
+						cli.ShowCommandHelp(c, c.Command.Name)
+						return nil
+					}
+					if config.Config.ActiveUser() == nil {
+						fmt.Println("未登录账号")
+						return nil
+					}
+					saveTo := c.Args().Get(1)
+					if saveTo != "" {
+						saveTo = filepath.Clean(saveTo)
+					}
+					familyId, err := parseFamilyId(c)
+					if err != nil {
+						fmt.Println(err)
+						return nil
+					}
+					RunAlbumDownload(c.String("root"), c.Args().Get(0), &DownloadOptions{
+						IsOverwrite:       c.Bool("ow"),
+						SaveTo:            saveTo,
+						Parallel:          c.Int("p"),
+						MaxRetry:          pandownload.DefaultDownloadMaxRetry,
+						MaxChecksumRetry:  pandownload.DefaultChecksumMaxRetry,
+						ShowProgress:      !c.Bool("np"),
+						FamilyId:          familyId,
+						ChecksumAlgorithm: downloader.DefaultChecksumAlgorithm,
+					})
+					return nil
+				},
+				Flags: append(albumFlags(),
+					cli.BoolFlag{
+						Name:  "ow",
+						Usage: "overwrite, 覆盖已存在的文件",
+					},
+					cli.IntFlag{
+						Name:  "p",
+						Usage: "指定每个文件的下载线程数",
+					},
+					cli.BoolFlag{
+						Name:  "np",
+						Usage: "no progress 不展示下载进度条",
+					},
+				),
+			},
+		},
+	}
+}
+
+// albumFlags 返回 album 子命令共用的参数
+func albumFlags() []cli.Flag {
+	return append([]cli.Flag{
+		cli.StringFlag{
+			Name:  "root",
+			Usage: "相册根目录",
+			Value: AlbumDefaultRoot,
+		},
+	}, FamilyFlags...)
+}
+
+// isAlbumPhoto 文件是否为照片
+func isAlbumPhoto(fe *cloudpan.AppFileEntity) bool {
+	return !fe.IsFolder && pandownload.MatchExtensions(fe.FileName, albumPhotoExtensions, nil)
+}
+
+// albumPhotos 返回 files 中的所有照片
+func albumPhotos(files cloudpan.AppFileList) cloudpan.AppFileList {
+	photos := make(cloudpan.AppFileList, 0, len(files))
+	for _, fe := range files {
+		if isAlbumPhoto(fe) {
+			photos = append(photos, fe)
+		}
+	}
+	return photos
+}
+
+// newAlbum 根据相册目录 dir 和其中的照片创建相册信息, cover 不为nil时获取封面的下载链接
+func newAlbum(dir *cloudpan.AppFileEntity, dirPath string, photos cloudpan.AppFileList, cover albumCoverFunc) *AlbumEntity {
+	album := &AlbumEntity{
+		Id:    dir.FileId,
+		Name:  path.Base(dirPath),
+		Path:  dirPath,
+		Count: len(photos),
+
+		photos: photos,
+	}
+	if cover != nil && len(photos) > 0 {
+		coverURL, err := cover(photos[0])
+		if err != nil {
+			panCommandVerbose.Warnf("获取相册封面错误: %s, %s\n", dirPath, err)
+		} else {
+			album.CoverURL = coverURL
+		}
+	}
+	return album
+}
+
+// GetAlbumList 返回相册根目录 root 中的所有相册, root 本身包含照片时也作为一个相册, 排在第一位.
+// 不包含照片的子目录不作为相册
+func GetAlbumList(list lsDirLister, root *cloudpan.AppFileEntity, rootPath string, cover albumCoverFunc) ([]*AlbumEntity, error) {
+	files, err := list(root)
+	if err != nil {
+		return nil, err
+	}
+
+	albums := make([]*AlbumEntity, 0, len(files)+1)
+	if photos := albumPhotos(files); len(photos) > 0 {
+		albums = append(albums, newAlbum(root, rootPath, photos, cover))
+	}
+	for _, fe := range files {
+		if !fe.IsFolder {
+			continue
+		}
+		subFiles, err := list(fe)
+		if err != nil {
+			return nil, err
+		}
+		if photos := albumPhotos(subFiles); len(photos) > 0 {
+			albums = append(albums, newAlbum(fe, path.Join(rootPath, fe.FileName), photos, cover))
+		}
+	}
+	return albums, nil
+}
+
+// findAlbumPhotoPaths 返回相册根目录 root 中名称为 name 的相册的所有照片的网盘路径
+func findAlbumPhotoPaths(list lsDirLister, root *cloudpan.AppFileEntity, rootPath, name string) ([]string, error) {
+	albums, err := GetAlbumList(list, root, rootPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, album := range albums {
+		if album.Name != name {
+			continue
+		}
+		paths := make([]string, 0, len(album.photos))
+		for _, fe := range album.photos {
+			paths = append(paths, path.Join(album.Path, fe.FileName))
+		}
+		return paths, nil
+	}
+	return nil, ErrAlbumNotFound
+}
+
+// albumRoot 返回相册根目录的网盘路径和文件信息
+func albumRoot(familyId int64, rootPath string) (string, *cloudpan.AppFileEntity, error) {
+	activeUser := GetActiveUser()
+	if rootPath == "" {
+		rootPath = AlbumDefaultRoot
+	}
+	rootPath = activeUser.PathJoin(familyId, rootPath)
+	root, apierr := activeUser.PanClient().AppFileInfoByPath(familyId, rootPath)
+	if apierr != nil {
+		return rootPath, nil, apierr
+	}
+	if !root.IsFolder {
+		return rootPath, nil, ErrAlbumRootNotDir
+	}
+	return rootPath, root, nil
+}
+
+// RunAlbumList 执行 列出相册根目录 rootPath 中的所有相册, showCover 为 true 时获取并显示封面的下载链接
+func RunAlbumList(familyId int64, rootPath string, showCover bool) {
+	rootPath, root, err := albumRoot(familyId, rootPath)
+	if err != nil {
+		fmt.Printf("获取相册根目录错误: %s, %s\n", rootPath, err)
+		return
+	}
+
+	var coverFunc albumCoverFunc
+	if showCover {
+		panClient := GetActiveUser().PanClient()
+		coverFunc = func(cover *cloudpan.AppFileEntity) (string, error) {
+			if IsFamilyCloud(familyId) {
+				durl, apierr := panClient.AppFamilyGetFileDownloadUrl(familyId, cover.FileId)
+				if apierr != nil {
+					return "", apierr
+				}
+				return durl, nil
+			}
+			durl, apierr := panClient.AppGetFileDownloadUrl(cover.FileId)
+			if apierr != nil {
+				return "", apierr
+			}
+			return durl, nil
+		}
+	}
+	albums, err := GetAlbumList(appDirLister(familyId), root, rootPath, coverFunc)
+	if err != nil {
+		fmt.Printf("获取相册列表错误: %s\n", err)
+		return
+	}
+	if len(albums) == 0 {
+		fmt.Printf("相册根目录中没有相册: %s\n", rootPath)
+		return
+	}
+
+	var w io.Writer = os.Stdout
+	if showCover {
+		// 封面的下载链接不写入日志文件
+		w = logfile.Stdout()
+	}
+	tb := cmdtable.NewTable(w)
+	header := []string{"#", "相册", "照片数量", "路径"}
+	if showCover {
+		header = append(header, "封面")
+	}
+	tb.SetHeader(header)
+	for k, album := range albums {
+		row := []string{strconv.Itoa(k), album.Name, strconv.Itoa(album.Count), album.Path}
+		if showCover {
+			row = append(row, album.CoverURL)
+		}
+		tb.Append(row)
+	}
+	tb.Render()
+}
+
+// RunAlbumDownload 执行 下载相册根目录 rootPath 中名称为 name 的相册中的所有照片,
+// 指定 options.SaveTo 时照片直接保存到该目录, 否则保存到默认的下载目录
+func RunAlbumDownload(rootPath, name string, options *DownloadOptions) {
+	rootPath, root, err := albumRoot(options.FamilyId, rootPath)
+	if err != nil {
+		fmt.Printf("获取相册根目录错误: %s, %s\n", rootPath, err)
+		return
+	}
+
+	paths, err := findAlbumPhotoPaths(appDirLister(options.FamilyId), root, rootPath, name)
+	if err != nil {
+		fmt.Printf("获取相册照片错误: %s, %s\n", name, err)
+		return
+	}
+	if len(paths) == 0 {
+		fmt.Printf("相册中没有照片: %s\n", name)
+		return
+	}
+	fmt.Printf("相册 %s 共有 %d 张照片\n", name, len(paths))
+	RunDownload(paths, options)
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctpango/internal/functions/pandownload"
+	"github.com/phpc0de/ctpango/internal/taskframework"
+)
+
+// newTestAlbumLister 模拟 /我的图片 目录:
+// 根目录有一张照片, 旅行 目录有两张照片和一个文本文件, 文档 目录没有照片
+func newTestAlbumLister() lsDirLister {
+	dirs := map[string]cloudpan.AppFileList{
+		"root": {
+			{FileId: "trip", FileName: "旅行", IsFolder: true},
+			{FileId: "doc", FileName: "文档", IsFolder: true},
+			{FileId: "p0", FileName: "cover.JPG"},
+		},
+		"trip": {
+			{FileId: "p1", FileName: "a.jpg"},
+			{FileId: "t1", FileName: "notes.txt"},
+			{FileId: "p2", FileName: "b.heic"},
+		},
+		"doc": {
+			{FileId: "t2", FileName: "readme.md"},
+		},
+	}
+	return func(dir *cloudpan.AppFileEntity) (cloudpan.AppFileList, error) {
+		files, ok := dirs[dir.FileId]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		return files, nil
+	}
+}
+
+func TestGetAlbumList(t *testing.T) {
+	root := &cloudpan.AppFileEntity{FileId: "root", FileName: "我的图片", IsFolder: true}
+	albums, err := GetAlbumList(newTestAlbumLister(), root, "/我的图片", func(cover *cloudpan.AppFileEntity) (string, error) {
+		return "https://example.com/" + cover.FileId, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(albums) != 2 {
+		t.Fatalf("got %d albums, want 2", len(albums))
+	}
+
+	testCases := []struct {
+		name, path, cover string
+		count             int
+	}{
+		{"我的图片", "/我的图片", "https://example.com/p0", 1},
+		{"旅行", "/我的图片/旅行", "https://example.com/p1", 2},
+	}
+	for k, tc := range testCases {
+		album := albums[k]
+		if album.Name != tc.name || album.Path != tc.path || album.Count != tc.count || album.CoverURL != tc.cover {
+			t.Errorf("album %d = %+v, want %+v", k, album, tc)
+		}
+	}
+
+	// 不获取封面时不请求下载链接
+	albums, err = GetAlbumList(newTestAlbumLister(), root, "/我的图片", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, album := range albums {
+		if album.CoverURL != "" {
+			t.Errorf("album %d cover = %s, want empty", k, album.CoverURL)
+		}
+	}
+}
+
+func TestAlbumDownloadEnqueue(t *testing.T) {
+	root := &cloudpan.AppFileEntity{FileId: "root", FileName: "我的图片", IsFolder: true}
+	paths, err := findAlbumPhotoPaths(newTestAlbumLister(), root, "/我的图片", "旅行")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executor := taskframework.NewTaskExecutor()
+	options := &DownloadOptions{SaveTo: "/photos", MaxRetry: 1}
+	enqueueDownloads(executor, func(panPath string, familyId int64) *pandownload.DownloadTaskUnit {
+		return &pandownload.DownloadTaskUnit{FilePanPath: panPath, FamilyId: familyId}
+	}, paths, options)
+
+	tasks := executor.PersistedTasks()
+	want := []struct{ panPath, savePath string }{
+		{"/我的图片/旅行/a.jpg", filepath.Join("/photos", "a.jpg")},
+		{"/我的图片/旅行/b.heic", filepath.Join("/photos", "b.heic")},
+	}
+	if len(tasks) != len(want) {
+		t.Fatalf("got %d tasks, want %d", len(tasks), len(want))
+	}
+	for k, w := range want {
+		if tasks[k].PanPath != w.panPath || tasks[k].SavePath != w.savePath {
+			t.Errorf("task %d = %s => %s, want %s => %s", k, tasks[k].PanPath, tasks[k].SavePath, w.panPath, w.savePath)
+		}
+	}
+
+	if _, err = findAlbumPhotoPaths(newTestAlbumLister(), root, "/我的图片", "文档"); err != ErrAlbumNotFound {
+		t.Errorf("album without photos: got err %v, want %v", err, ErrAlbumNotFound)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/urfave/cli"
+)
+
+// AllUsersFlag 对所有已登录的账号依次执行命令
+var AllUsersFlag = cli.BoolFlag{
+	Name:  "all-users",
+	Usage: "对所有已登录的账号依次执行, 每个账号使用各自当前的云工作模式, 完成后恢复当前账号, 适用于多个账号共同存储数据的情况",
+}
+
+// RunForAllUsers 依次切换到每个已登录的账号执行 op, 并输出每个账号的执行结果.
+// 执行完成后恢复原来的当前账号, op 返回错误或 panic 时也会恢复
+func RunForAllUsers(op func() error) error {
+	users := make(config.PanUserList, len(config.Config.UserList))
+	copy(users, config.Config.UserList)
+	if len(users) == 0 {
+		return ErrNotLogined
+	}
+
+	activeUID := config.Config.ActiveUID
+	defer config.Config.SetActiveUID(activeUID)
+
+	results := make([]error, len(users))
+	for i, u := range users {
+		fmt.Printf("[%d/%d] 切换到账号: %s\n", i+1, len(users), userDisplayName(u))
+		config.Config.SetActiveUID(u.UID)
+		results[i] = op()
+		if results[i] == ErrShutdown {
+			// 收到退出信号, 不再执行其他账号
+			return ErrShutdown
+		}
+	}
+
+	failed := 0
+	fmt.Printf("\n所有账号执行完毕:\n")
+	for i, u := range users {
+		if results[i] != nil {
+			failed++
+			fmt.Printf("  %s: 失败, %s\n", userDisplayName(u), results[i])
+		} else {
+			fmt.Printf("  %s: 完成\n", userDisplayName(u))
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 个账号执行失败", failed)
+	}
+	return nil
+}
+
+// activeUserOp 返回检查当前账号登录状态后执行 run 的 op, 用于 RunForAllUsers.
+// run 的参数为当前账号的云工作模式
+func activeUserOp(run func(familyId int64) error) func() error {
+	return func() error {
+		activeUser := GetActiveUser()
+		if activeUser == nil || activeUser.PanClient() == nil {
+			return ErrNotLogined
+		}
+		return run(activeUser.ActiveFamilyId)
+	}
+}
+
+// checkAllUsersFamilyFlags 家庭云ID只属于一个账号, all-users 时每个账号使用各自当前的云工作模式,
+// 不能指定家庭云ID
+func checkAllUsersFamilyFlags(c *cli.Context) error {
+	if !c.Bool("all-users") {
+		return nil
+	}
+	if c.IsSet("familyId") || c.IsSet("family-id-env") || c.Bool("remember-family") {
+		return errors.New("家庭云ID只属于一个账号, all-users 不能和 familyId, family-id-env, remember-family 参数同时使用, 每个账号使用各自当前的云工作模式")
+	}
+	return nil
+}
+
+func userDisplayName(u *config.PanUser) string {
+	if u.Nickname != "" {
+		return u.Nickname
+	}
+	if u.AccountName != "" {
+		return u.AccountName
+	}
+	return strconv.FormatUint(u.UID, 10)
+}
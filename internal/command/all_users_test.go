@@ -0,0 +1,145 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"errors"
+	"flag"
+	"testing"
+
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/urfave/cli"
+)
+
+func setTestUsers(t *testing.T, uids ...uint64) {
+	userList, activeUID := config.Config.UserList, config.Config.ActiveUID
+	t.Cleanup(func() {
+		config.Config.UserList = userList
+		config.Config.SetActiveUID(activeUID)
+	})
+	config.Config.UserList = nil
+	for _, uid := range uids {
+		config.Config.UserList = append(config.Config.UserList, &config.PanUser{UID: uid})
+	}
+	config.Config.SetActiveUID(uids[len(uids)-1])
+}
+
+func TestRunForAllUsers(t *testing.T) {
+	setTestUsers(t, 1, 2, 3)
+
+	var called []uint64
+	opErr := errors.New("op failed")
+	err := RunForAllUsers(func() error {
+		called = append(called, config.Config.ActiveUID)
+		if config.Config.ActiveUID == 2 {
+			return opErr
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if len(called) != 3 || called[0] != 1 || called[1] != 2 || called[2] != 3 {
+		t.Fatalf("called: %v", called)
+	}
+	if config.Config.ActiveUID != 3 {
+		t.Fatalf("active uid: %d", config.Config.ActiveUID)
+	}
+
+	// 所有账号执行成功
+	if err = RunForAllUsers(func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunForAllUsersPanic(t *testing.T) {
+	setTestUsers(t, 1, 2)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic")
+			}
+		}()
+		RunForAllUsers(func() error {
+			if config.Config.ActiveUID == 1 {
+				panic("op panic")
+			}
+			return nil
+		})
+	}()
+	if config.Config.ActiveUID != 2 {
+		t.Fatalf("active uid: %d", config.Config.ActiveUID)
+	}
+}
+
+func TestRunForAllUsersNotLogin(t *testing.T) {
+	userList := config.Config.UserList
+	defer func() {
+		config.Config.UserList = userList
+	}()
+	config.Config.UserList = nil
+
+	called := false
+	err := RunForAllUsers(func() error {
+		called = true
+		return nil
+	})
+	if err != ErrNotLogined || called {
+		t.Fatalf("err: %v, called: %v", err, called)
+	}
+}
+
+func TestCheckAllUsersFamilyFlags(t *testing.T) {
+	newContext := func(args ...string) *cli.Context {
+		set := flag.NewFlagSet("test", flag.ContinueOnError)
+		set.Bool("all-users", false, "")
+		set.String("familyId", "", "")
+		set.String("family-id-env", "", "")
+		set.Bool("remember-family", false, "")
+		if err := set.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		return cli.NewContext(nil, set, nil)
+	}
+
+	if err := checkAllUsersFamilyFlags(newContext("-familyId", "123")); err != nil {
+		t.Errorf("familyId without all-users: %s", err)
+	}
+	if err := checkAllUsersFamilyFlags(newContext("-all-users")); err != nil {
+		t.Errorf("all-users without familyId: %s", err)
+	}
+	for _, args := range [][]string{
+		{"-all-users", "-familyId", "123"},
+		{"-all-users", "-family-id-env", "FAMILY_ID"},
+		{"-all-users", "-remember-family"},
+	} {
+		if err := checkAllUsersFamilyFlags(newContext(args...)); err == nil {
+			t.Errorf("%v should return error", args)
+		}
+	}
+}
+
+func TestActiveUserOpNotLogin(t *testing.T) {
+	setTestUsers(t, 1)
+
+	called := false
+	err := activeUserOp(func(familyId int64) error {
+		called = true
+		return nil
+	})()
+	if err != ErrNotLogined || called {
+		t.Fatalf("err: %v, called: %v", err, called)
+	}
+}
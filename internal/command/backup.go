@@ -281,17 +281,25 @@ func Backup(c *cli.Context) error {
 	localpaths := make([]string, 0)
 	flagSync := c.Bool("sync")
 	flagDelete := c.Bool("delete")
+	familyId, err := parseFamilyId(c)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
 
 	opt := &UploadOptions{
 		AllParallel:   c.Int("p"),
 		Parallel:      1, // 天翼云盘一个文件只支持单线程上传
 		MaxRetry:      c.Int("retry"),
 		NoRapidUpload: c.Bool("norapid"),
+		UploadMode:    c.String("upload-mode"),
 		NoSplitFile:   true, // 天翼云盘不支持分片并发上传，只支持单线程上传，支持断点续传
 		ShowProgress:  !c.Bool("np"),
 		IsOverwrite:   true,
-		FamilyId:      parseFamilyId(c),
+		FamilyId:      familyId,
 		ExcludeNames: c.StringSlice("exn"),
+		ExcludeHidden: c.Bool("exclude-hidden"),
+		ExcludeSystem: c.Bool("exclude-system"),
 	}
 
 	localCount := c.NArg() - 1
@@ -0,0 +1,257 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctapi/cloudpan/apierror"
+	"github.com/phpc0de/ctapi/cloudpan/apiutil"
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/urfave/cli"
+)
+
+type (
+	// BatchRenameOptions 批量重命名可选项
+	BatchRenameOptions struct {
+		DryRun  bool // 只输出重命名预览, 不重命名
+		Confirm bool // 跳过确认提示, 直接重命名
+	}
+
+	// BatchRenameData 重命名模板可以使用的变量
+	BatchRenameData struct {
+		Name  string // 不含扩展名的原文件名
+		Ext   string // 原文件的扩展名, 包含 . , 例如 .mp4
+		Index int    // 匹配的文件的序号, 从1开始
+	}
+
+	// batchRenameItem 一个文件的重命名计划
+	batchRenameItem struct {
+		File    *cloudpan.AppFileEntity
+		NewName string
+	}
+
+	// batchRenameClient 重命名文件用到的网盘接口
+	batchRenameClient interface {
+		AppRenameFile(renameFileId string, newName string) (*cloudpan.AppFileEntity, *apierror.ApiError)
+		AppFamilyRenameFile(familyId int64, renameFileId string, newName string) (*cloudpan.AppFileEntity, *apierror.ApiError)
+	}
+)
+
+var (
+	// ErrBatchRenameNoMatch 目录中没有匹配的文件
+	ErrBatchRenameNoMatch = errors.New("没有匹配的文件")
+	// ErrBatchRenameDuplicateName 重命名后的文件名重复
+	ErrBatchRenameDuplicateName = errors.New("重命名后的文件名重复")
+)
+
+func CmdBatchRename() cli.Command {
+	return cli.Command{
+		Name:      "batchrename",
+		Usage:     "使用正则表达式和模板批量重命名文件",
+		UsageText: cmder.App().Name + " batchrename [-dry-run] [-confirm] <网盘目录> <正则表达式> <新文件名模板>",
+		Description: `
+	重命名网盘目录中文件名匹配正则表达式的文件 (不包括子目录和目录中的文件夹), 新文件名使用 Go 模板生成.
+	模板可以使用以下变量:
+	{{.Name}}  不含扩展名的原文件名
+	{{.Ext}}   原文件的扩展名, 包含 . , 例如 .mp4
+	{{.Index}} 匹配的文件按文件名排序后的序号, 从1开始, 可以使用 {{printf "%03d" .Index}} 补零
+
+	未指定 -confirm 时, 先输出重命名预览, 需要输入 y 确认后再重命名.
+
+	示例:
+
+	预览 /我的资源 目录中所有 mp4 文件重命名为 第1集.mp4, 第2集.mp4 ... 的结果, 不重命名
+	cloudpan189-go batchrename -dry-run /我的资源 "\.mp4$" "第{{.Index}}集{{.Ext}}"
+
+	把 /照片 目录中的 IMG_xxxx.jpg 重命名为 2024_001.jpg, 2024_002.jpg ..., 不需要确认
+	cloudpan189-go batchrename -confirm /照片 "^IMG_" '2024_{{printf "%03d" .Index}}{{.Ext}}'
+`,
+		Category: "天翼云盘",
+		Before:   cmder.ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 3 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			if config.Config.ActiveUser() == nil {
+				fmt.Println("未登录账号")
+				return nil
+			}
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			RunBatchRename(familyId, c.Args().Get(0), c.Args().Get(1), c.Args().Get(2), &BatchRenameOptions{
+				DryRun:  c.Bool("dry-run"),
+				Confirm: c.Bool("confirm"),
+			})
+			return nil
+		},
+		Flags: append([]cli.Flag{
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "只输出重命名预览, 不重命名",
+			},
+			cli.BoolFlag{
+				Name:  "confirm",
+				Usage: "跳过确认提示, 直接重命名",
+			},
+		}, FamilyFlags...),
+	}
+}
+
+// RunBatchRename 重命名网盘目录 cloudDir 中文件名匹配正则表达式 pattern 的文件, 新文件名由模板 replacement 生成
+func RunBatchRename(familyId int64, cloudDir string, pattern, replacement string, opt *BatchRenameOptions) {
+	if opt == nil {
+		opt = &BatchRenameOptions{}
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		fmt.Printf("正则表达式错误: %s\n", err)
+		return
+	}
+	tmpl, err := template.New("rename").Option("missingkey=error").Parse(replacement)
+	if err != nil {
+		fmt.Printf("新文件名模板错误: %s\n", err)
+		return
+	}
+
+	activeUser := GetActiveUser()
+	cloudDir = activeUser.PathJoin(familyId, cloudDir)
+	dir, apierr := activeUser.PanClient().AppFileInfoByPath(familyId, cloudDir)
+	if apierr != nil {
+		fmt.Printf("获取目录信息错误: %s, %s\n", cloudDir, apierr)
+		return
+	}
+	if !dir.IsFolder {
+		fmt.Printf("不是目录: %s\n", cloudDir)
+		return
+	}
+	files, err := appDirLister(familyId)(dir)
+	if err != nil {
+		fmt.Printf("获取文件列表错误: %s, %s\n", cloudDir, err)
+		return
+	}
+
+	items, err := planBatchRename(files, re, tmpl)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	renderBatchRenamePreview(os.Stdout, items)
+	if opt.DryRun {
+		return
+	}
+	if !opt.Confirm {
+		var confirm string
+		fmt.Printf("确认重命名以上 %d 个文件? (y/n) > ", len(items))
+		_, err := fmt.Scanln(&confirm)
+		if err != nil || (confirm != "y" && confirm != "Y") {
+			fmt.Printf("已取消\n")
+			return
+		}
+	}
+	applyBatchRename(os.Stdout, activeUser.PanClient(), familyId, items)
+}
+
+// renderBatchRenameName 使用模板 tmpl 生成第 index 个匹配的文件 name 的新文件名
+func renderBatchRenameName(tmpl *template.Template, name string, index int) (string, error) {
+	ext := path.Ext(name)
+	buf := &bytes.Buffer{}
+	err := tmpl.Execute(buf, &BatchRenameData{
+		Name:  strings.TrimSuffix(name, ext),
+		Ext:   ext,
+		Index: index,
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// planBatchRename 生成 files 中文件名匹配 re 的文件的重命名计划, 新文件名与原文件名相同的文件不重命名
+func planBatchRename(files cloudpan.AppFileList, re *regexp.Regexp, tmpl *template.Template) ([]*batchRenameItem, error) {
+	names := map[string]bool{}
+	for _, fe := range files {
+		names[fe.FileName] = true
+	}
+
+	items := make([]*batchRenameItem, 0, len(files))
+	index := 0
+	for _, fe := range files {
+		if fe.IsFolder || !re.MatchString(fe.FileName) {
+			continue
+		}
+		index++
+		newName, err := renderBatchRenameName(tmpl, fe.FileName, index)
+		if err != nil {
+			return nil, fmt.Errorf("生成新文件名错误: %s, %s", fe.FileName, err)
+		}
+		if newName == fe.FileName {
+			continue
+		}
+		if newName == "" || !apiutil.CheckFileNameValid(newName) {
+			return nil, fmt.Errorf("新文件名不合法: %s -> %s, 文件名不能为空或包含特殊字符: %s", fe.FileName, newName, apiutil.FileNameSpecialChars)
+		}
+		if names[newName] {
+			return nil, fmt.Errorf("%w: %s -> %s", ErrBatchRenameDuplicateName, fe.FileName, newName)
+		}
+		names[newName] = true
+		items = append(items, &batchRenameItem{File: fe, NewName: newName})
+	}
+	if index == 0 {
+		return nil, ErrBatchRenameNoMatch
+	}
+	return items, nil
+}
+
+// renderBatchRenamePreview 输出重命名预览
+func renderBatchRenamePreview(w io.Writer, items []*batchRenameItem) {
+	for _, item := range items {
+		fmt.Fprintf(w, "%s -> %s\n", item.File.FileName, item.NewName)
+	}
+	fmt.Fprintf(w, "共 %d 个文件需要重命名\n", len(items))
+}
+
+// applyBatchRename 按计划逐个重命名文件, 返回重命名失败的文件数量
+func applyBatchRename(w io.Writer, client batchRenameClient, familyId int64, items []*batchRenameItem) (failed int) {
+	for _, item := range items {
+		var apierr *apierror.ApiError
+		if IsFamilyCloud(familyId) {
+			_, apierr = client.AppFamilyRenameFile(familyId, item.File.FileId, item.NewName)
+		} else {
+			_, apierr = client.AppRenameFile(item.File.FileId, item.NewName)
+		}
+		if apierr != nil {
+			failed++
+			fmt.Fprintf(w, "重命名文件失败: %s -> %s, %s\n", item.File.FileName, item.NewName, apierr)
+			continue
+		}
+		fmt.Fprintf(w, "重命名文件成功: %s -> %s\n", item.File.FileName, item.NewName)
+	}
+	fmt.Fprintf(w, "重命名完成, 成功 %d 个, 失败 %d 个\n", len(items)-failed, failed)
+	return failed
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"testing"
+	"text/template"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctapi/cloudpan/apierror"
+)
+
+type testRenameClient struct {
+	renamed map[string]string
+}
+
+func (c *testRenameClient) AppRenameFile(renameFileId string, newName string) (*cloudpan.AppFileEntity, *apierror.ApiError) {
+	if renameFileId == "bad" {
+		return nil, apierror.NewFailedApiError("rename failed")
+	}
+	c.renamed[renameFileId] = newName
+	return &cloudpan.AppFileEntity{FileId: renameFileId, FileName: newName}, nil
+}
+
+func (c *testRenameClient) AppFamilyRenameFile(familyId int64, renameFileId string, newName string) (*cloudpan.AppFileEntity, *apierror.ApiError) {
+	return c.AppRenameFile(renameFileId, newName)
+}
+
+func testRenameFiles() cloudpan.AppFileList {
+	return cloudpan.AppFileList{
+		{FileId: "d1", FileName: "a.mp4", IsFolder: true},
+		{FileId: "f1", FileName: "a.mp4"},
+		{FileId: "f2", FileName: "b.mkv"},
+		{FileId: "f3", FileName: "c.mp4"},
+		{FileId: "f4", FileName: "notes.txt"},
+	}
+}
+
+func TestRenderBatchRenameName(t *testing.T) {
+	cases := []struct {
+		replacement string
+		name        string
+		index       int
+		expected    string
+	}{
+		{"第{{.Index}}集{{.Ext}}", "a.mp4", 1, "第1集.mp4"},
+		{`{{printf "%03d" .Index}}_{{.Name}}{{.Ext}}`, "a.b.mp4", 12, "012_a.b.mp4"},
+		{"{{.Name}}", "README", 1, "README"},
+	}
+	for _, c := range cases {
+		tmpl := template.Must(template.New("rename").Parse(c.replacement))
+		name, err := renderBatchRenameName(tmpl, c.name, c.index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.replacement, c.expected, name)
+		}
+	}
+
+	// 模板引用不存在的变量
+	tmpl := template.Must(template.New("rename").Parse("{{.Size}}"))
+	if _, err := renderBatchRenameName(tmpl, "a.mp4", 1); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestPlanBatchRename(t *testing.T) {
+	tmpl := template.Must(template.New("rename").Parse("第{{.Index}}集{{.Ext}}"))
+	items, err := planBatchRename(testRenameFiles(), regexp.MustCompile(`\.mp4$`), tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].File.FileId != "f1" || items[0].NewName != "第1集.mp4" ||
+		items[1].File.FileId != "f3" || items[1].NewName != "第2集.mp4" {
+		t.Fatalf("items: %+v", items)
+	}
+
+	// 没有匹配的文件
+	if _, err = planBatchRename(testRenameFiles(), regexp.MustCompile(`\.avi$`), tmpl); err != ErrBatchRenameNoMatch {
+		t.Fatalf("err: %v", err)
+	}
+
+	// 新文件名重复
+	tmpl = template.Must(template.New("rename").Parse("same{{.Ext}}"))
+	if _, err = planBatchRename(testRenameFiles(), regexp.MustCompile(`\.mp4$`), tmpl); !errors.Is(err, ErrBatchRenameDuplicateName) {
+		t.Fatalf("err: %v", err)
+	}
+
+	// 新文件名包含特殊字符
+	tmpl = template.Must(template.New("rename").Parse("a/{{.Name}}"))
+	if _, err = planBatchRename(testRenameFiles(), regexp.MustCompile(`\.mp4$`), tmpl); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestBatchRenameDryRunOutput(t *testing.T) {
+	tmpl := template.Must(template.New("rename").Parse("{{.Index}}{{.Ext}}"))
+	items, err := planBatchRename(testRenameFiles(), regexp.MustCompile(`^[ab]\.`), tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	renderBatchRenamePreview(buf, items)
+	expected := "a.mp4 -> 1.mp4\nb.mkv -> 2.mkv\n共 2 个文件需要重命名\n"
+	if buf.String() != expected {
+		t.Fatalf("output: %s", buf)
+	}
+}
+
+func TestApplyBatchRename(t *testing.T) {
+	client := &testRenameClient{renamed: map[string]string{}}
+	items := []*batchRenameItem{
+		{File: &cloudpan.AppFileEntity{FileId: "f1", FileName: "a.mp4"}, NewName: "1.mp4"},
+		{File: &cloudpan.AppFileEntity{FileId: "bad", FileName: "b.mp4"}, NewName: "2.mp4"},
+	}
+	buf := &bytes.Buffer{}
+	if failed := applyBatchRename(buf, client, 0, items); failed != 1 {
+		t.Fatalf("failed: %d, output: %s", failed, buf)
+	}
+	if len(client.renamed) != 1 || client.renamed["f1"] != "1.mp4" {
+		t.Fatalf("renamed: %v", client.renamed)
+	}
+}
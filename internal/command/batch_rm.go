@@ -0,0 +1,433 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctapi/cloudpan/apierror"
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/cmder/cmdtable"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/phpc0de/ctpango/internal/functions"
+	"github.com/phpc0de/ctpango/internal/taskframework"
+	"github.com/urfave/cli"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// deleteClient 删除文件用到的网盘接口
+	deleteClient interface {
+		AppFileInfoByPath(familyId int64, pathStr string) (*cloudpan.AppFileEntity, *apierror.ApiError)
+		CreateBatchTask(param *cloudpan.BatchTaskParam) (string, *apierror.ApiError)
+		CheckBatchTask(typeFlag cloudpan.BatchTaskType, taskId string) (*cloudpan.CheckTaskResult, *apierror.ApiError)
+		AppCreateBatchTask(familyId int64, param *cloudpan.BatchTaskParam) (string, *apierror.ApiError)
+		AppCheckBatchTask(typeFlag cloudpan.BatchTaskType, taskId string) (*cloudpan.CheckTaskResult, *apierror.ApiError)
+		RecycleDelete(familyId int64, fileIdList []string) *apierror.ApiError
+	}
+
+	// batchDeleteTaskUnit 批量删除的任务单元
+	batchDeleteTaskUnit struct {
+		taskInfo *taskframework.TaskInfo
+
+		PanClient  deleteClient
+		FamilyId   int64
+		PanPath    string                  // 要删除的网盘文件路径
+		FileEntity *cloudpan.AppFileEntity // 已获取的文件信息, 为空时根据 PanPath 获取
+		DryRun     bool                    // 只检查, 不删除
+		Mode       DeleteMode              // 删除方式
+
+		taskId     string                           // 已创建的删除任务, 重试时先查询该任务的状态, 不重新创建
+		lastResult *taskframework.TaskUnitRunResult // 最终的执行结果
+	}
+)
+
+const (
+	// DefaultBatchDeleteMaxRetry 批量删除失败最大重试次数
+	DefaultBatchDeleteMaxRetry = 3
+	// batchDeleteCheckTimes 每次执行时查询删除任务状态的最大次数
+	batchDeleteCheckTimes = 5
+)
+
+func CmdBatchDelete() cli.Command {
+	return cli.Command{
+		Name:      "batchrm",
+		Usage:     "根据列表文件批量删除文件/目录",
+		UsageText: cmder.App().Name + " batchrm <本地列表文件的路径>",
+		Description: `
+	读取本地列表文件中记录的网盘路径, 并逐个删除.
+	列表文件支持以下格式:
+	1. 纯文本, 每行一个网盘路径, 以 # 开头的行会被忽略
+	2. JSON数组, 例如: ["/我的资源/1.mp4", "/我的资源/2.mp4"]
+	3. export 命令导出的元数据文件, 每行一个JSON对象, 读取其中的 path 字段
+
+	删除失败的路径会写入错误报告文件, 该文件可以再次作为列表文件使用.
+	默认被删除的文件或目录会移入回收站, 可在网盘文件回收站找回.
+	-cloud-trash-on-delete 与默认方式相同, 文件移入回收站; 使用 -cloud-permanent-delete 彻底删除, 无法找回.
+
+	示例:
+
+	删除 /Users/tickstep/Downloads/rm_list.txt 里面记录的所有文件
+	cloudpan189-go batchrm /Users/tickstep/Downloads/rm_list.txt
+
+	只检查列表中的文件是否存在, 不删除
+	cloudpan189-go batchrm -dryrun /Users/tickstep/Downloads/rm_list.txt
+
+	删除失败的路径写入到 /Users/tickstep/Downloads/rm_failed.txt
+	cloudpan189-go batchrm -errlog /Users/tickstep/Downloads/rm_failed.txt /Users/tickstep/Downloads/rm_list.txt
+
+	彻底删除列表中的文件, 不保留在回收站
+	cloudpan189-go batchrm -cloud-permanent-delete /Users/tickstep/Downloads/rm_list.txt
+`,
+		Category: "天翼云盘",
+		Before:   cmder.ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if c.NArg() == 0 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			if config.Config.ActiveUser() == nil {
+				fmt.Println("未登录账号")
+				return nil
+			}
+			mode, err := deleteModeOf(c.Bool("cloud-trash-on-delete"), c.Bool("cloud-permanent-delete"))
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			RunBatchDelete(familyId, c.Args().Get(0), c.Bool("dryrun"), mode, c.Int("retry"), c.String("errlog"))
+			return nil
+		},
+		Flags: append([]cli.Flag{
+			cli.BoolFlag{
+				Name:  "dryrun",
+				Usage: "只检查列表中的文件是否存在, 不执行删除",
+			},
+			cli.IntFlag{
+				Name:  "retry",
+				Usage: "删除失败最大重试次数",
+				Value: DefaultBatchDeleteMaxRetry,
+			},
+			cli.StringFlag{
+				Name:  "errlog",
+				Usage: "删除失败的路径保存的文件, 默认为列表文件同目录下的 <列表文件名>.failed.txt",
+			},
+			cli.BoolFlag{
+				Name:  "cloud-trash-on-delete",
+				Usage: "文件移入回收站, 与默认的删除方式相同",
+			},
+			cli.BoolFlag{
+				Name:  "cloud-permanent-delete",
+				Usage: "彻底删除文件, 不保留在回收站, 无法找回",
+			},
+		}, FamilyFlags...),
+	}
+}
+
+// RunBatchDelete 执行 根据列表文件批量删除文件/目录
+func RunBatchDelete(familyId int64, listFilePath string, dryRun bool, mode DeleteMode, maxRetry int, errLogPath string) {
+	data, err := ioutil.ReadFile(listFilePath)
+	if err != nil {
+		fmt.Printf("读取列表文件出错: %s\n", err)
+		return
+	}
+
+	panPaths, err := parseBatchDeleteList(data)
+	if err != nil {
+		fmt.Printf("解析列表文件出错: %s\n", err)
+		return
+	}
+	if len(panPaths) == 0 {
+		fmt.Println("列表文件中没有有效的文件路径")
+		return
+	}
+
+	if maxRetry < 0 {
+		maxRetry = DefaultBatchDeleteMaxRetry
+	}
+
+	var (
+		activeUser = GetActiveUser()
+		executor   = taskframework.TaskExecutor{
+			IsFailedDeque: true, // 统计失败的列表
+		}
+	)
+	for _, p := range panPaths {
+		unit := &batchDeleteTaskUnit{
+			PanClient: activeUser.PanClient(),
+			FamilyId:  familyId,
+			PanPath:   path.Clean(activeUser.PathJoin(familyId, p)),
+			DryRun:    dryRun,
+			Mode:      mode,
+		}
+		executor.Append(unit, maxRetry)
+	}
+	executor.Execute()
+
+	failedList := executor.FailedDeque()
+	if failedList.Size() == 0 {
+		if dryRun {
+			fmt.Printf("\n检查结束, 共 %d 个文件/目录, 全部存在\n", len(panPaths))
+		} else {
+			if mode == DeleteModePermanent {
+				fmt.Printf("\n删除结束, 共彻底删除 %d 个文件/目录\n", len(panPaths))
+			} else {
+				fmt.Printf("\n删除结束, 共删除 %d 个文件/目录, 可在云盘文件回收站找回\n", len(panPaths))
+			}
+		}
+		return
+	}
+
+	if errLogPath == "" {
+		errLogPath = listFilePath + ".failed.txt"
+	}
+	failedPaths := make([]string, 0, failedList.Size())
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"#", "文件/目录"})
+	for e := failedList.Shift(); e != nil; e = failedList.Shift() {
+		item := e.(*taskframework.TaskInfoItem)
+		panPath := item.Unit.(*batchDeleteTaskUnit).PanPath
+		failedPaths = append(failedPaths, panPath)
+		tb.Append([]string{strconv.Itoa(len(failedPaths) - 1), panPath})
+	}
+
+	if dryRun {
+		fmt.Printf("\n检查结束, 共 %d 个文件/目录, 以下 %d 个文件/目录检查失败: \n", len(panPaths), len(failedPaths))
+	} else {
+		fmt.Printf("\n删除结束, 共 %d 个文件/目录, 以下 %d 个文件/目录删除失败: \n", len(panPaths), len(failedPaths))
+	}
+	tb.Render()
+
+	err = ioutil.WriteFile(errLogPath, []byte(strings.Join(failedPaths, "\n")+"\n"), 0644)
+	if err != nil {
+		fmt.Printf("保存错误报告文件出错: %s\n", err)
+		return
+	}
+	fmt.Printf("错误报告文件保存路径: %s\n", errLogPath)
+}
+
+// parseBatchDeleteList 解析列表文件, 支持纯文本, JSON数组以及 export 导出的元数据文件
+func parseBatchDeleteList(data []byte) ([]string, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	panPaths := make([]string, 0)
+	switch data[0] {
+	case '[':
+		// JSON数组
+		if err := json.Unmarshal(data, &panPaths); err != nil {
+			return nil, err
+		}
+		for k := range panPaths {
+			panPaths[k] = strings.TrimSpace(panPaths[k])
+		}
+	case '{':
+		// export 导出的元数据文件, 每行一个JSON对象
+		dec := json.NewDecoder(bytes.NewReader(data))
+		for {
+			item := ImportExportFileItem{}
+			err := dec.Decode(&item)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			panPaths = append(panPaths, strings.TrimSpace(item.Path))
+		}
+	default:
+		// 纯文本, 每行一个路径
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+			panPaths = append(panPaths, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	// 去除空路径
+	result := panPaths[:0]
+	for _, p := range panPaths {
+		if p != "" {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+func (bdu *batchDeleteTaskUnit) SetTaskInfo(info *taskframework.TaskInfo) {
+	bdu.taskInfo = info
+}
+
+func (bdu *batchDeleteTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
+	result = &taskframework.TaskUnitRunResult{}
+
+	var (
+		fe     = bdu.FileEntity
+		apierr *apierror.ApiError
+	)
+	if bdu.taskId != "" {
+		// 上次执行的删除任务未完成, 查询同一任务的状态, 文件可能已被删除, 不能重新获取文件信息
+		return bdu.checkTask(result)
+	}
+	if fe == nil {
+		fe, apierr = bdu.PanClient.AppFileInfoByPath(bdu.FamilyId, bdu.PanPath)
+		if apierr != nil {
+			result.ResultMessage = "获取文件信息错误"
+			result.Err = apierr
+			// 文件不存在则无需重试
+			result.NeedRetry = apierr.ErrCode() != apierror.ApiCodeFileNotFoundCode
+			return
+		}
+	}
+
+	if bdu.DryRun {
+		fmt.Printf("[%s] 文件存在, 将会被删除: %s\n", bdu.taskInfo.Id(), bdu.PanPath)
+		result.Succeed = true
+		return
+	}
+
+	isFolder := 0
+	if fe.IsFolder {
+		isFolder = 1
+	}
+	delParam := &cloudpan.BatchTaskParam{
+		TypeFlag: cloudpan.BatchTaskTypeDelete,
+		TaskInfos: cloudpan.BatchTaskInfoList{
+			&cloudpan.BatchTaskInfo{
+				FileId:      fe.FileId,
+				FileName:    fe.FileName,
+				IsFolder:    isFolder,
+				SrcParentId: fe.ParentId,
+			},
+		},
+	}
+
+	var taskId string
+	if IsFamilyCloud(bdu.FamilyId) {
+		taskId, apierr = bdu.PanClient.AppCreateBatchTask(bdu.FamilyId, delParam)
+	} else {
+		taskId, apierr = bdu.PanClient.CreateBatchTask(delParam)
+	}
+	if apierr != nil {
+		result.ResultMessage = "创建删除任务错误"
+		result.Err = apierr
+		result.NeedRetry = true
+		return
+	}
+	bdu.FileEntity, bdu.taskId = fe, taskId
+	return bdu.checkTask(result)
+}
+
+// checkTask 查询删除任务的状态, 任务完成后彻底删除或输出结果, 未完成时重试并再次查询
+func (bdu *batchDeleteTaskUnit) checkTask(result *taskframework.TaskUnitRunResult) *taskframework.TaskUnitRunResult {
+	var (
+		fe      = bdu.FileEntity
+		taskRes *cloudpan.CheckTaskResult
+		apierr  *apierror.ApiError
+	)
+	for i := 0; i < batchDeleteCheckTimes; i++ {
+		time.Sleep(time.Duration(200) * time.Millisecond)
+		if IsFamilyCloud(bdu.FamilyId) {
+			taskRes, apierr = bdu.PanClient.AppCheckBatchTask(cloudpan.BatchTaskTypeDelete, bdu.taskId)
+		} else {
+			taskRes, apierr = bdu.PanClient.CheckBatchTask(cloudpan.BatchTaskTypeDelete, bdu.taskId)
+		}
+		if apierr != nil {
+			result.ResultMessage = "查询删除任务错误"
+			result.Err = apierr
+			result.NeedRetry = true
+			return result
+		}
+		if taskRes.TaskStatus == cloudpan.BatchTaskStatusOk {
+			break
+		}
+	}
+	if taskRes.TaskStatus != cloudpan.BatchTaskStatusOk {
+		result.ResultMessage = "删除任务未完成"
+		result.NeedRetry = true
+		return result
+	}
+
+	if bdu.Mode == DeleteModePermanent {
+		familyId := bdu.FamilyId
+		if !IsFamilyCloud(familyId) {
+			familyId = 0
+		}
+		apierr = bdu.PanClient.RecycleDelete(familyId, []string{fe.FileId})
+		if apierr != nil {
+			result.ResultMessage = "文件已移入回收站, 但彻底删除失败"
+			result.Err = apierr
+			// 文件已不在原路径, 重试无法再次找到
+			result.NeedRetry = false
+			return result
+		}
+		fmt.Printf("[%s] 已彻底删除: %s\n", bdu.taskInfo.Id(), bdu.PanPath)
+		result.Succeed = true
+		return result
+	}
+
+	fmt.Printf("[%s] 已删除: %s\n", bdu.taskInfo.Id(), bdu.PanPath)
+	result.Succeed = true
+	return result
+}
+
+func (bdu *batchDeleteTaskUnit) OnRetry(lastRunResult *taskframework.TaskUnitRunResult) {
+	if lastRunResult.Err == nil {
+		fmt.Printf("[%s] %s, 重试 %d/%d\n", bdu.taskInfo.Id(), lastRunResult.ResultMessage, bdu.taskInfo.Retry(), bdu.taskInfo.MaxRetry())
+		return
+	}
+	fmt.Printf("[%s] %s, %s, 重试 %d/%d\n", bdu.taskInfo.Id(), lastRunResult.ResultMessage, lastRunResult.Err, bdu.taskInfo.Retry(), bdu.taskInfo.MaxRetry())
+}
+
+func (bdu *batchDeleteTaskUnit) OnSuccess(lastRunResult *taskframework.TaskUnitRunResult) {
+	bdu.lastResult = lastRunResult
+}
+
+func (bdu *batchDeleteTaskUnit) OnFailed(lastRunResult *taskframework.TaskUnitRunResult) {
+	bdu.lastResult = lastRunResult
+	if lastRunResult.Err == nil {
+		fmt.Printf("[%s] %s: %s\n", bdu.taskInfo.Id(), lastRunResult.ResultMessage, bdu.PanPath)
+		return
+	}
+	fmt.Printf("[%s] %s, %s: %s\n", bdu.taskInfo.Id(), lastRunResult.ResultMessage, lastRunResult.Err, bdu.PanPath)
+}
+
+func (bdu *batchDeleteTaskUnit) OnComplete(lastRunResult *taskframework.TaskUnitRunResult) {
+}
+
+func (bdu *batchDeleteTaskUnit) RetryWait() time.Duration {
+	return functions.RetryWait(bdu.taskInfo.Retry())
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBatchDeleteList(t *testing.T) {
+	expected := []string{"/我的资源/1.mp4", "/我的资源/2.mp4"}
+	cases := map[string]string{
+		"text":   "/我的资源/1.mp4\r\n\n# comment\n  /我的资源/2.mp4  \n",
+		"json":   `["/我的资源/1.mp4", "", "/我的资源/2.mp4"]`,
+		"export": "{\"md5\":\"3F9EEEBC4E583574D9D64A75E5061E56\",\"size\":1,\"path\":\"/我的资源/1.mp4\"}\n{\"md5\":\"3F9EEEBC4E583574D9D64A75E5061E56\",\"size\":2,\"path\":\"/我的资源/2.mp4\"}\n",
+	}
+	for name, data := range cases {
+		paths, err := parseBatchDeleteList([]byte(data))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !reflect.DeepEqual(paths, expected) {
+			t.Fatalf("%s: got %v, want %v", name, paths, expected)
+		}
+	}
+
+	if _, err := parseBatchDeleteList([]byte(`["/我的资源/1.mp4"`)); err == nil {
+		t.Fatal("expected error for broken json")
+	}
+}
+
+func TestBatchDeleteTaskPending(t *testing.T) {
+	client := newFakeDeleteClient()
+	// 第一次执行时删除任务一直未完成, 文件已不在原路径
+	client.pending["1"] = batchDeleteCheckTimes + 1
+	unit := &batchDeleteTaskUnit{
+		PanClient: client,
+		PanPath:   "/a.txt",
+	}
+	executeDeleteUnits([]*batchDeleteTaskUnit{unit}, 1)
+
+	if unit.lastResult == nil || !unit.lastResult.Succeed {
+		t.Fatalf("result = %+v, want succeed", unit.lastResult)
+	}
+	if len(client.taskFiles) != 1 || len(client.deleted) != 1 {
+		t.Errorf("tasks = %v, deleted = %v, want 1 each", client.taskFiles, client.deleted)
+	}
+}
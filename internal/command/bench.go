@@ -0,0 +1,293 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctlibgo/converter"
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/cmder/cmdtable"
+	"github.com/phpc0de/ctpango/internal/apistat"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/phpc0de/ctpango/internal/file/downloader"
+	"github.com/phpc0de/ctpango/internal/functions/panupload"
+	"github.com/phpc0de/ctpango/internal/localfile"
+	"github.com/phpc0de/ctpango/internal/taskframework"
+	"github.com/phpc0de/ctpango/library/requester/transfer"
+	"github.com/urfave/cli"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type (
+	// benchResult 测速结果
+	benchResult struct {
+		name    string
+		size    int64
+		elapsed time.Duration
+		err     error
+	}
+)
+
+var (
+	// BenchDownloadParallels 下载测速使用的线程数
+	BenchDownloadParallels = []int{1, 2, 4, 8}
+
+	// DefaultBenchUploadSize 上传测速默认使用的文件大小
+	DefaultBenchUploadSize = 16 * converter.MB
+)
+
+func CmdBench() cli.Command {
+	return cli.Command{
+		Name:      "bench",
+		Usage:     "测试下载/上传速度",
+		UsageText: cmder.App().Name + " bench <网盘文件的路径>",
+		Description: `
+	下载指定的网盘文件进行测速, 分别使用 1, 2, 4, 8 个线程下载, 并输出各自的下载速度,
+	可根据结果设置合适的下载线程数 (download -p 或 config set -max_download_parallel).
+	下载的数据保存在临时文件中, 测速完成后会被删除. 建议使用 50MB 以上的文件进行测速.
+
+	示例:
+
+	使用 /我的资源/1.mp4 进行下载测速
+	cloudpan189-go bench /我的资源/1.mp4
+
+	同时测试上传速度, 上传一个 16MB 的临时文件到 /我的资源 目录, 测速完成后会被删除
+	cloudpan189-go bench -upload /我的资源/1.mp4
+
+	上传测速使用 64MB 的临时文件
+	cloudpan189-go bench -upload -size 64MB /我的资源/1.mp4
+`,
+		Category: "天翼云盘",
+		Before:   cmder.ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if c.NArg() == 0 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			if config.Config.ActiveUser() == nil {
+				fmt.Println("未登录账号")
+				return nil
+			}
+
+			uploadSize := DefaultBenchUploadSize
+			if c.IsSet("size") {
+				size, err := converter.ParseFileSizeStr(c.String("size"))
+				if err != nil || size <= 0 {
+					fmt.Printf("上传测速文件大小错误: %s\n", c.String("size"))
+					return nil
+				}
+				uploadSize = size
+			}
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			RunBench(familyId, c.Args().Get(0), c.Bool("upload"), uploadSize)
+			return nil
+		},
+		Flags: append([]cli.Flag{
+			cli.BoolFlag{
+				Name:  "upload",
+				Usage: "同时测试上传速度, 上传临时文件到测速文件所在的网盘目录",
+			},
+			cli.StringFlag{
+				Name:  "size",
+				Usage: "上传测速使用的临时文件大小, 默认16MB",
+			},
+		}, FamilyFlags...),
+	}
+}
+
+// RunBench 执行下载/上传测速
+func RunBench(familyId int64, panPath string, isUpload bool, uploadSize int64) {
+	activeUser := GetActiveUser()
+	panPath = path.Clean(activeUser.PathJoin(familyId, panPath))
+	fileInfo, apierr := activeUser.PanClient().AppFileInfoByPath(familyId, panPath)
+	if apierr != nil {
+		fmt.Printf("获取网盘文件信息错误: %s\n", apierr)
+		return
+	}
+	if fileInfo.IsFolder {
+		fmt.Println("测速需要指定一个文件, 而不是目录")
+		return
+	}
+	if fileInfo.FileSize == 0 {
+		fmt.Println("测速文件大小为0, 请使用其他文件")
+		return
+	}
+
+	results := make([]*benchResult, 0, len(BenchDownloadParallels)+1)
+	for _, parallel := range BenchDownloadParallels {
+		fmt.Printf("[%d线程] 下载测速中, 请稍候...\n", parallel)
+		r := benchDownload(activeUser.PanClient(), familyId, fileInfo, parallel)
+		results = append(results, r)
+	}
+
+	if isUpload {
+		fmt.Printf("上传测速中, 请稍候...\n")
+		results = append(results, benchUpload(activeUser.PanClient(), familyId, path.Dir(panPath), uploadSize))
+	}
+
+	fmt.Printf("\n测速结果, 测速文件: %s\n", panPath)
+	renderBenchResults(results)
+}
+
+// benchDownload 使用指定的线程数下载文件, 数据写入临时文件
+func benchDownload(panClient *apistat.PanClient, familyId int64, fileInfo *cloudpan.AppFileEntity, parallel int) *benchResult {
+	r := &benchResult{
+		name: fmt.Sprintf("下载 (%d线程)", parallel),
+		size: fileInfo.FileSize,
+	}
+
+	tmpFile, err := ioutil.TempFile("", "cloudpan189-bench-")
+	if err != nil {
+		r.err = err
+		return r
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	writer, file, err := downloader.NewDownloaderWriterByFilename(tmpFile.Name(), os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	defer file.Close()
+
+	cfg := &downloader.Config{
+		Mode:                       transfer.RangeGenMode_BlockSize,
+		MaxParallel:                parallel,
+		CacheSize:                  config.Config.CacheSize,
+		BlockSize:                  MaxDownloadRangeSize,
+		InstanceStateStorageFormat: downloader.InstanceStateStorageFormatJSON,
+	}
+	if cfg.CacheSize == 0 {
+		cfg.CacheSize = int(DownloadCacheSize)
+	}
+
+	der := downloader.NewDownloader(writer, cfg, panClient)
+	der.SetFileInfo(fileInfo)
+	der.SetFamilyId(familyId)
+
+	startTime := time.Now()
+	r.err = der.Execute()
+	r.elapsed = time.Since(startTime)
+	return r
+}
+
+// benchUpload 生成随机数据的临时文件并上传, 上传完成后删除网盘中的文件
+func benchUpload(panClient *apistat.PanClient, familyId int64, panDir string, size int64) *benchResult {
+	r := &benchResult{
+		name: "上传",
+		size: size,
+	}
+
+	tmpFile, err := ioutil.TempFile("", "cloudpan189-bench-")
+	if err != nil {
+		r.err = err
+		return r
+	}
+	defer os.Remove(tmpFile.Name())
+	// 随机数据, 避免触发秒传
+	_, err = io.CopyN(tmpFile, rand.Reader, size)
+	tmpFile.Close()
+	if err != nil {
+		r.err = err
+		return r
+	}
+
+	uploadDatabase, err := panupload.NewUploadingDatabase()
+	if err != nil {
+		r.err = err
+		return r
+	}
+	defer uploadDatabase.Close()
+
+	var (
+		executor  = &taskframework.TaskExecutor{}
+		statistic = &panupload.UploadStatistic{}
+		savePath  = path.Join(panDir, filepath.Base(tmpFile.Name())+".tmp")
+	)
+	executor.Append(&panupload.UploadTaskUnit{
+		LocalFileChecksum: localfile.NewLocalFileEntity(tmpFile.Name()),
+		SavePath:          savePath,
+		FamilyId:          familyId,
+		PanClient:         panClient,
+		UploadingDatabase: uploadDatabase,
+		FolderCreateMutex: &sync.Mutex{},
+		Parallel:          1,
+		NoRapidUpload:     true,
+		UploadMode:        panupload.UploadModeMultipart,
+		NoSplitFile:       true,
+		UploadStatistic:   statistic,
+	}, 0)
+
+	startTime := time.Now()
+	executor.Execute()
+	r.elapsed = time.Since(startTime)
+
+	if statistic.TotalSize() != size {
+		r.err = fmt.Errorf("上传测速文件失败")
+		return r
+	}
+
+	// 删除网盘中的测速文件
+	units, err := newRmTaskUnits(GetActivePanClient(), familyId, []string{savePath}, false, DeleteModeDefault)
+	if err != nil {
+		fmt.Printf("删除测速文件失败: %s\n", err)
+		return r
+	}
+	executeDeleteUnits(units, DefaultRmMaxRetry)
+	return r
+}
+
+func renderBenchResults(results []*benchResult) {
+	var best *benchResult
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"#", "测速项", "数据量", "耗时", "平均速度"})
+	tb.SetColumnAlignment([]int{tablewriter.ALIGN_DEFAULT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+	for k, r := range results {
+		if r.err != nil {
+			tb.Append([]string{strconv.Itoa(k), r.name, converter.ConvertFileSize(r.size, 2), "-", "失败: " + r.err.Error()})
+			continue
+		}
+		tb.Append([]string{strconv.Itoa(k), r.name, converter.ConvertFileSize(r.size, 2), (r.elapsed / 1e6 * 1e6).String(), converter.ConvertFileSize(r.speedsPerSecond(), 2) + "/s"})
+		if r.name != "上传" && (best == nil || r.speedsPerSecond() > best.speedsPerSecond()) {
+			best = r
+		}
+	}
+	tb.Render()
+
+	if best != nil {
+		fmt.Printf("\n下载速度最快的是: %s\n", best.name)
+	}
+}
+
+func (r *benchResult) speedsPerSecond() int64 {
+	if r.elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(r.size) / r.elapsed.Seconds())
+}
@@ -0,0 +1,213 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctapi/cloudpan/apierror"
+	"github.com/phpc0de/ctlibgo/requester"
+	"github.com/phpc0de/ctlibgo/requester/rio/speeds"
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/phpc0de/ctpango/library/requester/transfer"
+	"github.com/urfave/cli"
+)
+
+type (
+	// catDataClient 读取网盘文件数据使用的接口
+	catDataClient interface {
+		AppDownloadFileData(downloadFileUrl string, fileRange cloudpan.AppFileDownloadRange, downloadFunc cloudpan.DownloadFuncCallback) *apierror.ApiError
+	}
+
+	// rateLimitWriter 按 rl 限速写入数据
+	rateLimitWriter struct {
+		w  io.Writer
+		rl *speeds.RateLimit
+	}
+)
+
+var (
+	// ErrCatRangeInvalid offset 或 length 错误
+	ErrCatRangeInvalid = errors.New("offset 和 length 不能小于0")
+)
+
+func CmdCat() cli.Command {
+	return cli.Command{
+		Name:      "cat",
+		Usage:     "输出网盘文件内容到标准输出",
+		UsageText: cmder.App().Name + " cat [--offset <偏移>] [--length <长度>] <文件路径>",
+		Description: `
+	不保存到本地, 直接输出网盘文件的内容, 适合预览网盘中的日志文件或脚本.
+	下载速度受 max_download_rate 限制.
+
+	示例:
+
+	输出 /我的资源/run.sh 的内容
+	cloudpan189-go cat /我的资源/run.sh
+
+	输出 /我的资源/app.log 从第 1024 个字节开始的 4096 个字节
+	cloudpan189-go cat --offset 1024 --length 4096 /我的资源/app.log
+
+	查看 /我的资源/app.log 的内容, 配合 grep 使用
+	cloudpan189-go cat /我的资源/app.log | grep ERROR
+`,
+		Category: "天翼云盘",
+		Before:   cmder.ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			if config.Config.ActiveUser() == nil {
+				fmt.Fprintln(os.Stderr, "未登录账号")
+				return nil
+			}
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			RunCatRange(familyId, c.Args().Get(0), c.Int64("offset"), c.Int64("length"))
+			return nil
+		},
+		Flags: append([]cli.Flag{
+			cli.Int64Flag{
+				Name:  "offset",
+				Usage: "从文件的第 offset 个字节开始输出, 从0开始计算",
+			},
+			cli.Int64Flag{
+				Name:  "length",
+				Usage: "最多输出的字节数, 0为输出到文件末尾",
+			},
+		}, FamilyFlags...),
+	}
+}
+
+// RunCat 执行 输出网盘文件的全部内容到标准输出
+func RunCat(familyId int64, cloudPath string) {
+	RunCatRange(familyId, cloudPath, 0, 0)
+}
+
+// RunCatRange 执行 输出网盘文件从 offset 开始的 length 个字节到标准输出, length 为0输出到文件末尾.
+// 错误信息输出到标准错误, 避免混入文件内容
+func RunCatRange(familyId int64, cloudPath string, offset, length int64) {
+	if offset < 0 || length < 0 {
+		fmt.Fprintln(os.Stderr, ErrCatRangeInvalid)
+		return
+	}
+
+	activeUser := GetActiveUser()
+	panClient := activeUser.PanClient()
+	cloudPath = activeUser.PathJoin(familyId, cloudPath)
+	fileInfo, apierr := panClient.AppFileInfoByPath(familyId, cloudPath)
+	if apierr != nil {
+		fmt.Fprintf(os.Stderr, "获取网盘文件信息错误: %s, %s\n", cloudPath, apierr)
+		return
+	}
+	if fileInfo.IsFolder {
+		fmt.Fprintf(os.Stderr, "不支持输出目录: %s\n", cloudPath)
+		return
+	}
+	if offset >= fileInfo.FileSize {
+		// 超出文件大小, 没有内容可输出
+		return
+	}
+
+	var durl string
+	if IsFamilyCloud(familyId) {
+		durl, apierr = panClient.AppFamilyGetFileDownloadUrl(familyId, fileInfo.FileId)
+	} else {
+		durl, apierr = panClient.AppGetFileDownloadUrl(fileInfo.FileId)
+	}
+	if apierr != nil {
+		fmt.Fprintf(os.Stderr, "获取下载链接错误: %s, %s\n", cloudPath, apierr)
+		return
+	}
+
+	rate := config.Config.MaxDownloadRate
+	if rateAt := downloadRateSchedule(); rateAt != nil {
+		rate = rateAt(time.Now())
+	}
+	var rl *speeds.RateLimit
+	if rate > 0 {
+		rl = speeds.NewRateLimit(transfer.RateLimitValue(rate))
+		defer rl.Stop()
+	}
+
+	err := catFile(os.Stdout, panClient, config.Config.HTTPClient(""), durl, offset, length, rl)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取网盘文件错误: %s, %s\n", cloudPath, err)
+	}
+}
+
+// catFile 读取下载链接 durl 从 offset 开始的 length 个字节并写入 w, length 为0读取到文件末尾.
+// 服务器不支持 Range 时跳过 offset 之前的数据. rl 不为nil时限速
+func catFile(w io.Writer, dataClient catDataClient, client *requester.HTTPClient, durl string, offset, length int64, rl *speeds.RateLimit) error {
+	fileRange := cloudpan.AppFileDownloadRange{
+		Offset: offset,
+	}
+	if length > 0 {
+		fileRange.End = offset + length - 1
+	}
+
+	var (
+		resp *http.Response
+		err  error
+	)
+	apierr := dataClient.AppDownloadFileData(durl, fileRange, func(httpMethod, fullUrl string, headers map[string]string) (*http.Response, error) {
+		resp, err = client.Req(httpMethod, fullUrl, nil, headers)
+		return resp, err
+	})
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if apierr != nil {
+		return apierr
+	}
+
+	body := io.Reader(resp.Body)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if offset > 0 {
+			// 服务器不支持断点续传, 跳过 offset 之前的数据
+			if _, err = io.CopyN(io.Discard, body, offset); err != nil {
+				return err
+			}
+		}
+	case http.StatusPartialContent:
+	default:
+		return fmt.Errorf("HTTP状态码: %s", resp.Status)
+	}
+	if length > 0 {
+		body = io.LimitReader(body, length)
+	}
+
+	if rl != nil {
+		w = &rateLimitWriter{w: w, rl: rl}
+	}
+	_, err = io.Copy(w, body)
+	return err
+}
+
+func (rw *rateLimitWriter) Write(p []byte) (int, error) {
+	rw.rl.Add(int64(len(p))) // 限速阻塞
+	return rw.w.Write(p)
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctlibgo/requester"
+)
+
+const catTestContent = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// newCatTestServer 返回支持或不支持 Range 的测试服务器, 记录收到的 Range 头
+func newCatTestServer(supportRange bool, gotRange *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*gotRange = r.Header.Get("Range")
+		if !supportRange || *gotRange == "" {
+			w.Write([]byte(catTestContent))
+			return
+		}
+		var start, end int64
+		rs := strings.SplitN(strings.TrimPrefix(*gotRange, "bytes="), "-", 2)
+		start, _ = strconv.ParseInt(rs[0], 10, 64)
+		end = int64(len(catTestContent)) - 1
+		if rs[1] != "" {
+			end, _ = strconv.ParseInt(rs[1], 10, 64)
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(catTestContent)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(catTestContent[start : end+1]))
+	}))
+}
+
+func TestCatFile(t *testing.T) {
+	testCases := []struct {
+		name         string
+		supportRange bool
+		offset       int64
+		length       int64
+		wantRange    string
+		want         string
+	}{
+		{"whole file", true, 0, 0, "", catTestContent},
+		{"offset and length", true, 10, 5, "bytes=10-14", "abcde"},
+		{"offset only", true, 30, 0, "bytes=30-", "uvwxyz"},
+		{"length only", true, 0, 3, "bytes=0-2", "012"},
+		{"no range support", false, 10, 5, "bytes=10-14", "abcde"},
+	}
+
+	panClient := cloudpan.NewPanClient(cloudpan.WebLoginToken{}, cloudpan.AppLoginToken{})
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotRange string
+			server := newCatTestServer(tc.supportRange, &gotRange)
+			defer server.Close()
+
+			buf := &bytes.Buffer{}
+			err := catFile(buf, panClient, requester.NewHTTPClient(), server.URL+"/file?id=1", tc.offset, tc.length, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotRange != tc.wantRange {
+				t.Errorf("Range = %q, want %q", gotRange, tc.wantRange)
+			}
+			if buf.String() != tc.want {
+				t.Errorf("output = %q, want %q", buf.String(), tc.want)
+			}
+		})
+	}
+}
+
+func TestCatFileHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	panClient := cloudpan.NewPanClient(cloudpan.WebLoginToken{}, cloudpan.AppLoginToken{})
+	buf := &bytes.Buffer{}
+	if err := catFile(buf, panClient, requester.NewHTTPClient(), server.URL+"/file?id=1", 0, 0, nil); err == nil {
+		t.Fatal("expected error for HTTP 403")
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("output = %q, want empty", buf.String())
+	}
+}
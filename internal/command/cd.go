@@ -50,16 +50,15 @@ func CmdCd() cli.Command {
 				fmt.Println("未登录账号")
 				return nil
 			}
-			RunChangeDirectory(parseFamilyId(c), c.Args().Get(0))
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			RunChangeDirectory(familyId, c.Args().Get(0))
 			return nil
 		},
-		Flags: []cli.Flag{
-			cli.StringFlag{
-				Name:  "familyId",
-				Usage: "家庭云ID",
-				Value: "",
-			},
-		},
+		Flags: FamilyFlags,
 	}
 }
 
@@ -0,0 +1,194 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctapi/cloudpan/apierror"
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/cmder/cmdtable"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/phpc0de/ctpango/internal/functions/pandiff"
+	"github.com/phpc0de/ctpango/internal/functions/pandownload"
+	"github.com/urfave/cli"
+)
+
+const (
+	// CheckStatusPass 本地文件与云盘文件的md5一致
+	CheckStatusPass = "PASS"
+	// CheckStatusFail 本地文件与云盘文件的md5不一致, 或云盘文件不存在
+	CheckStatusFail = "FAIL"
+)
+
+type (
+	// CheckResult 一个本地文件的校验结果
+	CheckResult struct {
+		Path        string // 相对于本地目录的路径
+		ExpectedMD5 string // 云盘记录的md5
+		ActualMD5   string // 本地文件的md5
+		Err         error  // 获取云盘文件信息或读取本地文件的错误
+	}
+
+	// checkClient 校验文件用到的网盘接口
+	checkClient interface {
+		AppFileInfoByPath(familyId int64, pathStr string) (*cloudpan.AppFileEntity, *apierror.ApiError)
+	}
+)
+
+// Passed 是否校验通过
+func (cr *CheckResult) Passed() bool {
+	return cr.Err == nil && cr.ExpectedMD5 != "" && strings.EqualFold(cr.ExpectedMD5, cr.ActualMD5)
+}
+
+// Status 校验结果, PASS 或 FAIL
+func (cr *CheckResult) Status() string {
+	if cr.Passed() {
+		return CheckStatusPass
+	}
+	return CheckStatusFail
+}
+
+func CmdCheck() cli.Command {
+	return cli.Command{
+		Name:      "check",
+		Usage:     "校验本地已下载的文件与云盘文件是否一致",
+		UsageText: cmder.App().Name + " check <本地目录> <云盘目录>",
+		Description: `
+	遍历本地目录下的所有文件, 按相对路径找到云盘目录中对应的文件, 比较本地文件和云盘文件的md5.
+	输出每个文件的路径, 云盘记录的md5, 本地文件的md5, 以及校验结果 PASS 或 FAIL,
+	云盘中不存在对应文件的也为 FAIL. 最后输出校验的文件总数, 通过数和失败数.
+
+	示例:
+
+	校验从云盘 /我的资源 下载到 d:/panfile 的文件
+	cloudpan189-go check d:/panfile /我的资源
+
+	校验从家庭云下载的文件
+	cloudpan189-go check -familyId 12345 d:/panfile /我的资源
+`,
+		Category: "天翼云盘",
+		Before:   cmder.ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 2 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			if config.Config.ActiveUser() == nil {
+				fmt.Println("未登录账号")
+				return nil
+			}
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			RunCheck(familyId, c.Args().Get(0), c.Args().Get(1))
+			return nil
+		},
+		Flags: FamilyFlags,
+	}
+}
+
+// RunCheck 校验本地目录 localDir 下的文件与云盘目录 cloudDir 中对应文件的md5
+func RunCheck(familyId int64, localDir, cloudDir string) {
+	localDir = filepath.Clean(localDir)
+	if fi, err := os.Stat(localDir); err != nil {
+		fmt.Println(err)
+		return
+	} else if !fi.IsDir() {
+		fmt.Printf("本地路径不是目录: %s\n", localDir)
+		return
+	}
+
+	activeUser := GetActiveUser()
+	cloudDir = path.Clean(activeUser.PathJoin(familyId, cloudDir))
+	results, err := checkLocalFiles(activeUser.PanClient(), familyId, localDir, cloudDir)
+	if err != nil {
+		fmt.Printf("获取本地文件列表错误: %s\n", err)
+		return
+	}
+	renderCheckResults(os.Stdout, results)
+}
+
+// checkLocalFiles 逐个获取本地文件对应的云盘文件信息, 并计算本地文件的md5
+func checkLocalFiles(client checkClient, familyId int64, localDir, cloudDir string) ([]*CheckResult, error) {
+	localFiles, err := pandiff.LocalFiles(localDir)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*CheckResult, 0, len(localFiles))
+	for _, entry := range localFiles {
+		result := &CheckResult{
+			Path: entry.Path,
+		}
+		results = append(results, result)
+
+		fileInfo, apierr := client.AppFileInfoByPath(familyId, path.Join(cloudDir, entry.Path))
+		if apierr != nil {
+			if apierr.ErrCode() == apierror.ApiCodeFileNotFoundCode {
+				result.Err = fmt.Errorf("云盘文件不存在")
+			} else {
+				result.Err = apierr
+			}
+			continue
+		}
+		if fileInfo.IsFolder {
+			result.Err = fmt.Errorf("云盘路径是目录")
+			continue
+		}
+		result.ExpectedMD5 = strings.ToLower(fileInfo.FileMd5)
+
+		result.ActualMD5, result.Err = pandownload.FileChecksum(entry.LocalPath, pandownload.HashAlgorithmMD5)
+	}
+	return results, nil
+}
+
+// renderCheckResults 输出校验结果表格和统计, 返回通过数和失败数
+func renderCheckResults(w io.Writer, results []*CheckResult) (passed, failed int) {
+	tb := cmdtable.NewTable(w)
+	tb.SetHeader([]string{"#", "文件路径", "云盘MD5", "本地MD5", "结果"})
+	tb.SetColumnAlignment([]int{tablewriter.ALIGN_DEFAULT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_CENTER})
+	for k, result := range results {
+		status := result.Status()
+		if result.Passed() {
+			passed++
+		} else {
+			failed++
+		}
+		expected, actual := result.ExpectedMD5, result.ActualMD5
+		if result.Err != nil {
+			status += ": " + result.Err.Error()
+		}
+		if expected == "" {
+			expected = "-"
+		}
+		if actual == "" {
+			actual = "-"
+		}
+		tb.Append([]string{strconv.Itoa(k + 1), result.Path, expected, actual, status})
+	}
+	tb.Render()
+	fmt.Fprintf(w, "\n共校验 %d 个文件, 通过 %d 个, 失败 %d 个\n", len(results), passed, failed)
+	return
+}
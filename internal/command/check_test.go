@@ -0,0 +1,100 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctapi/cloudpan/apierror"
+)
+
+// fakeCheckClient 模拟网盘, 记录每个文件的md5
+type fakeCheckClient map[string]string // path -> md5
+
+func (f fakeCheckClient) AppFileInfoByPath(familyId int64, pathStr string) (*cloudpan.AppFileEntity, *apierror.ApiError) {
+	md5Sum, ok := f[pathStr]
+	if !ok {
+		return nil, apierror.NewApiError(apierror.ApiCodeFileNotFoundCode, "file not found")
+	}
+	return &cloudpan.AppFileEntity{Path: pathStr, FileMd5: strings.ToUpper(md5Sum)}, nil
+}
+
+func md5Hex(data string) string {
+	sum := md5.Sum([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCheckLocalFiles(t *testing.T) {
+	localDir := t.TempDir()
+	files := map[string]string{
+		"match.txt":         "same content",
+		"sub/mismatch.txt":  "local content",
+		"sub/not_found.txt": "only local",
+	}
+	for name, content := range files {
+		p := filepath.Join(localDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client := fakeCheckClient{
+		"/pan/match.txt":        md5Hex("same content"),
+		"/pan/sub/mismatch.txt": md5Hex("cloud content"),
+	}
+
+	results, err := checkLocalFiles(client, 0, localDir, "/pan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPath := map[string]*CheckResult{}
+	for _, r := range results {
+		byPath[r.Path] = r
+	}
+	if len(byPath) != 3 {
+		t.Fatalf("results: %v", results)
+	}
+
+	if r := byPath["match.txt"]; !r.Passed() || r.ActualMD5 != md5Hex("same content") {
+		t.Errorf("match.txt: %+v", r)
+	}
+	if r := byPath["sub/mismatch.txt"]; r.Passed() || r.Status() != CheckStatusFail || r.Err != nil ||
+		r.ExpectedMD5 != md5Hex("cloud content") || r.ActualMD5 != md5Hex("local content") {
+		t.Errorf("sub/mismatch.txt: %+v", r)
+	}
+	if r := byPath["sub/not_found.txt"]; r.Passed() || r.Err == nil || r.ExpectedMD5 != "" {
+		t.Errorf("sub/not_found.txt: %+v", r)
+	}
+
+	buf := &bytes.Buffer{}
+	passed, failed := renderCheckResults(buf, results)
+	if passed != 1 || failed != 2 {
+		t.Fatalf("passed: %d, failed: %d", passed, failed)
+	}
+	for _, s := range []string{"match.txt", CheckStatusPass, "云盘文件不存在", "共校验 3 个文件, 通过 1 个, 失败 2 个"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("output does not contain %q:\n%s", s, buf.String())
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phpc0de/ctlibgo/converter"
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/phpc0de/ctpango/internal/functions/pandownload"
+	"github.com/urfave/cli"
+)
+
+func CmdClean() cli.Command {
+	return cli.Command{
+		Name:      "clean",
+		Usage:     "清理下载中断后遗留的断点续传文件",
+		UsageText: cmder.App().Name + " clean [--dry-run] [--confirm] [--older-than <时长>] [本地目录]",
+		Description: `
+	下载被强制中断时, 未完成的下载文件和断点续传文件 (` + pandownload.DownloadSuffix + `) 会遗留在本地.
+	该命令遍历本地目录, 删除所有断点续传文件和对应的未完成的下载文件, 并输出统计.
+	不指定目录时, 清理配置的下载储存路径 (savedir). 清理后无法再断点续传.
+	正在下载的文件, 断点续传信息记录已下载完成的文件, 以及最近10分钟内更新过的断点续传文件不会被清理.
+	未指定 --confirm 时, 输出要清理的文件后需要输入 y 确认.
+
+	--older-than 只清理超过指定时长没有更新的断点续传文件, 支持的单位: s, m, h, d, 如 30m, 12h, 7d
+
+	示例:
+
+	预览要清理的文件, 不删除
+	cloudpan189-go clean --dry-run
+
+	清理 D:/Downloads 中超过7天没有更新的断点续传文件, 不需要确认
+	cloudpan189-go clean --older-than 7d --confirm D:/Downloads
+`,
+		Category: "天翼云盘",
+		Before:   cmder.ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			dir := config.Config.SaveDir
+			if c.NArg() > 0 {
+				dir = c.Args().Get(0)
+			}
+			olderThan, err := parseOlderThan(c.String("older-than"))
+			if err != nil {
+				fmt.Printf("时长格式错误: %s\n", c.String("older-than"))
+				return nil
+			}
+			RunClean(dir, c.Bool("dry-run"), olderThan, c.Bool("confirm"))
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "只输出要清理的文件, 不删除",
+			},
+			cli.StringFlag{
+				Name:  "older-than",
+				Usage: "只清理超过该时长没有更新的断点续传文件, 如 12h, 7d, 最少为10分钟",
+			},
+			cli.BoolFlag{
+				Name:  "confirm",
+				Usage: "跳过确认提示, 直接删除",
+			},
+		},
+	}
+}
+
+// parseOlderThan 解析时长, 在 time.ParseDuration 的基础上支持以天为单位, 如 7d
+func parseOlderThan(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("invalid duration: %s", s)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration: %s", s)
+	}
+	return d, nil
+}
+
+// RunClean 清理 dir 目录中遗留的断点续传文件和未完成的下载文件, dryRun 为 true 时只输出不删除,
+// confirm 为 false 时删除前需要输入 y 确认
+func RunClean(dir string, dryRun bool, olderThan time.Duration, confirm bool) {
+	if fi, err := os.Stat(dir); err != nil {
+		fmt.Printf("%s\n", err)
+		return
+	} else if !fi.IsDir() {
+		fmt.Printf("%s 不是目录\n", dir)
+		return
+	}
+
+	list, err := pandownload.FindOrphanedDownloads(dir, olderThan, time.Now())
+	if err != nil {
+		fmt.Printf("遍历目录错误: %s\n", err)
+	}
+
+	for _, od := range list {
+		if od.FileExists {
+			fmt.Printf("%s (%s)\n", od.FilePath, converter.ConvertFileSize(od.FileSize, 2))
+		}
+		fmt.Printf("%s\n", od.StatePath)
+	}
+
+	if dryRun {
+		fmt.Printf("\n共找到 %d 个未完成的下载, 预览模式, 未删除任何文件\n", len(list))
+		return
+	}
+	if len(list) == 0 {
+		fmt.Printf("\n没有找到未完成的下载\n")
+		return
+	}
+	if !confirm {
+		var input string
+		fmt.Printf("\n确认删除以上 %d 个未完成的下载? 删除后无法再断点续传 (y/n) > ", len(list))
+		_, err := fmt.Scanln(&input)
+		if err != nil || (input != "y" && input != "Y") {
+			fmt.Printf("已取消\n")
+			return
+		}
+	}
+
+	var (
+		removed   int
+		freedSize int64
+	)
+	for _, od := range list {
+		if err := od.Remove(); err != nil {
+			fmt.Printf("删除失败: %s, %s\n", od.StatePath, err)
+			continue
+		}
+		removed++
+		freedSize += od.FileSize
+	}
+	fmt.Printf("\n共找到 %d 个未完成的下载, 已清理 %d 个, 释放空间: %s\n", len(list), removed, converter.ConvertFileSize(freedSize, 2))
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/phpc0de/ctpango/internal/file/downloader"
+	"github.com/phpc0de/ctpango/internal/functions/pandownload"
+	"github.com/phpc0de/ctpango/library/requester/transfer"
+)
+
+// writeTestDownload 创建未完成的下载文件和断点续传文件, fileSize 小于0时不创建下载文件
+func writeTestDownload(t *testing.T, path string, fileSize, totalSize int64, modTime time.Time) {
+	writeTestDownloadState(t, path, fileSize, totalSize, transfer.RangeList{&transfer.Range{Begin: 0, End: totalSize}}, modTime)
+}
+
+// writeTestDownloadState 创建下载文件和断点续传文件, ranges 为未下载的部分
+func writeTestDownloadState(t *testing.T, path string, fileSize, totalSize int64, ranges transfer.RangeList, modTime time.Time) {
+	if fileSize >= 0 {
+		if err := ioutil.WriteFile(path, make([]byte, fileSize), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	statePath := path + pandownload.DownloadSuffix
+	f, err := os.Create(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := transfer.NewDownloadStatus()
+	status.SetTotalSize(totalSize)
+	is := downloader.NewInstanceState(f, downloader.InstanceStateStorageFormatJSON)
+	is.Put(&transfer.DownloadInstanceInfo{DownloadStatus: status, Ranges: ranges})
+	is.Close()
+	if err = os.Chtimes(statePath, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestRunClean(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	old, now := time.Now().Add(-48*time.Hour), time.Now()
+	var (
+		oldFile      = filepath.Join(dir, "old.bin")
+		recentFile   = filepath.Join(dir, "recent.bin")
+		stateOnly    = filepath.Join(dir, "sub", "state-only.bin")
+		mismatchFile = filepath.Join(dir, "mismatch.bin")
+		completeFile = filepath.Join(dir, "complete.bin")
+		lockedFile   = filepath.Join(dir, "locked.bin")
+		dayOldFile   = filepath.Join(dir, "day-old.bin")
+	)
+	writeTestDownload(t, oldFile, 10, 100, old)
+	writeTestDownload(t, recentFile, 100, 100, now)
+	writeTestDownload(t, stateOnly, -1, 100, old)
+	writeTestDownload(t, mismatchFile, 200, 100, old)
+	writeTestDownloadState(t, completeFile, 100, 100, nil, old)
+	writeTestDownload(t, lockedFile, 10, 100, old)
+	writeTestDownload(t, dayOldFile, 10, 100, now.Add(-time.Hour))
+
+	// 正在下载的文件持有下载锁
+	lock, err := downloader.LockFile(lockedFile+downloader.LockFileSuffix, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Unlock()
+
+	// 最近10分钟内更新的, 已下载完成的和正在下载的不算遗留的文件
+	list, err := pandownload.FindOrphanedDownloads(dir, 0, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("found %d, want 3", len(list))
+	}
+
+	// 预览模式不删除文件
+	RunClean(dir, true, 0, false)
+	for _, path := range []string{oldFile, recentFile, mismatchFile, dayOldFile} {
+		if !fileExists(path) || !fileExists(path+pandownload.DownloadSuffix) {
+			t.Fatalf("dry run removed %s", path)
+		}
+	}
+
+	// 只清理超过24小时没有更新的
+	RunClean(dir, false, 24*time.Hour, true)
+	for _, path := range []string{oldFile, oldFile + pandownload.DownloadSuffix, stateOnly + pandownload.DownloadSuffix} {
+		if fileExists(path) {
+			t.Errorf("%s should be removed", path)
+		}
+	}
+	for _, path := range []string{recentFile, mismatchFile, completeFile, lockedFile, dayOldFile} {
+		if !fileExists(path) || !fileExists(path+pandownload.DownloadSuffix) {
+			t.Errorf("%s should be kept", path)
+		}
+	}
+}
+
+func TestParseOlderThan(t *testing.T) {
+	for s, want := range map[string]time.Duration{"": 0, "30m": 30 * time.Minute, "12h": 12 * time.Hour, "7d": 7 * 24 * time.Hour, "0.5d": 12 * time.Hour} {
+		if d, err := parseOlderThan(s); err != nil || d != want {
+			t.Errorf("parseOlderThan(%q) = %s, %v, want %s", s, d, err, want)
+		}
+	}
+	for _, s := range []string{"abc", "-1h", "xd"} {
+		if _, err := parseOlderThan(s); err == nil {
+			t.Errorf("parseOlderThan(%q) should fail", s)
+		}
+	}
+}
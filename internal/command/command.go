@@ -18,13 +18,14 @@ import (
 	"fmt"
 	"github.com/phpc0de/ctpango/cmder"
 	"github.com/phpc0de/ctpango/cmder/cmdutil"
+	"github.com/phpc0de/ctpango/internal/apistat"
 	"github.com/phpc0de/ctpango/library/crypto"
 	"github.com/phpc0de/ctlibgo/getip"
+	"os"
 	"strconv"
+	"strings"
 
 	"github.com/urfave/cli"
-
-	"github.com/phpc0de/ctapi/cloudpan"
 	"github.com/phpc0de/ctpango/internal/config"
 )
 
@@ -47,7 +48,24 @@ const (
 var ErrBadArgs = errors.New("参数错误")
 var ErrNotLogined = errors.New("未登录账号")
 
-func GetActivePanClient() *cloudpan.PanClient {
+// FamilyFlags 指定家庭云的参数, 由 parseFamilyId 解析
+var FamilyFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "familyId",
+		Usage: "家庭云ID",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "family-id-env",
+		Usage: "从指定的环境变量中读取家庭云ID, 优先于 familyId 参数",
+	},
+	cli.BoolFlag{
+		Name:  "remember-family",
+		Usage: "把 familyId 或 family-id-env 指定的家庭云ID保存为当前的云工作模式, 后续命令无需再指定",
+	},
+}
+
+func GetActivePanClient() *apistat.PanClient {
 	return config.Config.ActiveUser().PanClient()
 }
 
@@ -55,20 +73,158 @@ func GetActiveUser() *config.PanUser {
 	return config.Config.ActiveUser()
 }
 
-func parseFamilyId(c *cli.Context) int64 {
+// parseFamilyId 解析 familyId 和 family-id-env 参数, 都没有设置时返回当前的云工作模式.
+// 家庭云ID格式错误时返回错误, 不会退回到个人云, 避免在错误的云盘中操作文件
+func parseFamilyId(c *cli.Context) (int64, error) {
 	familyId := config.Config.ActiveUser().ActiveFamilyId
 	if c.IsSet("familyId") {
 		fid, errfi := strconv.ParseInt(c.String("familyId"), 10, 64)
-		if errfi != nil {
-			familyId = 0
-		} else {
+		if errfi != nil || fid < 0 {
+			return 0, fmt.Errorf("家庭云ID格式错误: %s", c.String("familyId"))
+		}
+		familyId = fid
+	}
+	if c.IsSet("family-id-env") {
+		// 从环境变量中读取, 避免家庭云ID出现在命令历史记录或进程列表中
+		envName := c.String("family-id-env")
+		if envValue := strings.TrimSpace(os.Getenv(envName)); envValue != "" {
+			fid, errfi := strconv.ParseInt(envValue, 10, 64)
+			if errfi != nil || fid < 0 {
+				return 0, fmt.Errorf("环境变量 %s 中的家庭云ID格式错误: %s", envName, envValue)
+			}
 			familyId = fid
+		} else {
+			fmt.Printf("环境变量 %s 未设置, 忽略 family-id-env 参数\n", envName)
 		}
 	}
-	return familyId
+	if c.Bool("remember-family") {
+		if c.IsSet("familyId") || c.IsSet("family-id-env") {
+			rememberFamilyId(c, familyId)
+		} else {
+			fmt.Println("remember-family 需要和 familyId 或 family-id-env 参数一起使用")
+		}
+	}
+	return familyId, nil
+}
+
+// rememberFamilyId 把家庭云ID保存为当前的云工作模式, 和 family <familyId> 命令相同
+func rememberFamilyId(c *cli.Context, familyId int64) {
+	if familyId == config.Config.ActiveUser().ActiveFamilyId {
+		return
+	}
+	RunSwitchFamilyList(familyId)
+	cmder.SaveConfigFunc(c)
+}
+
+
+
+func CmdConfigShow() cli.Command {
+	return cli.Command{
+		Name:      "show",
+		Usage:     "以JSON或TOML格式显示程序配置",
+		UsageText: cmder.App().Name + " config show [-format json|toml]",
+		Description: `
+	显示当前的完整配置, 用于排查配置问题. 密码, token 等敏感信息会显示为 ***
+
+	例子:
+		cloudpan189-go config show
+		cloudpan189-go config show -format toml`,
+		Action: func(c *cli.Context) error {
+			var (
+				str string
+				err error
+			)
+			switch strings.ToLower(c.String("format")) {
+			case "json":
+				str, err = config.Config.ShowJSON()
+			case "toml":
+				str, err = config.Config.ShowTOML()
+			default:
+				fmt.Printf("不支持的格式: %s, 可选值: json, toml\n", c.String("format"))
+				return nil
+			}
+			if err != nil {
+				fmt.Printf("显示配置错误: %s\n", err)
+				return nil
+			}
+			fmt.Println(str)
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "format",
+				Usage: "输出格式, 可选值: json, toml",
+				Value: "json",
+			},
+		},
+	}
+}
+
+func CmdConfigShowEffective() cli.Command {
+	return cli.Command{
+		Name:      "show-effective",
+		Usage:     "显示应用环境变量和参数覆盖后的配置, 以及每项配置的来源",
+		UsageText: cmder.App().Name + " [--set-config key=value ...] config show-effective",
+		Description: `
+	启动时依次应用配置文件, 环境变量和全局参数 --set-config, 后面的覆盖前面的, 所有命令都使用覆盖后的配置.
+	显示当前生效的配置和每项配置的来源:
+		file: 配置文件
+		env:  环境变量, 名称为 ` + config.EnvConfigOverridePrefix + ` 加上大写的配置项名称, - 替换为 _, 如 ` + config.ConfigKeyEnvName("max_download_rate") + `
+		flag: 全局参数 --set-config, 格式为 key=value, 可以指定多个
+
+	覆盖的值只在本次运行中生效, 不会保存到配置文件.
+
+	例子:
+		cloudpan189-go config show-effective
+		` + config.ConfigKeyEnvName("max_download_rate") + `=2MB cloudpan189-go config show-effective
+		cloudpan189-go --set-config max_download_load=3 --set-config progress-style=bar config show-effective`,
+		Action: func(c *cli.Context) error {
+			err := config.Config.PrintEffectiveTable(os.Stdout)
+			if err != nil {
+				fmt.Printf("显示配置错误: %s\n", err)
+			}
+			return nil
+		},
+	}
 }
 
+func CmdConfigValidate() cli.Command {
+	return cli.Command{
+		Name:      "validate",
+		Usage:     "检查配置项的值, 输出发现的问题",
+		UsageText: cmder.App().Name + " config validate",
+		Description: `
+	检查下载目录是否存在并可写, max_download_parallel 是否在 1 ~ ` + strconv.Itoa(config.MaxValidParallel) + ` 之间,
+	max_download_total_parallel 是否在 0 ~ ` + strconv.Itoa(config.MaxValidTotalParallel) + ` 之间,
+	max_download_queue 是否在 0 ~ ` + strconv.Itoa(config.MaxValidDownloadQueue) + ` 之间, 限速是否不小于0,
+	代理地址是否合法, CA证书文件是否存在, 以及所有账号的登录凭证是否为空.
+	发现问题时退出码为1, 否则为0.
 
+	例子:
+		cloudpan189-go config validate`,
+		Action: func(c *cli.Context) error {
+			code := RunConfigValidate()
+			if code == 0 || cmder.IsInteractive() {
+				return nil
+			}
+			return cli.NewExitError("", code)
+		},
+	}
+}
+
+// RunConfigValidate 执行 检查配置, 输出每个问题, 有问题时返回1, 否则返回0
+func RunConfigValidate() int {
+	problems := config.Config.Validate()
+	for _, p := range problems {
+		fmt.Printf("[%s] 错误: %s\n", p.Key, p.Message)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("共发现 %d 个问题\n", len(problems))
+		return 1
+	}
+	fmt.Println("配置检查通过")
+	return 0
+}
 
 func CmdConfig() cli.Command {
 	return cli.Command{
@@ -84,6 +240,12 @@ func CmdConfig() cli.Command {
 			return nil
 		},
 		Subcommands: []cli.Command{
+			CmdConfigShow(),
+			CmdConfigShowEffective(),
+			CmdConfigValidate(),
+			CmdConfigReset(),
+			CmdConfigExport(),
+			CmdConfigImport(),
 			{
 				Name:      "set",
 				Usage:     "修改程序配置项",
@@ -94,10 +256,19 @@ func CmdConfig() cli.Command {
 
 		cache_size 的值支持可选设置单位, 单位不区分大小写, b 和 B 均表示字节的意思, 如 64KB, 1MB, 32kb, 65536b, 65536
 		max_download_rate, max_upload_rate 的值支持可选设置单位, 单位为每秒的传输速率, 后缀'/s' 可省略, 如 2MB/s, 2MB, 2m, 2mb 均为一个意思
+		rate-schedule 按整点时间段限速, 格式为 HH:00-HH:00:<速度>, 多个时间段用逗号隔开, 速度为 unlimited 代表不限制
 
 	例子:
 		cloudpan189-go config set -cache_size 64KB
-		cloudpan189-go config set -cache_size 16384 -max_download_parallel 200 -savedir D:/download`,
+		cloudpan189-go config set -cache_size 16384 -max_download_parallel 200 -savedir D:/download
+		cloudpan189-go config set -family-savedir 12345:D:/family_download
+		cloudpan189-go config set -rate-schedule "00:00-08:00:unlimited,08:00-22:00:500KB"
+		cloudpan189-go config set -cacert /etc/ssl/company-ca.pem
+		cloudpan189-go config set -progress-style bar
+		cloudpan189-go config set -history_file D:/cloud189/history.jsonl
+		cloudpan189-go config set -log_file D:/cloud189/cloudpan189.log -log_max_size 20MB
+		cloudpan189-go config set -store-credentials-keychain true
+		cloudpan189-go config set -webhook_url https://example.com/hook -webhook_on_success false`,
 				Action: func(c *cli.Context) error {
 					if c.NumFlags() <= 0 || c.NArg() > 0 {
 						cli.ShowCommandHelp(c, c.Command.Name)
@@ -119,6 +290,12 @@ func CmdConfig() cli.Command {
 					if c.IsSet("max_download_load") {
 						config.Config.MaxDownloadLoad = c.Int("max_download_load")
 					}
+					if c.IsSet("max_download_total_parallel") {
+						config.Config.MaxDownloadTotalParallel = c.Int("max_download_total_parallel")
+					}
+					if c.IsSet("max_download_queue") {
+						config.Config.MaxDownloadQueue = c.Int("max_download_queue")
+					}
 					if c.IsSet("max_download_rate") {
 						err := config.Config.SetMaxDownloadRateByStr(c.String("max_download_rate"))
 						if err != nil {
@@ -133,15 +310,100 @@ func CmdConfig() cli.Command {
 							return nil
 						}
 					}
+					if c.IsSet("rate-schedule") {
+						err := config.Config.SetRateScheduleByStr(c.String("rate-schedule"))
+						if err != nil {
+							fmt.Printf("设置 rate-schedule 错误: %s\n", err)
+							return nil
+						}
+					}
+					if c.IsSet("webhook_url") {
+						err := config.Config.SetWebhookURLByStr(c.String("webhook_url"))
+						if err != nil {
+							fmt.Printf("设置 webhook_url 错误: %s\n", err)
+							return nil
+						}
+					}
+					if c.IsSet("webhook_on_success") {
+						b, err := strconv.ParseBool(c.String("webhook_on_success"))
+						if err != nil {
+							fmt.Printf("设置 webhook_on_success 错误: %s\n", err)
+							return nil
+						}
+						config.Config.WebhookOnSuccess = b
+					}
+					if c.IsSet("webhook_on_failure") {
+						b, err := strconv.ParseBool(c.String("webhook_on_failure"))
+						if err != nil {
+							fmt.Printf("设置 webhook_on_failure 错误: %s\n", err)
+							return nil
+						}
+						config.Config.WebhookOnFailure = b
+					}
+					if c.IsSet("store-credentials-keychain") {
+						b, err := strconv.ParseBool(c.String("store-credentials-keychain"))
+						if err != nil {
+							fmt.Printf("设置 store-credentials-keychain 错误: %s\n", err)
+							return nil
+						}
+						config.Config.StoreCredentialsKeychain = b
+					}
+					if c.IsSet("progress-style") {
+						err := config.Config.SetProgressStyleByStr(c.String("progress-style"))
+						if err != nil {
+							fmt.Printf("设置 progress-style 错误: %s\n", err)
+							return nil
+						}
+					}
 					if c.IsSet("savedir") {
 						config.Config.SaveDir = c.String("savedir")
 					}
+					if c.IsSet("history_file") {
+						config.Config.HistoryFile = c.String("history_file")
+					}
+					if c.IsSet("log_file") {
+						config.Config.LogFile = c.String("log_file")
+					}
+					if c.IsSet("log_max_size") {
+						err := config.Config.SetLogMaxSizeByStr(c.String("log_max_size"))
+						if err != nil {
+							fmt.Printf("设置 log_max_size 错误: %s\n", err)
+							return nil
+						}
+					}
+					if c.IsSet("family-savedir") {
+						activeUser := config.Config.ActiveUser()
+						if activeUser == nil {
+							fmt.Println("未登录账号, 无法设置 family-savedir")
+							return nil
+						}
+						err := activeUser.SetFamilySaveDirByStr(c.String("family-savedir"))
+						if err != nil {
+							fmt.Printf("设置 family-savedir 错误: %s\n", err)
+							return nil
+						}
+					}
 					if c.IsSet("proxy") {
 						config.Config.SetProxy(c.String("proxy"))
 					}
 					if c.IsSet("local_addrs") {
 						config.Config.SetLocalAddrs(c.String("local_addrs"))
 					}
+					if c.IsSet("cacert") {
+						err := config.Config.SetTLSCACert(c.String("cacert"))
+						if err != nil {
+							fmt.Printf("设置 cacert 错误: %s\n", err)
+							return nil
+						}
+					}
+					if c.IsSet("tls_skip_verify") {
+						b, err := strconv.ParseBool(c.String("tls_skip_verify"))
+						if err != nil {
+							fmt.Printf("设置 tls_skip_verify 错误: %s\n", err)
+							return nil
+						}
+						config.Config.TLSSkipVerify = b
+					}
 
 					err := config.Config.Save()
 					if err != nil {
@@ -161,7 +423,7 @@ func CmdConfig() cli.Command {
 					},
 					cli.IntFlag{
 						Name:  "max_download_parallel",
-						Usage: "下载网络连接的最大并发量",
+						Usage: "每个文件的下载线程数",
 					},
 					cli.IntFlag{
 						Name:  "max_upload_parallel",
@@ -171,6 +433,14 @@ func CmdConfig() cli.Command {
 						Name:  "max_download_load",
 						Usage: "同时进行下载文件的最大数量",
 					},
+					cli.IntFlag{
+						Name:  "max_download_total_parallel",
+						Usage: "所有同时下载的文件的下载线程总数上限, 0代表不限制",
+					},
+					cli.IntFlag{
+						Name:  "max_download_queue",
+						Usage: "一次下载最多加入下载队列的文件数量, 0代表不限制",
+					},
 					cli.StringFlag{
 						Name:  "max_download_rate",
 						Usage: "限制最大下载速度, 0代表不限制",
@@ -179,10 +449,50 @@ func CmdConfig() cli.Command {
 						Name:  "max_upload_rate",
 						Usage: "限制最大上传速度, 0代表不限制",
 					},
+					cli.StringFlag{
+						Name:  "rate-schedule",
+						Usage: "按时间段限速, 例如 00:00-08:00:unlimited,08:00-22:00:500KB, 空字符串为清除",
+					},
+					cli.StringFlag{
+						Name:  "webhook_url",
+						Usage: "下载或上传完成后以POST方式发送JSON通知到该URL, 空字符串为不通知",
+					},
+					cli.StringFlag{
+						Name:  "webhook_on_success",
+						Usage: "任务成功时发送webhook通知, true 或 false",
+					},
+					cli.StringFlag{
+						Name:  "webhook_on_failure",
+						Usage: "任务失败时发送webhook通知, true 或 false",
+					},
+					cli.StringFlag{
+						Name:  "store-credentials-keychain",
+						Usage: "登录凭证保存到系统钥匙串, true 或 false",
+					},
+					cli.StringFlag{
+						Name:  "progress-style",
+						Usage: "下载进度的输出样式, 可选值: simple, bar, spinner",
+					},
 					cli.StringFlag{
 						Name:  "savedir",
 						Usage: "下载文件的储存目录",
 					},
+					cli.StringFlag{
+						Name:  "history_file",
+						Usage: "下载和上传历史记录文件路径, 空字符串为使用配置目录",
+					},
+					cli.StringFlag{
+						Name:  "log_file",
+						Usage: "日志文件路径, 标准输出和调试日志同时写入该文件, 登录凭证和下载链接不写入, 空字符串为不写入",
+					},
+					cli.StringFlag{
+						Name:  "log_max_size",
+						Usage: "日志文件大小上限, 超过时轮转, 例如 10MB, 0代表使用默认值",
+					},
+					cli.StringFlag{
+						Name:  "family-savedir",
+						Usage: "当前账号家庭云文件的下载储存目录, 格式为 <familyId>:<path>, path 为空则使用 savedir",
+					},
 					cli.StringFlag{
 						Name:  "proxy",
 						Usage: "设置代理, 支持 http/socks5 代理",
@@ -191,6 +501,14 @@ func CmdConfig() cli.Command {
 						Name:  "local_addrs",
 						Usage: "设置本地网卡地址, 多个地址用逗号隔开",
 					},
+					cli.StringFlag{
+						Name:  "cacert",
+						Usage: "自定义CA证书路径(PEM格式), 空字符串为清除, 只对下载和 webhook 等请求生效, 网盘接口请求不使用",
+					},
+					cli.StringFlag{
+						Name:  "tls_skip_verify",
+						Usage: "不校验服务器TLS证书, true 或 false, 有安全风险, 只对下载和 webhook 等请求生效, 网盘接口请求不使用",
+					},
 				},
 			},
 		},
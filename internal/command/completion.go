@@ -0,0 +1,426 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/urfave/cli"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// EnvCompleteCloudPath 为 0 时, bash 自动补全不补全网盘路径
+	EnvCompleteCloudPath = "CLOUD189_COMPLETE_CLOUD_PATH"
+)
+
+var (
+	// cloudPathCommands 参数为网盘路径的命令, 自动补全时补全网盘中的文件和目录
+	cloudPathCommands = []string{"cd", "cp", "mv", "xcp", "download", "du", "exists", "export", "ls", "mkdir", "rename", "rm", "tree"}
+)
+
+func CmdCompletion() cli.Command {
+	return cli.Command{
+		Name:      "completion",
+		Aliases:   []string{"completions"},
+		Usage:     "输出 shell 自动补全脚本",
+		UsageText: cmder.App().Name + " completion <bash|zsh|fish>",
+		Description: `
+	输出 bash, zsh 或 fish 的自动补全脚本, 可以补全命令, 命令参数, 以及网盘中的文件和目录.
+	补全网盘路径时调用 ls -output-paths-only 获取候选项, 每次补全都会请求网盘接口,
+	网络较慢时可以使用 -cloud-path-complete=false 关闭网盘路径补全.
+	参数值和 upload 等命令的本地路径使用 shell 默认的文件补全.
+
+	示例:
+
+	bash, 添加到 ~/.bashrc
+	source <(cloudpan189-go completion bash)
+
+	zsh, 保存到 fpath 中的目录
+	cloudpan189-go completion zsh > "${fpath[1]}/_cloudpan189-go"
+
+	fish
+	cloudpan189-go completion fish > ~/.config/fish/completions/cloudpan189-go.fish
+
+	不补全网盘路径
+	cloudpan189-go completion -cloud-path-complete=false bash
+`,
+		Category: "其他",
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			if err := RunCompletion(os.Stdout, cmder.App(), c.Args().Get(0), c.BoolT("cloud-path-complete")); err != nil {
+				fmt.Println(err)
+			}
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.BoolTFlag{
+				Name:  "cloud-path-complete",
+				Usage: "补全网盘中的文件和目录, 默认开启",
+			},
+		},
+	}
+}
+
+// RunCompletion 输出 shell 自动补全脚本
+func RunCompletion(w io.Writer, app *cli.App, shell string, cloudPathComplete bool) error {
+	switch strings.ToLower(shell) {
+	case "bash":
+		writeBashCompletion(w, app, cloudPathComplete)
+	case "zsh":
+		writeZshCompletion(w, app, cloudPathComplete)
+	case "fish":
+		writeFishCompletion(w, app, cloudPathComplete)
+	default:
+		return fmt.Errorf("不支持的 shell: %s, 可选值: bash, zsh, fish", shell)
+	}
+	return nil
+}
+
+// IsBashCompletionRequest 是否为 bash complete -C 调用的补全请求,
+// bash 会设置 COMP_LINE, COMP_POINT 环境变量, 参数为 命令名, 当前单词, 前一个单词
+func IsBashCompletionRequest() bool {
+	_, hasLine := os.LookupEnv("COMP_LINE")
+	_, hasPoint := os.LookupEnv("COMP_POINT")
+	return hasLine && hasPoint && len(os.Args) == 4
+}
+
+// RunBashCompletion 输出 bash complete -C 的补全候选项, 每行一个
+func RunBashCompletion(app *cli.App) {
+	line := os.Getenv("COMP_LINE")
+	if point, err := strconv.Atoi(os.Getenv("COMP_POINT")); err == nil && point >= 0 && point <= len(line) {
+		line = line[:point]
+	}
+
+	var cloudPaths func(prefix string) []string
+	if os.Getenv(EnvCompleteCloudPath) != "0" {
+		cloudPaths = func(prefix string) []string {
+			activeUser := config.Config.ActiveUser()
+			if activeUser == nil {
+				return nil
+			}
+			return lsPaths(activeUser.ActiveFamilyId, prefix)
+		}
+	}
+	for _, candidate := range completeLine(app, line, cloudPaths) {
+		fmt.Println(candidate)
+	}
+}
+
+// completeLine 返回命令行 line 最后一个单词的补全候选项, 候选项后面的空格表示补全完成.
+// 返回 nil 时由 shell 使用默认的文件补全
+func completeLine(app *cli.App, line string, cloudPaths func(prefix string) []string) []string {
+	words := strings.Fields(line)
+	cur := ""
+	if len(words) > 0 && !strings.HasSuffix(line, " ") {
+		cur = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+	if len(words) == 0 {
+		return nil
+	}
+
+	var (
+		cmd         *cli.Command
+		flags       = app.Flags
+		subcommands = cli.Commands(app.Commands)
+		numArgs     int  // 命令之后的参数数量
+		expectValue bool // 前一个单词是需要参数值的选项
+	)
+	for _, word := range words[1:] {
+		if expectValue {
+			expectValue = false
+			continue
+		}
+		if strings.HasPrefix(word, "-") {
+			flag := findCompletionFlag(flags, word)
+			expectValue = flag != nil && completionFlagTakesValue(flag) && !strings.Contains(word, "=")
+			continue
+		}
+		if numArgs == 0 {
+			if next := findCompletionCommand(subcommands, word); next != nil {
+				cmd, flags, subcommands = next, next.Flags, next.Subcommands
+				continue
+			}
+		}
+		numArgs++
+	}
+
+	switch {
+	case expectValue:
+		return nil
+	case strings.HasPrefix(cur, "-"):
+		return completionPrefixed(completionFlagNames(flags), cur)
+	case len(subcommands) > 0 && numArgs == 0:
+		return completionPrefixed(completionCommandNames(subcommands), cur)
+	case cmd != nil && cmdContains(cloudPathCommands, cmd.Name):
+		if cloudPaths == nil {
+			return nil
+		}
+		candidates := cloudPaths(cur)
+		for k := range candidates {
+			if !strings.HasSuffix(candidates[k], "/") {
+				candidates[k] += " "
+			}
+		}
+		return candidates
+	}
+	return nil
+}
+
+// completionPrefixed 返回以 prefix 开头的单词, 并加上空格
+func completionPrefixed(words []string, prefix string) []string {
+	candidates := make([]string, 0, len(words))
+	for _, word := range words {
+		if strings.HasPrefix(word, prefix) {
+			candidates = append(candidates, word+" ")
+		}
+	}
+	return candidates
+}
+
+func findCompletionCommand(commands cli.Commands, name string) *cli.Command {
+	for k := range commands {
+		if commands[k].HasName(name) {
+			return &commands[k]
+		}
+	}
+	return nil
+}
+
+func findCompletionFlag(flags []cli.Flag, word string) cli.Flag {
+	name := strings.TrimLeft(word, "-")
+	if i := strings.Index(name, "="); i >= 0 {
+		name = name[:i]
+	}
+	for _, flag := range flags {
+		for _, flagName := range completionFlagNamesOf(flag) {
+			if flagName == name {
+				return flag
+			}
+		}
+	}
+	return nil
+}
+
+// completionFlagTakesValue 选项是否需要参数值
+func completionFlagTakesValue(flag cli.Flag) bool {
+	switch flag.(type) {
+	case cli.BoolFlag, cli.BoolTFlag:
+		return false
+	}
+	return true
+}
+
+// completionFlagNamesOf 返回选项的名称和别名, 不包含 -
+func completionFlagNamesOf(flag cli.Flag) []string {
+	names := strings.Split(flag.GetName(), ",")
+	for k := range names {
+		names[k] = strings.TrimSpace(names[k])
+	}
+	return names
+}
+
+// completionFlag 单个字母的选项为 -x, 其他为 --xxx
+func completionFlag(name string) string {
+	if len(name) == 1 {
+		return "-" + name
+	}
+	return "--" + name
+}
+
+func completionFlagNames(flags []cli.Flag) []string {
+	names := make([]string, 0, len(flags))
+	for _, flag := range flags {
+		for _, name := range completionFlagNamesOf(flag) {
+			names = append(names, completionFlag(name))
+		}
+	}
+	return names
+}
+
+func completionCommandNames(commands cli.Commands) []string {
+	names := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		if cmd.Hidden {
+			continue
+		}
+		names = append(names, cmd.Names()...)
+	}
+	return names
+}
+
+// completionValueFlags 返回需要参数值的选项, 包含 -x 和 --x 两种形式
+func completionValueFlags(flags []cli.Flag) []string {
+	var names []string
+	for _, flag := range flags {
+		if !completionFlagTakesValue(flag) {
+			continue
+		}
+		for _, name := range completionFlagNamesOf(flag) {
+			names = append(names, "-"+name, "--"+name)
+		}
+	}
+	return names
+}
+
+// writeZshValueFlagsCase 前一个单词是需要参数值的选项时, 使用文件补全
+func writeZshValueFlagsCase(w io.Writer, indent string, flags []cli.Flag) {
+	valueFlags := completionValueFlags(flags)
+	if len(valueFlags) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%scase \" %s \" in\n", indent, strings.Join(valueFlags, " "))
+	fmt.Fprintf(w, "%s*\" $prev \"*)\n%s\t_files\n%s\treturn\n%s\t;;\n%sesac\n", indent, indent, indent, indent, indent)
+}
+
+// cloudPathCommandNames 返回参数为网盘路径的命令的名称和别名
+func cloudPathCommandNames(app *cli.App) []string {
+	var names []string
+	for _, cmd := range app.Commands {
+		if cmdContains(cloudPathCommands, cmd.Name) {
+			names = append(names, cmd.Names()...)
+		}
+	}
+	return names
+}
+
+func cmdContains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func writeBashCompletion(w io.Writer, app *cli.App, cloudPathComplete bool) {
+	fmt.Fprintf(w, "# %s bash completion\n", app.Name)
+	fmt.Fprintf(w, "# source <(%s completion bash)\n\n", app.Name)
+	completer := app.Name
+	if !cloudPathComplete {
+		completer = fmt.Sprintf("env %s=0 %s", EnvCompleteCloudPath, app.Name)
+	}
+	// 由程序根据 COMP_LINE 输出候选项, 没有候选项时使用默认的文件补全
+	fmt.Fprintf(w, "complete -o default -o nospace -C '%s' %s\n", completer, app.Name)
+}
+
+func writeZshCompletion(w io.Writer, app *cli.App, cloudPathComplete bool) {
+	fn := "_" + strings.Replace(app.Name, "-", "_", -1)
+	fmt.Fprintf(w, "#compdef %s\n\n", app.Name)
+	fmt.Fprintf(w, "# %s completion zsh > \"${fpath[1]}/_%s\"\n\n", app.Name, app.Name)
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintf(w, "\tlocal cur=\"${words[CURRENT]}\" prev=\"${words[CURRENT-1]}\"\n")
+	fmt.Fprintf(w, "\tif (( CURRENT <= 3 )) && [[ \"${words[2]}\" == -* ]]; then\n")
+	writeZshValueFlagsCase(w, "\t\t", app.Flags)
+	fmt.Fprintf(w, "\tfi\n")
+	fmt.Fprintf(w, "\tif (( CURRENT == 2 )); then\n")
+	fmt.Fprintf(w, "\t\tif [[ \"$cur\" == -* ]]; then\n\t\t\tcompadd -- %s\n\t\telse\n\t\t\tcompadd -- %s\n\t\tfi\n\t\treturn\n\tfi\n",
+		strings.Join(completionFlagNames(app.Flags), " "), strings.Join(completionCommandNames(app.Commands), " "))
+
+	fmt.Fprintf(w, "\tcase \"${words[2]}\" in\n")
+	for _, cmd := range app.Commands {
+		if cmd.Hidden {
+			continue
+		}
+		fmt.Fprintf(w, "\t%s)\n", strings.Join(cmd.Names(), "|"))
+		writeZshValueFlagsCase(w, "\t\t", cmd.Flags)
+		fmt.Fprintf(w, "\t\tif [[ \"$cur\" == -* ]]; then\n\t\t\tcompadd -- %s\n\t\t\treturn\n\t\tfi\n", strings.Join(completionFlagNames(cmd.Flags), " "))
+		if len(cmd.Subcommands) > 0 {
+			fmt.Fprintf(w, "\t\tif (( CURRENT == 3 )); then\n\t\t\tcompadd -- %s\n\t\t\treturn\n\t\tfi\n", strings.Join(completionCommandNames(cmd.Subcommands), " "))
+		}
+		fmt.Fprintf(w, "\t\t;;\n")
+	}
+	fmt.Fprintf(w, "\tesac\n")
+
+	fmt.Fprintf(w, "\tcase \"${words[2]}\" in\n")
+	fmt.Fprintf(w, "\t%s)\n", strings.Join(cloudPathCommandNames(app), "|"))
+	if cloudPathComplete {
+		fmt.Fprintf(w, "\t\tlocal -a paths\n")
+		fmt.Fprintf(w, "\t\tpaths=(\"${(@f)$(%s ls -output-paths-only \"$cur\" 2>/dev/null)}\")\n", app.Name)
+		// 目录补全后不加空格, 方便继续补全下一级
+		fmt.Fprintf(w, "\t\tcompadd -Q -S '' -- ${(M)paths:#*/}\n")
+		fmt.Fprintf(w, "\t\tcompadd -Q -- ${paths:#*/}\n")
+	}
+	fmt.Fprintf(w, "\t\t;;\n\t*)\n\t\t_files\n\t\t;;\n\tesac\n}\n\n")
+	fmt.Fprintf(w, "compdef %s %s\n", fn, app.Name)
+}
+
+func writeFishCompletion(w io.Writer, app *cli.App, cloudPathComplete bool) {
+	fn := "__" + strings.Replace(app.Name, "-", "_", -1) + "_cloud_paths"
+	fmt.Fprintf(w, "# %s completion fish > ~/.config/fish/completions/%s.fish\n\n", app.Name, app.Name)
+	if cloudPathComplete {
+		fmt.Fprintf(w, "function %s\n\t%s ls -output-paths-only (commandline -ct) 2>/dev/null\nend\n\n", fn, app.Name)
+	}
+	fmt.Fprintf(w, "complete -c %s -f\n", app.Name)
+	writeFishFlags(w, app.Name, "__fish_use_subcommand", app.Flags)
+	for _, cmd := range app.Commands {
+		if cmd.Hidden {
+			continue
+		}
+		fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -a '%s' -d '%s'\n", app.Name, strings.Join(cmd.Names(), " "), fishEscape(cmd.Usage))
+		seen := fmt.Sprintf("'__fish_seen_subcommand_from %s'", strings.Join(cmd.Names(), " "))
+		for _, sub := range cmd.Subcommands {
+			if sub.Hidden {
+				continue
+			}
+			fmt.Fprintf(w, "complete -c %s -n %s -a '%s' -d '%s'\n", app.Name, seen, strings.Join(sub.Names(), " "), fishEscape(sub.Usage))
+		}
+		writeFishFlags(w, app.Name, seen, cmd.Flags)
+	}
+
+	cloudNames := strings.Join(cloudPathCommandNames(app), " ")
+	if cloudPathComplete {
+		fmt.Fprintf(w, "complete -c %s -n '__fish_seen_subcommand_from %s' -a '(%s)'\n", app.Name, cloudNames, fn)
+	}
+	fmt.Fprintf(w, "complete -c %s -n 'not __fish_use_subcommand; and not __fish_seen_subcommand_from %s' -F\n", app.Name, cloudNames)
+}
+
+func writeFishFlags(w io.Writer, name, condition string, flags []cli.Flag) {
+	for _, flag := range flags {
+		var opts []string
+		for _, flagName := range completionFlagNamesOf(flag) {
+			if len(flagName) == 1 {
+				opts = append(opts, "-s "+flagName)
+			} else {
+				opts = append(opts, "-l "+flagName)
+			}
+		}
+		if completionFlagTakesValue(flag) {
+			// 参数值使用文件补全
+			opts = append(opts, "-r -F")
+		}
+		fmt.Fprintf(w, "complete -c %s -n %s %s -d '%s'\n", name, condition, strings.Join(opts, " "), fishEscape(completionFlagUsage(flag)))
+	}
+}
+
+// completionFlagUsage 获取选项的说明
+func completionFlagUsage(flag cli.Flag) string {
+	if f, ok := flag.(cli.DocGenerationFlag); ok {
+		return f.GetUsage()
+	}
+	return ""
+}
+
+// fishEscape 转义 fish 单引号字符串中的 \ 和 '
+func fishEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
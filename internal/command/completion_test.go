@@ -0,0 +1,164 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"bytes"
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/urfave/cli"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newCompletionTestApp() *cli.App {
+	app := cli.NewApp()
+	app.Name = "cloudpan189-go"
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "log-format"},
+		cli.BoolFlag{Name: "verbose"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:    "ls",
+			Aliases: []string{"l", "ll"},
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "l"},
+				cli.BoolFlag{Name: "interactive, i"},
+				cli.StringFlag{Name: "output-format"},
+			},
+		},
+		{
+			Name: "login",
+		},
+		{
+			Name: "config",
+			Subcommands: []cli.Command{
+				{Name: "set"},
+				{Name: "show"},
+			},
+		},
+		{
+			Name:  "upload",
+			Flags: []cli.Flag{cli.IntFlag{Name: "p"}},
+		},
+	}
+	return app
+}
+
+func TestCompleteLine(t *testing.T) {
+	app := newCompletionTestApp()
+	var prefixes []string
+	cloudPaths := func(prefix string) []string {
+		prefixes = append(prefixes, prefix)
+		return []string{prefix + "a/", prefix + "b.txt"}
+	}
+
+	testCases := []struct {
+		line string
+		want []string
+	}{
+		{"cloudpan189-go l", []string{"ls ", "l ", "ll ", "login "}},
+		{"cloudpan189-go --v", []string{"--verbose "}},
+		{"cloudpan189-go --log-format json lo", []string{"login "}},
+		{"cloudpan189-go --log-format ", nil},
+		{"cloudpan189-go ls -", []string{"-l ", "--interactive ", "-i ", "--output-format "}},
+		{"cloudpan189-go ls --output-format ", nil},
+		{"cloudpan189-go ls -l /我的", []string{"/我的a/", "/我的b.txt "}},
+		{"cloudpan189-go ll ", []string{"a/", "b.txt "}},
+		{"cloudpan189-go config s", []string{"set ", "show "}},
+		{"cloudpan189-go config set ", nil},
+		{"cloudpan189-go upload ", nil},
+		{"cloudpan189-go upload -p ", nil},
+	}
+	for _, tc := range testCases {
+		got := completeLine(app, tc.line, cloudPaths)
+		if len(got) == 0 && len(tc.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %q, want %q", tc.line, got, tc.want)
+		}
+	}
+	if !reflect.DeepEqual(prefixes, []string{"/我的", ""}) {
+		t.Errorf("cloud path prefixes: %q", prefixes)
+	}
+
+	// 关闭网盘路径补全
+	if got := completeLine(app, "cloudpan189-go ls /", nil); got != nil {
+		t.Errorf("cloud path complete disabled: got %q", got)
+	}
+}
+
+func TestLsPathCandidates(t *testing.T) {
+	for prefix, want := range map[string][2]string{
+		"":        {"", ""},
+		"电影":      {"", "电影"},
+		"/":       {"/", ""},
+		"/我的资源/电": {"/我的资源/", "电"},
+		"我的资源/":   {"我的资源/", ""},
+	} {
+		dirPart, base := splitPathPrefix(prefix)
+		if dirPart != want[0] || base != want[1] {
+			t.Errorf("split %q: got %q, %q", prefix, dirPart, base)
+		}
+	}
+
+	files := cloudpan.AppFileList{
+		{FileName: "电影", IsFolder: true},
+		{FileName: "电视剧.mp4"},
+		{FileName: "音乐", IsFolder: true},
+	}
+	got := lsPathCandidates("/我的资源/", "电", files)
+	want := []string{"/我的资源/电影/", "/我的资源/电视剧.mp4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRunCompletion(t *testing.T) {
+	app := newCompletionTestApp()
+	buf := &bytes.Buffer{}
+	if err := RunCompletion(buf, app, "bash", true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "complete -o default -o nospace -C 'cloudpan189-go' cloudpan189-go") {
+		t.Errorf("bash: %s", buf.String())
+	}
+
+	buf.Reset()
+	RunCompletion(buf, app, "bash", false)
+	if !strings.Contains(buf.String(), "-C 'env "+EnvCompleteCloudPath+"=0 cloudpan189-go'") {
+		t.Errorf("bash without cloud path: %s", buf.String())
+	}
+
+	for _, shell := range []string{"zsh", "fish"} {
+		buf.Reset()
+		if err := RunCompletion(buf, app, shell, true); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), "cloudpan189-go ls -output-paths-only") {
+			t.Errorf("%s: cloud path completion missing", shell)
+		}
+		buf.Reset()
+		RunCompletion(buf, app, shell, false)
+		if strings.Contains(buf.String(), "-output-paths-only") {
+			t.Errorf("%s: cloud path completion should be disabled", shell)
+		}
+	}
+
+	if err := RunCompletion(buf, app, "powershell", true); err == nil {
+		t.Error("expected error for unsupported shell")
+	}
+}
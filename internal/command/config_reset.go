@@ -0,0 +1,82 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/urfave/cli"
+)
+
+func CmdConfigReset() cli.Command {
+	return cli.Command{
+		Name:      "reset",
+		Usage:     "恢复所有配置项为默认值",
+		UsageText: cmder.App().Name + " config reset [-keep-accounts=false] [-confirm]",
+		Description: `
+	将所有配置项恢复为默认值并保存到配置文件. 默认保留已登录的账号,
+	使用 -keep-accounts=false 会同时删除所有账号. 未指定 -confirm 时需要输入 y 确认
+
+	例子:
+		cloudpan189-go config reset
+		cloudpan189-go config reset -confirm
+		cloudpan189-go config reset -keep-accounts=false -confirm`,
+		Action: func(c *cli.Context) error {
+			if !c.Bool("confirm") {
+				var confirm string
+				if c.BoolT("keep-accounts") {
+					fmt.Printf("所有配置项将恢复为默认值, 确认重置? (y/n) > ")
+				} else {
+					fmt.Printf("所有配置项将恢复为默认值, 并删除所有账号, 确认重置? (y/n) > ")
+				}
+				_, err := fmt.Scanln(&confirm)
+				if err != nil || (confirm != "y" && confirm != "Y") {
+					fmt.Printf("已取消\n")
+					return nil
+				}
+			}
+			RunConfigReset(c.BoolT("keep-accounts"))
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.BoolTFlag{
+				Name:  "keep-accounts",
+				Usage: "保留已登录的账号, 默认为 true",
+			},
+			cli.BoolFlag{
+				Name:  "confirm",
+				Usage: "跳过确认提示, 直接重置",
+			},
+		},
+	}
+}
+
+// RunConfigReset 恢复所有配置项为默认值并保存
+func RunConfigReset(keepAccounts bool) {
+	err := config.Config.Reset(keepAccounts)
+	if err != nil {
+		fmt.Printf("重置配置错误: %s\n", err)
+		return
+	}
+	err = config.Config.Save()
+	if err != nil {
+		fmt.Printf("保存配置错误: %s\n", err)
+		return
+	}
+
+	config.Config.PrintTable()
+	fmt.Printf("\n重置配置成功!\n\n")
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/urfave/cli"
+)
+
+func CmdConfigExport() cli.Command {
+	return cli.Command{
+		Name:      "export",
+		Usage:     "导出配置到文件, 用于在多台机器间共享配置",
+		UsageText: cmder.App().Name + " config export <文件路径>",
+		Description: `
+	以JSON格式导出除登录凭证外的所有配置项, 包括下载目录, 并发数, 限速, 代理等,
+	以及每个账号的工作目录和家庭云下载目录. 不会导出密码和token,
+	也不会导出只与本机有关的本地网卡地址, CA证书, 历史记录文件和日志文件路径.
+	导出的文件可以在其他机器上使用 config import 导入.
+
+	例子:
+		cloudpan189-go config export cloud189_config.json`,
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			RunConfigExport(c.Args().Get(0))
+			return nil
+		},
+	}
+}
+
+func CmdConfigImport() cli.Command {
+	return cli.Command{
+		Name:      "import",
+		Usage:     "从 config export 导出的文件导入配置",
+		UsageText: cmder.App().Name + " config import [-merge-accounts] <文件路径>",
+		Description: `
+	读取 config export 导出的文件, 合并到当前配置, 文件中没有的配置项保持不变.
+	导入后的配置检查不通过时 (参见 config validate), 不修改配置.
+	会覆盖已有的值时, 先列出将被修改的配置项, 输入 y 确认后才导入.
+	使用 -merge-accounts 时, 同时合并已登录的相同账号的工作目录和家庭云下载目录, 未登录的账号忽略.
+
+	例子:
+		cloudpan189-go config import cloud189_config.json
+		cloudpan189-go config import -merge-accounts cloud189_config.json`,
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			RunConfigImport(c.Args().Get(0), c.Bool("merge-accounts"))
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "merge-accounts",
+				Usage: "同时合并已登录的相同账号的设置",
+			},
+		},
+	}
+}
+
+// RunConfigExport 导出除登录凭证外的配置到 outputPath
+func RunConfigExport(outputPath string) {
+	// 导出的文件可能包含代理的密码
+	file, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		fmt.Printf("创建文件错误: %s\n", err)
+		return
+	}
+	defer file.Close()
+
+	if err = config.Config.ExportShared(file); err != nil {
+		fmt.Printf("导出配置错误: %s\n", err)
+		return
+	}
+	fmt.Printf("已导出配置到: %s\n", outputPath)
+}
+
+// RunConfigImport 从 inputPath 导入配置, 覆盖已有的值前需要输入 y 确认
+func RunConfigImport(inputPath string, mergeAccounts bool) {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		fmt.Printf("打开文件错误: %s\n", err)
+		return
+	}
+	defer file.Close()
+
+	changes, err := config.Config.ImportShared(file, mergeAccounts, confirmConfigChanges)
+	if err == config.ErrImportCanceled {
+		fmt.Printf("已取消\n")
+		return
+	}
+	if err != nil {
+		fmt.Printf("导入配置错误: %s\n", err)
+		return
+	}
+
+	// 使代理立即生效
+	config.Config.SetProxy(config.Config.Proxy)
+	if err = config.Config.Save(); err != nil {
+		fmt.Printf("保存配置错误: %s\n", err)
+		return
+	}
+	fmt.Printf("导入配置成功, 修改了 %d 项配置\n", len(changes))
+}
+
+// confirmConfigChanges 列出将被覆盖的配置项, 输入 y 确认
+func confirmConfigChanges(changes []*config.SettingChange) bool {
+	fmt.Printf("以下 %d 项配置将被覆盖:\n", len(changes))
+	for _, change := range changes {
+		fmt.Printf("  %s: %s -> %s\n", change.Key, change.Old, change.New)
+	}
+	fmt.Printf("确认导入? (y/n) > ")
+	var confirm string
+	_, err := fmt.Scanln(&confirm)
+	return err == nil && (confirm == "y" || confirm == "Y")
+}
@@ -88,16 +88,15 @@ func CmdMv() cli.Command {
 				return nil
 			}
 
-			RunMove(parseFamilyId(c), c.Args()...)
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			RunMove(familyId, c.Args()...)
 			return nil
 		},
-		Flags: []cli.Flag{
-			cli.StringFlag{
-				Name:  "familyId",
-				Usage: "家庭云ID",
-				Value: "",
-			},
-		},
+		Flags: FamilyFlags,
 	}
 }
 
@@ -0,0 +1,207 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctapi/cloudpan/apierror"
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/phpc0de/ctpango/internal/functions/pandiff"
+	"github.com/urfave/cli"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+)
+
+type (
+	// pager 分页输出, 非终端或找不到分页程序时直接输出到标准输出
+	pager struct {
+		io.Writer
+		cmd *exec.Cmd
+		in  io.WriteCloser
+	}
+)
+
+func CmdDiff() cli.Command {
+	return cli.Command{
+		Name:      "diff",
+		Usage:     "对比本地目录和云盘目录",
+		UsageText: cmder.App().Name + " diff <本地目录> <云盘目录>",
+		Description: `
+	对比本地目录和云盘目录下的所有文件, 先比较文件大小, 大小相同时再比较md5.
+	输出三类文件: 只存在于本地的文件, 只存在于云盘的文件, 以及两边都存在但内容不同的文件.
+	在终端中运行时使用颜色区分 (红色: 只存在于本地, 绿色: 只存在于云盘, 黄色: 内容不同),
+	并使用环境变量 PAGER 指定的程序 (默认为 less) 分页输出.
+
+	示例:
+
+	对比本地的 d:/panfile 和云盘的 /我的资源
+	cloudpan189-go diff d:/panfile /我的资源
+
+	以JSON格式输出对比结果
+	cloudpan189-go diff -json d:/panfile /我的资源 > diff.json
+`,
+		Category: "天翼云盘",
+		Before:   cmder.ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 2 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			if config.Config.ActiveUser() == nil {
+				fmt.Println("未登录账号")
+				return nil
+			}
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			result := RunDiff(familyId, c.Args().Get(0), c.Args().Get(1))
+			if result == nil {
+				return nil
+			}
+			if c.Bool("json") {
+				data, err := json.MarshalIndent(result, "", "  ")
+				if err != nil {
+					fmt.Println(err)
+					return nil
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+
+			p := newPager(c.Bool("no-pager"))
+			pandiff.WriteText(p, result, isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == "")
+			p.Close()
+			return nil
+		},
+		Flags: append([]cli.Flag{
+			cli.BoolFlag{
+				Name:  "json",
+				Usage: "以JSON格式输出对比结果",
+			},
+			cli.BoolFlag{
+				Name:  "no-pager",
+				Usage: "不使用分页程序, 直接输出",
+			},
+		}, FamilyFlags...),
+	}
+}
+
+// RunDiff 对比本地目录和云盘目录, 出错时返回 nil
+func RunDiff(familyId int64, localDir, cloudDir string) *pandiff.DiffResult {
+	localDir = filepath.Clean(localDir)
+	if fi, err := os.Stat(localDir); err != nil {
+		fmt.Println(err)
+		return nil
+	} else if !fi.IsDir() {
+		fmt.Printf("本地路径不是目录: %s\n", localDir)
+		return nil
+	}
+
+	activeUser := GetActiveUser()
+	cloudDir = path.Clean(activeUser.PathJoin(familyId, cloudDir))
+	cloudFiles := make([]*pandiff.FileEntry, 0)
+	var walkErr error
+	activeUser.PanClient().AppFilesDirectoriesRecurseList(familyId, cloudDir, func(depth int, fdPath string, fd *cloudpan.AppFileEntity, apiError *apierror.ApiError) bool {
+		if apiError != nil {
+			walkErr = apiError
+			return false
+		}
+		// 只有云盘路径为文件时, 才会以 depth 0 回调
+		if depth == 0 {
+			walkErr = fmt.Errorf("云盘路径不是目录: %s", cloudDir)
+			return false
+		}
+		cloudFiles = append(cloudFiles, &pandiff.FileEntry{
+			Path: pandiff.RelativeCloudPath(cloudDir, fdPath),
+			Size: fd.FileSize,
+			MD5:  fd.FileMd5,
+		})
+		return true
+	})
+	if walkErr != nil {
+		fmt.Printf("获取云盘文件列表错误: %s\n", walkErr)
+		return nil
+	}
+
+	localFiles, err := pandiff.LocalFiles(localDir)
+	if err != nil {
+		fmt.Printf("获取本地文件列表错误: %s\n", err)
+		return nil
+	}
+
+	result, err := pandiff.Diff(localFiles, cloudFiles, pandiff.LocalMD5)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	return result
+}
+
+// isTerminal 文件是否为终端
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// newPager 标准输出为终端时, 使用 PAGER 环境变量指定的程序分页输出, 未设置时尝试使用 less
+func newPager(disable bool) *pager {
+	p := &pager{Writer: os.Stdout}
+	if disable || !isTerminal(os.Stdout) {
+		return p
+	}
+
+	pagerCmd := os.Getenv("PAGER")
+	if pagerCmd == "" {
+		if _, err := exec.LookPath("less"); err != nil {
+			return p
+		}
+		pagerCmd = "less"
+	}
+	cmd := exec.Command(pagerCmd)
+	if pagerCmd == "less" {
+		// 内容不足一屏时直接退出, 并保留颜色
+		cmd.Args = append(cmd.Args, "-FRX")
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return p
+	}
+	if err = cmd.Start(); err != nil {
+		return p
+	}
+	p.Writer, p.cmd, p.in = in, cmd, in
+	return p
+}
+
+// Close 等待分页程序退出
+func (p *pager) Close() error {
+	if p.cmd == nil {
+		return nil
+	}
+	p.in.Close()
+	return p.cmd.Wait()
+}
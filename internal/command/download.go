@@ -14,36 +14,70 @@
 package command
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/phpc0de/ctapi/cloudpan"
 	"github.com/phpc0de/ctapi/cloudpan/apierror"
 	"github.com/phpc0de/ctpango/cmder"
 	"github.com/phpc0de/ctpango/cmder/cmdtable"
+	"github.com/phpc0de/ctpango/internal/apistat"
 	"github.com/phpc0de/ctpango/internal/config"
 	"github.com/phpc0de/ctpango/internal/file/downloader"
 	"github.com/phpc0de/ctpango/internal/functions/pandownload"
+	"github.com/phpc0de/ctpango/internal/logfile"
+	"github.com/phpc0de/ctpango/library/crypto"
 	"github.com/phpc0de/ctpango/internal/taskframework"
 	"github.com/phpc0de/ctlibgo/converter"
 	"github.com/phpc0de/ctpango/library/requester/transfer"
 	"github.com/urfave/cli"
+	"io"
+	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type (
 	//DownloadOptions 下载可选参数
 	DownloadOptions struct {
-		IsPrintStatus        bool
-		IsExecutedPermission bool
-		IsOverwrite          bool
-		SaveTo               string
-		Parallel             int
-		Load                 int
-		MaxRetry             int
-		NoCheck              bool
-		ShowProgress         bool
-		FamilyId             int64
+		IsPrintStatus            bool
+		IsListWorkers            bool // 每个下载线程输出一行简要状态
+		MaxNameLength            int  // 下载进度中文件名的最大长度
+		IsPrintSpeedReport       bool
+		BandwidthHistoryPath     string // 不为空时, 每秒记录一次下载速度到该CSV文件
+		IsPrintCompletionTime    bool
+		Offset                   int   // 目录展开时跳过前 Offset 个文件
+		Limit                    int   // 目录展开时最多下载 Limit 个文件, 0为不限制
+		LimitTotalSize           int64 // 下载数据总量达到 LimitTotalSize 后不再开始新的下载任务, 0为不限制
+		IsExecutedPermission     bool
+		IsOverwrite              bool
+		SaveTo                   string
+		Parallel                 int
+		ConcurrentFiles          int // 同时下载的文件数量
+		MaxRetry                 int
+		MaxChecksumRetry         int // 文件校验失败最大重试次数, 不占用 MaxRetry
+		NoCheck                  bool
+		ShowProgress             bool
+		FamilyId                 int64
+		ChecksumAlgorithm        string // 校验文件使用的摘要算法, 目前只支持 md5
+		Adaptive                 bool
+		BandwidthTest            bool          // 开始下载前测量可用带宽, 未指定 Parallel 时根据带宽减少每个文件的下载线程数
+		InterfaceChangeDetection bool          // 本机网络地址变化时立即重新建立连接
+		DecryptKey               []byte        // 不为空时, 下载完成后解密 .enc 后缀的文件
+		TaskTimeout              time.Duration // 单个文件每次下载的超时时间, 超时后重试, 0为不限制
+		SkipFirstBytes           int64         // 大于0时忽略断点续传文件, 从该偏移开始下载, 只支持下载单个文件
+		SpeedSamplingWindow      time.Duration // 显示的下载速度为该时间内的平均速度
+		PrecomputePaths          bool          // 开始下载前并发展开所有目录, 预先计算所有文件的保存路径和文件总数
+		CloudMoveBeforeDownload  bool          // 下载前移动网盘文件到暂存目录, 下载成功后删除, 失败后移回原目录
+		MirrorStructure          bool          // 指定 SaveTo 时在保存目录下保留完整的网盘路径
+		FilterExtensions         []string      // 不为空时, 下载目录时只下载这些扩展名的文件
+		ExcludeExtensions        []string      // 下载目录时不下载这些扩展名的文件
+		PipeCommand              string        // 不为空时, 每个文件下载到临时目录并校验后, 写入该 shell 命令的标准输入
 	}
 
 	// LocateDownloadOption 获取下载链接可选参数
@@ -58,6 +92,9 @@ var (
 
 	// DownloadCacheSize 默认每个线程下载缓存大小
 	DownloadCacheSize = 64 * converter.KB
+
+	// ErrSkipFirstBytesNotFile skip-first-N-bytes 的下载目标不是单个文件
+	ErrSkipFirstBytesNotFile = errors.New("skip-first-N-bytes 只支持下载单个文件, 不支持目录")
 )
 
 func CmdDownload() cli.Command {
@@ -88,6 +125,70 @@ func CmdDownload() cli.Command {
 
     下载 /我的资源/1.mp4 并保存下载的文件到本地的 d:/panfile
 	cloudpan189-go d --saveto d:/panfile /我的资源/1.mp4
+
+	下载 /我的资源/2024 目录到 d:/panfile, 保留完整的网盘路径, 文件保存到 d:/panfile/我的资源/2024 目录
+	cloudpan189-go d --saveto d:/panfile --mirror-structure /我的资源/2024
+
+	只下载 /我的资源 目录中的 mp4 和 mkv 文件
+	cloudpan189-go d --filter-ext mp4,mkv /我的资源
+
+	下载 /我的资源 目录, 不下载其中的 txt 和 nfo 文件
+	cloudpan189-go d --exclude-ext txt,nfo /我的资源
+
+	下载 /加密 目录中的 .enc 文件, 不保存到本地, 每个文件下载校验后写入 openssl 命令的标准输入进行解密,
+	命令可以使用环境变量 ` + pandownload.PipeEnvFileName + ` (文件名) 和 ` + pandownload.PipeEnvCloudPath + ` (网盘路径)
+	cloudpan189-go d --download-to-pipe 'openssl enc -d -aes-256-cbc -pass env:KEY -out "${` + pandownload.PipeEnvFileName + `%.enc}"' /加密/*.enc
+
+	下载 /我的资源/1.mp4, 并把每秒的下载速度记录到 speeds.csv
+	cloudpan189-go d --output-bandwidth-history speeds.csv /我的资源/1.mp4
+
+	从环境变量 FAMILY_ID 中读取家庭云ID, 下载家庭云中的 /我的资源/1.mp4
+	cloudpan189-go d --family-id-env FAMILY_ID /我的资源/1.mp4
+
+	分批下载 /我的资源 目录, 每次下载1000个文件
+	cloudpan189-go d --offset 0 --limit 1000 /我的资源
+	cloudpan189-go d --offset 1000 --limit 1000 /我的资源
+
+	下载 /我的资源 目录, 下载的数据总量达到 1GB 后不再开始新的下载任务, 正在下载的文件会继续下载完成
+	cloudpan189-go d --limit-total-size 1GB /我的资源
+
+	只输出 /我的资源/1.mp4 的临时下载链接, 不下载, 可以配合 curl 或 wget 使用, 注意链接很快就会失效
+	cloudpan189-go d --show-cloud-url /我的资源/1.mp4
+
+	同时下载 /我的资源 目录中的 4 个文件, 每个文件使用 8 个线程下载,
+	总线程数超过 max_download_total_parallel 时会自动减少每个文件的线程数
+	cloudpan189-go d --concurrent-files 4 -p 8 /我的资源
+
+	下载 /我的资源 目录, 开始下载前测量5秒可用带宽, 带宽较低时自动减少每个文件的下载线程数, 指定 -p 时不调整
+	cloudpan189-go d --bandwidth-test /我的资源
+
+	下载 upload -upload-encrypt 加密上传的 /我的资源/1.mp4.enc, 使用密钥文件 my.key 解密后保存为 1.mp4
+	cloudpan189-go d --download-decrypt my.key /我的资源/1.mp4.enc
+
+	下载 /我的资源 目录, 单个文件下载超过 30 分钟仍未完成时停止该文件的下载并重试, 避免卡住的下载一直占用下载队列
+	cloudpan189-go d --task-timeout 1800 /我的资源
+
+	下载 /我的资源/1.mp4, 显示最近10秒的平均下载速度, 速度显示更平滑
+	cloudpan189-go d --speed-sampling-window 10 /我的资源/1.mp4
+
+	下载 /我的资源/1.mp4, 每个下载线程输出一行简要状态, 适合较窄的终端
+	cloudpan189-go d --list-workers /我的资源/1.mp4
+
+	下载 /我的资源 目录, 下载进度中的文件名最多显示20个字符, 0为不截断
+	cloudpan189-go d --max-name-length 20 /我的资源
+
+	断点续传文件丢失, 本地的 1.mp4 已下载了 104857600 字节, 从该位置继续下载
+	cloudpan189-go d --skip-first-N-bytes 104857600 /我的资源/1.mp4
+
+	下载 /我的资源 目录, 开始下载前先列出所有文件, 下载过程中输出总进度
+	cloudpan189-go d --precompute-paths /我的资源
+
+	下载 /我的资源 目录, 每个文件下载前先移动到所在目录的 _downloading 暂存目录, 下载期间其他设备看不到该文件,
+	下载并校验成功后删除网盘中的文件, 下载失败则移回原位置
+	cloudpan189-go d --cloud-move-before-download /我的资源
+
+	依次使用所有已登录的账号, 下载各个账号网盘中的 /我的资源 目录, 完成后恢复当前账号, 文件默认保存到以账号UID命名的目录
+	cloudpan189-go d --all-users /我的资源
 `,
 		Category: "天翼云盘",
 		Before:   cmder.ReloadConfigFunc,
@@ -107,23 +208,108 @@ func CmdDownload() cli.Command {
 				saveTo = filepath.Clean(c.String("saveto"))
 			}
 
+			if err := checkAllUsersFamilyFlags(c); err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
 			do := &DownloadOptions{
-				IsPrintStatus:        c.Bool("status"),
-				IsExecutedPermission: c.Bool("x"),
-				IsOverwrite:          c.Bool("ow"),
-				SaveTo:               saveTo,
-				Parallel:             c.Int("p"),
-				Load:                 c.Int("l"),
-				MaxRetry:             c.Int("retry"),
-				NoCheck:              c.Bool("nocheck"),
-				ShowProgress:         !c.Bool("np"),
-				FamilyId:             parseFamilyId(c),
+				IsPrintStatus:            c.Bool("status"),
+				IsListWorkers:            c.Bool("list-workers"),
+				MaxNameLength:            c.Int("max-name-length"),
+				IsPrintSpeedReport:       c.Bool("speed-report"),
+				BandwidthHistoryPath:     c.String("output-bandwidth-history"),
+				IsPrintCompletionTime:    c.Bool("output-completion-time"),
+				Offset:                   c.Int("offset"),
+				Limit:                    c.Int("limit"),
+				IsExecutedPermission:     c.Bool("x"),
+				IsOverwrite:              c.Bool("ow"),
+				SaveTo:                   saveTo,
+				Parallel:                 c.Int("p"),
+				ConcurrentFiles:          c.Int("concurrent-files"),
+				MaxRetry:                 c.Int("retry"),
+				MaxChecksumRetry:         c.Int("retry-on-checksum-fail"),
+				NoCheck:                  c.Bool("nocheck"),
+				ShowProgress:             !c.Bool("np"),
+				FamilyId:                 familyId,
+				ChecksumAlgorithm:        c.String("checksum-algorithm"),
+				Adaptive:                 c.Bool("adaptive"),
+				BandwidthTest:            c.Bool("bandwidth-test"),
+				InterfaceChangeDetection: c.Bool("interface-change-detection"),
+				TaskTimeout:              time.Duration(c.Int("task-timeout")) * time.Second,
+				SpeedSamplingWindow:      time.Duration(c.Int("speed-sampling-window")) * time.Second,
+				PrecomputePaths:          c.Bool("precompute-paths"),
+				CloudMoveBeforeDownload:  c.Bool("cloud-move-before-download"),
+				MirrorStructure:          c.Bool("mirror-structure"),
+				FilterExtensions:         pandownload.ParseExtensions(c.String("filter-ext")),
+				ExcludeExtensions:        pandownload.ParseExtensions(c.String("exclude-ext")),
+				PipeCommand:              c.String("download-to-pipe"),
 			}
 
-			RunDownload(c.Args(), do)
+			if c.IsSet("skip-first-N-bytes") {
+				if c.NArg() != 1 || c.Int64("skip-first-N-bytes") < 0 {
+					fmt.Printf("skip-first-N-bytes 只支持下载单个文件, 且不能小于0\n")
+					return nil
+				}
+				do.SkipFirstBytes = c.Int64("skip-first-N-bytes")
+			}
+
+			if c.IsSet("limit-total-size") {
+				size, err := converter.ParseFileSizeStr(c.String("limit-total-size"))
+				if err != nil || size < 0 {
+					fmt.Printf("下载数据总量上限错误: %s\n", c.String("limit-total-size"))
+					return nil
+				}
+				do.LimitTotalSize = size
+			}
+			if !do.NoCheck && !pandownload.IsHashAlgorithmSupported(do.ChecksumAlgorithm) {
+				fmt.Printf("不支持的校验算法: %s, 天翼云盘目前只提供文件的md5值, 可选值: md5\n", do.ChecksumAlgorithm)
+				return nil
+			}
+			if do.CloudMoveBeforeDownload && do.NoCheck {
+				fmt.Println("--cloud-move-before-download 需要校验下载的文件后才删除网盘文件, 不能和 --nocheck 同时使用")
+				return nil
+			}
+			if c.Bool("show-cloud-url") {
+				RunShowCloudUrl(do.FamilyId, c.Args())
+				return nil
+			}
+			if c.IsSet("download-decrypt") {
+				key, err := crypto.LoadGCMKeyFile(c.String("download-decrypt"))
+				if err != nil {
+					fmt.Printf("读取解密密钥文件错误: %s\n", err)
+					return nil
+				}
+				do.DecryptKey = key
+			}
+
+			if c.Bool("all-users") {
+				paths := c.Args()
+				err := RunForAllUsers(activeUserOp(func(familyId int64) error {
+					o := *do
+					o.FamilyId = familyId
+					return RunDownload(paths, &o)
+				}))
+				if err == ErrShutdown {
+					return err
+				}
+				if err != nil {
+					fmt.Println(err)
+				}
+				return nil
+			}
+
+			if err := RunDownload(c.Args(), do); err == ErrShutdown {
+				return err
+			}
 			return nil
 		},
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
+			AllUsersFlag,
 			cli.BoolFlag{
 				Name:  "ow",
 				Usage: "overwrite, 覆盖已存在的文件",
@@ -132,6 +318,39 @@ func CmdDownload() cli.Command {
 				Name:  "status",
 				Usage: "输出所有线程的工作状态",
 			},
+			cli.BoolFlag{
+				Name:  "list-workers",
+				Usage: "每个未完成的线程输出一行工作状态, 比 status 的表格更紧凑, 适合较窄的终端",
+			},
+			cli.IntFlag{
+				Name:  "max-name-length",
+				Usage: "下载进度中文件名的最大长度, 超过时截断中间的部分, 以 ... 代替, 不影响保存的文件名, 0为不截断",
+				Value: DefaultMaxNameLength,
+			},
+			cli.BoolFlag{
+				Name:  "speed-report",
+				Usage: "下载完成后输出各个线程的速度统计",
+			},
+			cli.StringFlag{
+				Name:  "output-bandwidth-history",
+				Usage: "每秒记录一次下载速度到指定的CSV文件, 格式为: timestamp,task_id,total_speed_bps,worker_speeds..., 用于分析下载过程中的限速和拥塞",
+			},
+			cli.IntFlag{
+				Name:  "offset",
+				Usage: "下载目录时跳过前 offset 个文件, 配合 limit 分批下载大目录",
+			},
+			cli.IntFlag{
+				Name:  "limit",
+				Usage: "下载目录时最多下载 limit 个文件, 0为不限制",
+			},
+			cli.StringFlag{
+				Name:  "limit-total-size",
+				Usage: "下载的数据总量达到该值后不再开始新的下载任务, 正在下载的文件会继续下载完成, 例如 1GB, 0为不限制",
+			},
+			cli.BoolFlag{
+				Name:  "output-completion-time",
+				Usage: "每个文件下载成功后输出完成时间",
+			},
 			cli.BoolFlag{
 				Name:  "save",
 				Usage: "将下载的文件直接保存到当前工作目录",
@@ -140,37 +359,284 @@ func CmdDownload() cli.Command {
 				Name:  "saveto",
 				Usage: "将下载的文件直接保存到指定的目录",
 			},
+			cli.BoolFlag{
+				Name:  "mirror-structure",
+				Usage: "配合 save 或 saveto 使用, 在保存目录下保留完整的网盘路径, 默认只保留下载的文件或目录本身",
+			},
+			cli.StringFlag{
+				Name:  "filter-ext",
+				Usage: "下载目录时只下载指定扩展名的文件, 多个扩展名用逗号分隔, 不区分大小写, 例如: mp4,mkv",
+			},
+			cli.StringFlag{
+				Name:  "exclude-ext",
+				Usage: "下载目录时不下载指定扩展名的文件, 多个扩展名用逗号分隔, 不区分大小写, 例如: txt,nfo",
+			},
+			cli.StringFlag{
+				Name:  "download-to-pipe",
+				Usage: "不保存文件, 每个文件先下载到临时目录并校验, 再写入该 shell 命令的标准输入, 完成后删除临时文件. 标准输出只包含命令的输出, 下载进度等信息输出到标准错误",
+			},
 			cli.BoolFlag{
 				Name:  "x",
 				Usage: "为文件加上执行权限, (windows系统无效)",
 			},
 			cli.IntFlag{
 				Name:  "p",
-				Usage: "指定下载线程数",
+				Usage: "指定每个文件的下载线程数",
+			},
+			cli.BoolFlag{
+				Name:  "adaptive",
+				Usage: "根据实际的下载速度自动调整下载线程数, 不超过指定的下载线程数",
+			},
+			cli.BoolFlag{
+				Name:  "bandwidth-test",
+				Usage: "开始下载前使用与下载相同的线程数测量5秒可用带宽 (最多下载16MB), 未指定 -p 时根据测量结果减少每个文件的下载线程数",
+			},
+			cli.BoolFlag{
+				Name:  "interface-change-detection",
+				Usage: "每10秒检测一次本机的网络地址, 发生变化时 (例如切换WiFi或移动热点) 立即重新获取下载链接并重新连接, 不等待失效的连接超时",
+			},
+			cli.IntFlag{
+				Name:  "concurrent-files, l",
+				Usage: "指定同时进行下载文件的数量, 与每个文件的下载线程数 -p 相互独立",
 			},
 			cli.IntFlag{
-				Name:  "l",
-				Usage: "指定同时进行下载文件的数量",
+				Name:  "task-timeout",
+				Usage: "单个文件每次下载的超时时间, 单位为秒, 超时后停止该文件的下载并重试(断点续传), 0为不限制",
+			},
+			cli.IntFlag{
+				Name:  "speed-sampling-window",
+				Usage: "显示的下载速度为最近多少秒的平均速度, 窗口越小速度变化越及时但波动越大, 窗口越大速度越平滑",
+				Value: int(downloader.DefaultSpeedSamplingWindow / time.Second),
+			},
+			cli.BoolFlag{
+				Name:  "precompute-paths",
+				Usage: "开始下载前先并发展开所有目录, 计算所有文件的保存路径, 下载过程中输出总进度(已结束的文件数/文件总数)",
+			},
+			cli.Int64Flag{
+				Name:  "skip-first-N-bytes",
+				Usage: "认为本地文件的前N个字节已下载, 忽略断点续传文件, 从第N个字节开始下载. 用于断点续传文件损坏或丢失时手动继续下载, 只支持下载单个文件",
 			},
 			cli.IntFlag{
 				Name:  "retry",
 				Usage: "下载失败最大重试次数",
 				Value: pandownload.DefaultDownloadMaxRetry,
 			},
+			cli.IntFlag{
+				Name:  "retry-on-checksum-fail",
+				Usage: "文件校验失败时重新下载的最大次数, 单独计数, 不占用 retry 的重试次数",
+				Value: pandownload.DefaultChecksumMaxRetry,
+			},
+			cli.BoolFlag{
+				Name:  "cloud-move-before-download",
+				Usage: "下载前移动网盘文件到所在目录的 " + pandownload.CloudStagingDirName + " 暂存目录, 下载并校验成功后删除网盘文件, 失败后移回原位置",
+			},
 			cli.BoolFlag{
 				Name:  "nocheck",
-				Usage: "下载文件完成后不校验文件",
+				Usage: "下载文件完成后不校验文件, 忽略 checksum-algorithm 指定的任何校验算法",
+			},
+			cli.StringFlag{
+				Name:  "checksum-algorithm, hash-algorithm",
+				Usage: "下载文件完成后校验文件使用的摘要算法, 天翼云盘目前只提供文件的md5值, 可选值: md5",
+				Value: pandownload.HashAlgorithmMD5,
 			},
 			cli.BoolFlag{
-				Name:  "np",
-				Usage: "no progress 不展示下载进度条",
+				Name:  "show-cloud-url",
+				Usage: "不下载文件, 只输出文件的临时下载链接, 格式为: <网盘路径>\t<下载链接>, 链接的有效时间很短",
 			},
 			cli.StringFlag{
-				Name:  "familyId",
-				Usage: "家庭云ID",
-				Value: "",
+				Name:  "download-decrypt",
+				Usage: "从指定的密钥文件读取32字节密钥, 下载完成后使用 AES-256-GCM 解密 .enc 后缀的文件, 并去掉 .enc 后缀",
 			},
-		},
+			cli.BoolFlag{
+				Name:  "np",
+				Usage: "no progress 不展示下载进度条",
+			},
+		}, FamilyFlags...),
+	}
+}
+
+// checkSkipFirstBytesTarget 检查 skip-first-N-bytes 的下载目标为单个文件, 目录中的文件不会使用该参数
+func checkSkipFirstBytesTarget(client checkClient, familyId int64, paths []string) error {
+	if len(paths) != 1 {
+		return ErrSkipFirstBytesNotFile
+	}
+	fe, apierr := client.AppFileInfoByPath(familyId, paths[0])
+	if apierr != nil {
+		return fmt.Errorf("获取网盘文件信息错误: %s, %s", paths[0], apierr)
+	}
+	if fe.IsFolder {
+		return fmt.Errorf("%w: %s", ErrSkipFirstBytesNotFile, paths[0])
+	}
+	return nil
+}
+
+// RunShowCloudUrl 输出网盘文件的临时下载链接, 每行一个: <网盘路径>\t<下载链接>
+// 错误信息输出到标准错误, 方便把下载链接重定向到文件或其他程序. 下载链接不写入日志文件
+func RunShowCloudUrl(familyId int64, paths []string) {
+	paths, err := matchPathByShellPattern(familyId, paths...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	panClient := GetActivePanClient()
+	for _, panPath := range paths {
+		fileInfo, apierr := panClient.AppFileInfoByPath(familyId, panPath)
+		if apierr != nil {
+			fmt.Fprintf(os.Stderr, "获取网盘文件信息错误: %s, %s\n", panPath, apierr)
+			continue
+		}
+		if fileInfo.IsFolder {
+			fmt.Fprintf(os.Stderr, "不支持获取目录的下载链接, 跳过: %s\n", panPath)
+			continue
+		}
+
+		var durl string
+		if familyId > 0 {
+			durl, apierr = panClient.AppFamilyGetFileDownloadUrl(familyId, fileInfo.FileId)
+		} else {
+			durl, apierr = panClient.AppGetFileDownloadUrl(fileInfo.FileId)
+		}
+		if apierr != nil {
+			fmt.Fprintf(os.Stderr, "获取下载链接错误: %s, %s\n", panPath, apierr)
+			continue
+		}
+		fmt.Fprintf(logfile.Stdout(), "%s\t%s\n", panPath, durl)
+	}
+}
+
+// enqueueDownloads 为 paths 中的每个网盘路径创建下载任务并加入 executor
+func enqueueDownloads(executor *taskframework.TaskExecutor, newUnit func(panPath string, familyId int64) *pandownload.DownloadTaskUnit, paths []string, options *DownloadOptions) {
+	for k := range paths {
+		unit := newUnit(paths[k], options.FamilyId)
+
+		// 设置储存的路径
+		unit.OriginSaveRootPath, unit.SavePath, unit.PanRootDir = downloadSavePaths(paths[k], options)
+		info := executor.Append(unit, options.MaxRetry)
+		fmt.Printf("[%s] 加入下载队列: %s\n", info.Id(), paths[k])
+	}
+}
+
+// downloadSavePaths 返回网盘路径 panPath 的本地保存根目录, 保存路径和目录展开时去掉的网盘路径前缀,
+// 目录内的文件保存到 pandownload.SavePathOf(保存根目录, 网盘路径前缀, 文件的网盘路径).
+// 指定 SaveTo 时默认只保留 panPath 本身, 如 /photos/2024 的文件保存到 SaveTo/2024 下, MirrorStructure 时保留完整的网盘路径
+func downloadSavePaths(panPath string, options *DownloadOptions) (saveRootPath, savePath, panRootDir string) {
+	if options.SaveTo != "" {
+		if options.MirrorStructure {
+			return options.SaveTo, filepath.Join(options.SaveTo, panPath), ""
+		}
+		return options.SaveTo, filepath.Join(options.SaveTo, path.Base(panPath)), path.Dir(panPath)
+	}
+	// 使用默认的保存路径
+	return GetActiveUser().GetFamilySavePath(options.FamilyId, ""), GetActiveUser().GetFamilySavePath(options.FamilyId, panPath), ""
+}
+
+// planDownloads 预先展开 paths 中的所有目录, 返回所有要下载的文件和保存路径, 同时在本地创建所有目录, 保证空目录也能被保存
+func planDownloads(panClient *apistat.PanClient, paths []string, options *DownloadOptions) []*pandownload.PlannedDownload {
+	fmt.Printf("[0] 正在列出所有要下载的文件...\n")
+	var (
+		planned []*pandownload.PlannedDownload
+		lister  = pandownload.NewFolderLister(panClient, options.FamilyId)
+	)
+	for _, panPath := range paths {
+		fileInfo, apierr := panClient.AppFileInfoByPath(options.FamilyId, panPath)
+		if apierr != nil {
+			fmt.Printf("[0] 获取下载路径信息错误: %s, %s\n", panPath, apierr)
+			continue
+		}
+		saveRootPath, savePath, panRootDir := downloadSavePaths(panPath, options)
+		if !fileInfo.IsFolder {
+			planned = append(planned, &pandownload.PlannedDownload{FileInfo: fileInfo, SavePath: savePath, SaveRootPath: saveRootPath, PanRootDir: panRootDir})
+			continue
+		}
+
+		files, dirs, err := pandownload.PlanDownload(fileInfo, saveRootPath, panRootDir, lister, pandownload.DefaultPlanParallel)
+		if err != nil {
+			fmt.Printf("[0] 警告: 列出目录 %s 错误, 部分文件不会被下载: %s\n", panPath, err)
+		}
+		files = filterPlannedDownloads(files, options)
+		for _, dir := range append([]string{savePath}, dirs...) {
+			os.MkdirAll(dir, 0777)
+		}
+		planned = append(planned, files...)
+	}
+	fmt.Printf("[0] 共 %d 个文件\n", len(planned))
+	return planned
+}
+
+// filterPlannedDownloads 只保留符合扩展名过滤条件的文件
+func filterPlannedDownloads(files []*pandownload.PlannedDownload, options *DownloadOptions) []*pandownload.PlannedDownload {
+	if len(options.FilterExtensions) == 0 && len(options.ExcludeExtensions) == 0 {
+		return files
+	}
+	filtered := make([]*pandownload.PlannedDownload, 0, len(files))
+	for _, pd := range files {
+		if pandownload.MatchExtensions(pd.FileInfo.FileName, options.FilterExtensions, options.ExcludeExtensions) {
+			filtered = append(filtered, pd)
+		}
+	}
+	return filtered
+}
+
+// appendPlannedDownloads 把预先计算的文件加入下载队列, 并设置文件总数用于输出总进度
+func appendPlannedDownloads(executor *taskframework.TaskExecutor, newUnit func(panPath string, familyId int64) *pandownload.DownloadTaskUnit, planned []*pandownload.PlannedDownload, queueCounter *pandownload.DownloadQueueCounter, statistic *pandownload.DownloadStatistic, options *DownloadOptions) {
+	var total int64
+	for _, pd := range planned {
+		add, stop := queueCounter.Next()
+		if stop {
+			if queueCounter.NeedWarnCapped() {
+				fmt.Printf("[0] 警告: 加入下载队列的文件数量已达到上限 %d, 不再添加新的下载任务, 请使用 --offset 和 --limit 分批下载\n", queueCounter.MaxQueue)
+			}
+			break
+		}
+		if !add {
+			continue
+		}
+
+		unit := newUnit(pd.FileInfo.Path, options.FamilyId)
+		unit.SetFileInfo(pd.FileInfo)
+		unit.SavePath = pd.SavePath
+		unit.OriginSaveRootPath = pd.SaveRootPath
+		unit.PanRootDir = pd.PanRootDir
+		info := executor.Append(unit, options.MaxRetry)
+		fmt.Printf("[%s] 加入下载队列: %s\n", info.Id(), pd.FileInfo.Path)
+		total++
+	}
+	statistic.SetTotalFiles(total)
+}
+
+// downloadQueueKey 返回区分下载队列文件的参数, 账号, 家庭云, 保存位置和网盘路径相同的下载使用同一个队列文件
+func downloadQueueKey(paths []string, options *DownloadOptions) string {
+	return fmt.Sprintf("%d\n%d\n%s\n%t\n%s", GetActiveUser().UID, options.FamilyId, options.SaveTo, options.MirrorStructure, strings.Join(paths, "\n"))
+}
+
+// resumeDownloadQueue 检测上一次以相同参数下载时未完成的下载队列, 确认后加入下载队列
+func resumeDownloadQueue(executor *taskframework.TaskExecutor, newUnit func(panPath string, familyId int64) *pandownload.DownloadTaskUnit, queuePath string) {
+	queue, err := taskframework.LoadPersistedQueue(queuePath)
+	if err != nil {
+		fmt.Printf("读取未完成的下载队列错误: %s\n", err)
+		return
+	}
+	if queue == nil || len(queue.Tasks) == 0 {
+		return
+	}
+
+	var confirm string
+	fmt.Printf("发现上次未完成的下载队列, 共 %d 个任务, 保存时间: %s\n", len(queue.Tasks), time.Unix(queue.Timestamp, 0).Format("2006-01-02 15:04:05"))
+	fmt.Printf("是否继续下载? (y/n) > ")
+	_, err = fmt.Scanln(&confirm)
+	if err != nil || (confirm != "y" && confirm != "Y") {
+		fmt.Printf("已放弃上次未完成的下载队列\n")
+		return
+	}
+
+	for _, task := range queue.Tasks {
+		unit := newUnit(task.PanPath, task.FamilyId)
+		unit.SavePath = task.SavePath
+		unit.OriginSaveRootPath = task.SaveRootPath
+		unit.PanRootDir = task.PanRootDir
+		info := executor.AppendPersisted(unit, task)
+		fmt.Printf("[%s] 恢复下载队列: %s\n", info.Id(), task.PanPath)
 	}
 }
 
@@ -178,42 +644,104 @@ func downloadPrintFormat(load int) string {
 	if load <= 1 {
 		return pandownload.DefaultPrintFormat
 	}
-	return "\r[%s] ↓ %s/%s %s/s in %s, left %s ..."
+	return "\r[%s] %s↓ %s/%s %s/s in %s, left %s ..."
 }
 
-// RunDownload 执行下载网盘内文件
-func RunDownload(paths []string, options *DownloadOptions) {
+// downloadProgressStyle 返回配置的下载进度样式, 配置错误时使用 StyleSimple
+func downloadProgressStyle() downloader.ProgressStyle {
+	style, err := downloader.ParseProgressStyle(config.Config.ProgressStyle)
+	if err != nil {
+		panCommandVerbose.Warnf("%s\n", err)
+		return downloader.StyleSimple
+	}
+	return style
+}
+
+// downloadRateSchedule 返回按时间段限速的函数, 没有设置限速计划时返回nil
+func downloadRateSchedule() func(now time.Time) int64 {
+	rs := config.Config.RateSchedule
+	if len(rs) == 0 {
+		return nil
+	}
+	maxRate := config.Config.MaxDownloadRate
+	return func(now time.Time) int64 {
+		return rs.RateAt(now, maxRate)
+	}
+}
+
+// RunDownload 执行下载网盘内文件, 有文件下载失败或无法开始下载时返回错误
+func RunDownload(paths []string, options *DownloadOptions) error {
 	if options == nil {
 		options = &DownloadOptions{}
 	}
 
-	if options.Load <= 0 {
-		options.Load = config.Config.MaxDownloadLoad
+	if options.ConcurrentFiles <= 0 {
+		options.ConcurrentFiles = config.Config.MaxDownloadLoad
+	}
+	if options.ConcurrentFiles <= 0 {
+		options.ConcurrentFiles = 1
 	}
 
 	if options.MaxRetry < 0 {
 		options.MaxRetry = pandownload.DefaultDownloadMaxRetry
 	}
+	if options.MaxChecksumRetry < 0 {
+		options.MaxChecksumRetry = pandownload.DefaultChecksumMaxRetry
+	}
 
 	if runtime.GOOS == "windows" {
 		// windows下不加执行权限
 		options.IsExecutedPermission = false
 	}
 
+	var pipeStdout io.Writer
+	if options.PipeCommand != "" {
+		// 标准输出只保留管道命令输出的数据, 进度等其它输出写入标准错误
+		pipeStdout = logfile.Stdout()
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		defer func() {
+			os.Stdout = stdout
+		}()
+
+		// 写入管道命令时先下载到临时目录, 校验后再写入命令
+		tmpDir, err := ioutil.TempDir("", "cloudpan189-pipe-")
+		if err != nil {
+			fmt.Printf("创建临时目录失败: %s\n", err)
+			return err
+		}
+		defer os.RemoveAll(tmpDir)
+		options.SaveTo = tmpDir
+		options.MirrorStructure = true
+		options.IsOverwrite = true
+	}
+
 	// 设置下载配置
 	cfg := &downloader.Config{
 		Mode:                       transfer.RangeGenMode_BlockSize,
 		CacheSize:                  config.Config.CacheSize,
 		BlockSize:                  MaxDownloadRangeSize,
 		MaxRate:                    config.Config.MaxDownloadRate,
+		RateSchedule:               downloadRateSchedule(),
 		InstanceStateStorageFormat: downloader.InstanceStateStorageFormatJSON,
-		ShowProgress: options.ShowProgress,
+		ShowProgress:               options.ShowProgress,
+		ProgressStyle:              downloadProgressStyle(),
+		Adaptive:                   options.Adaptive,
+		InterfaceChangeDetection:   options.InterfaceChangeDetection,
+		ChecksumAlgorithm:          strings.ToLower(options.ChecksumAlgorithm),
+		SpeedSamplingWindow:        options.SpeedSamplingWindow,
 	}
 	if cfg.CacheSize == 0 {
 		cfg.CacheSize = int(DownloadCacheSize)
 	}
 
-	// 设置下载最大并发量
+	if options.BandwidthTest {
+		// 所有文件共用一次测量结果
+		cfg.BandwidthTest = downloader.NewBandwidthTest()
+	}
+
+	// 设置每个文件的下载线程数
+	cfg.ParallelExplicit = options.Parallel > 0
 	if options.Parallel < 1 {
 		options.Parallel = config.Config.MaxDownloadParallel
 	}
@@ -221,85 +749,153 @@ func RunDownload(paths []string, options *DownloadOptions) {
 	paths, err := matchPathByShellPattern(options.FamilyId, paths...)
 	if err != nil {
 		fmt.Println(err)
-		return
+		return err
+	}
+	if options.SkipFirstBytes > 0 {
+		if err = checkSkipFirstBytesTarget(GetActivePanClient(), options.FamilyId, paths); err != nil {
+			fmt.Println(err)
+			return err
+		}
 	}
-
-	fmt.Print("\n")
-	fmt.Printf("[0] 提示: 当前下载最大并发量为: %d, 下载缓存为: %d\n", options.Parallel, cfg.CacheSize)
 
 	var (
 		panClient = GetActivePanClient()
 		loadCount = 0
+		planned   []*pandownload.PlannedDownload
 	)
 
-	// 预测要下载的文件数量
-	for k := range paths {
-		// 使用递归获取文件的方法计算路径包含的文件的总数量
-		panClient.AppFilesDirectoriesRecurseList(options.FamilyId, paths[k], func(depth int, _ string, fd *cloudpan.AppFileEntity, apiError *apierror.ApiError) bool {
-			if apiError != nil {
-				panCommandVerbose.Warnf("%s\n", apiError)
-				return true
-			}
+	if options.PrecomputePaths {
+		// 预先展开所有目录, 文件数量即为要下载的文件数量
+		planned = planDownloads(panClient, paths, options)
+		loadCount = len(planned)
+	} else {
+		// 预测要下载的文件数量
+		for k := range paths {
+			// 使用递归获取文件的方法计算路径包含的文件的总数量
+			panClient.AppFilesDirectoriesRecurseList(options.FamilyId, paths[k], func(depth int, _ string, fd *cloudpan.AppFileEntity, apiError *apierror.ApiError) bool {
+				if apiError != nil {
+					panCommandVerbose.Warnf("%s\n", apiError)
+					return true
+				}
 
-			// 忽略统计文件夹数量
-			if !fd.IsFolder {
-				loadCount++
-				if loadCount >= options.Load { // 文件的总数量超过指定的指定数量，则不再进行下层的递归查找文件
-					return false
+				// 忽略统计文件夹数量
+				if !fd.IsFolder {
+					loadCount++
+					if loadCount >= options.ConcurrentFiles { // 文件的总数量超过同时下载的文件数量，则不再进行下层的递归查找文件
+						return false
+					}
 				}
-			}
-			return true
-		})
+				return true
+			})
 
-		if loadCount >= options.Load {
-			break
+			if loadCount >= options.ConcurrentFiles {
+				break
+			}
 		}
 	}
 
-	// 修改Load, 设置MaxParallel
-	if loadCount > 0 {
-		options.Load = loadCount
-		// 取平均值
-		cfg.MaxParallel = config.AverageParallel(options.Parallel, loadCount)
-	} else {
-		cfg.MaxParallel = options.Parallel
+	// 要下载的文件比较少时, 只需要同时下载 loadCount 个文件
+	if loadCount > 0 && loadCount < options.ConcurrentFiles {
+		options.ConcurrentFiles = loadCount
 	}
+	// 下载线程总数超过上限时, 减少每个文件的下载线程数
+	cfg.MaxParallel = config.ClampParallel(options.Parallel, options.ConcurrentFiles, config.Config.MaxDownloadTotalParallel)
+
+	fmt.Print("\n")
+	if options.Parallel > cfg.MaxParallel {
+		fmt.Printf("[0] 提示: 下载线程总数超过上限 %d, 每个文件的下载线程数调整为: %d\n", config.Config.MaxDownloadTotalParallel, cfg.MaxParallel)
+	}
+	fmt.Printf("[0] 提示: 同时下载文件数量为: %d, 每个文件下载线程数为: %d, 下载缓存为: %d\n", options.ConcurrentFiles, cfg.MaxParallel, cfg.CacheSize)
+
+	var bandwidthHistory *pandownload.BandwidthHistory
+	if options.BandwidthHistoryPath != "" {
+		bandwidthHistory, err = pandownload.NewBandwidthHistory(options.BandwidthHistoryPath)
+		if err != nil {
+			fmt.Printf("创建下载速度记录文件失败: %s\n", err)
+			return err
+		}
+		defer bandwidthHistory.Close()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	var (
 		executor = taskframework.TaskExecutor{
 			IsFailedDeque: true, // 统计失败的列表
 		}
-		statistic = &pandownload.DownloadStatistic{}
+		statistic = &pandownload.DownloadStatistic{
+			LimitTotalSize: options.LimitTotalSize,
+		}
+		webhook      = newWebhook()
+		queueCounter = &pandownload.DownloadQueueCounter{
+			MaxQueue: config.Config.MaxDownloadQueue,
+			Offset:   options.Offset,
+			Limit:    options.Limit,
+		}
+		cloudStagingDirs = &pandownload.CloudStagingDirs{}
 	)
-	// 处理队列
-	for k := range paths {
+	newUnit := func(panPath string, familyId int64) *pandownload.DownloadTaskUnit {
 		newCfg := *cfg
-		unit := pandownload.DownloadTaskUnit{
-			Cfg:                  &newCfg, // 复制一份新的cfg
-			PanClient:            panClient,
-			VerbosePrinter:       panCommandVerbose,
-			PrintFormat:          downloadPrintFormat(options.Load),
-			ParentTaskExecutor:   &executor,
-			DownloadStatistic:    statistic,
-			IsPrintStatus:        options.IsPrintStatus,
-			IsExecutedPermission: options.IsExecutedPermission,
-			IsOverwrite:          options.IsOverwrite,
-			NoCheck:              options.NoCheck,
-			FilePanPath:          paths[k],
-			FamilyId:             options.FamilyId,
+		return &pandownload.DownloadTaskUnit{
+			Cfg:                     &newCfg, // 复制一份新的cfg
+			PanClient:               panClient,
+			VerbosePrinter:          panCommandVerbose,
+			PrintFormat:             downloadPrintFormat(options.ConcurrentFiles),
+			ParentTaskExecutor:      &executor,
+			DownloadStatistic:       statistic,
+			QueueCounter:            queueCounter,
+			IsPrintStatus:           options.IsPrintStatus,
+			IsListWorkers:           options.IsListWorkers,
+			MaxNameLength:           options.MaxNameLength,
+			IsPrintSpeedReport:      options.IsPrintSpeedReport,
+			BandwidthHistory:        bandwidthHistory,
+			Webhook:                 webhook,
+			IsPrintCompletionTime:   options.IsPrintCompletionTime,
+			IsExecutedPermission:    options.IsExecutedPermission,
+			IsOverwrite:             options.IsOverwrite,
+			NoCheck:                 options.NoCheck,
+			DecryptKey:              options.DecryptKey,
+			TaskTimeout:             options.TaskTimeout,
+			SkipFirstBytes:          options.SkipFirstBytes,
+			MaxChecksumRetry:        options.MaxChecksumRetry,
+			CloudMoveBeforeDownload: options.CloudMoveBeforeDownload,
+			CloudStagingDirs:        cloudStagingDirs,
+			FilterExtensions:        options.FilterExtensions,
+			ExcludeExtensions:       options.ExcludeExtensions,
+			PipeCommand:             options.PipeCommand,
+			PipeStdout:              pipeStdout,
+			Ctx:                     ctx,
+			FilePanPath:             panPath,
+			FamilyId:                familyId,
 		}
+	}
 
-		// 设置储存的路径
-		if options.SaveTo != "" {
-			unit.OriginSaveRootPath = options.SaveTo
-			unit.SavePath = filepath.Join(options.SaveTo, filepath.Base(paths[k]))
-		} else {
-			// 使用默认的保存路径
-			unit.OriginSaveRootPath = GetActiveUser().GetSavePath("")
-			unit.SavePath = GetActiveUser().GetSavePath(paths[k])
-		}
-		info := executor.Append(&unit, options.MaxRetry)
-		fmt.Printf("[%s] 加入下载队列: %s\n", info.Id(), paths[k])
+	executor.SetParallel(options.ConcurrentFiles)
+
+	// 收到 SIGINT 或 SIGTERM 时停止下载, 保存断点信息和下载队列后返回 ErrShutdown
+	var interrupted int32
+	done := make(chan struct{})
+	stopWatch := WatchShutdownSignal(func() {
+		atomic.StoreInt32(&interrupted, 1)
+		executor.Stop()
+		cancel()
+	}, done, DefaultShutdownTimeout)
+	defer func() {
+		close(done)
+		stopWatch()
+	}()
+
+	// 保存未完成的下载队列, 程序中断后以相同的参数再次下载时可以继续
+	queuePath := pandownload.DownloadQueueFilePath(downloadQueueKey(paths, options))
+	executor.PersistQueue(queuePath)
+	resumeDownloadQueue(&executor, newUnit, queuePath)
+
+	// 处理队列
+	if options.PrecomputePaths {
+		appendPlannedDownloads(&executor, newUnit, planned, queueCounter, statistic, options)
+	} else {
+		enqueueDownloads(&executor, newUnit, paths, options)
 	}
 
 	// 开始计时
@@ -307,12 +903,22 @@ func RunDownload(paths []string, options *DownloadOptions) {
 
 	// 开始执行
 	executor.Execute()
+	webhook.Wait()
+	cloudStagingDirs.RemoveEmpty(panClient)
 
 	fmt.Printf("\n下载结束, 时间: %s, 数据总量: %s\n", statistic.Elapsed()/1e6*1e6, converter.ConvertFileSize(statistic.TotalSize()))
+	if statistic.LimitReached() {
+		fmt.Printf("已达到下载数据总量上限 %s, 剩余的文件未下载\n", converter.ConvertFileSize(statistic.LimitTotalSize, 2))
+	}
+	if atomic.LoadInt32(&interrupted) != 0 {
+		fmt.Printf("下载已中断, 以相同的参数再次下载可以继续\n")
+		return ErrShutdown
+	}
 
 	// 输出失败的文件列表
 	failedList := executor.FailedDeque()
-	if failedList.Size() != 0 {
+	failedCount := failedList.Size()
+	if failedCount != 0 {
 		fmt.Printf("以下文件下载失败: \n")
 		tb := cmdtable.NewTable(os.Stdout)
 		for e := failedList.Shift(); e != nil; e = failedList.Shift() {
@@ -320,5 +926,7 @@ func RunDownload(paths []string, options *DownloadOptions) {
 			tb.Append([]string{item.Info.Id(), item.Unit.(*pandownload.DownloadTaskUnit).FilePanPath})
 		}
 		tb.Render()
+		return fmt.Errorf("%d 个文件下载失败", failedCount)
 	}
+	return nil
 }
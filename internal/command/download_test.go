@@ -0,0 +1,65 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/phpc0de/ctpango/internal/functions/pandownload"
+)
+
+func TestDownloadSavePathsSaveTo(t *testing.T) {
+	const panPath = "/photos/2024"
+	testCases := []struct {
+		name         string
+		mirror       bool
+		wantSavePath string
+		wantFilePath string // /photos/2024/jan/img.jpg 的保存路径
+	}{
+		{"flat", false, filepath.Join("/dl", "2024"), filepath.Join("/dl", "2024/jan/img.jpg")},
+		{"mirror", true, filepath.Join("/dl", "photos/2024"), filepath.Join("/dl", "photos/2024/jan/img.jpg")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			options := &DownloadOptions{SaveTo: "/dl", MirrorStructure: tc.mirror}
+			saveRootPath, savePath, panRootDir := downloadSavePaths(panPath, options)
+			if saveRootPath != "/dl" {
+				t.Errorf("saveRootPath = %s, want /dl", saveRootPath)
+			}
+			if savePath != tc.wantSavePath {
+				t.Errorf("savePath = %s, want %s", savePath, tc.wantSavePath)
+			}
+			if got := pandownload.SavePathOf(saveRootPath, panRootDir, "/photos/2024/jan/img.jpg"); got != tc.wantFilePath {
+				t.Errorf("file save path = %s, want %s", got, tc.wantFilePath)
+			}
+		})
+	}
+}
+
+func TestCheckSkipFirstBytesTarget(t *testing.T) {
+	client := newFakeDeleteClient()
+	if err := checkSkipFirstBytesTarget(client, 0, []string{"/a.txt"}); err != nil {
+		t.Fatalf("file: %s", err)
+	}
+	for _, paths := range [][]string{{"/dir"}, {"/a.txt", "/b.txt"}} {
+		if err := checkSkipFirstBytesTarget(client, 0, paths); !errors.Is(err, ErrSkipFirstBytesNotFile) {
+			t.Errorf("%v: err = %v, want ErrSkipFirstBytesNotFile", paths, err)
+		}
+	}
+	if err := checkSkipFirstBytesTarget(client, 0, []string{"/missing"}); err == nil {
+		t.Error("missing file should return error")
+	}
+}
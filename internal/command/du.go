@@ -0,0 +1,221 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctapi/cloudpan/apierror"
+	"github.com/phpc0de/ctlibgo/converter"
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/cmder/cmdtable"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/urfave/cli"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	// duEntry 目录的空间占用
+	duEntry struct {
+		Path      string `json:"path"`
+		Size      int64  `json:"size"`
+		FileCount int64  `json:"fileCount"`
+	}
+
+	// duStat 按目录累计文件大小
+	duStat struct {
+		root     string
+		maxDepth int
+		entries  map[string]*duEntry
+	}
+)
+
+func CmdDu() cli.Command {
+	return cli.Command{
+		Name:      "du",
+		Usage:     "统计目录的空间占用",
+		UsageText: cmder.App().Name + " du <目录>",
+		Description: `
+	统计目录内每个子目录的文件总大小和文件数量, 和 Unix du 命令类似, 按总大小从大到小排列.
+	不指定目录时统计当前工作目录.
+
+	示例:
+
+	统计 /我的资源 的空间占用
+	cloudpan189-go du /我的资源
+
+	只统计 /我的资源 的总大小, 和 du -s 类似
+	cloudpan189-go du -depth 0 /我的资源
+
+	统计 /我的资源 及其下一层子目录的空间占用
+	cloudpan189-go du -depth 1 /我的资源
+
+	以JSON格式输出统计结果
+	cloudpan189-go du -json /我的资源 > du.json
+`,
+		Category: "天翼云盘",
+		Before:   cmder.ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if config.Config.ActiveUser() == nil {
+				fmt.Println("未登录账号")
+				return nil
+			}
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			entries := RunDu(familyId, c.Args().Get(0), c.Int("depth"))
+			if entries == nil {
+				return nil
+			}
+			if c.Bool("json") {
+				data, err := json.MarshalIndent(entries, "", "  ")
+				if err != nil {
+					fmt.Println(err)
+					return nil
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+			printDuEntries(os.Stdout, entries)
+			return nil
+		},
+		Flags: append([]cli.Flag{
+			cli.IntFlag{
+				Name:  "depth",
+				Usage: "输出的最大目录深度, 和 du --max-depth 类似, 0为只输出总大小, 小于0为不限制",
+				Value: -1,
+			},
+			cli.BoolFlag{
+				Name:  "json",
+				Usage: "以JSON格式输出统计结果",
+			},
+		}, FamilyFlags...),
+	}
+}
+
+// RunDu 统计目录的空间占用, 结果按总大小从大到小排列, 出错时返回 nil
+func RunDu(familyId int64, cloudPath string, depth int) []*duEntry {
+	activeUser := GetActiveUser()
+	cloudPath = path.Clean(activeUser.PathJoin(familyId, cloudPath))
+	stat := newDuStat(cloudPath, depth)
+
+	var walkErr error
+	activeUser.PanClient().AppFilesDirectoriesRecurseList(familyId, cloudPath, func(depth int, fdPath string, fd *cloudpan.AppFileEntity, apiError *apierror.ApiError) bool {
+		if apiError != nil {
+			walkErr = apiError
+			return false
+		}
+		if fd.IsFolder {
+			stat.addDir(fdPath)
+		} else {
+			stat.addFile(fdPath, fd.FileSize)
+		}
+		return true
+	})
+	if walkErr != nil {
+		fmt.Printf("获取目录信息错误: %s\n", walkErr)
+		return nil
+	}
+	return stat.sortedEntries()
+}
+
+func newDuStat(root string, maxDepth int) *duStat {
+	root = path.Clean(root)
+	return &duStat{
+		root:     root,
+		maxDepth: maxDepth,
+		entries: map[string]*duEntry{
+			root: {Path: root},
+		},
+	}
+}
+
+// ancestors 返回 p 所在的各级目录 (包含 root, 不包含 p 本身), 超过最大深度的目录不返回
+func (s *duStat) ancestors(p string) []string {
+	rel := strings.TrimPrefix(strings.TrimPrefix(path.Clean(p), s.root), "/")
+	dirs := []string{s.root}
+	if rel == "" {
+		return dirs
+	}
+	names := strings.Split(rel, "/")
+	dir := s.root
+	for k, name := range names[:len(names)-1] {
+		if s.maxDepth >= 0 && k+1 > s.maxDepth {
+			break
+		}
+		dir = path.Join(dir, name)
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+func (s *duStat) entry(dir string) *duEntry {
+	e, ok := s.entries[dir]
+	if !ok {
+		e = &duEntry{Path: dir}
+		s.entries[dir] = e
+	}
+	return e
+}
+
+// addDir 记录目录, 使空目录也能输出
+func (s *duStat) addDir(p string) {
+	p = path.Clean(p)
+	dirs := s.ancestors(p)
+	// 目录本身的深度为其上级目录深度加一
+	if p != s.root && (s.maxDepth < 0 || len(dirs) <= s.maxDepth) {
+		s.entry(p)
+	}
+}
+
+// addFile 把文件大小累计到所在的各级目录
+func (s *duStat) addFile(p string, size int64) {
+	for _, dir := range s.ancestors(p) {
+		e := s.entry(dir)
+		e.Size += size
+		e.FileCount++
+	}
+}
+
+// sortedEntries 按总大小从大到小排列, 大小相同时按路径排列
+func (s *duStat) sortedEntries() []*duEntry {
+	entries := make([]*duEntry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Size != entries[j].Size {
+			return entries[i].Size > entries[j].Size
+		}
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
+
+func printDuEntries(w io.Writer, entries []*duEntry) {
+	tb := cmdtable.NewTable(w)
+	tb.SetHeader([]string{"路径", "总大小", "文件数"})
+	for _, e := range entries {
+		tb.Append([]string{e.Path, converter.ConvertFileSize(e.Size, 2), strconv.FormatInt(e.FileCount, 10)})
+	}
+	tb.Render()
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"testing"
+)
+
+// newDuTestStat 模拟的网盘目录:
+// /我的资源
+// ├── 1.mp4 (100)
+// ├── 文档/
+// │   ├── a.txt (10)
+// │   └── 草稿/
+// │       └── b.txt (1)
+// ├── 空目录/
+// └── 视频/
+//
+//	└── 2.mp4 (200)
+func newDuTestStat(maxDepth int) *duStat {
+	s := newDuStat("/我的资源", maxDepth)
+	s.addFile("/我的资源/1.mp4", 100)
+	s.addDir("/我的资源/文档")
+	s.addFile("/我的资源/文档/a.txt", 10)
+	s.addDir("/我的资源/文档/草稿")
+	s.addFile("/我的资源/文档/草稿/b.txt", 1)
+	s.addDir("/我的资源/空目录")
+	s.addDir("/我的资源/视频")
+	s.addFile("/我的资源/视频/2.mp4", 200)
+	return s
+}
+
+func checkDuEntries(t *testing.T, entries []*duEntry, expected []duEntry) {
+	t.Helper()
+	if len(entries) != len(expected) {
+		for _, e := range entries {
+			t.Logf("%+v", *e)
+		}
+		t.Fatalf("got %d entries, want %d", len(entries), len(expected))
+	}
+	for k, e := range entries {
+		if *e != expected[k] {
+			t.Fatalf("entry %d: got %+v, want %+v", k, *e, expected[k])
+		}
+	}
+}
+
+func TestDuStat(t *testing.T) {
+	checkDuEntries(t, newDuTestStat(-1).sortedEntries(), []duEntry{
+		{Path: "/我的资源", Size: 311, FileCount: 4},
+		{Path: "/我的资源/视频", Size: 200, FileCount: 1},
+		{Path: "/我的资源/文档", Size: 11, FileCount: 2},
+		{Path: "/我的资源/文档/草稿", Size: 1, FileCount: 1},
+		{Path: "/我的资源/空目录", Size: 0, FileCount: 0},
+	})
+}
+
+func TestDuStatMaxDepth(t *testing.T) {
+	checkDuEntries(t, newDuTestStat(0).sortedEntries(), []duEntry{
+		{Path: "/我的资源", Size: 311, FileCount: 4},
+	})
+	checkDuEntries(t, newDuTestStat(1).sortedEntries(), []duEntry{
+		{Path: "/我的资源", Size: 311, FileCount: 4},
+		{Path: "/我的资源/视频", Size: 200, FileCount: 1},
+		{Path: "/我的资源/文档", Size: 11, FileCount: 2},
+		{Path: "/我的资源/空目录", Size: 0, FileCount: 0},
+	})
+}
+
+func TestDuStatRootDir(t *testing.T) {
+	s := newDuStat("/", -1)
+	s.addDir("/a")
+	s.addFile("/a/1.txt", 5)
+	s.addFile("/2.txt", 7)
+	checkDuEntries(t, s.sortedEntries(), []duEntry{
+		{Path: "/", Size: 12, FileCount: 2},
+		{Path: "/a", Size: 5, FileCount: 1},
+	})
+}
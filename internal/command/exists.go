@@ -0,0 +1,172 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"github.com/phpc0de/ctapi/cloudpan/apierror"
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/urfave/cli"
+)
+
+type (
+	// existsState 路径的检查结果
+	existsState int
+)
+
+const (
+	// existsFound 路径存在
+	existsFound existsState = iota
+	// existsMissing 路径不存在
+	existsMissing
+	// existsError 查询出错, 无法确定是否存在
+	existsError
+)
+
+const (
+	// ExistsExitOK 检查通过
+	ExistsExitOK = 0
+	// ExistsExitMissing 检查不通过
+	ExistsExitMissing = 1
+	// ExistsExitError 查询出错, 无法确定结果
+	ExistsExitError = 2
+)
+
+func CmdExists() cli.Command {
+	return cli.Command{
+		Name:      "exists",
+		Usage:     "检查云盘路径是否存在",
+		UsageText: cmder.App().Name + " exists <路径1> <路径2> ...",
+		Description: `
+	检查一个或多个云盘路径是否存在, 逐个输出 EXISTS: <路径> 或 MISSING: <路径>, 并通过退出码返回检查结果, 便于在脚本中使用.
+	默认 (--all) 所有路径都存在时退出码为0, 否则为1; 使用 --any 时只要有一个路径存在退出码就为0.
+	查询出错 (例如网络错误) 导致无法确定结果时, 退出码为2.
+	交互命令行模式下只输出结果, 不会退出程序.
+
+	示例:
+
+	检查 /我的资源/1.mp4 是否存在
+	cloudpan189-go exists /我的资源/1.mp4
+
+	在脚本中检查多个文件是否都存在, 不输出任何内容
+	cloudpan189-go exists -q /我的资源/1.mp4 /我的资源/2.mp4 && echo "all exist"
+
+	检查多个文件是否至少有一个存在
+	cloudpan189-go exists --any /我的资源/1.mp4 /我的资源/2.mp4
+`,
+		Category: "天翼云盘",
+		Before:   cmder.ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if c.NArg() == 0 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			if config.Config.ActiveUser() == nil {
+				fmt.Println("未登录账号")
+				return nil
+			}
+			if c.Bool("all") && c.Bool("any") {
+				fmt.Println("--all 和 --any 不能同时使用")
+				return nil
+			}
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			code := RunExists(familyId, c.Args(), c.Bool("quiet"), c.Bool("any"))
+			if code == ExistsExitOK || cmder.IsInteractive() {
+				return nil
+			}
+			return cli.NewExitError("", code)
+		},
+		Flags: append([]cli.Flag{
+			cli.BoolFlag{
+				Name:  "quiet, q",
+				Usage: "不输出任何内容, 只通过退出码返回结果",
+			},
+			cli.BoolFlag{
+				Name:  "all",
+				Usage: "所有路径都存在时退出码为0 (默认)",
+			},
+			cli.BoolFlag{
+				Name:  "any",
+				Usage: "至少一个路径存在时退出码为0",
+			},
+		}, FamilyFlags...),
+	}
+}
+
+// RunExists 检查云盘路径是否存在, 返回退出码
+func RunExists(familyId int64, paths []string, quiet, matchAny bool) int {
+	activeUser := GetActiveUser()
+	states := make([]existsState, 0, len(paths))
+	for _, p := range paths {
+		fullPath := activeUser.PathJoin(familyId, p)
+		_, apierr := activeUser.PanClient().AppFileInfoByPath(familyId, fullPath)
+		state := existsFound
+		if apierr != nil {
+			if apierr.Code == apierror.ApiCodeFileNotFoundCode {
+				state = existsMissing
+			} else {
+				state = existsError
+			}
+		}
+		states = append(states, state)
+
+		if quiet {
+			continue
+		}
+		switch state {
+		case existsFound:
+			fmt.Printf("EXISTS: %s\n", fullPath)
+		case existsMissing:
+			fmt.Printf("MISSING: %s\n", fullPath)
+		default:
+			fmt.Printf("ERROR: %s, %s\n", fullPath, apierr)
+		}
+	}
+	return existsExitCode(states, matchAny)
+}
+
+// existsExitCode 根据各路径的检查结果计算退出码.
+// 查询出错的路径只有在影响最终结果时才返回 ExistsExitError
+func existsExitCode(states []existsState, matchAny bool) int {
+	var found, missing, failed int
+	for _, state := range states {
+		switch state {
+		case existsFound:
+			found++
+		case existsMissing:
+			missing++
+		default:
+			failed++
+		}
+	}
+	if matchAny {
+		if found > 0 {
+			return ExistsExitOK
+		}
+	} else if missing > 0 {
+		return ExistsExitMissing
+	}
+	if failed > 0 {
+		return ExistsExitError
+	}
+	if matchAny {
+		return ExistsExitMissing
+	}
+	return ExistsExitOK
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"testing"
+)
+
+func TestExistsExitCode(t *testing.T) {
+	testCases := []struct {
+		name     string
+		states   []existsState
+		matchAny bool
+		want     int
+	}{
+		{"all found", []existsState{existsFound, existsFound}, false, ExistsExitOK},
+		{"all one missing", []existsState{existsFound, existsMissing}, false, ExistsExitMissing},
+		{"all missing beats error", []existsState{existsError, existsMissing}, false, ExistsExitMissing},
+		{"all with error", []existsState{existsFound, existsError}, false, ExistsExitError},
+		{"any one found", []existsState{existsMissing, existsFound}, true, ExistsExitOK},
+		{"any found beats error", []existsState{existsError, existsFound}, true, ExistsExitOK},
+		{"any none found", []existsState{existsMissing, existsMissing}, true, ExistsExitMissing},
+		{"any with error", []existsState{existsMissing, existsError}, true, ExistsExitError},
+	}
+	for _, tc := range testCases {
+		if got := existsExitCode(tc.states, tc.matchAny); got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
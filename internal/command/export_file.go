@@ -67,20 +67,20 @@ func CmdExport() cli.Command {
 			}
 
 			subArgs := c.Args()
-			RunExportFiles(parseFamilyId(c), c.Bool("ow"), subArgs[:len(subArgs)-1], subArgs[len(subArgs)-1])
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			RunExportFiles(familyId, c.Bool("ow"), subArgs[:len(subArgs)-1], subArgs[len(subArgs)-1])
 			return nil
 		},
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			cli.BoolFlag{
 				Name:  "ow",
 				Usage: "overwrite, 覆盖已存在的导出文件",
 			},
-			cli.StringFlag{
-				Name:  "familyId",
-				Usage: "家庭云ID",
-				Value: "",
-			},
-		},
+		}, FamilyFlags...),
 	}
 }
 
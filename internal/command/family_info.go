@@ -0,0 +1,114 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/cmder/cmdtable"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/urfave/cli"
+	"os"
+	"strconv"
+)
+
+const (
+	// FamilyUserRoleAdmin 家庭云管理员(创建者)
+	FamilyUserRoleAdmin = 1
+)
+
+func CmdFamilyInfo() cli.Command {
+	return cli.Command{
+		Name:      "familyinfo",
+		Usage:     "显示家庭云的详细信息",
+		UsageText: cmder.App().Name + " familyinfo [familyId]",
+		Description: `
+	显示指定家庭云的详细信息, 包括家庭云名称, 成员数量, 当前帐号在该家庭云中的角色, 创建日期等.
+	如果没有提供 familyId, 则显示当前所在的家庭云.
+	家庭云ID可以通过 family 命令查看.
+
+	示例:
+	cloudpan189-go familyinfo
+	cloudpan189-go familyinfo <familyId>
+`,
+		Category: "天翼云盘账号",
+		Before:   cmder.ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if config.Config.ActiveUser() == nil {
+				fmt.Println("未登录账号")
+				return nil
+			}
+			familyId := config.Config.ActiveUser().ActiveFamilyId
+			if c.NArg() > 0 {
+				id, err := strconv.ParseInt(c.Args().Get(0), 10, 64)
+				if err != nil {
+					fmt.Printf("家庭云ID错误: %s\n", c.Args().Get(0))
+					return nil
+				}
+				familyId = id
+			}
+			if familyId <= 0 {
+				fmt.Println("当前为个人云, 请指定家庭云ID, 家庭云ID可以通过 family 命令查看")
+				return nil
+			}
+			RunFamilyInfo(familyId)
+			return nil
+		},
+	}
+}
+
+// RunFamilyInfo 显示家庭云的详细信息
+func RunFamilyInfo(familyId int64) {
+	familyResult, apierr := GetActivePanClient().AppFamilyGetFamilyList()
+	if apierr != nil {
+		fmt.Printf("获取家庭列表失败: %s\n", apierr)
+		return
+	}
+
+	var familyInfo *cloudpan.AppFamilyInfo
+	for _, info := range familyResult.FamilyInfoList {
+		if info.FamilyId == familyId {
+			familyInfo = info
+			break
+		}
+	}
+	if familyInfo == nil {
+		fmt.Printf("未找到家庭云: %d, 家庭云ID可以通过 family 命令查看\n", familyId)
+		return
+	}
+
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT})
+	tb.AppendBulk([][]string{
+		[]string{"家庭云ID", strconv.FormatInt(familyInfo.FamilyId, 10)},
+		[]string{"家庭云名", familyInfo.RemarkName},
+		[]string{"成员数量", strconv.Itoa(familyInfo.Count)},
+		[]string{"我的角色", familyUserRoleName(familyInfo.UserRole)},
+		[]string{"创建日期", familyInfo.CreateTime},
+		[]string{"类型", strconv.Itoa(familyInfo.Type)},
+		[]string{"使用状态", strconv.Itoa(familyInfo.UseFlag)},
+	})
+	tb.Render()
+	fmt.Println("注意: 天翼云盘接口暂不提供家庭云成员列表, 空间配额和共享文件数量")
+}
+
+// familyUserRoleName 返回家庭云角色的中文名称
+func familyUserRoleName(role int) string {
+	if role == FamilyUserRoleAdmin {
+		return "管理员"
+	}
+	return "成员"
+}
@@ -36,6 +36,9 @@ func CmdFamily() cli.Command {
 	示例:
 	cloudpan189-go family
 	cloudpan189-go family <familyId>
+
+	在其他命令中指定家庭云ID的同时切换云工作模式, 和上面的命令效果相同
+	cloudpan189-go ls --familyId <familyId> --remember-family
 `,
 		Category: "天翼云盘账号",
 		Before:   cmder.ReloadConfigFunc,
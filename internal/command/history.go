@@ -0,0 +1,163 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/phpc0de/ctlibgo/converter"
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/cmder/cmdtable"
+	"github.com/phpc0de/ctpango/internal/history"
+	"github.com/urfave/cli"
+)
+
+const (
+	// DefaultHistoryNum 默认显示的历史记录数量
+	DefaultHistoryNum = 50
+)
+
+func CmdHistory() cli.Command {
+	return cli.Command{
+		Name:      "history",
+		Usage:     "显示最近的下载和上传记录",
+		UsageText: cmder.App().Name + " history [-n <数量>] [--json] [--clear]",
+		Description: `
+	每个文件下载或上传结束(成功或最终失败)后, 记录时间, 操作, 网盘路径, 本地路径, 结果, 大小和耗时.
+	记录以每行一个 JSON 的格式保存在配置目录的 cloud189_history.jsonl 文件中,
+	可以通过 config set -history_file 修改保存的路径.
+
+	示例:
+
+	显示最近50条记录
+	cloudpan189-go history
+
+	显示最近10条记录
+	cloudpan189-go history -n 10
+
+	以JSON格式输出所有记录
+	cloudpan189-go history -n 0 --json
+
+	清空所有记录
+	cloudpan189-go history --clear
+`,
+		Category: "其他",
+		Before:   cmder.ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			store := history.DefaultStore()
+			if c.Bool("clear") {
+				if err := RunHistoryClear(store); err != nil {
+					fmt.Printf("清空历史记录错误: %s\n", err)
+					return nil
+				}
+				fmt.Println("已清空历史记录")
+				return nil
+			}
+			if err := RunHistory(os.Stdout, store, c.Int("n"), c.Bool("json")); err != nil {
+				fmt.Printf("读取历史记录错误: %s\n", err)
+			}
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.IntFlag{
+				Name:  "n",
+				Usage: "显示最近的记录数量, 0为显示所有记录",
+				Value: DefaultHistoryNum,
+			},
+			cli.BoolFlag{
+				Name:  "json",
+				Usage: "以JSON数组格式输出",
+			},
+			cli.BoolFlag{
+				Name:  "clear",
+				Usage: "清空所有历史记录",
+			},
+		},
+	}
+}
+
+// RunHistory 输出最近的 n 条历史记录, n 小于等于0时输出所有记录
+func RunHistory(w io.Writer, store *history.Store, n int, asJSON bool) error {
+	records, err := store.Last(n)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		if records == nil {
+			records = []*history.Record{}
+		}
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", data)
+		return nil
+	}
+
+	if len(records) == 0 {
+		fmt.Fprintln(w, "没有历史记录")
+		return nil
+	}
+
+	tb := cmdtable.NewTable(w)
+	tb.SetHeader([]string{"#", "时间", "操作", "结果", "大小", "耗时", "网盘路径", "本地路径"})
+	tb.SetColumnAlignment([]int{tablewriter.ALIGN_DEFAULT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT})
+	for k, r := range records {
+		tb.Append([]string{
+			strconv.Itoa(k),
+			r.Time.Local().Format("2006-01-02 15:04:05"),
+			historyOperationName(r.Operation),
+			historyResultName(r),
+			converter.ConvertFileSize(r.Size, 2),
+			(time.Duration(r.Duration*float64(time.Second)) / 1e6 * 1e6).String(),
+			r.CloudPath,
+			r.LocalPath,
+		})
+	}
+	tb.Render()
+	return nil
+}
+
+// RunHistoryClear 清空历史记录
+func RunHistoryClear(store *history.Store) error {
+	return store.Clear()
+}
+
+func historyOperationName(operation string) string {
+	switch operation {
+	case history.OperationDownload:
+		return "下载"
+	case history.OperationUpload:
+		return "上传"
+	}
+	return operation
+}
+
+// historyResultName 失败时附带失败的原因
+func historyResultName(r *history.Record) string {
+	if r.Result == history.ResultSuccess {
+		return "成功"
+	}
+	if r.Error != "" {
+		return "失败: " + r.Error
+	}
+	return "失败"
+}
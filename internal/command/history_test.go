@@ -0,0 +1,91 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phpc0de/ctpango/internal/history"
+)
+
+func TestRunHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := history.NewStore(filepath.Join(dir, "history.jsonl"))
+
+	buf := &bytes.Buffer{}
+	if err := RunHistory(buf, store, DefaultHistoryNum, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "没有历史记录") {
+		t.Errorf("empty: %s", buf.String())
+	}
+
+	store.Append(history.NewRecord(history.OperationDownload, "/我的资源/1.mp4", "/tmp/1.mp4", 1024, time.Second, nil))
+	store.Append(history.NewRecord(history.OperationUpload, "/备份/2.txt", "/tmp/2.txt", 10, time.Second, errors.New("网络错误")))
+
+	buf.Reset()
+	if err := RunHistory(buf, store, DefaultHistoryNum, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"下载", "上传", "成功", "失败: 网络错误", "/我的资源/1.mp4", "/tmp/2.txt"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("table output missing %q: %s", s, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := RunHistory(buf, store, 1, true); err != nil {
+		t.Fatal(err)
+	}
+	var records []*history.Record
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+		t.Fatalf("json output: %s, %s", err, buf.String())
+	}
+	if len(records) != 1 || records[0].CloudPath != "/备份/2.txt" {
+		t.Errorf("json records: %+v", records)
+	}
+}
+
+func TestRunHistoryClear(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := history.NewStore(filepath.Join(dir, "history.jsonl"))
+	store.Append(history.NewRecord(history.OperationDownload, "/1.mp4", "/tmp/1.mp4", 1, 0, nil))
+
+	if err := RunHistoryClear(store); err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := RunHistory(buf, store, 0, true); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("after clear: %s", buf.String())
+	}
+}
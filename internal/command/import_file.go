@@ -81,24 +81,24 @@ func CmdImport() cli.Command {
 			}
 
 			subArgs := c.Args()
-			RunImportFiles(parseFamilyId(c), c.Bool("ow"), saveTo, subArgs[0])
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			RunImportFiles(familyId, c.Bool("ow"), saveTo, subArgs[0])
 			return nil
 		},
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			cli.BoolFlag{
 				Name:  "ow",
 				Usage: "overwrite, 覆盖已存在的网盘文件",
 			},
-			cli.StringFlag{
-				Name:  "familyId",
-				Usage: "家庭云ID",
-				Value: "",
-			},
 			cli.StringFlag{
 				Name:  "saveto",
 				Usage: "将文件保存到指定的目录",
 			},
-		},
+		}, FamilyFlags...),
 	}
 }
 
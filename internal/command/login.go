@@ -18,8 +18,10 @@ import (
 	"github.com/phpc0de/ctapi/cloudpan"
 	"github.com/phpc0de/ctpango/cmder"
 	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/phpc0de/ctpango/internal/functions/panlogin"
 	_ "github.com/phpc0de/ctlibgo/requester"
 	"github.com/urfave/cli"
+	"time"
 )
 
 
@@ -31,9 +33,13 @@ func CmdLogin() cli.Command {
 	示例:
 		cloudpan189-go login
 		cloudpan189-go login -username=tickstep -password=123xxx
+		cloudpan189-go login -qrcode
 
 	常规登录:
 		按提示一步一步来即可.
+
+	扫码登录:
+		在终端中显示二维码, 使用天翼云盘App扫码并确认即可登录, 二维码默认在120秒后失效.
 `,
 		Category: "天翼云盘账号",
 		Before:   cmder.ReloadConfigFunc, // 每次进行登录动作的时候需要调用刷新配置
@@ -45,6 +51,13 @@ func CmdLogin() cli.Command {
 			passowrd := ""
 			if c.IsSet("COOKIE_LOGIN_USER") {
 				webToken.CookieLoginUser = c.String("COOKIE_LOGIN_USER")
+			} else if c.Bool("qrcode") {
+				var err error
+				username, webToken, appToken, err = RunLoginQR(time.Duration(c.Int("qrcode-timeout")) * time.Second)
+				if err != nil {
+					fmt.Println(err)
+					return err
+				}
 			} else if c.NArg() == 0 {
 				var err error
 				username, passowrd, webToken, appToken, err = RunLogin(c.String("username"), c.String("password"))
@@ -60,6 +73,9 @@ func CmdLogin() cli.Command {
 			// save username / password
 			cloudUser.LoginUserName = config.EncryptString(username)
 			cloudUser.LoginUserPassword = config.EncryptString(passowrd)
+			if c.Bool("store-credentials-keychain") {
+				config.Config.StoreCredentialsKeychain = true
+			}
 			config.Config.SetActiveUser(cloudUser)
 			fmt.Println("天翼帐号登录成功: ", cloudUser.Nickname)
 			return nil
@@ -74,6 +90,19 @@ func CmdLogin() cli.Command {
 				Name:  "password",
 				Usage: "登录天翼帐号的用户密码",
 			},
+			cli.BoolFlag{
+				Name:  "qrcode",
+				Usage: "使用天翼云盘App扫描二维码登录",
+			},
+			cli.BoolFlag{
+				Name:  "store-credentials-keychain",
+				Usage: "登录凭证保存到系统钥匙串, 配置文件中只保存引用键",
+			},
+			cli.IntFlag{
+				Name:  "qrcode-timeout",
+				Usage: "扫码登录时二维码的有效时间, 单位: 秒",
+				Value: int(panlogin.DefaultQRCodeTimeout / time.Second),
+			},
 			// 暂不支持
 			// cloudpan189-go login -COOKIE_LOGIN_USER=8B12CBBCE89CA8DFC3445985B63B511B5E7EC7...
 			//cli.StringFlag{
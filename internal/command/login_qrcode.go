@@ -0,0 +1,59 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"errors"
+	"fmt"
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctpango/internal/functions/panlogin"
+	"github.com/skip2/go-qrcode"
+	"time"
+)
+
+// RunLoginQR 扫码登录, 在终端中输出二维码, 等待扫码确认后返回登录凭证
+func RunLoginQR(timeout time.Duration) (loginName string, webToken cloudpan.WebLoginToken, appToken cloudpan.AppLoginToken, err error) {
+	if timeout <= 0 {
+		timeout = panlogin.DefaultQRCodeTimeout
+	}
+	client := panlogin.NewQRCodeLoginClient()
+	info, err := client.GetQRCode()
+	if err != nil {
+		return "", webToken, appToken, fmt.Errorf("获取登录二维码失败: %s", err)
+	}
+
+	qr, err := qrcode.New(info.UUID, qrcode.Medium)
+	if err != nil {
+		return "", webToken, appToken, err
+	}
+	fmt.Println(qr.ToSmallString(false))
+	fmt.Printf("请使用天翼云盘App扫描二维码登录, 二维码将在 %s 后失效\n", timeout)
+
+	redirectURL, err := panlogin.WaitQRCodeLogin(client, info, panlogin.DefaultQRCodePollInterval, timeout, func(state *panlogin.QRCodeState) {
+		fmt.Println(panlogin.QRCodeStateText(state.Status))
+	})
+	if err != nil {
+		return "", webToken, appToken, err
+	}
+
+	token, loginName, err := client.GetToken(redirectURL)
+	if err != nil {
+		return "", webToken, appToken, fmt.Errorf("获取登录凭证失败: %s", err)
+	}
+	webToken.CookieLoginUser = cloudpan.RefreshCookieToken(token.SessionKey)
+	if webToken.CookieLoginUser == "" {
+		return "", webToken, appToken, errors.New("获取登录凭证失败: 无法获取网页版 cookie")
+	}
+	return loginName, webToken, *token, nil
+}
@@ -14,6 +14,10 @@
 package command
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"github.com/olekukonko/tablewriter"
 	"github.com/phpc0de/ctapi/cloudpan"
@@ -23,16 +27,39 @@ import (
 	"github.com/phpc0de/ctlibgo/converter"
 	"github.com/phpc0de/ctlibgo/text"
 	"github.com/urfave/cli"
+	"github.com/phpc0de/ctapi/cloudpan/apierror"
+	"github.com/phpc0de/ctpango/internal/utils"
+	"io"
 	"os"
+	"path"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 type (
 	// LsOptions 列目录可选项
 	LsOptions struct {
-		Total bool
+		Total         bool
+		Recurse       bool           // 递归列出所有文件
+		MaxDepth      int            // 递归的最大深度, 小于等于0为不限制
+		OutputFormat  string         // 输出格式, table, json, ndjson 或 csv
+		ShowId        bool           // 显示 fileId 列
+		IdOnly        bool           // 只输出 fileId, 每行一个
+		PathRegexp    *regexp.Regexp // 不为空时, 只列出完整路径匹配该正则表达式的文件和目录
+		Page          int            // 分页显示时显示的页码, 从1开始
+		PageSize      int            // 每页显示的数量, 大于0时分页显示
+		Interactive   bool           // 分页显示时每显示一页等待用户按回车继续, 输入 q 退出
+		MaxNameLength int            // 表格中文件名的最大长度, 超过时截断, 小于等于0为不截断
 	}
 
+	// lsPageFetcher 获取第 page 页的文件列表, total 为文件总数
+	lsPageFetcher func(page int) (files cloudpan.AppFileList, total int, err error)
+
+	// lsDirLister 获取目录下的文件和目录
+	lsDirLister func(dir *cloudpan.AppFileEntity) (cloudpan.AppFileList, error)
+
 	// SearchOptions 搜索可选项
 	SearchOptions struct {
 		Total   bool
@@ -43,6 +70,25 @@ type (
 const (
 	opLs int = iota
 	opSearch
+	opLsRecurse
+)
+
+const (
+	// DefaultLsPageSize 分页显示时默认每页显示的数量
+	DefaultLsPageSize = 100
+	// DefaultMaxNameLength ls 表格和下载进度中文件名的默认最大长度
+	DefaultMaxNameLength = 40
+)
+
+const (
+	// OutputFormatTable 表格输出
+	OutputFormatTable = "table"
+	// OutputFormatJSON JSON数组输出
+	OutputFormatJSON = "json"
+	// OutputFormatNDJSON 每行一个JSON对象, 获取到文件后立即输出
+	OutputFormatNDJSON = "ndjson"
+	// OutputFormatCSV CSV输出
+	OutputFormatCSV = "csv"
 )
 
 func CmdLs() cli.Command {
@@ -67,10 +113,58 @@ func CmdLs() cli.Command {
 
 	按文件大小降序排序
 	cloudpan189-go ls -size -desc 我的资源
+
+	递归列出 /我的资源 内的所有文件和目录, 按路径排序, 可用于生成文件清单
+	cloudpan189-go ls -R /我的资源 > manifest.txt
+
+	递归列出 /我的资源 内的文件和目录, 最多列出两层
+	cloudpan189-go ls -R -max-depth 2 /我的资源
+
+	以JSON格式列出 /我的资源 内的文件和目录
+	cloudpan189-go ls -output-format json /我的资源
+
+	递归列出 /我的资源 内的文件和目录, 每行输出一个JSON对象, 获取到文件后立即输出, 可配合 jq 流式处理
+	cloudpan189-go ls -R --output-ndjson /我的资源 | jq 'select(.FileSize > 1000000)'
+
+	以CSV格式递归列出 /我的资源 内的所有文件和目录
+	cloudpan189-go ls -R -output-format csv /我的资源 > manifest.csv
+
+	列出 /我的资源 内的文件和目录, 并显示 fileId
+	cloudpan189-go ls -show-id /我的资源
+
+	只输出 /我的资源 内的文件和目录的 fileId, 每行一个
+	cloudpan189-go ls -id-only /我的资源
+
+	递归列出 /照片 内按 年/月 存放的所有 jpg 文件, 正则表达式匹配完整路径
+	cloudpan189-go ls -R -cloud-path-regex-filter '\d{4}/\d{2}/.*\.jpg$' /照片
+
+	分页列出 /我的资源 内的文件和目录, 每页10项, 显示第2页
+	cloudpan189-go ls -page 2 -page-size 10 /我的资源
+
+	逐页列出 /我的资源 内的文件和目录, 每显示一页按回车继续, 输入 q 退出
+	cloudpan189-go ls -i /我的资源
+
+	只输出 /我的资源 内以 电影 开头的文件和目录的路径, 每行一个, 目录以 / 结尾, 用于 shell 自动补全
+	cloudpan189-go ls -output-paths-only /我的资源/电影
+
+	列出 /我的资源 内的文件和目录, 不截断过长的文件名
+	cloudpan189-go ls -max-name-length 0 /我的资源
 `,
 		Category: "天翼云盘",
 		Before:   cmder.ReloadConfigFunc,
 		Action: func(c *cli.Context) error {
+			if c.Bool("output-paths-only") {
+				// 用于自动补全, 未登录时也不输出提示
+				if config.Config.ActiveUser() != nil {
+					familyId, err := parseFamilyId(c)
+					if err != nil {
+						fmt.Println(err)
+						return nil
+					}
+					RunLsPathsOnly(familyId, c.Args().Get(0))
+				}
+				return nil
+			}
 			if config.Config.ActiveUser() == nil {
 				fmt.Println("未登录账号")
 				return nil
@@ -100,13 +194,63 @@ func CmdLs() cli.Command {
 				orderBy = cloudpan.OrderByTime
 			}
 
-			RunLs(parseFamilyId(c), c.Args().Get(0), &LsOptions{
-				Total: c.Bool("l") || c.Parent().Args().Get(0) == "ll",
+			outputFormat := strings.ToLower(c.String("output-format"))
+			if c.Bool("output-ndjson") {
+				outputFormat = OutputFormatNDJSON
+			}
+			switch outputFormat {
+			case OutputFormatTable, OutputFormatJSON, OutputFormatNDJSON, OutputFormatCSV:
+			default:
+				fmt.Printf("不支持的输出格式: %s, 可选值: table, json, ndjson, csv\n", c.String("output-format"))
+				return nil
+			}
+
+			var pathRegexp *regexp.Regexp
+			if c.IsSet("cloud-path-regex-filter") {
+				var err error
+				pathRegexp, err = regexp.Compile(c.String("cloud-path-regex-filter"))
+				if err != nil {
+					fmt.Printf("路径正则表达式错误: %s\n", err)
+					return nil
+				}
+			}
+
+			page, pageSize := c.Int("page"), c.Int("page-size")
+			if page < 0 || pageSize < 0 {
+				fmt.Println("页码和每页数量不能小于0")
+				return nil
+			}
+			if page > 0 || pageSize > 0 || c.Bool("interactive") {
+				if page == 0 {
+					page = 1
+				}
+				if pageSize == 0 {
+					pageSize = DefaultLsPageSize
+				}
+			}
+
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			RunLs(familyId, c.Args().Get(0), &LsOptions{
+				Total:         c.Bool("l") || c.Parent().Args().Get(0) == "ll",
+				Recurse:       c.Bool("R"),
+				MaxDepth:      c.Int("max-depth"),
+				OutputFormat:  outputFormat,
+				ShowId:        c.Bool("show-id"),
+				IdOnly:        c.Bool("id-only"),
+				PathRegexp:    pathRegexp,
+				Page:          page,
+				PageSize:      pageSize,
+				Interactive:   c.Bool("interactive"),
+				MaxNameLength: c.Int("max-name-length"),
 			}, orderBy, orderSort)
 
 			return nil
 		},
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			cli.BoolFlag{
 				Name:  "l",
 				Usage: "详细显示",
@@ -131,20 +275,65 @@ func CmdLs() cli.Command {
 				Name:  "size",
 				Usage: "根据大小排序",
 			},
+			cli.BoolFlag{
+				Name:  "R",
+				Usage: "递归列出目录内的所有文件和目录, 按路径排序",
+			},
+			cli.IntFlag{
+				Name:  "max-depth",
+				Usage: "递归列出的最大深度, 需配合 -R 使用, 0为不限制",
+			},
+			cli.BoolFlag{
+				Name:  "show-id",
+				Usage: "显示 fileId 列",
+			},
+			cli.BoolFlag{
+				Name:  "id-only",
+				Usage: "只输出 fileId, 每行一个, 便于在脚本中使用",
+			},
+			cli.BoolFlag{
+				Name:  "output-paths-only",
+				Usage: "把参数作为路径前缀, 只输出以该前缀开头的文件和目录的路径, 每行一个, 目录以 / 结尾, 出错时不输出任何内容, 用于 shell 自动补全",
+			},
 			cli.StringFlag{
-				Name:  "familyId",
-				Usage: "家庭云ID",
-				Value: "",
+				Name:  "cloud-path-regex-filter",
+				Usage: "只列出完整路径匹配该正则表达式的文件和目录, 和按文件名匹配不同, 匹配的是完整路径",
 			},
-		},
+			cli.IntFlag{
+				Name:  "page",
+				Usage: "分页显示, 显示第几页, 从1开始",
+			},
+			cli.IntFlag{
+				Name:  "page-size",
+				Usage: fmt.Sprintf("分页显示, 每页显示的数量, 指定 page 或 interactive 时默认为 %d", DefaultLsPageSize),
+			},
+			cli.BoolFlag{
+				Name:  "interactive, i",
+				Usage: "逐页显示, 每显示一页按回车继续, 输入 q 退出",
+			},
+			cli.StringFlag{
+				Name:  "output-format",
+				Usage: "输出格式, 可选值: table, json, ndjson, csv",
+				Value: OutputFormatTable,
+			},
+			cli.BoolFlag{
+				Name:  "output-ndjson",
+				Usage: "每行输出一个JSON对象, 获取到文件后立即输出, 不等待列出所有文件, 同 -output-format ndjson",
+			},
+			cli.IntFlag{
+				Name:  "max-name-length",
+				Usage: "表格中文件名的最大长度, 超过时截断中间的部分, 以 ... 代替, 0为不截断",
+				Value: DefaultMaxNameLength,
+			},
+		}, FamilyFlags...),
 	}
 }
 
-func RunLs(familyId int64, targetPath string, lsOptions *LsOptions, orderBy cloudpan.OrderBy, orderSort cloudpan.OrderSort)  {
+func RunLs(familyId int64, targetPath string, lsOptions *LsOptions, orderBy cloudpan.OrderBy, orderSort cloudpan.OrderSort) {
 	activeUser := config.Config.ActiveUser()
 	targetPath = activeUser.PathJoin(familyId, targetPath)
-	if targetPath[len(targetPath) - 1] == '/' {
-		targetPath = text.Substr(targetPath, 0, len(targetPath) - 1)
+	if targetPath[len(targetPath)-1] == '/' {
+		targetPath = text.Substr(targetPath, 0, len(targetPath)-1)
 	}
 
 	targetPathInfo, err := activeUser.PanClient().AppFileInfoByPath(familyId, targetPath)
@@ -153,12 +342,44 @@ func RunLs(familyId int64, targetPath string, lsOptions *LsOptions, orderBy clou
 		return
 	}
 
+	// NDJSON 不分页时边获取边输出
+	streamNDJSON := lsOptions.OutputFormat == OutputFormatNDJSON && lsOptions.PageSize <= 0 && !lsOptions.IdOnly
+
+	if lsOptions.Recurse && targetPathInfo.IsFolder {
+		if streamNDJSON {
+			targetPathInfo.Path = targetPath
+			err := streamLsRecurse(appDirLister(familyId), targetPathInfo, 1, lsOptions.MaxDepth, lsOptions.PathRegexp, os.Stdout)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			return
+		}
+		runLsRecurse(familyId, targetPath, lsOptions)
+		return
+	}
+
 	fileList := cloudpan.AppFileList{}
 	fileListParam := cloudpan.NewAppFileListParam()
 	fileListParam.FileId = targetPathInfo.FileId
 	fileListParam.FamilyId = familyId
 	fileListParam.OrderBy = orderBy
 	fileListParam.OrderSort = orderSort
+	if targetPathInfo.IsFolder && streamNDJSON {
+		err := streamLsPages(appFileListPageFetcher(fileListParam, targetPath, DefaultLsPageSize), lsOptions.PathRegexp, os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return
+	}
+	if targetPathInfo.IsFolder && lsOptions.PageSize > 0 && lsOptions.PathRegexp == nil {
+		// 服务器端分页, 只获取需要显示的页
+		fetch := appFileListPageFetcher(fileListParam, targetPath, lsOptions.PageSize)
+		runLsPages(fetch, lsOptions, func(files cloudpan.AppFileList) {
+			printLsFileList(lsOptions, targetPath, files)
+		}, os.Stdin, os.Stderr)
+		return
+	}
+
 	if targetPathInfo.IsFolder {
 		fileResult, err := activeUser.PanClient().AppGetAllFileList(fileListParam)
 		if err != nil {
@@ -183,21 +404,387 @@ func RunLs(familyId int64, targetPath string, lsOptions *LsOptions, orderBy clou
 	} else {
 		fileList = append(fileList, targetPathInfo)
 	}
-	renderTable(opLs, lsOptions.Total, targetPath, fileList)
+
+	for _, file := range fileList {
+		if file.Path == "" {
+			if targetPathInfo.IsFolder {
+				file.Path = path.Join(targetPath, file.FileName)
+			} else {
+				file.Path = targetPath
+			}
+		}
+	}
+	fileList = filterFileListByPathRegexp(fileList, lsOptions.PathRegexp)
+
+	if lsOptions.PageSize > 0 {
+		runLsPages(slicePageFetcher(fileList, lsOptions.PageSize), lsOptions, func(files cloudpan.AppFileList) {
+			printLsFileList(lsOptions, targetPath, files)
+		}, os.Stdin, os.Stderr)
+		return
+	}
+	printLsFileList(lsOptions, targetPath, fileList)
 }
 
+// RunLsPathsOnly 输出以 prefix 开头的文件和目录的路径, 用于 shell 自动补全.
+// 输出的路径保持 prefix 的形式, 相对路径输出相对路径
+func RunLsPathsOnly(familyId int64, prefix string) {
+	for _, candidate := range lsPaths(familyId, prefix) {
+		fmt.Println(candidate)
+	}
+}
+
+// lsPaths 获取以 prefix 开头的文件和目录的路径, 出错时返回 nil
+func lsPaths(familyId int64, prefix string) []string {
+	activeUser := config.Config.ActiveUser()
+	if activeUser == nil {
+		return nil
+	}
+	dirPart, base := splitPathPrefix(prefix)
+	dirPath := activeUser.PathJoin(familyId, dirPart)
+	dirInfo, apierr := activeUser.PanClient().AppFileInfoByPath(familyId, dirPath)
+	if apierr != nil || !dirInfo.IsFolder {
+		return nil
+	}
 
-func renderTable(op int, isTotal bool, path string, files cloudpan.AppFileList) {
-	tb := cmdtable.NewTable(os.Stdout)
+	fileListParam := cloudpan.NewAppFileListParam()
+	fileListParam.FileId = dirInfo.FileId
+	fileListParam.FamilyId = familyId
+	fileListParam.OrderBy = cloudpan.OrderByName
+	fileListParam.OrderSort = cloudpan.OrderAsc
+	fileResult, apierr := activeUser.PanClient().AppGetAllFileList(fileListParam)
+	if apierr != nil {
+		return nil
+	}
+	return lsPathCandidates(dirPart, base, fileResult.FileList)
+}
+
+// splitPathPrefix 把路径前缀拆分为目录部分 (包含末尾的 /) 和文件名前缀
+func splitPathPrefix(prefix string) (dirPart, base string) {
+	i := strings.LastIndex(prefix, "/")
+	return prefix[:i+1], prefix[i+1:]
+}
+
+// lsPathCandidates 返回目录内文件名以 base 开头的文件和目录的路径, 目录以 / 结尾
+func lsPathCandidates(dirPart, base string, files cloudpan.AppFileList) []string {
+	candidates := make([]string, 0, len(files))
+	for _, file := range files {
+		if !strings.HasPrefix(file.FileName, base) {
+			continue
+		}
+		candidate := dirPart + file.FileName
+		if file.IsFolder {
+			candidate += "/"
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
+// appFileListPageFetcher 服务器端分页获取 fileListParam 指定目录的文件列表, 每页 pageSize 项
+func appFileListPageFetcher(fileListParam *cloudpan.AppFileListParam, targetPath string, pageSize int) lsPageFetcher {
+	return func(page int) (cloudpan.AppFileList, int, error) {
+		param := *fileListParam
+		param.PageNum = uint(page)
+		param.PageSize = uint(pageSize)
+		fileResult, apierr := config.Config.ActiveUser().PanClient().AppFileList(&param)
+		if apierr != nil {
+			return nil, 0, apierr
+		}
+		for _, file := range fileResult.FileList {
+			if file.Path == "" {
+				file.Path = path.Join(targetPath, file.FileName)
+			}
+		}
+		return fileResult.FileList, fileResult.Count, nil
+	}
+}
+
+// appDirLister 获取家庭云 familyId 中目录下的所有文件和目录, 个人云 familyId 为0
+func appDirLister(familyId int64) lsDirLister {
+	return func(dir *cloudpan.AppFileEntity) (cloudpan.AppFileList, error) {
+		param := cloudpan.NewAppFileListParam()
+		param.FileId = dir.FileId
+		param.FamilyId = familyId
+		param.OrderBy = cloudpan.OrderByName
+		param.OrderSort = cloudpan.OrderAsc
+		fileResult, apierr := config.Config.ActiveUser().PanClient().AppGetAllFileList(param)
+		if apierr != nil {
+			return nil, apierr
+		}
+		return fileResult.FileList, nil
+	}
+}
+
+// streamLsPages 逐页获取文件列表, 每获取一页立即以 NDJSON 格式输出到 w
+func streamLsPages(fetch lsPageFetcher, re *regexp.Regexp, w io.Writer) error {
+	fetched := 0
+	for page := 1; ; page++ {
+		files, total, err := fetch(page)
+		if err != nil {
+			return err
+		}
+		if err = writeNDJSON(w, filterFileListByPathRegexp(files, re)); err != nil {
+			return err
+		}
+		fetched += len(files)
+		if len(files) == 0 || fetched >= total {
+			return nil
+		}
+	}
+}
+
+// streamLsRecurse 递归列出 dir 内的文件和目录, 每获取一个目录的内容立即以 NDJSON 格式输出到 w.
+// 按获取的顺序输出, 目录在其内容之前输出, 不按路径排序. maxDepth 小于等于0为不限制深度
+func streamLsRecurse(list lsDirLister, dir *cloudpan.AppFileEntity, depth, maxDepth int, re *regexp.Regexp, w io.Writer) error {
+	files, err := list(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.Path == "" {
+			file.Path = path.Join(dir.Path, file.FileName)
+		}
+		if re == nil || re.MatchString(file.Path) {
+			if err = writeNDJSON(w, cloudpan.AppFileList{file}); err != nil {
+				return err
+			}
+		}
+		if file.IsFolder && (maxDepth <= 0 || depth < maxDepth) {
+			if err = streamLsRecurse(list, file, depth+1, maxDepth, re, w); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeNDJSON 每行输出一个文件的JSON对象
+func writeNDJSON(w io.Writer, files []*cloudpan.AppFileEntity) error {
+	enc := json.NewEncoder(w)
+	for _, file := range files {
+		if err := enc.Encode(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printLsFileList 按 lsOptions 指定的格式输出文件列表
+func printLsFileList(lsOptions *LsOptions, targetPath string, fileList cloudpan.AppFileList) {
+	if lsOptions.IdOnly {
+		printFileIds(fileList)
+		return
+	}
+
+	if lsOptions.OutputFormat == OutputFormatJSON || lsOptions.OutputFormat == OutputFormatNDJSON || lsOptions.OutputFormat == OutputFormatCSV {
+		fmt.Print(formatFileList(lsOptions.OutputFormat, fileList))
+		return
+	}
+	renderTable(opLs, lsOptions.Total, lsOptions.ShowId, lsOptions.MaxNameLength, targetPath, fileList)
+}
+
+// runLsRecurse 递归列出目录内的所有文件和目录, 按路径排序
+func runLsRecurse(familyId int64, targetPath string, lsOptions *LsOptions) {
+	activeUser := config.Config.ActiveUser()
+	var apiErr *apierror.ApiError
+	fileList := activeUser.PanClient().AppFilesDirectoriesRecurseList(familyId, targetPath, func(depth int, _ string, fd *cloudpan.AppFileEntity, apiError *apierror.ApiError) bool {
+		if apiError != nil {
+			apiErr = apiError
+			return false
+		}
+		return true
+	})
+	if fileList == nil {
+		if apiErr != nil {
+			fmt.Println(apiErr)
+		}
+		return
+	}
+
+	files := make(cloudpan.AppFileList, 0, len(fileList))
+	for _, file := range fileList {
+		if lsOptions.MaxDepth > 0 && lsRecurseDepth(targetPath, file.Path) > lsOptions.MaxDepth {
+			continue
+		}
+		files = append(files, file)
+	}
+	files = filterFileListByPathRegexp(files, lsOptions.PathRegexp)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	if lsOptions.PageSize > 0 {
+		runLsPages(slicePageFetcher(files, lsOptions.PageSize), lsOptions, func(files cloudpan.AppFileList) {
+			printLsRecurseFileList(lsOptions, targetPath, files)
+		}, os.Stdin, os.Stderr)
+		return
+	}
+	printLsRecurseFileList(lsOptions, targetPath, files)
+}
+
+// printLsRecurseFileList 按 lsOptions 指定的格式输出递归列出的文件列表
+func printLsRecurseFileList(lsOptions *LsOptions, targetPath string, files cloudpan.AppFileList) {
+	if lsOptions.IdOnly {
+		printFileIds(files)
+		return
+	}
+
+	if lsOptions.OutputFormat == OutputFormatJSON || lsOptions.OutputFormat == OutputFormatNDJSON || lsOptions.OutputFormat == OutputFormatCSV {
+		fmt.Print(formatFileList(lsOptions.OutputFormat, files))
+		return
+	}
+
+	if lsOptions.Total {
+		renderTable(opLsRecurse, true, true, lsOptions.MaxNameLength, targetPath, files)
+		return
+	}
+
+	// 平铺输出, 每行一个相对路径
+	for _, file := range files {
+		if lsOptions.ShowId {
+			fmt.Printf("%s\t%s\n", file.FileId, lsRecurseShowPath(targetPath, file))
+			continue
+		}
+		fmt.Println(lsRecurseShowPath(targetPath, file))
+	}
+}
+
+// slicePageFetcher 客户端分页, 从已获取的完整文件列表中截取每一页
+func slicePageFetcher(files cloudpan.AppFileList, pageSize int) lsPageFetcher {
+	return func(page int) (cloudpan.AppFileList, int, error) {
+		start := (page - 1) * pageSize
+		if start < 0 || start >= len(files) {
+			return cloudpan.AppFileList{}, len(files), nil
+		}
+		end := start + pageSize
+		if end > len(files) {
+			end = len(files)
+		}
+		return files[start:end], len(files), nil
+	}
+}
+
+// lsPageCount 总页数, 没有文件时为1
+func lsPageCount(total, pageSize int) int {
+	if total <= 0 {
+		return 1
+	}
+	return (total + pageSize - 1) / pageSize
+}
+
+// runLsPages 分页显示文件列表, 从 lsOptions.Page 页开始.
+// 交互模式下每显示一页从 in 读取一行, 输入 q 或读取结束时退出; 页码和提示信息输出到 msg, 不影响 JSON 和 CSV 输出
+func runLsPages(fetch lsPageFetcher, lsOptions *LsOptions, render func(files cloudpan.AppFileList), in io.Reader, msg io.Writer) {
+	reader := bufio.NewReader(in)
+	page := lsOptions.Page
+	for {
+		files, total, err := fetch(page)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		render(files)
+
+		pageCount := lsPageCount(total, lsOptions.PageSize)
+		fmt.Fprintf(msg, "第 %d/%d 页, 每页 %d 项, 共 %d 项\n", page, pageCount, lsOptions.PageSize, total)
+		if !lsOptions.Interactive || page >= pageCount {
+			return
+		}
+
+		fmt.Fprintf(msg, "按回车显示下一页, 输入 q 退出 > ")
+		line, err := reader.ReadString('\n')
+		if strings.EqualFold(strings.TrimSpace(line), "q") || (err != nil && line == "") {
+			return
+		}
+		page++
+	}
+}
+
+// filterFileListByPathRegexp 只保留完整路径匹配正则表达式的文件和目录, re 为 nil 时不过滤
+func filterFileListByPathRegexp(files cloudpan.AppFileList, re *regexp.Regexp) cloudpan.AppFileList {
+	if re == nil {
+		return files
+	}
+	filtered := make(cloudpan.AppFileList, 0, len(files))
+	for _, file := range files {
+		if re.MatchString(file.Path) {
+			filtered = append(filtered, file)
+		}
+	}
+	return filtered
+}
+
+// printFileIds 每行输出一个 fileId
+func printFileIds(files cloudpan.AppFileList) {
+	for _, file := range files {
+		fmt.Println(file.FileId)
+	}
+}
+
+// lsRecurseDepth 文件相对于目录的深度, 目录下的直接子文件深度为1
+func lsRecurseDepth(dirPath, filePath string) int {
+	relPath := strings.Trim(utils.TrimPathPrefix(filePath, dirPath), cloudpan.PathSeparator)
+	return strings.Count(relPath, cloudpan.PathSeparator) + 1
+}
+
+// lsRecurseShowPath 文件相对于目录的路径, 目录以路径分隔符结尾
+func lsRecurseShowPath(dirPath string, file *cloudpan.AppFileEntity) string {
+	relPath := strings.TrimPrefix(utils.TrimPathPrefix(file.Path, dirPath), cloudpan.PathSeparator)
+	if file.IsFolder {
+		relPath += cloudpan.PathSeparator
+	}
+	return relPath
+}
+
+// formatFileList 将文件列表格式化为指定的输出格式, 支持 table, json, ndjson 和 csv
+func formatFileList(format string, files []*cloudpan.AppFileEntity) string {
+	buf := &bytes.Buffer{}
+	switch format {
+	case OutputFormatJSON:
+		if files == nil {
+			files = []*cloudpan.AppFileEntity{}
+		}
+		data, err := json.MarshalIndent(files, "", "  ")
+		if err != nil {
+			return ""
+		}
+		buf.Write(data)
+		buf.WriteString("\n")
+	case OutputFormatNDJSON:
+		writeNDJSON(buf, files)
+	case OutputFormatCSV:
+		w := csv.NewWriter(buf)
+		w.Write([]string{"name", "size", "md5", "path", "last_modified"})
+		for _, file := range files {
+			w.Write([]string{file.FileName, strconv.FormatInt(file.FileSize, 10), file.FileMd5, file.Path, file.LastOpTime})
+		}
+		w.Flush()
+	default:
+		renderTableTo(buf, opLs, false, false, 0, "", files)
+	}
+	return buf.String()
+}
+
+func renderTable(op int, isTotal, showId bool, maxNameLength int, path string, files cloudpan.AppFileList) {
+	renderTableTo(os.Stdout, op, isTotal, showId, maxNameLength, path, files)
+}
+
+// renderTableTo 输出文件列表表格, showId 为 true 时简略表格也显示 fileId 列, 详细表格总是显示.
+// 文件(目录)列超过 maxNameLength 个字符时截断, 小于等于0为不截断
+func renderTableTo(w io.Writer, op int, isTotal, showId bool, maxNameLength int, path string, files cloudpan.AppFileList) {
+	tb := cmdtable.NewTable(w)
 	var (
 		fN, dN   int64
 		showPath string
 	)
+	showName := func(name string) string {
+		return utils.TruncateName(name, maxNameLength)
+	}
 
 	switch op {
 	case opLs:
 		showPath = "文件(目录)"
-	case opSearch:
+	case opSearch, opLsRecurse:
 		showPath = "路径"
 	}
 
@@ -206,33 +793,57 @@ func renderTable(op int, isTotal bool, path string, files cloudpan.AppFileList)
 		tb.SetColumnAlignment([]int{tablewriter.ALIGN_DEFAULT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT})
 		for k, file := range files {
 			if file.IsFolder {
-				tb.Append([]string{strconv.Itoa(k), file.FileId, "-", "-", "-", file.CreateTime, file.LastOpTime, file.FileName + cloudpan.PathSeparator})
+				if op == opLsRecurse {
+					tb.Append([]string{strconv.Itoa(k), file.FileId, "-", "-", "-", file.CreateTime, file.LastOpTime, showName(lsRecurseShowPath(path, file))})
+					continue
+				}
+				tb.Append([]string{strconv.Itoa(k), file.FileId, "-", "-", "-", file.CreateTime, file.LastOpTime, showName(file.FileName) + cloudpan.PathSeparator})
 				continue
 			}
 
 			switch op {
 			case opLs:
-				tb.Append([]string{strconv.Itoa(k), file.FileId, converter.ConvertFileSize(file.FileSize, 2), file.FileMd5, strconv.FormatInt(file.FileSize, 10), file.CreateTime, file.LastOpTime, file.FileName})
+				tb.Append([]string{strconv.Itoa(k), file.FileId, converter.ConvertFileSize(file.FileSize, 2), file.FileMd5, strconv.FormatInt(file.FileSize, 10), file.CreateTime, file.LastOpTime, showName(file.FileName)})
 			case opSearch:
-				tb.Append([]string{strconv.Itoa(k), file.FileId, converter.ConvertFileSize(file.FileSize, 2), file.FileMd5, strconv.FormatInt(file.FileSize, 10), file.CreateTime, file.LastOpTime, file.Path})
+				tb.Append([]string{strconv.Itoa(k), file.FileId, converter.ConvertFileSize(file.FileSize, 2), file.FileMd5, strconv.FormatInt(file.FileSize, 10), file.CreateTime, file.LastOpTime, showName(file.Path)})
+			case opLsRecurse:
+				tb.Append([]string{strconv.Itoa(k), file.FileId, converter.ConvertFileSize(file.FileSize, 2), file.FileMd5, strconv.FormatInt(file.FileSize, 10), file.CreateTime, file.LastOpTime, showName(lsRecurseShowPath(path, file))})
 			}
 		}
 		fN, dN = files.Count()
 		tb.Append([]string{"", "", "总: " + converter.ConvertFileSize(files.TotalSize(), 2), "", "", "", fmt.Sprintf("文件总数: %d, 目录总数: %d", fN, dN)})
+	} else if showId {
+		tb.SetHeader([]string{"#", "fileId", "文件大小", "修改日期", showPath})
+		tb.SetColumnAlignment([]int{tablewriter.ALIGN_DEFAULT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT})
+		for k, file := range files {
+			if file.IsFolder {
+				tb.Append([]string{strconv.Itoa(k), file.FileId, "-", file.LastOpTime, showName(file.FileName) + cloudpan.PathSeparator})
+				continue
+			}
+
+			switch op {
+			case opLs:
+				tb.Append([]string{strconv.Itoa(k), file.FileId, converter.ConvertFileSize(file.FileSize, 2), file.LastOpTime, showName(file.FileName)})
+			case opSearch:
+				tb.Append([]string{strconv.Itoa(k), file.FileId, converter.ConvertFileSize(file.FileSize, 2), file.LastOpTime, showName(file.Path)})
+			}
+		}
+		fN, dN = files.Count()
+		tb.Append([]string{"", "", "总: " + converter.ConvertFileSize(files.TotalSize(), 2), "", fmt.Sprintf("文件总数: %d, 目录总数: %d", fN, dN)})
 	} else {
 		tb.SetHeader([]string{"#", "文件大小", "修改日期", showPath})
 		tb.SetColumnAlignment([]int{tablewriter.ALIGN_DEFAULT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT})
 		for k, file := range files {
 			if file.IsFolder {
-				tb.Append([]string{strconv.Itoa(k), "-", file.LastOpTime, file.FileName + cloudpan.PathSeparator})
+				tb.Append([]string{strconv.Itoa(k), "-", file.LastOpTime, showName(file.FileName) + cloudpan.PathSeparator})
 				continue
 			}
 
 			switch op {
 			case opLs:
-				tb.Append([]string{strconv.Itoa(k), converter.ConvertFileSize(file.FileSize, 2), file.LastOpTime, file.FileName})
+				tb.Append([]string{strconv.Itoa(k), converter.ConvertFileSize(file.FileSize, 2), file.LastOpTime, showName(file.FileName)})
 			case opSearch:
-				tb.Append([]string{strconv.Itoa(k), converter.ConvertFileSize(file.FileSize, 2), file.LastOpTime, file.Path})
+				tb.Append([]string{strconv.Itoa(k), converter.ConvertFileSize(file.FileSize, 2), file.LastOpTime, showName(file.Path)})
 			}
 		}
 		fN, dN = files.Count()
@@ -242,8 +853,8 @@ func renderTable(op int, isTotal bool, path string, files cloudpan.AppFileList)
 	tb.Render()
 
 	if fN+dN >= 60 {
-		fmt.Printf("\n当前目录: %s\n", path)
+		fmt.Fprintf(w, "\n当前目录: %s\n", path)
 	}
 
-	fmt.Printf("----\n")
+	fmt.Fprintf(w, "----\n")
 }
@@ -0,0 +1,281 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/phpc0de/ctapi/cloudpan"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var formatTestFiles = []*cloudpan.AppFileEntity{
+	{
+		FileId:     "1001",
+		FileName:   "我的资源",
+		Path:       "/我的资源",
+		IsFolder:   true,
+		LastOpTime: "2021-01-01 10:00:00",
+	},
+	{
+		FileId:     "1002",
+		FileName:   "1,2.mp4",
+		FileSize:   1024,
+		FileMd5:    "0E5A2C0694784EAB88C0EFDD0CE2BF1A",
+		Path:       "/我的资源/1,2.mp4",
+		LastOpTime: "2021-01-02 10:00:00",
+	},
+}
+
+func TestFormatFileListJSON(t *testing.T) {
+	output := formatFileList(OutputFormatJSON, formatTestFiles)
+	files := []*cloudpan.AppFileEntity{}
+	if err := json.Unmarshal([]byte(output), &files); err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || *files[1] != *formatTestFiles[1] || !files[0].IsFolder {
+		t.Errorf("unexpected json output: %s", output)
+	}
+
+	if output = formatFileList(OutputFormatJSON, nil); strings.TrimSpace(output) != "[]" {
+		t.Errorf("expected empty json array, got: %s", output)
+	}
+}
+
+func TestFormatFileListNDJSON(t *testing.T) {
+	output := formatFileList(OutputFormatNDJSON, formatTestFiles)
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got: %s", output)
+	}
+	for i, line := range lines {
+		file := &cloudpan.AppFileEntity{}
+		if err := json.Unmarshal([]byte(line), file); err != nil {
+			t.Fatal(err)
+		}
+		if *file != *formatTestFiles[i] {
+			t.Errorf("line %d: unexpected ndjson output: %s", i, line)
+		}
+	}
+
+	if output = formatFileList(OutputFormatNDJSON, nil); output != "" {
+		t.Errorf("expected empty ndjson output, got: %s", output)
+	}
+}
+
+func TestStreamLsPages(t *testing.T) {
+	pages := []cloudpan.AppFileList{
+		{{FileId: "1", Path: "/a/1.mp4"}, {FileId: "2", Path: "/a/2.txt"}},
+		{{FileId: "3", Path: "/a/3.mp4"}},
+	}
+	fetched := []int{}
+	fetch := func(page int) (cloudpan.AppFileList, int, error) {
+		fetched = append(fetched, page)
+		return pages[page-1], 3, nil
+	}
+
+	buf := &bytes.Buffer{}
+	if err := streamLsPages(fetch, regexp.MustCompile(`\.mp4$`), buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched) != 2 {
+		t.Errorf("fetched pages = %v, want [1 2]", fetched)
+	}
+	ids := []string{}
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		file := &cloudpan.AppFileEntity{}
+		if err := dec.Decode(file); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, file.FileId)
+	}
+	if strings.Join(ids, ",") != "1,3" {
+		t.Errorf("file ids = %v, want [1 3]", ids)
+	}
+}
+
+func TestStreamLsRecurse(t *testing.T) {
+	tree := map[string]cloudpan.AppFileList{
+		"root": {{FileId: "d1", FileName: "sub", IsFolder: true}, {FileId: "f1", FileName: "1.mp4"}},
+		"d1":   {{FileId: "d2", FileName: "deep", IsFolder: true}, {FileId: "f2", FileName: "2.mp4"}},
+		"d2":   {{FileId: "f3", FileName: "3.mp4"}},
+	}
+	list := func(dir *cloudpan.AppFileEntity) (cloudpan.AppFileList, error) {
+		return tree[dir.FileId], nil
+	}
+	paths := func(output string) []string {
+		result := []string{}
+		for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+			file := &cloudpan.AppFileEntity{}
+			if err := json.Unmarshal([]byte(line), file); err != nil {
+				t.Fatal(err)
+			}
+			result = append(result, file.Path)
+		}
+		return result
+	}
+
+	buf := &bytes.Buffer{}
+	root := &cloudpan.AppFileEntity{FileId: "root", Path: "/a", IsFolder: true}
+	if err := streamLsRecurse(list, root, 1, 2, nil, buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "/a/sub /a/sub/deep /a/sub/2.mp4 /a/1.mp4"
+	if got := strings.Join(paths(buf.String()), " "); got != expected {
+		t.Errorf("paths = %s, want %s", got, expected)
+	}
+
+	buf.Reset()
+	if err := streamLsRecurse(list, root, 1, 0, regexp.MustCompile(`\.mp4$`), buf); err != nil {
+		t.Fatal(err)
+	}
+	expected = "/a/sub/deep/3.mp4 /a/sub/2.mp4 /a/1.mp4"
+	if got := strings.Join(paths(buf.String()), " "); got != expected {
+		t.Errorf("paths = %s, want %s", got, expected)
+	}
+}
+
+func TestFormatFileListCSV(t *testing.T) {
+	expected := "name,size,md5,path,last_modified\n" +
+		"我的资源,0,,/我的资源,2021-01-01 10:00:00\n" +
+		"\"1,2.mp4\",1024,0E5A2C0694784EAB88C0EFDD0CE2BF1A,\"/我的资源/1,2.mp4\",2021-01-02 10:00:00\n"
+	if output := formatFileList(OutputFormatCSV, formatTestFiles); output != expected {
+		t.Errorf("unexpected csv output: %s", output)
+	}
+}
+
+func TestFormatFileListTable(t *testing.T) {
+	output := formatFileList(OutputFormatTable, formatTestFiles)
+	for _, s := range []string{"我的资源/", "1,2.mp4", "1.00KB", "文件总数: 1, 目录总数: 1"} {
+		if !strings.Contains(output, s) {
+			t.Errorf("table output missing %q: %s", s, output)
+		}
+	}
+}
+
+func TestRenderTableShowId(t *testing.T) {
+	buf := &bytes.Buffer{}
+	renderTableTo(buf, opLs, false, true, 0, "/", formatTestFiles)
+	for _, s := range []string{"FILEID", "1001", "1002"} {
+		if !strings.Contains(strings.ToUpper(buf.String()), s) {
+			t.Errorf("table output missing %q: %s", s, buf.String())
+		}
+	}
+
+	buf.Reset()
+	renderTableTo(buf, opLs, false, false, 0, "/", formatTestFiles)
+	if strings.Contains(buf.String(), "1002") {
+		t.Errorf("unexpected fileId in table output: %s", buf.String())
+	}
+}
+
+func TestRenderTableMaxNameLength(t *testing.T) {
+	longName := strings.Repeat("很长的文件名", 10) + ".mp4"
+	files := cloudpan.AppFileList{
+		{FileId: "1", FileName: longName, Path: "/" + longName, FileSize: 1024},
+		{FileId: "2", FileName: strings.Repeat("目录", 30), Path: "/" + strings.Repeat("目录", 30), IsFolder: true},
+	}
+
+	buf := &bytes.Buffer{}
+	renderTableTo(buf, opLs, false, false, 10, "/", files)
+	out := buf.String()
+	if strings.Contains(out, longName) {
+		t.Errorf("long name not truncated: %s", out)
+	}
+	for _, s := range []string{"很长的文...mp4", "目录目录...录目录/"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("table output missing %q: %s", s, out)
+		}
+	}
+
+	buf.Reset()
+	renderTableTo(buf, opLs, false, false, 0, "/", files)
+	if !strings.Contains(buf.String(), longName) {
+		t.Errorf("name truncated with max length 0: %s", buf.String())
+	}
+}
+
+func TestFilterFileListByPathRegexp(t *testing.T) {
+	files := cloudpan.AppFileList{
+		{FileId: "1", Path: "/照片/2020/01/a.jpg"},
+		{FileId: "2", Path: "/照片/2020/01/b.png"},
+		{FileId: "3", Path: "/照片/2020/c.jpg"},
+		{FileId: "4", Path: "/照片/2021/12/旅行/d.jpg"},
+		{FileId: "5", Path: "/照片/2021/12", IsFolder: true},
+	}
+	if result := filterFileListByPathRegexp(files, nil); len(result) != len(files) {
+		t.Fatalf("nil regexp should not filter, got %d", len(result))
+	}
+
+	result := filterFileListByPathRegexp(files, regexp.MustCompile(`\d{4}/\d{2}/.*\.jpg`))
+	if len(result) != 2 || result[0].FileId != "1" || result[1].FileId != "4" {
+		t.Fatalf("unexpected result: %v", result)
+	}
+}
+
+// lsPageTestFiles 模拟包含25个文件的目录
+func lsPageTestFiles() cloudpan.AppFileList {
+	files := make(cloudpan.AppFileList, 0, 25)
+	for i := 0; i < 25; i++ {
+		name := fmt.Sprintf("%02d.txt", i)
+		files = append(files, &cloudpan.AppFileEntity{FileId: strconv.Itoa(i), FileName: name, Path: "/dir/" + name})
+	}
+	return files
+}
+
+func TestRunLsPages(t *testing.T) {
+	fetch := slicePageFetcher(lsPageTestFiles(), 10)
+	var pages []cloudpan.AppFileList
+	render := func(files cloudpan.AppFileList) {
+		pages = append(pages, files)
+	}
+
+	// --page 2 --page-size 10
+	msg := &bytes.Buffer{}
+	runLsPages(fetch, &LsOptions{Page: 2, PageSize: 10}, render, strings.NewReader(""), msg)
+	if len(pages) != 1 || len(pages[0]) != 10 || pages[0][0].FileId != "10" || pages[0][9].FileId != "19" {
+		t.Fatalf("page 2: %v", pages)
+	}
+	if msg.String() != "第 2/3 页, 每页 10 项, 共 25 项\n" {
+		t.Fatalf("msg: %s", msg)
+	}
+
+	// 最后一页只有5项, 超出范围的页为空
+	files, total, _ := fetch(3)
+	if len(files) != 5 || files[4].FileId != "24" || total != 25 {
+		t.Fatalf("page 3: %d, total: %d", len(files), total)
+	}
+	if files, _, _ = fetch(4); len(files) != 0 {
+		t.Fatalf("page 4: %d", len(files))
+	}
+
+	// 交互模式, 显示到最后一页后自动结束
+	pages = nil
+	runLsPages(fetch, &LsOptions{Page: 1, PageSize: 10, Interactive: true}, render, strings.NewReader("\n\n\n\n"), &bytes.Buffer{})
+	if len(pages) != 3 || pages[2][0].FileId != "20" {
+		t.Fatalf("interactive pages: %d", len(pages))
+	}
+
+	// 交互模式, 输入 q 退出
+	pages = nil
+	runLsPages(fetch, &LsOptions{Page: 1, PageSize: 10, Interactive: true}, render, strings.NewReader("Q\n"), &bytes.Buffer{})
+	if len(pages) != 1 {
+		t.Fatalf("interactive quit pages: %d", len(pages))
+	}
+}
@@ -14,6 +14,7 @@
 package command
 
 import (
+	"errors"
 	"fmt"
 	"github.com/phpc0de/ctapi/cloudpan"
 	"github.com/phpc0de/ctapi/cloudpan/apierror"
@@ -28,9 +29,24 @@ func CmdMkdir() cli.Command {
 	return cli.Command{
 		Name:      "mkdir",
 		Usage:     "创建目录",
-		UsageText: cmder.App().Name + " mkdir <目录>",
-		Category:  "天翼云盘",
-		Before:    cmder.ReloadConfigFunc,
+		UsageText: cmder.App().Name + " mkdir [-p] <目录>",
+		Description: `
+	默认父目录必须已经存在, 否则创建失败. 使用 -p 参数时自动创建所有不存在的父目录.
+	目录已存在时不会重复创建.
+
+	示例:
+
+	在当前目录创建 照片 目录
+	cloudpan189-go mkdir 照片
+
+	创建 /我的资源/2021/照片, 自动创建不存在的 /我的资源/2021
+	cloudpan189-go mkdir -p /我的资源/2021/照片
+
+	在家庭云创建目录
+	cloudpan189-go mkdir -familyId 12345 /我的资源
+`,
+		Category: "天翼云盘",
+		Before:   cmder.ReloadConfigFunc,
 		Action: func(c *cli.Context) error {
 			if c.NArg() == 0 {
 				cli.ShowCommandHelp(c, c.Command.Name)
@@ -40,46 +56,83 @@ func CmdMkdir() cli.Command {
 				fmt.Println("未登录账号")
 				return nil
 			}
-			RunMkdir(parseFamilyId(c), c.Args().Get(0))
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			RunMkdir(familyId, c.Args().Get(0), c.Bool("parents"))
 			return nil
 		},
-		Flags: []cli.Flag{
-			cli.StringFlag{
-				Name:  "familyId",
-				Usage: "家庭云ID",
-				Value: "",
+		Flags: append([]cli.Flag{
+			cli.BoolFlag{
+				Name:  "parents, p",
+				Usage: "自动创建不存在的父目录",
 			},
-		},
+		}, FamilyFlags...),
 	}
 }
 
-func RunMkdir(familyId int64, name string) {
-	activeUser := GetActiveUser()
-	fullpath := activeUser.PathJoin(familyId, name)
-	pathSlice := strings.Split(fullpath, "/")
-	rs := &cloudpan.AppMkdirResult{}
-	err := apierror.NewFailedApiError("")
+// mkdirClient 创建目录用到的网盘接口
+type mkdirClient interface {
+	AppFileInfoByPath(familyId int64, pathStr string) (*cloudpan.AppFileEntity, *apierror.ApiError)
+	AppMkdirRecursive(familyId int64, parentFileId string, fullPath string, index int, pathSlice []string) (*cloudpan.AppMkdirResult, *apierror.ApiError)
+}
 
-	var cWorkDir = activeUser.Workdir
-	var cFileId = activeUser.WorkdirFileEntity.FileId
-	if IsFamilyCloud(familyId) {
-		cWorkDir = activeUser.FamilyWorkdir
-		cFileId = activeUser.FamilyWorkdirFileEntity.FileId
-	}
-	if path.Dir(fullpath) == cWorkDir {
-		rs, err = activeUser.PanClient().AppMkdirRecursive(familyId, cFileId, path.Clean(path.Dir(fullpath)), len(pathSlice) - 1, pathSlice)
-	} else {
-		rs, err = activeUser.PanClient().AppMkdirRecursive(familyId,"", "", 0, pathSlice)
-	}
+var (
+	// ErrMkdirParentNotExist 父目录不存在
+	ErrMkdirParentNotExist = errors.New("父目录不存在, 使用 -p 参数自动创建")
+	// ErrMkdirParentNotDir 父路径不是目录
+	ErrMkdirParentNotDir = errors.New("父路径不是目录")
+)
 
+// RunMkdir 执行创建目录, parents 为 true 时自动创建不存在的父目录, 返回创建的目录的 file_id
+func RunMkdir(familyId int64, name string, parents bool) (string, error) {
+	activeUser := GetActiveUser()
+	fullpath := activeUser.PathJoin(familyId, name)
+	fileId, err := mkdirPath(activeUser.PanClient(), familyId, fullpath, parents)
 	if err != nil {
 		fmt.Println("创建文件夹失败：" + err.Error())
-		return
+		return "", err
+	}
+	fmt.Println("创建文件夹成功: ", fullpath)
+	return fileId, nil
+}
+
+// mkdirPath 创建目录 fullpath, 目录已存在时直接返回其 file_id
+func mkdirPath(client mkdirClient, familyId int64, fullpath string, parents bool) (string, error) {
+	fullpath = path.Clean("/" + fullpath)
+	if fullpath == "/" {
+		return "", fmt.Errorf("不能创建根目录")
 	}
+	pathSlice := strings.Split(fullpath, "/")
+	parentPath := path.Dir(fullpath)
 
-	if rs.FileId != "" {
-		fmt.Println("创建文件夹成功: ", fullpath)
+	var (
+		rs     *cloudpan.AppMkdirResult
+		apierr *apierror.ApiError
+	)
+	parent, apierr := client.AppFileInfoByPath(familyId, parentPath)
+	if apierr != nil {
+		if apierr.ErrCode() != apierror.ApiCodeFileNotFoundCode {
+			return "", apierr
+		}
+		if !parents {
+			return "", fmt.Errorf("%w: %s", ErrMkdirParentNotExist, parentPath)
+		}
+		// 从根目录开始逐级创建
+		rs, apierr = client.AppMkdirRecursive(familyId, "", "", 0, pathSlice)
 	} else {
-		fmt.Println("创建文件夹失败: ", fullpath)
+		if !parent.IsFolder {
+			return "", fmt.Errorf("%w: %s", ErrMkdirParentNotDir, parentPath)
+		}
+		rs, apierr = client.AppMkdirRecursive(familyId, parent.FileId, parentPath, len(pathSlice)-1, pathSlice)
 	}
-}
\ No newline at end of file
+	if apierr != nil {
+		return "", apierr
+	}
+	if rs == nil || rs.FileId == "" {
+		return "", fmt.Errorf("未返回目录ID: %s", fullpath)
+	}
+	return rs.FileId, nil
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"errors"
+	"path"
+	"testing"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctapi/cloudpan/apierror"
+)
+
+// fakeMkdirClient 模拟网盘, 只记录已存在的目录
+type fakeMkdirClient struct {
+	dirs      map[string]string // path -> file_id
+	mkdirArgs []string          // 每次调用 AppMkdirRecursive 传入的 parentFileId
+}
+
+func (f *fakeMkdirClient) AppFileInfoByPath(familyId int64, pathStr string) (*cloudpan.AppFileEntity, *apierror.ApiError) {
+	fileId, ok := f.dirs[pathStr]
+	if !ok {
+		return nil, apierror.NewApiError(apierror.ApiCodeFileNotFoundCode, "file not found")
+	}
+	return &cloudpan.AppFileEntity{FileId: fileId, IsFolder: true}, nil
+}
+
+func (f *fakeMkdirClient) AppMkdirRecursive(familyId int64, parentFileId string, fullPath string, index int, pathSlice []string) (*cloudpan.AppMkdirResult, *apierror.ApiError) {
+	f.mkdirArgs = append(f.mkdirArgs, parentFileId)
+	p := "/"
+	for _, name := range pathSlice {
+		p = path.Join(p, name)
+		if _, ok := f.dirs[p]; !ok {
+			f.dirs[p] = "id:" + p
+		}
+	}
+	return &cloudpan.AppMkdirResult{FileId: f.dirs[p]}, nil
+}
+
+func TestMkdirPathMissingParent(t *testing.T) {
+	client := &fakeMkdirClient{dirs: map[string]string{"/": "root"}}
+	_, err := mkdirPath(client, 0, "/a/b/c", false)
+	if !errors.Is(err, ErrMkdirParentNotExist) {
+		t.Fatalf("err = %v, want ErrMkdirParentNotExist", err)
+	}
+	if len(client.mkdirArgs) != 0 {
+		t.Errorf("AppMkdirRecursive called %d times without -p, want 0", len(client.mkdirArgs))
+	}
+	if _, ok := client.dirs["/a"]; ok {
+		t.Errorf("parent /a created without -p")
+	}
+}
+
+func TestMkdirPathMissingParentWithParents(t *testing.T) {
+	client := &fakeMkdirClient{dirs: map[string]string{"/": "root"}}
+	fileId, err := mkdirPath(client, 0, "/a/b/c", true)
+	if err != nil {
+		t.Fatalf("mkdirPath: %s", err)
+	}
+	if fileId != "id:/a/b/c" {
+		t.Errorf("fileId = %q, want %q", fileId, "id:/a/b/c")
+	}
+	for _, p := range []string{"/a", "/a/b", "/a/b/c"} {
+		if _, ok := client.dirs[p]; !ok {
+			t.Errorf("%s not created", p)
+		}
+	}
+	if len(client.mkdirArgs) != 1 || client.mkdirArgs[0] != "" {
+		t.Errorf("AppMkdirRecursive parentFileId = %q, want creation from root", client.mkdirArgs)
+	}
+}
+
+func TestMkdirPathExistingParent(t *testing.T) {
+	client := &fakeMkdirClient{dirs: map[string]string{"/": "root", "/a": "id:/a"}}
+	for _, parents := range []bool{false, true} {
+		fileId, err := mkdirPath(client, 0, "/a/b", parents)
+		if err != nil {
+			t.Fatalf("mkdirPath(parents=%t): %s", parents, err)
+		}
+		if fileId != "id:/a/b" {
+			t.Errorf("mkdirPath(parents=%t) = %q, want %q", parents, fileId, "id:/a/b")
+		}
+	}
+	for _, arg := range client.mkdirArgs {
+		if arg != "id:/a" {
+			t.Errorf("AppMkdirRecursive parentFileId = %q, want the parent id", arg)
+		}
+	}
+}
+
+func TestMkdirPathParentNotDir(t *testing.T) {
+	client := &fakeFileParentClient{}
+	if _, err := mkdirPath(client, 0, "/a.txt/b", true); !errors.Is(err, ErrMkdirParentNotDir) {
+		t.Errorf("err = %v, want ErrMkdirParentNotDir", err)
+	}
+}
+
+// fakeFileParentClient 父路径总是一个文件
+type fakeFileParentClient struct {
+	fakeMkdirClient
+}
+
+func (f *fakeFileParentClient) AppFileInfoByPath(familyId int64, pathStr string) (*cloudpan.AppFileEntity, *apierror.ApiError) {
+	return &cloudpan.AppFileEntity{FileId: "file", IsFolder: false}, nil
+}
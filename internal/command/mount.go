@@ -0,0 +1,82 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/urfave/cli"
+	"time"
+)
+
+// DefaultMountCacheTTL 默认目录列表的缓存时间, 单位: 秒
+const DefaultMountCacheTTL = 30
+
+func CmdMount() cli.Command {
+	return cli.Command{
+		Name:      "mount",
+		Usage:     "以只读的 FUSE 文件系统挂载云盘目录 (Linux)",
+		UsageText: cmder.App().Name + " mount --mountpoint <本地挂载点> <云盘目录>",
+		Description: `
+	以 FUSE 文件系统的方式把云盘目录挂载到本地目录, 不指定云盘目录时挂载当前工作目录.
+	挂载后可以使用 ls, cp, 播放器等任意程序直接读取云盘中的文件, 文件数据在读取时才从云盘下载.
+	按 Ctrl+C 卸载, 也可以使用 fusermount -u <本地挂载点> 卸载.
+
+	注意:
+	1. 目前为只读挂载, 不支持创建, 修改, 删除和重命名文件, 这些操作会返回 "Read-only file system" 错误.
+	2. 需要系统支持 FUSE, Linux 需要安装 fuse (fusermount 命令). macOS, FreeBSD 和 Windows 暂不支持.
+	3. 目录列表默认缓存30秒, 期间云盘中的变化不会显示, 可以使用 --cache-ttl 调整.
+	4. 随机读取时每次都需要重新建立连接, 适合顺序读取的场景.
+
+	示例:
+
+	把云盘的 /我的资源 挂载到本地的 /mnt/cloud189
+	cloudpan189-go mount --mountpoint /mnt/cloud189 /我的资源
+
+	挂载家庭云, 目录列表缓存5分钟
+	cloudpan189-go mount --familyId 12345 --cache-ttl 300 --mountpoint /mnt/family /
+`,
+		Category: "天翼云盘",
+		Before:   cmder.ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if c.String("mountpoint") == "" {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			if config.Config.ActiveUser() == nil {
+				fmt.Println("未登录账号")
+				return nil
+			}
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			RunMount(familyId, c.Args().Get(0), c.String("mountpoint"), time.Duration(c.Int("cache-ttl"))*time.Second)
+			return nil
+		},
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "mountpoint",
+				Usage: "本地挂载点, 必须是已存在的空目录",
+			},
+			cli.IntFlag{
+				Name:  "cache-ttl",
+				Usage: "目录列表的缓存时间, 单位: 秒, 0为不缓存",
+				Value: DefaultMountCacheTTL,
+			},
+		}, FamilyFlags...),
+	}
+}
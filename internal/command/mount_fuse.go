@@ -0,0 +1,83 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package command
+
+import (
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"fmt"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/phpc0de/ctpango/internal/functions/panfuse"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+)
+
+// RunMount 挂载云盘目录到本地挂载点, 直到卸载或收到中断信号
+func RunMount(familyId int64, cloudPath, mountpoint string, cacheTTL time.Duration) {
+	activeUser := GetActiveUser()
+	cloudPath = path.Clean(activeUser.PathJoin(familyId, cloudPath))
+	root, apierr := activeUser.PanClient().AppFileInfoByPath(familyId, cloudPath)
+	if apierr != nil {
+		fmt.Printf("获取云盘目录信息错误: %s\n", apierr)
+		return
+	}
+	if !root.IsFolder {
+		fmt.Printf("云盘路径不是目录: %s\n", cloudPath)
+		return
+	}
+	root.Path = cloudPath
+
+	conn, err := fuse.Mount(mountpoint,
+		fuse.FSName("cloudpan189"),
+		fuse.Subtype("cloudpan189-go"),
+		fuse.ReadOnly(),
+	)
+	if err != nil {
+		fmt.Printf("挂载失败: %s, 请确认挂载点为已存在的空目录, 并且系统已安装 fuse\n", err)
+		return
+	}
+	defer conn.Close()
+
+	// 收到中断信号时卸载, 卸载后 Serve 返回
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	go func() {
+		if _, ok := <-sigCh; !ok {
+			return
+		}
+		if err := fuse.Unmount(mountpoint); err != nil {
+			fmt.Printf("卸载失败: %s, 请使用 fusermount -u %s 卸载\n", err, mountpoint)
+		}
+	}()
+
+	fmt.Printf("已挂载 %s 到 %s (只读), 按 Ctrl+C 卸载\n", cloudPath, mountpoint)
+	backend := &panfuse.PanBackend{
+		PanClient: activeUser.PanClient(),
+		FamilyId:  familyId,
+		Client:    config.Config.HTTPClient(""),
+	}
+	if err = fs.Serve(conn, panfuse.NewFS(backend, root, cacheTTL)); err != nil {
+		fmt.Printf("挂载出错: %s\n", err)
+		return
+	}
+	fmt.Printf("已卸载: %s\n", mountpoint)
+}
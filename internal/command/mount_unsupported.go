@@ -0,0 +1,29 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package command
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// RunMount 当前系统不支持 FUSE 挂载
+func RunMount(familyId int64, cloudPath, mountpoint string, cacheTTL time.Duration) {
+	fmt.Printf("当前系统 (%s) 暂不支持挂载, 目前只支持 Linux\n", runtime.GOOS)
+}
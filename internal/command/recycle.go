@@ -19,10 +19,13 @@ import (
 	"github.com/phpc0de/ctapi/cloudpan"
 	"github.com/phpc0de/ctpango/cmder"
 	"github.com/phpc0de/ctpango/cmder/cmdtable"
+	"github.com/phpc0de/ctpango/internal/apistat"
 	"github.com/phpc0de/ctlibgo/converter"
 	"github.com/urfave/cli"
 	"os"
+	"path"
 	"strconv"
+	"strings"
 )
 
 func CmdRecycle() cli.Command {
@@ -42,6 +45,9 @@ func CmdRecycle() cli.Command {
 
 	3. 清空回收站, 程序不会进行二次确认, 谨慎操作!!!
 	cloudpan189-go recycle delete -all
+
+	4. 还原回收站中原路径位于 /我的资源/照片 下的所有文件和目录, 还原前会列出文件并确认
+	cloudpan189-go recycle restore -path-prefix /我的资源/照片
 `,
 		Category: "天翼云盘",
 		Before:   cmder.ReloadConfigFunc,
@@ -70,12 +76,17 @@ func CmdRecycle() cli.Command {
 				},
 			},
 			{
-				Name:        "restore",
-				Aliases:     []string{"r"},
-				Usage:       "还原回收站文件或目录",
-				UsageText:   cmder.App().Name + " recycle restore <file_id 1> <file_id 2> <file_id 3> ...",
-				Description: `根据文件/目录的 fs_id, 还原回收站指定的文件或目录`,
+				Name:      "restore",
+				Aliases:   []string{"r"},
+				Usage:     "还原回收站文件或目录",
+				UsageText: cmder.App().Name + " recycle restore [-path-prefix <路径前缀>] <file_id 1> <file_id 2> <file_id 3> ...",
+				Description: `根据文件/目录的 fs_id, 还原回收站指定的文件或目录.
+	使用 -path-prefix 时, 还原原路径位于该路径下 (或等于该路径) 的所有文件和目录, 适用于误删了整个目录的情况`,
 				Action: func(c *cli.Context) error {
+					if c.IsSet("path-prefix") {
+						RunRecycleRestoreByPathPrefix(c.String("path-prefix"), c.Bool("y"))
+						return nil
+					}
 					if c.NArg() <= 0 {
 						cli.ShowCommandHelp(c, c.Command.Name)
 						return nil
@@ -83,6 +94,16 @@ func CmdRecycle() cli.Command {
 					RunRecycleRestore(c.Args()...)
 					return nil
 				},
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "path-prefix",
+						Usage: "还原原路径位于该路径下的所有文件和目录",
+					},
+					cli.BoolFlag{
+						Name:  "y",
+						Usage: "使用 -path-prefix 时不进行二次确认",
+					},
+				},
 			},
 			{
 				Name:        "delete",
@@ -189,6 +210,87 @@ func RunRecycleRestore(fidStrList ...string) {
 	}
 }
 
+// RunRecycleRestoreByPathPrefix 还原原路径位于 pathPrefix 下的所有文件和目录, 还原前列出文件并确认
+func RunRecycleRestoreByPathPrefix(pathPrefix string, noConfirm bool) {
+	pathPrefix = path.Clean("/" + pathPrefix)
+	panClient := GetActivePanClient()
+	allFiles, err := recycleListAll(panClient)
+	if err != nil {
+		fmt.Printf("获取回收站文件列表失败: %s\n", err)
+		return
+	}
+
+	restoreFileList := filterRecycleByPathPrefix(allFiles, pathPrefix)
+	if len(restoreFileList) == 0 {
+		fmt.Printf("回收站中没有原路径位于 %s 下的文件\n", pathPrefix)
+		return
+	}
+
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"#", "file_id", "原路径", "文件大小", "删除日期"})
+	for k, file := range restoreFileList {
+		sizeStr := "-"
+		if !file.IsFolder {
+			sizeStr = converter.ConvertFileSize(file.FileSize, 2)
+		}
+		tb.Append([]string{strconv.Itoa(k), file.FileId, recycleOriginalPath(file), sizeStr, file.LastOpTime})
+	}
+	tb.Render()
+
+	if !noConfirm {
+		var confirm string
+		fmt.Printf("确认还原以上 %d 个文件/目录? (y/n) > ", len(restoreFileList))
+		_, err := fmt.Scanln(&confirm)
+		if err != nil || (confirm != "y" && confirm != "Y") {
+			fmt.Println("已取消还原")
+			return
+		}
+	}
+
+	taskId, apierr := panClient.RecycleRestore(restoreFileList)
+	if apierr != nil {
+		fmt.Printf("还原文件失败：%s\n", apierr)
+		return
+	}
+	if taskId != "" {
+		fmt.Printf("还原成功, 共 %d 个文件/目录\n", len(restoreFileList))
+	}
+}
+
+// recycleListAll 获取回收站的所有文件
+func recycleListAll(panClient *apistat.PanClient) (cloudpan.RecycleFileInfoList, error) {
+	allFiles := cloudpan.RecycleFileInfoList{}
+	for pageNum := 1; ; pageNum++ {
+		fdl, err := panClient.RecycleList(pageNum, 0)
+		if err != nil {
+			return nil, err
+		}
+		allFiles = append(allFiles, fdl.Data...)
+		if len(fdl.Data) == 0 || uint(len(allFiles)) >= fdl.RecordCount {
+			return allFiles, nil
+		}
+	}
+}
+
+// recycleOriginalPath 回收站文件删除前的路径
+func recycleOriginalPath(file *cloudpan.RecycleFileInfo) string {
+	return path.Join("/", file.PathStr, file.FileName)
+}
+
+// filterRecycleByPathPrefix 筛选原路径等于 pathPrefix 或位于 pathPrefix 目录下的文件,
+// 按路径的层级匹配, /a/b 不会匹配 /a/bc
+func filterRecycleByPathPrefix(files cloudpan.RecycleFileInfoList, pathPrefix string) []*cloudpan.RecycleFileInfo {
+	pathPrefix = path.Clean("/" + pathPrefix)
+	result := []*cloudpan.RecycleFileInfo{}
+	for _, file := range files {
+		p := recycleOriginalPath(file)
+		if pathPrefix == "/" || p == pathPrefix || strings.HasPrefix(p, pathPrefix+"/") {
+			result = append(result, file)
+		}
+	}
+	return result
+}
+
 func isFileIdInTheRestoreList(fileId string, fidStrList ...string) bool {
 	for _, id := range fidStrList {
 		if id == fileId {
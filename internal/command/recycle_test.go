@@ -0,0 +1,53 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"github.com/phpc0de/ctapi/cloudpan"
+	"testing"
+)
+
+func TestFilterRecycleByPathPrefix(t *testing.T) {
+	files := cloudpan.RecycleFileInfoList{
+		{FileId: "1", PathStr: "/我的资源", FileName: "照片", IsFolder: true},
+		{FileId: "2", PathStr: "/我的资源/照片2020", FileName: "a.jpg"},
+		{FileId: "3", PathStr: "/我的资源/照片/旅行", FileName: "b.jpg"},
+		{FileId: "4", PathStr: "/", FileName: "c.txt"},
+		{FileId: "5", PathStr: "", FileName: "d.txt"},
+	}
+
+	cases := map[string][]string{
+		"/我的资源/照片": {"1", "3"},
+		"我的资源/照片/": {"1", "3"},
+		"/我的资源":    {"1", "2", "3"},
+		"/c.txt":   {"4"},
+		"/":        {"1", "2", "3", "4", "5"},
+		"/我的资源/视频": {},
+	}
+	for prefix, expect := range cases {
+		result := filterRecycleByPathPrefix(files, prefix)
+		if len(result) != len(expect) {
+			t.Fatalf("%s: got %d files, want %v", prefix, len(result), expect)
+		}
+		for k, file := range result {
+			if file.FileId != expect[k] {
+				t.Fatalf("%s: got %s, want %v", prefix, file.FileId, expect)
+			}
+		}
+	}
+
+	if p := recycleOriginalPath(files[4]); p != "/d.txt" {
+		t.Fatalf("original path: %s", p)
+	}
+}
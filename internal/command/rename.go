@@ -52,16 +52,15 @@ func CmdRename() cli.Command {
 				fmt.Println("未登录账号")
 				return nil
 			}
-			RunRename(parseFamilyId(c), c.Args().Get(0), c.Args().Get(1))
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			RunRename(familyId, c.Args().Get(0), c.Args().Get(1))
 			return nil
 		},
-		Flags: []cli.Flag{
-			cli.StringFlag{
-				Name:  "familyId",
-				Usage: "家庭云ID",
-				Value: "",
-			},
-		},
+		Flags: FamilyFlags,
 	}
 }
 
@@ -14,38 +14,73 @@
 package command
 
 import (
+	"errors"
 	"fmt"
-	"github.com/phpc0de/ctapi/cloudpan"
 	"github.com/phpc0de/ctpango/cmder"
 	"github.com/phpc0de/ctpango/cmder/cmdtable"
 	"github.com/phpc0de/ctpango/internal/config"
-	"github.com/phpc0de/ctlibgo/logger"
+	"github.com/phpc0de/ctpango/internal/taskframework"
 	"github.com/urfave/cli"
+	"io"
 	"os"
 	"path"
 	"strconv"
-	"time"
+)
+
+type (
+	// DeleteMode 删除文件/目录的方式
+	DeleteMode int
+)
+
+const (
+	// DeleteModeDefault 使用接口默认的删除方式.
+	// rm 和 batchrm 使用的批量任务删除接口 (DELETE) 默认把文件移入回收站,
+	// 回收站的删除接口 (recycle delete) 默认彻底删除
+	DeleteModeDefault DeleteMode = iota
+	// DeleteModePermanent 彻底删除, 无法找回
+	DeleteModePermanent
+)
+
+const (
+	// DefaultRmMaxRetry rm 删除失败最大重试次数
+	DefaultRmMaxRetry = 3
+)
+
+var (
+	// ErrDeleteModeConflict 同时指定了移入回收站和彻底删除
+	ErrDeleteModeConflict = errors.New("cloud-trash-on-delete 和 cloud-permanent-delete 不能同时使用")
+	// ErrRmIsDirectory 删除目录时未指定 -r
+	ErrRmIsDirectory = errors.New("不能删除目录, 请使用 -r 参数递归删除")
 )
 
 func CmdRm() cli.Command {
 	return cli.Command{
 		Name:      "rm",
 		Usage:     "删除文件/目录",
-		UsageText: cmder.App().Name + " rm <文件/目录的路径1> <文件/目录2> <文件/目录3> ...",
+		UsageText: cmder.App().Name + " rm [-r] [-f] <文件/目录的路径1> <文件/目录2> <文件/目录3> ...",
 		Description: `
 	注意: 删除多个文件和目录时, 请确保每一个文件和目录都存在, 否则删除操作会失败.
-	被删除的文件或目录可在网盘文件回收站找回.
+	删除目录必须使用 -r 参数, 目录中的所有文件也会被删除.
+	删除前会列出要删除的文件/目录并进行确认, 使用 -f 参数跳过确认.
+	默认使用批量任务删除接口, 被删除的文件或目录会移入回收站, 可在网盘文件回收站找回.
+	-cloud-trash-on-delete 与默认方式相同, 文件移入回收站; 使用 -cloud-permanent-delete 彻底删除, 无法找回.
 
 	示例:
 
 	删除 /我的资源/1.mp4
 	cloudpan189-go rm /我的资源/1.mp4
 
+	彻底删除 /我的资源/1.mp4, 不保留在回收站
+	cloudpan189-go rm -cloud-permanent-delete /我的资源/1.mp4
+
 	删除 /我的资源/1.mp4 和 /我的资源/2.mp4
 	cloudpan189-go rm /我的资源/1.mp4 /我的资源/2.mp4
 
 	删除 /我的资源 整个目录 !!
-	cloudpan189-go rm /我的资源
+	cloudpan189-go rm -r /我的资源
+
+	删除 /我的资源 整个目录, 不进行确认 !!
+	cloudpan189-go rm -r -f /我的资源
 `,
 		Category: "天翼云盘",
 		Before:   cmder.ReloadConfigFunc,
@@ -58,138 +93,159 @@ func CmdRm() cli.Command {
 				fmt.Println("未登录账号")
 				return nil
 			}
-			RunRemove(parseFamilyId(c), c.Args()...)
+			mode, err := deleteModeOf(c.Bool("cloud-trash-on-delete"), c.Bool("cloud-permanent-delete"))
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			RunRmWithMode(familyId, c.Args(), c.Bool("recursive"), c.Bool("force"), mode)
 			return nil
 		},
-		Flags: []cli.Flag{
-			cli.StringFlag{
-				Name:  "familyId",
-				Usage: "家庭云ID",
-				Value: "",
+		Flags: append([]cli.Flag{
+			cli.BoolFlag{
+				Name:  "recursive, r",
+				Usage: "递归删除目录及其中的所有文件",
 			},
-		},
+			cli.BoolFlag{
+				Name:  "force, f",
+				Usage: "删除前不进行确认",
+			},
+			cli.BoolFlag{
+				Name:  "cloud-trash-on-delete",
+				Usage: "文件移入回收站, 与默认的删除方式相同",
+			},
+			cli.BoolFlag{
+				Name:  "cloud-permanent-delete",
+				Usage: "彻底删除文件, 不保留在回收站, 无法找回",
+			},
+		}, FamilyFlags...),
 	}
 }
 
-// RunRemove 执行 批量删除文件/目录
-func RunRemove(familyId int64, paths ...string) {
-	if IsFamilyCloud(familyId) {
-		delFamilyCloudFiles(familyId, paths...)
-	} else {
-		delPersonCloudFiles(familyId, paths...)
-	}
+// RunRm 执行 删除文件/目录, 使用接口默认的删除方式.
+// 删除目录需要指定 recursive, 除非指定 force, 否则删除前进行确认
+func RunRm(familyId int64, paths []string, recursive, force bool) {
+	RunRmWithMode(familyId, paths, recursive, force, DeleteModeDefault)
 }
 
-func delFamilyCloudFiles(familyId int64, paths ...string)  {
+// RunRmWithMode 执行 删除文件/目录, 按 mode 指定的方式删除, 每个文件/目录作为一个任务执行
+func RunRmWithMode(familyId int64, paths []string, recursive, force bool, mode DeleteMode) {
 	activeUser := GetActiveUser()
-	infoList, _, delFileInfos := getBatchTaskInfoList(familyId, paths...)
-	if infoList == nil || len(*infoList) == 0 {
-		fmt.Println("没有有效的文件可删除")
-		return
-	}
-
-	// create delete files task
-	delParam := &cloudpan.BatchTaskParam{
-		TypeFlag: cloudpan.BatchTaskTypeDelete,
-		TaskInfos: *infoList,
+	absPaths := make([]string, 0, len(paths))
+	for _, p := range paths {
+		absPaths = append(absPaths, path.Clean(activeUser.PathJoin(familyId, p)))
 	}
 
-	taskId, err := activeUser.PanClient().AppCreateBatchTask(familyId, delParam)
+	units, err := newRmTaskUnits(activeUser.PanClient(), familyId, absPaths, recursive, mode)
 	if err != nil {
-		fmt.Println("无法删除文件，请稍后重试")
-		return
-	}
-	logger.Verboseln("delete file task id: " + taskId)
-
-	// check task
-	time.Sleep(time.Duration(200) * time.Millisecond)
-	taskRes, err := activeUser.PanClient().AppCheckBatchTask(cloudpan.BatchTaskTypeDelete, taskId)
-	if err != nil || taskRes.TaskStatus != cloudpan.BatchTaskStatusOk {
-		fmt.Println("无法删除文件，请稍后重试")
+		fmt.Println(err)
 		return
 	}
 
-	pnt := func() {
+	if !force {
 		tb := cmdtable.NewTable(os.Stdout)
-		tb.SetHeader([]string{"#", "文件/目录"})
-		for k := range *delFileInfos {
-			tb.Append([]string{strconv.Itoa(k), (*delFileInfos)[k].Path})
+		tb.SetHeader([]string{"#", "文件/目录", "类型"})
+		for k, unit := range units {
+			fileType := "文件"
+			if unit.FileEntity.IsFolder {
+				fileType = "目录"
+			}
+			tb.Append([]string{strconv.Itoa(k), unit.PanPath, fileType})
 		}
 		tb.Render()
-	}
-	if taskRes.TaskStatus == cloudpan.BatchTaskStatusOk {
-		fmt.Println("操作成功, 以下文件/目录已删除, 可在云盘文件回收站找回: ")
-		pnt()
-	}
-}
 
-func delPersonCloudFiles(familyId int64, paths ...string)  {
-	activeUser := GetActiveUser()
-	infoList, _, delFileInfos := getBatchTaskInfoList(familyId, paths...)
-	if infoList == nil || len(*infoList) == 0 {
-		fmt.Println("没有有效的文件可删除")
-		return
+		action := "删除"
+		if mode == DeleteModePermanent {
+			action = "彻底删除"
+		}
+		var confirm string
+		fmt.Printf("确认%s以上 %d 个文件/目录? (y/n) > ", action, len(units))
+		_, err := fmt.Scanln(&confirm)
+		if err != nil || (confirm != "y" && confirm != "Y") {
+			fmt.Println("已取消删除")
+			return
+		}
 	}
 
-	// create delete files task
-	delParam := &cloudpan.BatchTaskParam{
-		TypeFlag: cloudpan.BatchTaskTypeDelete,
-		TaskInfos: *infoList,
-	}
+	executeDeleteUnits(units, DefaultRmMaxRetry)
+	fmt.Println()
+	printDeleteResults(os.Stdout, units)
+}
 
-	taskId, err := activeUser.PanClient().CreateBatchTask(delParam)
-	if err != nil {
-		fmt.Println("无法删除文件，请稍后重试")
-		return
+// newRmTaskUnits 获取要删除的文件信息, 生成删除任务, 目录需要指定 recursive
+func newRmTaskUnits(client deleteClient, familyId int64, paths []string, recursive bool, mode DeleteMode) ([]*batchDeleteTaskUnit, error) {
+	units := make([]*batchDeleteTaskUnit, 0, len(paths))
+	for _, p := range paths {
+		fe, apierr := client.AppFileInfoByPath(familyId, p)
+		if apierr != nil {
+			return nil, fmt.Errorf("获取文件信息错误, %s: %s", apierr, p)
+		}
+		if fe.IsFolder && !recursive {
+			return nil, fmt.Errorf("%w: %s", ErrRmIsDirectory, p)
+		}
+		units = append(units, &batchDeleteTaskUnit{
+			PanClient:  client,
+			FamilyId:   familyId,
+			PanPath:    p,
+			FileEntity: fe,
+			Mode:       mode,
+		})
 	}
-	logger.Verboseln("delete file task id: " + taskId)
+	return units, nil
+}
 
-	// check task
-	time.Sleep(time.Duration(200) * time.Millisecond)
-	taskRes, err := activeUser.PanClient().CheckBatchTask(cloudpan.BatchTaskTypeDelete, taskId)
-	if err != nil || taskRes.TaskStatus != cloudpan.BatchTaskStatusOk {
-		fmt.Println("无法删除文件，请稍后重试")
-		return
+// executeDeleteUnits 逐个执行删除任务
+func executeDeleteUnits(units []*batchDeleteTaskUnit, maxRetry int) {
+	executor := taskframework.TaskExecutor{}
+	for _, unit := range units {
+		executor.Append(unit, maxRetry)
 	}
+	executor.Execute()
+}
 
-	pnt := func() {
-		tb := cmdtable.NewTable(os.Stdout)
-		tb.SetHeader([]string{"#", "文件/目录"})
-		for k := range *delFileInfos {
-			tb.Append([]string{strconv.Itoa(k), (*delFileInfos)[k].Path})
+// printDeleteResults 输出每个文件/目录的删除结果
+func printDeleteResults(w io.Writer, units []*batchDeleteTaskUnit) {
+	succeed := 0
+	tb := cmdtable.NewTable(w)
+	tb.SetHeader([]string{"#", "文件/目录", "结果"})
+	for k, unit := range units {
+		tb.Append([]string{strconv.Itoa(k), unit.PanPath, deleteResultText(unit)})
+		if unit.lastResult != nil && unit.lastResult.Succeed {
+			succeed++
 		}
-		tb.Render()
 	}
-	if taskRes.TaskStatus == cloudpan.BatchTaskStatusOk {
-		fmt.Println("操作成功, 以下文件/目录已删除, 可在云盘文件回收站找回: ")
-		pnt()
+	tb.Render()
+	fmt.Fprintf(w, "删除结束, 成功 %d 个, 失败 %d 个\n", succeed, len(units)-succeed)
+}
+
+// deleteResultText 删除任务的执行结果
+func deleteResultText(unit *batchDeleteTaskUnit) string {
+	res := unit.lastResult
+	switch {
+	case res == nil:
+		return "未执行"
+	case res.Succeed && unit.Mode == DeleteModePermanent:
+		return "已彻底删除"
+	case res.Succeed:
+		return "已删除"
+	case res.Err != nil:
+		return fmt.Sprintf("%s, %s", res.ResultMessage, res.Err)
 	}
+	return res.ResultMessage
 }
 
-func getBatchTaskInfoList(familyId int64, paths ...string) (*cloudpan.BatchTaskInfoList, *[]string, *[]*cloudpan.AppFileEntity) {
-	activeUser := GetActiveUser()
-	failedRmPaths := make([]string, 0, len(paths))
-	delFileInfos := make([]*cloudpan.AppFileEntity, 0, len(paths))
-	infoList := cloudpan.BatchTaskInfoList{}
-	for _, p := range paths {
-		absolutePath := path.Clean(activeUser.PathJoin(familyId, p))
-		fe, err := activeUser.PanClient().AppFileInfoByPath(familyId, absolutePath)
-		if err != nil {
-			failedRmPaths = append(failedRmPaths, absolutePath)
-			continue
-		}
-		isFolder := 0
-		if fe.IsFolder {
-			isFolder = 1
-		}
-		infoItem := &cloudpan.BatchTaskInfo{
-			FileId: fe.FileId,
-			FileName: fe.FileName,
-			IsFolder: isFolder,
-			SrcParentId: fe.ParentId,
-		}
-		infoList = append(infoList, infoItem)
-		delFileInfos = append(delFileInfos, fe)
+// deleteModeOf 根据命令行参数返回删除方式, trash 与默认方式相同
+func deleteModeOf(trash, permanent bool) (DeleteMode, error) {
+	switch {
+	case trash && permanent:
+		return DeleteModeDefault, ErrDeleteModeConflict
+	case permanent:
+		return DeleteModePermanent, nil
 	}
-	return &infoList, &failedRmPaths, &delFileInfos
-}
\ No newline at end of file
+	return DeleteModeDefault, nil
+}
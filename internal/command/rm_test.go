@@ -0,0 +1,182 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctapi/cloudpan/apierror"
+)
+
+// fakeDeleteClient 模拟网盘的删除接口
+type fakeDeleteClient struct {
+	mu        sync.Mutex
+	files     map[string]*cloudpan.AppFileEntity // path -> 文件信息
+	failIds   map[string]bool                    // 创建删除任务失败的 file_id
+	deleted   []string                           // 已移入回收站的 file_id
+	purged    []string                           // 已彻底删除的 file_id
+	taskFiles map[string]string                  // taskId -> file_id
+	pending   map[string]int                     // file_id -> 删除任务返回未完成状态的次数
+}
+
+func newFakeDeleteClient() *fakeDeleteClient {
+	return &fakeDeleteClient{
+		files: map[string]*cloudpan.AppFileEntity{
+			"/a.txt": {FileId: "1", FileName: "a.txt"},
+			"/b.txt": {FileId: "2", FileName: "b.txt"},
+			"/dir":   {FileId: "3", FileName: "dir", IsFolder: true},
+		},
+		failIds:   map[string]bool{},
+		taskFiles: map[string]string{},
+		pending:   map[string]int{},
+	}
+}
+
+func (f *fakeDeleteClient) AppFileInfoByPath(familyId int64, pathStr string) (*cloudpan.AppFileEntity, *apierror.ApiError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fe, ok := f.files[pathStr]
+	if !ok {
+		return nil, apierror.NewApiError(apierror.ApiCodeFileNotFoundCode, "file not found")
+	}
+	return fe, nil
+}
+
+func (f *fakeDeleteClient) CreateBatchTask(param *cloudpan.BatchTaskParam) (string, *apierror.ApiError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fileId := param.TaskInfos[0].FileId
+	if f.failIds[fileId] {
+		return "", apierror.NewFailedApiError("create task failed")
+	}
+	taskId := "task" + fileId
+	f.taskFiles[taskId] = fileId
+	// 创建任务后文件不在原路径
+	for p, fe := range f.files {
+		if fe.FileId == fileId {
+			delete(f.files, p)
+		}
+	}
+	return taskId, nil
+}
+
+func (f *fakeDeleteClient) CheckBatchTask(typeFlag cloudpan.BatchTaskType, taskId string) (*cloudpan.CheckTaskResult, *apierror.ApiError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fileId := f.taskFiles[taskId]
+	if f.pending[fileId] > 0 {
+		f.pending[fileId]--
+		// 任务执行中
+		return &cloudpan.CheckTaskResult{TaskStatus: cloudpan.BatchTaskStatus(3)}, nil
+	}
+	f.deleted = append(f.deleted, fileId)
+	return &cloudpan.CheckTaskResult{TaskStatus: cloudpan.BatchTaskStatusOk}, nil
+}
+
+func (f *fakeDeleteClient) AppCreateBatchTask(familyId int64, param *cloudpan.BatchTaskParam) (string, *apierror.ApiError) {
+	return f.CreateBatchTask(param)
+}
+
+func (f *fakeDeleteClient) AppCheckBatchTask(typeFlag cloudpan.BatchTaskType, taskId string) (*cloudpan.CheckTaskResult, *apierror.ApiError) {
+	return f.CheckBatchTask(typeFlag, taskId)
+}
+
+func (f *fakeDeleteClient) RecycleDelete(familyId int64, fileIdList []string) *apierror.ApiError {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.purged = append(f.purged, fileIdList...)
+	return nil
+}
+
+func TestDeleteModeOf(t *testing.T) {
+	cases := []struct {
+		trash, permanent bool
+		want             DeleteMode
+		wantErr          error
+	}{
+		{false, false, DeleteModeDefault, nil},
+		{true, false, DeleteModeDefault, nil},
+		{false, true, DeleteModePermanent, nil},
+		{true, true, DeleteModeDefault, ErrDeleteModeConflict},
+	}
+	for _, c := range cases {
+		mode, err := deleteModeOf(c.trash, c.permanent)
+		if err != c.wantErr {
+			t.Errorf("deleteModeOf(%t, %t) err = %v, want %v", c.trash, c.permanent, err, c.wantErr)
+		}
+		if mode != c.want {
+			t.Errorf("deleteModeOf(%t, %t) = %d, want %d", c.trash, c.permanent, mode, c.want)
+		}
+	}
+}
+
+func TestNewRmTaskUnitsDirectoryWithoutRecursive(t *testing.T) {
+	client := newFakeDeleteClient()
+	_, err := newRmTaskUnits(client, 0, []string{"/a.txt", "/dir"}, false, DeleteModeDefault)
+	if !errors.Is(err, ErrRmIsDirectory) {
+		t.Fatalf("err = %v, want ErrRmIsDirectory", err)
+	}
+	if !strings.Contains(err.Error(), "/dir") {
+		t.Errorf("err = %q, want it to contain the directory path", err)
+	}
+
+	units, err := newRmTaskUnits(client, 0, []string{"/a.txt", "/dir"}, true, DeleteModeDefault)
+	if err != nil {
+		t.Fatalf("newRmTaskUnits with recursive: %s", err)
+	}
+	if len(units) != 2 {
+		t.Errorf("len(units) = %d, want 2", len(units))
+	}
+
+	if _, err = newRmTaskUnits(client, 0, []string{"/missing.txt"}, true, DeleteModeDefault); err == nil {
+		t.Errorf("expected error for missing path")
+	}
+}
+
+func TestExecuteDeleteUnits(t *testing.T) {
+	client := newFakeDeleteClient()
+	client.failIds["2"] = true
+	units, err := newRmTaskUnits(client, 0, []string{"/a.txt", "/b.txt", "/dir"}, true, DeleteModePermanent)
+	if err != nil {
+		t.Fatalf("newRmTaskUnits: %s", err)
+	}
+	executeDeleteUnits(units, 0)
+
+	wantSucceed := []bool{true, false, true}
+	for k, unit := range units {
+		if unit.lastResult == nil {
+			t.Fatalf("%s: no result", unit.PanPath)
+		}
+		if unit.lastResult.Succeed != wantSucceed[k] {
+			t.Errorf("%s: Succeed = %t, want %t", unit.PanPath, unit.lastResult.Succeed, wantSucceed[k])
+		}
+	}
+	if len(client.deleted) != 2 || len(client.purged) != 2 {
+		t.Errorf("deleted = %v, purged = %v, want 2 each", client.deleted, client.purged)
+	}
+
+	buf := &bytes.Buffer{}
+	printDeleteResults(buf, units)
+	out := buf.String()
+	for _, want := range []string{"已彻底删除", "创建删除任务错误", "成功 2 个, 失败 1 个"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
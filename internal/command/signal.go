@@ -0,0 +1,79 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultShutdownTimeout 收到退出信号后等待任务保存断点信息的最长时间
+	DefaultShutdownTimeout = 5 * time.Second
+	// ShutdownExitCode 收到退出信号后程序的退出码
+	ShutdownExitCode = 130
+)
+
+var (
+	// ErrShutdown 收到退出信号, 任务已停止并保存了断点信息, 命令返回该错误后由 main 以 ShutdownExitCode 退出
+	ErrShutdown = errors.New("收到退出信号, 已停止")
+
+	// shutdownExit 等待任务结束超时或再次收到信号时强制退出程序
+	shutdownExit = os.Exit
+	// shutdownOutput 输出退出提示
+	shutdownOutput io.Writer = os.Stderr
+)
+
+// WatchShutdownSignal 收到 SIGINT 或 SIGTERM 时调用 cancel 取消正在进行的任务, 任务结束后由调用方返回 ErrShutdown,
+// 经过 main 退出程序, 保证断点信息写入和 defer 执行. done 在 timeout 内没有关闭或再次收到信号时强制退出.
+// 任务结束后调用返回的 stop 取消监听
+func WatchShutdownSignal(cancel func(), done <-chan struct{}, timeout time.Duration) (stop func()) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	stopCh := make(chan struct{})
+
+	go func() {
+		select {
+		case <-sigCh:
+		case <-stopCh:
+			return
+		}
+
+		fmt.Fprintln(shutdownOutput, "正在保存断点信息, 请稍候...")
+		cancel()
+		select {
+		case <-done:
+			return
+		case <-sigCh:
+			fmt.Fprintln(shutdownOutput, "再次收到退出信号, 立即退出")
+		case <-time.After(timeout):
+			fmt.Fprintln(shutdownOutput, "等待超时, 部分断点信息可能未保存")
+		}
+		shutdownExit(ShutdownExitCode)
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(sigCh)
+			close(stopCh)
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchShutdownSignalSavesState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signal_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	statePath := filepath.Join(dir, "file.bin.cloudpan189-downloading")
+
+	exitCode := make(chan int, 1)
+	shutdownExit = func(code int) {
+		exitCode <- code
+	}
+	shutdownOutput = &bytes.Buffer{}
+	defer func() {
+		shutdownExit = os.Exit
+		shutdownOutput = os.Stderr
+	}()
+
+	// 模拟下载, 取消后写入断点信息
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				time.Sleep(50 * time.Millisecond) // 等待正在下载的数据写入
+				ioutil.WriteFile(statePath, []byte("state"), 0644)
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	stop := WatchShutdownSignal(cancel, done, DefaultShutdownTimeout)
+	defer stop()
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Signal(os.Interrupt); err != nil {
+		t.Skipf("sending interrupt is not supported: %s", err)
+	}
+
+	// 任务保存断点信息后结束, 由调用方返回 ErrShutdown, 不强制退出
+	select {
+	case <-done:
+		if _, err = os.Stat(statePath); err != nil {
+			t.Error("state file does not exist after shutdown")
+		}
+	case <-time.After(DefaultShutdownTimeout + time.Second):
+		t.Fatal("task was not canceled")
+	}
+	select {
+	case code := <-exitCode:
+		t.Fatalf("exited with code %d after the task finished", code)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWatchShutdownSignalTimeout(t *testing.T) {
+	exitCode := make(chan int, 1)
+	shutdownExit = func(code int) {
+		exitCode <- code
+	}
+	shutdownOutput = &bytes.Buffer{}
+	defer func() {
+		shutdownExit = os.Exit
+		shutdownOutput = os.Stderr
+	}()
+
+	// done 不会关闭, 超时后退出
+	stop := WatchShutdownSignal(func() {}, make(chan struct{}), 50*time.Millisecond)
+	defer stop()
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Signal(os.Interrupt); err != nil {
+		t.Skipf("sending interrupt is not supported: %s", err)
+	}
+
+	select {
+	case code := <-exitCode:
+		if code != ShutdownExitCode {
+			t.Errorf("exit code = %d, want %d", code, ShutdownExitCode)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("shutdown did not exit after timeout")
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/phpc0de/ctlibgo/requester"
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/cmder/cmdtable"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/phpc0de/ctpango/internal/functions/panupload"
+	"github.com/urfave/cli"
+)
+
+func CmdGetTags() cli.Command {
+	return cli.Command{
+		Name:      "gettags",
+		Usage:     "查看网盘文件的标签",
+		UsageText: cmder.App().Name + " gettags <文件路径>",
+		Description: `
+	查看使用 upload -upload-tags 上传时添加的标签.
+	天翼云盘不支持自定义元数据, 标签保存在与文件同目录的附属文件 <文件名>` + panupload.TagsSidecarSuffix + ` 中.
+
+	示例:
+
+	查看 /视频/1.mp4 的标签
+	cloudpan189-go gettags /视频/1.mp4
+`,
+		Category: "天翼云盘",
+		Before:   cmder.ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			if config.Config.ActiveUser() == nil {
+				fmt.Println("未登录账号")
+				return nil
+			}
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			RunGetTags(familyId, c.Args().Get(0))
+			return nil
+		},
+		Flags: FamilyFlags,
+	}
+}
+
+// RunGetTags 执行 读取网盘文件 cloudPath 的标签附属文件并输出
+func RunGetTags(familyId int64, cloudPath string) {
+	activeUser := GetActiveUser()
+	panClient := activeUser.PanClient()
+	cloudPath = activeUser.PathJoin(familyId, cloudPath)
+	sidecarPath := panupload.TagsSidecarPath(cloudPath)
+	fileInfo, apierr := panClient.AppFileInfoByPath(familyId, sidecarPath)
+	if apierr != nil {
+		fmt.Printf("文件没有标签: %s, %s\n", cloudPath, apierr)
+		return
+	}
+
+	var durl string
+	if IsFamilyCloud(familyId) {
+		durl, apierr = panClient.AppFamilyGetFileDownloadUrl(familyId, fileInfo.FileId)
+	} else {
+		durl, apierr = panClient.AppGetFileDownloadUrl(fileInfo.FileId)
+	}
+	if apierr != nil {
+		fmt.Printf("获取下载链接错误: %s, %s\n", sidecarPath, apierr)
+		return
+	}
+
+	tags, err := readTags(panClient, config.Config.HTTPClient(""), durl)
+	if err != nil {
+		fmt.Printf("读取文件标签错误: %s, %s\n", sidecarPath, err)
+		return
+	}
+	renderTags(os.Stdout, tags)
+}
+
+// readTags 读取下载链接 durl 的标签附属文件
+func readTags(dataClient catDataClient, client *requester.HTTPClient, durl string) (map[string]string, error) {
+	buf := &bytes.Buffer{}
+	if err := catFile(buf, dataClient, client, durl, 0, 0, nil); err != nil {
+		return nil, err
+	}
+	tags := map[string]string{}
+	if err := json.Unmarshal(buf.Bytes(), &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// renderTags 按 key 排序输出标签
+func renderTags(w io.Writer, tags map[string]string) {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tb := cmdtable.NewTable(w)
+	tb.SetHeader([]string{"key", "value"})
+	for _, k := range keys {
+		tb.Append([]string{k, tags[k]})
+	}
+	tb.Render()
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctlibgo/requester"
+)
+
+func TestReadTags(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"owner": "alice", "project": "demo"}`))
+	}))
+	defer server.Close()
+
+	panClient := cloudpan.NewPanClient(cloudpan.WebLoginToken{}, cloudpan.AppLoginToken{})
+	tags, err := readTags(panClient, requester.NewHTTPClient(), server.URL+"/file.meta.json?id=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags["owner"] != "alice" || tags["project"] != "demo" {
+		t.Fatalf("got tags %v", tags)
+	}
+
+	buf := &bytes.Buffer{}
+	renderTags(buf, tags)
+	out := buf.String()
+	if strings.Index(out, "owner") > strings.Index(out, "project") {
+		t.Errorf("tags not sorted by key:\n%s", out)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/phpc0de/ctpango/internal/logfile"
+	"github.com/urfave/cli"
+)
+
+const (
+	// TokenExpiryWarningDuration sskAccessToken 剩余有效期小于该值时输出警告
+	TokenExpiryWarningDuration = 1 * time.Hour
+
+	// EnvAccessToken export 格式输出的 accessToken 环境变量名
+	EnvAccessToken = "CLOUDPAN189_ACCESS_TOKEN"
+	// EnvSessionKey export 格式输出的 sessionKey 环境变量名
+	EnvSessionKey = "CLOUDPAN189_SESSION_KEY"
+	// EnvSessionSecret export 格式输出的 sessionSecret 环境变量名
+	EnvSessionSecret = "CLOUDPAN189_SESSION_SECRET"
+	// EnvSskAccessToken export 格式输出的 sskAccessToken 环境变量名
+	EnvSskAccessToken = "CLOUDPAN189_SSK_ACCESS_TOKEN"
+	// EnvSskTokenExpiresAt export 格式输出的 sskAccessToken 过期时间环境变量名, 值为 Unix 时间戳(秒)
+	EnvSskTokenExpiresAt = "CLOUDPAN189_SSK_ACCESS_TOKEN_EXPIRES_AT"
+)
+
+func CmdToken() cli.Command {
+	return cli.Command{
+		Name:      "token",
+		Usage:     "输出当前帐号的登录凭证",
+		UsageText: cmder.App().Name + " token [-export]",
+		Description: `
+	输出当前帐号的 accessToken, sessionKey, sessionSecret, sskAccessToken 和 sskAccessToken 的过期时间,
+	用于在脚本中直接调用天翼云盘的接口. 只有 sskAccessToken 有已知的过期时间, 其他凭证的有效期由服务器决定.
+	登录凭证只输出到标准输出, sskAccessToken 剩余有效期不足1小时时在标准错误输出警告.
+	注意: 登录凭证等同于帐号密码, 不要泄露给他人.
+
+	示例:
+
+	输出当前帐号的登录凭证
+	cloudpan189-go token
+
+	以 shell export 格式输出, 并导入到当前 shell 的环境变量中
+	eval "$(cloudpan189-go token -export)"
+`,
+		Category: "天翼云盘账号",
+		Before:   cmder.ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			activeUser := config.Config.ActiveUser()
+			if activeUser == nil || activeUser.AppToken.SessionKey == "" {
+				fmt.Fprintln(os.Stderr, "未登录账号")
+				return nil
+			}
+			// 登录凭证不写入日志文件
+			RunToken(logfile.Stdout(), os.Stderr, &activeUser.AppToken, c.Bool("export"), time.Now())
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "export",
+				Usage: "以 shell export 格式输出, 例如: export " + EnvAccessToken + "='...'",
+			},
+		},
+	}
+}
+
+// RunToken 输出登录凭证 token 到 w, 剩余有效期不足 TokenExpiryWarningDuration 时输出警告到 warnW
+func RunToken(w, warnW io.Writer, token *cloudpan.AppLoginToken, export bool, now time.Time) {
+	expiresAt := tokenExpiresAt(token)
+	if export {
+		renderTokenExport(w, token, expiresAt)
+	} else {
+		renderToken(w, token, expiresAt)
+	}
+	if warning := tokenExpiryWarning(expiresAt, now); warning != "" {
+		fmt.Fprintln(warnW, warning)
+	}
+}
+
+// tokenExpiresAt 返回 sskAccessToken 的过期时间, 未知时返回零值
+func tokenExpiresAt(token *cloudpan.AppLoginToken) time.Time {
+	if token.SskAccessTokenExpiresIn <= 0 {
+		return time.Time{}
+	}
+	// SskAccessTokenExpiresIn 为毫秒时间戳
+	return time.Unix(0, token.SskAccessTokenExpiresIn*int64(time.Millisecond))
+}
+
+// tokenExpiryWarning sskAccessToken 已过期或剩余有效期不足 TokenExpiryWarningDuration 时返回警告信息, 过期时间未知时不警告
+func tokenExpiryWarning(expiresAt, now time.Time) string {
+	if expiresAt.IsZero() {
+		return ""
+	}
+	left := expiresAt.Sub(now)
+	if left <= 0 {
+		return fmt.Sprintf("警告: sskAccessToken 已于 %s 过期, 请重新登录", expiresAt.Format("2006-01-02 15:04:05"))
+	}
+	if left < TokenExpiryWarningDuration {
+		return fmt.Sprintf("警告: sskAccessToken 将在 %s 后过期 (%s), 请及时重新登录", left.Truncate(time.Second), expiresAt.Format("2006-01-02 15:04:05"))
+	}
+	return ""
+}
+
+func renderToken(w io.Writer, token *cloudpan.AppLoginToken, expiresAt time.Time) {
+	expires := "未知"
+	if !expiresAt.IsZero() {
+		expires = expiresAt.Format("2006-01-02 15:04:05")
+	}
+	fmt.Fprintf(w, "accessToken: %s\n", token.AccessToken)
+	fmt.Fprintf(w, "sessionKey: %s\n", token.SessionKey)
+	fmt.Fprintf(w, "sessionSecret: %s\n", token.SessionSecret)
+	fmt.Fprintf(w, "sskAccessToken: %s\n", token.SskAccessToken)
+	fmt.Fprintf(w, "sskAccessToken 过期时间: %s\n", expires)
+}
+
+// renderTokenExport 以 shell export 格式输出, sskAccessToken 的过期时间为 Unix 时间戳(秒), 未知时为0
+func renderTokenExport(w io.Writer, token *cloudpan.AppLoginToken, expiresAt time.Time) {
+	var expires int64
+	if !expiresAt.IsZero() {
+		expires = expiresAt.Unix()
+	}
+	fmt.Fprintf(w, "export %s=%s\n", EnvAccessToken, shellQuote(token.AccessToken))
+	fmt.Fprintf(w, "export %s=%s\n", EnvSessionKey, shellQuote(token.SessionKey))
+	fmt.Fprintf(w, "export %s=%s\n", EnvSessionSecret, shellQuote(token.SessionSecret))
+	fmt.Fprintf(w, "export %s=%s\n", EnvSskAccessToken, shellQuote(token.SskAccessToken))
+	fmt.Fprintf(w, "export %s=%d\n", EnvSskTokenExpiresAt, expires)
+}
+
+// shellQuote 使用单引号包裹 s, 避免 shell 解析其中的特殊字符
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+)
+
+func TestRunTokenExport(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	expiresAt := now.Add(24 * time.Hour)
+	token := &cloudpan.AppLoginToken{
+		AccessToken:             "access",
+		SessionKey:              "key'1",
+		SessionSecret:           "secret",
+		SskAccessToken:          "ssk",
+		SskAccessTokenExpiresIn: expiresAt.UnixNano() / int64(time.Millisecond),
+	}
+
+	out, warn := &bytes.Buffer{}, &bytes.Buffer{}
+	RunToken(out, warn, token, true, now)
+	expected := "export CLOUDPAN189_ACCESS_TOKEN='access'\n" +
+		"export CLOUDPAN189_SESSION_KEY='key'\\''1'\n" +
+		"export CLOUDPAN189_SESSION_SECRET='secret'\n" +
+		"export CLOUDPAN189_SSK_ACCESS_TOKEN='ssk'\n" +
+		"export CLOUDPAN189_SSK_ACCESS_TOKEN_EXPIRES_AT=" + strconv.FormatInt(expiresAt.Unix(), 10) + "\n"
+	if out.String() != expected {
+		t.Fatalf("output: %s", out)
+	}
+	if warn.Len() != 0 {
+		t.Fatalf("warning: %s", warn)
+	}
+
+	// 过期时间未知
+	out.Reset()
+	token.SskAccessTokenExpiresIn = 0
+	RunToken(out, warn, token, true, now)
+	if !strings.HasSuffix(out.String(), "export CLOUDPAN189_SSK_ACCESS_TOKEN_EXPIRES_AT=0\n") || warn.Len() != 0 {
+		t.Fatalf("output: %s, warning: %s", out, warn)
+	}
+}
+
+func TestTokenExpiryWarning(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	cases := []struct {
+		expiresAt time.Time
+		warn      bool
+	}{
+		{time.Time{}, false},
+		{now.Add(2 * time.Hour), false},
+		{now.Add(TokenExpiryWarningDuration), false},
+		{now.Add(30 * time.Minute), true},
+		{now.Add(-time.Minute), true},
+	}
+	for _, c := range cases {
+		warning := tokenExpiryWarning(c.expiresAt, now)
+		if (warning != "") != c.warn {
+			t.Errorf("expires at %s: warning: %q", c.expiresAt, warning)
+		}
+	}
+
+	// 警告输出到 warnW, 不输出到 w
+	out, warn := &bytes.Buffer{}, &bytes.Buffer{}
+	RunToken(out, warn, &cloudpan.AppLoginToken{
+		SessionKey:              "key",
+		SskAccessTokenExpiresIn: now.Add(10*time.Minute).UnixNano() / int64(time.Millisecond),
+	}, false, now)
+	if !strings.Contains(warn.String(), "警告") || strings.Contains(out.String(), "警告") {
+		t.Fatalf("output: %s, warning: %s", out, warn)
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctlibgo/converter"
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/urfave/cli"
+	"io"
+	"os"
+	"path"
+)
+
+type (
+	// treeNode 目录树节点, 用于JSON输出
+	treeNode struct {
+		FileId   string      `json:"fileId"`
+		Name     string      `json:"name"`
+		Path     string      `json:"path"`
+		IsFolder bool        `json:"isFolder"`
+		Size     int64       `json:"size"`
+		Children []*treeNode `json:"children,omitempty"`
+	}
+
+	// treeStatistic 目录树统计
+	treeStatistic struct {
+		dirs  int64
+		files int64
+		size  int64
+	}
+
+	// treeListFunc 获取目录下的文件和目录
+	treeListFunc func(folder *cloudpan.AppFileEntity) (cloudpan.AppFileList, error)
+)
+
+const (
+	treeConnector     = "├── "
+	treeLastConnector = "└── "
+	treeIndent        = "│   "
+	treeLastIndent    = "    "
+)
+
+func CmdTree() cli.Command {
+	return cli.Command{
+		Name:      "tree",
+		Usage:     "以树形结构列出目录",
+		UsageText: cmder.App().Name + " tree <目录>",
+		Description: `
+	以树形结构列出目录内的所有文件和目录, 和 Unix tree 命令的输出类似, 不指定目录时列出当前工作目录
+
+	示例:
+
+	列出 /我的资源 的目录树
+	cloudpan189-go tree /我的资源
+
+	列出 /我的资源 的目录树, 最多列出两层
+	cloudpan189-go tree -depth 2 /我的资源
+
+	以JSON格式输出 /我的资源 的目录树
+	cloudpan189-go tree -json /我的资源 > tree.json
+`,
+		Category: "天翼云盘",
+		Before:   cmder.ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if config.Config.ActiveUser() == nil {
+				fmt.Println("未登录账号")
+				return nil
+			}
+			if c.Bool("json") {
+				familyId, err := parseFamilyId(c)
+				if err != nil {
+					fmt.Println(err)
+					return nil
+				}
+				RunTreeJSON(familyId, c.Args().Get(0), c.Int("depth"))
+				return nil
+			}
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			RunTree(familyId, c.Args().Get(0), c.Int("depth"))
+			return nil
+		},
+		Flags: append([]cli.Flag{
+			cli.IntFlag{
+				Name:  "depth",
+				Usage: "列出的最大深度, 0为不限制",
+			},
+			cli.BoolFlag{
+				Name:  "json",
+				Usage: "以嵌套的JSON对象输出目录树",
+			},
+		}, FamilyFlags...),
+	}
+}
+
+// RunTree 以树形结构列出目录, 每列出一个目录就输出一次, 不缓存整个目录树
+func RunTree(familyId int64, cloudPath string, maxDepth int) {
+	root, list := treeRootAndListFunc(familyId, cloudPath)
+	if root == nil {
+		return
+	}
+
+	stat, err := renderTree(os.Stdout, root, maxDepth, list)
+	if err != nil {
+		fmt.Printf("获取目录信息错误: %s\n", err)
+	}
+	fmt.Printf("\n%d 个目录, %d 个文件, 总大小: %s\n", stat.dirs, stat.files, converter.ConvertFileSize(stat.size, 2))
+}
+
+// RunTreeJSON 以嵌套的JSON对象输出目录树
+func RunTreeJSON(familyId int64, cloudPath string, maxDepth int) {
+	root, list := treeRootAndListFunc(familyId, cloudPath)
+	if root == nil {
+		return
+	}
+
+	node, _, err := buildTreeNode(root, maxDepth, list)
+	if err != nil {
+		fmt.Printf("获取目录信息错误: %s\n", err)
+		return
+	}
+	data, err := json.MarshalIndent(node, "", "  ")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+func treeRootAndListFunc(familyId int64, cloudPath string) (*cloudpan.AppFileEntity, treeListFunc) {
+	activeUser := GetActiveUser()
+	cloudPath = path.Clean(activeUser.PathJoin(familyId, cloudPath))
+	root, apierr := activeUser.PanClient().AppFileInfoByPath(familyId, cloudPath)
+	if apierr != nil {
+		fmt.Println(apierr)
+		return nil, nil
+	}
+	root.Path = cloudPath
+
+	return root, func(folder *cloudpan.AppFileEntity) (cloudpan.AppFileList, error) {
+		param := cloudpan.NewAppFileListParam()
+		param.FileId = folder.FileId
+		param.FamilyId = familyId
+		param.OrderBy = cloudpan.OrderByName
+		param.OrderSort = cloudpan.OrderAsc
+		result, apierr := activeUser.PanClient().AppGetAllFileList(param)
+		if apierr != nil {
+			return nil, apierr
+		}
+		return result.FileList, nil
+	}
+}
+
+// renderTree 输出目录树, root 为文件时只输出该文件
+func renderTree(w io.Writer, root *cloudpan.AppFileEntity, maxDepth int, list treeListFunc) (*treeStatistic, error) {
+	stat := &treeStatistic{}
+	fmt.Fprintln(w, root.Path)
+	if !root.IsFolder {
+		stat.files++
+		stat.size += root.FileSize
+		return stat, nil
+	}
+	return stat, walkTree(w, "", root, 1, maxDepth, list, stat)
+}
+
+func walkTree(w io.Writer, prefix string, folder *cloudpan.AppFileEntity, depth, maxDepth int, list treeListFunc, stat *treeStatistic) error {
+	files, err := list(folder)
+	if err != nil {
+		return err
+	}
+	for k, file := range files {
+		connector, indent := treeConnector, treeIndent
+		if k == len(files)-1 {
+			connector, indent = treeLastConnector, treeLastIndent
+		}
+
+		if !file.IsFolder {
+			stat.files++
+			stat.size += file.FileSize
+			fmt.Fprintf(w, "%s%s%s\n", prefix, connector, file.FileName)
+			continue
+		}
+
+		stat.dirs++
+		fmt.Fprintf(w, "%s%s%s%s\n", prefix, connector, file.FileName, cloudpan.PathSeparator)
+		if maxDepth > 0 && depth >= maxDepth {
+			continue
+		}
+		if file.Path == "" {
+			file.Path = path.Join(folder.Path, file.FileName)
+		}
+		if err = walkTree(w, prefix+indent, file, depth+1, maxDepth, list, stat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildTreeNode 获取完整的目录树
+func buildTreeNode(root *cloudpan.AppFileEntity, maxDepth int, list treeListFunc) (*treeNode, *treeStatistic, error) {
+	stat := &treeStatistic{}
+	node := newTreeNode(root)
+	if !root.IsFolder {
+		stat.files++
+		stat.size += root.FileSize
+		return node, stat, nil
+	}
+	return node, stat, fillTreeNode(node, root, 1, maxDepth, list, stat)
+}
+
+func fillTreeNode(node *treeNode, folder *cloudpan.AppFileEntity, depth, maxDepth int, list treeListFunc, stat *treeStatistic) error {
+	files, err := list(folder)
+	if err != nil {
+		return err
+	}
+	node.Children = make([]*treeNode, 0, len(files))
+	for _, file := range files {
+		if file.Path == "" {
+			file.Path = path.Join(folder.Path, file.FileName)
+		}
+		child := newTreeNode(file)
+		node.Children = append(node.Children, child)
+		if !file.IsFolder {
+			stat.files++
+			stat.size += file.FileSize
+			continue
+		}
+
+		stat.dirs++
+		if maxDepth > 0 && depth >= maxDepth {
+			continue
+		}
+		if err = fillTreeNode(child, file, depth+1, maxDepth, list, stat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newTreeNode(file *cloudpan.AppFileEntity) *treeNode {
+	return &treeNode{
+		FileId:   file.FileId,
+		Name:     file.FileName,
+		Path:     file.Path,
+		IsFolder: file.IsFolder,
+		Size:     file.FileSize,
+	}
+}
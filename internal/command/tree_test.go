@@ -0,0 +1,118 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/phpc0de/ctapi/cloudpan"
+	"testing"
+)
+
+// newTestTreeListFunc 模拟的网盘目录:
+// /我的资源
+// ├── 1.mp4
+// ├── 文档/
+// │   ├── a.txt
+// │   └── 草稿/
+// │       └── b.txt
+// └── 2.mp4
+func newTestTreeListFunc() (*cloudpan.AppFileEntity, treeListFunc) {
+	children := map[string]cloudpan.AppFileList{
+		"1": {
+			{FileId: "11", FileName: "1.mp4", FileSize: 100},
+			{FileId: "12", FileName: "文档", IsFolder: true},
+			{FileId: "13", FileName: "2.mp4", FileSize: 200},
+		},
+		"12": {
+			{FileId: "121", FileName: "a.txt", FileSize: 10},
+			{FileId: "122", FileName: "草稿", IsFolder: true},
+		},
+		"122": {
+			{FileId: "1221", FileName: "b.txt", FileSize: 1},
+		},
+	}
+	root := &cloudpan.AppFileEntity{FileId: "1", FileName: "我的资源", Path: "/我的资源", IsFolder: true}
+	return root, func(folder *cloudpan.AppFileEntity) (cloudpan.AppFileList, error) {
+		return children[folder.FileId], nil
+	}
+}
+
+func TestRenderTree(t *testing.T) {
+	root, list := newTestTreeListFunc()
+	buf := &bytes.Buffer{}
+	stat, err := renderTree(buf, root, 0, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `/我的资源
+├── 1.mp4
+├── 文档/
+│   ├── a.txt
+│   └── 草稿/
+│       └── b.txt
+└── 2.mp4
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+	if stat.dirs != 2 || stat.files != 4 || stat.size != 311 {
+		t.Errorf("unexpected statistic: %+v", stat)
+	}
+}
+
+func TestRenderTreeDepth(t *testing.T) {
+	root, list := newTestTreeListFunc()
+	buf := &bytes.Buffer{}
+	stat, err := renderTree(buf, root, 1, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `/我的资源
+├── 1.mp4
+├── 文档/
+└── 2.mp4
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+	if stat.dirs != 1 || stat.files != 2 {
+		t.Errorf("unexpected statistic: %+v", stat)
+	}
+}
+
+func TestBuildTreeNode(t *testing.T) {
+	root, list := newTestTreeListFunc()
+	node, _, err := buildTreeNode(root, 2, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed := &treeNode{}
+	if err = json.Unmarshal(data, parsed); err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Children) != 3 || parsed.Children[1].Path != "/我的资源/文档" {
+		t.Fatalf("unexpected tree: %s", data)
+	}
+	// 深度为2, 草稿 目录的内容不会被列出
+	draft := parsed.Children[1].Children[1]
+	if draft.Name != "草稿" || !draft.IsFolder || len(draft.Children) != 0 {
+		t.Errorf("unexpected tree: %s", data)
+	}
+}
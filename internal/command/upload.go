@@ -14,8 +14,12 @@
 package command
 
 import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/phpc0de/ctpango/cmder"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
@@ -39,6 +43,7 @@ import (
 	"github.com/phpc0de/ctpango/internal/functions/panupload"
 	"github.com/phpc0de/ctpango/internal/localfile"
 	"github.com/phpc0de/ctpango/internal/taskframework"
+	"github.com/phpc0de/ctpango/library/crypto"
 	"github.com/phpc0de/ctlibgo/converter"
 )
 
@@ -52,19 +57,34 @@ const (
 type (
 	// UploadOptions 上传可选项
 	UploadOptions struct {
-		AllParallel   int // 所有文件并发上传数量，即可以同时并发上传多少个文件
-		Parallel      int // 单个文件并发上传数量
-		MaxRetry      int
-		NoRapidUpload bool
-		NoSplitFile   bool // 禁用分片上传
-		ShowProgress  bool
-		IsOverwrite   bool // 覆盖已存在的文件，如果同名文件已存在则移到回收站里
-		FamilyId      int64
-		ExcludeNames []string // 排除的文件名，包括文件夹和文件。即这些文件/文件夹不进行上传，支持正则表达式
+		AllParallel      int // 所有文件并发上传数量，即可以同时并发上传多少个文件
+		Parallel         int // 单个文件并发上传数量
+		MaxRetry         int
+		NoRapidUpload    bool
+		UploadMode       string // 上传模式: auto, rapid, multipart
+		NoSplitFile      bool   // 禁用分片上传
+		ShowProgress     bool
+		IsOverwrite      bool // 覆盖已存在的文件，如果同名文件已存在则移到回收站里
+		FamilyId         int64
+		ExcludeNames     []string                   // 排除的文件名，包括文件夹和文件。即这些文件/文件夹不进行上传，支持正则表达式
+		ExcludeHidden    bool                       // 排除 . 开头的文件和文件夹
+		ExcludeSystem    bool                       // 排除操作系统生成的元数据文件, 见 systemFileNames
+		SkipIfUploading  bool                       // 跳过存在未完成上传记录的文件
+		LocalTreeFirst   bool                       // 上传前先列出所有本地文件并统计总大小, 确认后再上传
+		EncryptKey       []byte                     // 不为空时, 使用 AES-256-GCM 加密文件后再上传, 网盘文件名会加上 .enc 后缀
+		FlatCloudDir     bool                       // 所有文件直接上传到目标目录, 不保留本地的子目录结构
+		ConflictStrategy panupload.ConflictStrategy // 网盘中已存在同名文件时的处理策略, 为空时使用 IsOverwrite
+		OnlyNewer        bool                       // 网盘中已存在同名文件时, 只有本地文件的修改时间更新才上传并覆盖
+		Tags             map[string]string          // 不为空时, 上传成功后把标签保存到网盘中的附属文件 <文件名>.meta.json
+	}
+
+	// flatCloudNamer 平铺上传时分配网盘中的文件名, 文件名冲突时使用相对路径作为文件名
+	flatCloudNamer struct {
+		used map[string]bool
 	}
 )
 
-var UploadFlags = []cli.Flag{
+var UploadFlags = append([]cli.Flag{
 	cli.IntFlag{
 		Name:  "p",
 		Usage: "本次操作文件上传并发数量，即可以同时并发上传多少个文件。0代表跟从配置文件设置",
@@ -88,15 +108,44 @@ var UploadFlags = []cli.Flag{
 		Usage: "不检测秒传",
 	},
 	cli.StringFlag{
-		Name:  "familyId",
-		Usage: "家庭云ID",
-		Value: "",
+		Name:  "upload-mode",
+		Usage: "上传模式, auto: 先检测秒传, 秒传失败再正常上传; rapid: 只使用秒传, 网盘中不存在该文件则上传失败, 不消耗上传流量; multipart: 不检测秒传, 直接正常上传",
+		Value: panupload.UploadModeAuto,
 	},
 	cli.StringSliceFlag{
 		Name:  "exn",
 		Usage: "exclude name，指定排除的文件夹或者文件的名称，只支持正则表达式。支持同时排除多个名称，每一个名称就是一个exn参数",
 		Value: nil,
 	},
+	cli.BoolFlag{
+		Name:  "exclude-hidden",
+		Usage: "排除 . 开头的文件和文件夹, 例如 .git, .DS_Store, .env",
+	},
+	cli.BoolFlag{
+		Name:  "exclude-system",
+		Usage: "排除操作系统生成的元数据文件和文件夹, 例如 Thumbs.db, desktop.ini, .DS_Store, $RECYCLE.BIN",
+	},
+}, FamilyFlags...)
+
+// systemFileNames 操作系统生成的元数据文件和文件夹, 不区分大小写
+var systemFileNames = map[string]bool{
+	"thumbs.db":                 true,
+	"ehthumbs.db":               true,
+	"ehthumbs_vista.db":         true,
+	"desktop.ini":               true,
+	"$recycle.bin":              true,
+	"system volume information": true,
+	".ds_store":                 true,
+	".appledouble":              true,
+	".localized":                true,
+	".spotlight-v100":           true,
+	".trashes":                  true,
+	".fseventsd":                true,
+	".temporaryitems":           true,
+	"__macosx":                  true,
+	"icon\r":                    true,
+	"@eadir":                    true,
+	".directory":                true,
 }
 
 func CmdUpload() cli.Command {
@@ -134,6 +183,47 @@ func CmdUpload() cli.Command {
     8. 将本地的 C:\Users\Administrator\Video 整个目录上传到网盘 /视频 目录，但是排除所有的 @eadir 文件夹
     cloudpan189-go upload -exn "^@eadir$" C:/Users/Administrator/Video /视频
 
+    9. 只使用秒传上传 1.mp4，网盘中不存在该文件则上传失败，可用于确认文件之前是否已经上传过
+    cloudpan189-go upload -upload-mode rapid 1.mp4 /视频
+
+    10. 使用密钥文件 my.key 加密后上传 1.mp4，网盘中保存为 /视频/1.mp4.enc，下载时使用 download -download-decrypt my.key 解密
+    密钥文件内容为32字节的密钥, 或64位的十六进制字符串, 可以使用 openssl rand -hex 32 > my.key 生成
+    cloudpan189-go upload -upload-encrypt my.key 1.mp4 /视频
+
+    11. 上传 C:/Users/Administrator/Video 目录, 跳过其他上传进程正在上传(存在未完成上传记录)的文件
+    cloudpan189-go upload -skip-if-uploading C:/Users/Administrator/Video /视频
+
+    12. 上传前先列出 C:/Users/Administrator/Video 目录中的所有文件和总大小, 确认后再上传
+    cloudpan189-go upload -local-tree-first C:/Users/Administrator/Video /视频
+
+    13. 将 C:/Users/Administrator/Video 目录中所有子目录的文件直接上传到网盘 /视频 目录, 不保留子目录结构,
+    文件名冲突时使用相对路径作为文件名, 例如 dir1/file.txt 和 dir2/file.txt 分别保存为 file.txt 和 dir2_file.txt
+    cloudpan189-go upload -flat-cloud-dir C:/Users/Administrator/Video /视频
+
+    14. 上传 1.mp4 到网盘 /视频 目录, 如果已存在同名文件则保存为 1_1.mp4, 1_2.mp4 ...
+    cloudpan189-go upload -on-conflict rename-with-sequence 1.mp4 /视频
+
+    15. 只计算 C:/Users/Administrator/Video 目录中所有文件的MD5并保存到 md5.txt, 不上传文件
+    cloudpan189-go upload -upload-hash-only C:/Users/Administrator/Video > md5.txt
+
+    16. 上传 C:/Users/Administrator/Project 目录, 排除 .git, .env 等 . 开头的文件和文件夹, 以及 Thumbs.db, desktop.ini 等系统文件
+    cloudpan189-go upload -exclude-hidden -exclude-system C:/Users/Administrator/Project /备份
+
+    17. 增量备份 C:/Users/Administrator/Project 目录, 只上传网盘中不存在的文件, 以及修改时间比网盘中的文件新的文件
+    cloudpan189-go upload -upload-only-newer C:/Users/Administrator/Project /备份
+
+    18. 从标准输入读取数据, 上传到网盘 /备份 目录并保存为 db.sql.gz, 此时只需要指定网盘目录
+    mysqldump mydb | gzip | cloudpan189-go upload -from-stdin -stdin-name db.sql.gz /备份
+
+    19. 同上, 并指定数据的大小, 接收到的数据大小不一致时不上传
+    cat 1.mp4 | cloudpan189-go upload -from-stdin -stdin-name 1.mp4 -size 1048576 /视频
+
+    20. 上传 1.mp4 到网盘 /视频 目录, 并添加标签 project=demo 和 owner=alice, 标签保存在 /视频/1.mp4.meta.json, 使用 gettags 命令查看
+    cloudpan189-go upload -upload-tags project=demo,owner=alice 1.mp4 /视频
+
+    21. 依次使用所有已登录的账号, 上传 1.mp4 到各个账号的网盘 /视频 目录, 完成后恢复当前账号
+    cloudpan189-go upload -all-users 1.mp4 /视频
+
   参考：
     以下是典型的排除特定文件或者文件夹的例子，注意：参数值必须是正则表达式。在正则表达式中，^表示匹配开头，$表示匹配结尾。
     1)排除@eadir文件或者文件夹：-exn "^@eadir$"
@@ -144,26 +234,153 @@ func CmdUpload() cli.Command {
 		Category: "天翼云盘",
 		Before:   cmder.ReloadConfigFunc,
 		Action: func(c *cli.Context) error {
+			if c.Bool("upload-hash-only") && c.NArg() >= 1 {
+				RunUploadHashOnly(c.Args(), &UploadOptions{
+					ExcludeNames:  c.StringSlice("exn"),
+					ExcludeHidden: c.Bool("exclude-hidden"),
+					ExcludeSystem: c.Bool("exclude-system"),
+				})
+				return nil
+			}
+			var tags map[string]string
+			if c.IsSet("upload-tags") {
+				t, err := panupload.ParseTags(c.String("upload-tags"))
+				if err != nil {
+					fmt.Println(err)
+					return nil
+				}
+				tags = t
+			}
+
+			if c.Bool("from-stdin") {
+				if c.Bool("all-users") {
+					fmt.Println("从标准输入上传时, 不支持 all-users 参数")
+					return nil
+				}
+				if c.NArg() != 1 || c.String("stdin-name") == "" {
+					fmt.Println("从标准输入上传时, 需要指定 stdin-name 参数和唯一的网盘目录")
+					return nil
+				}
+				familyId, err := parseFamilyId(c)
+				if err != nil {
+					fmt.Println(err)
+					return nil
+				}
+				RunUploadFromStdin(familyId, c.Args().Get(0), c.String("stdin-name"), c.Int64("size"), &UploadOptions{
+					MaxRetry:      c.Int("retry"),
+					NoRapidUpload: c.Bool("norapid"),
+					UploadMode:    c.String("upload-mode"),
+					NoSplitFile:   true,
+					ShowProgress:  !c.Bool("np"),
+					IsOverwrite:   c.Bool("ow"),
+					Tags:          tags,
+				})
+				return nil
+			}
 			if c.NArg() < 2 {
 				cli.ShowCommandHelp(c, c.Command.Name)
 				return nil
 			}
 
+			var encryptKey []byte
+			if c.IsSet("upload-encrypt") {
+				key, err := crypto.LoadGCMKeyFile(c.String("upload-encrypt"))
+				if err != nil {
+					fmt.Printf("读取加密密钥文件错误: %s\n", err)
+					return nil
+				}
+				encryptKey = key
+			}
+
+			var conflictStrategy panupload.ConflictStrategy
+			if c.IsSet("on-conflict") {
+				cs, err := panupload.ParseConflictStrategy(c.String("on-conflict"))
+				if err != nil {
+					fmt.Println(err)
+					return nil
+				}
+				conflictStrategy = cs
+			}
+
+			if err := checkAllUsersFamilyFlags(c); err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
 			subArgs := c.Args()
-			RunUpload(subArgs[:c.NArg()-1], subArgs[c.NArg()-1], &UploadOptions{
-				AllParallel:   c.Int("p"),
-				Parallel:      1, // 天翼云盘一个文件只支持单线程上传
-				MaxRetry:      c.Int("retry"),
-				NoRapidUpload: c.Bool("norapid"),
-				NoSplitFile:   true, // 天翼云盘不支持分片并发上传，只支持单线程上传，支持断点续传
-				ShowProgress:  !c.Bool("np"),
-				IsOverwrite:   c.Bool("ow"),
-				FamilyId:      parseFamilyId(c),
-				ExcludeNames: c.StringSlice("exn"),
-			})
+			uo := &UploadOptions{
+				AllParallel:      c.Int("p"),
+				Parallel:         1, // 天翼云盘一个文件只支持单线程上传
+				MaxRetry:         c.Int("retry"),
+				NoRapidUpload:    c.Bool("norapid"),
+				UploadMode:       c.String("upload-mode"),
+				NoSplitFile:      true, // 天翼云盘不支持分片并发上传，只支持单线程上传，支持断点续传
+				ShowProgress:     !c.Bool("np"),
+				IsOverwrite:      c.Bool("ow"),
+				FamilyId:         familyId,
+				ExcludeNames:     c.StringSlice("exn"),
+				ExcludeHidden:    c.Bool("exclude-hidden"),
+				ExcludeSystem:    c.Bool("exclude-system"),
+				SkipIfUploading:  c.Bool("skip-if-uploading"),
+				LocalTreeFirst:   c.Bool("local-tree-first"),
+				EncryptKey:       encryptKey,
+				FlatCloudDir:     c.Bool("flat-cloud-dir"),
+				ConflictStrategy: conflictStrategy,
+				OnlyNewer:        c.Bool("upload-only-newer"),
+				Tags:             tags,
+			}
+			if c.Bool("all-users") {
+				err := RunForAllUsers(activeUserOp(func(familyId int64) error {
+					o := *uo
+					o.FamilyId = familyId
+					return RunUpload(subArgs[:c.NArg()-1], subArgs[c.NArg()-1], &o)
+				}))
+				if err != nil {
+					fmt.Println(err)
+				}
+				return nil
+			}
+			RunUpload(subArgs[:c.NArg()-1], subArgs[c.NArg()-1], uo)
 			return nil
 		},
-		Flags: UploadFlags,
+		Flags: append(UploadFlags, AllUsersFlag, cli.BoolFlag{
+			Name:  "local-tree-first",
+			Usage: "上传前先列出所有要上传的本地文件, 统计文件数量和总大小, 确认后再上传",
+		}, cli.BoolFlag{
+			Name:  "skip-if-uploading",
+			Usage: "跳过存在未完成上传记录的文件, 避免多个上传进程同时上传同一个文件, 注意: 需要断点续传的文件也会被跳过",
+		}, cli.BoolFlag{
+			Name:  "flat-cloud-dir",
+			Usage: "所有文件直接上传到目标目录, 不保留本地的子目录结构, 文件名冲突时使用相对路径作为文件名, 如 dir2_file.txt",
+		}, cli.BoolFlag{
+			Name:  "upload-hash-only",
+			Usage: "只计算并输出本地文件的MD5, 格式为 <md5>\t<本地路径>, 不上传文件也不访问网盘, 此时可以不指定网盘目录",
+		}, cli.StringFlag{
+			Name:  "on-conflict",
+			Usage: "网盘中已存在同名文件时的处理策略: skip 跳过, overwrite 覆盖(同 ow), rename-with-timestamp 文件名加上时间戳, rename-with-sequence 文件名加上序号 _1, _2...",
+		}, cli.BoolFlag{
+			Name:  "upload-only-newer",
+			Usage: "网盘中已存在同名文件时, 只有本地文件的修改时间比网盘文件新才上传, 并覆盖网盘文件(on-conflict 未指定时), 用于增量备份",
+		}, cli.StringFlag{
+			Name:  "upload-encrypt",
+			Usage: "从指定的密钥文件读取32字节密钥, 使用 AES-256-GCM 加密文件后再上传, 网盘文件名会加上 .enc 后缀",
+		}, cli.BoolFlag{
+			Name:  "from-stdin",
+			Usage: "从标准输入读取数据并上传, 需要同时指定 stdin-name 参数, 此时只需要指定网盘目录",
+		}, cli.StringFlag{
+			Name:  "stdin-name",
+			Usage: "从标准输入上传时, 保存到网盘的文件名",
+		}, cli.Int64Flag{
+			Name:  "size",
+			Usage: "从标准输入上传时, 数据的大小(字节), 接收到的数据大小不一致时不上传",
+		}, cli.StringFlag{
+			Name:  "upload-tags",
+			Usage: "给上传的文件添加标签, 格式为 key1=val1,key2=val2, 天翼云盘不支持自定义元数据, 标签以 JSON 格式保存到网盘中的附属文件 <文件名>.meta.json",
+		}),
 	}
 }
 
@@ -190,10 +407,15 @@ func CmdRapidUpload() cli.Command {
 				return nil
 			}
 
-			RunRapidUpload(parseFamilyId(c), c.Bool("ow"), c.Args().Get(0), c.String("md5"), c.Int64("size"))
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			RunRapidUpload(familyId, c.Bool("ow"), c.Args().Get(0), c.String("md5"), c.Int64("size"))
 			return nil
 		},
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			cli.StringFlag{
 				Name:     "md5",
 				Usage:    "文件的 md5 值",
@@ -208,17 +430,19 @@ func CmdRapidUpload() cli.Command {
 				Name:  "ow",
 				Usage: "overwrite, 覆盖已存在的文件",
 			},
-			cli.StringFlag{
-				Name:  "familyId",
-				Usage: "家庭云ID",
-				Value: "",
-			},
-		},
+		}, FamilyFlags...),
 	}
 }
 
-// RunUpload 执行文件上传
-func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
+func uploadPrintFormat(load int) string {
+	if load <= 1 {
+		return panupload.DefaultPrintFormat
+	}
+	return "\r[%s] %s↑ %s/%s %s/s in %s, left %s ..."
+}
+
+// RunUpload 执行文件上传, 有文件上传失败或无法开始上传时返回错误
+func RunUpload(localPaths []string, savePath string, opt *UploadOptions) error {
 	activeUser := GetActiveUser()
 	if opt == nil {
 		opt = &UploadOptions{}
@@ -236,6 +460,26 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 		opt.MaxRetry = DefaultUploadMaxRetry
 	}
 
+	opt.UploadMode = strings.ToLower(opt.UploadMode)
+	if opt.UploadMode == "" {
+		opt.UploadMode = panupload.UploadModeAuto
+	}
+	if !panupload.IsUploadModeSupported(opt.UploadMode) {
+		err := fmt.Errorf("不支持的上传模式: %s, 可选值: auto, rapid, multipart", opt.UploadMode)
+		fmt.Println(err)
+		return err
+	}
+	switch opt.UploadMode {
+	case panupload.UploadModeRapid:
+		if opt.NoRapidUpload {
+			err := errors.New("上传模式为 rapid 时不能同时指定 norapid 参数")
+			fmt.Println(err)
+			return err
+		}
+	case panupload.UploadModeMultipart:
+		opt.NoRapidUpload = true
+	}
+
 	savePath = activeUser.PathJoin(opt.FamilyId, savePath)
 	_, err1 := activeUser.PanClient().AppFileInfoByPath(opt.FamilyId, savePath)
 	if err1 != nil {
@@ -245,17 +489,28 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 	switch len(localPaths) {
 	case 0:
 		fmt.Printf("本地路径为空\n")
-		return
+		return errors.New("本地路径为空")
+	}
+
+	if opt.LocalTreeFirst && !confirmLocalTree(localPaths, opt) {
+		fmt.Printf("上传取消.\n")
+		return nil
 	}
 
 	// 打开上传状态
 	uploadDatabase, err := panupload.NewUploadingDatabase()
 	if err != nil {
 		fmt.Printf("打开上传未完成数据库错误: %s\n", err)
-		return
+		return err
 	}
 	defer uploadDatabase.Close()
 
+	// 在开始上传之前记录未完成上传的文件, 上传过程中数据库会被修改
+	var uploadingPaths panupload.UploadingPathSet
+	if opt.SkipIfUploading {
+		uploadingPaths = uploadDatabase.UploadingPathSet()
+	}
+
 	var (
 		// 使用 task framework
 		executor = &taskframework.TaskExecutor{
@@ -263,8 +518,10 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 		}
 		// 统计
 		statistic = &panupload.UploadStatistic{}
+		webhook   = newWebhook()
 
 		folderCreateMutex = &sync.Mutex{}
+		flatNamer         = newFlatCloudNamer()
 	)
 	executor.SetParallel(opt.AllParallel)
 
@@ -274,6 +531,7 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 
 	// 启动上传任务
 	Done := make(chan struct{})
+	failedCount := 0
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -292,11 +550,12 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 			}
 		}
 		fmt.Printf("\n")
-		fmt.Printf("上传结束, 时间: %s, 总大小: %s\n", statistic.Elapsed()/1e6*1e6, converter.ConvertFileSize(statistic.TotalSize()))
+		fmt.Printf("上传结束, 时间: %s, 总大小: %s, 平均速度: %s/s\n", statistic.Elapsed()/1e6*1e6, converter.ConvertFileSize(statistic.TotalSize()), converter.ConvertFileSize(statistic.AverageSpeed(), 2))
 
 		// 输出上传失败的文件列表
 		for _, failed := range failedList {
 			if failed.Size() != 0 {
+				failedCount += failed.Size()
 				fmt.Printf("以下文件上传失败: \n")
 				tb := cmdtable.NewTable(os.Stdout)
 				for e := failed.Shift(); e != nil; e = failed.Shift() {
@@ -362,14 +621,40 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 				return err
 			}
 
+			if !fi.IsDir() && uploadingPaths.Contains(file) {
+				fmt.Printf("[SKIP] 上传中的文件已存在，跳过: %s\n", file)
+				return nil
+			}
+
+			// 平铺上传时不创建子目录
+			if opt.FlatCloudDir && fi.IsDir() {
+				if strings.HasPrefix(fi.Name(), ".ecloud") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
 			subSavePath := strings.TrimPrefix(file, localPathDir)
+			if opt.FlatCloudDir {
+				subSavePath = strings.TrimPrefix(file, curPath)
+				if subSavePath == "" {
+					// 上传的是单个文件
+					subSavePath = fi.Name()
+				}
+			}
 
 			// 针对 windows 的目录处理
 			if os.PathSeparator == '\\' {
 				subSavePath = cmdutil.ConvertToUnixPathSeparator(subSavePath)
 			}
 
+			if opt.FlatCloudDir {
+				subSavePath = flatNamer.Name(subSavePath)
+			}
 			subSavePath = path.Clean(savePath + cloudpan.PathSeparator + subSavePath)
+			if len(opt.EncryptKey) > 0 && !fi.IsDir() {
+				subSavePath += crypto.GCMEncryptedSuffix
+			}
 			var ufm *panupload.UploadedFileMeta
 
 			if db != nil {
@@ -415,10 +700,17 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 				FolderCreateMutex: folderCreateMutex,
 				Parallel:          opt.Parallel,
 				NoRapidUpload:     opt.NoRapidUpload,
+				UploadMode:        opt.UploadMode,
 				NoSplitFile:       opt.NoSplitFile,
+				EncryptKey:        opt.EncryptKey,
 				UploadStatistic:   statistic,
+				Webhook:           webhook,
 				ShowProgress:      opt.ShowProgress,
+				PrintFormat:       uploadPrintFormat(opt.AllParallel),
 				IsOverwrite:       opt.IsOverwrite,
+				ConflictStrategy:  opt.ConflictStrategy,
+				OnlyNewer:         opt.OnlyNewer,
+				Tags:              opt.Tags,
 				FolderSyncDb:      db,
 			}, opt.MaxRetry)
 
@@ -432,18 +724,197 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 	time.Sleep(500 * time.Millisecond)
 	close(Done)
 	wg.Wait()
+	webhook.Wait()
+	if failedCount > 0 {
+		return fmt.Errorf("%d 个文件上传失败", failedCount)
+	}
+	return nil
+}
+
+// RunUploadFromStdin 从标准输入读取数据, 上传到网盘目录 cloudPath 并保存为 fileName.
+// 秒传和创建上传任务都需要预先知道文件的MD5, 所以数据会先写入临时文件, 接收的同时计算MD5,
+// 接收完成后再使用正常的上传流程上传. size 大于 0 时, 接收到的数据大小必须与 size 一致
+func RunUploadFromStdin(familyId int64, cloudPath string, fileName string, size int64, opt *UploadOptions) {
+	if opt == nil {
+		opt = &UploadOptions{}
+	}
+	opt.FamilyId = familyId
+	opt.FlatCloudDir = false
+	opt.LocalTreeFirst = false
+
+	tmpDir, err := ioutil.TempDir("", "cloudpan189-stdin")
+	if err != nil {
+		fmt.Printf("创建临时目录错误: %s\n", err)
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpFile, md5Str, n, err := receiveStdinFile(os.Stdin, tmpDir, fileName, size)
+	if err != nil {
+		fmt.Printf("读取标准输入错误: %s\n", err)
+		return
+	}
+	fmt.Printf("已接收标准输入数据: %s, MD5: %s\n", converter.ConvertFileSize(n, 2), md5Str)
+
+	RunUpload([]string{tmpFile}, cloudPath, opt)
+}
+
+// receiveStdinFile 把 r 中的数据写入 dir 目录下名为 fileName 的文件, 返回文件路径, 数据的MD5和大小
+func receiveStdinFile(r io.Reader, dir, fileName string, size int64) (filePath, md5Str string, n int64, err error) {
+	if fileName == "" || strings.ContainsAny(fileName, "/\\") || fileName == "." || fileName == ".." {
+		return "", "", 0, fmt.Errorf("文件名不合法: %s", fileName)
+	}
+
+	filePath = filepath.Join(dir, fileName)
+	f, err := os.Create(filePath)
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	n, err = io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		return "", "", n, err
+	}
+	if size > 0 && n != size {
+		return "", "", n, fmt.Errorf("接收到的数据大小 %d 与指定的大小 %d 不一致", n, size)
+	}
+	return filePath, hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func newFlatCloudNamer() *flatCloudNamer {
+	return &flatCloudNamer{used: map[string]bool{}}
+}
+
+// Name 返回文件在网盘目标目录中的文件名, relPath 为文件相对于上传目录的路径, 使用 / 分隔.
+// 文件名未被使用时直接使用原文件名, 否则使用以 _ 连接的相对路径, 仍然冲突时再加上序号
+func (n *flatCloudNamer) Name(relPath string) string {
+	relPath = strings.Trim(path.Clean("/"+relPath), "/")
+	name := path.Base(relPath)
+	if n.used[name] {
+		name = strings.ReplaceAll(relPath, "/", "_")
+		ext := path.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		for i := 1; n.used[name]; i++ {
+			name = fmt.Sprintf("%s_%d%s", base, i, ext)
+		}
+	}
+	n.used[name] = true
+	return name
+}
+
+// localTreeSummary 要上传的本地文件统计
+type localTreeSummary struct {
+	files     int
+	dirs      int
+	excluded  int
+	totalSize int64
+}
+
+// summarizeLocalFiles 按上传时相同的规则遍历本地文件, 统计文件数量和总大小, fn 不为空时每个文件调用一次
+func summarizeLocalFiles(localPaths []string, opt *UploadOptions, fn func(file string, fi os.FileInfo)) *localTreeSummary {
+	summary := &localTreeSummary{}
+	var walkFunc filepath.WalkFunc
+	walkFunc = func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if isExcludeFile(file, opt) {
+			summary.excluded++
+			return filepath.SkipDir
+		}
+		if fi.Mode()&os.ModeSymlink != 0 { // 读取 symbol link
+			return WalkAllFile(file+string(os.PathSeparator), walkFunc)
+		}
+		if fi.IsDir() {
+			if strings.HasPrefix(fi.Name(), ".ecloud") {
+				return filepath.SkipDir
+			}
+			summary.dirs++
+			return nil
+		}
+		summary.files++
+		summary.totalSize += fi.Size()
+		if fn != nil {
+			fn(file, fi)
+		}
+		return nil
+	}
+
+	for _, curPath := range localPaths {
+		curPath = filepath.Clean(curPath)
+		if isExcludeFile(curPath, opt) {
+			summary.excluded++
+			continue
+		}
+		if err := WalkAllFile(curPath, walkFunc); err != nil {
+			fmt.Printf("警告: 遍历错误: %s\n", err)
+		}
+	}
+	return summary
+}
+
+// confirmLocalTree 列出所有要上传的本地文件和总大小, 返回用户是否确认上传
+func confirmLocalTree(localPaths []string, opt *UploadOptions) bool {
+	fmt.Printf("要上传的本地文件:\n")
+	summary := summarizeLocalFiles(localPaths, opt, func(file string, fi os.FileInfo) {
+		fmt.Printf("  %10s  %s\n", converter.ConvertFileSize(fi.Size(), 2), file)
+	})
+	fmt.Printf("\n共 %d 个文件, %d 个目录, 总大小: %s", summary.files, summary.dirs, converter.ConvertFileSize(summary.totalSize, 2))
+	if summary.excluded > 0 {
+		fmt.Printf(", 排除 %d 项", summary.excluded)
+	}
+	fmt.Printf("\n")
+	if summary.files == 0 {
+		return false
+	}
+
+	var confirm string
+	fmt.Printf("确认上传? (y/n) > ")
+	_, err := fmt.Scanln(&confirm)
+	return err == nil && (confirm == "y" || confirm == "Y")
+}
+
+// RunUploadHashOnly 按上传时相同的规则遍历本地文件, 计算并输出每个文件的MD5, 不上传文件
+func RunUploadHashOnly(localPaths []string, opt *UploadOptions) {
+	failed := 0
+	summarizeLocalFiles(localPaths, opt, func(file string, fi os.FileInfo) {
+		lfc, err := localfile.GetFileSum(file, localfile.CHECKSUM_MD5)
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "计算MD5失败: %s, %s\n", file, err)
+			return
+		}
+		fmt.Printf("%s\t%s\n", strings.ToLower(lfc.MD5), file)
+	})
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d 个文件计算MD5失败\n", failed)
+	}
 }
 
 // 是否是排除上传的文件
 func isExcludeFile(filePath string, opt *UploadOptions) bool {
-	if opt == nil || len(opt.ExcludeNames) == 0{
+	if opt == nil {
+		return false
+	}
+	if opt.ExcludeHidden || opt.ExcludeSystem {
+		name := filepath.Base(filePath)
+		if opt.ExcludeHidden && isHiddenFileName(name) {
+			return true
+		}
+		if opt.ExcludeSystem && systemFileNames[strings.ToLower(name)] {
+			return true
+		}
+	}
+	if len(opt.ExcludeNames) == 0 {
 		return false
 	}
 
-	for _,pattern := range opt.ExcludeNames {
+	for _, pattern := range opt.ExcludeNames {
 		fileName := path.Base(filePath)
 
-		m,_ := regexp.MatchString(pattern, fileName)
+		m, _ := regexp.MatchString(pattern, fileName)
 		if m {
 			return true
 		}
@@ -451,6 +922,11 @@ func isExcludeFile(filePath string, opt *UploadOptions) bool {
 	return false
 }
 
+// isHiddenFileName 是否是 . 开头的隐藏文件或文件夹, 不包括 . 和 ..
+func isHiddenFileName(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
+
 func WalkAllFile(dirPath string, walkFn filepath.WalkFunc) error {
 	info, err := os.Lstat(dirPath)
 	if err != nil {
@@ -0,0 +1,203 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSummarizeLocalFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]int{
+		"a.txt":          10,
+		"b.jpg":          20,
+		"sub/c.txt":      30,
+		"sub/deep/d.txt": 40,
+		".ecloud/db":     50, // 备份数据库, 不上传
+		"@eadir/thumb":   60,
+	}
+	for name, size := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err = ioutil.WriteFile(p, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var listed int
+	summary := summarizeLocalFiles([]string{dir}, &UploadOptions{
+		ExcludeNames: []string{`\.jpg$`, "^@eadir$"},
+	}, func(file string, fi os.FileInfo) {
+		listed++
+	})
+	if summary.files != 3 || listed != 3 {
+		t.Fatalf("files: %d, listed: %d", summary.files, listed)
+	}
+	if summary.totalSize != 80 {
+		t.Fatalf("total size: %d", summary.totalSize)
+	}
+	// sub, sub/deep
+	if summary.dirs != 2 {
+		t.Fatalf("dirs: %d", summary.dirs)
+	}
+	if summary.excluded != 2 {
+		t.Fatalf("excluded: %d", summary.excluded)
+	}
+}
+
+func TestSummarizeLocalFilesExcludeHidden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{
+		"a.txt",
+		".env",
+		".git/config",
+		".git/objects/ab/cdef",
+		"sub/.DS_Store",
+		"sub/Thumbs.db",
+		"sub/desktop.ini",
+		"sub/b.txt",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err = ioutil.WriteFile(p, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(opt *UploadOptions) map[string]bool {
+		listed := map[string]bool{}
+		summarizeLocalFiles([]string{dir}, opt, func(file string, fi os.FileInfo) {
+			rel, _ := filepath.Rel(dir, file)
+			listed[filepath.ToSlash(rel)] = true
+		})
+		return listed
+	}
+
+	listed := list(&UploadOptions{ExcludeHidden: true})
+	if len(listed) != 4 || !listed["a.txt"] || !listed["sub/b.txt"] || !listed["sub/Thumbs.db"] || !listed["sub/desktop.ini"] {
+		t.Fatalf("exclude hidden: %v", listed)
+	}
+
+	listed = list(&UploadOptions{ExcludeSystem: true})
+	if len(listed) != 5 || listed["sub/.DS_Store"] || listed["sub/Thumbs.db"] || listed["sub/desktop.ini"] || !listed[".git/config"] {
+		t.Fatalf("exclude system: %v", listed)
+	}
+
+	listed = list(&UploadOptions{ExcludeHidden: true, ExcludeSystem: true})
+	if len(listed) != 2 || !listed["a.txt"] || !listed["sub/b.txt"] {
+		t.Fatalf("exclude hidden and system: %v", listed)
+	}
+
+	// 上传目录本身是 . 时不排除
+	if isExcludeFile(".", &UploadOptions{ExcludeHidden: true}) {
+		t.Fatal(". should not be excluded")
+	}
+}
+
+func TestFlatCloudNamer(t *testing.T) {
+	n := newFlatCloudNamer()
+	cases := []struct {
+		relPath, name string
+	}{
+		{"/dir1/file.txt", "file.txt"},
+		{"/dir2/file.txt", "dir2_file.txt"},
+		{"/a.mp4", "a.mp4"},
+		{"/dir2_file.txt", "dir2_file_1.txt"},
+		{"/dir3/sub/file.txt", "dir3_sub_file.txt"},
+		{"dir2/file.txt", "dir2_file_2.txt"},
+	}
+	for _, c := range cases {
+		if name := n.Name(c.relPath); name != c.name {
+			t.Errorf("%s: got %s, want %s", c.relPath, name, c.name)
+		}
+	}
+}
+
+func TestReceiveStdinFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upload-stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := make([]byte, 300*1024+7)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	sum := md5.Sum(data)
+	want := hex.EncodeToString(sum[:])
+
+	// 使用管道模拟标准输入, 分多次写入
+	pr, pw := io.Pipe()
+	go func() {
+		for off := 0; off < len(data); off += 4096 {
+			end := off + 4096
+			if end > len(data) {
+				end = len(data)
+			}
+			pw.Write(data[off:end])
+		}
+		pw.Close()
+	}()
+
+	filePath, md5Str, n, err := receiveStdinFile(pr, dir, "db.sql.gz", int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filePath != filepath.Join(dir, "db.sql.gz") {
+		t.Errorf("file path: got %s", filePath)
+	}
+	if md5Str != want {
+		t.Errorf("md5: got %s, want %s", md5Str, want)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("size: got %d, want %d", n, len(data))
+	}
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, data) {
+		t.Errorf("content mismatch")
+	}
+
+	// 大小与指定的不一致
+	if _, _, _, err := receiveStdinFile(bytes.NewReader(data), dir, "a.bin", int64(len(data))+1); err == nil {
+		t.Errorf("expected size mismatch error")
+	}
+
+	// 不合法的文件名
+	for _, name := range []string{"", ".", "..", "a/b", "..\\b"} {
+		if _, _, _, err := receiveStdinFile(bytes.NewReader(data), dir, name, 0); err == nil {
+			t.Errorf("%q: expected invalid name error", name)
+		}
+	}
+}
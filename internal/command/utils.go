@@ -17,6 +17,7 @@ import (
 	"fmt"
 	"github.com/phpc0de/ctapi/cloudpan"
 	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/phpc0de/ctpango/internal/functions"
 	"github.com/phpc0de/ctlibgo/logger"
 	"path"
 )
@@ -81,4 +82,18 @@ func GetFamilyCloudMark(familyId int64) string {
 		return "家庭云"
 	}
 	return "个人云"
-}
\ No newline at end of file
+}
+
+// newWebhook 根据配置返回任务完成时调用的 webhook, 未设置 webhook_url 时返回 nil
+func newWebhook() *functions.Webhook {
+	if config.Config.WebhookURL == "" {
+		return nil
+	}
+	client := config.Config.HTTPClient("")
+	return &functions.Webhook{
+		URL:       config.Config.WebhookURL,
+		OnSuccess: config.Config.WebhookOnSuccess,
+		OnFailure: config.Config.WebhookOnFailure,
+		Client:    client,
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/phpc0de/ctpango/internal/config"
+)
+
+func TestNewWebhookVerifiesTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	webhookURL, skipVerify := config.Config.WebhookURL, config.Config.TLSSkipVerify
+	defer func() {
+		config.Config.WebhookURL, config.Config.TLSSkipVerify = webhookURL, skipVerify
+	}()
+	config.Config.WebhookURL = server.URL
+
+	// 自签名证书校验失败
+	config.Config.TLSSkipVerify = false
+	if _, err := newWebhook().Client.Req(http.MethodPost, server.URL, nil, nil); err == nil {
+		t.Fatal("self-signed certificate accepted")
+	}
+
+	config.Config.TLSSkipVerify = true
+	resp, err := newWebhook().Client.Req(http.MethodPost, server.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
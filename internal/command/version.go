@@ -0,0 +1,90 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"github.com/phpc0de/ctlibgo/checkaccess"
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/cmder/cmdutil"
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/urfave/cli"
+	"io"
+	"os"
+	"runtime"
+)
+
+type (
+	// VersionInfo 程序的构建信息
+	VersionInfo struct {
+		Version       string
+		Commit        string
+		BuildDate     string
+		GoVersion     string
+		Platform      string
+		ExecutableDir string
+		Writable      bool // 程序所在目录是否可写, 不可写时无法使用 update 命令更新
+	}
+)
+
+func CmdVersion() cli.Command {
+	return cli.Command{
+		Name:      "version",
+		Usage:     "显示程序的版本和构建信息",
+		UsageText: cmder.App().Name + " version",
+		Description: `
+	显示程序的版本, 构建时的 git commit, 构建日期, Go 版本, 系统架构,
+	以及程序所在目录是否可写 (不可写时无法使用 update 命令更新), 提交问题反馈时请附上这些信息.
+
+	示例:
+
+	cloudpan189-go version
+`,
+		Category: "其他",
+		Action: func(c *cli.Context) error {
+			RunVersion(os.Stdout)
+			return nil
+		},
+	}
+}
+
+// GetVersionInfo 获取程序的构建信息
+func GetVersionInfo() *VersionInfo {
+	executableDir := cmdutil.ExecutablePath()
+	return &VersionInfo{
+		Version:       config.AppVersion,
+		Commit:        config.BuildCommit,
+		BuildDate:     config.BuildDate,
+		GoVersion:     runtime.Version(),
+		Platform:      runtime.GOOS + "/" + runtime.GOARCH,
+		ExecutableDir: executableDir,
+		Writable:      checkaccess.AccessRDWR(executableDir),
+	}
+}
+
+// RunVersion 输出程序的构建信息
+func RunVersion(w io.Writer) {
+	info := GetVersionInfo()
+	writable := "是"
+	if !info.Writable {
+		writable = "否, 无法使用 update 命令更新"
+	}
+	fmt.Fprintf(w, "版本: %s\n", info.Version)
+	fmt.Fprintf(w, "Git提交: %s\n", info.Commit)
+	fmt.Fprintf(w, "构建日期: %s\n", info.BuildDate)
+	fmt.Fprintf(w, "Go版本: %s\n", info.GoVersion)
+	fmt.Fprintf(w, "系统架构: %s\n", info.Platform)
+	fmt.Fprintf(w, "程序目录: %s\n", info.ExecutableDir)
+	fmt.Fprintf(w, "程序目录可写: %s\n", writable)
+}
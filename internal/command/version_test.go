@@ -0,0 +1,58 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVersionBuildInfo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip building binary in short mode")
+	}
+	bin := filepath.Join(t.TempDir(), "cloudpan189-go")
+	ldflags := "-X main.Version=v9.9.9" +
+		" -X github.com/phpc0de/ctpango/internal/config.BuildCommit=0123abc" +
+		" -X github.com/phpc0de/ctpango/internal/config.BuildDate=2021-01-02T03:04:05Z"
+	build := exec.Command("go", "build", "-ldflags", ldflags, "-o", bin, "github.com/phpc0de/ctpango")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Skipf("build binary failed: %s, %s", err, out)
+	}
+
+	out, err := exec.Command(bin, "version").CombinedOutput()
+	if err != nil {
+		t.Fatalf("run version: %s, %s", err, out)
+	}
+	fields := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		i := strings.Index(line, ": ")
+		if i < 0 {
+			continue
+		}
+		fields[line[:i]] = line[i+2:]
+	}
+	for _, key := range []string{"版本", "Git提交", "构建日期", "Go版本", "系统架构", "程序目录", "程序目录可写"} {
+		if strings.TrimSpace(fields[key]) == "" {
+			t.Errorf("field %s is empty, output:\n%s", key, out)
+		}
+	}
+	for key, want := range map[string]string{"版本": "v9.9.9", "Git提交": "0123abc", "构建日期": "2021-01-02T03:04:05Z"} {
+		if fields[key] != want {
+			t.Errorf("field %s: got %q, want %q", key, fields[key], want)
+		}
+	}
+}
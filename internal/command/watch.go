@@ -0,0 +1,130 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/phpc0de/ctpango/cmder"
+	"github.com/phpc0de/ctpango/internal/functions/panwatch"
+	"github.com/urfave/cli"
+)
+
+func CmdWatch() cli.Command {
+	return cli.Command{
+		Name:      "watch",
+		Usage:     "监控本地目录的文件变化",
+		UsageText: cmder.App().Name + " watch --log-only [--log-file <日志文件>] <本地目录>",
+		Description: `
+	监控本地目录及其所有子目录, 把文件的创建, 修改, 重命名, 删除和权限变化事件以JSON格式逐行输出,
+	可用于审计目录中哪些文件发生了变化. 按 Ctrl+C 停止监控.
+	目前只支持 --log-only 模式, 只记录事件, 不上传任何文件.
+
+	每个事件输出一行, 格式为:
+	{"time":"2021-03-04T05:06:07+08:00","event":"write","path":"/data/a.txt","size":1024}
+	event 的取值: create, write, rename, delete, chmod. 文件已不存在或者是目录时 size 为0.
+
+	示例:
+
+	监控 /data 目录, 事件输出到标准输出
+	cloudpan189-go watch --log-only /data
+
+	监控 /data 目录, 事件追加写入到 watch.log
+	cloudpan189-go watch --log-only --log-file watch.log /data
+`,
+		Category: "天翼云盘",
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			if !c.Bool("log-only") {
+				fmt.Println("目前只支持 --log-only 模式, 请加上 --log-only 参数")
+				return nil
+			}
+			RunWatchLog(c.Args().Get(0), c.String("log-file"))
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "log-only",
+				Usage: "只以JSON格式记录文件系统事件, 不上传文件",
+			},
+			cli.StringFlag{
+				Name:  "log-file",
+				Usage: "把事件追加写入到指定的文件, 默认输出到标准输出",
+			},
+		},
+	}
+}
+
+// RunWatchLog 监控本地目录, 把文件系统事件以JSON格式写入日志, 直到收到中断信号
+func RunWatchLog(dir, logFile string) {
+	if fi, err := os.Stat(dir); err != nil {
+		fmt.Printf("%s\n", err)
+		return
+	} else if !fi.IsDir() {
+		fmt.Printf("%s 不是目录\n", dir)
+		return
+	}
+
+	var out io.Writer = os.Stdout
+	if logFile != "" {
+		f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Printf("打开日志文件错误: %s\n", err)
+			return
+		}
+		defer f.Close()
+		out = f
+	}
+
+	l, err := panwatch.NewLogger(out)
+	if err != nil {
+		fmt.Printf("创建监控错误: %s\n", err)
+		return
+	}
+	if err = l.AddRecursive(dir); err != nil {
+		l.Close()
+		fmt.Printf("监控目录错误: %s\n", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	go func() {
+		select {
+		case <-sigCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if logFile != "" {
+		fmt.Printf("开始监控 %s, 事件写入 %s, 按 Ctrl+C 停止\n", dir, logFile)
+	} else {
+		fmt.Fprintf(os.Stderr, "开始监控 %s, 按 Ctrl+C 停止\n", dir)
+	}
+	if err = l.Run(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "写入日志错误: %s\n", err)
+	}
+}
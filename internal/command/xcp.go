@@ -62,7 +62,11 @@ func CmdXcp() cli.Command {
 				fmt.Println("未登录账号")
 				return nil
 			}
-			familyId := parseFamilyId(c)
+			familyId, err := parseFamilyId(c)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
 			fileSource := PersonCloud
 			if c.IsSet("source") {
 				sourceStr := c.String("source")
@@ -84,20 +88,14 @@ func CmdXcp() cli.Command {
 			RunXCopy(fileSource, familyId, c.Args()...)
 			return nil
 		},
-		Flags: []cli.Flag{
-			cli.StringFlag{
-				Name:     "familyId",
-				Usage:    "家庭云ID",
-				Value:    "",
-				Required: false,
-			},
+		Flags: append([]cli.Flag{
 			cli.StringFlag{
 				Name:     "source",
 				Usage:    "文件源，person-个人云，family-家庭云",
 				Value:    "",
 				Required: false,
 			},
-		},
+		}, FamilyFlags...),
 	}
 }
 
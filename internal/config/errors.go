@@ -28,4 +28,16 @@ var (
 	ErrConfigFileNoPermission = errors.New("config file permission denied")
 	//ErrConfigContentsParseError 解析Config数据错误
 	ErrConfigContentsParseError = errors.New("config contents parse error")
+	//ErrInvalidWebhookURL webhook URL 不是 http 或 https 地址
+	ErrInvalidWebhookURL = errors.New("webhook url must be an http or https url")
+	//ErrUnknownConfigKey 不支持的配置项名称
+	ErrUnknownConfigKey = errors.New("unknown config key")
+	//ErrNoStoredCredentials 未保存可用于重新登录的账号密码或 sessionKey
+	ErrNoStoredCredentials = errors.New("no stored credentials to refresh token")
+	//ErrTokenRefreshFailed 刷新登录凭证失败
+	ErrTokenRefreshFailed = errors.New("refresh token failed")
+	//ErrImportCanceled 导入配置时未确认覆盖已有的值
+	ErrImportCanceled = errors.New("import config canceled")
+	//ErrImportInvalid 导入的配置检查不通过
+	ErrImportInvalid = errors.New("imported config is invalid")
 )
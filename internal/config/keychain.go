@@ -0,0 +1,132 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/zalando/go-keyring"
+)
+
+const (
+	// KeychainService 登录凭证保存在系统钥匙串中使用的服务名
+	KeychainService = "cloudpan189-go"
+)
+
+var (
+	// 系统钥匙串操作, 测试时可替换
+	keychainSet    = keyring.Set
+	keychainGet    = keyring.Get
+	keychainDelete = keyring.Delete
+)
+
+// keychainCredentials 保存在系统钥匙串中的登录凭证
+type keychainCredentials struct {
+	WebToken cloudpan.WebLoginToken `json:"webToken"`
+	AppToken cloudpan.AppLoginToken `json:"appToken"`
+}
+
+// keychainRef 返回用户登录凭证在系统钥匙串中的引用键
+func keychainRef(uid uint64) string {
+	return "uid-" + strconv.FormatUint(uid, 10)
+}
+
+// storeKeychainCredentials 保存用户登录凭证到系统钥匙串
+func storeKeychainCredentials(ref string, user *PanUser) error {
+	data, err := jsoniter.Marshal(&keychainCredentials{
+		WebToken: user.WebToken,
+		AppToken: user.AppToken,
+	})
+	if err != nil {
+		return err
+	}
+	return keychainSet(KeychainService, ref, string(data))
+}
+
+// loadKeychainCredentials 从系统钥匙串读取用户登录凭证
+func loadKeychainCredentials(user *PanUser) error {
+	data, err := keychainGet(KeychainService, user.KeychainRef)
+	if err != nil {
+		return err
+	}
+	cred := &keychainCredentials{}
+	if err = jsoniter.UnmarshalFromString(data, cred); err != nil {
+		return err
+	}
+	user.WebToken = cred.WebToken
+	user.AppToken = cred.AppToken
+	return nil
+}
+
+// deleteKeychainCredentials 删除用户保存在系统钥匙串中的登录凭证
+func deleteKeychainCredentials(user *PanUser) {
+	if user.KeychainRef == "" {
+		return
+	}
+	err := keychainDelete(KeychainService, user.KeychainRef)
+	if err != nil && err != keyring.ErrNotFound {
+		CmdConfigVerbose.Warnf("删除系统钥匙串中的登录凭证失败: %s\n", err)
+	}
+	user.KeychainRef = ""
+}
+
+// saveUserList 返回写入配置文件的用户列表.
+// 开启 StoreCredentialsKeychain 时, 登录凭证保存到系统钥匙串, 配置文件中只保存引用键;
+// 系统钥匙串不可用时给出警告, 登录凭证仍然保存在配置文件中.
+func (c *PanConfig) saveUserList() PanUserList {
+	if !c.StoreCredentialsKeychain {
+		for _, user := range c.UserList {
+			deleteKeychainCredentials(user)
+		}
+		return c.UserList
+	}
+
+	list := make(PanUserList, 0, len(c.UserList))
+	for _, user := range c.UserList {
+		if user.KeychainRef != "" && user.WebToken.CookieLoginUser == "" && user.AppToken.SessionKey == "" {
+			// 未能从系统钥匙串读取登录凭证, 保留原有的引用键
+			list = append(list, user)
+			continue
+		}
+		ref := keychainRef(user.UID)
+		if err := storeKeychainCredentials(ref, user); err != nil {
+			fmt.Printf("警告: 无法使用系统钥匙串保存登录凭证, 登录凭证将保存在配置文件中: %s\n", err)
+			user.KeychainRef = ""
+			list = append(list, user)
+			continue
+		}
+		user.KeychainRef = ref
+
+		u := *user
+		u.WebToken = cloudpan.WebLoginToken{}
+		u.AppToken = cloudpan.AppLoginToken{}
+		list = append(list, &u)
+	}
+	return list
+}
+
+// loadKeychainUserList 从系统钥匙串读取配置文件中引用的登录凭证
+func (c *PanConfig) loadKeychainUserList() {
+	for _, user := range c.UserList {
+		if user.KeychainRef == "" {
+			continue
+		}
+		if err := loadKeychainCredentials(user); err != nil {
+			fmt.Printf("警告: 无法从系统钥匙串读取账号 %s 的登录凭证, 请重新登录: %s\n", user.Nickname, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/zalando/go-keyring"
+)
+
+func newKeychainTestConfig(t *testing.T, path string) *PanConfig {
+	c := NewConfig(path)
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestKeychainCredentials(t *testing.T) {
+	keyring.MockInit()
+	path := filepath.Join(t.TempDir(), ConfigName)
+
+	c := newKeychainTestConfig(t, path)
+	c.StoreCredentialsKeychain = true
+	c.UserList = PanUserList{{
+		UID:      10086,
+		Nickname: "tickstep",
+		WebToken: cloudpan.WebLoginToken{CookieLoginUser: "web-cookie-token"},
+		AppToken: cloudpan.AppLoginToken{SessionKey: "app-session-key"},
+	}}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "web-cookie-token") || strings.Contains(string(data), "app-session-key") {
+		t.Fatalf("config file should not contain tokens: %s", data)
+	}
+	if !strings.Contains(string(data), keychainRef(10086)) {
+		t.Fatalf("config file should contain keychain ref: %s", data)
+	}
+	if c.UserList[0].WebToken.CookieLoginUser != "web-cookie-token" {
+		t.Fatal("in-memory token should be kept after save")
+	}
+
+	loaded := newKeychainTestConfig(t, path)
+	if len(loaded.UserList) != 1 {
+		t.Fatalf("got %d users, want 1", len(loaded.UserList))
+	}
+	u := loaded.UserList[0]
+	if u.WebToken.CookieLoginUser != "web-cookie-token" || u.AppToken.SessionKey != "app-session-key" {
+		t.Fatalf("tokens not restored from keychain: %+v %+v", u.WebToken, u.AppToken)
+	}
+
+	// 关闭后登录凭证重新写回配置文件, 并删除钥匙串中的凭证
+	loaded.StoreCredentialsKeychain = false
+	if err := loaded.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "web-cookie-token") {
+		t.Fatalf("config file should contain tokens: %s", data)
+	}
+	if _, err := keyring.Get(KeychainService, keychainRef(10086)); err != keyring.ErrNotFound {
+		t.Fatalf("keychain item should be deleted, got %v", err)
+	}
+}
+
+func TestKeychainCredentialsFallback(t *testing.T) {
+	keyring.MockInit()
+	keychainSet = func(service, user, password string) error {
+		return errors.New("keychain unsupported")
+	}
+	defer func() { keychainSet = keyring.Set }()
+
+	path := filepath.Join(t.TempDir(), ConfigName)
+	c := newKeychainTestConfig(t, path)
+	c.StoreCredentialsKeychain = true
+	c.UserList = PanUserList{{
+		UID:      10086,
+		WebToken: cloudpan.WebLoginToken{CookieLoginUser: "web-cookie-token"},
+	}}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "web-cookie-token") {
+		t.Fatalf("config file should fall back to storing tokens: %s", data)
+	}
+	if c.UserList[0].KeychainRef != "" {
+		t.Fatalf("keychain ref should be empty, got %q", c.UserList[0].KeychainRef)
+	}
+}
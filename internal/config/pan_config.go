@@ -25,6 +25,8 @@ import (
 	"github.com/phpc0de/ctapi/cloudpan"
 	"github.com/phpc0de/ctpango/cmder/cmdutil"
 	"github.com/phpc0de/ctpango/cmder/cmdutil/jsonhelper"
+	"github.com/phpc0de/ctpango/internal/file/downloader"
+	"github.com/phpc0de/ctpango/internal/logfile"
 	"github.com/phpc0de/ctlibgo/logger"
 	"github.com/phpc0de/ctlibgo/requester"
 )
@@ -36,8 +38,16 @@ const (
 	EnvConfigDir = "CLOUD189_CONFIG_DIR"
 	// ConfigName 配置文件名
 	ConfigName = "cloud189_config.json"
+	// HistoryFileName 默认的下载和上传历史记录文件名
+	HistoryFileName = "cloud189_history.jsonl"
 	// ConfigVersion 配置文件版本
-	ConfigVersion string = "1.0"
+	ConfigVersion string = "1.1"
+	// RedactedValue 显示配置时敏感信息的替代值
+	RedactedValue = "***"
+	// DefaultMaxDownloadQueue 默认一次下载最多加入下载队列的文件数量
+	DefaultMaxDownloadQueue = 1000
+	// DefaultMaxDownloadTotalParallel 默认所有文件的下载线程总数上限
+	DefaultMaxDownloadTotalParallel = 32
 )
 
 var (
@@ -48,6 +58,11 @@ var (
 	Config = NewConfig(configFilePath)
 
 	AppVersion string
+
+	// BuildCommit 构建时的 git commit, 通过 -ldflags "-X github.com/phpc0de/ctpango/internal/config.BuildCommit=<commit>" 设置
+	BuildCommit = "unknown"
+	// BuildDate 构建日期, 通过 -ldflags "-X github.com/phpc0de/ctpango/internal/config.BuildDate=<date>" 设置
+	BuildDate = "unknown"
 )
 
 type UpdateCheckInfo struct {
@@ -63,24 +78,47 @@ type PanConfig struct {
 
 	UserList PanUserList `json:"userList"`
 
-	CacheSize           int `json:"cacheSize"`           // 下载缓存
-	MaxDownloadParallel int `json:"maxDownloadParallel"` // 最大下载并发量
-	MaxUploadParallel   int `json:"maxUploadParallel"`   // 最大上传并发量，即同时上传文件最大数量
-	MaxDownloadLoad     int `json:"maxDownloadLoad"`     // 同时进行下载文件的最大数量
+	CacheSize                int `json:"cacheSize"`                // 下载缓存
+	MaxDownloadParallel      int `json:"maxDownloadParallel"`      // 最大下载并发量
+	MaxUploadParallel        int `json:"maxUploadParallel"`        // 最大上传并发量，即同时上传文件最大数量
+	MaxDownloadLoad          int `json:"maxDownloadLoad"`          // 同时进行下载文件的最大数量
+	MaxDownloadQueue         int `json:"maxDownloadQueue"`         // 一次下载最多加入下载队列的文件数量, 0代表不限制
+	MaxDownloadTotalParallel int `json:"maxDownloadTotalParallel"` // 所有同时下载的文件的下载线程总数上限, 0代表不限制
 
 	MaxDownloadRate int64 `json:"maxDownloadRate"` // 限制最大下载速度，单位 B/s, 即字节/每秒
 	MaxUploadRate   int64 `json:"maxUploadRate"`   // 限制最大上传速度，单位 B/s, 即字节/每秒
 
+	RateSchedule RateSchedule `json:"rateSchedule"` // 按时间段限速, 优先于 MaxDownloadRate 和 MaxUploadRate
+
+	ProgressStyle string `json:"progressStyle"` // 下载进度的输出样式, simple, bar 或 spinner
+
+	WebhookURL       string `json:"webhookURL"`       // 下载或上传完成后 POST 通知的URL, 为空不通知
+	WebhookOnSuccess bool   `json:"webhookOnSuccess"` // 任务成功时通知
+	WebhookOnFailure bool   `json:"webhookOnFailure"` // 任务失败时通知
+
+	StoreCredentialsKeychain bool `json:"storeCredentialsKeychain"` // 登录凭证保存到系统钥匙串, 配置文件中只保存引用键
+
 	SaveDir string `json:"saveDir"` // 下载储存路径
 
-	Proxy           string          `json:"proxy"`      // 代理
-	LocalAddrs      string          `json:"localAddrs"` // 本地网卡地址
+	HistoryFile string `json:"historyFile"` // 下载和上传历史记录文件路径, 为空时保存在配置目录
+
+	LogFile    string `json:"logFile"`    // 日志文件路径, 标准输出和调试日志同时写入该文件, 为空不写入
+	LogMaxSize int64  `json:"logMaxSize"` // 日志文件大小上限, 超过时轮转, 0代表使用默认值
+
+	Proxy           string          `json:"proxy"`         // 代理
+	LocalAddrs      string          `json:"localAddrs"`    // 本地网卡地址
+	TLSCACert       string          `json:"tlsCACert"`     // 自定义CA证书路径, PEM格式
+	TLSSkipVerify   bool            `json:"tlsSkipVerify"` // 不校验服务器TLS证书
 	UpdateCheckInfo UpdateCheckInfo `json:"updateCheckInfo"`
 
 	configFilePath string
 	configFile     *os.File
 	fileMu         sync.Mutex
 	activeUser     *PanUser
+
+	setConfigs []string                // --set-config 参数覆盖的配置项
+	sources    map[string]ConfigSource // 配置项的值的来源
+	overrides  []*configOverride       // 被覆盖的配置字段, 保存时还原
 }
 
 // NewConfig 返回 PanConfig 指针对象
@@ -124,7 +162,17 @@ func (c *PanConfig) Save() error {
 	c.fileMu.Lock()
 	defer c.fileMu.Unlock()
 
-	data, err := jsoniter.MarshalIndent(c, "", " ")
+	// 环境变量和 --set-config 参数覆盖的值不保存到配置文件
+	sc, err := c.withoutOverrides()
+	if err != nil {
+		return err
+	}
+
+	// 开启系统钥匙串时, 配置文件中不保存登录凭证
+	userList := sc.UserList
+	sc.UserList = c.saveUserList()
+	data, err := jsoniter.MarshalIndent(sc, "", " ")
+	sc.UserList = userList
 	if err != nil {
 		// json数据生成失败
 		panic(err)
@@ -160,6 +208,9 @@ func (c *PanConfig) init() error {
 		return err
 	}
 
+	// 应用环境变量和 --set-config 参数覆盖的配置项, 出错时仍使用配置文件中的值
+	overrideErr := c.applyOverrides(os.Environ(), c.setConfigs)
+
 	// 设置全局代理
 	if c.Proxy != "" {
 		requester.SetGlobalProxy(c.Proxy)
@@ -169,7 +220,7 @@ func (c *PanConfig) init() error {
 		requester.SetLocalTCPAddrList(strings.Split(c.LocalAddrs, ",")...)
 	}
 
-	return nil
+	return overrideErr
 }
 
 // lazyOpenConfigFile 打开配置文件
@@ -225,6 +276,8 @@ func (c *PanConfig) loadConfigFromFile() (err error) {
 	if err != nil {
 		return ErrConfigContentsParseError
 	}
+	c.loadKeychainUserList()
+	c.fix()
 	return nil
 }
 
@@ -245,6 +298,12 @@ func (c *PanConfig) initDefaultConfig() {
 			c.SaveDir = filepath.Join(dataPath, "Downloads")
 		}
 	}
+	c.MaxDownloadQueue = DefaultMaxDownloadQueue
+	c.MaxDownloadTotalParallel = DefaultMaxDownloadTotalParallel
+	c.ProgressStyle = string(downloader.StyleSimple)
+	c.LogMaxSize = logfile.DefaultMaxSize
+	c.WebhookOnSuccess = true
+	c.WebhookOnFailure = true
 	c.ConfigVer = ConfigVersion
 }
 
@@ -262,6 +321,14 @@ func GetConfigDir() string {
 	return cmdutil.ExecutablePathJoin(configDir)
 }
 
+// HistoryFilePath 返回下载和上传历史记录文件的路径, 未设置时保存在配置目录
+func (c *PanConfig) HistoryFilePath() string {
+	if c.HistoryFile != "" {
+		return c.HistoryFile
+	}
+	return filepath.Join(GetConfigDir(), HistoryFileName)
+}
+
 func (c *PanConfig) ActiveUser() *PanUser {
 	if c.activeUser == nil {
 		if c.UserList == nil {
@@ -273,14 +340,16 @@ func (c *PanConfig) ActiveUser() *PanUser {
 		for _, u := range c.UserList {
 			if u.UID == c.ActiveUID {
 				if u.PanClient() == nil {
-					// restore client
-					user, err := SetupUserByCookie(&u.WebToken, &u.AppToken)
+					// restore client, token expired, login again automatically
+					refresher := NewTokenRefresher(u, c.Save)
+					user, err := setupUserByCookie(&u.WebToken, &u.AppToken, refresher)
 					if err != nil {
 						logger.Verboseln("setup user error")
 						return nil
 					}
 					u.panClient = user.panClient
 					u.Nickname = user.Nickname
+					u.panClient.SetTokenRefresher(refresher.Refresh)
 
 					// check workdir valid or not
 					if u.ActiveFamilyId > 0 {
@@ -340,8 +409,24 @@ func (c *PanConfig) SetActiveUser(user *PanUser) *PanUser {
 	return c.ActiveUser()
 }
 
-func (c *PanConfig) fix() {
+// SetActiveUID 切换当前账号, 不重新获取账号信息, 账号信息在下次调用 ActiveUser 时加载
+func (c *PanConfig) SetActiveUID(uid uint64) {
+	c.ActiveUID = uid
+	// clear active user cache
+	c.activeUser = nil
+}
 
+func (c *PanConfig) fix() {
+	// 1.1 之前的配置文件没有 max_download_queue 和 max_download_total_parallel, 值为0时使用默认值, 而不是不限制
+	if c.ConfigVer < "1.1" {
+		if c.MaxDownloadQueue == 0 {
+			c.MaxDownloadQueue = DefaultMaxDownloadQueue
+		}
+		if c.MaxDownloadTotalParallel == 0 {
+			c.MaxDownloadTotalParallel = DefaultMaxDownloadTotalParallel
+		}
+	}
+	c.ConfigVer = ConfigVersion
 }
 
 // NumLogins 获取登录的用户数量
@@ -365,6 +450,7 @@ func (c *PanConfig) DeleteUser(uid uint64) (*PanUser, error) {
 		if u.UID == uid {
 			// delete user from user list
 			c.UserList = append(c.UserList[:idx], c.UserList[idx+1:]...)
+			deleteKeychainCredentials(u)
 			c.ActiveUID = 0
 			c.activeUser = nil
 			if len(c.UserList) > 0 {
@@ -376,11 +462,38 @@ func (c *PanConfig) DeleteUser(uid uint64) (*PanUser, error) {
 	return nil, fmt.Errorf("未找到指定的账号")
 }
 
+// Reset 恢复所有配置项为默认值. keepAccounts 为 true 时保留登录账号及其凭证的保存方式,
+// 否则同时删除所有账号
+func (c *PanConfig) Reset(keepAccounts bool) error {
+	d := NewConfig(c.configFilePath)
+	d.initDefaultConfig()
+	data, err := jsoniter.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	activeUID, userList, keychain := c.ActiveUID, c.UserList, c.StoreCredentialsKeychain
+	if err = jsoniter.Unmarshal(data, c); err != nil {
+		return err
+	}
+	if keepAccounts {
+		c.ActiveUID, c.UserList, c.StoreCredentialsKeychain = activeUID, userList, keychain
+		return nil
+	}
+
+	for _, u := range userList {
+		deleteKeychainCredentials(u)
+	}
+	c.activeUser = nil
+	return nil
+}
+
 // HTTPClient 返回设置好的 HTTPClient
 func (c *PanConfig) HTTPClient(ua string) *requester.HTTPClient {
 	client := requester.NewHTTPClient()
 	if ua != "" {
 		client.SetUserAgent(ua)
 	}
+	c.SetupHTTPClientTLS(client)
 	return client
 }
@@ -0,0 +1,251 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/phpc0de/ctpango/cmder/cmdtable"
+)
+
+const (
+	// EnvConfigOverridePrefix 覆盖配置项的环境变量前缀, 如 CLOUD189_CFG_MAX_DOWNLOAD_RATE 覆盖 max_download_rate
+	EnvConfigOverridePrefix = "CLOUD189_CFG_"
+
+	// ConfigSourceFile 配置项的值来自配置文件
+	ConfigSourceFile ConfigSource = "file"
+	// ConfigSourceEnv 配置项的值来自环境变量
+	ConfigSourceEnv ConfigSource = "env"
+	// ConfigSourceFlag 配置项的值来自 --set-config 参数
+	ConfigSourceFlag ConfigSource = "flag"
+)
+
+type (
+	// ConfigSource 配置项的值的来源
+	ConfigSource string
+
+	// configSetter 把字符串形式的值设置到配置项
+	configSetter func(c *PanConfig, value string) error
+
+	// configOverride 被环境变量或 --set-config 参数覆盖的配置字段
+	configOverride struct {
+		field     int           // PanConfig 的字段序号
+		value     reflect.Value // 覆盖后的值
+		fileValue reflect.Value // 配置文件中的值
+	}
+)
+
+// configSetters 支持覆盖的配置项, 名称与 config set 和 PrintTable 一致.
+// 只修改配置字段, 不设置全局代理等运行时状态
+var configSetters = map[string]configSetter{
+	"cache_size":                  (*PanConfig).SetCacheSizeByStr,
+	"max_download_parallel":       intSetter(func(c *PanConfig) *int { return &c.MaxDownloadParallel }),
+	"max_upload_parallel":         intSetter(func(c *PanConfig) *int { return &c.MaxUploadParallel }),
+	"max_download_load":           intSetter(func(c *PanConfig) *int { return &c.MaxDownloadLoad }),
+	"max_download_total_parallel": intSetter(func(c *PanConfig) *int { return &c.MaxDownloadTotalParallel }),
+	"max_download_queue":          intSetter(func(c *PanConfig) *int { return &c.MaxDownloadQueue }),
+	"max_download_rate":           (*PanConfig).SetMaxDownloadRateByStr,
+	"max_upload_rate":             (*PanConfig).SetMaxUploadRateByStr,
+	"rate-schedule":               (*PanConfig).SetRateScheduleByStr,
+	"store-credentials-keychain":  boolSetter(func(c *PanConfig) *bool { return &c.StoreCredentialsKeychain }),
+	"progress-style":              (*PanConfig).SetProgressStyleByStr,
+	"webhook_url":                 (*PanConfig).SetWebhookURLByStr,
+	"webhook_on_success":          boolSetter(func(c *PanConfig) *bool { return &c.WebhookOnSuccess }),
+	"webhook_on_failure":          boolSetter(func(c *PanConfig) *bool { return &c.WebhookOnFailure }),
+	"savedir":                     stringSetter(func(c *PanConfig) *string { return &c.SaveDir }),
+	"history_file":                stringSetter(func(c *PanConfig) *string { return &c.HistoryFile }),
+	"log_file":                    stringSetter(func(c *PanConfig) *string { return &c.LogFile }),
+	"log_max_size":                (*PanConfig).SetLogMaxSizeByStr,
+	"proxy":                       stringSetter(func(c *PanConfig) *string { return &c.Proxy }),
+	"local_addrs":                 stringSetter(func(c *PanConfig) *string { return &c.LocalAddrs }),
+	"cacert":                      (*PanConfig).SetTLSCACert,
+	"tls_skip_verify":             boolSetter(func(c *PanConfig) *bool { return &c.TLSSkipVerify }),
+}
+
+func intSetter(field func(c *PanConfig) *int) configSetter {
+	return func(c *PanConfig, value string) error {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = i
+		return nil
+	}
+}
+
+func boolSetter(field func(c *PanConfig) *bool) configSetter {
+	return func(c *PanConfig, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func stringSetter(field func(c *PanConfig) *string) configSetter {
+	return func(c *PanConfig, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+// ConfigKeyEnvName 返回覆盖配置项 key 的环境变量名称
+func ConfigKeyEnvName(key string) string {
+	return EnvConfigOverridePrefix + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// EffectiveConfig 返回依次应用环境变量和 setConfigs 覆盖后的配置副本, 以及每个配置项的值的来源.
+// environ 为 os.Environ() 格式的环境变量, setConfigs 为 key=value 格式, 后面的覆盖前面的.
+// 不修改 c, 也不保存到配置文件
+func (c *PanConfig) EffectiveConfig(environ, setConfigs []string) (*PanConfig, map[string]ConfigSource, error) {
+	ec, err := c.clone()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sources := make(map[string]ConfigSource, len(configSetters))
+	for key := range configSetters {
+		sources[key] = ConfigSourceFile
+	}
+
+	envKeys := make(map[string]string, len(configSetters))
+	for key := range configSetters {
+		envKeys[ConfigKeyEnvName(key)] = key
+	}
+	for _, kv := range environ {
+		kvs := strings.SplitN(kv, "=", 2)
+		key, ok := envKeys[kvs[0]]
+		if !ok || len(kvs) != 2 {
+			continue
+		}
+		if err = configSetters[key](ec, kvs[1]); err != nil {
+			return nil, nil, fmt.Errorf("环境变量 %s 错误: %s", kvs[0], err)
+		}
+		sources[key] = ConfigSourceEnv
+	}
+
+	for _, kv := range setConfigs {
+		kvs := strings.SplitN(kv, "=", 2)
+		if len(kvs) != 2 {
+			return nil, nil, fmt.Errorf("--set-config %s 格式错误, 应为 key=value", kv)
+		}
+		key := strings.TrimSpace(kvs[0])
+		setter, ok := configSetters[key]
+		if !ok {
+			return nil, nil, fmt.Errorf("--set-config %s: %w", kv, ErrUnknownConfigKey)
+		}
+		if err = setter(ec, kvs[1]); err != nil {
+			return nil, nil, fmt.Errorf("--set-config %s 错误: %s", kv, err)
+		}
+		sources[key] = ConfigSourceFlag
+	}
+	return ec, sources, nil
+}
+
+// clone 返回配置项的副本, 不包含配置文件等运行时状态
+func (c *PanConfig) clone() (*PanConfig, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	cc := &PanConfig{}
+	if err = json.Unmarshal(data, cc); err != nil {
+		return nil, err
+	}
+	return cc, nil
+}
+
+// SetConfigOverrides 设置 --set-config 参数覆盖的配置项, 格式为 key=value, 并重载配置使其生效.
+// 覆盖的值只在本次运行中生效, 不保存到配置文件
+func (c *PanConfig) SetConfigOverrides(setConfigs []string) error {
+	c.setConfigs = setConfigs
+	return c.Reload()
+}
+
+// applyOverrides 把环境变量和 setConfigs 覆盖的值应用到配置, 并记录被覆盖的字段, 保存时还原为配置文件中的值
+func (c *PanConfig) applyOverrides(environ, setConfigs []string) error {
+	c.overrides = nil
+	c.sources = nil
+
+	fc, err := c.clone()
+	if err != nil {
+		return err
+	}
+	ec, sources, err := fc.EffectiveConfig(environ, setConfigs)
+	if err != nil {
+		return err
+	}
+	c.sources = sources
+
+	cv, fv, ev := reflect.ValueOf(c).Elem(), reflect.ValueOf(fc).Elem(), reflect.ValueOf(ec).Elem()
+	for i := 0; i < cv.NumField(); i++ {
+		if cv.Type().Field(i).PkgPath != "" {
+			continue
+		}
+		if reflect.DeepEqual(fv.Field(i).Interface(), ev.Field(i).Interface()) {
+			continue
+		}
+		cv.Field(i).Set(ev.Field(i))
+		c.overrides = append(c.overrides, &configOverride{
+			field:     i,
+			value:     ev.Field(i),
+			fileValue: fv.Field(i),
+		})
+	}
+	return nil
+}
+
+// withoutOverrides 返回用于保存到配置文件的配置, 仍为覆盖值的字段还原为配置文件中的值,
+// 运行中修改过的字段 (如 config set) 保留修改后的值
+func (c *PanConfig) withoutOverrides() (*PanConfig, error) {
+	if len(c.overrides) == 0 {
+		return c, nil
+	}
+	sc, err := c.clone()
+	if err != nil {
+		return nil, err
+	}
+	cv, sv := reflect.ValueOf(c).Elem(), reflect.ValueOf(sc).Elem()
+	for _, o := range c.overrides {
+		if reflect.DeepEqual(cv.Field(o.field).Interface(), o.value.Interface()) {
+			sv.Field(o.field).Set(o.fileValue)
+		}
+	}
+	return sc, nil
+}
+
+// PrintEffectiveTable 输出当前生效的配置表格, 比 PrintTable 多一列值的来源
+func (c *PanConfig) PrintEffectiveTable(w io.Writer) error {
+	tb := cmdtable.NewTable(w)
+	tb.SetHeader([]string{"名称", "值", "来源", "描述"})
+	tb.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	tb.SetColumnAlignment([]int{tablewriter.ALIGN_DEFAULT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT})
+	for _, row := range c.tableRows() {
+		source := c.sources[row[0]]
+		if source == "" {
+			source = ConfigSourceFile
+		}
+		tb.Append([]string{row[0], row[1], string(source), row[3]})
+	}
+	tb.Render()
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEffectiveConfig(t *testing.T) {
+	c := newTestConfig()
+	c.MaxDownloadLoad = 1
+	c.MaxDownloadParallel = 10
+	c.SaveDir = "/file"
+
+	environ := []string{
+		"PATH=/usr/bin",
+		ConfigKeyEnvName("max_download_load") + "=2",
+		ConfigKeyEnvName("progress-style") + "=bar",
+		ConfigKeyEnvName("savedir") + "=/env",
+	}
+	ec, sources, err := c.EffectiveConfig(environ, []string{"savedir=/flag", "max_download_rate=2MB/s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ec.MaxDownloadLoad != 2 || ec.ProgressStyle != "bar" || ec.SaveDir != "/flag" || ec.MaxDownloadRate != 2*1024*1024 || ec.MaxDownloadParallel != 10 {
+		t.Errorf("unexpected effective config: %+v", ec)
+	}
+	want := map[string]ConfigSource{
+		"max_download_load":     ConfigSourceEnv,
+		"progress-style":        ConfigSourceEnv,
+		"savedir":               ConfigSourceFlag,
+		"max_download_rate":     ConfigSourceFlag,
+		"max_download_parallel": ConfigSourceFile,
+	}
+	for key, source := range want {
+		if sources[key] != source {
+			t.Errorf("source of %s = %s, want %s", key, sources[key], source)
+		}
+	}
+	// 不修改原配置
+	if c.MaxDownloadLoad != 1 || c.SaveDir != "/file" {
+		t.Errorf("original config modified: %+v", c)
+	}
+}
+
+func TestEffectiveConfigErrors(t *testing.T) {
+	c := newTestConfig()
+	if _, _, err := c.EffectiveConfig(nil, []string{"no_such_key=1"}); !errors.Is(err, ErrUnknownConfigKey) {
+		t.Errorf("unknown key: err = %v", err)
+	}
+	if _, _, err := c.EffectiveConfig(nil, []string{"savedir"}); err == nil {
+		t.Error("missing value should return error")
+	}
+	if _, _, err := c.EffectiveConfig([]string{ConfigKeyEnvName("tls_skip_verify") + "=maybe"}, nil); err == nil {
+		t.Error("invalid env value should return error")
+	}
+	for _, size := range []string{"512KB", "101MB"} {
+		if _, _, err := c.EffectiveConfig(nil, []string{"log_max_size=" + size}); err == nil {
+			t.Errorf("log_max_size=%s should return error", size)
+		}
+	}
+	for _, size := range []string{"0", "1MB", "100MB"} {
+		if _, _, err := c.EffectiveConfig(nil, []string{"log_max_size=" + size}); err != nil {
+			t.Errorf("log_max_size=%s: %s", size, err)
+		}
+	}
+}
+
+func TestConfigOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ConfigName)
+	c := newKeychainTestConfig(t, path)
+	c.MaxDownloadLoad = 1
+	c.SaveDir = "/file"
+	c.MaxUploadRate = 1024
+
+	environ := []string{
+		ConfigKeyEnvName("savedir") + "=/env",
+		ConfigKeyEnvName("max_upload_rate") + "=2KB",
+	}
+	if err := c.applyOverrides(environ, []string{"max_download_load=3"}); err != nil {
+		t.Fatal(err)
+	}
+	if c.MaxDownloadLoad != 3 || c.SaveDir != "/env" || c.MaxUploadRate != 2048 {
+		t.Fatalf("overrides not applied: load %d, savedir %s, upload rate %d", c.MaxDownloadLoad, c.SaveDir, c.MaxUploadRate)
+	}
+	if c.sources["savedir"] != ConfigSourceEnv || c.sources["max_download_load"] != ConfigSourceFlag {
+		t.Errorf("unexpected sources: %v", c.sources)
+	}
+
+	// 覆盖的值不保存到配置文件, 运行中修改的值正常保存
+	c.MaxUploadRate = 4096
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	fc := newKeychainTestConfig(t, path)
+	if fc.MaxDownloadLoad != 1 || fc.SaveDir != "/file" || fc.MaxUploadRate != 4096 {
+		t.Errorf("saved config: load %d, savedir %s, upload rate %d", fc.MaxDownloadLoad, fc.SaveDir, fc.MaxUploadRate)
+	}
+
+	// 覆盖的值错误时使用配置文件中的值
+	if err := fc.applyOverrides(nil, []string{"max_download_load=x"}); err == nil {
+		t.Error("invalid override should return error")
+	}
+	if fc.MaxDownloadLoad != 1 || len(fc.overrides) != 0 {
+		t.Errorf("invalid override applied: load %d", fc.MaxDownloadLoad)
+	}
+}
+
+func TestPrintEffectiveTable(t *testing.T) {
+	c := newTestConfig()
+	if err := c.applyOverrides(nil, []string{"max_download_load=3"}); err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := c.PrintEffectiveTable(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(line, "max_download_load ") && !strings.Contains(line, "flag") {
+			t.Errorf("max_download_load should come from flag: %s", line)
+		}
+		if strings.Contains(line, "savedir") && !strings.Contains(line, "file") {
+			t.Errorf("savedir should come from file: %s", line)
+		}
+	}
+	// 每个配置项都有对应的覆盖方法
+	for _, row := range c.tableRows() {
+		if _, ok := configSetters[row[0]]; !ok {
+			t.Errorf("config key %s can not be overridden", row[0])
+		}
+	}
+}
@@ -14,12 +14,17 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 
 	"github.com/olekukonko/tablewriter"
 	"github.com/phpc0de/ctpango/cmder/cmdtable"
+	"github.com/phpc0de/ctpango/internal/file/downloader"
+	"github.com/phpc0de/ctpango/internal/logfile"
 	"github.com/phpc0de/ctlibgo/converter"
 	"github.com/phpc0de/ctlibgo/requester"
 )
@@ -66,22 +71,175 @@ func (c *PanConfig) SetMaxUploadRateByStr(sizeStr string) error {
 	return nil
 }
 
+// SetLogMaxSizeByStr 设置 log_max_size
+func (c *PanConfig) SetLogMaxSizeByStr(sizeStr string) error {
+	size, err := converter.ParseFileSizeStr(sizeStr)
+	if err != nil {
+		return err
+	}
+	if !validLogMaxSize(size) {
+		return fmt.Errorf("%s 超出范围, 应为 %s, 0代表使用默认值", sizeStr, logMaxSizeRange())
+	}
+	c.LogMaxSize = size
+	return nil
+}
+
+// SetProgressStyleByStr 设置 progress-style
+func (c *PanConfig) SetProgressStyleByStr(str string) error {
+	style, err := downloader.ParseProgressStyle(str)
+	if err != nil {
+		return err
+	}
+	c.ProgressStyle = string(style)
+	return nil
+}
+
+// SetWebhookURLByStr 设置 webhook_url, 空字符串为不通知
+func (c *PanConfig) SetWebhookURLByStr(str string) error {
+	if str == "" {
+		c.WebhookURL = ""
+		return nil
+	}
+	u, err := url.Parse(str)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+	c.WebhookURL = str
+	return nil
+}
+
+// SetRateScheduleByStr 设置 rate-schedule
+func (c *PanConfig) SetRateScheduleByStr(str string) error {
+	rs, err := ParseRateSchedule(str)
+	if err != nil {
+		return err
+	}
+	c.RateSchedule = rs
+	return nil
+}
+
 // PrintTable 输出表格
 func (c *PanConfig) PrintTable() {
 	tb := cmdtable.NewTable(os.Stdout)
 	tb.SetHeader([]string{"名称", "值", "建议值", "描述"})
 	tb.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
 	tb.SetColumnAlignment([]int{tablewriter.ALIGN_DEFAULT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT})
-	tb.AppendBulk([][]string{
+	tb.AppendBulk(c.tableRows())
+	tb.Render()
+}
+
+// tableRows 返回配置表格的每一行: 名称, 值, 建议值, 描述
+func (c *PanConfig) tableRows() [][]string {
+	return [][]string{
 		[]string{"cache_size", converter.ConvertFileSize(int64(c.CacheSize), 2), "1KB ~ 256KB", "下载缓存, 如果硬盘占用高或下载速度慢, 请尝试调大此值"},
-		[]string{"max_download_parallel", strconv.Itoa(c.MaxDownloadParallel), "1 ~ 64", "最大下载并发量"},
+		[]string{"max_download_parallel", strconv.Itoa(c.MaxDownloadParallel), "1 ~ " + strconv.Itoa(MaxValidParallel), "每个文件的下载线程数"},
 		[]string{"max_upload_parallel", strconv.Itoa(c.MaxUploadParallel), "1 ~ 100", "最大上传并发量，即同时上传文件最大数量"},
 		[]string{"max_download_load", strconv.Itoa(c.MaxDownloadLoad), "1 ~ 5", "同时进行下载文件的最大数量"},
+		[]string{"max_download_total_parallel", strconv.Itoa(c.MaxDownloadTotalParallel), "0 ~ " + strconv.Itoa(MaxValidTotalParallel), "所有同时下载的文件的下载线程总数上限, 超过时自动减少每个文件的下载线程数, 0代表不限制"},
+		[]string{"max_download_queue", strconv.Itoa(c.MaxDownloadQueue), "0 ~ " + strconv.Itoa(MaxValidDownloadQueue), "一次下载最多加入下载队列的文件数量, 0代表不限制"},
 		[]string{"max_download_rate", showMaxRate(c.MaxDownloadRate), "", "限制最大下载速度, 0代表不限制"},
 		[]string{"max_upload_rate", showMaxRate(c.MaxUploadRate), "", "限制最大上传速度, 0代表不限制"},
+		[]string{"rate-schedule", c.RateSchedule.String(), "", "按时间段限速, 对上传和下载均有效, 未匹配的时间段使用 max_download_rate 和 max_upload_rate"},
+		[]string{"store-credentials-keychain", strconv.FormatBool(c.StoreCredentialsKeychain), "", "登录凭证保存到系统钥匙串(macOS Keychain, Windows 凭据管理器, Linux libsecret), 配置文件中只保存引用键, 系统不支持时仍保存到配置文件"},
+		[]string{"progress-style", c.ProgressStyle, "simple, bar, spinner", "下载进度的输出样式: simple 输出下载量和速度, bar 输出进度条和百分比, spinner 输出旋转的指示符"},
+		[]string{"webhook_url", c.WebhookURL, "", "下载或上传完成后以POST方式发送JSON通知到该URL, 为空不通知"},
+		[]string{"webhook_on_success", strconv.FormatBool(c.WebhookOnSuccess), "", "任务成功时发送webhook通知"},
+		[]string{"webhook_on_failure", strconv.FormatBool(c.WebhookOnFailure), "", "任务失败时发送webhook通知"},
 		[]string{"savedir", c.SaveDir, "", "下载文件的储存目录"},
+		[]string{"history_file", c.HistoryFile, "", "下载和上传历史记录文件路径, 为空时保存在配置目录的 " + HistoryFileName},
+		[]string{"log_file", c.LogFile, "", "日志文件路径, 标准输出和调试日志同时写入该文件, 登录凭证和下载链接不写入, 为空不写入"},
+		[]string{"log_max_size", showLogMaxSize(c.LogMaxSize), logMaxSizeRange(), "日志文件大小上限, 超过时把旧日志重命名为 log_file 加后缀 " + logfile.RotatedSuffix + ", 0代表使用默认值"},
 		[]string{"proxy", c.Proxy, "", "设置代理, 支持 http/socks5 代理，例如：http://127.0.0.1:8888"},
 		[]string{"local_addrs", c.LocalAddrs, "", "设置本地网卡地址, 多个地址用逗号隔开"},
-	})
-	tb.Render()
+		[]string{"cacert", c.TLSCACert, "", "自定义CA证书路径(PEM格式), 用于信任SSL解密代理等的证书, 只对下载和 webhook 等请求生效, 网盘接口请求不使用"},
+		[]string{"tls_skip_verify", strconv.FormatBool(c.TLSSkipVerify), "false", "不校验服务器TLS证书, 有安全风险, 只对下载和 webhook 等请求生效, 网盘接口请求不使用"},
+	}
+}
+
+// RedactedConfig 返回隐藏了敏感信息的配置副本, 密码和token等字段会被替换为 RedactedValue
+func (c *PanConfig) RedactedConfig() (*PanConfig, error) {
+	rc, err := c.clone()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range rc.UserList {
+		if user == nil {
+			continue
+		}
+		redactString(&user.LoginUserPassword)
+		redactString(&user.WebToken.CookieLoginUser)
+		redactString(&user.AppToken.SessionKey)
+		redactString(&user.AppToken.SessionSecret)
+		redactString(&user.AppToken.FamilySessionKey)
+		redactString(&user.AppToken.FamilySessionSecret)
+		redactString(&user.AppToken.AccessToken)
+		redactString(&user.AppToken.RefreshToken)
+		redactString(&user.AppToken.SskAccessToken)
+	}
+	rc.Proxy = redactProxy(rc.Proxy)
+	rc.WebhookURL = redactWebhookURL(rc.WebhookURL)
+	return rc, nil
+}
+
+// ShowJSON 以JSON格式输出隐藏了敏感信息的配置
+func (c *PanConfig) ShowJSON() (string, error) {
+	rc, err := c.RedactedConfig()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(rc, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ShowTOML 以TOML格式输出隐藏了敏感信息的配置
+func (c *PanConfig) ShowTOML() (string, error) {
+	rc, err := c.RedactedConfig()
+	if err != nil {
+		return "", err
+	}
+	builder := &strings.Builder{}
+	encodeTOML(builder, rc)
+	return builder.String(), nil
+}
+
+// redactString 隐藏不为空的敏感字段
+func redactString(s *string) {
+	if *s != "" {
+		*s = RedactedValue
+	}
+}
+
+// redactWebhookURL 隐藏 webhook URL 中可能包含密钥的用户信息, 路径和参数, 只保留协议和主机
+func redactWebhookURL(webhookURL string) string {
+	if webhookURL == "" {
+		return ""
+	}
+	u, err := url.Parse(webhookURL)
+	if err != nil || u.Host == "" {
+		return RedactedValue
+	}
+	if u.User == nil && (u.Path == "" || u.Path == "/") && u.RawQuery == "" && u.Fragment == "" {
+		return webhookURL
+	}
+	return u.Scheme + "://" + u.Host + "/" + RedactedValue
+}
+
+// redactProxy 隐藏代理地址中的密码
+func redactProxy(proxy string) string {
+	u, err := url.Parse(proxy)
+	if err != nil || u.User == nil {
+		return proxy
+	}
+	if _, ok := u.User.Password(); !ok {
+		return proxy
+	}
+	u.User = url.UserPassword(u.User.Username(), RedactedValue)
+	return strings.Replace(u.String(), url.QueryEscape(RedactedValue), RedactedValue, 1)
 }
@@ -0,0 +1,256 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+)
+
+type (
+	// SharedConfig 导出的配置, 用于在多台机器间共享设置, 不包含登录凭证
+	SharedConfig struct {
+		Settings map[string]json.RawMessage `json:"settings"` // 配置项, key 与配置文件中的名称一致
+		Accounts []*SharedAccount           `json:"accounts"` // 账号的设置
+	}
+
+	// SharedAccount 账号中可以共享的设置, 不包含密码和token
+	SharedAccount struct {
+		UID                     uint64                 `json:"uid"`
+		Nickname                string                 `json:"nickname"`
+		Workdir                 string                 `json:"workdir"`
+		WorkdirFileEntity       cloudpan.AppFileEntity `json:"workdirFileEntity"`
+		FamilyWorkdir           string                 `json:"familyWorkdir"`
+		FamilyWorkdirFileEntity cloudpan.AppFileEntity `json:"familyWorkdirFileEntity"`
+		ActiveFamilyId          int64                  `json:"activeFamilyId"`
+		FamilySaveDir           map[int64]string       `json:"familySaveDir"`
+	}
+
+	// SettingChange 导入配置时将被覆盖的一项配置
+	SettingChange struct {
+		Key string // 配置项名称, 账号的设置为 "账号 <uid>: 名称"
+		Old string // 当前的值, JSON 格式
+		New string // 导入的值, JSON 格式
+	}
+)
+
+// unsharedConfigKeys 不导出的配置项, 账号和登录凭证, 以及只与本机有关的信息
+var unsharedConfigKeys = map[string]bool{
+	"configVer":       true,
+	"activeUID":       true,
+	"userList":        true,
+	"updateCheckInfo": true,
+	"localAddrs":      true,
+	"tlsCACert":       true,
+	"historyFile":     true,
+	"logFile":         true,
+}
+
+// settingsMap 返回可以共享的配置项
+func (c *PanConfig) settingsMap() (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	settings := map[string]json.RawMessage{}
+	if err = json.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+	for key := range settings {
+		if unsharedConfigKeys[key] {
+			delete(settings, key)
+		}
+	}
+	return settings, nil
+}
+
+// sharedAccount 返回账号中可以共享的设置
+func sharedAccount(u *PanUser) *SharedAccount {
+	return &SharedAccount{
+		UID:                     u.UID,
+		Nickname:                u.Nickname,
+		Workdir:                 u.Workdir,
+		WorkdirFileEntity:       u.WorkdirFileEntity,
+		FamilyWorkdir:           u.FamilyWorkdir,
+		FamilyWorkdirFileEntity: u.FamilyWorkdirFileEntity,
+		ActiveFamilyId:          u.ActiveFamilyId,
+		FamilySaveDir:           u.FamilySaveDir,
+	}
+}
+
+// apply 把账号的设置合并到 u
+func (sa *SharedAccount) apply(u *PanUser) {
+	u.Workdir, u.WorkdirFileEntity = sa.Workdir, sa.WorkdirFileEntity
+	u.FamilyWorkdir, u.FamilyWorkdirFileEntity = sa.FamilyWorkdir, sa.FamilyWorkdirFileEntity
+	u.ActiveFamilyId = sa.ActiveFamilyId
+	u.FamilySaveDir = sa.FamilySaveDir
+}
+
+// ExportShared 以JSON格式导出除登录凭证外的所有配置项, 以及每个账号的工作目录和下载目录设置
+func (c *PanConfig) ExportShared(w io.Writer) error {
+	settings, err := c.settingsMap()
+	if err != nil {
+		return err
+	}
+	sc := &SharedConfig{
+		Settings: settings,
+		Accounts: make([]*SharedAccount, 0, len(c.UserList)),
+	}
+	for _, u := range c.UserList {
+		if u != nil {
+			sc.Accounts = append(sc.Accounts, sharedAccount(u))
+		}
+	}
+	data, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// ImportShared 读取 ExportShared 导出的配置, 合并到当前配置.
+// mergeAccounts 为 true 时同时合并 UID 相同的已登录账号的设置, 未登录的账号忽略.
+// 存在将被覆盖的值时调用 confirm, confirm 为 nil 或返回 false 时不修改配置. 返回被覆盖的配置项
+func (c *PanConfig) ImportShared(r io.Reader, mergeAccounts bool, confirm func(changes []*SettingChange) bool) ([]*SettingChange, error) {
+	sc := &SharedConfig{}
+	if err := json.NewDecoder(r).Decode(sc); err != nil {
+		return nil, err
+	}
+
+	current, err := c.settingsMap()
+	if err != nil {
+		return nil, err
+	}
+	settings := map[string]json.RawMessage{}
+	changes := make([]*SettingChange, 0)
+	for key, value := range sc.Settings {
+		if unsharedConfigKeys[key] {
+			continue
+		}
+		settings[key] = value
+		if old, ok := current[key]; ok && !jsonEqual(old, value) {
+			changes = append(changes, &SettingChange{Key: key, Old: string(old), New: string(value)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	// 导入后的配置检查不通过时不修改配置
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	if err = validateImported(c, data); err != nil {
+		return nil, err
+	}
+
+	accounts := map[*PanUser]*SharedAccount{}
+	if mergeAccounts {
+		for _, sa := range sc.Accounts {
+			if sa == nil {
+				continue
+			}
+			u := c.UserList.findByUID(sa.UID)
+			if u == nil {
+				continue
+			}
+			accounts[u] = sa
+			changes = append(changes, accountChanges(u, sa)...)
+		}
+	}
+
+	if len(changes) > 0 && (confirm == nil || !confirm(changes)) {
+		return nil, ErrImportCanceled
+	}
+
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	for u, sa := range accounts {
+		sa.apply(u)
+	}
+	return changes, nil
+}
+
+// validateImported 检查 c 合并导入的配置项 data 后是否合法, 账号的登录凭证不在检查范围内
+func validateImported(c *PanConfig, data []byte) error {
+	imported, err := c.clone()
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, imported); err != nil {
+		return err
+	}
+	msgs := make([]string, 0)
+	for _, p := range imported.Validate() {
+		if !strings.HasPrefix(p.Key, "user[") {
+			msgs = append(msgs, p.Key+": "+p.Message)
+		}
+	}
+	if len(msgs) > 0 {
+		return fmt.Errorf("%w: %s", ErrImportInvalid, strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// accountChanges 返回合并账号设置时将被覆盖的值
+func accountChanges(u *PanUser, sa *SharedAccount) []*SettingChange {
+	old, _ := json.Marshal(sharedAccount(u))
+	oldFields, newFields := map[string]json.RawMessage{}, map[string]json.RawMessage{}
+	json.Unmarshal(old, &oldFields)
+	data, _ := json.Marshal(sa)
+	json.Unmarshal(data, &newFields)
+
+	changes := make([]*SettingChange, 0)
+	for _, key := range []string{"workdir", "familyWorkdir", "activeFamilyId", "familySaveDir"} {
+		if !jsonEqual(oldFields[key], newFields[key]) {
+			changes = append(changes, &SettingChange{
+				Key: "账号 " + strconv.FormatUint(u.UID, 10) + ": " + key,
+				Old: string(oldFields[key]),
+				New: string(newFields[key]),
+			})
+		}
+	}
+	return changes
+}
+
+// findByUID 返回 UID 为 uid 的账号, 不存在时返回 nil
+func (pl PanUserList) findByUID(uid uint64) *PanUser {
+	for _, u := range pl {
+		if u != nil && u.UID == uid {
+			return u
+		}
+	}
+	return nil
+}
+
+// jsonEqual 比较两个JSON值是否相同, 忽略格式差异
+func jsonEqual(a, b json.RawMessage) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return bytes.Equal(a, b)
+	}
+	da, _ := json.Marshal(va)
+	db, _ := json.Marshal(vb)
+	return bytes.Equal(da, db)
+}
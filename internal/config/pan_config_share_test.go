@@ -0,0 +1,147 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+)
+
+func TestExportImportSharedRoundTrip(t *testing.T) {
+	src := newTestConfig()
+	src.SaveDir = t.TempDir()
+	src.MaxUploadParallel = 3
+	src.MaxDownloadRate = 2 * 1024 * 1024
+	src.ProgressStyle = "bar"
+	src.WebhookURL = "https://example.com/hook"
+	src.RateSchedule, _ = ParseRateSchedule("00:00-08:00:unlimited,08:00-22:00:500KB")
+	src.UserList[0].FamilySaveDir = map[int64]string{12345: "/data/family"}
+
+	buf := &bytes.Buffer{}
+	if err := src.ExportShared(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"session-key", "session-secret", "access-token", "cookie", src.UserList[0].LoginUserPassword} {
+		if strings.Contains(buf.String(), secret) {
+			t.Fatalf("exported config contains secret %q:\n%s", secret, buf.String())
+		}
+	}
+
+	dst := NewConfig("")
+	dst.initDefaultConfig()
+	dst.MaxDownloadParallel = 10
+	dst.UserList = PanUserList{
+		&PanUser{
+			UID:      10001,
+			Workdir:  "/",
+			AppToken: cloudpan.AppLoginToken{AccessToken: "dst-access-token"},
+		},
+	}
+	var confirmed []*SettingChange
+	changes, err := dst.ImportShared(bytes.NewReader(buf.Bytes()), true, func(c []*SettingChange) bool {
+		confirmed = c
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) == 0 || !reflect.DeepEqual(changes, confirmed) {
+		t.Fatalf("changes: %v, confirmed: %v", changes, confirmed)
+	}
+
+	srcSettings, _ := src.settingsMap()
+	dstSettings, _ := dst.settingsMap()
+	if len(srcSettings) != len(dstSettings) {
+		t.Fatalf("settings: %d != %d", len(srcSettings), len(dstSettings))
+	}
+	for key, value := range srcSettings {
+		if !jsonEqual(value, dstSettings[key]) {
+			t.Errorf("%s: %s != %s", key, value, dstSettings[key])
+		}
+	}
+
+	user := dst.UserList[0]
+	if user.Workdir != "/我的资源" || user.FamilySaveDir[12345] != "/data/family" {
+		t.Errorf("account settings not merged: %+v", user)
+	}
+	if user.AppToken.AccessToken != "dst-access-token" {
+		t.Errorf("access token overwritten: %s", user.AppToken.AccessToken)
+	}
+}
+
+func TestImportSharedCanceled(t *testing.T) {
+	buf := &bytes.Buffer{}
+	src := newTestConfig()
+	src.SaveDir = t.TempDir()
+	if err := src.ExportShared(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := NewConfig("")
+	dst.initDefaultConfig()
+	saveDir := dst.SaveDir
+	_, err := dst.ImportShared(bytes.NewReader(buf.Bytes()), false, func(c []*SettingChange) bool {
+		return false
+	})
+	if err != ErrImportCanceled {
+		t.Fatalf("err: %v", err)
+	}
+	if dst.SaveDir != saveDir {
+		t.Fatalf("config modified after canceled: %s", dst.SaveDir)
+	}
+
+	// 没有将被覆盖的值时不需要确认
+	if _, err = src.ImportShared(bytes.NewReader(buf.Bytes()), true, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportSharedInvalid(t *testing.T) {
+	src := newTestConfig()
+	src.SaveDir = t.TempDir()
+	src.LocalAddrs = "192.168.1.2"
+	src.LogFile = "/var/log/ctpan.log"
+	buf := &bytes.Buffer{}
+	if err := src.ExportShared(buf); err != nil {
+		t.Fatal(err)
+	}
+	// 只与本机有关的配置项不导出
+	for _, key := range []string{"localAddrs", "tlsCACert", "historyFile", "logFile"} {
+		if strings.Contains(buf.String(), `"`+key+`"`) {
+			t.Errorf("exported config contains %s", key)
+		}
+	}
+
+	src.MaxDownloadParallel = MaxValidParallel + 1
+	buf.Reset()
+	if err := src.ExportShared(buf); err != nil {
+		t.Fatal(err)
+	}
+	dst := NewConfig("")
+	dst.initDefaultConfig()
+	_, err := dst.ImportShared(bytes.NewReader(buf.Bytes()), false, func(c []*SettingChange) bool {
+		return true
+	})
+	if !errors.Is(err, ErrImportInvalid) || !strings.Contains(err.Error(), "max_download_parallel") {
+		t.Fatalf("err: %v", err)
+	}
+	if dst.MaxDownloadParallel != 0 {
+		t.Fatalf("config modified after invalid import: %d", dst.MaxDownloadParallel)
+	}
+}
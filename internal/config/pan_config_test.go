@@ -0,0 +1,95 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestPanConfigMigrate(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		data         string
+		queue, total int
+	}{
+		{`{"configVer":"1.0","maxDownloadQueue":0,"maxDownloadTotalParallel":0}`, DefaultMaxDownloadQueue, DefaultMaxDownloadTotalParallel},
+		{`{"configVer":"1.0","maxDownloadQueue":50,"maxDownloadTotalParallel":8}`, 50, 8},
+		{`{"configVer":"1.1","maxDownloadQueue":0,"maxDownloadTotalParallel":0}`, 0, 0},
+	} {
+		path := filepath.Join(dir, ConfigName)
+		if err := ioutil.WriteFile(path, []byte(tc.data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		c := newKeychainTestConfig(t, path)
+		if c.MaxDownloadQueue != tc.queue || c.MaxDownloadTotalParallel != tc.total || c.ConfigVer != ConfigVersion {
+			t.Errorf("%s: queue = %d, total = %d, version = %s", tc.data, c.MaxDownloadQueue, c.MaxDownloadTotalParallel, c.ConfigVer)
+		}
+		c.Close()
+	}
+}
+
+func TestPanConfigReset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ConfigName)
+	c := newKeychainTestConfig(t, path)
+	c.UserList = PanUserList{{UID: 10086, Nickname: "tickstep"}, {UID: 10087, Nickname: "ctpan"}}
+	c.ActiveUID = 10087
+	c.CacheSize = 65536
+	c.MaxDownloadParallel = 200
+	c.MaxUploadParallel = 10
+	c.MaxDownloadLoad = 3
+	c.MaxDownloadQueue = 5
+	c.MaxDownloadTotalParallel = 64
+	c.MaxDownloadRate = 1024
+	c.MaxUploadRate = 2048
+	c.WebhookURL = "http://127.0.0.1/hook"
+	c.WebhookOnFailure = false
+	c.Proxy = "socks5://127.0.0.1:1080"
+	c.SaveDir = "/tmp/ctpan"
+
+	if err := c.Reset(true); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.UserList) != 2 || c.UserList[1].Nickname != "ctpan" || c.ActiveUID != 10087 {
+		t.Fatalf("accounts not preserved: %v, active: %d", c.UserList, c.ActiveUID)
+	}
+	if c.CacheSize != 0 || c.MaxDownloadParallel != 0 || c.MaxUploadParallel != 0 || c.MaxDownloadLoad != 0 ||
+		c.MaxDownloadRate != 0 || c.MaxUploadRate != 0 {
+		t.Errorf("numeric fields not reset: %+v", c)
+	}
+	if c.MaxDownloadQueue != DefaultMaxDownloadQueue || c.MaxDownloadTotalParallel != DefaultMaxDownloadTotalParallel {
+		t.Errorf("download queue: %d, total parallel: %d", c.MaxDownloadQueue, c.MaxDownloadTotalParallel)
+	}
+	if c.WebhookURL != "" || !c.WebhookOnFailure || c.Proxy != "" || c.SaveDir == "/tmp/ctpan" || c.ConfigVer != ConfigVersion {
+		t.Errorf("settings not reset: %+v", c)
+	}
+
+	// 重置后可正常保存和读取
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	c = newKeychainTestConfig(t, path)
+	if len(c.UserList) != 2 || c.MaxDownloadQueue != DefaultMaxDownloadQueue {
+		t.Fatalf("reload: %v, queue: %d", c.UserList, c.MaxDownloadQueue)
+	}
+
+	if err := c.Reset(false); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.UserList) != 0 || c.ActiveUID != 0 || c.ActiveUser() != nil {
+		t.Fatalf("accounts not deleted: %v", c.UserList)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/phpc0de/ctlibgo/checkaccess"
+	"github.com/phpc0de/ctlibgo/converter"
+)
+
+const (
+	// MaxValidParallel max_download_parallel 的最大合法值, 与 PrintTable 中的范围一致
+	MaxValidParallel = 64
+	// MaxValidTotalParallel max_download_total_parallel 的最大合法值, 即 max_download_load 为5时的线程总数, 0代表不限制
+	MaxValidTotalParallel = MaxValidParallel * 5
+	// MaxValidDownloadQueue max_download_queue 的最大合法值, 0代表不限制
+	MaxValidDownloadQueue = 10000
+	// MinValidLogMaxSize log_max_size 的最小合法值, 0代表使用默认值
+	MinValidLogMaxSize = converter.MB
+	// MaxValidLogMaxSize log_max_size 的最大合法值
+	MaxValidLogMaxSize = 100 * converter.MB
+)
+
+type (
+	// ConfigProblem 配置检查发现的问题
+	ConfigProblem struct {
+		Key     string // 配置项名称, 与 PrintTable 一致, 账号的问题为 user[昵称]
+		Message string
+	}
+)
+
+// Validate 检查配置项的值, 返回发现的所有问题, 没有问题时返回空
+func (c *PanConfig) Validate() []*ConfigProblem {
+	var problems []*ConfigProblem
+	report := func(key, format string, a ...interface{}) {
+		problems = append(problems, &ConfigProblem{Key: key, Message: fmt.Sprintf(format, a...)})
+	}
+
+	// 下载目录
+	if c.SaveDir == "" {
+		report("savedir", "未设置下载目录")
+	} else if fi, err := os.Stat(c.SaveDir); err != nil {
+		report("savedir", "下载目录不存在: %s", c.SaveDir)
+	} else if !fi.IsDir() {
+		report("savedir", "下载目录不是目录: %s", c.SaveDir)
+	} else if !checkaccess.AccessRDWR(c.SaveDir) {
+		report("savedir", "下载目录不可写: %s", c.SaveDir)
+	}
+
+	if c.MaxDownloadParallel < 1 || c.MaxDownloadParallel > MaxValidParallel {
+		report("max_download_parallel", "%d 超出范围, 应为 1 ~ %d", c.MaxDownloadParallel, MaxValidParallel)
+	}
+	if c.MaxDownloadTotalParallel < 0 || c.MaxDownloadTotalParallel > MaxValidTotalParallel {
+		report("max_download_total_parallel", "%d 超出范围, 应为 0 ~ %d", c.MaxDownloadTotalParallel, MaxValidTotalParallel)
+	}
+	if c.MaxDownloadQueue < 0 || c.MaxDownloadQueue > MaxValidDownloadQueue {
+		report("max_download_queue", "%d 超出范围, 应为 0 ~ %d", c.MaxDownloadQueue, MaxValidDownloadQueue)
+	}
+	if c.MaxDownloadRate < 0 {
+		report("max_download_rate", "%d 不能小于0", c.MaxDownloadRate)
+	}
+	if c.MaxUploadRate < 0 {
+		report("max_upload_rate", "%d 不能小于0", c.MaxUploadRate)
+	}
+	if !validLogMaxSize(c.LogMaxSize) {
+		report("log_max_size", "%s 超出范围, 应为 %s, 0代表使用默认值", converter.ConvertFileSize(c.LogMaxSize, 2), logMaxSizeRange())
+	}
+
+	if c.Proxy != "" {
+		if u, err := url.Parse(c.Proxy); err != nil {
+			report("proxy", "代理地址格式错误: %s", err)
+		} else if (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") || u.Host == "" {
+			report("proxy", "代理地址应为 http, https 或 socks5 地址, 例如 http://127.0.0.1:8888: %s", c.Proxy)
+		}
+	}
+
+	if c.TLSCACert != "" {
+		if fi, err := os.Stat(c.TLSCACert); err != nil {
+			report("cacert", "CA证书文件不存在: %s", c.TLSCACert)
+		} else if fi.IsDir() {
+			report("cacert", "CA证书路径不是文件: %s", c.TLSCACert)
+		}
+	}
+
+	for _, user := range c.UserList {
+		name := user.Nickname
+		if name == "" {
+			name = strconv.FormatUint(user.UID, 10)
+		}
+		key := "user[" + name + "]"
+		if user.WebToken.CookieLoginUser == "" {
+			report(key, "网页登录凭证为空, 请重新登录")
+		}
+		if user.AppToken.SessionKey == "" || user.AppToken.SessionSecret == "" {
+			report(key, "客户端登录凭证为空, 请重新登录")
+		}
+	}
+	return problems
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+)
+
+// problemKeys 返回所有问题的配置项名称, 已排序
+func problemKeys(problems []*ConfigProblem) string {
+	keys := make([]string, 0, len(problems))
+	for _, p := range problems {
+		keys = append(keys, p.Key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, []byte("cert"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestConfig()
+	c.SaveDir = dir
+	c.TLSCACert = caFile
+	if problems := c.Validate(); len(problems) != 0 {
+		t.Fatalf("valid config reported problems: %s", problemKeys(problems))
+	}
+
+	c.SaveDir = filepath.Join(dir, "missing")
+	c.MaxDownloadParallel = MaxValidParallel + 1
+	c.MaxDownloadQueue = -1
+	c.MaxDownloadTotalParallel = MaxValidTotalParallel + 1
+	c.MaxDownloadRate = -1
+	c.MaxUploadRate = -1
+	c.LogMaxSize = MaxValidLogMaxSize + 1
+	c.Proxy = "127.0.0.1:8888"
+	c.TLSCACert = filepath.Join(dir, "missing.pem")
+	c.UserList = append(c.UserList, &PanUser{UID: 10002, Nickname: "nologin", WebToken: cloudpan.WebLoginToken{CookieLoginUser: "cookie"}})
+	got := problemKeys(c.Validate())
+	want := "cacert,log_max_size,max_download_parallel,max_download_queue,max_download_rate,max_download_total_parallel,max_upload_rate,proxy,savedir,user[nologin]"
+	if got != want {
+		t.Errorf("problems = %s, want %s", got, want)
+	}
+
+	// 下载目录是文件
+	c = newTestConfig()
+	c.SaveDir = caFile
+	c.MaxDownloadParallel = 0
+	c.Proxy = "ftp://127.0.0.1"
+	if got = problemKeys(c.Validate()); got != "max_download_parallel,proxy,savedir" {
+		t.Errorf("problems = %s, want max_download_parallel,proxy,savedir", got)
+	}
+}
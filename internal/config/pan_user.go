@@ -18,8 +18,11 @@ import (
 	"github.com/phpc0de/ctapi/cloudpan"
 	"github.com/phpc0de/ctapi/cloudpan/apierror"
 	"github.com/phpc0de/ctlibgo/logger"
+	"github.com/phpc0de/ctpango/internal/apistat"
 	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 type PanUser struct {
@@ -36,21 +39,30 @@ type PanUser struct {
 	ActiveFamilyId int64 `json:"activeFamilyId"` // 0代表个人云
 	ActiveFamilyInfo cloudpan.AppFamilyInfo `json:"activeFamilyInfo"`
 
+	FamilySaveDir map[int64]string `json:"familySaveDir"` // 家庭云文件的下载储存路径, key为家庭云ID
+
 	LoginUserName string `json:"loginUserName"`
 	LoginUserPassword string `json:"loginUserPassword"`
 
-	WebToken cloudpan.WebLoginToken `json:"webToken"`
-	AppToken cloudpan.AppLoginToken `json:"appToken"`
-	panClient *cloudpan.PanClient
+	WebToken    cloudpan.WebLoginToken `json:"webToken"`
+	AppToken    cloudpan.AppLoginToken `json:"appToken"`
+	KeychainRef string                 `json:"keychainRef"` // 登录凭证在系统钥匙串中的引用键, 为空代表保存在配置文件中
+	panClient   *apistat.PanClient
 }
 
 type PanUserList []*PanUser
 
 func SetupUserByCookie(webToken *cloudpan.WebLoginToken, appToken *cloudpan.AppLoginToken) (user *PanUser, err *apierror.ApiError) {
+	return setupUserByCookie(webToken, appToken, nil)
+}
+
+// setupUserByCookie 同 SetupUserByCookie, 登录凭证过期且无法用 sessionKey 刷新时,
+// 使用 refresher 重新获取登录凭证, 新的凭证会写回 webToken 和 appToken
+func setupUserByCookie(webToken *cloudpan.WebLoginToken, appToken *cloudpan.AppLoginToken, refresher *TokenRefresher) (user *PanUser, err *apierror.ApiError) {
 	tryRefreshWebToken := true
 
 doLoginAct:
-	panClient := cloudpan.NewPanClient(*webToken, *appToken)
+	panClient := apistat.NewPanClient(cloudpan.NewPanClient(*webToken, *appToken))
 	u := &PanUser{
 		WebToken: *webToken,
 		AppToken: *appToken,
@@ -72,6 +84,14 @@ doLoginAct:
 				goto doLoginAct
 			}
 		}
+		if err.Code == apierror.ApiCodeTokenExpiredCode && refresher != nil {
+			r := refresher
+			refresher = nil
+			if _, er := r.Refresh(); er == nil {
+				*webToken, *appToken = r.user.WebToken, r.user.AppToken
+				goto doLoginAct
+			}
+		}
 		return nil, err
 	}
 	name := "Unknown"
@@ -107,7 +127,7 @@ doLoginAct:
 	return u, nil
 }
 
-func (pu *PanUser) PanClient() *cloudpan.PanClient {
+func (pu *PanUser) PanClient() *apistat.PanClient {
 	return pu.panClient
 }
 
@@ -149,4 +169,42 @@ func (pu *PanUser) GetSavePath(filePanPath string) string {
 		dir = filepath.Clean(dirStr)
 	}
 	return dir
-}
\ No newline at end of file
+}
+
+// GetFamilySavePath 根据家庭云ID和网盘文件路径 panpath, 返回本地储存路径,
+// 家庭云设置了单独的储存路径时使用该路径, 否则和 GetSavePath 相同
+func (pu *PanUser) GetFamilySavePath(familyId int64, filePanPath string) string {
+	saveDir, ok := pu.FamilySaveDir[familyId]
+	if familyId <= 0 || !ok || saveDir == "" {
+		return pu.GetSavePath(filePanPath)
+	}
+	dirStr := filepath.Join(saveDir, filePanPath)
+	dir, err := filepath.Abs(dirStr)
+	if err != nil {
+		dir = filepath.Clean(dirStr)
+	}
+	return dir
+}
+
+// SetFamilySaveDirByStr 设置家庭云的下载储存路径, 格式为 <familyId>:<path>, path 为空则删除该家庭云的设置
+func (pu *PanUser) SetFamilySaveDirByStr(str string) error {
+	strs := strings.SplitN(str, ":", 2)
+	if len(strs) != 2 {
+		return fmt.Errorf("格式错误, 应为 <familyId>:<path>")
+	}
+	familyId, err := strconv.ParseInt(strings.TrimSpace(strs[0]), 10, 64)
+	if err != nil || familyId <= 0 {
+		return fmt.Errorf("家庭云ID错误: %s", strs[0])
+	}
+
+	saveDir := strings.TrimSpace(strs[1])
+	if saveDir == "" {
+		delete(pu.FamilySaveDir, familyId)
+		return nil
+	}
+	if pu.FamilySaveDir == nil {
+		pu.FamilySaveDir = map[int64]string{}
+	}
+	pu.FamilySaveDir[familyId] = saveDir
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestGetFamilySavePath(t *testing.T) {
+	saveDir := Config.SaveDir
+	defer func() {
+		Config.SaveDir = saveDir
+	}()
+	Config.SaveDir = filepath.Join(t.TempDir(), "Downloads")
+	familyDir := filepath.Join(t.TempDir(), "family")
+
+	pu := &PanUser{UID: 10086}
+	if err := pu.SetFamilySaveDirByStr("12345:" + familyDir); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		familyId int64
+		panPath  string
+		expected string
+	}{
+		{0, "/我的资源/1.mp4", filepath.Join(Config.SaveDir, "10086", "我的资源", "1.mp4")},
+		{12345, "/我的资源/1.mp4", filepath.Join(familyDir, "我的资源", "1.mp4")},
+		{12345, "", familyDir},
+		// 未单独设置的家庭云使用 savedir
+		{54321, "/我的资源/1.mp4", filepath.Join(Config.SaveDir, "10086", "我的资源", "1.mp4")},
+	}
+	for _, c := range cases {
+		if p := pu.GetFamilySavePath(c.familyId, c.panPath); p != c.expected {
+			t.Errorf("familyId %d, panPath %s: expected %s, got %s", c.familyId, c.panPath, c.expected, p)
+		}
+	}
+
+	// path 为空时删除家庭云的设置
+	if err := pu.SetFamilySaveDirByStr("12345:"); err != nil {
+		t.Fatal(err)
+	}
+	expected := filepath.Join(Config.SaveDir, "10086", "我的资源", "1.mp4")
+	if p := pu.GetFamilySavePath(12345, "/我的资源/1.mp4"); p != expected {
+		t.Errorf("expected %s, got %s", expected, p)
+	}
+}
+
+func TestSetFamilySaveDirByStr(t *testing.T) {
+	pu := &PanUser{}
+	for _, str := range []string{"", "D:/download", "abc:D:/download", "0:D:/download"} {
+		if err := pu.SetFamilySaveDirByStr(str); err == nil {
+			t.Errorf("%q: expected error", str)
+		}
+	}
+	// windows 路径中的冒号不影响解析
+	if err := pu.SetFamilySaveDirByStr("12345:D:/download"); err != nil {
+		t.Fatal(err)
+	}
+	if pu.FamilySaveDir[12345] != "D:/download" {
+		t.Errorf("unexpected family save dir: %s", pu.FamilySaveDir[12345])
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/phpc0de/ctlibgo/converter"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// RateWindow 限速时间段, [StartHour, EndHour) 内使用 MaxRate 限速, MaxRate 为0代表不限制.
+	// StartHour 大于 EndHour 时表示跨越午夜, 例如 22:00-06:00
+	RateWindow struct {
+		StartHour int   `json:"startHour"`
+		EndHour   int   `json:"endHour"`
+		MaxRate   int64 `json:"maxRate"` // 单位 B/s
+	}
+
+	// RateSchedule 限速计划, 按顺序匹配第一个包含当前时间的时间段
+	RateSchedule []RateWindow
+)
+
+const (
+	// RateUnlimited 不限速
+	RateUnlimited = "unlimited"
+)
+
+var (
+	// ErrRateScheduleFormat 限速计划格式错误
+	ErrRateScheduleFormat = errors.New("格式错误, 应为 HH:00-HH:00:<速度>, 多个时间段用逗号隔开, 例如 00:00-08:00:unlimited,08:00-22:00:500KB")
+)
+
+// ParseRateSchedule 解析限速计划, 例如 "00:00-08:00:unlimited,08:00-22:00:500KB", 空字符串表示清除限速计划
+func ParseRateSchedule(str string) (RateSchedule, error) {
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return nil, nil
+	}
+
+	rs := RateSchedule{}
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		// HH:MM-HH:MM:<rate>
+		timeRange := strings.SplitN(item, "-", 2)
+		if len(timeRange) != 2 {
+			return nil, ErrRateScheduleFormat
+		}
+		endAndRate := strings.SplitN(timeRange[1], ":", 3)
+		if len(endAndRate) != 3 {
+			return nil, ErrRateScheduleFormat
+		}
+
+		startHour, err := parseScheduleHour(timeRange[0])
+		if err != nil {
+			return nil, err
+		}
+		endHour, err := parseScheduleHour(endAndRate[0] + ":" + endAndRate[1])
+		if err != nil {
+			return nil, err
+		}
+		if startHour == endHour {
+			return nil, fmt.Errorf("时间段的开始和结束时间不能相同: %s", item)
+		}
+
+		var maxRate int64
+		rateStr := strings.TrimSpace(endAndRate[2])
+		if !strings.EqualFold(rateStr, RateUnlimited) {
+			maxRate, err = converter.ParseFileSizeStr(stripPerSecond(rateStr))
+			if err != nil {
+				return nil, fmt.Errorf("速度格式错误: %s", rateStr)
+			}
+		}
+
+		rs = append(rs, RateWindow{
+			StartHour: startHour,
+			EndHour:   endHour,
+			MaxRate:   maxRate,
+		})
+	}
+	return rs, nil
+}
+
+// parseScheduleHour 解析 HH:00 格式的整点时间, 支持 24:00
+func parseScheduleHour(str string) (int, error) {
+	strs := strings.Split(strings.TrimSpace(str), ":")
+	if len(strs) != 2 {
+		return 0, ErrRateScheduleFormat
+	}
+	hour, err := strconv.Atoi(strs[0])
+	if err != nil || hour < 0 || hour > 24 {
+		return 0, fmt.Errorf("时间格式错误: %s", str)
+	}
+	minute, err := strconv.Atoi(strs[1])
+	if err != nil || minute != 0 {
+		return 0, fmt.Errorf("时间只支持整点: %s", str)
+	}
+	return hour, nil
+}
+
+// Contains 时间段是否包含该小时
+func (rw *RateWindow) Contains(hour int) bool {
+	if rw.StartHour < rw.EndHour {
+		return hour >= rw.StartHour && hour < rw.EndHour
+	}
+	// 跨越午夜
+	return hour >= rw.StartHour || hour < rw.EndHour
+}
+
+// RateAt 返回该时间的限速, 没有匹配的时间段时返回 defaultRate, 0代表不限制
+func (rs RateSchedule) RateAt(t time.Time, defaultRate int64) int64 {
+	hour := t.Hour()
+	for k := range rs {
+		if rs[k].Contains(hour) {
+			return rs[k].MaxRate
+		}
+	}
+	return defaultRate
+}
+
+func (rs RateSchedule) String() string {
+	items := make([]string, 0, len(rs))
+	for _, rw := range rs {
+		rate := RateUnlimited
+		if rw.MaxRate > 0 {
+			rate = converter.ConvertFileSize(rw.MaxRate, 2)
+		}
+		items = append(items, fmt.Sprintf("%02d:00-%02d:00:%s", rw.StartHour, rw.EndHour, rate))
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"github.com/phpc0de/ctlibgo/converter"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRateSchedule(t *testing.T) {
+	rs, err := ParseRateSchedule("00:00-08:00:unlimited, 08:00-22:00:500KB, 22:00-24:00:2MB/s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := RateSchedule{
+		{StartHour: 0, EndHour: 8, MaxRate: 0},
+		{StartHour: 8, EndHour: 22, MaxRate: 500 * converter.KB},
+		{StartHour: 22, EndHour: 24, MaxRate: 2 * converter.MB},
+	}
+	if !reflect.DeepEqual(rs, expected) {
+		t.Errorf("expected %v, got %v", expected, rs)
+	}
+	if rs.String() != "00:00-08:00:unlimited,08:00-22:00:500.00KB,22:00-24:00:2.00MB" {
+		t.Errorf("unexpected string: %s", rs.String())
+	}
+
+	// 清除限速计划
+	if rs, err = ParseRateSchedule(""); err != nil || rs != nil {
+		t.Errorf("expected empty schedule, got %v, %s", rs, err)
+	}
+
+	for _, str := range []string{
+		"08:00-22:00",
+		"08:00:500KB",
+		"08:30-22:00:500KB",
+		"08:00-25:00:500KB",
+		"08:00-08:00:500KB",
+		"08:00-22:00:abc",
+	} {
+		if _, err = ParseRateSchedule(str); err == nil {
+			t.Errorf("%s: expected error", str)
+		}
+	}
+}
+
+func TestRateScheduleRateAt(t *testing.T) {
+	rs, err := ParseRateSchedule("08:00-22:00:500KB,22:00-02:00:1MB")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const defaultRate = 100
+	cases := []struct {
+		hour     int
+		expected int64
+	}{
+		{7, defaultRate},
+		{8, 500 * converter.KB},
+		{21, 500 * converter.KB},
+		{22, converter.MB},
+		{0, converter.MB},
+		{1, converter.MB},
+		{2, defaultRate},
+	}
+	for _, c := range cases {
+		now := time.Date(2021, 1, 1, c.hour, 59, 59, 0, time.Local)
+		if rate := rs.RateAt(now, defaultRate); rate != c.expected {
+			t.Errorf("hour %d: expected %d, got %d", c.hour, c.expected, rate)
+		}
+	}
+}
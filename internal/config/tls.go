@@ -0,0 +1,90 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/phpc0de/ctlibgo/requester"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+)
+
+var (
+	// ErrNoCertificates PEM文件中没有证书
+	ErrNoCertificates = errors.New("no certificates found in PEM file")
+
+	tlsSkipVerifyWarnOnce sync.Once
+)
+
+// LoadCACertPool 加载系统的CA证书和 caCertPath 中的PEM证书
+func LoadCACertPool(caCertPath string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(caCertPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, ErrNoCertificates
+	}
+	return pool, nil
+}
+
+// SetTLSCACert 设置自定义CA证书, 为空则清除
+func (c *PanConfig) SetTLSCACert(caCertPath string) error {
+	if caCertPath != "" {
+		if _, err := LoadCACertPool(caCertPath); err != nil {
+			return err
+		}
+	}
+	c.TLSCACert = caCertPath
+	return nil
+}
+
+// SetupHTTPClientTLS 根据 tls 配置设置 client 的证书校验, 未设置 TLSSkipVerify 时校验服务器证书,
+// 设置了 TLSCACert 时使用系统CA和自定义CA校验. ctapi 的网盘接口客户端不使用此设置
+func (c *PanConfig) SetupHTTPClientTLS(client *requester.HTTPClient) {
+	if c.TLSSkipVerify {
+		tlsSkipVerifyWarnOnce.Do(func() {
+			fmt.Fprintln(os.Stderr, "警告: 已设置 tls_skip_verify, 不会校验服务器的TLS证书, 连接可能被中间人窃听或篡改!")
+		})
+		client.SetHTTPSecure(false)
+		return
+	}
+
+	// requester.HTTPClient 默认不校验证书, 需要启用证书校验
+	client.SetHTTPSecure(true)
+	if c.TLSCACert == "" {
+		return
+	}
+	pool, err := LoadCACertPool(c.TLSCACert)
+	if err != nil {
+		// 加载失败时只使用系统CA校验, 不降级为不校验
+		fmt.Fprintf(os.Stderr, "警告: 加载CA证书 %s 失败: %s\n", c.TLSCACert, err)
+		return
+	}
+	if transport, ok := client.Transport.(*http.Transport); ok {
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs: pool,
+		}
+	}
+}
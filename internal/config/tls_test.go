@@ -0,0 +1,100 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func writeServerCACert(t *testing.T, srv *httptest.Server) string {
+	caCertPath := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(caCertPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return caCertPath
+}
+
+func TestSetupHTTPClientTLSCACert(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	c := &PanConfig{}
+	if err := c.SetTLSCACert(writeServerCACert(t, srv)); err != nil {
+		t.Fatal(err)
+	}
+
+	client := c.HTTPClient("")
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok || transport.TLSClientConfig == nil || transport.TLSClientConfig.RootCAs == nil || transport.TLSClientConfig.InsecureSkipVerify {
+		t.Fatalf("custom CA not set in transport")
+	}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestSetupHTTPClientTLSVerify(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// 未设置 tls_skip_verify 时校验证书
+	c := &PanConfig{}
+	if resp, err := c.HTTPClient("").Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Errorf("self-signed certificate accepted")
+	}
+
+	c.TLSSkipVerify = true
+	resp, err := c.HTTPClient("").Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestSetupHTTPClientTLSUnknownCA(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// CA证书加载失败时只使用系统CA校验, 不会降级为不校验
+	c := &PanConfig{TLSCACert: filepath.Join(t.TempDir(), "not_exist.pem")}
+	client := c.HTTPClient("")
+	if resp, err := client.Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Errorf("expected certificate error")
+	}
+}
+
+func TestSetTLSCACertInvalid(t *testing.T) {
+	invalid := filepath.Join(t.TempDir(), "invalid.pem")
+	ioutil.WriteFile(invalid, []byte("not a certificate"), 0644)
+
+	c := &PanConfig{}
+	if err := c.SetTLSCACert(invalid); err != ErrNoCertificates {
+		t.Errorf("expected ErrNoCertificates, got %v", err)
+	}
+	if err := c.SetTLSCACert(""); err != nil || c.TLSCACert != "" {
+		t.Errorf("expected cacert cleared")
+	}
+}
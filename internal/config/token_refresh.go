@@ -0,0 +1,87 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctlibgo/logger"
+)
+
+// TokenRefresher 登录凭证过期时, 使用保存的账号密码或 sessionKey 重新获取登录凭证
+type TokenRefresher struct {
+	user          *PanUser
+	login         func(username, password string) (*cloudpan.WebLoginToken, *cloudpan.AppLoginToken, error)
+	refreshCookie func(sessionKey string) string
+	save          func() error
+}
+
+// NewTokenRefresher 创建 TokenRefresher, 刷新成功后调用 save 保存新的登录凭证
+func NewTokenRefresher(user *PanUser, save func() error) *TokenRefresher {
+	return &TokenRefresher{
+		user:          user,
+		login:         loginByPassword,
+		refreshCookie: cloudpan.RefreshCookieToken,
+		save:          save,
+	}
+}
+
+// loginByPassword 使用账号密码重新登录, 获取 APP 和 WEB 登录凭证
+func loginByPassword(username, password string) (*cloudpan.WebLoginToken, *cloudpan.AppLoginToken, error) {
+	appToken, apierr := cloudpan.AppLogin(username, password)
+	if apierr != nil {
+		return nil, nil, apierr
+	}
+	webToken := &cloudpan.WebLoginToken{}
+	if cookie := cloudpan.RefreshCookieToken(appToken.SessionKey); cookie != "" {
+		webToken.CookieLoginUser = cookie
+	} else {
+		webToken, apierr = cloudpan.Login(username, password)
+		if apierr != nil {
+			return nil, nil, apierr
+		}
+	}
+	return webToken, appToken, nil
+}
+
+// Refresh 重新获取登录凭证, 更新用户信息并返回使用新凭证的 cloudpan.PanClient.
+// 优先使用保存的账号密码重新登录, 未保存账号密码时使用 sessionKey 刷新 WEB 登录凭证
+func (tr *TokenRefresher) Refresh() (*cloudpan.PanClient, error) {
+	username := DecryptString(tr.user.LoginUserName)
+	password := DecryptString(tr.user.LoginUserPassword)
+	if username != "" && password != "" {
+		webToken, appToken, err := tr.login(username, password)
+		if err != nil {
+			logger.Verbosef("使用保存的账号密码重新登录失败: %s\n", err)
+			return nil, err
+		}
+		tr.user.WebToken = *webToken
+		tr.user.AppToken = *appToken
+	} else if tr.user.AppToken.SessionKey != "" {
+		cookie := tr.refreshCookie(tr.user.AppToken.SessionKey)
+		if cookie == "" {
+			return nil, ErrTokenRefreshFailed
+		}
+		tr.user.WebToken.CookieLoginUser = cookie
+	} else {
+		return nil, ErrNoStoredCredentials
+	}
+	logger.Verboseln("登录凭证已过期, 已重新获取登录凭证")
+
+	if tr.save != nil {
+		if err := tr.save(); err != nil {
+			logger.Verbosef("保存登录凭证失败: %s\n", err)
+		}
+	}
+	return cloudpan.NewPanClient(tr.user.WebToken, tr.user.AppToken), nil
+}
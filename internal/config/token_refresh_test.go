@@ -0,0 +1,88 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+)
+
+func TestTokenRefresherRefresh(t *testing.T) {
+	user := &PanUser{
+		LoginUserName:     EncryptString("13800000000"),
+		LoginUserPassword: EncryptString("password"),
+		AppToken:          cloudpan.AppLoginToken{SessionKey: "old-session"},
+	}
+	saveCount := 0
+	tr := NewTokenRefresher(user, func() error {
+		saveCount++
+		return nil
+	})
+	tr.login = func(username, password string) (*cloudpan.WebLoginToken, *cloudpan.AppLoginToken, error) {
+		if username != "13800000000" || password != "password" {
+			t.Fatalf("username: %s, password: %s", username, password)
+		}
+		return &cloudpan.WebLoginToken{CookieLoginUser: "new-cookie"}, &cloudpan.AppLoginToken{SessionKey: "new-session"}, nil
+	}
+
+	client, err := tr.Refresh()
+	if err != nil || client == nil {
+		t.Fatalf("client: %v, err: %v", client, err)
+	}
+	if user.WebToken.CookieLoginUser != "new-cookie" || user.AppToken.SessionKey != "new-session" {
+		t.Fatalf("web token: %v, app token: %v", user.WebToken, user.AppToken)
+	}
+	if saveCount != 1 {
+		t.Fatalf("save count: %d", saveCount)
+	}
+}
+
+func TestTokenRefresherRefreshFailed(t *testing.T) {
+	user := &PanUser{
+		LoginUserName:     EncryptString("13800000000"),
+		LoginUserPassword: EncryptString("password"),
+		WebToken:          cloudpan.WebLoginToken{CookieLoginUser: "old-cookie"},
+		AppToken:          cloudpan.AppLoginToken{SessionKey: "old-session"},
+	}
+	loginErr := errors.New("login failed")
+	tr := NewTokenRefresher(user, func() error {
+		t.Fatal("unexpected save")
+		return nil
+	})
+	tr.login = func(username, password string) (*cloudpan.WebLoginToken, *cloudpan.AppLoginToken, error) {
+		return nil, nil, loginErr
+	}
+	if _, err := tr.Refresh(); err != loginErr {
+		t.Fatalf("err: %v", err)
+	}
+	if user.WebToken.CookieLoginUser != "old-cookie" || user.AppToken.SessionKey != "old-session" {
+		t.Fatalf("web token: %v, app token: %v", user.WebToken, user.AppToken)
+	}
+
+	// 未保存账号密码时使用 sessionKey 刷新
+	user.LoginUserName, user.LoginUserPassword = "", ""
+	tr.refreshCookie = func(sessionKey string) string {
+		return ""
+	}
+	if _, err := tr.Refresh(); err != ErrTokenRefreshFailed {
+		t.Fatalf("err: %v", err)
+	}
+
+	user.AppToken.SessionKey = ""
+	if _, err := tr.Refresh(); err != ErrNoStoredCredentials {
+		t.Fatalf("err: %v", err)
+	}
+}
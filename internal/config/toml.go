@@ -0,0 +1,147 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	// tomlField 结构体中需要输出的字段
+	tomlField struct {
+		key   string
+		value reflect.Value
+	}
+)
+
+// encodeTOML 将结构体编码为TOML格式, 只支持配置文件用到的类型:
+// 基本类型, 基本类型的数组, 基本类型的map, 结构体, 结构体(指针)的数组. 键名与JSON保持一致
+func encodeTOML(builder *strings.Builder, v interface{}) {
+	encodeTOMLTable(builder, "", reflect.ValueOf(v))
+}
+
+func encodeTOMLTable(builder *strings.Builder, tableKey string, v reflect.Value) {
+	v = reflect.Indirect(v)
+	fields := tomlFields(v)
+
+	// 先输出普通的键值对, 再输出子表, TOML要求子表必须在后面
+	for _, f := range fields {
+		if isTOMLTable(f.value) || isTOMLTableArray(f.value) {
+			continue
+		}
+		fmt.Fprintf(builder, "%s = %s\n", f.key, tomlValue(f.value))
+	}
+	for _, f := range fields {
+		childKey := joinTOMLKey(tableKey, f.key)
+		switch {
+		case isTOMLTable(f.value):
+			fmt.Fprintf(builder, "\n[%s]\n", childKey)
+			encodeTOMLTable(builder, childKey, f.value)
+		case isTOMLTableArray(f.value):
+			for i := 0; i < f.value.Len(); i++ {
+				item := f.value.Index(i)
+				if item.Kind() == reflect.Ptr && item.IsNil() {
+					continue
+				}
+				fmt.Fprintf(builder, "\n[[%s]]\n", childKey)
+				encodeTOMLTable(builder, childKey, item)
+			}
+		}
+	}
+}
+
+// tomlFields 获取结构体中导出的字段, 键名使用json标签
+func tomlFields(v reflect.Value) []tomlField {
+	t := v.Type()
+	fields := make([]tomlField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" { // 未导出
+			continue
+		}
+		key := sf.Name
+		if tag := strings.Split(sf.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			key = tag
+		}
+		fields = append(fields, tomlField{key: key, value: v.Field(i)})
+	}
+	return fields
+}
+
+func isTOMLTable(v reflect.Value) bool {
+	return reflect.Indirect(v).Kind() == reflect.Struct
+}
+
+func isTOMLTableArray(v reflect.Value) bool {
+	if v.Kind() != reflect.Slice {
+		return false
+	}
+	elem := v.Type().Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	return elem.Kind() == reflect.Struct
+}
+
+func joinTOMLKey(tableKey, key string) string {
+	if tableKey == "" {
+		return key
+	}
+	return tableKey + "." + key
+}
+
+// tomlValue 基本类型的TOML表示
+func tomlValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Slice, reflect.Array:
+		items := make([]string, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, tomlValue(v.Index(i)))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case reflect.Map:
+		// 内联表, 键排序后输出, 保证输出稳定
+		items := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			items = append(items, strconv.Quote(fmt.Sprint(k.Interface()))+" = "+tomlValue(v.MapIndex(k)))
+		}
+		sort.Strings(items)
+		if len(items) == 0 {
+			return "{}"
+		}
+		return "{ " + strings.Join(items, ", ") + " }"
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return `""`
+		}
+		return tomlValue(v.Elem())
+	}
+	return strconv.Quote(fmt.Sprint(v.Interface()))
+}
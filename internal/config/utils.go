@@ -17,6 +17,7 @@ import (
 	"encoding/hex"
 	"github.com/olekukonko/tablewriter"
 	"github.com/phpc0de/ctpango/cmder/cmdtable"
+	"github.com/phpc0de/ctpango/internal/logfile"
 	"github.com/phpc0de/ctlibgo/converter"
 	"github.com/phpc0de/ctlibgo/crypto"
 	"github.com/phpc0de/ctlibgo/ids"
@@ -47,13 +48,21 @@ func (pl *PanUserList) String() string {
 	return builder.String()
 }
 
-// AverageParallel 返回平均的下载最大并发量
-func AverageParallel(parallel, downloadLoad int) int {
-	if downloadLoad < 1 {
-		return 1
+// ClampParallel 返回每个文件实际使用的下载线程数.
+// 同时下载 concurrentFiles 个文件, 每个文件使用 parallel 个线程, 总线程数超过 maxTotal 时,
+// 平均分配 maxTotal 个线程, 每个文件至少1个线程. maxTotal 小于等于0时不限制
+func ClampParallel(parallel, concurrentFiles, maxTotal int) int {
+	if parallel < 1 {
+		parallel = 1
+	}
+	if concurrentFiles < 1 {
+		concurrentFiles = 1
+	}
+	if maxTotal <= 0 || parallel*concurrentFiles <= maxTotal {
+		return parallel
 	}
 
-	p := parallel / downloadLoad
+	p := maxTotal / concurrentFiles
 	if p < 1 {
 		return 1
 	}
@@ -75,6 +84,22 @@ func showMaxRate(size int64) string {
 	return converter.ConvertFileSize(size, 2) + "/s"
 }
 
+func showLogMaxSize(size int64) string {
+	if size <= 0 {
+		return "默认 " + converter.ConvertFileSize(logfile.DefaultMaxSize, 0)
+	}
+	return converter.ConvertFileSize(size, 2)
+}
+
+// validLogMaxSize log_max_size 是否在合法范围内, 0代表使用默认值
+func validLogMaxSize(size int64) bool {
+	return size == 0 || (size >= MinValidLogMaxSize && size <= MaxValidLogMaxSize)
+}
+
+func logMaxSizeRange() string {
+	return converter.ConvertFileSize(MinValidLogMaxSize, 0) + " ~ " + converter.ConvertFileSize(MaxValidLogMaxSize, 0)
+}
+
 // EncryptString 加密
 func EncryptString(text string) string {
 	if text == "" {
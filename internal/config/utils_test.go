@@ -25,3 +25,24 @@ func TestEncryptString(t *testing.T) {
 func TestDecryptString(t *testing.T) {
 	fmt.Println(DecryptString("75b3c8d21607440c0e8a70f4a4861c8669774cc69c70ce2a2c8acb815b6d5d3b"))
 }
+
+func TestClampParallel(t *testing.T) {
+	testCases := []struct {
+		parallel, concurrentFiles, maxTotal, want int
+	}{
+		{8, 4, 32, 8},  // 刚好等于上限
+		{8, 4, 0, 8},   // 不限制
+		{16, 4, 32, 8}, // 超过上限, 平均分配
+		{10, 3, 32, 10},
+		{20, 3, 32, 10},
+		{8, 64, 32, 1}, // 文件数量超过上限, 每个文件至少1个线程
+		{0, 4, 32, 1},
+		{8, 0, 32, 8},
+		{40, 0, 32, 32},
+	}
+	for _, tc := range testCases {
+		if got := ClampParallel(tc.parallel, tc.concurrentFiles, tc.maxTotal); got != tc.want {
+			t.Errorf("ClampParallel(%d, %d, %d) = %d, want %d", tc.parallel, tc.concurrentFiles, tc.maxTotal, got, tc.want)
+		}
+	}
+}
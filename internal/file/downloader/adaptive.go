@@ -0,0 +1,96 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package downloader
+
+import (
+	"context"
+	"github.com/phpc0de/ctlibgo/logger"
+	"github.com/phpc0de/ctpango/library/requester/transfer"
+	"time"
+)
+
+var (
+	// AdaptiveWarmUpDuration 自适应并发开始采样前的等待时间
+	AdaptiveWarmUpDuration = 5 * time.Second
+	// AdaptiveSampleInterval 自适应并发的采样周期
+	AdaptiveSampleInterval = 5 * time.Second
+	// AdaptiveHighWaterSize 单个线程的速度超过该值时视为已饱和
+	AdaptiveHighWaterSize int64 = 1024 * 1024 // 1mb
+)
+
+type (
+	// adaptiveParallelSample 自适应并发的速度采样
+	adaptiveParallelSample struct {
+		speedsPerSecond int64   // 总的下载速度
+		workerSpeeds    []int64 // 正在下载的各个线程的速度
+	}
+)
+
+// adaptiveParallel 根据采样计算新的并发量
+// 平均每个线程的速度低于 MinParallelSize 时减少一个线程,
+// 所有正在下载的线程都超过 AdaptiveHighWaterSize 时增加一个线程, 但不超过 maxParallel
+func adaptiveParallel(sample adaptiveParallelSample, current, maxParallel int) int {
+	if current < 1 {
+		current = 1
+	}
+	if current > 1 && sample.speedsPerSecond/int64(current) < MinParallelSize {
+		return current - 1
+	}
+	if current >= maxParallel || len(sample.workerSpeeds) < current {
+		return current
+	}
+	for _, speeds := range sample.workerSpeeds {
+		if speeds < AdaptiveHighWaterSize {
+			return current
+		}
+	}
+	return current + 1
+}
+
+// adaptiveParallelController 根据实际的下载速度, 动态调整 Monitor 同时下载的线程数量.
+// 从 maxParallel 个线程开始, 减少时 Monitor 暂停多出的线程, 增加时恢复暂停的线程, 不超过 maxParallel
+func (der *Downloader) adaptiveParallelController(ctx context.Context, status *transfer.DownloadStatus, maxParallel int) {
+	der.monitor.SetActiveCapacity(maxParallel)
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(AdaptiveWarmUpDuration):
+	}
+
+	ticker := time.NewTicker(AdaptiveSampleInterval)
+	defer ticker.Stop()
+	for {
+		current := der.monitor.ActiveCapacity()
+		sample := adaptiveParallelSample{
+			speedsPerSecond: status.SpeedsPerSecond(),
+		}
+		der.monitor.RangeWorker(func(key int, worker *Worker) bool {
+			if worker.GetStatus().StatusCode() == StatusCodeDownloading {
+				sample.workerSpeeds = append(sample.workerSpeeds, worker.GetSpeedsPerSecond())
+			}
+			return true
+		})
+
+		if parallel := adaptiveParallel(sample, current, maxParallel); parallel != current {
+			logger.Verbosef("DEBUG: adaptive parallel: %d -> %d, speeds: %d\n", current, parallel, sample.speedsPerSecond)
+			der.monitor.SetActiveCapacity(parallel)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctpango/internal/apistat"
+	"github.com/phpc0de/ctpango/library/requester/transfer"
+)
+
+func TestAdaptiveParallel(t *testing.T) {
+	const maxParallel = 4
+	var (
+		slow      = MinParallelSize / 2
+		saturated = AdaptiveHighWaterSize * 2
+	)
+
+	// 模拟下载状态: 先是各线程都饱和, 然后网络变慢
+	stream := []struct {
+		sample adaptiveParallelSample
+		expect int
+	}{
+		{adaptiveParallelSample{saturated * 2, []int64{saturated, saturated}}, 3},
+		{adaptiveParallelSample{saturated * 3, []int64{saturated, saturated, saturated}}, 4},
+		{adaptiveParallelSample{saturated * 4, []int64{saturated, saturated, saturated, saturated}}, 4}, // 不超过 maxParallel
+		{adaptiveParallelSample{saturated * 2, []int64{saturated, saturated, saturated, MinParallelSize}}, 4},
+		{adaptiveParallelSample{slow * 4, []int64{slow, slow, slow, slow}}, 3},
+		{adaptiveParallelSample{slow * 3, []int64{slow, slow, slow}}, 2},
+		{adaptiveParallelSample{slow * 2, []int64{slow, slow}}, 1},
+		{adaptiveParallelSample{0, []int64{0}}, 1}, // 最少一个线程
+	}
+
+	current := 2
+	for k, s := range stream {
+		current = adaptiveParallel(s.sample, current, maxParallel)
+		if current != s.expect {
+			t.Fatalf("sample %d: parallel %d, want %d", k, current, s.expect)
+		}
+	}
+}
+
+func TestMonitorActiveCapacity(t *testing.T) {
+	const (
+		workerNum = 3
+		rangeSize = 10 * 1024 * 1024
+		totalSize = workerNum * rangeSize
+	)
+	// 每个连接缓慢输出数据, 保证测试期间一直在下载
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var begin, end int64
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &begin, &end)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", begin, end, totalSize))
+		w.Header().Set("Content-Length", strconv.FormatInt(end-begin+1, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		chunk := make([]byte, 1024)
+		for {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}))
+	defer server.Close()
+
+	file, err := ioutil.TempFile(t.TempDir(), "monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	panClient := apistat.NewPanClient(cloudpan.NewPanClient(cloudpan.WebLoginToken{}, cloudpan.AppLoginToken{}))
+	status := transfer.NewDownloadStatus()
+	status.SetTotalSize(totalSize)
+	mt := NewMonitor()
+	writeMu := &sync.Mutex{}
+	for i := 0; i < workerNum; i++ {
+		wer := NewWorker(i, 0, "1", server.URL+"/file/1", file)
+		wer.SetPanClient(panClient)
+		wer.SetWriteMutex(writeMu)
+		wer.SetTotalSize(totalSize)
+		wer.SetAcceptRange("bytes")
+		wer.SetRange(&transfer.Range{Begin: int64(i) * rangeSize, End: int64(i+1) * rangeSize})
+		mt.Append(wer)
+	}
+	mt.SetStatus(status)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		mt.Execute(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	countStatus := func(code StatusCode) (num int) {
+		mt.RangeWorker(func(key int, worker *Worker) bool {
+			if worker.GetStatus().StatusCode() == code {
+				num++
+			}
+			return true
+		})
+		return
+	}
+	waitFor := func(desc string, cond func() bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: downloading %d, paused %d", desc, countStatus(StatusCodeDownloading), countStatus(StatusCodePaused))
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	waitFor("start", func() bool { return countStatus(StatusCodeDownloading) == workerNum })
+
+	// 减少并发量, 暂停正在下载的worker
+	mt.SetActiveCapacity(1)
+	waitFor("scale down", func() bool {
+		return countStatus(StatusCodeDownloading) == 1 && countStatus(StatusCodePaused) == workerNum-1
+	})
+
+	// 增加并发量, 恢复暂停的worker
+	mt.SetActiveCapacity(2)
+	waitFor("scale up", func() bool {
+		return countStatus(StatusCodeDownloading) == 2 && countStatus(StatusCodePaused) == 1
+	})
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctlibgo/logger"
+)
+
+var (
+	// BandwidthProbeDuration 测量带宽的最长时间
+	BandwidthProbeDuration = 5 * time.Second
+	// BandwidthProbeSize 测量带宽时最多下载的数据量, 由所有连接平分
+	BandwidthProbeSize int64 = 16 * 1024 * 1024 // 16mb
+	// BandwidthPerParallel 根据测量的带宽调整并发量时, 每个线程至少分得的带宽
+	BandwidthPerParallel int64 = 256 * 1024 // 256kb/s
+
+	// ErrBandwidthProbeNoData 测量带宽时没有下载到数据
+	ErrBandwidthProbeNoData = errors.New("bandwidth probe received no data")
+)
+
+type (
+	// BandwidthTest 下载前测量可用带宽, 复制的 Config 共用同一个 BandwidthTest, 只测量一次
+	BandwidthTest struct {
+		once      sync.Once
+		bandwidth int64
+		err       error
+	}
+)
+
+// NewBandwidthTest 返回未测量的 BandwidthTest
+func NewBandwidthTest() *BandwidthTest {
+	return &BandwidthTest{}
+}
+
+// Measure 第一次调用时使用 probe 测量带宽, 之后返回第一次测量的结果
+func (bt *BandwidthTest) Measure(probe func() (int64, error)) (int64, error) {
+	bt.once.Do(func() {
+		bt.bandwidth, bt.err = probe()
+	})
+	return bt.bandwidth, bt.err
+}
+
+// ParallelForBandwidth 根据测量的带宽 bandwidth (B/s) 计算并发量, 保证每个线程至少分得 BandwidthPerParallel,
+// 结果在 1 ~ maxParallel 之间, bandwidth <= 0 时返回 maxParallel
+func ParallelForBandwidth(bandwidth int64, maxParallel int) int {
+	if bandwidth <= 0 || BandwidthPerParallel <= 0 {
+		return maxParallel
+	}
+	parallel := bandwidth / BandwidthPerParallel
+	if parallel < 1 {
+		return 1
+	}
+	if parallel < int64(maxParallel) {
+		return int(parallel)
+	}
+	return maxParallel
+}
+
+// probeBandwidth 使用 Config.MaxParallel 个连接同时下载文件开头的数据测量可用带宽,
+// 天翼云盘按连接限速, 单个连接测量的带宽会远小于多线程下载的带宽.
+// 最多下载 BandwidthProbeSize 字节或 BandwidthProbeDuration, 返回 B/s
+func (der *Downloader) probeBandwidth() (int64, error) {
+	size := BandwidthProbeSize
+	if der.fileInfo.FileSize < size {
+		size = der.fileInfo.FileSize
+	}
+	if size <= 0 {
+		return 0, ErrBandwidthProbeNoData
+	}
+	parallel := int64(der.config.MaxParallel)
+	if parallel < 1 {
+		parallel = 1
+	}
+	if parallel > size {
+		parallel = size
+	}
+
+	durl, err := der.downloadUrlFunc(der.familyId, der.fileInfo.FileId)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		start    = time.Now()
+		received int64
+		errMu    sync.Mutex
+		probeErr error
+		wg       sync.WaitGroup
+		rangeLen = size / parallel
+	)
+	for i := int64(0); i < parallel; i++ {
+		begin, end := i*rangeLen, (i+1)*rangeLen-1
+		if i == parallel-1 {
+			end = size - 1
+		}
+		wg.Add(1)
+		go func(begin, end int64) {
+			defer wg.Done()
+			n, err := der.probeRange(durl, begin, end, start.Add(BandwidthProbeDuration))
+			atomic.AddInt64(&received, n)
+			if err != nil {
+				errMu.Lock()
+				probeErr = err
+				errMu.Unlock()
+			}
+		}(begin, end)
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	if received <= 0 {
+		if probeErr != nil {
+			return 0, probeErr
+		}
+		return 0, ErrBandwidthProbeNoData
+	}
+	if elapsed <= 0 {
+		elapsed = time.Millisecond
+	}
+	return int64(float64(received) / elapsed.Seconds()), nil
+}
+
+// probeRange 下载 begin ~ end 的数据并丢弃, 到 deadline 时关闭连接, 返回下载的数据量
+func (der *Downloader) probeRange(durl string, begin, end int64, deadline time.Time) (int64, error) {
+	var (
+		received int64
+		readErr  error
+	)
+	apierr := der.panClient.AppDownloadFileData(durl, cloudpan.AppFileDownloadRange{
+		Offset: begin,
+		End:    end,
+	}, func(httpMethod, fullUrl string, headers map[string]string) (*http.Response, error) {
+		resp, err := der.client.Req(httpMethod, fullUrl, nil, headers)
+		if resp != nil {
+			defer resp.Body.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode/100 != 2 {
+			return nil, fmt.Errorf("bandwidth probe: %s", resp.Status)
+		}
+
+		// 超时后关闭连接, 结束读取
+		timer := time.AfterFunc(time.Until(deadline), func() {
+			resp.Body.Close()
+		})
+		defer timer.Stop()
+		received, readErr = io.CopyN(io.Discard, resp.Body, end-begin+1)
+		return resp, nil
+	})
+	if apierr != nil {
+		return received, apierr
+	}
+	if received <= 0 && readErr != nil {
+		return 0, readErr
+	}
+	return received, nil
+}
+
+// applyBandwidthTest 测量可用带宽并保存到 Config.MeasuredBandwidth, 未指定并发量时根据带宽减少并发量
+func (der *Downloader) applyBandwidthTest() {
+	if der.config.BandwidthTest == nil {
+		return
+	}
+	bandwidth, err := der.config.BandwidthTest.Measure(der.probeBandwidth)
+	if err != nil {
+		logger.Verbosef("DEBUG: bandwidth test error: %s\n", err)
+		return
+	}
+	der.config.MeasuredBandwidth = bandwidth
+	if der.config.ParallelExplicit {
+		return
+	}
+	if parallel := ParallelForBandwidth(bandwidth, der.config.MaxParallel); parallel != der.config.MaxParallel {
+		logger.Verbosef("DEBUG: measured bandwidth %d B/s, max parallel %d -> %d\n", bandwidth, der.config.MaxParallel, parallel)
+		der.config.MaxParallel = parallel
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package downloader
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctpango/internal/apistat"
+)
+
+// newProbeTestDownloader 返回从 server 下载大小为 fileSize 的文件的 Downloader
+func newProbeTestDownloader(server *httptest.Server, fileSize int64, cfg *Config) *Downloader {
+	der := NewDownloader(nil, cfg, apistat.NewPanClient(cloudpan.NewPanClient(cloudpan.WebLoginToken{}, cloudpan.AppLoginToken{})))
+	der.SetFileInfo(&cloudpan.AppFileEntity{FileId: "1", FileSize: fileSize})
+	der.SetDownloadUrlFunc(func(familyId int64, fileId string) (string, error) {
+		return server.URL + "/file?id=" + fileId, nil
+	})
+	der.lazyInit()
+	return der
+}
+
+func TestBandwidthTestReducesParallel(t *testing.T) {
+	probeDuration := BandwidthProbeDuration
+	BandwidthProbeDuration = 500 * time.Millisecond
+	defer func() { BandwidthProbeDuration = probeDuration }()
+
+	// 所有连接共用带宽, 每 100ms 输出 16KB, 约 160KB/s, 低于一个线程所需的 BandwidthPerParallel
+	var requests int32
+	tick := time.NewTicker(100 * time.Millisecond)
+	defer tick.Stop()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if !strings.HasPrefix(r.Header.Get("Range"), "bytes=") {
+			t.Errorf("range: %s", r.Header.Get("Range"))
+		}
+		w.WriteHeader(http.StatusPartialContent)
+		chunk := make([]byte, 16*1024)
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-tick.C:
+			}
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	cfg := NewConfig()
+	cfg.MaxParallel = 8
+	cfg.BandwidthTest = NewBandwidthTest()
+	der := newProbeTestDownloader(server, 1024*1024*1024, cfg)
+
+	start := time.Now()
+	der.applyBandwidthTest()
+	if elapsed := time.Since(start); elapsed > 3*BandwidthProbeDuration {
+		t.Fatalf("probe took %s", elapsed)
+	}
+	if cfg.MeasuredBandwidth <= 0 || cfg.MeasuredBandwidth >= BandwidthPerParallel {
+		t.Fatalf("measured bandwidth: %d", cfg.MeasuredBandwidth)
+	}
+	if cfg.MaxParallel != 1 {
+		t.Fatalf("max parallel: %d", cfg.MaxParallel)
+	}
+
+	// 复制的配置共用测量结果, 不再测量
+	explicit := cfg.Copy()
+	explicit.MaxParallel = 8
+	explicit.MeasuredBandwidth = 0
+	explicit.ParallelExplicit = true
+	newProbeTestDownloader(server, 1024*1024*1024, explicit).applyBandwidthTest()
+	if n := atomic.LoadInt32(&requests); n != 8 {
+		t.Fatalf("requests: %d", n)
+	}
+	if explicit.MeasuredBandwidth != cfg.MeasuredBandwidth || explicit.MaxParallel != 8 {
+		t.Fatalf("explicit parallel changed: %d, bandwidth: %d", explicit.MaxParallel, explicit.MeasuredBandwidth)
+	}
+}
+
+func TestBandwidthTestPerConnectionLimit(t *testing.T) {
+	probeDuration := BandwidthProbeDuration
+	BandwidthProbeDuration = 500 * time.Millisecond
+	defer func() { BandwidthProbeDuration = probeDuration }()
+
+	// 每个连接每 100ms 输出 16KB, 约 160KB/s, 与天翼云盘一样按连接限速
+	var (
+		requests int32
+		mu       sync.Mutex
+		ranges   = map[string]bool{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		mu.Lock()
+		ranges[r.Header.Get("Range")] = true
+		mu.Unlock()
+		w.WriteHeader(http.StatusPartialContent)
+		chunk := make([]byte, 16*1024)
+		for {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}))
+	defer server.Close()
+
+	cfg := NewConfig()
+	cfg.MaxParallel = 8
+	cfg.BandwidthTest = NewBandwidthTest()
+	newProbeTestDownloader(server, 1024*1024*1024, cfg).applyBandwidthTest()
+
+	// 8 个连接的总带宽远大于单个连接的带宽
+	if n := atomic.LoadInt32(&requests); n != 8 || len(ranges) != 8 {
+		t.Fatalf("requests: %d, ranges: %v", n, ranges)
+	}
+	if cfg.MeasuredBandwidth < 3*BandwidthPerParallel {
+		t.Fatalf("measured bandwidth: %d", cfg.MeasuredBandwidth)
+	}
+	if cfg.MaxParallel < 3 {
+		t.Fatalf("max parallel: %d", cfg.MaxParallel)
+	}
+}
+
+func TestBandwidthTestFastKeepsParallel(t *testing.T) {
+	content := make([]byte, 4*1024*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	cfg := NewConfig()
+	cfg.MaxParallel = 4
+	cfg.BandwidthTest = NewBandwidthTest()
+	newProbeTestDownloader(server, int64(len(content)), cfg).applyBandwidthTest()
+	if cfg.MeasuredBandwidth < 4*BandwidthPerParallel || cfg.MaxParallel != 4 {
+		t.Fatalf("measured bandwidth: %d, max parallel: %d", cfg.MeasuredBandwidth, cfg.MaxParallel)
+	}
+}
+
+func TestParallelForBandwidth(t *testing.T) {
+	for _, c := range []struct {
+		bandwidth   int64
+		maxParallel int
+		want        int
+	}{
+		{0, 5, 5},
+		{BandwidthPerParallel / 2, 5, 1},
+		{BandwidthPerParallel * 3, 5, 3},
+		{BandwidthPerParallel * 100, 5, 5},
+	} {
+		if got := ParallelForBandwidth(c.bandwidth, c.maxParallel); got != c.want {
+			t.Errorf("ParallelForBandwidth(%d, %d) = %d, want %d", c.bandwidth, c.maxParallel, got, c.want)
+		}
+	}
+}
@@ -15,11 +15,18 @@ package downloader
 
 import (
 	"github.com/phpc0de/ctpango/library/requester/transfer"
+	"time"
 )
 
 const (
 	//CacheSize 默认的下载缓存
 	CacheSize = 8192
+	// DefaultChecksumAlgorithm 默认校验文件使用的摘要算法
+	DefaultChecksumAlgorithm = "md5"
+	// DefaultSpeedSamplingWindow 默认计算下载速度的滑动窗口
+	DefaultSpeedSamplingWindow = 3 * time.Second
+	// DefaultMaxLBCheckParallel 默认同时检测的负载均衡服务器数量
+	DefaultMaxLBCheckParallel = 10
 )
 
 var (
@@ -34,17 +41,31 @@ type Config struct {
 	CacheSize                  int                        // 下载缓冲
 	BlockSize                  int64                      // 每个Range区块的大小, RangeGenMode 为 RangeGenMode2 时才有效
 	MaxRate                    int64                      // 限制最大下载速度
+	RateSchedule               func(now time.Time) int64  // 按时间段限速, 返回该时间的最大下载速度, 0代表不限制
 	InstanceStateStorageFormat InstanceStateStorageFormat // 断点续传储存类型
 	InstanceStatePath          string                     // 断点续传信息路径
 	TryHTTP                    bool                       // 是否尝试使用 http 连接
 	ShowProgress               bool                       // 是否展示下载进度条
+	ProgressStyle              ProgressStyle              // 下载进度的输出样式, 默认为 StyleSimple
+	Adaptive                   bool                       // 是否根据下载速度自动调整并发量
+	InterfaceChangeDetection   bool                       // 是否检测本机网络地址的变化, 变化时立即重设所有连接
+	ChecksumAlgorithm          string                     // 下载完成后校验文件使用的摘要算法, 目前只支持 md5, 默认为 md5
+	SkipFirstBytes             int64                      // 大于0时忽略断点续传信息, 认为文件的前 SkipFirstBytes 字节已下载, 从该位置开始下载
+	SpeedSamplingWindow        time.Duration              // 显示的下载速度为该时间内的平均速度, 0为默认值 DefaultSpeedSamplingWindow
+	MaxLBCheckParallel         int                        // 同时检测的负载均衡服务器数量, 0为默认值 DefaultMaxLBCheckParallel
+	BandwidthTest              *BandwidthTest             // 不为nil时下载前测量可用带宽, 复制的配置共用测量结果
+	MeasuredBandwidth          int64                      // 测量到的可用带宽, 单位 B/s, 0代表未测量
+	ParallelExplicit           bool                       // MaxParallel 由用户指定, 不根据测量的带宽调整
 }
 
 //NewConfig 返回默认配置
 func NewConfig() *Config {
 	return &Config{
-		MaxParallel: 5,
-		CacheSize:   CacheSize,
+		MaxParallel:         5,
+		CacheSize:           CacheSize,
+		ChecksumAlgorithm:   DefaultChecksumAlgorithm,
+		SpeedSamplingWindow: DefaultSpeedSamplingWindow,
+		MaxLBCheckParallel:  DefaultMaxLBCheckParallel,
 	}
 }
 
@@ -54,6 +75,15 @@ func (cfg *Config) Fix() {
 	if cfg.MaxParallel < 1 {
 		cfg.MaxParallel = 1
 	}
+	if cfg.ChecksumAlgorithm == "" {
+		cfg.ChecksumAlgorithm = DefaultChecksumAlgorithm
+	}
+	if cfg.SpeedSamplingWindow <= 0 {
+		cfg.SpeedSamplingWindow = DefaultSpeedSamplingWindow
+	}
+	if cfg.MaxLBCheckParallel < 1 {
+		cfg.MaxLBCheckParallel = DefaultMaxLBCheckParallel
+	}
 }
 
 //Copy 拷贝新的配置
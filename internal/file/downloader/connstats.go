@@ -0,0 +1,164 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+
+	"github.com/phpc0de/ctlibgo/requester"
+)
+
+type (
+	// ConnectionStats 下载连接统计
+	ConnectionStats struct {
+		Opened         int64 // 新建的连接数
+		Reused         int64 // 复用的 Keep-Alive 连接数
+		HeaderBytes    int64 // 发送的请求头字节数
+		PeakConcurrent int64 // 同时使用的连接数峰值
+	}
+
+	// connGauge 统计同时使用的连接数, 由 Monitor 共享给所有 worker
+	connGauge struct {
+		active int64
+		peak   int64
+	}
+
+	// connTraceTransport 记录 worker 每个请求的连接信息
+	connTraceTransport struct {
+		http.RoundTripper
+		worker *Worker
+	}
+
+	// connTraceBody 关闭响应时释放连接计数
+	connTraceBody struct {
+		io.ReadCloser
+		once    sync.Once
+		release func()
+	}
+)
+
+func (cs ConnectionStats) String() string {
+	return fmt.Sprintf("opened: %d, reused: %d, header bytes: %d, peak concurrent: %d", cs.Opened, cs.Reused, cs.HeaderBytes, cs.PeakConcurrent)
+}
+
+func (g *connGauge) acquire() {
+	active := atomic.AddInt64(&g.active, 1)
+	for {
+		peak := atomic.LoadInt64(&g.peak)
+		if active <= peak || atomic.CompareAndSwapInt64(&g.peak, peak, active) {
+			return
+		}
+	}
+}
+
+func (g *connGauge) release() {
+	atomic.AddInt64(&g.active, -1)
+}
+
+// Peak 返回同时使用的连接数峰值
+func (g *connGauge) Peak() int64 {
+	return atomic.LoadInt64(&g.peak)
+}
+
+func (b *connTraceBody) Close() error {
+	b.once.Do(b.release)
+	return b.ReadCloser.Close()
+}
+
+// RoundTrip 获取连接时记录新建或复用, 写入请求头时累计字节数, 连接使用期间计入 connGauge
+func (t *connTraceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	wer := t.worker
+	gauge := wer.connGauge
+	acquired := false
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&wer.connStats.Reused, 1)
+			} else {
+				atomic.AddInt64(&wer.connStats.Opened, 1)
+			}
+			if gauge != nil && !acquired {
+				acquired = true
+				gauge.acquire()
+			}
+		},
+		WroteHeaderField: func(key string, value []string) {
+			n := len(key) + len(": \r\n")
+			for i, v := range value {
+				if i > 0 {
+					n += len(", ")
+				}
+				n += len(v)
+			}
+			atomic.AddInt64(&wer.connStats.HeaderBytes, int64(n))
+		},
+	}
+	resp, err := t.RoundTripper.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if !acquired {
+		return resp, err
+	}
+	if err != nil || resp == nil || resp.Body == nil {
+		gauge.release()
+		return resp, err
+	}
+	resp.Body = &connTraceBody{ReadCloser: resp.Body, release: gauge.release}
+	return resp, err
+}
+
+// traceClientConnections 统计 client 的连接信息, client 需要已经初始化 Transport
+func (wer *Worker) traceClientConnections(client *requester.HTTPClient) {
+	if client == nil || client.Transport == nil {
+		return
+	}
+	if _, ok := client.Transport.(*connTraceTransport); ok {
+		return
+	}
+	client.Transport = &connTraceTransport{RoundTripper: client.Transport, worker: wer}
+}
+
+// ConnectionStats 返回 worker 的连接统计, 不包括 PeakConcurrent
+func (wer *Worker) ConnectionStats() ConnectionStats {
+	return ConnectionStats{
+		Opened:      atomic.LoadInt64(&wer.connStats.Opened),
+		Reused:      atomic.LoadInt64(&wer.connStats.Reused),
+		HeaderBytes: atomic.LoadInt64(&wer.connStats.HeaderBytes),
+	}
+}
+
+// ConnectionStats 汇总所有 worker 的连接统计
+func (mt *Monitor) ConnectionStats() ConnectionStats {
+	stats := ConnectionStats{
+		PeakConcurrent: mt.connGauge.Peak(),
+	}
+	for _, worker := range mt.workers {
+		ws := worker.ConnectionStats()
+		stats.Opened += ws.Opened
+		stats.Reused += ws.Reused
+		stats.HeaderBytes += ws.HeaderBytes
+	}
+	return stats
+}
+
+// ConnectionStats 返回下载的连接统计
+func (der *Downloader) ConnectionStats() ConnectionStats {
+	if der.monitor == nil {
+		return ConnectionStats{}
+	}
+	return der.monitor.ConnectionStats()
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package downloader
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctpango/internal/apistat"
+)
+
+func TestDownloaderConnectionStats(t *testing.T) {
+	const parallel = 4
+	content := make([]byte, parallel*MinParallelSize)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	// 等待所有worker都建立连接后再返回数据, 保证同时使用的连接数达到 parallel
+	var (
+		mu      sync.Mutex
+		waiting int
+		ready   = make(chan struct{})
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		waiting++
+		if waiting == parallel {
+			close(ready)
+		}
+		mu.Unlock()
+		select {
+		case <-ready:
+		case <-time.After(5 * time.Second):
+		}
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	cfg := NewConfig()
+	cfg.MaxParallel = parallel
+	cfg.CacheSize = 1024
+	der := NewDownloader(file, cfg, apistat.NewPanClient(cloudpan.NewPanClient(cloudpan.WebLoginToken{}, cloudpan.AppLoginToken{})))
+	der.SetFileInfo(&cloudpan.AppFileEntity{FileId: "1", FileSize: int64(len(content))})
+	der.SetDownloadUrlFunc(func(familyId int64, fileId string) (string, error) {
+		return server.URL + "/file?id=" + fileId, nil
+	})
+	if err = der.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := der.ConnectionStats()
+	if stats.PeakConcurrent != parallel {
+		t.Errorf("peak concurrent: %d, want %d", stats.PeakConcurrent, parallel)
+	}
+	if stats.Opened < parallel || stats.HeaderBytes <= 0 {
+		t.Errorf("stats: %s", stats)
+	}
+}
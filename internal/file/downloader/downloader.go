@@ -19,15 +19,16 @@ import (
 	"github.com/phpc0de/ctapi/cloudpan"
 	"github.com/phpc0de/ctapi/cloudpan/apierror"
 	"github.com/phpc0de/ctpango/cmder/cmdutil"
+	"github.com/phpc0de/ctpango/internal/apistat"
 	"github.com/phpc0de/ctpango/internal/waitgroup"
 	"github.com/phpc0de/ctlibgo/cachepool"
 	"github.com/phpc0de/ctlibgo/logger"
-	"github.com/phpc0de/ctlibgo/prealloc"
 	"github.com/phpc0de/ctlibgo/requester"
 	"github.com/phpc0de/ctlibgo/requester/rio/speeds"
 	"github.com/phpc0de/ctpango/library/requester/transfer"
 	"io"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 )
@@ -37,6 +38,11 @@ const (
 	DefaultAcceptRanges = "bytes"
 )
 
+var (
+	// ErrSkipFirstBytesOutOfRange 指定已下载的字节数超出文件大小
+	ErrSkipFirstBytesOutOfRange = errors.New("skip first bytes out of range")
+)
+
 type (
 	// Downloader 下载
 	Downloader struct {
@@ -49,17 +55,19 @@ type (
 		onDownloadStatusEvent DownloadStatusFunc //状态处理事件
 
 		monitorCancelFunc context.CancelFunc
+		ctx               context.Context // 不为空时, ctx 结束后取消下载
 
 		fileInfo               *cloudpan.AppFileEntity      // 下载的文件信息
 		familyId               int64
 		loadBalancerCompareFunc LoadBalancerCompareFunc // 负载均衡检测函数
 		durlCheckFunc           DURLCheckFunc           // 下载url检测函数
 		statusCodeBodyCheckFunc StatusCodeBodyCheckFunc
+		downloadUrlFunc         DownloadUrlFunc // 获取下载链接的函数
 		executeTime             time.Time
 		loadBalansers           []string
 		writer                  io.WriterAt
 		client                  *requester.HTTPClient
-		panClient               *cloudpan.PanClient
+		panClient               *apistat.PanClient
 		config                  *Config
 		monitor                 *Monitor
 		instanceState           *InstanceState
@@ -69,10 +77,12 @@ type (
 	DURLCheckFunc func(client *requester.HTTPClient, durl string) (contentLength int64, resp *http.Response, err error)
 	// StatusCodeBodyCheckFunc 响应状态码出错的检查函数
 	StatusCodeBodyCheckFunc func(respBody io.Reader) error
+	// DownloadUrlFunc 获取文件下载链接的函数
+	DownloadUrlFunc func(familyId int64, fileId string) (durl string, err error)
 )
 
 //NewDownloader 初始化Downloader
-func NewDownloader(writer io.WriterAt, config *Config, p *cloudpan.PanClient) (der *Downloader) {
+func NewDownloader(writer io.WriterAt, config *Config, p *apistat.PanClient) (der *Downloader) {
 	der = &Downloader{
 		config: config,
 		writer: writer,
@@ -106,6 +116,31 @@ func (der *Downloader) SetStatusCodeBodyCheckFunc(f StatusCodeBodyCheckFunc) {
 	der.statusCodeBodyCheckFunc = f
 }
 
+// SetContext 设置下载的 context, ctx 结束(超时或取消)后停止下载, Execute 返回 ctx.Err()
+func (der *Downloader) SetContext(ctx context.Context) {
+	der.ctx = ctx
+}
+
+// SetDownloadUrlFunc 设置获取下载链接的函数, 默认通过 PanClient 获取
+func (der *Downloader) SetDownloadUrlFunc(f DownloadUrlFunc) {
+	der.downloadUrlFunc = f
+}
+
+// panDownloadUrl 通过 PanClient 获取下载链接
+func (der *Downloader) panDownloadUrl(familyId int64, fileId string) (string, error) {
+	var durl string
+	var apierr *apierror.ApiError
+	if familyId > 0 {
+		durl, apierr = der.panClient.AppFamilyGetFileDownloadUrl(familyId, fileId)
+	} else {
+		durl, apierr = der.panClient.AppGetFileDownloadUrl(fileId)
+	}
+	if apierr != nil {
+		return "", apierr
+	}
+	return durl, nil
+}
+
 func (der *Downloader) lazyInit() {
 	if der.config == nil {
 		der.config = NewConfig()
@@ -123,6 +158,12 @@ func (der *Downloader) lazyInit() {
 	if der.loadBalancerCompareFunc == nil {
 		der.loadBalancerCompareFunc = DefaultLoadBalancerCompareFunc
 	}
+	if der.downloadUrlFunc == nil {
+		der.downloadUrlFunc = der.panDownloadUrl
+	}
+	if der.ctx == nil {
+		der.ctx = context.Background()
+	}
 }
 
 // SelectParallel 获取合适的 parallel
@@ -156,17 +197,17 @@ func (der *Downloader) SelectBlockSizeAndInitRangeGen(single bool, status *trans
 	if gen == nil {
 		switch der.config.Mode {
 		case transfer.RangeGenMode_Default:
-			gen = transfer.NewRangeListGenDefault(status.TotalSize(), 0, 0, parallel)
+			gen = transfer.NewRangeListGenDefault(status.TotalSize(), der.config.SkipFirstBytes, 0, parallel)
 			blockSize = gen.LoadBlockSize()
 		case transfer.RangeGenMode_BlockSize:
-			b2 := status.TotalSize()/int64(parallel) + 1
+			b2 := (status.TotalSize()-der.config.SkipFirstBytes)/int64(parallel) + 1
 			if b2 > der.config.BlockSize { // 选小的BlockSize, 以更高并发
 				blockSize = der.config.BlockSize
 			} else {
 				blockSize = b2
 			}
 
-			gen = transfer.NewRangeListGenBlockSize(status.TotalSize(), 0, blockSize)
+			gen = transfer.NewRangeListGenBlockSize(status.TotalSize(), der.config.SkipFirstBytes, blockSize)
 		default:
 			initErr = transfer.ErrUnknownRangeGenMode
 			return
@@ -201,10 +242,14 @@ func DefaultDURLCheckFunc(client *requester.HTTPClient, durl string) (contentLen
 	return resp.ContentLength, resp, nil
 }
 
-func (der *Downloader) checkLoadBalancers() *LoadBalancerResponseList {
+// checkLoadBalancers 检测负载均衡服务器, firstURL 为第一个下载链接, 始终排在第一位,
+// 其余可用的服务器按响应时间从快到慢排列
+func (der *Downloader) checkLoadBalancers(firstURL string) *LoadBalancerResponseList {
 	var (
 		loadBalancerResponses = make([]*LoadBalancerResponse, 0, len(der.loadBalansers)+1)
-		handleLoadBalancer    = func(req *http.Request) {
+		latencies             = make(map[*LoadBalancerResponse]time.Duration, len(der.loadBalansers))
+		mu                    sync.Mutex
+		handleLoadBalancer    = func(req *http.Request, latency time.Duration) {
 			if req == nil {
 				return
 			}
@@ -217,18 +262,25 @@ func (der *Downloader) checkLoadBalancers() *LoadBalancerResponseList {
 				URL:     req.URL.String(),
 			}
 
+			mu.Lock()
 			loadBalancerResponses = append(loadBalancerResponses, loadBalancer)
-			logger.Verbosef("DEBUG: load balance task: URL: %s", loadBalancer.URL)
+			latencies[loadBalancer] = latency
+			mu.Unlock()
+			logger.Verbosef("DEBUG: load balance task: URL: %s, latency: %s", loadBalancer.URL, latency)
 		}
 	)
 
 	// 加入第一个
 	loadBalancerResponses = append(loadBalancerResponses, &LoadBalancerResponse{
-		URL: "der.durl",
+		URL: firstURL,
 	})
 
 	// 负载均衡
-	wg := waitgroup.NewWaitGroup(10)
+	maxParallel := der.config.MaxLBCheckParallel
+	if maxParallel < 1 {
+		maxParallel = DefaultMaxLBCheckParallel
+	}
+	wg := waitgroup.NewWaitGroup(maxParallel)
 	privTimeout := der.client.Client.Timeout
 	der.client.SetTimeout(5 * time.Second)
 	for _, loadBalanser := range der.loadBalansers {
@@ -236,7 +288,9 @@ func (der *Downloader) checkLoadBalancers() *LoadBalancerResponseList {
 		go func(loadBalanser string) {
 			defer wg.Done()
 
+			checkStart := time.Now()
 			subContentLength, subResp, subErr := der.durlCheckFunc(der.client, loadBalanser)
+			latency := time.Since(checkStart)
 			if subResp != nil {
 				subResp.Body.Close() // 不读Body, 马上关闭连接
 			}
@@ -270,12 +324,18 @@ func (der *Downloader) checkLoadBalancers() *LoadBalancerResponseList {
 			//	return
 			//}
 
-			handleLoadBalancer(subResp.Request)
+			handleLoadBalancer(subResp.Request, latency)
 		}(loadBalanser)
 	}
 	wg.Wait()
 	der.client.SetTimeout(privTimeout)
 
+	// 第一个之后按响应时间排序, 响应最快的优先使用
+	subResponses := loadBalancerResponses[1:]
+	sort.SliceStable(subResponses, func(i, j int) bool {
+		return latencies[subResponses[i]] < latencies[subResponses[j]]
+	})
+
 	loadBalancerResponseList := NewLoadBalancerResponseList(loadBalancerResponses)
 	return loadBalancerResponseList
 }
@@ -285,8 +345,7 @@ func (der *Downloader) Execute() error {
 	der.lazyInit()
 
 	var (
-		loadBalancerResponseList = der.checkLoadBalancers()
-		bii                      *transfer.DownloadInstanceInfo
+		bii *transfer.DownloadInstanceInfo
 	)
 
 	err := der.initInstanceState(der.config.InstanceStateStorageFormat)
@@ -294,6 +353,20 @@ func (der *Downloader) Execute() error {
 		return err
 	}
 	bii = der.instanceState.Get()
+	if der.config.SkipFirstBytes > 0 {
+		if der.config.SkipFirstBytes >= der.fileInfo.FileSize {
+			return ErrSkipFirstBytesOutOfRange
+		}
+		// 手动指定已下载的字节数, 忽略断点续传信息
+		bii = nil
+	}
+
+	// 第一个下载链接作为负载均衡列表的第一个服务器
+	firstURL, err := der.downloadUrlFunc(der.familyId, der.fileInfo.FileId)
+	if err != nil {
+		return err
+	}
+	loadBalancerResponseList := der.checkLoadBalancers(firstURL)
 
 	var (
 		isInstance = bii != nil // 是否存在断点信息
@@ -311,17 +384,37 @@ func (der *Downloader) Execute() error {
 		// 新建状态
 		status = transfer.NewDownloadStatus()
 		status.SetTotalSize(der.fileInfo.FileSize)
+		status.AddDownloaded(der.config.SkipFirstBytes)
+	}
+
+	// 设置计算速度的滑动窗口
+	if der.config.SpeedSamplingWindow > 0 {
+		status.SetSpeedsWindow(der.config.SpeedSamplingWindow)
+	} else {
+		status.SetSpeedsWindow(DefaultSpeedSamplingWindow)
 	}
 
 	// 设置限速
-	if der.config.MaxRate > 0 {
+	if der.config.RateSchedule != nil {
+		srl := transfer.NewScheduledRateLimit(der.config.RateSchedule)
+		status.SetRateLimit(srl)
+		defer srl.Stop()
+
+		// 按时间段调整限速
+		scheduleCtx, scheduleCancelFunc := context.WithCancel(context.Background())
+		defer scheduleCancelFunc()
+		go srl.Run(scheduleCtx)
+	} else if der.config.MaxRate > 0 {
 		rl := speeds.NewRateLimit(der.config.MaxRate)
 		status.SetRateLimit(rl)
 		defer rl.Stop()
 	}
 
+	// 测量可用带宽, 调整并发量
+	der.applyBandwidthTest()
+
 	// 数据处理
-	parallel := der.SelectParallel(single, der.config.MaxParallel, status.TotalSize(), bii.Ranges) // 实际的下载并行量
+	parallel := der.SelectParallel(single, der.config.MaxParallel, status.TotalSize()-der.config.SkipFirstBytes, bii.Ranges) // 实际的下载并行量
 	blockSize, err := der.SelectBlockSizeAndInitRangeGen(single, status, parallel)                 // 实际的BlockSize
 	if err != nil {
 		return err
@@ -335,13 +428,13 @@ func (der *Downloader) Execute() error {
 	der.monitor.InitMonitorCapacity(parallel)
 
 	var writer Writer
-	// 尝试修剪文件
-	if fder, ok := der.writer.(Fder); ok {
-		err = prealloc.PreAlloc(fder.Fd(), status.TotalSize())
-		if err != nil {
-			logger.Verbosef("DEBUG: truncate file error: %s\n", err)
-		}
+	// 预分配文件空间
+	strategy, err := preallocFile(der.writer, status.TotalSize())
+	if err != nil {
+		logger.Verbosef("DEBUG: prealloc file error, strategy: %s, %s\n", strategy, err)
+		return err
 	}
+	logger.Verbosef("DEBUG: prealloc file strategy: %s\n", strategy)
 	writer = der.writer
 
 	// 数据平均分配给各个线程
@@ -351,7 +444,7 @@ func (der *Downloader) Execute() error {
 		// 分配线程
 		bii.Ranges = make(transfer.RangeList, 0, parallel)
 		if single { // 单线程
-			bii.Ranges = append(bii.Ranges, &transfer.Range{Begin: 0, End: der.fileInfo.FileSize})
+			bii.Ranges = append(bii.Ranges, &transfer.Range{Begin: der.config.SkipFirstBytes, End: der.fileInfo.FileSize})
 		} else {
 			gen := status.RangeListGen()
 			for i := 0; i < cap(bii.Ranges); i++ {
@@ -373,18 +466,17 @@ func (der *Downloader) Execute() error {
 			continue
 		}
 
-		// 获取下载链接
-		var durl string
-		var apierr *apierror.ApiError
-		if der.familyId > 0 {
-			durl, apierr = der.panClient.AppFamilyGetFileDownloadUrl(der.familyId, der.fileInfo.FileId)
+		// 获取下载链接, 第一个worker使用已获取的第一个下载链接
+		durl := firstURL
+		if durl != "" {
+			firstURL = ""
 		} else {
-			durl, apierr = der.panClient.AppGetFileDownloadUrl(der.fileInfo.FileId)
-		}
-		time.Sleep(time.Duration(200) * time.Millisecond)
-		if apierr != nil {
-			logger.Verbosef("ERROR: get download url error: %s\n", der.fileInfo.FileId)
-			continue
+			durl, err = der.downloadUrlFunc(der.familyId, der.fileInfo.FileId)
+			time.Sleep(time.Duration(200) * time.Millisecond)
+			if err != nil {
+				logger.Verbosef("ERROR: get download url error: %s\n", der.fileInfo.FileId)
+				continue
+			}
 		}
 		logger.Verbosef("work id: %d, download url: %s\n", k, durl)
 		client := requester.NewHTTPClient()
@@ -394,6 +486,8 @@ func (der *Downloader) Execute() error {
 		worker := NewWorker(k, der.familyId, der.fileInfo.FileId, durl, writer)
 		worker.SetClient(client)
 		worker.SetPanClient(der.panClient)
+		worker.SetDownloadUrlFunc(der.downloadUrlFunc)
+		worker.SetLoadBalancer(loadBalancerResponseList, loadBalancer.URL)
 		worker.SetWriteMutex(writeMu)
 		worker.SetTotalSize(der.fileInfo.FileSize)
 
@@ -407,7 +501,7 @@ func (der *Downloader) Execute() error {
 	// 服务器不支持断点续传, 或者单线程下载, 都不重载worker
 	der.monitor.SetReloadWorker(parallel > 1)
 
-	moniterCtx, moniterCancelFunc := context.WithCancel(context.Background())
+	moniterCtx, moniterCancelFunc := context.WithCancel(der.ctx)
 	der.monitorCancelFunc = moniterCancelFunc
 
 	der.monitor.SetInstanceState(der.instanceState)
@@ -416,11 +510,23 @@ func (der *Downloader) Execute() error {
 	der.executeTime = time.Now()
 	cmdutil.Trigger(der.onExecuteEvent)
 	der.downloadStatusEvent() // 启动执行状态处理事件
+	adaptiveCtx, adaptiveCancelFunc := context.WithCancel(moniterCtx)
+	if der.config.Adaptive && parallel > 1 {
+		go der.adaptiveParallelController(adaptiveCtx, status, parallel) // 启动自适应并发调整
+	}
+	if der.config.InterfaceChangeDetection {
+		go der.interfaceChangeWatcher(adaptiveCtx) // 启动网络地址变化检测
+	}
 	der.monitor.Execute(moniterCtx)
+	adaptiveCancelFunc()
+	logger.Verbosef("DEBUG: download task connection stats: %s\n", der.monitor.ConnectionStats())
 
 	// 检查错误
 	err = der.monitor.Err()
-	if err == nil { // 成功
+	if ctxErr := der.ctx.Err(); ctxErr != nil {
+		// 超时或被取消, 保留断点信息
+		err = ctxErr
+	} else if err == nil { // 成功
 		cmdutil.Trigger(der.onSuccessEvent)
 		der.removeInstanceState() // 移除断点续传文件
 	} else {
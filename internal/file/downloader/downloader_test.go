@@ -0,0 +1,224 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctpango/internal/apistat"
+)
+
+func TestDownloaderContextTimeout(t *testing.T) {
+	// 模拟卡住的服务器, 一直不返回数据
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer func() {
+		close(release)
+		server.CloseClientConnections()
+		server.Close()
+	}()
+
+	dir, err := ioutil.TempDir("", "downloader-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file, err := os.Create(filepath.Join(dir, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	cfg := NewConfig()
+	cfg.MaxParallel = 1
+	cfg.CacheSize = 1024
+	der := NewDownloader(file, cfg, apistat.NewPanClient(cloudpan.NewPanClient(cloudpan.WebLoginToken{}, cloudpan.AppLoginToken{})))
+	der.SetFileInfo(&cloudpan.AppFileEntity{FileId: "1", FileSize: 1024 * 1024})
+	der.SetDownloadUrlFunc(func(familyId int64, fileId string) (string, error) {
+		return server.URL + "/file?id=" + fileId, nil
+	})
+
+	const timeout = 1 * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	der.SetContext(ctx)
+
+	start := time.Now()
+	err = der.Execute()
+	elapsed := time.Since(start)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got err %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed < timeout || elapsed > timeout+500*time.Millisecond {
+		t.Fatalf("timeout fired after %s, want within 500ms of %s", elapsed, timeout)
+	}
+}
+
+func TestDownloaderSkipFirstBytes(t *testing.T) {
+	content := make([]byte, 512*1024)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	const skip = 300 * 1024
+	var minBegin int64 = -1
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var begin int64
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &begin)
+		mu.Lock()
+		if minBegin < 0 || begin < minBegin {
+			minBegin = begin
+		}
+		mu.Unlock()
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	// 本地文件已有前 skip 字节
+	file.Write(content[:skip])
+
+	cfg := NewConfig()
+	cfg.MaxParallel = 2
+	cfg.CacheSize = 1024
+	cfg.SkipFirstBytes = skip
+	der := NewDownloader(file, cfg, apistat.NewPanClient(cloudpan.NewPanClient(cloudpan.WebLoginToken{}, cloudpan.AppLoginToken{})))
+	der.SetFileInfo(&cloudpan.AppFileEntity{FileId: "1", FileSize: int64(len(content))})
+	der.SetDownloadUrlFunc(func(familyId int64, fileId string) (string, error) {
+		return server.URL + "/file?id=" + fileId, nil
+	})
+	if err = der.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if minBegin < skip {
+		t.Errorf("downloaded from offset %d, want >= %d", minBegin, skip)
+	}
+	data, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("downloaded file mismatch, size: %d", len(data))
+	}
+
+	cfg.SkipFirstBytes = int64(len(content))
+	der = NewDownloader(file, cfg, apistat.NewPanClient(cloudpan.NewPanClient(cloudpan.WebLoginToken{}, cloudpan.AppLoginToken{})))
+	der.SetFileInfo(&cloudpan.AppFileEntity{FileId: "1", FileSize: int64(len(content))})
+	if err = der.Execute(); err != ErrSkipFirstBytesOutOfRange {
+		t.Errorf("got err %v, want %v", err, ErrSkipFirstBytesOutOfRange)
+	}
+}
+
+func TestWorkerRefreshDownloadUrlOnAuthFailure(t *testing.T) {
+	content := make([]byte, 64*1024)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	// 第一个下载链接返回 401, 重新获取的下载链接正常
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("v") == "1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var (
+		urlCalls int
+		mu       sync.Mutex
+	)
+	cfg := NewConfig()
+	cfg.MaxParallel = 1
+	cfg.CacheSize = 1024
+	der := NewDownloader(file, cfg, apistat.NewPanClient(cloudpan.NewPanClient(cloudpan.WebLoginToken{}, cloudpan.AppLoginToken{})))
+	der.SetFileInfo(&cloudpan.AppFileEntity{FileId: "1", FileSize: int64(len(content))})
+	der.SetDownloadUrlFunc(func(familyId int64, fileId string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		urlCalls++
+		return fmt.Sprintf("%s/file?id=%s&v=%d", server.URL, fileId, urlCalls), nil
+	})
+	if err = der.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if urlCalls != 2 {
+		t.Errorf("download url fetched %d times, want 2", urlCalls)
+	}
+	data, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("downloaded file mismatch, size: %d", len(data))
+	}
+}
+
+func TestWorkerAuthRetriesExhausted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var urlCalls int
+	cfg := NewConfig()
+	cfg.MaxParallel = 1
+	cfg.CacheSize = 1024
+	der := NewDownloader(file, cfg, apistat.NewPanClient(cloudpan.NewPanClient(cloudpan.WebLoginToken{}, cloudpan.AppLoginToken{})))
+	der.SetFileInfo(&cloudpan.AppFileEntity{FileId: "1", FileSize: 64 * 1024})
+	der.SetDownloadUrlFunc(func(familyId int64, fileId string) (string, error) {
+		urlCalls++
+		return server.URL + "/file?id=" + fileId, nil
+	})
+	if err = der.Execute(); err != ErrAuthExpired {
+		t.Fatalf("got err %v, want %v", err, ErrAuthExpired)
+	}
+	// 第一次获取下载链接, 加上重试的次数
+	if urlCalls != 1+DefaultWorkerMaxAuthRetries {
+		t.Errorf("download url fetched %d times, want %d", urlCalls, 1+DefaultWorkerMaxAuthRetries)
+	}
+}
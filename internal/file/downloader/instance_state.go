@@ -147,6 +147,17 @@ func (is *InstanceState) Close() error {
 	return is.saveFile.Close()
 }
 
+// LoadInstanceInfo 读取断点续传文件中的信息, 文件不存在或无法解析时返回 nil
+func LoadInstanceInfo(path string) *transfer.DownloadInstanceInfo {
+	saveFile, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	is := NewInstanceState(saveFile, InstanceStateStorageFormatJSON)
+	defer is.Close()
+	return is.Get()
+}
+
 func (der *Downloader) initInstanceState(format InstanceStateStorageFormat) (err error) {
 	if der.instanceState != nil {
 		return errors.New("already initInstanceState")
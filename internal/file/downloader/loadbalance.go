@@ -15,7 +15,16 @@ package downloader
 
 import (
 	"net/http"
-	"sync/atomic"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// LoadBalancerMaxFailures 失败次数达到该值的负载均衡服务器不再使用
+	LoadBalancerMaxFailures = 3
+	// LoadBalancerSlowFactor 延迟超过平均延迟的该倍数时, 降低负载均衡服务器的优先级
+	LoadBalancerSlowFactor = 2
 )
 
 type (
@@ -24,10 +33,18 @@ type (
 		URL     string
 	}
 
-	// LoadBalancerResponseList 负载均衡列表
+	// loadBalancerHealth 负载均衡服务器的健康状态
+	loadBalancerHealth struct {
+		failures int
+		latency  time.Duration // 最近一次请求的延迟, 0为未记录
+	}
+
+	// LoadBalancerResponseList 负载均衡列表, 多个worker共享, 线程安全
 	LoadBalancerResponseList struct {
 		lbr    []*LoadBalancerResponse
-		cursor int32
+		cursor int
+		health map[string]*loadBalancerHealth
+		mu     sync.Mutex
 	}
 
 	LoadBalancerCompareFunc func(info map[string]string, subResp *http.Response) bool
@@ -36,23 +53,95 @@ type (
 // NewLoadBalancerResponseList 初始化负载均衡列表
 func NewLoadBalancerResponseList(lbr []*LoadBalancerResponse) *LoadBalancerResponseList {
 	return &LoadBalancerResponseList{
-		lbr: lbr,
+		lbr:    lbr,
+		health: map[string]*loadBalancerHealth{},
+	}
+}
+
+func (lbrl *LoadBalancerResponseList) getHealth(url string) *loadBalancerHealth {
+	h, ok := lbrl.health[url]
+	if !ok {
+		h = &loadBalancerHealth{}
+		lbrl.health[url] = h
+	}
+	return h
+}
+
+// MarkFailed 记录一次请求失败, 失败 LoadBalancerMaxFailures 次后不再使用该服务器
+func (lbrl *LoadBalancerResponseList) MarkFailed(url string) {
+	lbrl.mu.Lock()
+	defer lbrl.mu.Unlock()
+	lbrl.getHealth(url).failures++
+}
+
+// MarkSlow 记录一次请求的延迟, 延迟超过平均延迟 LoadBalancerSlowFactor 倍的服务器优先级降低
+func (lbrl *LoadBalancerResponseList) MarkSlow(url string, latency time.Duration) {
+	lbrl.mu.Lock()
+	defer lbrl.mu.Unlock()
+	lbrl.getHealth(url).latency = latency
+}
+
+// isFailed 是否已从轮询中移除, 调用时需持有锁
+func (lbrl *LoadBalancerResponseList) isFailed(url string) bool {
+	h, ok := lbrl.health[url]
+	return ok && h.failures >= LoadBalancerMaxFailures
+}
+
+// isSlow 延迟是否超过可用服务器平均延迟的 LoadBalancerSlowFactor 倍, 调用时需持有锁
+func (lbrl *LoadBalancerResponseList) isSlow(url string) bool {
+	h, ok := lbrl.health[url]
+	if !ok || h.latency <= 0 {
+		return false
+	}
+	var (
+		total time.Duration
+		count int
+	)
+	for _, lb := range lbrl.lbr {
+		if lbh, ok := lbrl.health[lb.URL]; ok && lbh.latency > 0 && !lbrl.isFailed(lb.URL) {
+			total += lbh.latency
+			count++
+		}
 	}
+	return count > 1 && h.latency*time.Duration(count) > total*LoadBalancerSlowFactor
 }
 
-// SequentialGet 顺序获取
+// Healthy 服务器是否仍在轮询中
+func (lbrl *LoadBalancerResponseList) Healthy(url string) bool {
+	lbrl.mu.Lock()
+	defer lbrl.mu.Unlock()
+	return !lbrl.isFailed(url)
+}
+
+// SequentialGet 顺序获取, 跳过已失败的服务器, 优先返回不慢的服务器, 全部失败时返回 nil
 func (lbrl *LoadBalancerResponseList) SequentialGet() *LoadBalancerResponse {
+	lbrl.mu.Lock()
+	defer lbrl.mu.Unlock()
 	if len(lbrl.lbr) == 0 {
 		return nil
 	}
 
-	if int(lbrl.cursor) >= len(lbrl.lbr) {
-		lbrl.cursor = 0
+	slow := -1
+	for i := 0; i < len(lbrl.lbr); i++ {
+		idx := (lbrl.cursor + i) % len(lbrl.lbr)
+		lb := lbrl.lbr[idx]
+		if lbrl.isFailed(lb.URL) {
+			continue
+		}
+		if lbrl.isSlow(lb.URL) {
+			if slow < 0 {
+				slow = idx
+			}
+			continue
+		}
+		lbrl.cursor = idx + 1
+		return lb
 	}
-
-	lbr := lbrl.lbr[int(lbrl.cursor)]
-	atomic.AddInt32(&lbrl.cursor, 1)
-	return lbr
+	if slow < 0 {
+		return nil
+	}
+	lbrl.cursor = slow + 1
+	return lbrl.lbr[slow]
 }
 
 // RandomGet 随机获取
@@ -60,6 +149,20 @@ func (lbrl *LoadBalancerResponseList) RandomGet() *LoadBalancerResponse {
 	return lbrl.lbr[RandomNumber(0, len(lbrl.lbr))]
 }
 
+// replaceURLHost 把 rawURL 的协议和域名换成 serverURL 的, 路径和参数不变, 解析失败时返回 rawURL
+func replaceURLHost(rawURL, serverURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	s, err := url.Parse(serverURL)
+	if err != nil || s.Host == "" {
+		return rawURL
+	}
+	u.Scheme, u.Host = s.Scheme, s.Host
+	return u.String()
+}
+
 // AddLoadBalanceServer 增加负载均衡服务器
 func (der *Downloader) AddLoadBalanceServer(urls ...string) {
 	der.loadBalansers = append(der.loadBalansers, urls...)
@@ -0,0 +1,248 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package downloader
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctlibgo/requester"
+	"github.com/phpc0de/ctpango/internal/apistat"
+)
+
+func newTestLoadBalancerList(urls ...string) *LoadBalancerResponseList {
+	lbr := make([]*LoadBalancerResponse, 0, len(urls))
+	for _, url := range urls {
+		lbr = append(lbr, &LoadBalancerResponse{URL: url})
+	}
+	return NewLoadBalancerResponseList(lbr)
+}
+
+func sequentialGetURLs(lbrl *LoadBalancerResponseList, n int) (urls []string) {
+	for i := 0; i < n; i++ {
+		lb := lbrl.SequentialGet()
+		if lb == nil {
+			urls = append(urls, "")
+			continue
+		}
+		urls = append(urls, lb.URL)
+	}
+	return
+}
+
+func TestLoadBalancerMarkFailed(t *testing.T) {
+	lbrl := newTestLoadBalancerList("a", "b", "c")
+	if urls := sequentialGetURLs(lbrl, 4); urls[0] != "a" || urls[1] != "b" || urls[2] != "c" || urls[3] != "a" {
+		t.Fatalf("rotation: %v", urls)
+	}
+
+	// 失败2次仍在轮询中, 3次后移除
+	lbrl.MarkFailed("b")
+	lbrl.MarkFailed("b")
+	if !lbrl.Healthy("b") {
+		t.Fatalf("b should still be healthy")
+	}
+	lbrl.MarkFailed("b")
+	if lbrl.Healthy("b") {
+		t.Fatalf("b should be removed")
+	}
+	for _, url := range sequentialGetURLs(lbrl, 6) {
+		if url == "b" || url == "" {
+			t.Fatalf("unexpected url %q", url)
+		}
+	}
+
+	for i := 0; i < LoadBalancerMaxFailures; i++ {
+		lbrl.MarkFailed("a")
+		lbrl.MarkFailed("c")
+	}
+	if lb := lbrl.SequentialGet(); lb != nil {
+		t.Fatalf("all failed, got %s", lb.URL)
+	}
+}
+
+func TestLoadBalancerMarkSlow(t *testing.T) {
+	lbrl := newTestLoadBalancerList("a", "b", "c")
+	lbrl.MarkSlow("a", 100*time.Millisecond)
+	lbrl.MarkSlow("b", 1000*time.Millisecond)
+	lbrl.MarkSlow("c", 100*time.Millisecond)
+
+	// b 的延迟超过平均值的2倍, 优先使用 a 和 c
+	for _, url := range sequentialGetURLs(lbrl, 6) {
+		if url == "b" {
+			t.Fatalf("slow lb should be deprioritized")
+		}
+	}
+
+	// 其他服务器都失败时仍然使用慢的服务器
+	for i := 0; i < LoadBalancerMaxFailures; i++ {
+		lbrl.MarkFailed("a")
+		lbrl.MarkFailed("c")
+	}
+	if lb := lbrl.SequentialGet(); lb == nil || lb.URL != "b" {
+		t.Fatalf("expected slow lb b, got %v", lb)
+	}
+}
+
+func TestLoadBalancerConcurrent(t *testing.T) {
+	lbrl := newTestLoadBalancerList("a", "b", "c", "d")
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				lb := lbrl.SequentialGet()
+				if lb == nil {
+					continue
+				}
+				if i%2 == 0 {
+					lbrl.MarkSlow(lb.URL, time.Duration(j)*time.Millisecond)
+				} else {
+					lbrl.MarkFailed("d")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if lbrl.Healthy("d") {
+		t.Fatalf("d should be removed")
+	}
+}
+
+func TestCheckLoadBalancersMaxParallel(t *testing.T) {
+	var (
+		delays = map[string]time.Duration{
+			"http://lb1/file": 60 * time.Millisecond,
+			"http://lb2/file": 40 * time.Millisecond,
+			"http://lb3/file": 5 * time.Millisecond,
+			"http://lb4/file": 80 * time.Millisecond,
+			"http://lb5/file": 20 * time.Millisecond,
+		}
+		mu       sync.Mutex
+		running  int
+		maxSeen  int
+		checked  = map[string]bool{}
+		fileSize = int64(1024)
+	)
+
+	cfg := NewConfig()
+	cfg.MaxLBCheckParallel = 2
+	der := NewDownloader(nil, cfg, nil)
+	der.SetFileInfo(&cloudpan.AppFileEntity{FileId: "1", FileSize: fileSize})
+	der.lazyInit()
+	der.durlCheckFunc = func(client *requester.HTTPClient, durl string) (int64, *http.Response, error) {
+		mu.Lock()
+		running++
+		if running > maxSeen {
+			maxSeen = running
+		}
+		checked[durl] = true
+		mu.Unlock()
+
+		time.Sleep(delays[durl])
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+
+		req, err := http.NewRequest(http.MethodGet, durl, nil)
+		if err != nil {
+			return 0, nil, err
+		}
+		return fileSize, &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+			Request:    req,
+		}, nil
+	}
+	for _, u := range []string{"http://lb1/file", "http://lb2/file", "http://lb3/file", "http://lb4/file", "http://lb5/file"} {
+		der.AddLoadBalanceServer(u)
+	}
+
+	lbrl := der.checkLoadBalancers("http://main/file")
+	if len(checked) != 5 {
+		t.Errorf("checked %d load balancers, want 5", len(checked))
+	}
+	if maxSeen > 2 {
+		t.Errorf("max parallel checks %d, want <= 2", maxSeen)
+	}
+	if len(lbrl.lbr) != 6 {
+		t.Fatalf("got %d load balancers, want 6", len(lbrl.lbr))
+	}
+	if lbrl.lbr[0].URL != "http://main/file" {
+		t.Errorf("first url = %s, want http://main/file", lbrl.lbr[0].URL)
+	}
+	if lbrl.lbr[1].URL != "http://lb3/file" {
+		t.Errorf("fastest load balancer = %s, want http://lb3/file", lbrl.lbr[1].URL)
+	}
+}
+
+func TestReplaceURLHost(t *testing.T) {
+	got := replaceURLHost("https://a.example.com/file/1?sig=abc", "http://b.example.com:8080/other")
+	if got != "http://b.example.com:8080/file/1?sig=abc" {
+		t.Fatalf("got %s", got)
+	}
+	if got = replaceURLHost("https://a.example.com/file/1", "::"); got != "https://a.example.com/file/1" {
+		t.Fatalf("invalid server url: got %s", got)
+	}
+}
+
+func TestWorkerSwitchServer(t *testing.T) {
+	var failedHits, hits int32
+	failed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failedHits, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failed.Close()
+	var gotPath, gotSig string
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		gotPath, gotSig = r.URL.Path, r.URL.Query().Get("sig")
+		w.Write([]byte("hello"))
+	}))
+	defer healthy.Close()
+
+	lbrl := newTestLoadBalancerList(failed.URL, healthy.URL)
+	for i := 0; i < LoadBalancerMaxFailures; i++ {
+		lbrl.MarkFailed(failed.URL)
+	}
+
+	file, err := ioutil.TempFile(t.TempDir(), "worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	wer := NewWorker(0, 0, "1", failed.URL+"/file/1?sig=abc", file)
+	wer.SetPanClient(apistat.NewPanClient(cloudpan.NewPanClient(cloudpan.WebLoginToken{}, cloudpan.AppLoginToken{})))
+	wer.SetLoadBalancer(lbrl, failed.URL)
+	wer.SetWriteMutex(&sync.Mutex{})
+	wer.SetTotalSize(5)
+	wer.Execute()
+
+	if atomic.LoadInt32(&failedHits) != 0 || atomic.LoadInt32(&hits) != 1 {
+		t.Fatalf("failed server hits %d, healthy server hits %d", failedHits, hits)
+	}
+	if gotPath != "/file/1" || gotSig != "abc" {
+		t.Fatalf("got path %s, sig %s", gotPath, gotSig)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package downloader
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+const (
+	// LockFileSuffix 下载锁文件后缀
+	LockFileSuffix = ".lock"
+
+	// DefaultLockTimeout 获取下载锁的默认超时时间
+	DefaultLockTimeout = 2 * time.Second
+
+	lockRetryInterval = 50 * time.Millisecond
+)
+
+var (
+	// ErrFileLocked 文件已被其他进程锁定
+	ErrFileLocked = errors.New("file is locked by another process")
+)
+
+// FileLock 文件锁, 用于防止多个进程同时下载同一个文件
+type FileLock struct {
+	path string
+	file *os.File
+}
+
+// LockFile 获取 path 的独占锁, 锁文件不存在时自动创建,
+// 在 timeout 内无法获取锁时返回 ErrFileLocked
+func LockFile(path string, timeout time.Duration) (*FileLock, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0666)
+		if err != nil {
+			return nil, err
+		}
+
+		err = tryLockFile(file)
+		if err == nil {
+			if isSameLockFile(path, file) {
+				return &FileLock{
+					path: path,
+					file: file,
+				}, nil
+			}
+			// 锁文件已被持有者删除, 重新打开后再获取
+			unlockFile(file)
+			err = ErrFileLocked
+		}
+		file.Close()
+		if err != ErrFileLocked || !time.Now().Before(deadline) {
+			return nil, err
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// isSameLockFile 判断已打开的锁文件是否仍然是 path 指向的文件
+func isSameLockFile(path string, file *os.File) bool {
+	pathInfo, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return os.SameFile(pathInfo, fileInfo)
+}
+
+// Path 返回锁文件路径
+func (fl *FileLock) Path() string {
+	return fl.path
+}
+
+// Unlock 释放锁并删除锁文件
+func (fl *FileLock) Unlock() error {
+	if fl == nil || fl.file == nil {
+		return nil
+	}
+	// 先删除再释放锁, 避免删除其他进程刚获取的锁文件
+	os.Remove(fl.path)
+	err := unlockFile(fl.file)
+	if cerr := fl.file.Close(); err == nil {
+		err = cerr
+	}
+	fl.file = nil
+	return err
+}
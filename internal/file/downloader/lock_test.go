@@ -0,0 +1,103 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package downloader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockFileMutualExclusion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lockPath := filepath.Join(dir, "file.bin"+LockFileSuffix)
+
+	fl, err := LockFile(lockPath, DefaultLockTimeout)
+	if err != nil {
+		t.Fatalf("LockFile: %s", err)
+	}
+
+	start := time.Now()
+	_, err = LockFile(lockPath, 200*time.Millisecond)
+	if err != ErrFileLocked {
+		t.Fatalf("second LockFile err = %v, want ErrFileLocked", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("second LockFile returned after %s, want to wait for the timeout", elapsed)
+	}
+
+	if err = fl.Unlock(); err != nil {
+		t.Fatalf("Unlock: %s", err)
+	}
+
+	fl2, err := LockFile(lockPath, DefaultLockTimeout)
+	if err != nil {
+		t.Fatalf("LockFile after Unlock: %s", err)
+	}
+	if err = fl2.Unlock(); err != nil {
+		t.Fatalf("Unlock: %s", err)
+	}
+	if _, err = os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("lock file still exists after Unlock, err = %v", err)
+	}
+}
+
+func TestLockFileConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lockPath := filepath.Join(dir, "file.bin"+LockFileSuffix)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		holders int
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fl, err := LockFile(lockPath, 10*time.Second)
+			if err != nil {
+				t.Errorf("LockFile: %s", err)
+				return
+			}
+			mu.Lock()
+			holders++
+			if holders > 1 {
+				t.Errorf("%d holders own the lock at the same time", holders)
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			holders--
+			mu.Unlock()
+			if err := fl.Unlock(); err != nil {
+				t.Errorf("Unlock: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/phpc0de/ctlibgo/logger"
 	"github.com/phpc0de/ctpango/library/requester/transfer"
 	"sort"
+	"sync/atomic"
 	"time"
 )
 
@@ -36,7 +37,10 @@ type (
 		completed       chan struct{}
 		err             error
 		resetController *ResetController
-		isReloadWorker  bool //是否重载worker, 单线程模式不重载
+		isReloadWorker  bool      //是否重载worker, 单线程模式不重载
+		activeCapacity  int32     // 同时下载的worker数量上限, 0为不限制
+		networkChanged  int32     // 本机网络地址是否发生了变化, 不为0时重设所有正在下载的worker
+		connGauge       connGauge // 所有worker同时使用的连接数
 
 		// 临时变量
 		lastAvaliableIndex int
@@ -145,6 +149,84 @@ func (mt *Monitor) SetReloadWorker(b bool) {
 	mt.isReloadWorker = b
 }
 
+// SetActiveCapacity 设置同时下载的worker数量上限, 0为不限制
+func (mt *Monitor) SetActiveCapacity(capacity int) {
+	atomic.StoreInt32(&mt.activeCapacity, int32(capacity))
+}
+
+// ActiveCapacity 同时下载的worker数量上限
+func (mt *Monitor) ActiveCapacity() int {
+	return int(atomic.LoadInt32(&mt.activeCapacity))
+}
+
+// numActiveWorkers 未完成且未暂停的worker数量
+func (mt *Monitor) numActiveWorkers() (num int) {
+	for _, worker := range mt.workers {
+		if !worker.Completed() && worker.GetStatus().StatusCode() != StatusCodePaused {
+			num++
+		}
+	}
+	return
+}
+
+// isActiveFull 同时下载的worker数量是否已达到上限
+func (mt *Monitor) isActiveFull() bool {
+	capacity := mt.ActiveCapacity()
+	return capacity > 0 && mt.numActiveWorkers() >= capacity
+}
+
+// applyActiveCapacity 同时下载的worker超过上限时暂停多出的worker, 低于上限时恢复之前暂停的worker
+func (mt *Monitor) applyActiveCapacity() {
+	capacity := mt.ActiveCapacity()
+	active := mt.numActiveWorkers()
+	if capacity > 0 && active > capacity {
+		for i := len(mt.workers) - 1; i >= 0 && active > capacity; i-- {
+			worker := mt.workers[i]
+			if !worker.park() {
+				continue
+			}
+			worker.parked = true
+			active--
+			logger.Verbosef("MONITOR: active capacity %d, worker[%d] paused\n", capacity, worker.ID())
+		}
+		return
+	}
+	for _, worker := range mt.workers {
+		if capacity > 0 && active >= capacity {
+			return
+		}
+		if !worker.parked {
+			continue
+		}
+		worker.parked = false
+		active++
+		logger.Verbosef("MONITOR: active capacity %d, worker[%d] resumed\n", capacity, worker.ID())
+		worker.Resume()
+	}
+}
+
+// NotifyNetworkChanged 通知本机网络地址发生了变化, 下次检查时重设所有正在下载的worker
+func (mt *Monitor) NotifyNetworkChanged() {
+	atomic.StoreInt32(&mt.networkChanged, 1)
+}
+
+// ResetActiveWorkers 重新获取下载链接并重设所有正在下载的worker,
+// 不等待已失效的连接超时, 忽略正在写入数据和已暂停的worker
+func (mt *Monitor) ResetActiveWorkers() {
+	for _, worker := range mt.workers {
+		switch worker.GetStatus().StatusCode() {
+		case StatusCodePending, StatusCodeDownloading, StatusCodeNetError, StatusCodeFailed, StatusCodeTooManyConnections, StatusCodeDownloadUrlExpired:
+		default:
+			continue
+		}
+
+		worker.RefreshDownloadUrl()
+		mt.resetController.AddResetNum()
+		logger.Verbosef("MONITOR: network changed, worker[%d] reload\n", worker.ID())
+		worker.Reset()
+	}
+}
+
 //IsLeftWorkersAllFailed 剩下的线程是否全部失败
 func (mt *Monitor) IsLeftWorkersAllFailed() bool {
 	failedNum := 0
@@ -258,6 +340,10 @@ func (mt *Monitor) TryAddNewWork() {
 		return
 	}
 
+	if mt.isActiveFull() { // 同时下载的数量已达上限
+		return
+	}
+
 	availableWorker := mt.GetAvailableWorker()
 	if availableWorker == nil {
 		return
@@ -284,6 +370,10 @@ func (mt *Monitor) DynamicSplitWorker(worker *Worker) {
 		return
 	}
 
+	if mt.isActiveFull() {
+		return
+	}
+
 	switch worker.status.statusCode {
 	case StatusCodeDownloading, StatusCodeFailed, StatusCodeNetError:
 	//pass
@@ -357,6 +447,17 @@ func (mt *Monitor) ResetWorker(worker *Worker) {
 	worker.Reset()
 }
 
+// saveInstanceState 保存断点信息到文件
+func (mt *Monitor) saveInstanceState() {
+	if mt.instanceState == nil {
+		return
+	}
+	mt.instanceState.Put(&transfer.DownloadInstanceInfo{
+		DownloadStatus: mt.status,
+		Ranges:         mt.GetAllWorkersRange(),
+	})
+}
+
 //Execute 执行任务
 func (mt *Monitor) Execute(cancelCtx context.Context) {
 	if len(mt.workers) == 0 {
@@ -367,6 +468,7 @@ func (mt *Monitor) Execute(cancelCtx context.Context) {
 	mt.lazyInit()
 	for _, worker := range mt.workers {
 		worker.SetDownloadStatus(mt.status)
+		worker.connGauge = &mt.connGauge
 		go worker.Execute()
 	}
 
@@ -384,22 +486,27 @@ func (mt *Monitor) Execute(cancelCtx context.Context) {
 					logger.Verbosef("DEBUG: cancel failed, worker id: %d, err: %s\n", worker.ID(), err)
 				}
 			}
+			// 取消时保存一次断点信息, 下次继续下载
+			mt.saveInstanceState()
 			return
 		case <-mt.completed:
 			return
 		case <-ticker.C:
+			// 网络地址发生变化, 原有的连接已失效
+			if atomic.CompareAndSwapInt32(&mt.networkChanged, 1, 0) {
+				mt.ResetActiveWorkers()
+			}
+
 			// 初始化监控工作
 			mt.ResetFailedAndNetErrorWorkers()
 
 			mt.status.UpdateSpeeds() // 更新速度
 
+			// 按同时下载的worker数量上限暂停或恢复worker
+			mt.applyActiveCapacity()
+
 			// 保存断点信息到文件
-			if mt.instanceState != nil {
-				mt.instanceState.Put(&transfer.DownloadInstanceInfo{
-					DownloadStatus: mt.status,
-					Ranges:         mt.GetAllWorkersRange(),
-				})
-			}
+			mt.saveInstanceState()
 
 			// 加入新range
 			mt.TryAddNewWork()
@@ -0,0 +1,80 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package downloader
+
+import (
+	"context"
+	"github.com/phpc0de/ctlibgo/logger"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// InterfaceCheckInterval 检测本机网络地址变化的周期
+	InterfaceCheckInterval = 10 * time.Second
+
+	// interfaceAddrsFunc 获取本机网络地址, 测试时替换
+	interfaceAddrsFunc = net.InterfaceAddrs
+)
+
+// localAddrsFingerprint 返回本机所有非回环地址排序后拼接的字符串, 用于判断网络地址是否变化
+func localAddrsFingerprint() (string, error) {
+	addrs, err := interfaceAddrsFunc()
+	if err != nil {
+		return "", err
+	}
+	ips := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		ips = append(ips, ipNet.IP.String())
+	}
+	sort.Strings(ips)
+	return strings.Join(ips, ","), nil
+}
+
+// interfaceChangeWatcher 定期检测本机网络地址, 发生变化时通知 Monitor 重设所有正在下载的连接
+func (der *Downloader) interfaceChangeWatcher(ctx context.Context) {
+	last, err := localAddrsFingerprint()
+	if err != nil {
+		logger.Verbosef("DEBUG: interface change detection disabled: %s\n", err)
+		return
+	}
+
+	ticker := time.NewTicker(InterfaceCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current, err := localAddrsFingerprint()
+		if err != nil {
+			logger.Verbosef("DEBUG: get interface addrs failed: %s\n", err)
+			continue
+		}
+		if current == last {
+			continue
+		}
+		logger.Verbosef("DOWNLOADER: local address changed: [%s] -> [%s], reset workers\n", last, current)
+		last = current
+		der.monitor.NotifyNetworkChanged()
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package downloader
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func stubInterfaceAddrs(t *testing.T, ips *atomic.Value) {
+	old := interfaceAddrsFunc
+	t.Cleanup(func() { interfaceAddrsFunc = old })
+	interfaceAddrsFunc = func() ([]net.Addr, error) {
+		addrs := make([]net.Addr, 0)
+		for _, ip := range ips.Load().([]string) {
+			addrs = append(addrs, &net.IPNet{IP: net.ParseIP(ip), Mask: net.CIDRMask(24, 32)})
+		}
+		return addrs, nil
+	}
+}
+
+func TestLocalAddrsFingerprint(t *testing.T) {
+	ips := &atomic.Value{}
+	ips.Store([]string{"192.168.1.10", "127.0.0.1", "fe80::1", "10.0.0.2"})
+	stubInterfaceAddrs(t, ips)
+
+	fp, err := localAddrsFingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 忽略回环和链路本地地址, 并排序
+	if fp != "10.0.0.2,192.168.1.10" {
+		t.Fatalf("fingerprint: %s", fp)
+	}
+}
+
+func TestInterfaceChangeWatcher(t *testing.T) {
+	oldInterval := InterfaceCheckInterval
+	InterfaceCheckInterval = 10 * time.Millisecond
+	defer func() { InterfaceCheckInterval = oldInterval }()
+
+	ips := &atomic.Value{}
+	ips.Store([]string{"192.168.1.10"})
+	stubInterfaceAddrs(t, ips)
+
+	der := &Downloader{monitor: NewMonitor()}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go der.interfaceChangeWatcher(ctx)
+
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&der.monitor.networkChanged) != 0 {
+		t.Fatal("should not notify when address is unchanged")
+	}
+
+	ips.Store([]string{"172.20.10.2"})
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&der.monitor.networkChanged) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("network change not detected")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package downloader
+
+import (
+	"errors"
+	"os"
+
+	"github.com/phpc0de/ctlibgo/prealloc"
+)
+
+type (
+	// PreallocStrategy 预分配文件空间的方式
+	PreallocStrategy int
+
+	// truncater 可以修改文件大小
+	truncater interface {
+		Truncate(size int64) error
+	}
+
+	// stater 可以获取文件信息
+	stater interface {
+		Stat() (os.FileInfo, error)
+	}
+)
+
+const (
+	// PreallocPosixFallocate 使用系统调用预分配 (ftruncate/SetFileValidData 等)
+	PreallocPosixFallocate PreallocStrategy = iota
+	// PreallocSeekAndWrite 在文件末尾写入一个字节来占用空间, 用于不支持系统调用预分配的文件系统, 例如 FAT32, 网络挂载等
+	PreallocSeekAndWrite
+	// PreallocNone 不预分配
+	PreallocNone
+)
+
+var (
+	// preAllocFunc 系统调用预分配, 测试时可替换
+	preAllocFunc = prealloc.PreAlloc
+)
+
+func (ps PreallocStrategy) String() string {
+	switch ps {
+	case PreallocPosixFallocate:
+		return "PosixFallocate"
+	case PreallocSeekAndWrite:
+		return "SeekAndWrite"
+	case PreallocNone:
+		return "None"
+	}
+	return "Unknown"
+}
+
+// preallocFile 预分配文件空间, 返回实际使用的方式.
+// 先尝试系统调用预分配, 如果是系统调用本身失败 (*prealloc.PreAllocError, 文件系统不支持),
+// 则改为在文件末尾写入一个字节; 如果仍然失败 (例如磁盘空间不足), 返回错误, 应终止下载.
+// 其他错误忽略, 不预分配.
+func preallocFile(writer Writer, size int64) (PreallocStrategy, error) {
+	fder, ok := writer.(Fder)
+	if !ok || size <= 0 {
+		return PreallocNone, nil
+	}
+
+	err := preAllocFunc(fder.Fd(), size)
+	if err == nil {
+		return PreallocPosixFallocate, nil
+	}
+
+	var pe *prealloc.PreAllocError
+	if !errors.As(err, &pe) {
+		return PreallocNone, nil
+	}
+
+	return PreallocSeekAndWrite, seekAndWritePrealloc(writer, size)
+}
+
+// seekAndWritePrealloc 在文件的 size-1 位置写入一个字节, 然后修正文件大小为 size
+func seekAndWritePrealloc(writer Writer, size int64) error {
+	if st, ok := writer.(stater); ok {
+		info, err := st.Stat()
+		if err == nil && info.Size() >= size {
+			// 文件已经足够大 (断点续传), 不能覆盖已下载的数据
+			if tr, ok := writer.(truncater); ok && info.Size() > size {
+				return tr.Truncate(size)
+			}
+			return nil
+		}
+	}
+
+	_, err := writer.WriteAt([]byte{0}, size-1)
+	if err != nil {
+		return err
+	}
+	if tr, ok := writer.(truncater); ok {
+		return tr.Truncate(size)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package downloader
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/phpc0de/ctlibgo/prealloc"
+)
+
+type (
+	// fakeFder 模拟文件, 只记录写入的数据
+	fakeFder struct {
+		data     []byte
+		writeErr error
+	}
+
+	// plainWriter 不支持获取fd
+	plainWriter struct{}
+)
+
+func (ff *fakeFder) Fd() uintptr {
+	return 100
+}
+
+func (ff *fakeFder) WriteAt(p []byte, off int64) (int, error) {
+	if ff.writeErr != nil {
+		return 0, ff.writeErr
+	}
+	if end := off + int64(len(p)); end > int64(len(ff.data)) {
+		ff.data = append(ff.data, make([]byte, end-int64(len(ff.data)))...)
+	}
+	return copy(ff.data[off:], p), nil
+}
+
+func (pw *plainWriter) WriteAt(p []byte, off int64) (int, error) {
+	return len(p), nil
+}
+
+func mockPreAlloc(t *testing.T, fn func(fd uintptr, length int64) error) {
+	old := preAllocFunc
+	preAllocFunc = fn
+	t.Cleanup(func() { preAllocFunc = old })
+}
+
+func TestPreallocFileStrategy(t *testing.T) {
+	var called uintptr
+	mockPreAlloc(t, func(fd uintptr, length int64) error {
+		called = fd
+		return nil
+	})
+	strategy, err := preallocFile(&fakeFder{}, 1024)
+	if err != nil || strategy != PreallocPosixFallocate || called != 100 {
+		t.Fatalf("fallocate: %s, %v, fd %d", strategy, err, called)
+	}
+
+	// 文件系统不支持, 改为写入最后一个字节
+	mockPreAlloc(t, func(fd uintptr, length int64) error {
+		return &prealloc.PreAllocError{ProcName: "Ftruncate", Err: syscall.EINVAL}
+	})
+	ff := &fakeFder{}
+	strategy, err = preallocFile(ff, 1024)
+	if err != nil || strategy != PreallocSeekAndWrite || len(ff.data) != 1024 {
+		t.Fatalf("seek and write: %s, %v, size %d", strategy, err, len(ff.data))
+	}
+
+	// 写入也失败, 需要终止下载
+	writeErr := errors.New("no space left on device")
+	strategy, err = preallocFile(&fakeFder{writeErr: writeErr}, 1024)
+	if err != writeErr || strategy != PreallocSeekAndWrite {
+		t.Fatalf("seek and write failed: %s, %v", strategy, err)
+	}
+
+	// 其他错误忽略
+	mockPreAlloc(t, func(fd uintptr, length int64) error {
+		return errors.New("unknown")
+	})
+	strategy, err = preallocFile(&fakeFder{}, 1024)
+	if err != nil || strategy != PreallocNone {
+		t.Fatalf("unknown error: %s, %v", strategy, err)
+	}
+
+	// 不支持fd
+	strategy, err = preallocFile(&plainWriter{}, 1024)
+	if err != nil || strategy != PreallocNone {
+		t.Fatalf("no fd: %s, %v", strategy, err)
+	}
+}
+
+func TestSeekAndWritePreallocFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prealloc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file, err := os.Create(filepath.Join(dir, "1.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if err = seekAndWritePrealloc(file, 4096); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := file.Stat(); info.Size() != 4096 {
+		t.Fatalf("size: %d", info.Size())
+	}
+
+	// 断点续传, 已下载的数据不能被覆盖
+	file.WriteAt([]byte{0xff}, 4095)
+	if err = seekAndWritePrealloc(file, 4096); err != nil {
+		t.Fatal(err)
+	}
+	last := make([]byte, 1)
+	file.ReadAt(last, 4095)
+	if !bytes.Equal(last, []byte{0xff}) {
+		t.Fatal("downloaded data overwritten")
+	}
+}
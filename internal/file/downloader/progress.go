@@ -0,0 +1,176 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package downloader
+
+import (
+	"fmt"
+	"github.com/phpc0de/ctlibgo/converter"
+	"github.com/phpc0de/ctpango/library/requester/transfer"
+	"io"
+	"strings"
+	"time"
+)
+
+type (
+	// ProgressStyle 下载进度的输出样式
+	ProgressStyle string
+
+	// ProgressInfo 输出下载进度需要的信息
+	ProgressInfo struct {
+		TaskId          string
+		Name            string // 文件名, 为空时不输出
+		Downloaded      int64
+		TotalSize       int64
+		SpeedsPerSecond int64
+		Elapsed         time.Duration
+		Left            time.Duration // 小于0代表剩余时间未知
+	}
+
+	// ProgressRenderer 下载进度输出
+	ProgressRenderer interface {
+		Render(w io.Writer, info *ProgressInfo)
+	}
+
+	// simpleProgressRenderer 按格式输出一行下载进度
+	simpleProgressRenderer struct {
+		format string
+	}
+
+	// barProgressRenderer 输出ASCII进度条
+	barProgressRenderer struct {
+		width int
+	}
+
+	// spinnerProgressRenderer 输出旋转的指示符
+	spinnerProgressRenderer struct {
+		frame int
+	}
+)
+
+const (
+	// StyleSimple 输出已下载量, 速度和剩余时间
+	StyleSimple ProgressStyle = "simple"
+	// StyleBar 输出ASCII进度条和百分比
+	StyleBar ProgressStyle = "bar"
+	// StyleSpinner 输出旋转的指示符, 适合文件大小未知或不关心进度的情况
+	StyleSpinner ProgressStyle = "spinner"
+
+	// DefaultProgressFormat 默认的 StyleSimple 输出格式
+	DefaultProgressFormat = "\r[%s] %s↓ %s/%s %s/s in %s, left %s ............"
+	// DefaultProgressBarWidth 默认的进度条宽度
+	DefaultProgressBarWidth = 30
+)
+
+var (
+	spinnerFrames = []byte{'|', '/', '-', '\\'}
+)
+
+// ParseProgressStyle 解析进度条样式, 空字符串为 StyleSimple
+func ParseProgressStyle(str string) (ProgressStyle, error) {
+	switch style := ProgressStyle(strings.ToLower(strings.TrimSpace(str))); style {
+	case "":
+		return StyleSimple, nil
+	case StyleSimple, StyleBar, StyleSpinner:
+		return style, nil
+	}
+	return "", fmt.Errorf("不支持的进度条样式: %s, 可选值: simple, bar, spinner", str)
+}
+
+// NewProgressRenderer 根据样式返回 ProgressRenderer, format 只对 StyleSimple 有效, 为空时使用 DefaultProgressFormat
+func NewProgressRenderer(style ProgressStyle, format string) ProgressRenderer {
+	switch style {
+	case StyleBar:
+		return &barProgressRenderer{width: DefaultProgressBarWidth}
+	case StyleSpinner:
+		return &spinnerProgressRenderer{}
+	}
+	if format == "" {
+		format = DefaultProgressFormat
+	}
+	return &simpleProgressRenderer{format: format}
+}
+
+// NewProgressInfo 从下载状态获取 ProgressInfo
+func NewProgressInfo(taskId, name string, status transfer.DownloadStatuser) *ProgressInfo {
+	return &ProgressInfo{
+		TaskId:          taskId,
+		Name:            name,
+		Downloaded:      status.Downloaded(),
+		TotalSize:       status.TotalSize(),
+		SpeedsPerSecond: status.SpeedsPerSecond(),
+		Elapsed:         status.TimeElapsed(),
+		Left:            status.TimeLeft(),
+	}
+}
+
+// nameField 输出在任务ID后的文件名, 带一个空格分隔
+func (info *ProgressInfo) nameField() string {
+	if info.Name == "" {
+		return ""
+	}
+	return info.Name + " "
+}
+
+// leftString 剩余时间未知时用 - 代替
+func (info *ProgressInfo) leftString() string {
+	if info.Left < 0 {
+		return "-"
+	}
+	return info.Left.String()
+}
+
+// percent 下载进度, 0 ~ 1, 文件大小为0时视为已完成
+func (info *ProgressInfo) percent() float64 {
+	if info.TotalSize <= 0 {
+		return 1
+	}
+	p := float64(info.Downloaded) / float64(info.TotalSize)
+	if p < 0 {
+		return 0
+	}
+	if p > 1 {
+		return 1
+	}
+	return p
+}
+
+func (r *simpleProgressRenderer) Render(w io.Writer, info *ProgressInfo) {
+	fmt.Fprintf(w, r.format, info.TaskId, info.nameField(),
+		converter.ConvertFileSize(info.Downloaded, 2),
+		converter.ConvertFileSize(info.TotalSize, 2),
+		converter.ConvertFileSize(info.SpeedsPerSecond, 2),
+		info.Elapsed/1e7*1e7, info.leftString(),
+	)
+}
+
+func (r *barProgressRenderer) Render(w io.Writer, info *ProgressInfo) {
+	percent := info.percent()
+	filled := int(percent * float64(r.width))
+	bar := strings.Repeat("=", filled)
+	if filled < r.width {
+		bar += ">" + strings.Repeat(" ", r.width-filled-1)
+	}
+	fmt.Fprintf(w, "\r[%s] %s[%s] %6.2f%% %s/s, ETA %s    ", info.TaskId, info.nameField(), bar, percent*100,
+		converter.ConvertFileSize(info.SpeedsPerSecond, 2), info.leftString())
+}
+
+func (r *spinnerProgressRenderer) Render(w io.Writer, info *ProgressInfo) {
+	frame := spinnerFrames[r.frame%len(spinnerFrames)]
+	r.frame++
+	fmt.Fprintf(w, "\r[%s] %c %s↓ %s %s/s in %s    ", info.TaskId, frame, info.nameField(),
+		converter.ConvertFileSize(info.Downloaded, 2),
+		converter.ConvertFileSize(info.SpeedsPerSecond, 2),
+		info.Elapsed/1e7*1e7,
+	)
+}
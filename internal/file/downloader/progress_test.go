@@ -0,0 +1,104 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package downloader
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProgressStyle(t *testing.T) {
+	for str, expect := range map[string]ProgressStyle{"": StyleSimple, "simple": StyleSimple, " BAR ": StyleBar, "spinner": StyleSpinner} {
+		style, err := ParseProgressStyle(str)
+		if err != nil || style != expect {
+			t.Fatalf("parse %q: got %s, %v", str, style, err)
+		}
+	}
+	if _, err := ParseProgressStyle("dots"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestProgressRenderer(t *testing.T) {
+	infos := []*ProgressInfo{
+		{TaskId: "1", Downloaded: 512, TotalSize: 1024, SpeedsPerSecond: 256, Elapsed: 2 * time.Second, Left: 2 * time.Second},
+		{TaskId: "2", Left: -1}, // 0字节文件
+		{TaskId: "3", Downloaded: 2048, TotalSize: 1024, Left: -1},
+	}
+
+	for _, info := range infos {
+		builder := &strings.Builder{}
+		NewProgressRenderer(StyleSimple, "").Render(builder, info)
+		out := builder.String()
+		if !strings.HasPrefix(out, "\r["+info.TaskId+"] ↓ ") {
+			t.Fatalf("simple: %q", out)
+		}
+		if info.Left < 0 && !strings.Contains(out, "left - ") {
+			t.Fatalf("simple unknown left: %q", out)
+		}
+
+		builder.Reset()
+		NewProgressRenderer(StyleBar, "").Render(builder, info)
+		out = builder.String()
+		start, end := strings.Index(out, "] [")+3, strings.LastIndex(out, "]")
+		if start < 3 || end-start != DefaultProgressBarWidth {
+			t.Fatalf("bar width: %q", out)
+		}
+		switch info.TaskId {
+		case "1":
+			if !strings.Contains(out, " 50.00%") || !strings.Contains(out, strings.Repeat("=", 15)+">") {
+				t.Fatalf("bar half: %q", out)
+			}
+		case "2", "3":
+			if !strings.Contains(out, "100.00%") || !strings.Contains(out, strings.Repeat("=", DefaultProgressBarWidth)) {
+				t.Fatalf("bar full: %q", out)
+			}
+		}
+	}
+}
+
+func TestProgressRendererName(t *testing.T) {
+	info := &ProgressInfo{TaskId: "1", Name: "1.mp4", Left: -1}
+	expects := map[ProgressStyle]string{
+		StyleSimple:  "\r[1] 1.mp4 ↓ ",
+		StyleBar:     "\r[1] 1.mp4 [",
+		StyleSpinner: "\r[1] | 1.mp4 ↓ ",
+	}
+	for style, prefix := range expects {
+		builder := &strings.Builder{}
+		NewProgressRenderer(style, "").Render(builder, info)
+		if out := builder.String(); !strings.HasPrefix(out, prefix) {
+			t.Errorf("%s: got %q, want prefix %q", style, out, prefix)
+		}
+	}
+}
+
+func TestSpinnerProgressRenderer(t *testing.T) {
+	renderer := NewProgressRenderer(StyleSpinner, "")
+	info := &ProgressInfo{TaskId: "1", Left: -1}
+	frames := make([]string, 0)
+	for i := 0; i < len(spinnerFrames)+1; i++ {
+		builder := &strings.Builder{}
+		renderer.Render(builder, info)
+		out := builder.String()
+		if !strings.HasPrefix(out, "\r[1] ") {
+			t.Fatalf("spinner: %q", out)
+		}
+		frames = append(frames, out[5:6])
+	}
+	if strings.Join(frames, "") != `|/-\|` {
+		t.Fatalf("frames: %v", frames)
+	}
+}
@@ -23,10 +23,22 @@ import (
 	"github.com/phpc0de/ctlibgo/logger"
 	"github.com/phpc0de/ctlibgo/requester"
 	"github.com/phpc0de/ctlibgo/requester/rio/speeds"
+	"github.com/phpc0de/ctpango/internal/apistat"
 	"github.com/phpc0de/ctpango/library/requester/transfer"
 	"io"
 	"net/http"
 	"sync"
+	"time"
+)
+
+const (
+	// DefaultWorkerMaxAuthRetries 下载链接鉴权失败时, 默认重新获取下载链接的最大次数
+	DefaultWorkerMaxAuthRetries = 2
+)
+
+var (
+	// ErrAuthExpired 重新获取下载链接后, 下载链接仍然返回 401 或 403
+	ErrAuthExpired = errors.New("download url auth expired")
 )
 
 type (
@@ -40,7 +52,7 @@ type (
 		familyId     int64
 		url          string // 下载地址
 		acceptRanges string
-		panClient    *cloudpan.PanClient
+		panClient    *apistat.PanClient
 		client       *requester.HTTPClient
 		writerAt     io.WriterAt
 		writeMu      *sync.Mutex
@@ -53,6 +65,18 @@ type (
 		err                    error // 错误信息
 		status                 WorkerStatus
 		downloadStatus         *transfer.DownloadStatus // 总的下载状态
+
+		loadBalancer    *LoadBalancerResponseList // 共享的负载均衡列表, 记录请求失败和延迟
+		loadBalancerURL string                    // 分配给该worker的负载均衡服务器
+		switchedServer  bool                      // 已切换到其他服务器, 下载地址使用 loadBalancerURL 的域名
+		parked          bool                      // 超过同时下载的数量上限被 Monitor 暂停, 只由 Monitor 修改
+
+		downloadUrlFunc DownloadUrlFunc // 获取下载链接的函数, 为空时通过 panClient 获取
+		maxAuthRetries  int             // 下载链接返回 401 或 403 时, 重新获取下载链接并重试的最大次数
+		authRetries     int             // 已重新获取下载链接的次数, 下载成功后清零
+
+		connStats ConnectionStats // 连接统计, 原子操作
+		connGauge *connGauge      // Monitor 共享的同时使用的连接数统计
 	}
 
 	// WorkerList worker列表
@@ -74,6 +98,7 @@ func NewWorker(id int, familyId int64, fileId, durl string, writerAt io.WriterAt
 		writerAt: writerAt,
 		fileId: fileId,
 		familyId: familyId,
+		maxAuthRetries: DefaultWorkerMaxAuthRetries,
 	}
 }
 
@@ -112,10 +137,16 @@ func (wer *Worker) SetClient(c *requester.HTTPClient) {
 	wer.client = c
 }
 
-func (wer *Worker) SetPanClient(p *cloudpan.PanClient) {
+func (wer *Worker) SetPanClient(p *apistat.PanClient) {
 	wer.panClient = p
 }
 
+// SetLoadBalancer 设置共享的负载均衡列表和分配给该worker的服务器
+func (wer *Worker) SetLoadBalancer(lbrl *LoadBalancerResponseList, url string) {
+	wer.loadBalancer = lbrl
+	wer.loadBalancerURL = url
+}
+
 //SetAcceptRange 设置AcceptRange
 func (wer *Worker) SetAcceptRange(acceptRanges string) {
 	wer.acceptRanges = acceptRanges
@@ -154,6 +185,10 @@ func (wer *Worker) GetRange() *transfer.Range {
 
 //GetSpeedsPerSecond 获取每秒的速度
 func (wer *Worker) GetSpeedsPerSecond() int64 {
+	if wer.speedsStat == nil {
+		// 还未开始下载
+		return 0
+	}
 	return wer.speedsStat.GetSpeeds()
 }
 
@@ -172,6 +207,28 @@ func (wer *Worker) Pause() {
 	wer.status.statusCode = StatusCodePaused
 }
 
+// park 断开正在下载的worker的连接并暂停, 已下载的数据会先写入, 可以使用 Resume 从断开的位置继续下载.
+// 与 Pause 不同, 不等待读满缓存, 不支持断点续传或不在下载中时返回false
+func (wer *Worker) park() bool {
+	if wer.acceptRanges == "" || wer.status.statusCode != StatusCodeDownloading || wer.resetFunc == nil {
+		return false
+	}
+	wer.resetFunc()
+	if wer.readRespBodyCancelFunc != nil {
+		wer.readRespBodyCancelFunc()
+	}
+
+	// 等待 Execute 退出
+	wer.execMu.Lock()
+	defer wer.execMu.Unlock()
+	if wer.Completed() || wer.status.statusCode == StatusCodeInternalError {
+		return false
+	}
+	wer.status.statusCode = StatusCodePaused
+	wer.err = nil
+	return true
+}
+
 //Resume 恢复下载
 func (wer *Worker) Resume() {
 	if wer.status.statusCode != StatusCodePaused {
@@ -206,8 +263,33 @@ func (wer *Worker) Reset() {
 	go wer.Execute()
 }
 
+// SetDownloadUrlFunc 设置获取下载链接的函数
+func (wer *Worker) SetDownloadUrlFunc(f DownloadUrlFunc) {
+	wer.downloadUrlFunc = f
+}
+
+// SetMaxAuthRetries 设置下载链接鉴权失败时重新获取下载链接的最大次数
+func (wer *Worker) SetMaxAuthRetries(n int) {
+	wer.maxAuthRetries = n
+}
+
 // RefreshDownloadUrl 重新刷新下载链接
 func (wer *Worker) RefreshDownloadUrl() {
+	if err := wer.refreshDownloadUrl(); err != nil {
+		wer.status.statusCode = StatusCodeTooManyConnections
+	}
+}
+
+func (wer *Worker) refreshDownloadUrl() error {
+	if wer.downloadUrlFunc != nil {
+		durl, err := wer.downloadUrlFunc(wer.familyId, wer.fileId)
+		if err != nil {
+			return err
+		}
+		wer.setUrl(durl)
+		return nil
+	}
+
 	var durl string
 	var apierr *apierror.ApiError
 
@@ -217,12 +299,35 @@ func (wer *Worker) RefreshDownloadUrl() {
 		durl, apierr = wer.panClient.AppGetFileDownloadUrl(wer.fileId)
 	}
 	if apierr != nil {
-		wer.status.statusCode = StatusCodeTooManyConnections
-		return
+		return apierr
+	}
+	wer.setUrl(durl)
+	return nil
+}
+
+// setUrl 设置重新获取的下载地址, 已切换服务器时继续使用切换后的服务器
+func (wer *Worker) setUrl(durl string) {
+	if wer.switchedServer {
+		durl = replaceURLHost(durl, wer.loadBalancerURL)
 	}
 	wer.url = durl
 }
 
+// request 请求 worker 的下载范围
+func (wer *Worker) request() (resp *http.Response, apierr *apierror.ApiError) {
+	apierr = wer.panClient.AppDownloadFileData(wer.url, cloudpan.AppFileDownloadRange{
+		Offset: wer.wrange.Begin,
+		End: wer.wrange.End - 1,
+	}, func(httpMethod, fullUrl string, headers map[string]string) (*http.Response, error) {
+		resp, wer.err = wer.client.Req(httpMethod, fullUrl, nil, headers)
+		if wer.err != nil {
+			return nil, wer.err
+		}
+		return resp, wer.err
+	})
+	return
+}
+
 // Canceled 是否已经取消
 func (wer *Worker) Canceled() bool {
 	return wer.status.statusCode == StatusCodeCanceled
@@ -261,6 +366,7 @@ func (wer *Worker) Err() error {
 //Execute 执行任务
 func (wer *Worker) Execute() {
 	wer.lazyInit()
+	wer.traceClientConnections(wer.client)
 
 	wer.execMu.Lock()
 	defer wer.execMu.Unlock()
@@ -297,18 +403,43 @@ func (wer *Worker) Execute() {
 
 	wer.status.statusCode = StatusCodePending
 
-	var resp *http.Response
+	// 分配的服务器已失败, 换一个
+	if wer.loadBalancer != nil && !wer.loadBalancer.Healthy(wer.loadBalancerURL) {
+		if lb := wer.loadBalancer.SequentialGet(); lb != nil {
+			logger.Verbosef("DEBUG: worker %d load balancer %s failed, switch to %s\n", wer.id, wer.loadBalancerURL, lb.URL)
+			wer.loadBalancerURL = lb.URL
+			wer.switchedServer = true
+			wer.url = replaceURLHost(wer.url, lb.URL)
+		}
+	}
 
-	apierr := wer.panClient.AppDownloadFileData(wer.url, cloudpan.AppFileDownloadRange{
-		Offset: wer.wrange.Begin,
-		End: wer.wrange.End - 1,
-	}, func(httpMethod, fullUrl string, headers map[string]string) (*http.Response, error) {
-		resp, wer.err = wer.client.Req(httpMethod, fullUrl, nil, headers)
-		if wer.err != nil {
-			return nil, wer.err
+	var (
+		resp     *http.Response
+		apierr   *apierror.ApiError
+		reqStart time.Time
+	)
+	for {
+		reqStart = time.Now()
+		resp, apierr = wer.request()
+		if wer.err != nil || apierr != nil || (resp.StatusCode != 401 && resp.StatusCode != 403) {
+			break
 		}
-		return resp, wer.err
-	})
+
+		// 下载链接鉴权失败, 可能已过期, 重新获取下载链接后重试
+		resp.Body.Close()
+		if wer.authRetries >= wer.maxAuthRetries {
+			wer.status.statusCode = StatusCodeInternalError // 强制停止下载, 由上层重试
+			wer.err = ErrAuthExpired
+			return
+		}
+		wer.authRetries++
+		logger.Verbosef("DEBUG: worker %d download url %s, refresh download url, retry %d/%d\n", wer.id, resp.Status, wer.authRetries, wer.maxAuthRetries)
+		if err := wer.refreshDownloadUrl(); err != nil {
+			wer.status.statusCode = StatusCodeNetError
+			wer.err = err
+			return
+		}
+	}
 
 	if resp != nil {
 		defer func() {
@@ -320,6 +451,9 @@ func (wer *Worker) Execute() {
 	}
 	if wer.err != nil || apierr != nil {
 		wer.status.statusCode = StatusCodeNetError
+		if wer.loadBalancer != nil {
+			wer.loadBalancer.MarkFailed(wer.loadBalancerURL)
+		}
 		return
 	}
 
@@ -328,11 +462,13 @@ func (wer *Worker) Execute() {
 	case 200, 206:
 		// do nothing, continue
 		wer.status.statusCode = StatusCodeDownloading
+		wer.authRetries = 0
+		if wer.loadBalancer != nil {
+			wer.loadBalancer.MarkSlow(wer.loadBalancerURL, time.Since(reqStart))
+		}
 		break
 	case 416: //Requested Range Not Satisfiable
 		fallthrough
-	case 403: // Forbidden
-		fallthrough
 	case 406: // Not Acceptable
 		wer.status.statusCode = StatusCodeNetError
 		wer.err = errors.New(resp.Status)
@@ -348,6 +484,9 @@ func (wer *Worker) Execute() {
 	default:
 		wer.status.statusCode = StatusCodeNetError
 		wer.err = fmt.Errorf("unexpected http status code, %d, %s", resp.StatusCode, resp.Status)
+		if wer.loadBalancer != nil {
+			wer.loadBalancer.MarkFailed(wer.loadBalancerURL)
+		}
 		return
 	}
 
@@ -37,7 +37,7 @@ type (
 		readed        int64
 		readerAt      io.ReaderAt
 		speedsStatRef *speeds.Speeds
-		rateLimit     *speeds.RateLimit
+		rateLimit     transfer.RateLimiter
 		mu            sync.Mutex
 	}
 
@@ -63,7 +63,7 @@ func SplitBlock(fileSize, blockSize int64) (blockList []*BlockState) {
 }
 
 // NewBufioSplitUnit io.ReaderAt实现SplitUnit接口, 有Buffer支持
-func NewBufioSplitUnit(readerAt io.ReaderAt, readRange transfer.Range, speedsStat *speeds.Speeds, rateLimit *speeds.RateLimit) SplitUnit {
+func NewBufioSplitUnit(readerAt io.ReaderAt, readRange transfer.Range, speedsStat *speeds.Speeds, rateLimit transfer.RateLimiter) SplitUnit {
 	su := &fileBlock{
 		readerAt:      readerAt,
 		readRange:     readRange,
@@ -85,12 +85,13 @@ func (fb *fileBlock) Read(b []byte) (n int, err error) {
 	fb.mu.Lock()
 	defer fb.mu.Unlock()
 
-	left := int(fb.Left())
+	// 使用 int64 比较, 分片超过 2GB 时转换为 int 会在32位系统上溢出
+	left := fb.Left()
 	if left <= 0 {
 		return 0, io.EOF
 	}
 
-	if len(b) > left {
+	if int64(len(b)) > left {
 		n, err = fb.readerAt.ReadAt(b[:left], fb.readed+fb.readRange.Begin)
 	} else {
 		n, err = fb.readerAt.ReadAt(b, fb.readed+fb.readRange.Begin)
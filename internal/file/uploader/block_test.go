@@ -50,3 +50,36 @@ func TestSplitUnitRead(t *testing.T) {
 		fmt.Printf("n: %d, left: %d\n", n, unit.Left())
 	}
 }
+
+// zeroReaderAt 任意位置都读取到0, 用于模拟大文件
+type zeroReaderAt struct{}
+
+func (zeroReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestSplitUnitReadLargeBlock(t *testing.T) {
+	// 超过 2GB 的分片, 剩余长度不能转换为 int 比较
+	var size int64 = 3 * 1024 * 1024 * 1024
+	unit := uploader.NewBufioSplitUnit(zeroReaderAt{}, transfer.Range{Begin: 0, End: size}, nil, nil)
+
+	buf := make([]byte, 1024)
+	n, err := unit.Read(buf)
+	if err != nil || n != len(buf) {
+		t.Fatalf("n: %d, err: %v", n, err)
+	}
+
+	unit = uploader.NewBufioSplitUnit(zeroReaderAt{}, transfer.Range{Begin: 0, End: size}, nil, nil)
+	if _, err = unit.Seek(-10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err = unit.Read(buf); err != nil || n != 10 {
+		t.Fatalf("n: %d, err: %v", n, err)
+	}
+	if _, err = unit.Read(buf); err != io.EOF {
+		t.Fatalf("err: %v", err)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/phpc0de/ctlibgo/requester/rio"
 	"github.com/phpc0de/ctlibgo/requester/rio/speeds"
 	"github.com/phpc0de/ctpango/internal/utils"
+	"github.com/phpc0de/ctpango/library/requester/transfer"
 	"sync"
 	"time"
 )
@@ -48,7 +49,7 @@ type (
 		config      *MultiUploaderConfig
 		workers     workerList
 		speedsStat  *speeds.Speeds
-		rateLimit   *speeds.RateLimit
+		rateLimit   transfer.RateLimiter
 
 		executeTime             time.Time
 		finished                chan struct{}
@@ -71,6 +72,7 @@ type (
 		Parallel  int   // 上传并发量
 		BlockSize int64 // 上传分块
 		MaxRate   int64 // 限制最大上传速度
+		RateSchedule func(now time.Time) int64 // 按时间段限速, 返回该时间的最大上传速度, 0代表不限制
 	}
 )
 
@@ -140,9 +142,19 @@ func (muer *MultiUploader) Execute() {
 	muer.lazyInit()
 
 	// 初始化限速
-	if muer.config.MaxRate > 0 {
-		muer.rateLimit = speeds.NewRateLimit(muer.config.MaxRate)
-		defer muer.rateLimit.Stop()
+	if muer.config.RateSchedule != nil {
+		srl := transfer.NewScheduledRateLimit(muer.config.RateSchedule)
+		muer.rateLimit = srl
+		defer srl.Stop()
+
+		// 按时间段调整限速
+		scheduleCtx, scheduleCancelFunc := context.WithCancel(context.Background())
+		defer scheduleCancelFunc()
+		go srl.Run(scheduleCtx)
+	} else if muer.config.MaxRate > 0 {
+		rl := speeds.NewRateLimit(muer.config.MaxRate)
+		muer.rateLimit = rl
+		defer rl.Stop()
 	}
 
 	// 分配任务
@@ -0,0 +1,109 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package uploader_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/phpc0de/ctlibgo/requester/rio"
+	"github.com/phpc0de/ctpango/internal/file/uploader"
+)
+
+// slowMultiUpload 每个分片分多次读取, 每次读取后等待, 模拟较慢的上传
+type slowMultiUpload struct {
+	mu    sync.Mutex
+	parts int
+}
+
+func (s *slowMultiUpload) Precreate() error {
+	return nil
+}
+
+func (s *slowMultiUpload) UploadFile(ctx context.Context, partseq int, partOffset int64, partEnd int64, readerlen64 rio.ReaderLen64) (bool, error) {
+	buf := make([]byte, 1024)
+	for {
+		_, err := readerlen64.Read(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	s.mu.Lock()
+	s.parts++
+	s.mu.Unlock()
+	return true, nil
+}
+
+func (s *slowMultiUpload) CommitFile() error {
+	return nil
+}
+
+func TestMultiUploaderStatusEvent(t *testing.T) {
+	const (
+		blockSize = 4 * 1024
+		numBlocks = 4
+	)
+	data := make([]byte, blockSize*numBlocks)
+	file, err := ioutil.TempFile(t.TempDir(), "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err = file.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	mu := &slowMultiUpload{}
+	muer := uploader.NewMultiUploader("/upload", "/commit", "1", "1", mu, rio.NewFileReaderAtLen64(file), &uploader.MultiUploaderConfig{
+		Parallel:  1,
+		BlockSize: blockSize,
+	})
+
+	var (
+		statusMu sync.Mutex
+		statuses []uploader.Status
+	)
+	muer.OnUploadStatusEvent(func(status uploader.Status, updateChan <-chan struct{}) {
+		statusMu.Lock()
+		defer statusMu.Unlock()
+		statuses = append(statuses, status)
+	})
+	succeed := false
+	muer.OnSuccess(func() {
+		succeed = true
+	})
+	muer.Execute()
+
+	if !succeed || mu.parts != numBlocks {
+		t.Fatalf("succeed: %v, parts: %d", succeed, mu.parts)
+	}
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	if len(statuses) == 0 {
+		t.Fatal("upload status event not fired")
+	}
+	for _, status := range statuses {
+		if status.TotalSize() != int64(len(data)) || status.Uploaded() < 0 || status.Uploaded() > status.TotalSize() {
+			t.Errorf("total: %d, uploaded: %d", status.TotalSize(), status.Uploaded())
+		}
+	}
+}
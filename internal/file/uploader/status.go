@@ -24,6 +24,7 @@ type (
 		Uploaded() int64            // 已上传数据
 		SpeedsPerSecond() int64     // 每秒的上传速度
 		TimeElapsed() time.Duration // 上传时间
+		TimeLeft() time.Duration    // 预计剩余时间, 小于0代表未知
 	}
 
 	// UploadStatus 上传状态
@@ -32,8 +33,10 @@ type (
 		uploaded        int64         // 已上传数据
 		speedsPerSecond int64         // 每秒的上传速度
 		timeElapsed     time.Duration // 上传时间
+		timeLeft        time.Duration // 预计剩余时间
 	}
 
+	// UploadStatusFunc 上传状态事件, 上传期间每秒调用一次
 	UploadStatusFunc func(status Status, updateChan <-chan struct{})
 )
 
@@ -57,6 +60,23 @@ func (us *UploadStatus) TimeElapsed() time.Duration {
 	return us.timeElapsed
 }
 
+// TimeLeft 返回预计剩余时间, 小于0代表未知
+func (us *UploadStatus) TimeLeft() time.Duration {
+	return us.timeLeft
+}
+
+// uploadTimeLeft 根据当前速度计算剩余时间, 速度为0时返回-1
+func uploadTimeLeft(totalSize, uploaded, speedsPerSecond int64) time.Duration {
+	if speedsPerSecond <= 0 {
+		return -1
+	}
+	left := totalSize - uploaded
+	if left < 0 {
+		left = 0
+	}
+	return time.Duration(left/speedsPerSecond) * time.Second
+}
+
 // GetStatusChan 获取上传状态
 func (u *Uploader) GetStatusChan() <-chan Status {
 	c := make(chan Status)
@@ -82,6 +102,7 @@ func (u *Uploader) GetStatusChan() <-chan Status {
 					uploaded:        readed,
 					speedsPerSecond: readed - old,
 					timeElapsed:     time.Since(u.executeTime) / 1e7 * 1e7,
+					timeLeft:        uploadTimeLeft(u.readed64.Len(), readed, readed-old),
 				}
 			}
 		}
@@ -103,11 +124,13 @@ func (muer *MultiUploader) uploadStatusEvent() {
 				return
 			case <-ticker.C:
 				readed := muer.workers.Readed()
+				speedsPerSecond := muer.speedsStat.GetSpeeds()
 				muer.onUploadStatusEvent(&UploadStatus{
 					totalSize:       muer.file.Len(),
 					uploaded:        readed,
-					speedsPerSecond: muer.speedsStat.GetSpeeds(),
+					speedsPerSecond: speedsPerSecond,
 					timeElapsed:     time.Since(muer.executeTime) / 1e8 * 1e8,
+					timeLeft:        uploadTimeLeft(muer.file.Len(), readed, speedsPerSecond),
 				}, muer.updateInstanceStateChan)
 			}
 		}
@@ -0,0 +1,189 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandiff
+
+import (
+	"fmt"
+	"github.com/phpc0de/ctpango/internal/localfile"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorReset  = "\x1b[0m"
+)
+
+type (
+	// FileEntry 参与对比的文件
+	FileEntry struct {
+		Path      string `json:"path"`          // 相对于对比根目录的路径, 使用 / 分隔
+		Size      int64  `json:"size"`          // 文件大小
+		MD5       string `json:"md5,omitempty"` // 文件md5, 本地文件只在需要时计算
+		LocalPath string `json:"-"`             // 本地文件的完整路径, 云盘文件为空
+	}
+
+	// ModifiedEntry 本地和云盘都存在, 但内容不同的文件
+	ModifiedEntry struct {
+		Path  string     `json:"path"`
+		Local *FileEntry `json:"local"`
+		Cloud *FileEntry `json:"cloud"`
+	}
+
+	// DiffResult 本地目录和云盘目录的对比结果, 各列表均按路径排序
+	DiffResult struct {
+		OnlyLocal []*FileEntry     `json:"onlyLocal"` // 只存在于本地的文件
+		OnlyCloud []*FileEntry     `json:"onlyCloud"` // 只存在于云盘的文件
+		Modified  []*ModifiedEntry `json:"modified"`  // 内容不同的文件
+	}
+
+	// MD5Func 计算本地文件的md5
+	MD5Func func(entry *FileEntry) (string, error)
+)
+
+// HasDiff 是否存在差异
+func (dr *DiffResult) HasDiff() bool {
+	return len(dr.OnlyLocal) > 0 || len(dr.OnlyCloud) > 0 || len(dr.Modified) > 0
+}
+
+// LocalMD5 计算本地文件的md5
+func LocalMD5(entry *FileEntry) (string, error) {
+	lfc, err := localfile.GetFileSum(entry.LocalPath, localfile.CHECKSUM_MD5)
+	if err != nil {
+		return "", err
+	}
+	return lfc.MD5, nil
+}
+
+// LocalFiles 列出本地目录下的所有文件, 不计算md5
+func LocalFiles(localDir string) ([]*FileEntry, error) {
+	entries := make([]*FileEntry, 0)
+	err := filepath.Walk(localDir, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(localDir, file)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &FileEntry{
+			Path:      filepath.ToSlash(rel),
+			Size:      fi.Size(),
+			LocalPath: file,
+		})
+		return nil
+	})
+	return entries, err
+}
+
+// RelativeCloudPath 返回云盘文件相对于 cloudDir 的路径
+func RelativeCloudPath(cloudDir, cloudPath string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(path.Clean(cloudPath), path.Clean(cloudDir)), "/")
+}
+
+// Diff 对比本地文件和云盘文件, 先比较文件大小, 大小相同时再比较md5.
+// 本地文件没有md5时使用 md5Func 计算, md5Func 为 nil 或云盘文件没有md5时只比较文件大小
+func Diff(local, cloud []*FileEntry, md5Func MD5Func) (*DiffResult, error) {
+	result := &DiffResult{
+		OnlyLocal: make([]*FileEntry, 0),
+		OnlyCloud: make([]*FileEntry, 0),
+		Modified:  make([]*ModifiedEntry, 0),
+	}
+
+	cloudFiles := make(map[string]*FileEntry, len(cloud))
+	for _, entry := range cloud {
+		cloudFiles[entry.Path] = entry
+	}
+
+	for _, localEntry := range local {
+		cloudEntry, ok := cloudFiles[localEntry.Path]
+		if !ok {
+			result.OnlyLocal = append(result.OnlyLocal, localEntry)
+			continue
+		}
+		delete(cloudFiles, localEntry.Path)
+
+		same, err := sameContent(localEntry, cloudEntry, md5Func)
+		if err != nil {
+			return nil, fmt.Errorf("计算文件md5失败: %s, %s", localEntry.LocalPath, err)
+		}
+		if !same {
+			result.Modified = append(result.Modified, &ModifiedEntry{
+				Path:  localEntry.Path,
+				Local: localEntry,
+				Cloud: cloudEntry,
+			})
+		}
+	}
+	for _, entry := range cloudFiles {
+		result.OnlyCloud = append(result.OnlyCloud, entry)
+	}
+
+	sort.Slice(result.OnlyLocal, func(i, j int) bool { return result.OnlyLocal[i].Path < result.OnlyLocal[j].Path })
+	sort.Slice(result.OnlyCloud, func(i, j int) bool { return result.OnlyCloud[i].Path < result.OnlyCloud[j].Path })
+	sort.Slice(result.Modified, func(i, j int) bool { return result.Modified[i].Path < result.Modified[j].Path })
+	return result, nil
+}
+
+func sameContent(localEntry, cloudEntry *FileEntry, md5Func MD5Func) (bool, error) {
+	if localEntry.Size != cloudEntry.Size {
+		return false, nil
+	}
+	if cloudEntry.MD5 == "" {
+		return true, nil
+	}
+	if localEntry.MD5 == "" {
+		if md5Func == nil {
+			return true, nil
+		}
+		sum, err := md5Func(localEntry)
+		if err != nil {
+			return false, err
+		}
+		localEntry.MD5 = sum
+	}
+	return strings.EqualFold(localEntry.MD5, cloudEntry.MD5), nil
+}
+
+// WriteText 输出对比结果, color 为 true 时使用颜色区分: 只存在于本地为红色, 只存在于云盘为绿色, 内容不同为黄色
+func WriteText(w io.Writer, result *DiffResult, color bool) {
+	paint := func(c, s string) string {
+		if !color {
+			return s
+		}
+		return c + s + colorReset
+	}
+
+	fmt.Fprintf(w, "只存在于本地的文件 (%d):\n", len(result.OnlyLocal))
+	for _, entry := range result.OnlyLocal {
+		fmt.Fprintln(w, paint(colorRed, "  - "+entry.Path))
+	}
+	fmt.Fprintf(w, "\n只存在于云盘的文件 (%d):\n", len(result.OnlyCloud))
+	for _, entry := range result.OnlyCloud {
+		fmt.Fprintln(w, paint(colorGreen, "  + "+entry.Path))
+	}
+	fmt.Fprintf(w, "\n内容不同的文件 (%d):\n", len(result.Modified))
+	for _, entry := range result.Modified {
+		fmt.Fprintln(w, paint(colorYellow, "  ~ "+entry.Path))
+	}
+}
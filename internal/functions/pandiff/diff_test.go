@@ -0,0 +1,148 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandiff_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/phpc0de/ctpango/internal/functions/pandiff"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	local := []*pandiff.FileEntry{
+		{Path: "a.txt", Size: 1, LocalPath: "a"},
+		{Path: "dir/b.txt", Size: 2, LocalPath: "b"},
+		{Path: "dir/c.txt", Size: 3, LocalPath: "c"},
+		{Path: "d.txt", Size: 4, LocalPath: "d"},
+		{Path: "e.txt", Size: 5, LocalPath: "e"},
+	}
+	cloud := []*pandiff.FileEntry{
+		{Path: "dir/b.txt", Size: 2, MD5: "BBBB"},
+		{Path: "dir/c.txt", Size: 3, MD5: "CCCC"},
+		{Path: "d.txt", Size: 40, MD5: "DDDD"},
+		{Path: "e.txt", Size: 5},
+		{Path: "z.txt", Size: 6},
+	}
+	hashed := make([]string, 0)
+	md5Func := func(entry *pandiff.FileEntry) (string, error) {
+		hashed = append(hashed, entry.LocalPath)
+		return map[string]string{"b": "bbbb", "c": "cccd"}[entry.LocalPath], nil
+	}
+
+	result, err := pandiff.Diff(local, cloud, md5Func)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.OnlyLocal) != 1 || result.OnlyLocal[0].Path != "a.txt" {
+		t.Fatalf("only local: %+v", result.OnlyLocal)
+	}
+	if len(result.OnlyCloud) != 1 || result.OnlyCloud[0].Path != "z.txt" {
+		t.Fatalf("only cloud: %+v", result.OnlyCloud)
+	}
+	if len(result.Modified) != 2 || result.Modified[0].Path != "d.txt" || result.Modified[1].Path != "dir/c.txt" {
+		t.Fatalf("modified: %+v", result.Modified)
+	}
+	// 大小不同或云盘没有md5时不计算本地md5
+	if strings.Join(hashed, ",") != "b,c" {
+		t.Fatalf("hashed: %v", hashed)
+	}
+	if !result.HasDiff() {
+		t.Fatal("should have diff")
+	}
+}
+
+func TestDiffMD5Error(t *testing.T) {
+	local := []*pandiff.FileEntry{{Path: "a.txt", Size: 1}}
+	cloud := []*pandiff.FileEntry{{Path: "a.txt", Size: 1, MD5: "AAAA"}}
+	_, err := pandiff.Diff(local, cloud, func(entry *pandiff.FileEntry) (string, error) {
+		return "", errors.New("read error")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDiffNoDiff(t *testing.T) {
+	result, err := pandiff.Diff(nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.HasDiff() {
+		t.Fatal("should not have diff")
+	}
+}
+
+func TestLocalFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pandiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.MkdirAll(filepath.Join(dir, "sub", "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "sub", "1.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := pandiff.LocalFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != "sub/1.txt" || entries[0].Size != 5 {
+		t.Fatalf("entries: %+v", entries)
+	}
+	sum, err := pandiff.LocalMD5(entries[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.EqualFold(sum, "5d41402abc4b2a76b9719d911017c592") {
+		t.Fatalf("md5: %s", sum)
+	}
+}
+
+func TestRelativeCloudPath(t *testing.T) {
+	if p := pandiff.RelativeCloudPath("/我的资源/", "/我的资源/dir/1.txt"); p != "dir/1.txt" {
+		t.Fatalf("got %s", p)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	result := &pandiff.DiffResult{
+		OnlyLocal: []*pandiff.FileEntry{{Path: "a.txt"}},
+		OnlyCloud: []*pandiff.FileEntry{{Path: "b.txt"}},
+		Modified:  []*pandiff.ModifiedEntry{{Path: "c.txt"}},
+	}
+
+	buf := &bytes.Buffer{}
+	pandiff.WriteText(buf, result, false)
+	out := buf.String()
+	if !strings.Contains(out, "  - a.txt\n") || !strings.Contains(out, "  + b.txt\n") || !strings.Contains(out, "  ~ c.txt\n") {
+		t.Fatalf("output: %s", out)
+	}
+	if strings.Contains(out, "\x1b[") {
+		t.Fatal("should not contain color")
+	}
+
+	buf.Reset()
+	pandiff.WriteText(buf, result, true)
+	if !strings.Contains(buf.String(), "\x1b[31m  - a.txt\x1b[0m") {
+		t.Fatalf("colored output: %q", buf.String())
+	}
+}
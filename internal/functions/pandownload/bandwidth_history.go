@@ -0,0 +1,116 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload
+
+import (
+	"encoding/csv"
+	"github.com/phpc0de/ctpango/internal/file/downloader"
+	"github.com/phpc0de/ctpango/library/requester/transfer"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type (
+	// BandwidthHistory 把每秒的下载速度采样写入CSV文件, 多个下载任务共用一个文件
+	BandwidthHistory struct {
+		file io.Closer
+		w    *csv.Writer
+		mu   sync.Mutex
+	}
+)
+
+// BandwidthHistoryHeader CSV文件的表头, worker_speeds 按线程ID排序展开为多列
+var BandwidthHistoryHeader = []string{"timestamp", "task_id", "total_speed_bps", "worker_speeds"}
+
+// NewBandwidthHistory 创建CSV文件并写入表头, 文件已存在时覆盖
+func NewBandwidthHistory(csvPath string) (*BandwidthHistory, error) {
+	file, err := os.Create(csvPath)
+	if err != nil {
+		return nil, err
+	}
+	bh := newBandwidthHistory(file, file)
+	if err = bh.writeRecord(BandwidthHistoryHeader); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return bh, nil
+}
+
+func newBandwidthHistory(w io.Writer, closer io.Closer) *BandwidthHistory {
+	return &BandwidthHistory{
+		file: closer,
+		w:    csv.NewWriter(w),
+	}
+}
+
+func (bh *BandwidthHistory) writeRecord(record []string) error {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+	if err := bh.w.Write(record); err != nil {
+		return err
+	}
+	// 每行都写入文件, 中途退出也能保留已有的采样
+	bh.w.Flush()
+	return bh.w.Error()
+}
+
+// WriteSample 写入一行采样
+func (bh *BandwidthHistory) WriteSample(now time.Time, taskId string, totalSpeeds int64, workerSpeeds []int64) error {
+	record := make([]string, 0, 3+len(workerSpeeds))
+	record = append(record, now.Format(time.RFC3339), taskId, strconv.FormatInt(totalSpeeds, 10))
+	for _, speeds := range workerSpeeds {
+		record = append(record, strconv.FormatInt(speeds, 10))
+	}
+	return bh.writeRecord(record)
+}
+
+// RecordWorkers 记录当前的总下载速度和各个线程的下载速度
+func (bh *BandwidthHistory) RecordWorkers(taskId string, status transfer.DownloadStatuser, workersCallback func(downloader.RangeWorkerFunc)) error {
+	type workerSpeeds struct {
+		id     int
+		speeds int64
+	}
+	workers := make([]workerSpeeds, 0)
+	if workersCallback != nil {
+		workersCallback(func(key int, worker *downloader.Worker) bool {
+			workers = append(workers, workerSpeeds{worker.ID(), worker.GetSpeedsPerSecond()})
+			return true
+		})
+	}
+	// Monitor 会调整 worker 的顺序, 按ID排序使每一列对应同一个线程
+	sort.Slice(workers, func(i, j int) bool {
+		return workers[i].id < workers[j].id
+	})
+
+	speeds := make([]int64, 0, len(workers))
+	for _, w := range workers {
+		speeds = append(speeds, w.speeds)
+	}
+	return bh.WriteSample(time.Now(), taskId, status.SpeedsPerSecond(), speeds)
+}
+
+// Close 关闭CSV文件
+func (bh *BandwidthHistory) Close() error {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+	bh.w.Flush()
+	if bh.file == nil {
+		return bh.w.Error()
+	}
+	return bh.file.Close()
+}
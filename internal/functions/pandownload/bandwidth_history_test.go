@@ -0,0 +1,62 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload_test
+
+import (
+	"github.com/phpc0de/ctpango/internal/functions/pandownload"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBandwidthHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pandownload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	csvPath := filepath.Join(dir, "history.csv")
+
+	bh, err := pandownload.NewBandwidthHistory(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err = bh.WriteSample(now, "1", 3072, []int64{1024, 2048}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 每行写入后立即可见
+	data, err := ioutil.ReadFile(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "timestamp,task_id,total_speed_bps,worker_speeds\n2021-01-02T03:04:05Z,1,3072,1024,2048\n"
+	if string(data) != expected {
+		t.Fatalf("got %q, want %q", data, expected)
+	}
+
+	if err = bh.WriteSample(now.Add(time.Second), "2", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = bh.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = ioutil.ReadFile(csvPath)
+	if string(data) != expected+"2021-01-02T03:04:06Z,2,0\n" {
+		t.Fatalf("got %q", data)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/phpc0de/ctpango/internal/file/downloader"
+)
+
+const (
+	// OrphanMinAge 断点续传文件至少这么久没有更新才认为是遗留的, 避免清理正在进行的下载
+	OrphanMinAge = 10 * time.Minute
+)
+
+type (
+	// OrphanedDownload 下载中断后遗留的断点续传文件和未完成的下载文件
+	OrphanedDownload struct {
+		StatePath  string    // 断点续传文件路径
+		FilePath   string    // 未完成的下载文件路径
+		FileExists bool      // 下载文件是否存在
+		FileSize   int64     // 下载文件的大小
+		TotalSize  int64     // 断点续传信息中记录的文件大小, 0为未知
+		ModTime    time.Time // 断点续传文件最后修改的时间
+	}
+)
+
+// FindOrphanedDownloads 查找 dir 目录下遗留的断点续传文件.
+// 只返回 olderThan 时间内没有修改过的断点续传文件, olderThan 小于 OrphanMinAge 时使用 OrphanMinAge.
+// 下载完成后会删除断点续传文件, 预分配空间的下载文件大小与总大小相同,
+// 所以下载文件不大于记录的总大小时认为是未完成的下载, 大于时认为不是同一个文件, 跳过.
+// 断点续传信息记录已下载完成的, 和正在被其他进程下载(持有下载锁)的, 也跳过
+func FindOrphanedDownloads(dir string, olderThan time.Duration, now time.Time) ([]*OrphanedDownload, error) {
+	if olderThan < OrphanMinAge {
+		olderThan = OrphanMinAge
+	}
+	list := []*OrphanedDownload{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), DownloadSuffix) {
+			return nil
+		}
+		if now.Sub(info.ModTime()) < olderThan {
+			return nil
+		}
+
+		od := &OrphanedDownload{
+			StatePath: path,
+			FilePath:  strings.TrimSuffix(path, DownloadSuffix),
+			ModTime:   info.ModTime(),
+		}
+		if ii := downloader.LoadInstanceInfo(path); ii != nil && ii.DownloadStatus != nil {
+			od.TotalSize = ii.DownloadStatus.TotalSize()
+			if od.TotalSize > 0 && ii.DownloadStatus.Downloaded() >= od.TotalSize {
+				// 已下载完成, 不是遗留的文件
+				return nil
+			}
+		}
+		if od.isLocked() {
+			return nil
+		}
+		if fi, err := os.Stat(od.FilePath); err == nil && !fi.IsDir() {
+			od.FileExists = true
+			od.FileSize = fi.Size()
+			if od.TotalSize > 0 && od.FileSize > od.TotalSize {
+				return nil
+			}
+		}
+		list = append(list, od)
+		return nil
+	})
+	return list, err
+}
+
+// lockPath 返回下载锁文件路径, 与下载时使用的相同
+func (od *OrphanedDownload) lockPath() string {
+	return od.FilePath + downloader.LockFileSuffix
+}
+
+// isLocked 是否正在被下载
+func (od *OrphanedDownload) isLocked() bool {
+	lock, err := downloader.LockFile(od.lockPath(), 0)
+	if err != nil {
+		return err == downloader.ErrFileLocked
+	}
+	lock.Unlock()
+	return false
+}
+
+// Remove 删除断点续传文件和未完成的下载文件, 删除期间持有下载锁, 文件正在被下载时返回错误
+func (od *OrphanedDownload) Remove() error {
+	lock, err := downloader.LockFile(od.lockPath(), 0)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if od.FileExists {
+		if err := os.Remove(od.FilePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Remove(od.StatePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
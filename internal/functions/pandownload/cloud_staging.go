@@ -0,0 +1,198 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctapi/cloudpan/apierror"
+)
+
+const (
+	// CloudStagingDirName 下载前移动网盘文件的暂存目录名称, 位于文件所在的目录下
+	CloudStagingDirName = "_downloading"
+	// CloudDeleteCheckTimes 查询网盘删除任务状态的最大次数
+	CloudDeleteCheckTimes = 10
+)
+
+var (
+	// cloudDeleteCheckInterval 查询网盘删除任务状态的间隔
+	cloudDeleteCheckInterval = 500 * time.Millisecond
+)
+
+type (
+	// cloudStagingClient 移动和删除网盘暂存文件使用的接口, 便于测试
+	cloudStagingClient interface {
+		AppFileInfoByPath(familyId int64, pathStr string) (*cloudpan.AppFileEntity, *apierror.ApiError)
+		AppMkdirRecursive(familyId int64, parentFileId string, fullPath string, index int, pathSlice []string) (*cloudpan.AppMkdirResult, *apierror.ApiError)
+		AppMoveFile(fileIdList []string, targetFolderId string) (*cloudpan.AppMoveFileResult, *apierror.ApiError)
+		AppFamilyMoveFile(familyId int64, fileId string, destParentId string) (*cloudpan.AppFileEntity, *apierror.ApiError)
+		CreateBatchTask(param *cloudpan.BatchTaskParam) (string, *apierror.ApiError)
+		AppCreateBatchTask(familyId int64, param *cloudpan.BatchTaskParam) (string, *apierror.ApiError)
+		CheckBatchTask(typeFlag cloudpan.BatchTaskType, taskId string) (*cloudpan.CheckTaskResult, *apierror.ApiError)
+		AppCheckBatchTask(typeFlag cloudpan.BatchTaskType, taskId string) (*cloudpan.CheckTaskResult, *apierror.ApiError)
+		AppFileList(param *cloudpan.AppFileListParam) (*cloudpan.AppFileListResult, *apierror.ApiError)
+	}
+
+	// CloudStagingDirs 记录下载过程中使用过的网盘暂存目录, 所有文件下载结束后删除其中的空目录, 多个任务共享, 线程安全
+	CloudStagingDirs struct {
+		dirs map[string]int64 // 暂存目录路径 -> 家庭云ID
+		mu   sync.Mutex
+	}
+)
+
+// CloudStagingDir 返回网盘文件 panPath 对应的暂存目录路径
+func CloudStagingDir(panPath string) string {
+	return path.Join(path.Dir(path.Clean(panPath)), CloudStagingDirName)
+}
+
+// CloudStagingPath 返回网盘文件 panPath 移动到暂存目录后的路径
+func CloudStagingPath(panPath string) string {
+	return path.Join(CloudStagingDir(panPath), path.Base(panPath))
+}
+
+// isInCloudStagingDir 网盘文件是否已经位于暂存目录中, 这些文件不再移动
+func isInCloudStagingDir(panPath string) bool {
+	return path.Base(path.Dir(path.Clean(panPath))) == CloudStagingDirName
+}
+
+// moveCloudFile 移动网盘文件到 targetFolderId 目录
+func moveCloudFile(client cloudStagingClient, familyId int64, fileId, targetFolderId string) error {
+	var apierr *apierror.ApiError
+	if familyId > 0 {
+		_, apierr = client.AppFamilyMoveFile(familyId, fileId, targetFolderId)
+	} else {
+		_, apierr = client.AppMoveFile([]string{fileId}, targetFolderId)
+	}
+	if apierr != nil {
+		return apierr
+	}
+	return nil
+}
+
+// moveToCloudStaging 移动网盘文件到暂存目录, 暂存目录不存在时自动创建, 返回移动后的路径
+func moveToCloudStaging(client cloudStagingClient, familyId int64, panPath string, fe *cloudpan.AppFileEntity) (string, error) {
+	stagingDir := CloudStagingDir(panPath)
+	rs, apierr := client.AppMkdirRecursive(familyId, "", "", 0, strings.Split(stagingDir, "/"))
+	if apierr != nil {
+		return "", fmt.Errorf("创建暂存目录 %s 失败, %s", stagingDir, apierr)
+	}
+	if rs == nil || rs.FileId == "" {
+		return "", fmt.Errorf("创建暂存目录 %s 失败", stagingDir)
+	}
+	if err := moveCloudFile(client, familyId, fe.FileId, rs.FileId); err != nil {
+		return "", err
+	}
+	return CloudStagingPath(panPath), nil
+}
+
+// findCloudStaged 查找上次下载中断后遗留在暂存目录中的网盘文件, 同时返回原目录的ID
+func findCloudStaged(client cloudStagingClient, familyId int64, panPath string) (fe *cloudpan.AppFileEntity, originParentId string, err error) {
+	fe, apierr := client.AppFileInfoByPath(familyId, CloudStagingPath(panPath))
+	if apierr != nil {
+		return nil, "", apierr
+	}
+	parent, apierr := client.AppFileInfoByPath(familyId, path.Dir(path.Clean(panPath)))
+	if apierr != nil {
+		return nil, "", apierr
+	}
+	return fe, parent.FileId, nil
+}
+
+// deleteCloudFile 删除网盘文件, 文件会被移入回收站
+func deleteCloudFile(client cloudStagingClient, familyId int64, fe *cloudpan.AppFileEntity) error {
+	isFolder := 0
+	if fe.IsFolder {
+		isFolder = 1
+	}
+	delParam := &cloudpan.BatchTaskParam{
+		TypeFlag: cloudpan.BatchTaskTypeDelete,
+		TaskInfos: cloudpan.BatchTaskInfoList{
+			&cloudpan.BatchTaskInfo{
+				FileId:      fe.FileId,
+				FileName:    fe.FileName,
+				IsFolder:    isFolder,
+				SrcParentId: fe.ParentId,
+			},
+		},
+	}
+
+	var (
+		taskId  string
+		taskRes *cloudpan.CheckTaskResult
+		apierr  *apierror.ApiError
+	)
+	if familyId > 0 {
+		taskId, apierr = client.AppCreateBatchTask(familyId, delParam)
+	} else {
+		taskId, apierr = client.CreateBatchTask(delParam)
+	}
+	if apierr != nil {
+		return apierr
+	}
+
+	// 删除任务是异步执行的, 多查询几次任务状态
+	for i := 0; i < CloudDeleteCheckTimes; i++ {
+		time.Sleep(cloudDeleteCheckInterval)
+		if familyId > 0 {
+			taskRes, apierr = client.AppCheckBatchTask(cloudpan.BatchTaskTypeDelete, taskId)
+		} else {
+			taskRes, apierr = client.CheckBatchTask(cloudpan.BatchTaskTypeDelete, taskId)
+		}
+		if apierr != nil {
+			return apierr
+		}
+		if taskRes.TaskStatus == cloudpan.BatchTaskStatusOk {
+			return nil
+		}
+	}
+	return fmt.Errorf("删除任务未完成")
+}
+
+// Add 记录使用过的暂存目录
+func (csd *CloudStagingDirs) Add(familyId int64, stagingDir string) {
+	csd.mu.Lock()
+	defer csd.mu.Unlock()
+	if csd.dirs == nil {
+		csd.dirs = map[string]int64{}
+	}
+	csd.dirs[stagingDir] = familyId
+}
+
+// RemoveEmpty 删除使用过的暂存目录中的空目录, 不为空的目录说明还有文件没有下载成功, 保留
+func (csd *CloudStagingDirs) RemoveEmpty(client cloudStagingClient) {
+	csd.mu.Lock()
+	defer csd.mu.Unlock()
+	for stagingDir, familyId := range csd.dirs {
+		fe, apierr := client.AppFileInfoByPath(familyId, stagingDir)
+		if apierr != nil || !fe.IsFolder {
+			continue
+		}
+		fl, apierr := client.AppFileList(&cloudpan.AppFileListParam{FamilyId: familyId, FileId: fe.FileId, PageNum: 1, PageSize: 1})
+		if apierr != nil || fl.Count > 0 || len(fl.FileList) > 0 {
+			continue
+		}
+		if err := deleteCloudFile(client, familyId, fe); err != nil {
+			fmt.Printf("删除网盘暂存目录失败: %s, %s\n", stagingDir, err)
+			continue
+		}
+		fmt.Printf("已删除网盘暂存目录: %s\n", stagingDir)
+	}
+	csd.dirs = nil
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctapi/cloudpan/apierror"
+)
+
+type fakeStagingClient struct {
+	files      map[string]*cloudpan.AppFileEntity
+	mkdirPaths []string
+	moves      []string // fileId>targetFolderId
+	familyMove bool
+	deleted    []string
+	pending    int            // 删除任务前几次查询返回未完成
+	children   map[string]int // 目录ID -> 文件数量
+}
+
+func (c *fakeStagingClient) AppFileInfoByPath(familyId int64, pathStr string) (*cloudpan.AppFileEntity, *apierror.ApiError) {
+	if fe, ok := c.files[pathStr]; ok {
+		return fe, nil
+	}
+	return nil, apierror.NewApiError(apierror.ApiCodeFileNotFoundCode, "文件不存在")
+}
+
+func (c *fakeStagingClient) AppMkdirRecursive(familyId int64, parentFileId string, fullPath string, index int, pathSlice []string) (*cloudpan.AppMkdirResult, *apierror.ApiError) {
+	c.mkdirPaths = append(c.mkdirPaths, strings.Join(pathSlice, "/"))
+	return &cloudpan.AppMkdirResult{FileId: "staging"}, nil
+}
+
+func (c *fakeStagingClient) AppMoveFile(fileIdList []string, targetFolderId string) (*cloudpan.AppMoveFileResult, *apierror.ApiError) {
+	for _, id := range fileIdList {
+		c.moves = append(c.moves, id+">"+targetFolderId)
+	}
+	return &cloudpan.AppMoveFileResult{}, nil
+}
+
+func (c *fakeStagingClient) AppFamilyMoveFile(familyId int64, fileId string, destParentId string) (*cloudpan.AppFileEntity, *apierror.ApiError) {
+	c.familyMove = true
+	c.moves = append(c.moves, fileId+">"+destParentId)
+	return &cloudpan.AppFileEntity{}, nil
+}
+
+func (c *fakeStagingClient) CreateBatchTask(param *cloudpan.BatchTaskParam) (string, *apierror.ApiError) {
+	for _, info := range param.TaskInfos {
+		c.deleted = append(c.deleted, info.FileId)
+	}
+	return "task", nil
+}
+
+func (c *fakeStagingClient) AppCreateBatchTask(familyId int64, param *cloudpan.BatchTaskParam) (string, *apierror.ApiError) {
+	return c.CreateBatchTask(param)
+}
+
+func (c *fakeStagingClient) CheckBatchTask(typeFlag cloudpan.BatchTaskType, taskId string) (*cloudpan.CheckTaskResult, *apierror.ApiError) {
+	if c.pending > 0 {
+		c.pending--
+		return &cloudpan.CheckTaskResult{TaskStatus: cloudpan.BatchTaskStatusNotAction}, nil
+	}
+	return &cloudpan.CheckTaskResult{TaskStatus: cloudpan.BatchTaskStatusOk}, nil
+}
+
+func (c *fakeStagingClient) AppCheckBatchTask(typeFlag cloudpan.BatchTaskType, taskId string) (*cloudpan.CheckTaskResult, *apierror.ApiError) {
+	return c.CheckBatchTask(typeFlag, taskId)
+}
+
+func (c *fakeStagingClient) AppFileList(param *cloudpan.AppFileListParam) (*cloudpan.AppFileListResult, *apierror.ApiError) {
+	return &cloudpan.AppFileListResult{Count: c.children[param.FileId]}, nil
+}
+
+func useFastCloudDeleteCheck(t *testing.T) {
+	interval := cloudDeleteCheckInterval
+	cloudDeleteCheckInterval = time.Millisecond
+	t.Cleanup(func() { cloudDeleteCheckInterval = interval })
+}
+
+func TestCloudStagingPath(t *testing.T) {
+	if got := CloudStagingPath("/我的资源/1.mp4"); got != "/我的资源/_downloading/1.mp4" {
+		t.Fatalf("CloudStagingPath = %s", got)
+	}
+	if got := CloudStagingPath("/1.mp4"); got != "/_downloading/1.mp4" {
+		t.Fatalf("CloudStagingPath = %s", got)
+	}
+	if !isInCloudStagingDir("/我的资源/_downloading/1.mp4") || isInCloudStagingDir("/我的资源/1.mp4") {
+		t.Fatal("isInCloudStagingDir wrong")
+	}
+}
+
+func TestMoveToCloudStaging(t *testing.T) {
+	useFastCloudDeleteCheck(t)
+	c := &fakeStagingClient{}
+	fe := &cloudpan.AppFileEntity{FileId: "f1", ParentId: "p1", FileName: "1.mp4"}
+	staged, err := moveToCloudStaging(c, 0, "/我的资源/1.mp4", fe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if staged != "/我的资源/_downloading/1.mp4" {
+		t.Fatalf("staged = %s", staged)
+	}
+	if len(c.mkdirPaths) != 1 || c.mkdirPaths[0] != "/我的资源/_downloading" {
+		t.Fatalf("mkdir = %v", c.mkdirPaths)
+	}
+	if len(c.moves) != 1 || c.moves[0] != "f1>staging" || c.familyMove {
+		t.Fatalf("moves = %v, familyMove = %t", c.moves, c.familyMove)
+	}
+
+	if err := moveCloudFile(c, 100, "f1", "p1"); err != nil {
+		t.Fatal(err)
+	}
+	if !c.familyMove || c.moves[1] != "f1>p1" {
+		t.Fatalf("family cloud should move back with AppFamilyMoveFile, moves = %v", c.moves)
+	}
+
+	if err := deleteCloudFile(c, 0, fe); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.deleted) != 1 || c.deleted[0] != "f1" {
+		t.Fatalf("deleted = %v", c.deleted)
+	}
+}
+
+func TestFindCloudStaged(t *testing.T) {
+	c := &fakeStagingClient{files: map[string]*cloudpan.AppFileEntity{
+		"/我的资源/_downloading/1.mp4": {FileId: "f1", ParentId: "staging"},
+		"/我的资源":                    {FileId: "p1", IsFolder: true},
+	}}
+	fe, originParentId, err := findCloudStaged(c, 0, "/我的资源/1.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fe.FileId != "f1" || originParentId != "p1" {
+		t.Fatalf("fe = %s, originParentId = %s", fe.FileId, originParentId)
+	}
+	if _, _, err := findCloudStaged(c, 0, "/我的资源/2.mp4"); err == nil {
+		t.Fatal("missing staged file should return error")
+	}
+}
+
+func TestDeleteCloudFileWaitTask(t *testing.T) {
+	useFastCloudDeleteCheck(t)
+	fe := &cloudpan.AppFileEntity{FileId: "f1"}
+
+	// 删除任务需要多次查询才完成
+	c := &fakeStagingClient{pending: 3}
+	if err := deleteCloudFile(c, 0, fe); err != nil {
+		t.Fatal(err)
+	}
+
+	// 一直未完成
+	c = &fakeStagingClient{pending: CloudDeleteCheckTimes}
+	if err := deleteCloudFile(c, 0, fe); err == nil {
+		t.Fatal("want error when the delete task never finishes")
+	}
+}
+
+func TestCloudStagingDirsRemoveEmpty(t *testing.T) {
+	useFastCloudDeleteCheck(t)
+	c := &fakeStagingClient{
+		files: map[string]*cloudpan.AppFileEntity{
+			"/我的资源/_downloading": {FileId: "d1", IsFolder: true},
+			"/视频/_downloading":   {FileId: "d2", IsFolder: true},
+		},
+		children: map[string]int{"d2": 1},
+	}
+	csd := &CloudStagingDirs{}
+	csd.Add(0, "/我的资源/_downloading")
+	csd.Add(0, "/视频/_downloading")
+	csd.Add(0, "/不存在/_downloading")
+	csd.RemoveEmpty(c)
+	if len(c.deleted) != 1 || c.deleted[0] != "d1" {
+		t.Fatalf("deleted = %v", c.deleted)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"path/filepath"
+	"sync"
+
+	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/phpc0de/ctpango/internal/taskframework"
+)
+
+const (
+	// DownloadQueueFilePrefix 保存未完成下载队列的文件名前缀
+	DownloadQueueFilePrefix = "cloud189_download_queue_"
+)
+
+type (
+	// DownloadQueueCounter 控制目录展开时加入下载队列的文件数量, 多个任务共用
+	DownloadQueueCounter struct {
+		MaxQueue int // 最多加入下载队列的文件数量, 小于等于0为不限制
+		Offset   int // 跳过前 Offset 个文件
+		Limit    int // 最多下载 Limit 个文件, 小于等于0为不限制
+
+		files  int // 已遍历的文件数量
+		queued int // 已加入下载队列的文件数量
+		capped bool
+		warned bool
+		mu     sync.Mutex
+	}
+)
+
+// Next 遍历到一个文件, 返回该文件是否加入下载队列, 以及是否应该停止继续遍历
+func (dqc *DownloadQueueCounter) Next() (add, stop bool) {
+	dqc.mu.Lock()
+	defer dqc.mu.Unlock()
+
+	index := dqc.files
+	dqc.files++
+	if index < dqc.Offset {
+		return false, false
+	}
+	if dqc.Limit > 0 && index >= dqc.Offset+dqc.Limit {
+		return false, true
+	}
+	if dqc.MaxQueue > 0 && dqc.queued >= dqc.MaxQueue {
+		dqc.capped = true
+		return false, true
+	}
+	dqc.queued++
+	return true, false
+}
+
+// Capped 是否因为达到 MaxQueue 而停止加入下载队列
+func (dqc *DownloadQueueCounter) Capped() bool {
+	dqc.mu.Lock()
+	defer dqc.mu.Unlock()
+	return dqc.capped
+}
+
+// NeedWarnCapped 达到 MaxQueue 后第一次调用返回 true, 用于只输出一次警告
+func (dqc *DownloadQueueCounter) NeedWarnCapped() bool {
+	dqc.mu.Lock()
+	defer dqc.mu.Unlock()
+	if !dqc.capped || dqc.warned {
+		return false
+	}
+	dqc.warned = true
+	return true
+}
+
+// Queued 已加入下载队列的文件数量
+func (dqc *DownloadQueueCounter) Queued() int {
+	dqc.mu.Lock()
+	defer dqc.mu.Unlock()
+	return dqc.queued
+}
+
+// DownloadQueueFilePath 返回保存未完成下载队列的文件路径.
+// 每组下载参数 key 使用单独的文件, 同时运行的多个下载不会覆盖彼此的队列, 以相同的参数再次下载时才会恢复
+func DownloadQueueFilePath(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(config.GetConfigDir(), DownloadQueueFilePrefix+hex.EncodeToString(sum[:8])+".json")
+}
+
+// PersistedTask 返回恢复下载任务所需的信息, 实现 taskframework.PersistableTaskUnit
+func (dtu *DownloadTaskUnit) PersistedTask() *taskframework.PersistedTask {
+	return &taskframework.PersistedTask{
+		PanPath:      dtu.FilePanPath,
+		SavePath:     dtu.SavePath,
+		SaveRootPath: dtu.OriginSaveRootPath,
+		PanRootDir:   dtu.PanRootDir,
+		FamilyId:     dtu.FamilyId,
+	}
+}
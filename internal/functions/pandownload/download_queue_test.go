@@ -0,0 +1,65 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload_test
+
+import (
+	"github.com/phpc0de/ctpango/internal/functions/pandownload"
+	"testing"
+)
+
+// queueAdded 返回加入下载队列的文件序号, 以及停止时的文件序号
+func queueAdded(dqc *pandownload.DownloadQueueCounter, total int) (added []int, stopAt int) {
+	for i := 0; i < total; i++ {
+		add, stop := dqc.Next()
+		if stop {
+			return added, i
+		}
+		if add {
+			added = append(added, i)
+		}
+	}
+	return added, -1
+}
+
+func TestDownloadQueueCounterMaxQueue(t *testing.T) {
+	dqc := &pandownload.DownloadQueueCounter{MaxQueue: 3}
+	added, stopAt := queueAdded(dqc, 10)
+	if len(added) != 3 || stopAt != 3 || !dqc.Capped() {
+		t.Errorf("unexpected result: %v, %d", added, stopAt)
+	}
+	if !dqc.NeedWarnCapped() || dqc.NeedWarnCapped() {
+		t.Errorf("warning should be reported once")
+	}
+}
+
+func TestDownloadQueueCounterOffsetLimit(t *testing.T) {
+	dqc := &pandownload.DownloadQueueCounter{MaxQueue: 100, Offset: 2, Limit: 3}
+	added, stopAt := queueAdded(dqc, 10)
+	if len(added) != 3 || added[0] != 2 || added[2] != 4 || stopAt != 5 {
+		t.Errorf("unexpected result: %v, %d", added, stopAt)
+	}
+	if dqc.Capped() || dqc.Queued() != 3 {
+		t.Errorf("unexpected counter state: capped %v, queued %d", dqc.Capped(), dqc.Queued())
+	}
+}
+
+func TestDownloadQueueFilePath(t *testing.T) {
+	a, b := pandownload.DownloadQueueFilePath("/a"), pandownload.DownloadQueueFilePath("/b")
+	if a == b {
+		t.Errorf("different downloads share queue file: %s", a)
+	}
+	if a != pandownload.DownloadQueueFilePath("/a") {
+		t.Errorf("queue file path not stable: %s", a)
+	}
+}
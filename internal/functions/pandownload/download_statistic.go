@@ -15,10 +15,41 @@ package pandownload
 
 import (
 	"github.com/phpc0de/ctpango/internal/functions"
+	"sync/atomic"
 )
 
 type (
 	DownloadStatistic struct {
 		functions.Statistic
+		LimitTotalSize int64 // 下载数据总量上限, 达到后不再开始新的下载任务, 小于等于0为不限制
+
+		limitWarned int32
+		totalFiles  int64 // 预先计算的要下载的文件总数, 0代表未知
+		doneFiles   int64 // 已结束(成功, 跳过或失败)的文件数量
 	}
 )
+
+// LimitReached 已下载的数据总量是否达到 LimitTotalSize
+func (ds *DownloadStatistic) LimitReached() bool {
+	return ds.LimitTotalSize > 0 && ds.TotalSize() >= ds.LimitTotalSize
+}
+
+// SetTotalFiles 设置预先计算的要下载的文件总数
+func (ds *DownloadStatistic) SetTotalFiles(n int64) {
+	atomic.StoreInt64(&ds.totalFiles, n)
+}
+
+// TotalFiles 返回要下载的文件总数, 0代表未知
+func (ds *DownloadStatistic) TotalFiles() int64 {
+	return atomic.LoadInt64(&ds.totalFiles)
+}
+
+// AddDoneFile 增加一个已结束的文件, 返回已结束的文件数量
+func (ds *DownloadStatistic) AddDoneFile() int64 {
+	return atomic.AddInt64(&ds.doneFiles, 1)
+}
+
+// NeedWarnLimitReached 达到 LimitTotalSize 后第一次调用返回 true, 用于只输出一次提示
+func (ds *DownloadStatistic) NeedWarnLimitReached() bool {
+	return ds.LimitReached() && atomic.CompareAndSwapInt32(&ds.limitWarned, 0, 1)
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload_test
+
+import (
+	"github.com/phpc0de/ctpango/internal/functions/pandownload"
+	"testing"
+)
+
+func TestDownloadStatisticLimitTotalSize(t *testing.T) {
+	ds := &pandownload.DownloadStatistic{LimitTotalSize: 100}
+	ds.AddTotalSize(60)
+	if ds.LimitReached() || ds.NeedWarnLimitReached() {
+		t.Fatal("limit should not be reached")
+	}
+	ds.AddTotalSize(40)
+	if !ds.LimitReached() {
+		t.Fatal("limit should be reached")
+	}
+	if !ds.NeedWarnLimitReached() {
+		t.Fatal("first call should warn")
+	}
+	if ds.NeedWarnLimitReached() {
+		t.Fatal("should only warn once")
+	}
+}
+
+func TestDownloadStatisticNoLimit(t *testing.T) {
+	ds := &pandownload.DownloadStatistic{}
+	ds.AddTotalSize(1 << 40)
+	if ds.LimitReached() {
+		t.Fatal("limit should not be reached when LimitTotalSize is 0")
+	}
+}
+
+func TestDownloadStatisticTotalFiles(t *testing.T) {
+	ds := &pandownload.DownloadStatistic{}
+	if ds.TotalFiles() != 0 {
+		t.Fatal("total files should be unknown")
+	}
+	ds.SetTotalFiles(3)
+	for i := int64(1); i <= 3; i++ {
+		if done := ds.AddDoneFile(); done != i {
+			t.Errorf("done: got %d, want %d", done, i)
+		}
+	}
+	if ds.TotalFiles() != 3 {
+		t.Errorf("total: %d", ds.TotalFiles())
+	}
+}
@@ -14,14 +14,19 @@
 package pandownload
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/phpc0de/ctapi/cloudpan"
 	"github.com/phpc0de/ctapi/cloudpan/apierror"
-	"github.com/phpc0de/ctpango/cmder/cmdtable"
+	"github.com/phpc0de/ctpango/internal/apistat"
+	"github.com/phpc0de/ctpango/internal/config"
 	"github.com/phpc0de/ctpango/internal/file/downloader"
 	"github.com/phpc0de/ctpango/internal/functions"
+	"github.com/phpc0de/ctpango/internal/history"
 	"github.com/phpc0de/ctpango/internal/taskframework"
+	"github.com/phpc0de/ctpango/internal/utils"
+	"github.com/phpc0de/ctpango/library/crypto"
 	"github.com/phpc0de/ctlibgo/converter"
 	"github.com/phpc0de/ctlibgo/logger"
 	"github.com/phpc0de/ctlibgo/requester"
@@ -29,8 +34,8 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -41,31 +46,57 @@ type (
 		taskInfo *taskframework.TaskInfo // 任务信息
 
 		Cfg                *downloader.Config
-		PanClient          *cloudpan.PanClient
+		PanClient          *apistat.PanClient
 		ParentTaskExecutor *taskframework.TaskExecutor
 
-		DownloadStatistic *DownloadStatistic // 下载统计
+		DownloadStatistic *DownloadStatistic    // 下载统计
+		QueueCounter      *DownloadQueueCounter // 控制目录展开时加入下载队列的文件数量
 
 		// 可选项
-		VerbosePrinter       *logger.CmdVerbose
-		PrintFormat          string
-		IsPrintStatus        bool // 是否输出各个下载线程的详细信息
-		IsExecutedPermission bool // 下载成功后是否加上执行权限
-		IsOverwrite          bool // 是否覆盖已存在的文件
-		NoCheck              bool // 不校验文件
-
-		FilePanPath string // 要下载的网盘文件路径
-		SavePath    string // 文件保存在本地的路径
-		OriginSaveRootPath    string // 文件保存在本地的根目录路径
-		FamilyId    int64 // 家庭云ID, 个人云默认为0
-
-		fileInfo *cloudpan.AppFileEntity // 文件或目录详情
+		VerbosePrinter          *logger.CmdVerbose
+		PrintFormat             string
+		IsPrintStatus           bool               // 是否输出各个下载线程的详细信息
+		IsListWorkers           bool               // 是否每个下载线程输出一行简要状态, 优先于 IsPrintStatus
+		MaxNameLength           int                // 下载进度中文件名的最大长度, 超过时截断, 小于等于0为不截断
+		IsPrintSpeedReport      bool               // 下载完成后是否输出各个下载线程的速度统计
+		IsPrintCompletionTime   bool               // 下载成功后是否输出完成时间
+		IsExecutedPermission    bool               // 下载成功后是否加上执行权限
+		IsOverwrite             bool               // 是否覆盖已存在的文件
+		NoCheck                 bool               // 不校验文件
+		DecryptKey              []byte             // 不为空时, 下载完成后使用 AES-256-GCM 解密 .enc 后缀的文件
+		BandwidthHistory        *BandwidthHistory  // 不为空时, 每秒记录一次下载速度到CSV文件
+		Webhook                 *functions.Webhook // 不为空时, 文件下载成功或失败后调用 webhook
+		TaskTimeout             time.Duration      // 单个文件每次下载的超时时间, 超时后停止下载并重试, 0为不限制
+		Ctx                     context.Context    // 不为空时, 取消后停止下载并保留断点信息
+		SkipFirstBytes          int64              // 大于0时忽略断点续传文件, 认为本地文件的前 SkipFirstBytes 字节已下载, 只在第一次下载时生效
+		MaxChecksumRetry        int                // 文件校验失败时最大重试次数, 单独计数, 不占用下载失败的重试次数
+		CloudMoveBeforeDownload bool               // 下载前移动网盘文件到暂存目录, 下载并校验成功后删除, 失败后移回原目录
+		CloudStagingDirs        *CloudStagingDirs  // 记录使用过的暂存目录, 全部下载结束后删除空的暂存目录
+		FilterExtensions        []string           // 不为空时, 展开目录时只下载这些扩展名的文件, 不含 . 且为小写
+		ExcludeExtensions       []string           // 展开目录时不下载这些扩展名的文件, 不含 . 且为小写
+		PipeCommand             string             // 不为空时, 下载并校验成功后把文件内容写入该 shell 命令的标准输入, 然后删除本地文件
+		PipeStdout              io.Writer          // PipeCommand 的标准输出, 为空时使用 os.Stdout
+
+		FilePanPath        string // 要下载的网盘文件路径
+		SavePath           string // 文件保存在本地的路径
+		OriginSaveRootPath string // 文件保存在本地的根目录路径
+		PanRootDir         string // 目录内的文件保存时去掉的网盘路径前缀, 为空时保存完整的网盘路径
+		FamilyId           int64  // 家庭云ID, 个人云默认为0
+
+		fileInfo         *cloudpan.AppFileEntity // 文件或目录详情
+		startedAt        time.Time               // 第一次开始下载的时间
+		completedAt      time.Time               // 下载完成的时间
+		finished         bool                    // 下载已结束(成功或失败), 在 OnComplete 中记录历史
+		checksumRetry    int                     // 文件校验失败已重试的次数
+		stagedPanPath    string                  // 网盘文件移动到暂存目录后的路径, 为空表示没有移动
+		originParentId   string                  // 网盘文件原来所在目录的ID, 下载失败后移回该目录
+		checksumVerified bool                    // 已使用服务器记录的摘要值校验过下载的文件
 	}
 )
 
 const (
 	// DefaultPrintFormat 默认的下载进度输出格式
-	DefaultPrintFormat = "\r[%s] ↓ %s/%s %s/s in %s, left %s ............"
+	DefaultPrintFormat = downloader.DefaultProgressFormat
 	//DownloadSuffix 文件下载后缀
 	DownloadSuffix = ".cloudpan189-downloading"
 	//StrDownloadInitError 初始化下载发生错误
@@ -78,12 +109,19 @@ const (
 	StrDownloadChecksumFailed = "检测文件有效性失败"
 	// DefaultDownloadMaxRetry 默认下载失败最大重试次数
 	DefaultDownloadMaxRetry = 3
+	// DefaultChecksumMaxRetry 默认文件校验失败最大重试次数
+	DefaultChecksumMaxRetry = 1
 )
 
 func (dtu *DownloadTaskUnit) SetTaskInfo(info *taskframework.TaskInfo) {
 	dtu.taskInfo = info
 }
 
+// SetFileInfo 设置要下载的文件详情, 设置后第一次下载时不再获取文件详情
+func (dtu *DownloadTaskUnit) SetFileInfo(fileInfo *cloudpan.AppFileEntity) {
+	dtu.fileInfo = fileInfo
+}
+
 func (dtu *DownloadTaskUnit) verboseInfof(format string, a ...interface{}) {
 	if dtu.VerbosePrinter != nil {
 		dtu.VerbosePrinter.Infof(format, a...)
@@ -114,6 +152,17 @@ func (dtu *DownloadTaskUnit) download() (err error) {
 		return fmt.Errorf("%s, path %s: not a directory", StrDownloadInitError, dir)
 	}
 
+	// 获取下载锁, 防止多个进程同时下载同一个文件
+	lockPath := dtu.SavePath + downloader.LockFileSuffix
+	fileLock, err := downloader.LockFile(lockPath, downloader.DefaultLockTimeout)
+	if err != nil {
+		if err == downloader.ErrFileLocked {
+			return fmt.Errorf("%w, 锁文件: %s", ErrDownloadFileLocked, lockPath)
+		}
+		return fmt.Errorf("%s, %s", StrDownloadInitError, err)
+	}
+	defer fileLock.Unlock()
+
 	// 打开文件
 	writer, file, err = downloader.NewDownloaderWriterByFilename(dtu.SavePath, os.O_CREATE|os.O_WRONLY, 0666)
 	if err != nil {
@@ -121,6 +170,21 @@ func (dtu *DownloadTaskUnit) download() (err error) {
 	}
 	defer file.Close()
 
+	if dtu.SkipFirstBytes > 0 {
+		info, err := file.Stat()
+		if err != nil {
+			return fmt.Errorf("%s, %s", StrDownloadInitError, err)
+		}
+		if info.Size() < dtu.SkipFirstBytes {
+			return ErrSkipFirstBytesOutOfRange
+		}
+		// 只在第一次下载时生效, 重试时使用新的断点续传文件
+		dtu.Cfg.SkipFirstBytes = dtu.SkipFirstBytes
+		dtu.SkipFirstBytes = 0
+		defer func() { dtu.Cfg.SkipFirstBytes = 0 }()
+		fmt.Printf("[%s] 跳过前 %d 字节, 从该位置开始下载\n", dtu.taskInfo.Id(), dtu.Cfg.SkipFirstBytes)
+	}
+
 	der := downloader.NewDownloader(writer, dtu.Cfg, dtu.PanClient)
 	der.SetFileInfo(dtu.fileInfo)
 	der.SetFamilyId(dtu.FamilyId)
@@ -136,42 +200,41 @@ func (dtu *DownloadTaskUnit) download() (err error) {
 
 	// 这里用共享变量的方式
 	isComplete := false
+	var (
+		speedReport         *WorkerSpeedReport
+		lastWorkersCallback func(downloader.RangeWorkerFunc)
+	)
+	if dtu.IsPrintSpeedReport {
+		speedReport = NewWorkerSpeedReport()
+	}
+	progressRenderer := downloader.NewProgressRenderer(dtu.Cfg.ProgressStyle, dtu.PrintFormat)
+	statusRenderer := NewWorkerStatusRenderer(dtu.IsPrintStatus, dtu.IsListWorkers)
+	progressName := utils.TruncateName(path.Base(dtu.FilePanPath), dtu.MaxNameLength)
 	der.OnDownloadStatusEvent(func(status transfer.DownloadStatuser, workersCallback func(downloader.RangeWorkerFunc)) {
+		if speedReport != nil && !isComplete {
+			// 记录各个线程的下载位置, 用于完成后输出速度统计
+			speedReport.RecordWorkers(workersCallback)
+			lastWorkersCallback = workersCallback
+		}
+		if dtu.BandwidthHistory != nil && !isComplete {
+			if err := dtu.BandwidthHistory.RecordWorkers(dtu.taskInfo.Id(), status, workersCallback); err != nil {
+				dtu.verboseInfof("[%s] write bandwidth history error: %s\n", dtu.taskInfo.Id(), err)
+			}
+		}
+
 		// 这里可能会下载结束了, 还会输出内容
 		builder := &strings.Builder{}
-		if dtu.IsPrintStatus {
+		if statusRenderer != nil {
 			// 输出所有的worker状态
-			var (
-				tb      = cmdtable.NewTable(builder)
-			)
-			tb.SetHeader([]string{"#", "status", "range", "left", "speeds", "error"})
-			workersCallback(func(key int, worker *downloader.Worker) bool {
-				wrange := worker.GetRange()
-				tb.Append([]string{fmt.Sprint(worker.ID()), worker.GetStatus().StatusText(), wrange.ShowDetails(), strconv.FormatInt(wrange.Len(), 10), strconv.FormatInt(worker.GetSpeedsPerSecond(), 10), fmt.Sprint(worker.Err())})
-				return true
-			})
-
-			// 先空两行
-			builder.WriteString("\n\n")
-			tb.Render()
-		}
-
-		// 如果下载速度为0, 剩余下载时间未知, 则用 - 代替
-		var leftStr string
-		left := status.TimeLeft()
-		if left < 0 {
-			leftStr = "-"
-		} else {
-			leftStr = left.String()
+			if dtu.IsListWorkers && dtu.Cfg.ShowProgress {
+				// 结束上一次输出的进度行
+				builder.WriteString("\n")
+			}
+			statusRenderer.Render(builder, workersCallback)
 		}
 
 		if dtu.Cfg.ShowProgress {
-			fmt.Fprintf(builder, dtu.PrintFormat, dtu.taskInfo.Id(),
-				converter.ConvertFileSize(status.Downloaded(), 2),
-				converter.ConvertFileSize(status.TotalSize(), 2),
-				converter.ConvertFileSize(status.SpeedsPerSecond(), 2),
-				status.TimeElapsed()/1e7*1e7, leftStr,
-			)
+			progressRenderer.Render(builder, downloader.NewProgressInfo(dtu.taskInfo.Id(), progressName, status))
 		}
 
 		if !isComplete {
@@ -181,10 +244,34 @@ func (dtu *DownloadTaskUnit) download() (err error) {
 	})
 
 	der.OnExecute(func() {
+		if dtu.Cfg.MeasuredBandwidth > 0 {
+			fmt.Printf("[%s] 测量的可用带宽: %s/s, 下载线程数: %d\n", dtu.taskInfo.Id(), converter.ConvertFileSize(dtu.Cfg.MeasuredBandwidth, 2), dtu.Cfg.MaxParallel)
+		}
 		fmt.Printf("[%s] 下载开始\n\n", dtu.taskInfo.Id())
 	})
 
+	ctx := dtu.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if dtu.TaskTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dtu.TaskTimeout)
+		defer cancel()
+	}
+	der.SetContext(ctx)
+
 	err = der.Execute()
+	switch err {
+	case context.DeadlineExceeded:
+		err = ErrTaskTimeout
+	case downloader.ErrSkipFirstBytesOutOfRange:
+		err = ErrSkipFirstBytesOutOfRange
+	}
+	if speedReport != nil {
+		// 最后记录一次, 统计到各个线程的结束位置
+		speedReport.RecordWorkers(lastWorkersCallback)
+	}
 	isComplete = true
 	fmt.Print("\n")
 
@@ -219,6 +306,11 @@ func (dtu *DownloadTaskUnit) download() (err error) {
 	}
 	fmt.Printf("[%s] 下载完成, 保存位置: %s\n", dtu.taskInfo.Id(), dtu.SavePath)
 
+	if speedReport != nil && speedReport.Len() > 0 {
+		fmt.Printf("[%s] 各线程下载速度统计:\n", dtu.taskInfo.Id())
+		speedReport.Render(os.Stdout)
+	}
+
 	return nil
 }
 
@@ -233,10 +325,35 @@ func (dtu *DownloadTaskUnit) panHTTPClient() (client *requester.HTTPClient) {
 	}
 	client.SetTimeout(20 * time.Minute)
 	client.SetKeepAlive(true)
+	config.Config.SetupHTTPClientTLS(client)
 	return client
 }
 
 func (dtu *DownloadTaskUnit) handleError(result *taskframework.TaskUnitRunResult) {
+	if result.Err == ErrTaskTimeout {
+		// 超时的任务保留了断点信息, 重试时继续下载
+		result.NeedRetry = true
+		return
+	}
+	if result.Err == ErrSkipFirstBytesOutOfRange {
+		result.NeedRetry = false
+		return
+	}
+	if result.Err == context.Canceled {
+		// 下载被取消, 断点信息已保存
+		result.NeedRetry = false
+		return
+	}
+	if errors.Is(result.Err, ErrDownloadFileLocked) {
+		// 其他进程正在下载, 重试也无法获取锁
+		result.NeedRetry = false
+		return
+	}
+	if result.Err == downloader.ErrAuthExpired {
+		// 下载链接鉴权失败, 重试时重新获取文件信息和下载链接
+		result.NeedRetry = true
+		return
+	}
 	switch value := result.Err.(type) {
 	case *apierror.ApiError:
 		switch value.ErrCode() {
@@ -268,7 +385,7 @@ func (dtu *DownloadTaskUnit) checkFileValid(result *taskframework.TaskUnitRunRes
 	}
 
 	// 就在这里处理校验出错
-	err := CheckFileValid(dtu.SavePath, dtu.fileInfo)
+	err := CheckFileValid(dtu.SavePath, dtu.fileInfo, dtu.Cfg.ChecksumAlgorithm)
 	if err != nil {
 		result.ResultMessage = StrDownloadChecksumFailed
 		result.Err = err
@@ -285,9 +402,7 @@ func (dtu *DownloadTaskUnit) checkFileValid(result *taskframework.TaskUnitRunRes
 			return
 		case ErrDownloadChecksumFailed:
 			// 校验失败, 需要重新下载
-			result.NeedRetry = true
-			// 设置允许覆盖
-			dtu.IsOverwrite = true
+			dtu.handleChecksumMismatch(result)
 			return
 		default:
 			result.NeedRetry = false
@@ -295,12 +410,79 @@ func (dtu *DownloadTaskUnit) checkFileValid(result *taskframework.TaskUnitRunRes
 		}
 	}
 
+	dtu.checksumVerified = true
 	fmt.Printf("[%s] 检验文件有效性成功: %s\n", dtu.taskInfo.Id(), dtu.SavePath)
 	return true
 }
 
+// handleChecksumMismatch 文件校验失败时重新下载, 使用 MaxChecksumRetry 单独计数,
+// 重试次数用完后不再重试, 多次校验失败通常是服务器上的文件已损坏, 而不是网络问题
+func (dtu *DownloadTaskUnit) handleChecksumMismatch(result *taskframework.TaskUnitRunResult) {
+	if dtu.checksumRetry >= dtu.MaxChecksumRetry {
+		result.NeedRetry = false
+		return
+	}
+	dtu.checksumRetry++
+	result.NeedRetry = true
+	result.NoRetryCount = true
+	// 设置允许覆盖
+	dtu.IsOverwrite = true
+}
+
+// isDecrypt 是否需要解密下载的文件, 只解密 .enc 后缀的文件
+func (dtu *DownloadTaskUnit) isDecrypt() bool {
+	return len(dtu.DecryptKey) > 0 && strings.HasSuffix(dtu.SavePath, crypto.GCMEncryptedSuffix)
+}
+
+// decryptFile 解密下载完成的文件, 解密后的文件去掉 .enc 后缀, 并删除加密的文件
+func (dtu *DownloadTaskUnit) decryptFile(result *taskframework.TaskUnitRunResult) (ok bool) {
+	plainPath := strings.TrimSuffix(dtu.SavePath, crypto.GCMEncryptedSuffix)
+	err := crypto.DecryptFileGCM(dtu.DecryptKey, dtu.SavePath, plainPath)
+	if err != nil {
+		// 密钥错误或文件损坏, 重试也无法解密, 保留加密的文件
+		result.ResultMessage = "解密文件失败"
+		result.Err = err
+		result.NeedRetry = false
+		return false
+	}
+	if dtu.IsExecutedPermission {
+		os.Chmod(plainPath, 0766)
+	}
+	os.Remove(dtu.SavePath)
+	fmt.Printf("[%s] 解密完成, 保存位置: %s\n", dtu.taskInfo.Id(), plainPath)
+	return true
+}
+
+// pipeFile 把下载完成的文件写入 PipeCommand 的标准输入, 执行后删除本地文件
+func (dtu *DownloadTaskUnit) pipeFile(result *taskframework.TaskUnitRunResult) (ok bool) {
+	localPath := dtu.SavePath
+	if dtu.isDecrypt() {
+		localPath = strings.TrimSuffix(dtu.SavePath, crypto.GCMEncryptedSuffix)
+	}
+	defer os.Remove(localPath)
+
+	stdout := dtu.PipeStdout
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	err := PipeFile(dtu.PipeCommand, localPath, filepath.Base(localPath), dtu.FilePanPath, stdout, os.Stderr)
+	if err != nil {
+		// 命令执行失败, 重新下载也无法解决
+		result.ResultMessage = "管道命令执行失败"
+		result.Err = err
+		result.NeedRetry = false
+		return false
+	}
+	fmt.Printf("[%s] 已写入管道命令: %s\n", dtu.taskInfo.Id(), dtu.FilePanPath)
+	return true
+}
+
 func (dtu *DownloadTaskUnit) OnRetry(lastRunResult *taskframework.TaskUnitRunResult) {
 	// 输出错误信息
+	if lastRunResult.NoRetryCount {
+		fmt.Printf("[%s] %s, %s, 校验失败重试 %d/%d\n", dtu.taskInfo.Id(), lastRunResult.ResultMessage, lastRunResult.Err, dtu.checksumRetry, dtu.MaxChecksumRetry)
+		return
+	}
 	if lastRunResult.Err == nil {
 		// result中不包含Err, 忽略输出
 		fmt.Printf("[%s] %s, 重试 %d/%d\n", dtu.taskInfo.Id(), lastRunResult.ResultMessage, dtu.taskInfo.Retry(), dtu.taskInfo.MaxRetry())
@@ -310,9 +492,52 @@ func (dtu *DownloadTaskUnit) OnRetry(lastRunResult *taskframework.TaskUnitRunRes
 }
 
 func (dtu *DownloadTaskUnit) OnSuccess(lastRunResult *taskframework.TaskUnitRunResult) {
+	if dtu.fileInfo != nil && !dtu.fileInfo.IsFolder {
+		dtu.printTotalProgress()
+	}
+	if dtu.IsPrintCompletionTime && !dtu.completedAt.IsZero() {
+		fmt.Printf("[%s] 完成时间: %s  %s\n", dtu.taskInfo.Id(), dtu.completedAt.Format("2006-01-02 15:04:05"), dtu.FilePanPath)
+	}
+	// 跳过的文件和目录不调用 webhook
+	if !dtu.completedAt.IsZero() {
+		dtu.finished = true
+		dtu.notifyWebhook(nil)
+	}
+	if dtu.stagedPanPath != "" && dtu.completedAt.IsZero() {
+		// 跳过下载, 不删除网盘文件
+		dtu.restoreCloudStaged()
+	} else if dtu.stagedPanPath != "" && !dtu.checksumVerified {
+		// 没有校验过的文件不能确认已完整下载, 不删除网盘文件
+		fmt.Printf("[%s] 文件未经过校验, 不删除网盘文件\n", dtu.taskInfo.Id())
+		dtu.restoreCloudStaged()
+	} else if dtu.stagedPanPath != "" {
+		if err := deleteCloudFile(dtu.PanClient, dtu.FamilyId, dtu.fileInfo); err != nil {
+			// 保留 stagedPanPath, 文件仍在暂存目录中
+			fmt.Printf("[%s] 删除网盘暂存文件失败, 文件仍在暂存目录: %s, %s\n", dtu.taskInfo.Id(), dtu.stagedPanPath, err)
+			return
+		}
+		fmt.Printf("[%s] 已删除网盘暂存文件: %s\n", dtu.taskInfo.Id(), dtu.stagedPanPath)
+		if dtu.CloudStagingDirs != nil {
+			dtu.CloudStagingDirs.Add(dtu.FamilyId, path.Dir(dtu.stagedPanPath))
+		}
+		dtu.stagedPanPath = ""
+	}
 }
 
 func (dtu *DownloadTaskUnit) OnFailed(lastRunResult *taskframework.TaskUnitRunResult) {
+	if dtu.fileInfo == nil || !dtu.fileInfo.IsFolder {
+		dtu.printTotalProgress()
+		err := lastRunResult.Err
+		if err == nil {
+			err = errors.New(lastRunResult.ResultMessage)
+		}
+		dtu.finished = true
+		dtu.notifyWebhook(err)
+	}
+	if dtu.stagedPanPath != "" {
+		dtu.restoreCloudStaged()
+	}
+
 	// 失败
 	if lastRunResult.Err == nil {
 		// result中不包含Err, 忽略输出
@@ -322,7 +547,32 @@ func (dtu *DownloadTaskUnit) OnFailed(lastRunResult *taskframework.TaskUnitRunRe
 	fmt.Printf("[%s] %s, %s\n", dtu.taskInfo.Id(), lastRunResult.ResultMessage, lastRunResult.Err)
 }
 
+// restoreCloudStaged 把暂存目录中的网盘文件移回原目录
+func (dtu *DownloadTaskUnit) restoreCloudStaged() {
+	if err := moveCloudFile(dtu.PanClient, dtu.FamilyId, dtu.fileInfo.FileId, dtu.originParentId); err != nil {
+		fmt.Printf("[%s] 移回网盘文件失败, 文件仍在暂存目录: %s, %s\n", dtu.taskInfo.Id(), dtu.stagedPanPath, err)
+		return
+	}
+	fmt.Printf("[%s] 已移回网盘文件: %s\n", dtu.taskInfo.Id(), dtu.FilePanPath)
+	dtu.stagedPanPath = ""
+}
+
+// OnComplete 下载成功或最终失败时记录历史, 重试时不记录
 func (dtu *DownloadTaskUnit) OnComplete(lastRunResult *taskframework.TaskUnitRunResult) {
+	if !dtu.finished {
+		return
+	}
+	dtu.finished = false
+
+	var err error
+	if !lastRunResult.Succeed {
+		err = lastRunResult.Err
+		if err == nil {
+			err = errors.New(lastRunResult.ResultMessage)
+		}
+	}
+	size, elapsed := dtu.sizeAndElapsed()
+	history.Append(history.NewRecord(history.OperationDownload, dtu.FilePanPath, dtu.SavePath, size, elapsed, err))
 }
 
 func (dtu *DownloadTaskUnit) RetryWait() time.Duration {
@@ -331,13 +581,33 @@ func (dtu *DownloadTaskUnit) RetryWait() time.Duration {
 
 func (dtu *DownloadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
 	result = &taskframework.TaskUnitRunResult{}
+	// 校验算法错误时直接失败, 而不是下载完成后跳过校验
+	if !dtu.NoCheck && !IsHashAlgorithmSupported(dtu.Cfg.ChecksumAlgorithm) {
+		result.ResultMessage = StrDownloadInitError
+		result.Err = unknownChecksumAlgorithmError(dtu.Cfg.ChecksumAlgorithm)
+		result.NeedRetry = false
+		return
+	}
 	// 获取文件信息
 	var apierr *apierror.ApiError
 	if dtu.fileInfo == nil || dtu.taskInfo.Retry() > 0 {
 		// 没有获取文件信息
 		// 如果是动态添加的下载任务, 是会写入文件信息的
 		// 如果该任务重试过, 则应该再获取一次文件信息
-		dtu.fileInfo, apierr = dtu.PanClient.AppFileInfoByPath(dtu.FamilyId, dtu.FilePanPath)
+		panPath := dtu.FilePanPath
+		if dtu.stagedPanPath != "" {
+			panPath = dtu.stagedPanPath
+		}
+		dtu.fileInfo, apierr = dtu.PanClient.AppFileInfoByPath(dtu.FamilyId, panPath)
+		if apierr != nil && apierr.ErrCode() == apierror.ApiCodeFileNotFoundCode && dtu.CloudMoveBeforeDownload && dtu.stagedPanPath == "" {
+			// 上次下载中断时文件可能还在暂存目录中
+			fe, originParentId, err := findCloudStaged(dtu.PanClient, dtu.FamilyId, dtu.FilePanPath)
+			if err == nil {
+				dtu.fileInfo, apierr = fe, nil
+				dtu.stagedPanPath = CloudStagingPath(dtu.FilePanPath)
+				dtu.originParentId = originParentId
+			}
+		}
 		if apierr != nil {
 			// 如果不是未登录或文件不存在, 则不重试
 			result.ResultMessage = "获取下载路径信息错误"
@@ -367,38 +637,52 @@ func (dtu *DownloadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
 			return
 		}
 
-		for k := range fileList {
-			if fileList[k].IsFolder {
-				continue
-			}
-			// 添加子任务
-			subUnit := *dtu
-			newCfg := *dtu.Cfg
-			subUnit.Cfg = &newCfg
-			subUnit.fileInfo = fileList[k] // 保存文件信息
-			subUnit.FilePanPath = fileList[k].Path
-			subUnit.SavePath = filepath.Join(dtu.OriginSaveRootPath, fileList[k].Path) // 保存位置
-
-			// 加入父队列
-			info := dtu.ParentTaskExecutor.Append(&subUnit, dtu.taskInfo.MaxRetry())
-			fmt.Printf("[%s] 加入下载队列: %s\n", info.Id(), fileList[k].Path)
-		}
+		dtu.enqueueSubFiles(fileList)
 
 		result.Succeed = true // 执行成功
 		return
 	}
 
+	// 达到下载数据总量上限, 不再开始新的下载, 正在下载的文件不受影响
+	if dtu.DownloadStatistic.LimitReached() {
+		dtu.warnLimitReached()
+		result.Succeed = true
+		return
+	}
+
 	fmt.Printf("[%s] 准备下载: %s\n", dtu.taskInfo.Id(), dtu.FilePanPath)
 
-	if !dtu.IsOverwrite && FileExist(dtu.SavePath) {
+	if !dtu.IsOverwrite && dtu.SkipFirstBytes == 0 && FileExist(dtu.SavePath) {
 		fmt.Printf("[%s] 文件已经存在: %s, 跳过...\n", dtu.taskInfo.Id(), dtu.SavePath)
 		result.Succeed = true // 执行成功
 		return
 	}
+	if !dtu.IsOverwrite && dtu.isDecrypt() && FileExist(strings.TrimSuffix(dtu.SavePath, crypto.GCMEncryptedSuffix)) {
+		fmt.Printf("[%s] 解密后的文件已经存在: %s, 跳过...\n", dtu.taskInfo.Id(), strings.TrimSuffix(dtu.SavePath, crypto.GCMEncryptedSuffix))
+		result.Succeed = true // 执行成功
+		return
+	}
 
 	fmt.Printf("[%s] 将会下载到路径: %s\n\n", dtu.taskInfo.Id(), dtu.SavePath)
 
+	if dtu.CloudMoveBeforeDownload && dtu.stagedPanPath == "" && !isInCloudStagingDir(dtu.FilePanPath) {
+		originParentId := dtu.fileInfo.ParentId
+		stagedPanPath, err := moveToCloudStaging(dtu.PanClient, dtu.FamilyId, dtu.FilePanPath, dtu.fileInfo)
+		if err != nil {
+			result.ResultMessage = "移动网盘文件到暂存目录失败"
+			result.Err = err
+			result.NeedRetry = true
+			return
+		}
+		dtu.stagedPanPath = stagedPanPath
+		dtu.originParentId = originParentId
+		fmt.Printf("[%s] 已移动网盘文件到暂存目录: %s\n", dtu.taskInfo.Id(), stagedPanPath)
+	}
+
 	var ok bool
+	if dtu.startedAt.IsZero() {
+		dtu.startedAt = time.Now()
+	}
 	er := dtu.download()
 
 	if er != nil {
@@ -416,9 +700,103 @@ func (dtu *DownloadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
 		return result
 	}
 
+	// 解密文件
+	if dtu.isDecrypt() && !dtu.decryptFile(result) {
+		return result
+	}
+
+	// 写入管道命令
+	if dtu.PipeCommand != "" && !dtu.pipeFile(result) {
+		return result
+	}
+
 	// 统计下载
 	dtu.DownloadStatistic.AddTotalSize(dtu.fileInfo.FileSize)
 	// 下载成功
+	dtu.completedAt = time.Now()
 	result.Succeed = true
 	return
 }
+
+// enqueueSubFiles 将目录下的文件加入父队列, 跳过不符合扩展名过滤条件的文件
+func (dtu *DownloadTaskUnit) enqueueSubFiles(fileList cloudpan.AppFileList) {
+	for k := range fileList {
+		if fileList[k].IsFolder {
+			continue
+		}
+		if !MatchExtensions(fileList[k].FileName, dtu.FilterExtensions, dtu.ExcludeExtensions) {
+			continue
+		}
+		if dtu.DownloadStatistic.LimitReached() {
+			dtu.warnLimitReached()
+			break
+		}
+		if dtu.QueueCounter != nil {
+			add, stop := dtu.QueueCounter.Next()
+			if stop {
+				if dtu.QueueCounter.NeedWarnCapped() {
+					fmt.Printf("[%s] 警告: 加入下载队列的文件数量已达到上限 %d, 不再添加新的下载任务, 请使用 --offset 和 --limit 分批下载\n", dtu.taskInfo.Id(), dtu.QueueCounter.MaxQueue)
+				}
+				break
+			}
+			if !add {
+				continue
+			}
+		}
+		// 添加子任务
+		subUnit := *dtu
+		newCfg := *dtu.Cfg
+		subUnit.Cfg = &newCfg
+		subUnit.SkipFirstBytes = 0
+		subUnit.fileInfo = fileList[k] // 保存文件信息
+		subUnit.FilePanPath = fileList[k].Path
+		subUnit.SavePath = SavePathOf(dtu.OriginSaveRootPath, dtu.PanRootDir, fileList[k].Path) // 保存位置
+
+		// 加入父队列
+		info := dtu.ParentTaskExecutor.Append(&subUnit, dtu.taskInfo.MaxRetry())
+		fmt.Printf("[%s] 加入下载队列: %s\n", info.Id(), fileList[k].Path)
+	}
+}
+
+// printTotalProgress 文件下载结束后, 如果预先计算了文件总数, 输出总进度
+func (dtu *DownloadTaskUnit) printTotalProgress() {
+	if dtu.DownloadStatistic == nil {
+		return
+	}
+	done, total := dtu.DownloadStatistic.AddDoneFile(), dtu.DownloadStatistic.TotalFiles()
+	if total <= 0 {
+		return
+	}
+	fmt.Printf("[%s] 总进度: %d/%d (%.2f%%)\n", dtu.taskInfo.Id(), done, total, float64(done)*100/float64(total))
+}
+
+// warnLimitReached 达到下载数据总量上限时输出一次提示
+func (dtu *DownloadTaskUnit) warnLimitReached() {
+	if dtu.DownloadStatistic.NeedWarnLimitReached() {
+		fmt.Printf("[%s] 提示: 已下载的数据总量达到上限 %s, 不再开始新的下载任务\n", dtu.taskInfo.Id(), converter.ConvertFileSize(dtu.DownloadStatistic.LimitTotalSize, 2))
+	}
+}
+
+// notifyWebhook 文件下载结束后调用 webhook, err 为 nil 代表下载成功
+func (dtu *DownloadTaskUnit) notifyWebhook(err error) {
+	if !dtu.Webhook.Enabled(err == nil) {
+		return
+	}
+	size, elapsed := dtu.sizeAndElapsed()
+	dtu.Webhook.Notify(functions.NewWebhookPayload(functions.WebhookTypeDownload, dtu.taskInfo.Id(), dtu.FilePanPath, dtu.SavePath, size, elapsed, err))
+}
+
+// sizeAndElapsed 返回文件大小和下载耗时, 未开始下载时耗时为0
+func (dtu *DownloadTaskUnit) sizeAndElapsed() (size int64, elapsed time.Duration) {
+	if dtu.fileInfo != nil {
+		size = dtu.fileInfo.FileSize
+	}
+	if !dtu.startedAt.IsZero() {
+		end := dtu.completedAt
+		if end.IsZero() {
+			end = time.Now()
+		}
+		elapsed = end.Sub(dtu.startedAt)
+	}
+	return
+}
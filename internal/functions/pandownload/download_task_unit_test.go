@@ -0,0 +1,94 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctpango/internal/file/downloader"
+	"github.com/phpc0de/ctpango/internal/taskframework"
+)
+
+func TestHandleErrorTaskTimeout(t *testing.T) {
+	dtu := &DownloadTaskUnit{}
+
+	result := &taskframework.TaskUnitRunResult{Err: ErrTaskTimeout}
+	dtu.handleError(result)
+	if !result.NeedRetry {
+		t.Fatal("task timeout should be retried")
+	}
+
+	result = &taskframework.TaskUnitRunResult{Err: &os.PathError{Op: "open", Path: "a", Err: os.ErrPermission}}
+	dtu.handleError(result)
+	if result.NeedRetry {
+		t.Fatal("path error should not be retried")
+	}
+}
+
+func TestHandleChecksumMismatch(t *testing.T) {
+	dtu := &DownloadTaskUnit{MaxChecksumRetry: 2}
+	for i := 1; i <= 2; i++ {
+		result := &taskframework.TaskUnitRunResult{Err: ErrDownloadChecksumFailed}
+		dtu.handleChecksumMismatch(result)
+		if !result.NeedRetry || !result.NoRetryCount {
+			t.Fatalf("checksum retry %d: NeedRetry = %t, NoRetryCount = %t, want both true", i, result.NeedRetry, result.NoRetryCount)
+		}
+		if !dtu.IsOverwrite {
+			t.Fatalf("checksum retry %d: IsOverwrite should be set", i)
+		}
+	}
+
+	result := &taskframework.TaskUnitRunResult{Err: ErrDownloadChecksumFailed}
+	dtu.handleChecksumMismatch(result)
+	if result.NeedRetry {
+		t.Fatal("checksum retries exhausted, should not retry")
+	}
+	if result.Err != ErrDownloadChecksumFailed {
+		t.Fatalf("Err = %v, want ErrDownloadChecksumFailed", result.Err)
+	}
+}
+
+func TestEnqueueSubFilesFilterExtensions(t *testing.T) {
+	executor := taskframework.NewTaskExecutor()
+	dtu := &DownloadTaskUnit{
+		Cfg:                &downloader.Config{},
+		ParentTaskExecutor: executor,
+		DownloadStatistic:  &DownloadStatistic{},
+		FilterExtensions:   []string{"mp4", "mkv"},
+		OriginSaveRootPath: "/save",
+	}
+	executor.Append(dtu, 0)
+
+	dtu.enqueueSubFiles(cloudpan.AppFileList{
+		{FileName: "sub", Path: "/v/sub", IsFolder: true},
+		{FileName: "a.txt", Path: "/v/a.txt"},
+		{FileName: "b.mp4", Path: "/v/b.mp4"},
+		{FileName: "c.MKV", Path: "/v/sub/c.MKV"},
+	})
+
+	var queued []string
+	for _, task := range executor.PersistedTasks() {
+		if task.PanPath != "" {
+			queued = append(queued, task.PanPath)
+		}
+	}
+	sort.Strings(queued)
+	if got := strings.Join(queued, ","); got != "/v/b.mp4,/v/sub/c.MKV" {
+		t.Errorf("queued = %s, want /v/b.mp4,/v/sub/c.MKV", got)
+	}
+}
@@ -13,17 +13,33 @@
 // limitations under the License.
 package pandownload
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	// ErrDownloadNotSupportChecksum 文件不支持校验
 	ErrDownloadNotSupportChecksum = errors.New("该文件不支持校验")
 	// ErrDownloadChecksumFailed 文件校验失败
 	ErrDownloadChecksumFailed = errors.New("该文件校验失败, 文件md5值与服务器记录的不匹配")
+	// ErrUnknownChecksumAlgorithm 不支持的校验算法
+	ErrUnknownChecksumAlgorithm = errors.New("不支持的校验算法, 天翼云盘目前只提供文件的md5值, 可选值: md5")
 	// ErrDownloadFileBanned 违规文件
 	ErrDownloadFileBanned = errors.New("该文件可能是违规文件, 不支持校验")
 	// ErrDlinkNotFound 未取得下载链接
 	ErrDlinkNotFound = errors.New("未取得下载链接")
 	// ErrShareInfoNotFound 未在已分享列表中找到分享信息
 	ErrShareInfoNotFound = errors.New("未在已分享列表中找到分享信息")
+	// ErrTaskTimeout 下载任务超时
+	ErrTaskTimeout = errors.New("下载任务超时")
+	// ErrSkipFirstBytesOutOfRange 指定已下载的字节数超出范围
+	ErrSkipFirstBytesOutOfRange = errors.New("指定已下载的字节数不小于网盘文件大小, 或大于本地文件大小")
+	// ErrDownloadFileLocked 目标文件正在被其他进程下载
+	ErrDownloadFileLocked = errors.New("目标文件正在被其他进程下载, 请等待其完成后重试")
 )
+
+// unknownChecksumAlgorithmError 返回包含算法名称的 ErrUnknownChecksumAlgorithm
+func unknownChecksumAlgorithmError(algorithm string) error {
+	return fmt.Errorf("%w: %s", ErrUnknownChecksumAlgorithm, algorithm)
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+)
+
+const (
+	// PipeEnvFileName 传给管道命令的环境变量, 值为文件名
+	PipeEnvFileName = "CLOUDPAN189_FILENAME"
+	// PipeEnvCloudPath 传给管道命令的环境变量, 值为文件的网盘路径
+	PipeEnvCloudPath = "CLOUDPAN189_CLOUD_PATH"
+)
+
+var (
+	// pipeMu 同时下载多个文件时, 管道命令依次执行, 避免输出交错
+	pipeMu sync.Mutex
+)
+
+// shellCommand 返回使用系统 shell 执行 command 的命令
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+// PipeFile 使用 shell 执行 command, 把本地文件 filePath 的内容写入命令的标准输入.
+// 命令的环境变量中包含 PipeEnvFileName 和 PipeEnvCloudPath, 标准输出和标准错误分别写入 stdout 和 stderr
+func PipeFile(command, filePath, fileName, cloudPath string, stdout, stderr io.Writer) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	cmd := shellCommand(command)
+	cmd.Stdin = file
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Env = append(os.Environ(), PipeEnvFileName+"="+fileName, PipeEnvCloudPath+"="+cloudPath)
+
+	pipeMu.Lock()
+	defer pipeMu.Unlock()
+	return cmd.Run()
+}
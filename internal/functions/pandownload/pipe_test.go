@@ -0,0 +1,53 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPipeFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh is not available on windows")
+	}
+
+	dir, err := ioutil.TempDir("", "pipe-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filePath := filepath.Join(dir, "a.txt")
+	if err = ioutil.WriteFile(filePath, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &bytes.Buffer{}
+	err = PipeFile(`printf "%s|%s|" "$`+PipeEnvFileName+`" "$`+PipeEnvCloudPath+`"; cat`, filePath, "a.txt", "/dir/a.txt", stdout, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stdout.String(), "a.txt|/dir/a.txt|hello"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+
+	if err = PipeFile("exit 3", filePath, "a.txt", "/dir/a.txt", ioutil.Discard, ioutil.Discard); err == nil {
+		t.Error("expected error for failing command")
+	}
+}
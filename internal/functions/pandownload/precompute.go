@@ -0,0 +1,118 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload
+
+import (
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctpango/internal/apistat"
+)
+
+const (
+	// DefaultPlanParallel 预先计算下载路径时默认同时列出的目录数量
+	DefaultPlanParallel = 4
+)
+
+type (
+	// PlannedDownload 预先计算好本地保存路径的下载文件
+	PlannedDownload struct {
+		FileInfo     *cloudpan.AppFileEntity
+		SavePath     string
+		SaveRootPath string // 本地保存的根目录
+		PanRootDir   string // 保存时去掉的网盘路径前缀
+	}
+
+	// FolderLister 列出网盘目录内的文件和子目录, 返回的文件需要包含完整的网盘路径
+	FolderLister func(folder *cloudpan.AppFileEntity) (cloudpan.AppFileList, error)
+)
+
+// NewFolderLister 返回使用 panClient 列出目录的 FolderLister, 文件路径由目录路径拼接, 不额外请求
+func NewFolderLister(panClient *apistat.PanClient, familyId int64) FolderLister {
+	return func(folder *cloudpan.AppFileEntity) (cloudpan.AppFileList, error) {
+		param := cloudpan.NewAppFileListParam()
+		param.FileId = folder.FileId
+		param.FamilyId = familyId
+		r, apierr := panClient.AppGetAllFileList(param)
+		if apierr != nil {
+			return nil, apierr
+		}
+		for _, fi := range r.FileList {
+			fi.Path = path.Join(folder.Path, fi.FileName)
+		}
+		return r.FileList, nil
+	}
+}
+
+// PlanDownload 展开网盘目录 root 内的所有文件, 最多 parallel 个目录同时列出.
+// 文件保存到 SavePathOf(saveRootPath, panRootDir, 文件的网盘路径), 与下载时展开目录的规则一致.
+// 返回按网盘路径排序的文件, 以及所有子目录的本地路径, 用于保存空目录.
+// 列出某个目录出错时, 继续列出其他目录, 返回第一个错误. root 不是目录时返回空
+func PlanDownload(root *cloudpan.AppFileEntity, saveRootPath, panRootDir string, list FolderLister, parallel int) (files []*PlannedDownload, dirs []string, err error) {
+	if !root.IsFolder {
+		return nil, nil, nil
+	}
+	if parallel <= 0 {
+		parallel = DefaultPlanParallel
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, parallel)
+		walk func(folder *cloudpan.AppFileEntity)
+	)
+	walk = func(folder *cloudpan.AppFileEntity) {
+		defer wg.Done()
+
+		sem <- struct{}{}
+		fileList, er := list(folder)
+		<-sem
+
+		mu.Lock()
+		defer mu.Unlock()
+		if er != nil {
+			if err == nil {
+				err = er
+			}
+			return
+		}
+		for _, fi := range fileList {
+			if fi.IsFolder {
+				dirs = append(dirs, SavePathOf(saveRootPath, panRootDir, fi.Path))
+				wg.Add(1)
+				go walk(fi)
+				continue
+			}
+			files = append(files, &PlannedDownload{
+				FileInfo:     fi,
+				SavePath:     SavePathOf(saveRootPath, panRootDir, fi.Path),
+				SaveRootPath: saveRootPath,
+				PanRootDir:   panRootDir,
+			})
+		}
+	}
+
+	wg.Add(1)
+	go walk(root)
+	wg.Wait()
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].FileInfo.Path < files[j].FileInfo.Path
+	})
+	sort.Strings(dirs)
+	return files, dirs, err
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+)
+
+// testFolderLister 按 tree 返回目录内容, tree 的键为目录路径, 值为目录内的文件名, 以 / 结尾的为目录
+func testFolderLister(tree map[string][]string, active, maxActive *int32) FolderLister {
+	return func(folder *cloudpan.AppFileEntity) (cloudpan.AppFileList, error) {
+		n := atomic.AddInt32(active, 1)
+		defer atomic.AddInt32(active, -1)
+		for {
+			m := atomic.LoadInt32(maxActive)
+			if n <= m || atomic.CompareAndSwapInt32(maxActive, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		names, ok := tree[folder.Path]
+		if !ok {
+			return nil, errors.New("list error: " + folder.Path)
+		}
+		list := cloudpan.AppFileList{}
+		for _, name := range names {
+			isFolder := strings.HasSuffix(name, "/")
+			name = strings.TrimSuffix(name, "/")
+			list = append(list, &cloudpan.AppFileEntity{
+				FileName: name,
+				Path:     path.Join(folder.Path, name),
+				IsFolder: isFolder,
+			})
+		}
+		return list, nil
+	}
+}
+
+func TestPlanDownload(t *testing.T) {
+	tree := map[string][]string{
+		"/资源":       {"b.txt", "a/", "c/", "d/", "e/"},
+		"/资源/a":     {"2.txt", "1.txt", "sub/"},
+		"/资源/a/sub": {"3.txt"},
+		"/资源/c":     {"4.txt"},
+		"/资源/d":     {},
+		"/资源/e":     {"5.txt"},
+	}
+	var active, maxActive int32
+	root := &cloudpan.AppFileEntity{FileName: "资源", Path: "/资源", IsFolder: true}
+	files, dirs, err := PlanDownload(root, "/save", "", testFolderLister(tree, &active, &maxActive), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotPaths, gotSavePaths []string
+	for _, f := range files {
+		gotPaths = append(gotPaths, f.FileInfo.Path)
+		gotSavePaths = append(gotSavePaths, f.SavePath)
+	}
+	wantPaths := []string{"/资源/a/1.txt", "/资源/a/2.txt", "/资源/a/sub/3.txt", "/资源/b.txt", "/资源/c/4.txt", "/资源/e/5.txt"}
+	if !reflect.DeepEqual(gotPaths, wantPaths) {
+		t.Errorf("paths: got %v, want %v", gotPaths, wantPaths)
+	}
+	for i, p := range wantPaths {
+		if want := filepath.Join("/save", p); gotSavePaths[i] != want {
+			t.Errorf("save path: got %s, want %s", gotSavePaths[i], want)
+		}
+	}
+
+	wantDirs := []string{
+		filepath.Join("/save", "/资源/a"),
+		filepath.Join("/save", "/资源/a/sub"),
+		filepath.Join("/save", "/资源/c"),
+		filepath.Join("/save", "/资源/d"),
+		filepath.Join("/save", "/资源/e"),
+	}
+	if !reflect.DeepEqual(dirs, wantDirs) {
+		t.Errorf("dirs: got %v, want %v", dirs, wantDirs)
+	}
+	if maxActive > 2 {
+		t.Errorf("listed %d folders at the same time, want at most 2", maxActive)
+	}
+	if maxActive < 2 {
+		t.Errorf("folders were not listed in parallel")
+	}
+}
+
+func TestPlanDownloadPanRootDir(t *testing.T) {
+	tree := map[string][]string{
+		"/资源":   {"a/"},
+		"/资源/a": {"1.txt"},
+	}
+	var active, maxActive int32
+	root := &cloudpan.AppFileEntity{FileName: "资源", Path: "/资源", IsFolder: true}
+	files, dirs, err := PlanDownload(root, "/save", "/", testFolderLister(tree, &active, &maxActive), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].SavePath != filepath.Join("/save", "资源/a/1.txt") {
+		t.Errorf("files: %+v", files)
+	}
+
+	files, dirs, err = PlanDownload(root, "/save", "/资源", testFolderLister(tree, &active, &maxActive), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].SavePath != filepath.Join("/save", "a/1.txt") {
+		t.Errorf("files: %+v", files)
+	}
+	if files[0].SaveRootPath != "/save" || files[0].PanRootDir != "/资源" {
+		t.Errorf("save root: %s, pan root: %s", files[0].SaveRootPath, files[0].PanRootDir)
+	}
+	if !reflect.DeepEqual(dirs, []string{filepath.Join("/save", "a")}) {
+		t.Errorf("dirs: %v", dirs)
+	}
+}
+
+func TestPlanDownloadError(t *testing.T) {
+	tree := map[string][]string{
+		"/资源":    {"a.txt", "bad/", "ok/"},
+		"/资源/ok": {"b.txt"},
+	}
+	var active, maxActive int32
+	root := &cloudpan.AppFileEntity{FileName: "资源", Path: "/资源", IsFolder: true}
+	files, _, err := PlanDownload(root, "/save", "", testFolderLister(tree, &active, &maxActive), 0)
+	if err == nil {
+		t.Fatal("expected list error")
+	}
+	// 出错的目录不影响其他目录
+	if len(files) != 2 || files[0].FileInfo.Path != "/资源/a.txt" || files[1].FileInfo.Path != "/资源/ok/b.txt" {
+		t.Errorf("files: %+v", files)
+	}
+
+	// 不是目录时返回空
+	files, dirs, err := PlanDownload(&cloudpan.AppFileEntity{Path: "/a.txt"}, "/save", "", nil, 0)
+	if files != nil || dirs != nil || err != nil {
+		t.Errorf("file root: %v, %v, %v", files, dirs, err)
+	}
+}
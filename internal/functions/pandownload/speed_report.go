@@ -0,0 +1,141 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload
+
+import (
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	"github.com/phpc0de/ctlibgo/converter"
+	"github.com/phpc0de/ctpango/cmder/cmdtable"
+	"github.com/phpc0de/ctpango/internal/file/downloader"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// WorkerSpeedReport 统计各个下载线程的速度
+	WorkerSpeedReport struct {
+		items map[int]*workerSpeedItem
+		mu    sync.Mutex
+	}
+
+	workerSpeedItem struct {
+		id         int
+		startTime  time.Time // 第一次统计到该线程的时间
+		lastTime   time.Time // 最后一次统计到该线程的时间
+		rangeStart int64     // 第一次统计到当前分配的范围时的下载位置
+		offset     int64     // 最后一次统计到该线程时的下载位置
+		end        int64     // 当前分配的范围的结束位置
+		downloaded int64     // 统计到的下载量, 包括之前分配的范围
+	}
+)
+
+// NewWorkerSpeedReport 初始化 WorkerSpeedReport
+func NewWorkerSpeedReport() *WorkerSpeedReport {
+	return &WorkerSpeedReport{
+		items: map[int]*workerSpeedItem{},
+	}
+}
+
+// Record 记录线程 id 当前的下载位置 offset 和范围的结束位置 end.
+// 线程下载完自己的范围后会被分配新的范围, 位置跳到新范围的开始, 跳过的部分不计入下载量
+func (wsr *WorkerSpeedReport) Record(id int, offset, end int64, now time.Time) {
+	wsr.mu.Lock()
+	defer wsr.mu.Unlock()
+
+	item, ok := wsr.items[id]
+	if !ok {
+		wsr.items[id] = &workerSpeedItem{
+			id:         id,
+			startTime:  now,
+			lastTime:   now,
+			rangeStart: offset,
+			offset:     offset,
+			end:        end,
+		}
+		return
+	}
+	if offset == item.offset {
+		// 只有位置变化时才更新时间, 避免线程结束后耗时一直增加. 范围被拆分时结束位置会变小
+		item.end = end
+		return
+	}
+	if offset < item.offset || item.offset >= item.end {
+		// 分配了新的范围
+		item.rangeStart = offset
+	} else {
+		item.downloaded += offset - item.offset
+	}
+	item.offset = offset
+	item.end = end
+	item.lastTime = now
+}
+
+// RecordWorkers 记录所有线程当前的下载位置
+func (wsr *WorkerSpeedReport) RecordWorkers(workersCallback func(downloader.RangeWorkerFunc)) {
+	if workersCallback == nil {
+		return
+	}
+	now := time.Now()
+	workersCallback(func(key int, worker *downloader.Worker) bool {
+		wrange := worker.GetRange()
+		wsr.Record(worker.ID(), wrange.LoadBegin(), wrange.LoadEnd(), now)
+		return true
+	})
+}
+
+// Len 统计到的线程数量
+func (wsr *WorkerSpeedReport) Len() int {
+	wsr.mu.Lock()
+	defer wsr.mu.Unlock()
+	return len(wsr.items)
+}
+
+// Render 输出各个线程的速度统计表
+func (wsr *WorkerSpeedReport) Render(w io.Writer) {
+	wsr.mu.Lock()
+	items := make([]*workerSpeedItem, 0, len(wsr.items))
+	for _, item := range wsr.items {
+		items = append(items, item)
+	}
+	wsr.mu.Unlock()
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].id < items[j].id
+	})
+
+	tb := cmdtable.NewTable(w)
+	tb.SetHeader([]string{"#", "range", "downloaded", "average speeds", "time"})
+	tb.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+	for _, item := range items {
+		var (
+			downloaded = item.downloaded
+			elapsed    = item.lastTime.Sub(item.startTime)
+			speedsStr  = "-"
+		)
+		if elapsed > 0 {
+			speedsStr = converter.ConvertFileSize(int64(float64(downloaded)/elapsed.Seconds()), 2) + "/s"
+		}
+		tb.Append([]string{
+			fmt.Sprint(item.id),
+			fmt.Sprintf("%d-%d", item.rangeStart, item.offset),
+			converter.ConvertFileSize(downloaded, 2),
+			speedsStr,
+			(elapsed / 1e6 * 1e6).String(),
+		})
+	}
+	tb.Render()
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload_test
+
+import (
+	"github.com/phpc0de/ctpango/internal/functions/pandownload"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkerSpeedReportSingleWorker(t *testing.T) {
+	report := pandownload.NewWorkerSpeedReport()
+	start := time.Now()
+	report.Record(0, 0, 1024*1024, start)
+	report.Record(0, 1024*1024, 1024*1024, start.Add(2*time.Second))
+	// 线程结束后位置不变, 耗时不应增加
+	report.Record(0, 1024*1024, 1024*1024, start.Add(5*time.Second))
+
+	if report.Len() != 1 {
+		t.Fatalf("worker count: %d, want 1", report.Len())
+	}
+
+	builder := &strings.Builder{}
+	report.Render(builder)
+
+	output := builder.String()
+	for _, s := range []string{"0-1048576", "1.00MB", "512.00KB/s", "2s"} {
+		if !strings.Contains(output, s) {
+			t.Fatalf("report missing %q", s)
+		}
+	}
+}
+
+func TestWorkerSpeedReportReassignedRange(t *testing.T) {
+	report := pandownload.NewWorkerSpeedReport()
+	start := time.Now()
+	report.Record(1, 0, 1000, start)
+	report.Record(1, 1000, 1000, start.Add(time.Second))
+	// 下载完后分配到其他线程拆分出的范围, 位置向后跳
+	report.Record(1, 5000, 6000, start.Add(2*time.Second))
+	report.Record(1, 5500, 6000, start.Add(3*time.Second))
+	// 再次分配到前面的范围, 位置向前跳
+	report.Record(1, 2000, 2500, start.Add(4*time.Second))
+	report.Record(1, 2500, 2500, start.Add(5*time.Second))
+
+	if report.Len() != 1 {
+		t.Fatalf("worker count: %d, want 1", report.Len())
+	}
+	builder := &strings.Builder{}
+	report.Render(builder)
+	// 1000 + 500 + 500
+	if output := builder.String(); !strings.Contains(output, "1.95KB") || !strings.Contains(output, "2000-2500") {
+		t.Fatalf("report: %s", output)
+	}
+}
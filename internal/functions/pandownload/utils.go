@@ -14,18 +14,156 @@
 package pandownload
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctlibgo/converter"
+	"hash"
+	"io"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
 )
 
-// CheckFileValid 检测文件有效性
-func CheckFileValid(filePath string, fileInfo *cloudpan.AppFileEntity) error {
-	// 检查MD5
+const (
+	// HashAlgorithmMD5 使用md5校验文件
+	HashAlgorithmMD5 = "md5"
+
+	// ChecksumBufSize 校验文件时每次读取的数据大小
+	ChecksumBufSize = int(4 * converter.MB)
+)
+
+// IsHashAlgorithmSupported 是否支持该校验算法, 天翼云盘目前只提供文件的md5值, 只支持md5
+func IsHashAlgorithmSupported(hashAlgorithm string) bool {
+	switch strings.ToLower(hashAlgorithm) {
+	case "", HashAlgorithmMD5:
+		return true
+	}
+	return false
+}
+
+// newChecksumHash 返回校验算法对应的 hash.Hash
+func newChecksumHash(hashAlgorithm string) (hash.Hash, error) {
+	switch strings.ToLower(hashAlgorithm) {
+	case "", HashAlgorithmMD5:
+		return md5.New(), nil
+	}
+	return nil, unknownChecksumAlgorithmError(hashAlgorithm)
+}
+
+// CheckFileValid 检测文件有效性, 使用服务器记录的文件大小和md5值校验
+func CheckFileValid(filePath string, fileInfo *cloudpan.AppFileEntity, hashAlgorithm string) error {
+	if fileInfo == nil {
+		return ErrDownloadNotSupportChecksum
+	}
+	return CheckFileSum(filePath, fileInfo.FileSize, fileInfo.FileMd5, hashAlgorithm)
+}
+
+// CheckFileSum 根据服务器记录的文件大小和md5值, 使用 hashAlgorithm 检测本地文件
+func CheckFileSum(filePath string, fileSize int64, md5Sum, hashAlgorithm string) error {
+	if !IsHashAlgorithmSupported(hashAlgorithm) {
+		return unknownChecksumAlgorithmError(hashAlgorithm)
+	}
+	if md5Sum == "" {
+		return ErrDownloadNotSupportChecksum
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
 	// 检查文件大小
-	// 检查digest签名
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != fileSize {
+		return ErrDownloadChecksumFailed
+	}
+
+	sum, err := readerChecksum(file, HashAlgorithmMD5)
+	if err != nil {
+		return err
+	}
+
+	// 检查文件摘要
+	if !strings.EqualFold(sum, md5Sum) {
+		return ErrDownloadChecksumFailed
+	}
 	return nil
 }
 
+// FileChecksum 使用 hashAlgorithm 计算本地文件的摘要值, 返回十六进制字符串
+func FileChecksum(filePath, hashAlgorithm string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return readerChecksum(file, hashAlgorithm)
+}
+
+// readerChecksum 分块读取数据计算摘要, 避免大文件占用过多内存
+func readerChecksum(r io.Reader, hashAlgorithm string) (string, error) {
+	h, err := newChecksumHash(hashAlgorithm)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.CopyBuffer(h, r, make([]byte, ChecksumBufSize))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// SavePathOf 返回网盘文件 panPath 的本地保存路径.
+// panRootDir 为空时保存到 filepath.Join(saveRootPath, 文件的网盘路径), 否则去掉网盘路径中的 panRootDir 前缀
+func SavePathOf(saveRootPath, panRootDir, panPath string) string {
+	if panRootDir == "" {
+		return filepath.Join(saveRootPath, panPath)
+	}
+	panRootDir = path.Clean(panRootDir)
+	if panRootDir == "/" || !strings.HasPrefix(panPath, panRootDir+"/") {
+		return filepath.Join(saveRootPath, panPath)
+	}
+	return filepath.Join(saveRootPath, strings.TrimPrefix(panPath, panRootDir))
+}
+
+// ParseExtensions 解析逗号分隔的扩展名列表, 如 "mp4,.MKV", 返回不含 . 的小写扩展名
+func ParseExtensions(s string) []string {
+	var exts []string
+	for _, ext := range strings.Split(s, ",") {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext != "" {
+			exts = append(exts, ext)
+		}
+	}
+	return exts
+}
+
+// MatchExtensions 文件名 name 的扩展名是否符合过滤条件, 不区分大小写.
+// include 不为空时扩展名必须在 include 中, 并且不能在 exclude 中
+func MatchExtensions(name string, include, exclude []string) bool {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+	for _, e := range exclude {
+		if ext == e {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, e := range include {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
 // FileExist 检查文件是否存在,
 // 只有当文件存在, 文件大小不为0或断点续传文件不存在时, 才判断为存在
 func FileExist(path string) bool {
@@ -0,0 +1,140 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload_test
+
+import (
+	"errors"
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctpango/internal/functions/pandownload"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	testFileData = "hello cloudpan189"
+	testFileMd5  = "0E5A2C0694784EAB88C0EFDD0CE2BF1A"
+)
+
+func writeTestFile(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "pandownload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	filePath := filepath.Join(dir, "test.txt")
+	if err = ioutil.WriteFile(filePath, []byte(testFileData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func TestCheckFileSumMD5(t *testing.T) {
+	filePath := writeTestFile(t)
+	size := int64(len(testFileData))
+
+	for _, algorithm := range []string{"", pandownload.HashAlgorithmMD5, "MD5"} {
+		if err := pandownload.CheckFileSum(filePath, size, testFileMd5, algorithm); err != nil {
+			t.Fatalf("%q check: %s", algorithm, err)
+		}
+	}
+	if err := pandownload.CheckFileSum(filePath, size, "D41D8CD98F00B204E9800998ECF8427E", pandownload.HashAlgorithmMD5); err != pandownload.ErrDownloadChecksumFailed {
+		t.Fatalf("md5 mismatch: got %v", err)
+	}
+	if err := pandownload.CheckFileSum(filePath, size+1, testFileMd5, pandownload.HashAlgorithmMD5); err != pandownload.ErrDownloadChecksumFailed {
+		t.Fatalf("size mismatch: got %v", err)
+	}
+	if err := pandownload.CheckFileSum(filePath, size, "", pandownload.HashAlgorithmMD5); err != pandownload.ErrDownloadNotSupportChecksum {
+		t.Fatalf("no md5: got %v", err)
+	}
+}
+
+func TestCheckFileValid(t *testing.T) {
+	filePath := writeTestFile(t)
+	fileInfo := &cloudpan.AppFileEntity{FileSize: int64(len(testFileData)), FileMd5: testFileMd5}
+
+	if err := pandownload.CheckFileValid(filePath, fileInfo, pandownload.HashAlgorithmMD5); err != nil {
+		t.Fatal(err)
+	}
+	fileInfo.FileMd5 = "D41D8CD98F00B204E9800998ECF8427E"
+	if err := pandownload.CheckFileValid(filePath, fileInfo, pandownload.HashAlgorithmMD5); err != pandownload.ErrDownloadChecksumFailed {
+		t.Fatalf("md5 mismatch: got %v", err)
+	}
+}
+
+func TestCheckFileSumUnknownAlgorithm(t *testing.T) {
+	filePath := writeTestFile(t)
+
+	err := pandownload.CheckFileSum(filePath, int64(len(testFileData)), testFileMd5, "sha256")
+	if !errors.Is(err, pandownload.ErrUnknownChecksumAlgorithm) {
+		t.Fatalf("unknown algorithm: got %v", err)
+	}
+	// 天翼云盘不提供 sha1 和 sha256 值, 不能用于校验
+	for _, algorithm := range []string{"crc32", "sha1", "sha256"} {
+		if pandownload.IsHashAlgorithmSupported(algorithm) {
+			t.Fatalf("%s should not be supported", algorithm)
+		}
+	}
+	for _, algorithm := range []string{"", pandownload.HashAlgorithmMD5, "MD5"} {
+		if !pandownload.IsHashAlgorithmSupported(algorithm) {
+			t.Fatalf("%q should be supported", algorithm)
+		}
+	}
+}
+
+func TestSavePathOf(t *testing.T) {
+	testCases := []struct {
+		panRootDir string
+		panPath    string
+		want       string
+	}{
+		{"", "/photos/2024/jan/img.jpg", filepath.Join("/save", "photos/2024/jan/img.jpg")},
+		{"/photos", "/photos/2024/jan/img.jpg", filepath.Join("/save", "2024/jan/img.jpg")},
+		{"/photos/", "/photos/2024/jan/img.jpg", filepath.Join("/save", "2024/jan/img.jpg")},
+		{"/", "/photos/2024/jan/img.jpg", filepath.Join("/save", "photos/2024/jan/img.jpg")},
+		{"/photo", "/photos/2024/jan/img.jpg", filepath.Join("/save", "photos/2024/jan/img.jpg")},
+	}
+	for _, tc := range testCases {
+		if got := pandownload.SavePathOf("/save", tc.panRootDir, tc.panPath); got != tc.want {
+			t.Errorf("SavePathOf(%q, %q) = %s, want %s", tc.panRootDir, tc.panPath, got, tc.want)
+		}
+	}
+}
+
+func TestMatchExtensions(t *testing.T) {
+	include := pandownload.ParseExtensions("mp4, .MKV,")
+	if len(include) != 2 || include[0] != "mp4" || include[1] != "mkv" {
+		t.Fatalf("ParseExtensions = %v, want [mp4 mkv]", include)
+	}
+	testCases := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    bool
+	}{
+		{"a.MP4", include, nil, true},
+		{"a.mkv", include, nil, true},
+		{"a.txt", include, nil, false},
+		{"mp4", include, nil, false},
+		{"a.txt", nil, nil, true},
+		{"a.txt", nil, []string{"txt"}, false},
+		{"a.mp4", include, []string{"mp4"}, false},
+	}
+	for _, tc := range testCases {
+		if got := pandownload.MatchExtensions(tc.name, tc.include, tc.exclude); got != tc.want {
+			t.Errorf("MatchExtensions(%s, %v, %v) = %t, want %t", tc.name, tc.include, tc.exclude, got, tc.want)
+		}
+	}
+}
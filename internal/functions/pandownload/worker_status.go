@@ -0,0 +1,78 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload
+
+import (
+	"fmt"
+	"github.com/phpc0de/ctlibgo/converter"
+	"github.com/phpc0de/ctpango/cmder/cmdtable"
+	"github.com/phpc0de/ctpango/internal/file/downloader"
+	"io"
+	"strconv"
+)
+
+type (
+	// WorkerStatusRenderer 输出各个下载线程的工作状态
+	WorkerStatusRenderer interface {
+		Render(w io.Writer, workersCallback func(downloader.RangeWorkerFunc))
+	}
+
+	// TableWorkerStatusRenderer 以表格输出所有线程的工作状态, 对应 --status
+	TableWorkerStatusRenderer struct{}
+
+	// CompactWorkerStatusRenderer 每个未完成的线程输出一行, 对应 --list-workers, 适合较窄的终端
+	CompactWorkerStatusRenderer struct{}
+)
+
+// NewWorkerStatusRenderer 根据选项返回 WorkerStatusRenderer, 都不需要输出时返回 nil.
+// 同时指定时优先使用 CompactWorkerStatusRenderer
+func NewWorkerStatusRenderer(isPrintStatus, isListWorkers bool) WorkerStatusRenderer {
+	if isListWorkers {
+		return &CompactWorkerStatusRenderer{}
+	}
+	if isPrintStatus {
+		return &TableWorkerStatusRenderer{}
+	}
+	return nil
+}
+
+func (r *TableWorkerStatusRenderer) Render(w io.Writer, workersCallback func(downloader.RangeWorkerFunc)) {
+	tb := cmdtable.NewTable(w)
+	tb.SetHeader([]string{"#", "status", "range", "left", "speeds", "error"})
+	workersCallback(func(key int, worker *downloader.Worker) bool {
+		wrange := worker.GetRange()
+		tb.Append([]string{fmt.Sprint(worker.ID()), worker.GetStatus().StatusText(), wrange.ShowDetails(), strconv.FormatInt(wrange.Len(), 10), strconv.FormatInt(worker.GetSpeedsPerSecond(), 10), fmt.Sprint(worker.Err())})
+		return true
+	})
+
+	// 先空两行
+	io.WriteString(w, "\n\n")
+	tb.Render()
+}
+
+func (r *CompactWorkerStatusRenderer) Render(w io.Writer, workersCallback func(downloader.RangeWorkerFunc)) {
+	workersCallback(func(key int, worker *downloader.Worker) bool {
+		wrange := worker.GetRange()
+		// 已完成的线程不再输出
+		if wrange == nil || worker.Completed() || wrange.Len() <= 0 {
+			return true
+		}
+		fmt.Fprintf(w, "[%d] range=%d-%d speed=%s/s left=%s\n", worker.ID(),
+			wrange.LoadBegin(), wrange.LoadEnd(),
+			converter.ConvertFileSize(worker.GetSpeedsPerSecond(), 2),
+			converter.ConvertFileSize(wrange.Len(), 2),
+		)
+		return true
+	})
+}
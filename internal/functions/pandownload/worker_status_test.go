@@ -0,0 +1,77 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload_test
+
+import (
+	"fmt"
+	"github.com/phpc0de/ctpango/internal/file/downloader"
+	"github.com/phpc0de/ctpango/internal/functions/pandownload"
+	"github.com/phpc0de/ctpango/library/requester/transfer"
+	"strings"
+	"testing"
+)
+
+func TestCompactWorkerStatusRenderer(t *testing.T) {
+	ranges := []*transfer.Range{
+		{Begin: 0, End: 1024},
+		{Begin: 2048, End: 2048}, // 已下载完成
+		{Begin: 4096, End: 8192},
+	}
+	workers := make([]*downloader.Worker, 0, len(ranges))
+	for k, r := range ranges {
+		worker := downloader.NewWorker(k, 0, "", "", nil)
+		worker.SetRange(r)
+		workers = append(workers, worker)
+	}
+	workersCallback := func(f downloader.RangeWorkerFunc) {
+		for k, worker := range workers {
+			if !f(k, worker) {
+				return
+			}
+		}
+	}
+
+	builder := &strings.Builder{}
+	pandownload.NewWorkerStatusRenderer(true, true).Render(builder, workersCallback)
+	output := builder.String()
+	fmt.Print(output)
+
+	if !strings.HasSuffix(output, "\n") {
+		t.Fatalf("output should end with newline: %q", output)
+	}
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("line count: %d, want 2, output: %q", len(lines), output)
+	}
+	for k, prefix := range []string{"[0] range=0-1024 ", "[2] range=4096-8192 "} {
+		if !strings.HasPrefix(lines[k], prefix) {
+			t.Errorf("line %d: %q, want prefix %q", k, lines[k], prefix)
+		}
+		if !strings.Contains(lines[k], " speed=") || !strings.Contains(lines[k], " left=") {
+			t.Errorf("line %d: %q", k, lines[k])
+		}
+	}
+}
+
+func TestNewWorkerStatusRenderer(t *testing.T) {
+	if pandownload.NewWorkerStatusRenderer(false, false) != nil {
+		t.Fatal("expected nil renderer")
+	}
+	if _, ok := pandownload.NewWorkerStatusRenderer(true, false).(*pandownload.TableWorkerStatusRenderer); !ok {
+		t.Fatal("expected table renderer")
+	}
+	if _, ok := pandownload.NewWorkerStatusRenderer(false, true).(*pandownload.CompactWorkerStatusRenderer); !ok {
+		t.Fatal("expected compact renderer")
+	}
+}
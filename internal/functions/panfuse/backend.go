@@ -0,0 +1,105 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package panfuse
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctapi/cloudpan/apierror"
+	"github.com/phpc0de/ctlibgo/requester"
+	"github.com/phpc0de/ctpango/internal/apistat"
+)
+
+type (
+	// PanBackend 使用天翼云盘接口实现 Backend
+	PanBackend struct {
+		PanClient *apistat.PanClient
+		FamilyId  int64 // 家庭云ID, 个人云为0
+		Client    *requester.HTTPClient
+	}
+)
+
+// ListDir 列出目录下的文件和目录
+func (pb *PanBackend) ListDir(dir *cloudpan.AppFileEntity) (cloudpan.AppFileList, error) {
+	param := cloudpan.NewAppFileListParam()
+	param.FileId = dir.FileId
+	param.FamilyId = pb.FamilyId
+	param.OrderBy = cloudpan.OrderByName
+	param.OrderSort = cloudpan.OrderAsc
+	result, apierr := pb.PanClient.AppGetAllFileList(param)
+	if apierr != nil {
+		return nil, apierr
+	}
+	return result.FileList, nil
+}
+
+// DownloadURL 获取文件的下载链接
+func (pb *PanBackend) DownloadURL(file *cloudpan.AppFileEntity) (string, error) {
+	var (
+		durl   string
+		apierr *apierror.ApiError
+	)
+	if pb.FamilyId > 0 {
+		durl, apierr = pb.PanClient.AppFamilyGetFileDownloadUrl(pb.FamilyId, file.FileId)
+	} else {
+		durl, apierr = pb.PanClient.AppGetFileDownloadUrl(file.FileId)
+	}
+	if apierr != nil {
+		return "", apierr
+	}
+	return durl, nil
+}
+
+// OpenURL 从 offset 处开始读取文件数据
+func (pb *PanBackend) OpenURL(url string, offset int64) (io.ReadCloser, error) {
+	var (
+		resp *http.Response
+		err  error
+	)
+	apierr := pb.PanClient.AppDownloadFileData(url, cloudpan.AppFileDownloadRange{
+		Offset: offset,
+	}, func(httpMethod, fullUrl string, headers map[string]string) (*http.Response, error) {
+		resp, err = pb.Client.Req(httpMethod, fullUrl, nil, headers)
+		return resp, err
+	})
+	if apierr != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, apierr
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if offset > 0 {
+			// 服务器不支持断点续传, 跳过 offset 之前的数据
+			if _, err = io.CopyN(io.Discard, resp.Body, offset); err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+		}
+		return resp.Body, nil
+	case http.StatusPartialContent:
+		return resp.Body, nil
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("HTTP状态码: %s", resp.Status)
+	}
+}
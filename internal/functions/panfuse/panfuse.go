@@ -0,0 +1,318 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+// Package panfuse 以 FUSE 文件系统的方式只读挂载天翼云盘
+package panfuse
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/phpc0de/ctapi/cloudpan"
+)
+
+const (
+	// DefaultCacheTTL 默认目录列表的缓存时间
+	DefaultCacheTTL = 30 * time.Second
+
+	fileTimeLayout = "2006-01-02 15:04:05"
+)
+
+type (
+	// Backend 挂载使用的网盘接口
+	Backend interface {
+		// ListDir 列出目录下的文件和目录, 不递归
+		ListDir(dir *cloudpan.AppFileEntity) (cloudpan.AppFileList, error)
+		// DownloadURL 获取文件的下载链接
+		DownloadURL(file *cloudpan.AppFileEntity) (string, error)
+		// OpenURL 从 offset 处开始读取下载链接的数据, 直到文件末尾
+		OpenURL(url string, offset int64) (io.ReadCloser, error)
+	}
+
+	// FS 只读的天翼云盘文件系统
+	FS struct {
+		backend  Backend
+		root     *cloudpan.AppFileEntity
+		cacheTTL time.Duration
+	}
+
+	// Dir 目录节点, 目录列表缓存 cacheTTL
+	Dir struct {
+		fs     *FS
+		entity *cloudpan.AppFileEntity
+
+		mu       sync.Mutex
+		children map[string]*cloudpan.AppFileEntity
+		names    []string
+		cachedAt time.Time
+	}
+
+	// File 文件节点
+	File struct {
+		fs     *FS
+		entity *cloudpan.AppFileEntity
+	}
+
+	// FileHandle 打开的文件, 第一次读取时才获取下载链接, 顺序读取时复用同一个连接
+	FileHandle struct {
+		file *File
+
+		mu     sync.Mutex
+		url    string
+		reader io.ReadCloser
+		pos    int64 // reader 当前的读取位置
+	}
+)
+
+var (
+	_ fs.FS                 = (*FS)(nil)
+	_ fs.HandleReadDirAller = (*Dir)(nil)
+	_ fs.NodeStringLookuper = (*Dir)(nil)
+	_ fs.NodeOpener         = (*File)(nil)
+	_ fs.HandleReader       = (*FileHandle)(nil)
+	_ fs.HandleReleaser     = (*FileHandle)(nil)
+)
+
+// NewFS 返回以 root 为根目录的文件系统, cacheTTL 小于等于0时不缓存目录列表
+func NewFS(backend Backend, root *cloudpan.AppFileEntity, cacheTTL time.Duration) *FS {
+	return &FS{
+		backend:  backend,
+		root:     root,
+		cacheTTL: cacheTTL,
+	}
+}
+
+// Root 返回根目录节点
+func (f *FS) Root() (fs.Node, error) {
+	return f.newDir(f.root), nil
+}
+
+func (f *FS) newDir(entity *cloudpan.AppFileEntity) *Dir {
+	return &Dir{fs: f, entity: entity}
+}
+
+func (f *FS) newNode(entity *cloudpan.AppFileEntity) fs.Node {
+	if entity.IsFolder {
+		return f.newDir(entity)
+	}
+	return &File{fs: f, entity: entity}
+}
+
+// readOnlyError 输出不支持写入的提示, 并返回 EROFS
+func readOnlyError(op, p string) error {
+	fmt.Fprintf(os.Stderr, "[mount] 天翼云盘为只读挂载, 不支持%s: %s\n", op, p)
+	return syscall.EROFS
+}
+
+// ioError 输出网盘接口的错误, 并返回 EIO
+func ioError(op, p string, err error) error {
+	fmt.Fprintf(os.Stderr, "[mount] %s失败: %s, 错误: %s\n", op, p, err)
+	return syscall.EIO
+}
+
+func entityTime(entity *cloudpan.AppFileEntity) time.Time {
+	t, err := time.ParseInLocation(fileTimeLayout, entity.LastOpTime, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// Attr 目录属性
+func (d *Dir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0555
+	a.Mtime = entityTime(d.entity)
+	a.Ctime = a.Mtime
+	return nil
+}
+
+// load 获取目录列表, 缓存未过期时使用缓存
+func (d *Dir) load() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.children != nil && d.fs.cacheTTL > 0 && time.Since(d.cachedAt) < d.fs.cacheTTL {
+		return nil
+	}
+
+	list, err := d.fs.backend.ListDir(d.entity)
+	if err != nil {
+		return ioError("获取目录列表", d.entity.Path, err)
+	}
+	d.children = make(map[string]*cloudpan.AppFileEntity, len(list))
+	d.names = make([]string, 0, len(list))
+	for _, entity := range list {
+		if _, ok := d.children[entity.FileName]; ok {
+			continue
+		}
+		if entity.Path == "" {
+			entity.Path = path.Join(d.entity.Path, entity.FileName)
+		}
+		d.children[entity.FileName] = entity
+		d.names = append(d.names, entity.FileName)
+	}
+	d.cachedAt = time.Now()
+	return nil
+}
+
+// ReadDirAll 列出目录
+func (d *Dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dirents := make([]fuse.Dirent, 0, len(d.names))
+	for _, name := range d.names {
+		dirent := fuse.Dirent{Name: name, Type: fuse.DT_File}
+		if d.children[name].IsFolder {
+			dirent.Type = fuse.DT_Dir
+		}
+		dirents = append(dirents, dirent)
+	}
+	return dirents, nil
+}
+
+// Lookup 查找目录下的文件或目录
+func (d *Dir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	entity, ok := d.children[name]
+	d.mu.Unlock()
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	return d.fs.newNode(entity), nil
+}
+
+// Create 只读挂载, 不支持创建文件
+func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	return nil, nil, readOnlyError("创建文件", path.Join(d.entity.Path, req.Name))
+}
+
+// Mkdir 只读挂载, 不支持创建目录
+func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
+	return nil, readOnlyError("创建目录", path.Join(d.entity.Path, req.Name))
+}
+
+// Remove 只读挂载, 不支持删除
+func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	return readOnlyError("删除", path.Join(d.entity.Path, req.Name))
+}
+
+// Rename 只读挂载, 不支持重命名和移动
+func (d *Dir) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Node) error {
+	return readOnlyError("重命名", path.Join(d.entity.Path, req.OldName))
+}
+
+// Attr 文件属性
+func (f *File) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = 0444
+	a.Size = uint64(f.entity.FileSize)
+	a.Mtime = entityTime(f.entity)
+	a.Ctime = a.Mtime
+	return nil
+}
+
+// Open 打开文件, 只支持只读打开
+func (f *File) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if !req.Flags.IsReadOnly() {
+		return nil, readOnlyError("写入文件", f.entity.Path)
+	}
+	return &FileHandle{file: f}, nil
+}
+
+// Setattr 只读挂载, 不支持修改文件属性
+func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	return readOnlyError("修改文件属性", f.entity.Path)
+}
+
+// Read 读取文件数据, 读取位置和上次读取的结束位置相同时继续使用原来的连接, 否则重新建立连接
+func (h *FileHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	size := h.file.entity.FileSize
+	if req.Offset >= size {
+		resp.Data = resp.Data[:0]
+		return nil
+	}
+	n := int64(req.Size)
+	if req.Offset+n > size {
+		n = size - req.Offset
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.reader == nil || h.pos != req.Offset {
+		if err := h.open(req.Offset); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, n)
+	read, err := io.ReadFull(h.reader, buf)
+	h.pos += int64(read)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		h.closeReader()
+		return ioError("读取文件", h.file.entity.Path, err)
+	}
+	resp.Data = buf[:read]
+	return nil
+}
+
+// open 从 offset 处重新建立连接, 第一次调用时获取下载链接
+func (h *FileHandle) open(offset int64) error {
+	h.closeReader()
+	if h.url == "" {
+		url, err := h.file.fs.backend.DownloadURL(h.file.entity)
+		if err != nil {
+			return ioError("获取下载链接", h.file.entity.Path, err)
+		}
+		h.url = url
+	}
+	reader, err := h.file.fs.backend.OpenURL(h.url, offset)
+	if err != nil {
+		// 下载链接可能已经过期, 下次读取时重新获取
+		h.url = ""
+		return ioError("读取文件", h.file.entity.Path, err)
+	}
+	h.reader, h.pos = reader, offset
+	return nil
+}
+
+func (h *FileHandle) closeReader() {
+	if h.reader != nil {
+		h.reader.Close()
+		h.reader = nil
+	}
+}
+
+// Release 关闭文件
+func (h *FileHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closeReader()
+	return nil
+}
@@ -0,0 +1,272 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package panfuse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/phpc0de/ctapi/cloudpan"
+)
+
+// mockBackend 内存中的网盘:
+// /我的资源
+// ├── 文档/
+// │   └── a.txt
+// └── 1.txt
+type mockBackend struct {
+	mu        sync.Mutex
+	children  map[string]cloudpan.AppFileList
+	data      map[string][]byte
+	listCalls int
+	urlCalls  int
+	opens     []int64
+	listErr   error
+}
+
+func newMockBackend() *mockBackend {
+	return &mockBackend{
+		children: map[string]cloudpan.AppFileList{
+			"1": {
+				{FileId: "12", FileName: "文档", IsFolder: true},
+				{FileId: "11", FileName: "1.txt", FileSize: 10, LastOpTime: "2021-01-02 03:04:05"},
+			},
+			"12": {
+				{FileId: "121", FileName: "a.txt", FileSize: 3},
+			},
+		},
+		data: map[string][]byte{
+			"11":  []byte("0123456789"),
+			"121": []byte("abc"),
+		},
+	}
+}
+
+func (mb *mockBackend) ListDir(dir *cloudpan.AppFileEntity) (cloudpan.AppFileList, error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.listCalls++
+	if mb.listErr != nil {
+		return nil, mb.listErr
+	}
+	return mb.children[dir.FileId], nil
+}
+
+func (mb *mockBackend) DownloadURL(file *cloudpan.AppFileEntity) (string, error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.urlCalls++
+	return file.FileId, nil
+}
+
+func (mb *mockBackend) OpenURL(url string, offset int64) (io.ReadCloser, error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.opens = append(mb.opens, offset)
+	return ioutil.NopCloser(bytes.NewReader(mb.data[url][offset:])), nil
+}
+
+func newTestFS(backend Backend, ttl time.Duration) *FS {
+	return NewFS(backend, &cloudpan.AppFileEntity{FileId: "1", FileName: "我的资源", Path: "/我的资源", IsFolder: true}, ttl)
+}
+
+func rootDir(t *testing.T, f *FS) *Dir {
+	node, err := f.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node.(*Dir)
+}
+
+func TestDirReadDirAllAndLookup(t *testing.T) {
+	ctx := context.Background()
+	backend := newMockBackend()
+	root := rootDir(t, newTestFS(backend, DefaultCacheTTL))
+
+	dirents, err := root.ReadDirAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []fuse.Dirent{
+		{Name: "文档", Type: fuse.DT_Dir},
+		{Name: "1.txt", Type: fuse.DT_File},
+	}
+	if len(dirents) != len(expected) {
+		t.Fatalf("got %v, want %v", dirents, expected)
+	}
+	for k := range dirents {
+		if dirents[k] != expected[k] {
+			t.Fatalf("got %v, want %v", dirents, expected)
+		}
+	}
+
+	node, err := root.Lookup(ctx, "文档")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attr := fuse.Attr{}
+	if err = node.Attr(ctx, &attr); err != nil {
+		t.Fatal(err)
+	}
+	if !attr.Mode.IsDir() {
+		t.Fatalf("mode: %s", attr.Mode)
+	}
+	sub := node.(*Dir)
+	if sub.entity.Path != "/我的资源/文档" {
+		t.Fatalf("path: %s", sub.entity.Path)
+	}
+
+	node, err = root.Lookup(ctx, "1.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attr = fuse.Attr{}
+	node.Attr(ctx, &attr)
+	if attr.Size != 10 || attr.Mode != 0444 {
+		t.Fatalf("file attr: %s", attr)
+	}
+	if want := time.Date(2021, 1, 2, 3, 4, 5, 0, time.Local); !attr.Mtime.Equal(want) {
+		t.Fatalf("mtime: %s", attr.Mtime)
+	}
+
+	if _, err = root.Lookup(ctx, "不存在"); err != syscall.ENOENT {
+		t.Fatalf("expected ENOENT, got %v", err)
+	}
+
+	// 缓存时间内只获取一次目录列表
+	if backend.listCalls != 1 {
+		t.Fatalf("list calls: %d", backend.listCalls)
+	}
+}
+
+func TestDirCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	backend := newMockBackend()
+	root := rootDir(t, newTestFS(backend, 0))
+	root.ReadDirAll(ctx)
+	root.ReadDirAll(ctx)
+	if backend.listCalls != 2 {
+		t.Fatalf("cache disabled, list calls: %d", backend.listCalls)
+	}
+
+	root = rootDir(t, newTestFS(backend, time.Minute))
+	root.ReadDirAll(ctx)
+	root.cachedAt = root.cachedAt.Add(-2 * time.Minute)
+	root.ReadDirAll(ctx)
+	if backend.listCalls != 4 {
+		t.Fatalf("cache expired, list calls: %d", backend.listCalls)
+	}
+}
+
+func TestDirListError(t *testing.T) {
+	backend := newMockBackend()
+	backend.listErr = errors.New("network error")
+	root := rootDir(t, newTestFS(backend, DefaultCacheTTL))
+	if _, err := root.ReadDirAll(context.Background()); err != syscall.EIO {
+		t.Fatalf("expected EIO, got %v", err)
+	}
+}
+
+func readHandle(t *testing.T, h fs.HandleReader, offset int64, size int) string {
+	req := &fuse.ReadRequest{Offset: offset, Size: size}
+	resp := &fuse.ReadResponse{}
+	if err := h.Read(context.Background(), req, resp); err != nil {
+		t.Fatal(err)
+	}
+	return string(resp.Data)
+}
+
+func TestFileRead(t *testing.T) {
+	ctx := context.Background()
+	backend := newMockBackend()
+	root := rootDir(t, newTestFS(backend, DefaultCacheTTL))
+	node, err := root.Lookup(ctx, "1.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handle, err := node.(*File).Open(ctx, &fuse.OpenRequest{Flags: fuse.OpenReadOnly}, &fuse.OpenResponse{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 打开时不获取下载链接
+	if backend.urlCalls != 0 {
+		t.Fatal("download url should be fetched lazily")
+	}
+	h := handle.(*FileHandle)
+
+	cases := []struct {
+		offset int64
+		size   int
+		data   string
+	}{
+		{0, 4, "0123"},
+		{4, 4, "4567"}, // 顺序读取, 复用连接
+		{8, 4, "89"},   // 超过文件末尾
+		{10, 4, ""},
+		{2, 3, "234"}, // 随机读取, 重新建立连接
+	}
+	for _, c := range cases {
+		if data := readHandle(t, h, c.offset, c.size); data != c.data {
+			t.Fatalf("read %d+%d: got %q, want %q", c.offset, c.size, data, c.data)
+		}
+	}
+	if backend.urlCalls != 1 {
+		t.Fatalf("url calls: %d", backend.urlCalls)
+	}
+	if len(backend.opens) != 2 || backend.opens[0] != 0 || backend.opens[1] != 2 {
+		t.Fatalf("opens: %v", backend.opens)
+	}
+	if err = h.Release(ctx, &fuse.ReleaseRequest{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	ctx := context.Background()
+	root := rootDir(t, newTestFS(newMockBackend(), DefaultCacheTTL))
+	node, _ := root.Lookup(ctx, "1.txt")
+
+	// 不输出提示信息到测试结果
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+
+	if _, err := node.(*File).Open(ctx, &fuse.OpenRequest{Flags: fuse.OpenWriteOnly}, &fuse.OpenResponse{}); err != syscall.EROFS {
+		t.Fatalf("open for write: %v", err)
+	}
+	if _, _, err := root.Create(ctx, &fuse.CreateRequest{Name: "new.txt"}, &fuse.CreateResponse{}); err != syscall.EROFS {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := root.Mkdir(ctx, &fuse.MkdirRequest{Name: "new"}); err != syscall.EROFS {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := root.Remove(ctx, &fuse.RemoveRequest{Name: "1.txt"}); err != syscall.EROFS {
+		t.Fatalf("remove: %v", err)
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panlogin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctapi/cloudpan/apiutil"
+	"github.com/phpc0de/ctlibgo/logger"
+	"github.com/phpc0de/ctlibgo/requester"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	// QRCodeStateSuccess 扫码并确认登录
+	QRCodeStateSuccess = 0
+	// QRCodeStateWaitScan 等待扫码
+	QRCodeStateWaitScan = -106
+	// QRCodeStateWaitConfirm 已扫码, 等待在手机上确认
+	QRCodeStateWaitConfirm = -11002
+	// QRCodeStateExpired 二维码已失效
+	QRCodeStateExpired = -11001
+
+	// DefaultQRCodePollInterval 默认查询扫码状态的间隔
+	DefaultQRCodePollInterval = 2 * time.Second
+	// DefaultQRCodeTimeout 默认二维码的有效时间
+	DefaultQRCodeTimeout = 120 * time.Second
+
+	qrcodeAppId      = "8025431004"
+	qrcodeClientType = "10020"
+	qrcodeReturnURL  = "https://m.cloud.189.cn/zhuanti/2020/loginErrorPc/index.html"
+	authURL          = "https://open.e.189.cn/api/logbox/oauth2"
+	webURL           = "https://cloud.189.cn"
+	apiURL           = "https://api.cloud.189.cn"
+)
+
+var (
+	// ErrQRCodeExpired 二维码已失效
+	ErrQRCodeExpired = errors.New("二维码已失效, 请重新登录")
+	// ErrQRCodeTimeout 等待扫码超时
+	ErrQRCodeTimeout = errors.New("等待扫码超时, 二维码已失效, 请重新登录")
+)
+
+type (
+	// QRCodeInfo 登录二维码
+	QRCodeInfo struct {
+		UUID       string `json:"uuid"`      // 二维码的内容
+		EncryUUID  string `json:"encryuuid"` // 查询扫码状态时使用
+		EncodeUUID string `json:"encodeuuid"`
+	}
+
+	// QRCodeState 扫码状态
+	QRCodeState struct {
+		Status      int    `json:"status"`
+		RedirectURL string `json:"redirectUrl"` // 登录成功后用于获取session
+		Msg         string `json:"msg"`
+	}
+
+	// QRCodeLoginClient 扫码登录需要的接口
+	QRCodeLoginClient interface {
+		// GetQRCode 获取登录二维码
+		GetQRCode() (*QRCodeInfo, error)
+		// QueryState 查询扫码状态
+		QueryState(info *QRCodeInfo) (*QRCodeState, error)
+		// GetToken 扫码成功后通过 redirectURL 获取登录凭证
+		GetToken(redirectURL string) (*cloudpan.AppLoginToken, string, error)
+	}
+
+	// qrcodeLoginClient 天翼云盘扫码登录
+	qrcodeLoginClient struct {
+		client    *requester.HTTPClient
+		lt        string
+		reqId     string
+		returnURL string
+		paramId   string
+	}
+
+	// qrcodeSessionResp getSessionForPC.action 的返回
+	qrcodeSessionResp struct {
+		ResCode             int    `json:"res_code"`
+		ResMessage          string `json:"res_message"`
+		LoginName           string `json:"loginName"`
+		SessionKey          string `json:"sessionKey"`
+		SessionSecret       string `json:"sessionSecret"`
+		FamilySessionKey    string `json:"familySessionKey"`
+		FamilySessionSecret string `json:"familySessionSecret"`
+		AccessToken         string `json:"accessToken"`
+		RefreshToken        string `json:"refreshToken"`
+	}
+
+	// qrcodeAccessTokenResp getAccessTokenBySsKey.action 的返回
+	qrcodeAccessTokenResp struct {
+		ExpiresIn   int64  `json:"expiresIn"`
+		AccessToken string `json:"accessToken"`
+	}
+)
+
+// NewQRCodeLoginClient 初始化扫码登录
+func NewQRCodeLoginClient() QRCodeLoginClient {
+	return &qrcodeLoginClient{
+		client: requester.NewHTTPClient(),
+	}
+}
+
+// QRCodeStateText 扫码状态的说明
+func QRCodeStateText(status int) string {
+	switch status {
+	case QRCodeStateSuccess:
+		return "登录成功"
+	case QRCodeStateWaitScan:
+		return "等待扫码"
+	case QRCodeStateWaitConfirm:
+		return "已扫码, 请在手机上确认登录"
+	case QRCodeStateExpired:
+		return "二维码已失效"
+	}
+	return "未知状态: " + strconv.Itoa(status)
+}
+
+// WaitQRCodeLogin 每隔 interval 查询一次扫码状态, 直到登录成功, 二维码失效或超过 timeout.
+// 状态变化时调用 onState, 登录成功时返回 redirectURL
+func WaitQRCodeLogin(client QRCodeLoginClient, info *QRCodeInfo, interval, timeout time.Duration, onState func(state *QRCodeState)) (string, error) {
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastStatus := QRCodeStateWaitScan
+	for {
+		select {
+		case <-deadline:
+			return "", ErrQRCodeTimeout
+		case <-ticker.C:
+		}
+
+		state, err := client.QueryState(info)
+		if err != nil {
+			// 网络错误时继续等待, 直到超时
+			logger.Verbosef("query qrcode state error: %s\n", err)
+			continue
+		}
+		if state.Status != lastStatus && onState != nil {
+			onState(state)
+		}
+		lastStatus = state.Status
+
+		switch state.Status {
+		case QRCodeStateSuccess:
+			if state.RedirectURL == "" {
+				return "", errors.New("登录成功, 但没有返回 redirectUrl")
+			}
+			return state.RedirectURL, nil
+		case QRCodeStateExpired:
+			return "", ErrQRCodeExpired
+		}
+	}
+}
+
+// initParams 获取登录页面的参数
+func (qc *qrcodeLoginClient) initParams() error {
+	fullUrl := fmt.Sprintf("%s/unifyLoginForPC.action?appId=%s&clientType=%s&returnURL=%s&timeStamp=%d",
+		webURL, qrcodeAppId, qrcodeClientType, qrcodeReturnURL, apiutil.Timestamp())
+	logger.Verboseln("do request url: " + fullUrl)
+	data, err := qc.client.Fetch("GET", fullUrl, nil, map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded",
+	})
+	if err != nil {
+		return err
+	}
+
+	params := map[string]*string{
+		`lt = "(.+?)"`:        &qc.lt,
+		`reqId = "(.+?)"`:     &qc.reqId,
+		`returnUrl = '(.+?)'`: &qc.returnURL,
+		`paramId = "(.+?)"`:   &qc.paramId,
+	}
+	for expr, value := range params {
+		match := regexp.MustCompile(expr).FindSubmatch(data)
+		if match == nil {
+			return fmt.Errorf("获取登录参数失败: %s", expr)
+		}
+		*value = string(match[1])
+	}
+	return nil
+}
+
+func (qc *qrcodeLoginClient) headers() map[string]string {
+	return map[string]string{
+		"Content-Type":     "application/x-www-form-urlencoded",
+		"Referer":          authURL + "/unifyAccountLogin.do",
+		"Cookie":           "LT=" + qc.lt,
+		"X-Requested-With": "XMLHttpRequest",
+		"REQID":            qc.reqId,
+		"lt":               qc.lt,
+	}
+}
+
+func (qc *qrcodeLoginClient) GetQRCode() (*QRCodeInfo, error) {
+	if err := qc.initParams(); err != nil {
+		return nil, err
+	}
+	body, err := qc.client.Fetch("POST", authURL+"/getUUID.do", map[string]string{
+		"appId": qrcodeAppId,
+	}, qc.headers())
+	if err != nil {
+		return nil, err
+	}
+	logger.Verboseln("response: " + string(body))
+	info := &QRCodeInfo{}
+	if err = json.Unmarshal(body, info); err != nil {
+		return nil, err
+	}
+	if info.UUID == "" || info.EncryUUID == "" {
+		return nil, errors.New("获取登录二维码失败")
+	}
+	return info, nil
+}
+
+func (qc *qrcodeLoginClient) QueryState(info *QRCodeInfo) (*QRCodeState, error) {
+	now := time.Now()
+	body, err := qc.client.Fetch("POST", authURL+"/qrcodeLoginState.do", map[string]string{
+		"appId":      qrcodeAppId,
+		"clientType": qrcodeClientType,
+		"returnUrl":  qc.returnURL,
+		"paramId":    qc.paramId,
+		"uuid":       info.UUID,
+		"encryuuid":  info.EncryUUID,
+		"date":       now.Format("2006-01-0215:04:05") + strconv.Itoa(now.Nanosecond()/1e6),
+		"timeStamp":  strconv.FormatInt(now.UnixNano()/1e6, 10),
+	}, qc.headers())
+	if err != nil {
+		return nil, err
+	}
+	state := &QRCodeState{}
+	if err = json.Unmarshal(body, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (qc *qrcodeLoginClient) GetToken(redirectURL string) (*cloudpan.AppLoginToken, string, error) {
+	fullUrl := fmt.Sprintf("%s/getSessionForPC.action?clientType=%s&version=%s&channelId=%s&redirectURL=%s",
+		apiURL, "TELEMAC", "1.0.0", "web_cloud.189.cn", url.QueryEscape(redirectURL))
+	body, err := qc.client.Fetch("GET", fullUrl, nil, map[string]string{
+		"Accept": "application/json;charset=UTF-8",
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	rs := &qrcodeSessionResp{}
+	if err = json.Unmarshal(body, rs); err != nil {
+		return nil, "", err
+	}
+	if rs.ResCode != 0 {
+		return nil, "", fmt.Errorf("获取session失败: %s", rs.ResMessage)
+	}
+	token := &cloudpan.AppLoginToken{
+		SessionKey:          rs.SessionKey,
+		SessionSecret:       rs.SessionSecret,
+		FamilySessionKey:    rs.FamilySessionKey,
+		FamilySessionSecret: rs.FamilySessionSecret,
+		AccessToken:         rs.AccessToken,
+		RefreshToken:        rs.RefreshToken,
+	}
+
+	// 和账号密码登录一样, 获取有效期的 Ssk token
+	timestamp := strconv.Itoa(apiutil.Timestamp())
+	fullUrl = fmt.Sprintf("%s/open/oauth2/getAccessTokenBySsKey.action?sessionKey=%s", apiURL, rs.SessionKey)
+	body, err = qc.client.Fetch("GET", fullUrl, nil, map[string]string{
+		"AppKey": "601102120",
+		"Signature": apiutil.SignatureOfMd5(map[string]string{
+			"Timestamp":  timestamp,
+			"sessionKey": rs.SessionKey,
+			"AppKey":     "601102120",
+		}),
+		"Sign-Type": "1",
+		"Accept":    "application/json",
+		"Timestamp": timestamp,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	atr := &qrcodeAccessTokenResp{}
+	if err = json.Unmarshal(body, atr); err != nil {
+		return nil, "", err
+	}
+	token.SskAccessToken = atr.AccessToken
+	token.SskAccessTokenExpiresIn = atr.ExpiresIn
+	return token, rs.LoginName, nil
+}
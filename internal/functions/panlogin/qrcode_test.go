@@ -0,0 +1,107 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panlogin_test
+
+import (
+	"errors"
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctpango/internal/functions/panlogin"
+	"testing"
+	"time"
+)
+
+type mockQRCodeClient struct {
+	states  []*panlogin.QRCodeState // 依次返回的扫码状态, 用完后一直返回最后一个
+	errs    map[int]error           // 第几次查询返回错误
+	queries int
+}
+
+func (m *mockQRCodeClient) GetQRCode() (*panlogin.QRCodeInfo, error) {
+	return &panlogin.QRCodeInfo{UUID: "uuid", EncryUUID: "encryuuid"}, nil
+}
+
+func (m *mockQRCodeClient) QueryState(info *panlogin.QRCodeInfo) (*panlogin.QRCodeState, error) {
+	m.queries++
+	if err := m.errs[m.queries]; err != nil {
+		return nil, err
+	}
+	i := m.queries - 1
+	if i >= len(m.states) {
+		i = len(m.states) - 1
+	}
+	return m.states[i], nil
+}
+
+func (m *mockQRCodeClient) GetToken(redirectURL string) (*cloudpan.AppLoginToken, string, error) {
+	return &cloudpan.AppLoginToken{}, "", nil
+}
+
+func TestWaitQRCodeLoginSuccess(t *testing.T) {
+	client := &mockQRCodeClient{
+		states: []*panlogin.QRCodeState{
+			{Status: panlogin.QRCodeStateWaitScan},
+			{Status: panlogin.QRCodeStateWaitConfirm},
+			{Status: panlogin.QRCodeStateWaitConfirm},
+			{Status: panlogin.QRCodeStateSuccess, RedirectURL: "https://cloud.189.cn/redirect"},
+		},
+		errs: map[int]error{2: errors.New("network error")},
+	}
+	info, _ := client.GetQRCode()
+
+	changes := make([]int, 0)
+	redirectURL, err := panlogin.WaitQRCodeLogin(client, info, time.Millisecond, time.Second, func(state *panlogin.QRCodeState) {
+		changes = append(changes, state.Status)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redirectURL != "https://cloud.189.cn/redirect" {
+		t.Fatalf("redirectURL: %s", redirectURL)
+	}
+	// 查询出错时继续等待, 只在状态变化时回调
+	if client.queries != 4 {
+		t.Fatalf("queries: %d", client.queries)
+	}
+	if len(changes) != 2 || changes[0] != panlogin.QRCodeStateWaitConfirm || changes[1] != panlogin.QRCodeStateSuccess {
+		t.Fatalf("changes: %v", changes)
+	}
+}
+
+func TestWaitQRCodeLoginExpired(t *testing.T) {
+	client := &mockQRCodeClient{
+		states: []*panlogin.QRCodeState{
+			{Status: panlogin.QRCodeStateWaitScan},
+			{Status: panlogin.QRCodeStateExpired},
+		},
+	}
+	info, _ := client.GetQRCode()
+	_, err := panlogin.WaitQRCodeLogin(client, info, time.Millisecond, time.Second, nil)
+	if err != panlogin.ErrQRCodeExpired {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestWaitQRCodeLoginTimeout(t *testing.T) {
+	client := &mockQRCodeClient{
+		states: []*panlogin.QRCodeState{{Status: panlogin.QRCodeStateWaitScan}},
+	}
+	info, _ := client.GetQRCode()
+	_, err := panlogin.WaitQRCodeLogin(client, info, time.Millisecond, 20*time.Millisecond, nil)
+	if err != panlogin.ErrQRCodeTimeout {
+		t.Fatalf("got %v", err)
+	}
+	if client.queries == 0 {
+		t.Fatal("should poll before timeout")
+	}
+}
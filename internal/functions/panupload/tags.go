@@ -0,0 +1,102 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/phpc0de/ctpango/internal/localfile"
+)
+
+const (
+	// TagsSidecarSuffix 保存文件标签的附属文件后缀, 天翼云盘不支持自定义元数据,
+	// 标签以 JSON 格式保存在与文件同目录的 <文件名>.meta.json 中
+	TagsSidecarSuffix = ".meta.json"
+)
+
+// ParseTags 解析 key1=val1,key2=val2 格式的标签, 值可以为空, key 不能为空
+func ParseTags(s string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || key == "" {
+			return nil, fmt.Errorf("标签格式错误: %s, 应为 key=value", item)
+		}
+		tags[key] = strings.TrimSpace(kv[1])
+	}
+	return tags, nil
+}
+
+// TagsSidecarPath 返回网盘文件 panPath 的标签附属文件路径
+func TagsSidecarPath(panPath string) string {
+	return path.Clean(panPath) + TagsSidecarSuffix
+}
+
+// uploadTags 把标签写入临时文件, 上传为 SavePath 的附属文件, 覆盖已存在的附属文件
+func (utu *UploadTaskUnit) uploadTags() error {
+	data, err := json.MarshalIndent(utu.Tags, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile("", "cloudpan189-tags-*"+TagsSidecarSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.Write(data)
+	if cerr := tmpFile.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	sidecar := &UploadTaskUnit{
+		LocalFileChecksum: localfile.NewLocalFileEntity(tmpFile.Name()),
+		SavePath:          TagsSidecarPath(utu.SavePath),
+		FamilyId:          utu.FamilyId,
+		FolderCreateMutex: utu.FolderCreateMutex,
+		PanClient:         utu.PanClient,
+		UploadingDatabase: utu.UploadingDatabase,
+		Parallel:          utu.Parallel,
+		UploadMode:        UploadModeAuto,
+		NoSplitFile:       utu.NoSplitFile,
+		UploadStatistic:   utu.UploadStatistic,
+		IsOverwrite:       true,
+	}
+	sidecar.SetTaskInfo(utu.taskInfo)
+	result := sidecar.Run()
+	if result == nil {
+		return errors.New("上传标签文件失败")
+	}
+	if !result.Succeed {
+		if result.Err != nil {
+			return result.Err
+		}
+		return errors.New(result.ResultMessage)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	testCases := []struct {
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"project=demo", map[string]string{"project": "demo"}, false},
+		{" project = demo , owner=alice,", map[string]string{"project": "demo", "owner": "alice"}, false},
+		{"empty=", map[string]string{"empty": ""}, false},
+		{"expr=a=b", map[string]string{"expr": "a=b"}, false},
+		{"novalue", nil, true},
+		{"=demo", nil, true},
+	}
+	for _, tc := range testCases {
+		got, err := ParseTags(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseTags(%q) err = %v, wantErr %v", tc.in, err, tc.wantErr)
+			continue
+		}
+		if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseTags(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestTagsSidecarPath(t *testing.T) {
+	if got := TagsSidecarPath("/视频/1.mp4"); got != "/视频/1.mp4.meta.json" {
+		t.Errorf("TagsSidecarPath = %s", got)
+	}
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/phpc0de/ctapi/cloudpan"
 	"github.com/phpc0de/ctapi/cloudpan/apierror"
+	"github.com/phpc0de/ctpango/internal/apistat"
 	"github.com/phpc0de/ctpango/internal/file/uploader"
 	"github.com/phpc0de/ctlibgo/requester"
 	"github.com/phpc0de/ctlibgo/requester/rio"
@@ -28,7 +29,7 @@ import (
 
 type (
 	PanUpload struct {
-		panClient  *cloudpan.PanClient
+		panClient  *apistat.PanClient
 		targetPath string
 		familyId   int64
 
@@ -66,7 +67,7 @@ func (e EmptyReaderLen64) Len() int64 {
 	return 0
 }
 
-func NewPanUpload(panClient *cloudpan.PanClient, targetPath, uploadUrl, commitUrl, uploadFileId, xRequestId string, familyId int64) uploader.MultiUpload {
+func NewPanUpload(panClient *apistat.PanClient, targetPath, uploadUrl, commitUrl, uploadFileId, xRequestId string, familyId int64) uploader.MultiUpload {
 	return &PanUpload{
 		panClient:     panClient,
 		targetPath:    targetPath,
@@ -80,7 +81,7 @@ func NewPanUpload(panClient *cloudpan.PanClient, targetPath, uploadUrl, commitUr
 
 func (pu *PanUpload) lazyInit() {
 	if pu.panClient == nil {
-		pu.panClient = &cloudpan.PanClient{}
+		pu.panClient = apistat.NewPanClient(&cloudpan.PanClient{})
 	}
 }
 
@@ -41,6 +41,9 @@ type (
 
 		dataFile *os.File
 	}
+
+	// UploadingPathSet 未完成上传的本地文件绝对路径集合
+	UploadingPathSet map[string]bool
 )
 
 // NewUploadingDatabase 初始化未完成上传的数据库, 从库中读取内容
@@ -146,6 +149,27 @@ func (ud *UploadingDatabase) Delete(meta *localfile.LocalFileMeta) bool {
 	return false
 }
 
+// UploadingPathSet 返回当前所有未完成上传的本地文件路径
+func (ud *UploadingDatabase) UploadingPathSet() UploadingPathSet {
+	set := UploadingPathSet{}
+	for _, uploading := range ud.UploadingList {
+		if uploading.LocalFileMeta == nil {
+			continue
+		}
+		meta := &localfile.LocalFileMeta{Path: uploading.LocalFileMeta.Path}
+		meta.CompleteAbsPath()
+		set[meta.Path] = true
+	}
+	return set
+}
+
+// Contains 检测本地文件是否存在未完成的上传
+func (s UploadingPathSet) Contains(localPath string) bool {
+	meta := &localfile.LocalFileMeta{Path: localPath}
+	meta.CompleteAbsPath()
+	return s[meta.Path]
+}
+
 // Search 搜索
 func (ud *UploadingDatabase) Search(meta *localfile.LocalFileMeta) *uploader.InstanceState {
 	if meta == nil {
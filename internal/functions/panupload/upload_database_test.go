@@ -0,0 +1,50 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/phpc0de/ctpango/internal/localfile"
+)
+
+func TestUploadingPathSet(t *testing.T) {
+	absPath, err := filepath.Abs("uploading.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ud := &UploadingDatabase{
+		UploadingList: []*Uploading{
+			{LocalFileMeta: &localfile.LocalFileMeta{Path: absPath}},
+			{LocalFileMeta: nil},
+		},
+	}
+
+	set := ud.UploadingPathSet()
+	if !set.Contains(absPath) {
+		t.Fatalf("absolute path not found: %s", absPath)
+	}
+	if !set.Contains("uploading.bin") {
+		t.Fatal("relative path not found")
+	}
+	if set.Contains("other.bin") {
+		t.Fatal("unexpected path found")
+	}
+
+	var empty UploadingPathSet
+	if empty.Contains(absPath) {
+		t.Fatal("nil set should be empty")
+	}
+}
@@ -14,6 +14,8 @@
 package panupload
 
 import (
+	"time"
+
 	"github.com/phpc0de/ctpango/internal/functions"
 )
 
@@ -22,3 +24,15 @@ type (
 		functions.Statistic
 	}
 )
+
+// AverageSpeed 返回开始计时以来的平均上传速度, 单位 B/s, 秒传的文件不计入上传的数据量
+func (us *UploadStatistic) AverageSpeed() int64 {
+	return averageSpeed(us.TotalSize(), us.Elapsed())
+}
+
+func averageSpeed(totalSize int64, elapsed time.Duration) int64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(totalSize) / elapsed.Seconds())
+}
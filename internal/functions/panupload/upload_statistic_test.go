@@ -0,0 +1,52 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUploadStatistic(t *testing.T) {
+	statistic := &UploadStatistic{}
+	statistic.StartTimer()
+
+	// 模拟多个上传任务同时完成
+	wg := sync.WaitGroup{}
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				statistic.AddTotalSize(1024)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if total := statistic.TotalSize(); total != 16*100*1024 {
+		t.Fatalf("total size: %d", total)
+	}
+	if speed := statistic.AverageSpeed(); speed <= 0 {
+		t.Fatalf("average speed: %d", speed)
+	}
+
+	if speed := averageSpeed(10*1024*1024, 4*time.Second); speed != 2560*1024 {
+		t.Errorf("average speed: %d", speed)
+	}
+	if speed := averageSpeed(1024, 0); speed != 0 {
+		t.Errorf("zero elapsed speed: %d", speed)
+	}
+}
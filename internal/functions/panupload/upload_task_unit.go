@@ -14,9 +14,11 @@
 package panupload
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path"
-	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -25,12 +27,15 @@ import (
 
 	"github.com/phpc0de/ctapi/cloudpan"
 	"github.com/phpc0de/ctapi/cloudpan/apierror"
+	"github.com/phpc0de/ctpango/internal/apistat"
 	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/phpc0de/ctpango/internal/file/downloader"
 	"github.com/phpc0de/ctpango/internal/file/uploader"
 	"github.com/phpc0de/ctpango/internal/functions"
+	"github.com/phpc0de/ctpango/internal/history"
 	"github.com/phpc0de/ctpango/internal/localfile"
 	"github.com/phpc0de/ctpango/internal/taskframework"
-	"github.com/phpc0de/ctlibgo/converter"
+	"github.com/phpc0de/ctpango/library/crypto"
 	"github.com/phpc0de/ctlibgo/requester/rio"
 )
 
@@ -47,21 +52,37 @@ type (
 		FolderCreateMutex *sync.Mutex
 		FolderSyncDb      SyncDb //文件备份状态数据库
 
-		PanClient         *cloudpan.PanClient
+		PanClient         *apistat.PanClient
 		UploadingDatabase *UploadingDatabase // 数据库
 		Parallel          int
-		NoRapidUpload     bool // 禁用秒传
-		NoSplitFile       bool // 禁用分片上传
+		NoRapidUpload     bool   // 禁用秒传
+		UploadMode        string // 上传模式, auto, rapid 或 multipart, 默认为 auto
+		NoSplitFile       bool   // 禁用分片上传
+		EncryptKey        []byte // 不为空时, 使用 AES-256-GCM 加密文件后再上传
 
 		UploadStatistic *UploadStatistic
+		Webhook         *functions.Webhook // 不为空时, 文件上传成功或失败后调用 webhook
 
 		taskInfo *taskframework.TaskInfo
 		panDir   string
 		panFile  string
 		state    *uploader.InstanceState
 
-		ShowProgress bool
-		IsOverwrite  bool // 覆盖已存在的文件，如果同名文件已存在则移到回收站里
+		ShowProgress     bool
+		PrintFormat      string                                      // 上传进度的输出格式, 为空时使用 DefaultPrintFormat
+		IsOverwrite      bool                                        // 覆盖已存在的文件，如果同名文件已存在则移到回收站里
+		ConflictStrategy ConflictStrategy                            // 网盘中已存在同名文件时的处理策略, 为空时不检测同名文件
+		OnlyNewer        bool                                        // 网盘中已存在同名文件时, 只有本地文件的修改时间更新才上传
+		Tags             map[string]string                           // 不为空时, 上传成功后把标签保存到附属文件 <文件名>.meta.json
+		OnUploadStatus   func(taskId string, status uploader.Status) // 不为空时, 上传期间每秒调用一次, 可用于自定义进度输出
+
+		plainFile *localfile.LocalFileEntity // 启用加密时, 加密前的本地文件
+		startedAt time.Time                  // 第一次开始上传的时间
+		finished  bool                       // 上传已结束(成功或失败), 在 OnComplete 中记录历史
+		retrying  bool                       // 本次运行失败后还会重试, 在 OnComplete 中保留加密的临时文件
+
+		replaceFile     *cloudpan.AppFileEntity // 只使用秒传并覆盖同名文件时, 秒传成功后才删除的网盘文件
+		replaceSavePath string                  // 只使用秒传并覆盖同名文件时, 秒传成功后重命名为该路径
 	}
 )
 
@@ -78,12 +99,46 @@ const (
 
 const (
 	StrUploadFailed = "上传文件失败"
+
+	// DefaultPrintFormat 默认的上传进度输出格式
+	DefaultPrintFormat = "\r[%s] %s↑ %s/%s %s/s in %s, left %s ............"
 )
 
 func (utu *UploadTaskUnit) SetTaskInfo(taskInfo *taskframework.TaskInfo) {
 	utu.taskInfo = taskInfo
 }
 
+// encryptFile 加密要上传的文件, 加密后的数据保存在临时文件中, 实际上传的是该临时文件,
+// 所以MD5也是按加密后的数据计算的. 重试时直接使用已加密的临时文件
+func (utu *UploadTaskUnit) encryptFile() error {
+	if len(utu.EncryptKey) == 0 || utu.plainFile != nil {
+		return nil
+	}
+
+	// 读取原始文件的大小和修改时间
+	err := utu.LocalFileChecksum.OpenPath()
+	if err != nil {
+		return err
+	}
+	utu.LocalFileChecksum.Close()
+
+	tmpFile, err := ioutil.TempFile("", "cloudpan189-encrypt-")
+	if err != nil {
+		return err
+	}
+	tmpFile.Close()
+
+	err = crypto.EncryptFileGCM(utu.EncryptKey, utu.LocalFileChecksum.Path, tmpFile.Name())
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+	utu.plainFile = utu.LocalFileChecksum
+	utu.LocalFileChecksum = localfile.NewLocalFileEntity(tmpFile.Name())
+	fmt.Printf("[%s] 加密文件完成: %s\n", utu.taskInfo.Id(), utu.plainFile.Path)
+	return nil
+}
+
 // prepareFile 解析文件阶段
 func (utu *UploadTaskUnit) prepareFile() {
 	// 解析文件保存路径
@@ -163,7 +218,11 @@ func (utu *UploadTaskUnit) rapidUpload() (isContinue bool, result *taskframework
 			return false, result
 		}
 	} else {
-		fmt.Printf("[%s] 秒传失败，开始正常上传文件\n", utu.taskInfo.Id())
+		if utu.UploadMode == UploadModeRapid {
+			fmt.Printf("[%s] 秒传失败，网盘中不存在该文件\n", utu.taskInfo.Id())
+		} else {
+			fmt.Printf("[%s] 秒传失败，开始正常上传文件\n", utu.taskInfo.Id())
+		}
 		result.Succeed = false
 		result.ResultMessage = "文件未曾上传，无法秒传"
 		return true, result
@@ -185,9 +244,10 @@ func (utu *UploadTaskUnit) upload() (result *taskframework.TaskUnitRunResult) {
 	muer := uploader.NewMultiUploader(utu.LocalFileChecksum.FileUploadUrl, utu.LocalFileChecksum.FileCommitUrl, utu.LocalFileChecksum.UploadFileId, utu.LocalFileChecksum.XRequestId,
 		NewPanUpload(utu.PanClient, utu.SavePath, utu.LocalFileChecksum.FileUploadUrl, utu.LocalFileChecksum.FileCommitUrl, utu.LocalFileChecksum.UploadFileId, utu.LocalFileChecksum.XRequestId, utu.FamilyId),
 		rio.NewFileReaderAtLen64(utu.LocalFileChecksum.GetFile()), &uploader.MultiUploaderConfig{
-			Parallel:  utu.Parallel,
-			BlockSize: blockSize,
-			MaxRate:   config.Config.MaxUploadRate,
+			Parallel:     utu.Parallel,
+			BlockSize:    blockSize,
+			MaxRate:      config.Config.MaxUploadRate,
+			RateSchedule: uploadRateSchedule(),
 		})
 
 	// 设置断点续传
@@ -195,6 +255,10 @@ func (utu *UploadTaskUnit) upload() (result *taskframework.TaskUnitRunResult) {
 		muer.SetInstanceState(utu.state)
 	}
 
+	if utu.PrintFormat == "" {
+		utu.PrintFormat = DefaultPrintFormat
+	}
+	progressRenderer := downloader.NewProgressRenderer(downloader.StyleSimple, utu.PrintFormat)
 	muer.OnUploadStatusEvent(func(status uploader.Status, updateChan <-chan struct{}) {
 		select {
 		case <-updateChan:
@@ -203,13 +267,18 @@ func (utu *UploadTaskUnit) upload() (result *taskframework.TaskUnitRunResult) {
 		default:
 		}
 
+		if utu.OnUploadStatus != nil {
+			utu.OnUploadStatus(utu.taskInfo.Id(), status)
+		}
 		if utu.ShowProgress {
-			fmt.Printf("\r[%s] ↑ %s/%s %s/s in %s ............", utu.taskInfo.Id(),
-				converter.ConvertFileSize(status.Uploaded(), 2),
-				converter.ConvertFileSize(status.TotalSize(), 2),
-				converter.ConvertFileSize(status.SpeedsPerSecond(), 2),
-				status.TimeElapsed(),
-			)
+			progressRenderer.Render(os.Stdout, &downloader.ProgressInfo{
+				TaskId:          utu.taskInfo.Id(),
+				Downloaded:      status.Uploaded(),
+				TotalSize:       status.TotalSize(),
+				SpeedsPerSecond: status.SpeedsPerSecond(),
+				Elapsed:         status.TimeElapsed(),
+				Left:            status.TimeLeft(),
+			})
 		}
 	})
 
@@ -251,6 +320,7 @@ func (utu *UploadTaskUnit) upload() (result *taskframework.TaskUnitRunResult) {
 }
 
 func (utu *UploadTaskUnit) OnRetry(lastRunResult *taskframework.TaskUnitRunResult) {
+	utu.retrying = true
 	// 输出错误信息
 	if lastRunResult.Err == nil {
 		// result中不包含Err, 忽略输出
@@ -261,6 +331,18 @@ func (utu *UploadTaskUnit) OnRetry(lastRunResult *taskframework.TaskUnitRunResul
 }
 
 func (utu *UploadTaskUnit) OnSuccess(lastRunResult *taskframework.TaskUnitRunResult) {
+	// 无需上传的文件不调用 webhook
+	if lastRunResult != ResultLocalFileNotUpdated && lastRunResult != ResultUpdateLocalDatabase {
+		utu.finished = true
+		utu.notifyWebhook(nil)
+	}
+
+	if len(utu.Tags) > 0 {
+		if err := utu.uploadTags(); err != nil {
+			fmt.Printf("[%s] 警告: 保存文件标签失败: %s, %s\n", utu.taskInfo.Id(), utu.SavePath, err)
+		}
+	}
+
 	//文件上传成功
 	if utu.FolderSyncDb == nil || lastRunResult == ResultLocalFileNotUpdated { //不需要更新数据库
 		return
@@ -270,6 +352,11 @@ func (utu *UploadTaskUnit) OnSuccess(lastRunResult *taskframework.TaskUnitRunRes
 		ModTime: utu.LocalFileChecksum.ModTime,
 		Size:    utu.LocalFileChecksum.Length,
 	}
+	if utu.plainFile != nil {
+		// 备份时按原始文件的大小和修改时间判断文件是否有更新
+		ufm.ModTime = utu.plainFile.ModTime
+		ufm.Size = utu.plainFile.Length
+	}
 	switch ufo := lastRunResult.Extra.(type) {
 	case *cloudpan.AppUploadFileCommitResult:
 		ufm.FileID = ufo.Id
@@ -292,13 +379,65 @@ func (utu *UploadTaskUnit) OnSuccess(lastRunResult *taskframework.TaskUnitRunRes
 
 func (utu *UploadTaskUnit) OnFailed(lastRunResult *taskframework.TaskUnitRunResult) {
 	// 失败
+	err := lastRunResult.Err
+	if err == nil {
+		err = errors.New(lastRunResult.ResultMessage)
+	}
+	utu.finished = true
+	utu.notifyWebhook(err)
+}
+
+// notifyWebhook 文件上传结束后调用 webhook, err 为 nil 代表上传成功
+func (utu *UploadTaskUnit) notifyWebhook(err error) {
+	if !utu.Webhook.Enabled(err == nil) {
+		return
+	}
+	localPath, size, elapsed := utu.localPathSizeAndElapsed()
+	utu.Webhook.Notify(functions.NewWebhookPayload(functions.WebhookTypeUpload, utu.taskInfo.Id(), utu.SavePath, localPath, size, elapsed, err))
+}
+
+// localPathSizeAndElapsed 返回本地文件路径, 文件大小和上传耗时, 启用加密时为加密前的文件
+func (utu *UploadTaskUnit) localPathSizeAndElapsed() (localPath string, size int64, elapsed time.Duration) {
+	if !utu.startedAt.IsZero() {
+		elapsed = time.Since(utu.startedAt)
+	}
+	localPath, size = utu.LocalFileChecksum.Path, utu.LocalFileChecksum.Length
+	if utu.plainFile != nil {
+		localPath, size = utu.plainFile.Path, utu.plainFile.Length
+	}
+	return
 }
 
 var ResultLocalFileNotUpdated = &taskframework.TaskUnitRunResult{ResultCode: 1, Succeed: true, ResultMessage: "本地文件未更新，无需上传！"}
 var ResultUpdateLocalDatabase = &taskframework.TaskUnitRunResult{ResultCode: 2, Succeed: true, ResultMessage: "本地文件和云端文件MD5一致，无需上传！"}
 
 func (utu *UploadTaskUnit) OnComplete(lastRunResult *taskframework.TaskUnitRunResult) {
+	// 上传成功或最终失败时记录历史, 重试时不记录
+	if utu.finished {
+		utu.finished = false
+		var err error
+		if !lastRunResult.Succeed {
+			err = lastRunResult.Err
+			if err == nil {
+				err = errors.New(lastRunResult.ResultMessage)
+			}
+		}
+		localPath, size, elapsed := utu.localPathSizeAndElapsed()
+		history.Append(history.NewRecord(history.OperationUpload, utu.SavePath, localPath, size, elapsed, err))
+	}
 
+	// 重试时继续使用已加密的临时文件
+	if utu.retrying {
+		utu.retrying = false
+		return
+	}
+
+	if utu.plainFile != nil {
+		// 任务结束, 删除加密的临时文件, 再次运行时重新加密
+		os.Remove(utu.LocalFileChecksum.Path)
+		utu.LocalFileChecksum = utu.plainFile
+		utu.plainFile = nil
+	}
 }
 
 func (utu *UploadTaskUnit) RetryWait() time.Duration {
@@ -307,7 +446,13 @@ func (utu *UploadTaskUnit) RetryWait() time.Duration {
 
 func (utu *UploadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
 
-	err := utu.LocalFileChecksum.OpenPath()
+	err := utu.encryptFile()
+	if err != nil {
+		fmt.Printf("[%s] 加密文件失败, 错误信息: %s, 跳过...\n", utu.taskInfo.Id(), err)
+		return
+	}
+
+	err = utu.LocalFileChecksum.OpenPath()
 	if err != nil {
 		fmt.Printf("[%s] 文件不可读, 错误信息: %s, 跳过...\n", utu.taskInfo.Id(), err)
 		return
@@ -315,6 +460,9 @@ func (utu *UploadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
 	defer utu.LocalFileChecksum.Close() // 关闭文件
 
 	timeStart := time.Now()
+	if utu.startedAt.IsZero() {
+		utu.startedAt = timeStart
+	}
 	result = &taskframework.TaskUnitRunResult{}
 
 	fmt.Printf("[%s] 准备上传: %s=>%s\n", utu.taskInfo.Id(), utu.LocalFileChecksum.Path, utu.SavePath)
@@ -355,8 +503,28 @@ StepUploadPrepareUpload:
 	if utu.FolderSyncDb != nil {
 		//启用了备份功能，强制使用覆盖同名文件功能
 		utu.IsOverwrite = true
+		utu.ConflictStrategy = ConflictStrategyOverwrite
 		testFileMeta = utu.FolderSyncDb.Get(utu.SavePath)
 	}
+	if utu.OnlyNewer {
+		efi, newer, err := checkLocalNewer(&panConflictClient{utu: utu}, utu.SavePath, utu.localModTime())
+		if err != nil {
+			result.Err = err
+			result.ResultMessage = "获取网盘文件信息失败"
+			return
+		}
+		if !newer {
+			fmt.Printf("[%s] 网盘中的文件不比本地文件旧, 跳过: %s\n", utu.taskInfo.Id(), utu.SavePath)
+			result.Succeed = true
+			result.Extra = efi
+			return
+		}
+		if efi != nil && utu.ConflictStrategy == "" {
+			// 本地文件更新, 覆盖网盘中的文件
+			utu.ConflictStrategy = ConflictStrategyOverwrite
+		}
+	}
+
 	// 创建上传任务
 	utu.LocalFileChecksum.Sum(localfile.CHECKSUM_MD5)
 
@@ -392,54 +560,46 @@ StepUploadPrepareUpload:
 	time.Sleep(time.Duration(2) * time.Second)
 	utu.FolderCreateMutex.Unlock()
 
-	if utu.IsOverwrite {
-		// 标记覆盖旧同名文件
-		// 检查同名文件是否存在
-		efi, apierr := utu.PanClient.AppFileInfoByPath(utu.FamilyId, utu.SavePath)
-		if apierr != nil && apierr.Code != apierror.ApiCodeFileNotFoundCode {
-			result.Err = apierr
-			result.ResultMessage = "检测同名文件失败"
+	if utu.ConflictStrategy == "" && utu.IsOverwrite {
+		utu.ConflictStrategy = ConflictStrategyOverwrite
+	}
+	if utu.UploadMode == UploadModeRapid && utu.ConflictStrategy == ConflictStrategyOverwrite {
+		// 只使用秒传时, 秒传可能失败, 先保存为临时文件名, 秒传成功后再删除同名文件
+		tmpSavePath, efi, skip, err := resolveRapidOverwrite(&panConflictClient{utu: utu}, utu.SavePath, utu.LocalFileChecksum.MD5, time.Now())
+		if err != nil {
+			result.Err = err
+			result.ResultMessage = "处理同名文件失败"
 			return
 		}
-		if efi != nil && efi.FileId != "" {
-			if efi.FileMd5 == strings.ToUpper(utu.LocalFileChecksum.MD5) {
-				result.Succeed = true
-				result.Extra = efi
-				return
-			}
-			// existed, delete it
-			infoList := cloudpan.BatchTaskInfoList{}
-			isFolder := 0
-			if efi.IsFolder {
-				isFolder = 1
-			}
-			infoItem := &cloudpan.BatchTaskInfo{
-				FileId:      efi.FileId,
-				FileName:    efi.FileName,
-				IsFolder:    isFolder,
-				SrcParentId: efi.ParentId,
-			}
-			infoList = append(infoList, infoItem)
-			delParam := &cloudpan.BatchTaskParam{
-				TypeFlag:  cloudpan.BatchTaskTypeDelete,
-				TaskInfos: infoList,
-			}
-
-			var taskId string
-			var err *apierror.ApiError
-			if utu.FamilyId > 0 {
-				taskId, err = utu.PanClient.AppCreateBatchTask(utu.FamilyId, delParam)
-			} else {
-				taskId, err = utu.PanClient.CreateBatchTask(delParam)
-			}
-
-			if err != nil || taskId == "" {
-				result.Err = err
-				result.ResultMessage = "无法删除文件，请稍后重试"
-				return
+		if skip {
+			result.Succeed = true
+			result.Extra = efi
+			return
+		}
+		if efi != nil {
+			utu.replaceFile = efi
+			utu.replaceSavePath = utu.SavePath
+			utu.SavePath = tmpSavePath
+		}
+	} else if utu.ConflictStrategy != "" {
+		savePath, efi, skip, err := resolveConflict(&panConflictClient{utu: utu}, utu.ConflictStrategy, utu.SavePath, utu.LocalFileChecksum.MD5, time.Now())
+		if err != nil {
+			result.Err = err
+			result.ResultMessage = "处理同名文件失败"
+			return
+		}
+		if skip {
+			if utu.ConflictStrategy == ConflictStrategySkip {
+				fmt.Printf("[%s] 网盘中已存在同名文件, 跳过: %s\n", utu.taskInfo.Id(), utu.SavePath)
 			}
-			time.Sleep(time.Duration(500) * time.Millisecond)
-			logger.Verbosef("[%s] 检测到同名文件，已移动到回收站: %s", utu.taskInfo.Id(), utu.SavePath)
+			result.Succeed = true
+			result.Extra = efi
+			return
+		}
+		if savePath != utu.SavePath {
+			fmt.Printf("[%s] 网盘中已存在同名文件, 重命名为: %s\n", utu.taskInfo.Id(), savePath)
+			utu.SavePath = savePath
+			utu.panFile = path.Base(savePath)
 		}
 	}
 
@@ -450,7 +610,7 @@ StepUploadPrepareUpload:
 
 	appCreateUploadFileParam = &cloudpan.AppCreateUploadFileParam{
 		ParentFolderId: rs.FileId,
-		FileName:       filepath.Base(utu.LocalFileChecksum.Path),
+		FileName:       path.Base(utu.SavePath),
 		Size:           utu.LocalFileChecksum.Length,
 		Md5:            md5Str,
 		LastWrite:      time.Unix(utu.LocalFileChecksum.ModTime, 0).Format("2006-01-02 15:04:05"),
@@ -480,14 +640,253 @@ stepUploadRapidUpload:
 	if !utu.NoRapidUpload {
 		isContinue, rapidUploadResult := utu.rapidUpload()
 		if !isContinue {
+			// 秒传成功, 删除被覆盖的同名文件
+			if utu.replaceFile != nil {
+				ret, _ := rapidUploadResult.Extra.(*cloudpan.AppUploadFileCommitResult)
+				if ret == nil || ret.Id == "" {
+					rapidUploadResult.Succeed = false
+					rapidUploadResult.Err = errors.New("秒传结果中没有文件ID")
+					rapidUploadResult.ResultMessage = "覆盖同名文件失败, 文件保存为: " + utu.SavePath
+					return rapidUploadResult
+				}
+				err := replaceAfterCommit(&panConflictClient{utu: utu}, utu.replaceFile, ret.Id, path.Base(utu.replaceSavePath))
+				if err != nil {
+					rapidUploadResult.Succeed = false
+					rapidUploadResult.Err = err
+					rapidUploadResult.ResultMessage = "覆盖同名文件失败, 文件保存为: " + utu.SavePath
+					return rapidUploadResult
+				}
+				utu.SavePath = utu.replaceSavePath
+				utu.panFile = path.Base(utu.SavePath)
+				utu.replaceFile = nil
+			}
 			// 秒传成功, 返回秒传的结果
 			return rapidUploadResult
 		}
+		if utu.UploadMode == UploadModeRapid {
+			// 只使用秒传, 不上传文件数据, 文件未曾上传时无需重试
+			rapidUploadResult.NeedRetry = rapidUploadResult.Err != nil
+			return rapidUploadResult
+		}
 	}
 
 stepUploadUpload:
+	if utu.UploadMode == UploadModeRapid {
+		result.ResultMessage = "只使用秒传, 跳过上传文件数据"
+		return
+	}
+
 	// 正常上传流程
 	uploadResult := utu.upload()
 
 	return uploadResult
 }
+
+// ConflictStrategy 网盘中已存在同名文件时的处理策略
+type ConflictStrategy string
+
+const (
+	// ConflictStrategySkip 跳过上传, 保留网盘中的文件
+	ConflictStrategySkip ConflictStrategy = "skip"
+	// ConflictStrategyOverwrite 先将网盘中的文件移到回收站, 再上传
+	ConflictStrategyOverwrite ConflictStrategy = "overwrite"
+	// ConflictStrategyRenameWithTimestamp 文件名加上时间戳后上传, 如 file_20060102150405.txt
+	ConflictStrategyRenameWithTimestamp ConflictStrategy = "rename-with-timestamp"
+	// ConflictStrategyRenameWithSequence 文件名加上序号后上传, 如 file_1.txt, 序号从1开始递增直到不存在同名文件
+	ConflictStrategyRenameWithSequence ConflictStrategy = "rename-with-sequence"
+
+	// maxConflictSequence rename-with-sequence 尝试的最大序号
+	maxConflictSequence = 1000
+)
+
+// ParseConflictStrategy 解析同名文件处理策略
+func ParseConflictStrategy(s string) (ConflictStrategy, error) {
+	switch cs := ConflictStrategy(strings.ToLower(s)); cs {
+	case ConflictStrategySkip, ConflictStrategyOverwrite, ConflictStrategyRenameWithTimestamp, ConflictStrategyRenameWithSequence:
+		return cs, nil
+	}
+	return "", fmt.Errorf("不支持的同名文件处理策略: %s, 可选值: skip, overwrite, rename-with-timestamp, rename-with-sequence", s)
+}
+
+// conflictClient 处理同名文件所需的网盘接口
+type conflictClient interface {
+	// FileInfoByPath 获取网盘文件信息, 文件不存在时返回 nil
+	FileInfoByPath(panPath string) (*cloudpan.AppFileEntity, error)
+	// Delete 将网盘文件移到回收站
+	Delete(efi *cloudpan.AppFileEntity) error
+	// Rename 重命名网盘文件
+	Rename(fileId, newName string) error
+}
+
+type panConflictClient struct {
+	utu *UploadTaskUnit
+}
+
+func (pc *panConflictClient) FileInfoByPath(panPath string) (*cloudpan.AppFileEntity, error) {
+	efi, apierr := pc.utu.PanClient.AppFileInfoByPath(pc.utu.FamilyId, panPath)
+	if apierr != nil {
+		if apierr.Code == apierror.ApiCodeFileNotFoundCode {
+			return nil, nil
+		}
+		return nil, apierr
+	}
+	if efi == nil || efi.FileId == "" {
+		return nil, nil
+	}
+	return efi, nil
+}
+
+func (pc *panConflictClient) Delete(efi *cloudpan.AppFileEntity) error {
+	isFolder := 0
+	if efi.IsFolder {
+		isFolder = 1
+	}
+	delParam := &cloudpan.BatchTaskParam{
+		TypeFlag: cloudpan.BatchTaskTypeDelete,
+		TaskInfos: cloudpan.BatchTaskInfoList{
+			&cloudpan.BatchTaskInfo{
+				FileId:      efi.FileId,
+				FileName:    efi.FileName,
+				IsFolder:    isFolder,
+				SrcParentId: efi.ParentId,
+			},
+		},
+	}
+
+	var taskId string
+	var apierr *apierror.ApiError
+	if pc.utu.FamilyId > 0 {
+		taskId, apierr = pc.utu.PanClient.AppCreateBatchTask(pc.utu.FamilyId, delParam)
+	} else {
+		taskId, apierr = pc.utu.PanClient.CreateBatchTask(delParam)
+	}
+	if apierr != nil {
+		return apierr
+	}
+	if taskId == "" {
+		return errors.New("无法删除文件，请稍后重试")
+	}
+	time.Sleep(time.Duration(500) * time.Millisecond)
+	logger.Verbosef("[%s] 检测到同名文件，已移动到回收站: %s", pc.utu.taskInfo.Id(), path.Join(pc.utu.panDir, efi.FileName))
+	return nil
+}
+
+func (pc *panConflictClient) Rename(fileId, newName string) error {
+	var apierr *apierror.ApiError
+	if pc.utu.FamilyId > 0 {
+		_, apierr = pc.utu.PanClient.AppFamilyRenameFile(pc.utu.FamilyId, fileId, newName)
+	} else {
+		_, apierr = pc.utu.PanClient.AppRenameFile(fileId, newName)
+	}
+	if apierr != nil {
+		return apierr
+	}
+	return nil
+}
+
+// localModTime 本地文件的修改时间, 启用加密时为加密前的文件的修改时间
+func (utu *UploadTaskUnit) localModTime() int64 {
+	if utu.plainFile != nil {
+		return utu.plainFile.ModTime
+	}
+	return utu.LocalFileChecksum.ModTime
+}
+
+// checkLocalNewer 检查本地文件是否比网盘中的同名文件新, 网盘中不存在该文件或为目录时视为更新.
+// 网盘文件的修改时间无法解析时也视为更新, 宁可重复上传也不漏传
+func checkLocalNewer(client conflictClient, savePath string, localModTime int64) (existed *cloudpan.AppFileEntity, newer bool, err error) {
+	efi, err := client.FileInfoByPath(savePath)
+	if err != nil {
+		return nil, false, err
+	}
+	if efi == nil || efi.IsFolder {
+		return nil, true, nil
+	}
+	remoteModTime, err := time.ParseInLocation("2006-01-02 15:04:05", efi.LastOpTime, time.Local)
+	if err != nil {
+		return efi, true, nil
+	}
+	return efi, localModTime > remoteModTime.Unix(), nil
+}
+
+// conflictRename 在文件名和扩展名之间插入 suffix, 加密文件的 .enc 后缀保持在最后
+func conflictRename(savePath, suffix string) string {
+	dir, name := path.Split(savePath)
+	encSuffix := ""
+	if strings.HasSuffix(name, crypto.GCMEncryptedSuffix) && name != crypto.GCMEncryptedSuffix {
+		name = strings.TrimSuffix(name, crypto.GCMEncryptedSuffix)
+		encSuffix = crypto.GCMEncryptedSuffix
+	}
+	ext := path.Ext(name)
+	if ext == name {
+		// 以 . 开头且没有其他扩展名的文件, 如 .bashrc
+		ext = ""
+	}
+	return dir + strings.TrimSuffix(name, ext) + suffix + ext + encSuffix
+}
+
+// resolveConflict 按照 strategy 处理网盘中的同名文件, 返回实际上传的网盘路径.
+// skip 为 true 时无需上传, existed 为网盘中已存在的文件
+func resolveConflict(client conflictClient, strategy ConflictStrategy, savePath, md5 string, now time.Time) (newSavePath string, existed *cloudpan.AppFileEntity, skip bool, err error) {
+	efi, err := client.FileInfoByPath(savePath)
+	if err != nil {
+		return "", nil, false, err
+	}
+	if efi == nil {
+		return savePath, nil, false, nil
+	}
+
+	switch strategy {
+	case ConflictStrategySkip:
+		return savePath, efi, true, nil
+	case ConflictStrategyOverwrite:
+		if efi.FileMd5 == strings.ToUpper(md5) {
+			// 文件内容相同, 无需重新上传
+			return savePath, efi, true, nil
+		}
+		if err = client.Delete(efi); err != nil {
+			return "", nil, false, err
+		}
+		return savePath, nil, false, nil
+	case ConflictStrategyRenameWithTimestamp:
+		return conflictRename(savePath, "_"+now.Format("20060102150405")), nil, false, nil
+	case ConflictStrategyRenameWithSequence:
+		for i := 1; i <= maxConflictSequence; i++ {
+			candidate := conflictRename(savePath, fmt.Sprintf("_%d", i))
+			efi, err = client.FileInfoByPath(candidate)
+			if err != nil {
+				return "", nil, false, err
+			}
+			if efi == nil {
+				return candidate, nil, false, nil
+			}
+		}
+		return "", nil, false, fmt.Errorf("同名文件过多, 序号已超过 %d", maxConflictSequence)
+	}
+	return savePath, nil, false, nil
+}
+
+// resolveRapidOverwrite 只使用秒传并覆盖同名文件时, 检测网盘中的同名文件, 不删除.
+// 存在内容不同的同名文件时, 返回秒传使用的临时路径和同名文件, 秒传成功后再调用 replaceAfterCommit 覆盖
+func resolveRapidOverwrite(client conflictClient, savePath, md5 string, now time.Time) (tmpSavePath string, existed *cloudpan.AppFileEntity, skip bool, err error) {
+	efi, err := client.FileInfoByPath(savePath)
+	if err != nil {
+		return "", nil, false, err
+	}
+	if efi == nil {
+		return savePath, nil, false, nil
+	}
+	if efi.FileMd5 == strings.ToUpper(md5) {
+		// 文件内容相同, 无需重新上传
+		return savePath, efi, true, nil
+	}
+	return conflictRename(savePath, "_rapid"+now.Format("20060102150405")), efi, false, nil
+}
+
+// replaceAfterCommit 秒传成功后, 将同名文件移到回收站, 再把秒传的文件重命名为 name
+func replaceAfterCommit(client conflictClient, existed *cloudpan.AppFileEntity, committedFileId, name string) error {
+	if err := client.Delete(existed); err != nil {
+		return err
+	}
+	return client.Rename(committedFileId, name)
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctpango/internal/localfile"
+	"github.com/phpc0de/ctpango/internal/taskframework"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mockConflictClient 模拟网盘中已存在的文件
+type mockConflictClient struct {
+	files   map[string]*cloudpan.AppFileEntity
+	deleted []string
+	renamed []string
+}
+
+func (mc *mockConflictClient) FileInfoByPath(panPath string) (*cloudpan.AppFileEntity, error) {
+	return mc.files[panPath], nil
+}
+
+func (mc *mockConflictClient) Delete(efi *cloudpan.AppFileEntity) error {
+	mc.deleted = append(mc.deleted, efi.FileId)
+	return nil
+}
+
+func (mc *mockConflictClient) Rename(fileId, newName string) error {
+	mc.renamed = append(mc.renamed, fileId+":"+newName)
+	return nil
+}
+
+func newMockConflictClient() *mockConflictClient {
+	return &mockConflictClient{
+		files: map[string]*cloudpan.AppFileEntity{
+			"/视频/1.mp4":   {FileId: "1", FileName: "1.mp4", FileMd5: "AAAA"},
+			"/视频/1_1.mp4": {FileId: "2", FileName: "1_1.mp4", FileMd5: "BBBB"},
+		},
+	}
+}
+
+func TestResolveConflict(t *testing.T) {
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.Local)
+
+	// 不存在同名文件
+	for _, cs := range []ConflictStrategy{ConflictStrategySkip, ConflictStrategyOverwrite, ConflictStrategyRenameWithTimestamp, ConflictStrategyRenameWithSequence} {
+		mc := newMockConflictClient()
+		p, _, skip, err := resolveConflict(mc, cs, "/视频/2.mp4", "cccc", now)
+		if err != nil || skip || p != "/视频/2.mp4" || len(mc.deleted) != 0 {
+			t.Fatalf("%s: got %s, %v, %v, %v", cs, p, skip, err, mc.deleted)
+		}
+	}
+
+	// skip
+	mc := newMockConflictClient()
+	p, efi, skip, err := resolveConflict(mc, ConflictStrategySkip, "/视频/1.mp4", "cccc", now)
+	if err != nil || !skip || efi == nil || efi.FileId != "1" || len(mc.deleted) != 0 {
+		t.Fatalf("skip: got %s, %v, %v, %v", p, skip, err, mc.deleted)
+	}
+
+	// overwrite, 文件内容不同
+	mc = newMockConflictClient()
+	p, _, skip, err = resolveConflict(mc, ConflictStrategyOverwrite, "/视频/1.mp4", "cccc", now)
+	if err != nil || skip || p != "/视频/1.mp4" || len(mc.deleted) != 1 || mc.deleted[0] != "1" {
+		t.Fatalf("overwrite: got %s, %v, %v, %v", p, skip, err, mc.deleted)
+	}
+
+	// overwrite, 文件内容相同
+	mc = newMockConflictClient()
+	p, efi, skip, err = resolveConflict(mc, ConflictStrategyOverwrite, "/视频/1.mp4", "aaaa", now)
+	if err != nil || !skip || efi == nil || len(mc.deleted) != 0 {
+		t.Fatalf("overwrite same md5: got %s, %v, %v, %v", p, skip, err, mc.deleted)
+	}
+
+	// rename-with-timestamp
+	mc = newMockConflictClient()
+	p, _, skip, err = resolveConflict(mc, ConflictStrategyRenameWithTimestamp, "/视频/1.mp4", "cccc", now)
+	if err != nil || skip || p != "/视频/1_20210304050607.mp4" || len(mc.deleted) != 0 {
+		t.Fatalf("rename-with-timestamp: got %s, %v, %v, %v", p, skip, err, mc.deleted)
+	}
+
+	// rename-with-sequence, 1_1.mp4 也已存在
+	mc = newMockConflictClient()
+	p, _, skip, err = resolveConflict(mc, ConflictStrategyRenameWithSequence, "/视频/1.mp4", "cccc", now)
+	if err != nil || skip || p != "/视频/1_2.mp4" || len(mc.deleted) != 0 {
+		t.Fatalf("rename-with-sequence: got %s, %v, %v, %v", p, skip, err, mc.deleted)
+	}
+}
+
+func TestResolveRapidOverwrite(t *testing.T) {
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.Local)
+
+	// 不存在同名文件
+	mc := newMockConflictClient()
+	p, efi, skip, err := resolveRapidOverwrite(mc, "/视频/2.mp4", "cccc", now)
+	if err != nil || skip || efi != nil || p != "/视频/2.mp4" {
+		t.Fatalf("not exists: got %s, %v, %v, %v", p, efi, skip, err)
+	}
+
+	// 文件内容相同
+	p, efi, skip, err = resolveRapidOverwrite(mc, "/视频/1.mp4", "aaaa", now)
+	if err != nil || !skip || efi == nil {
+		t.Fatalf("same md5: got %s, %v, %v, %v", p, efi, skip, err)
+	}
+
+	// 文件内容不同, 秒传前不删除同名文件
+	p, efi, skip, err = resolveRapidOverwrite(mc, "/视频/1.mp4", "cccc", now)
+	if err != nil || skip || efi == nil || efi.FileId != "1" || p != "/视频/1_rapid20210304050607.mp4" {
+		t.Fatalf("overwrite: got %s, %v, %v, %v", p, efi, skip, err)
+	}
+	if len(mc.deleted) != 0 {
+		t.Fatalf("deleted before rapid upload: %v", mc.deleted)
+	}
+
+	// 秒传成功后删除同名文件, 再重命名
+	if err = replaceAfterCommit(mc, efi, "3", "1.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if len(mc.deleted) != 1 || mc.deleted[0] != "1" || len(mc.renamed) != 1 || mc.renamed[0] != "3:1.mp4" {
+		t.Fatalf("replace: deleted %v, renamed %v", mc.deleted, mc.renamed)
+	}
+}
+
+func TestConflictRename(t *testing.T) {
+	cases := map[string]string{
+		"/视频/1.mp4":     "/视频/1_1.mp4",
+		"/视频/1.mp4.enc": "/视频/1_1.mp4.enc",
+		"/视频/README":    "/视频/README_1",
+		"/.bashrc":      "/.bashrc_1",
+	}
+	for savePath, expect := range cases {
+		if p := conflictRename(savePath, "_1"); p != expect {
+			t.Fatalf("%s: got %s, want %s", savePath, p, expect)
+		}
+	}
+
+	if _, err := ParseConflictStrategy("Rename-With-Sequence"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseConflictStrategy("rename"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestCheckLocalNewer(t *testing.T) {
+	remote := time.Date(2021, 3, 4, 5, 6, 7, 0, time.Local)
+	mc := &mockConflictClient{
+		files: map[string]*cloudpan.AppFileEntity{
+			"/备份/1.txt":   {FileId: "1", FileName: "1.txt", LastOpTime: remote.Format("2006-01-02 15:04:05")},
+			"/备份/dir":     {FileId: "2", FileName: "dir", IsFolder: true},
+			"/备份/bad.txt": {FileId: "3", FileName: "bad.txt", LastOpTime: "-"},
+		},
+	}
+
+	testCases := []struct {
+		savePath     string
+		localModTime int64
+		newer        bool
+		existed      bool
+	}{
+		{"/备份/1.txt", remote.Unix() + 1, true, true},
+		{"/备份/1.txt", remote.Unix(), false, true},
+		{"/备份/1.txt", remote.Unix() - 3600, false, true},
+		{"/备份/2.txt", 0, true, false},  // 网盘中不存在
+		{"/备份/dir", 0, true, false},    // 同名的是目录
+		{"/备份/bad.txt", 0, true, true}, // 时间无法解析
+	}
+	for _, tc := range testCases {
+		efi, newer, err := checkLocalNewer(mc, tc.savePath, tc.localModTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if newer != tc.newer || (efi != nil) != tc.existed {
+			t.Errorf("%s, %d: got newer %v, existed %v", tc.savePath, tc.localModTime, newer, efi != nil)
+		}
+	}
+}
+
+func TestEncryptedTempFileKeptOnRetry(t *testing.T) {
+	plainPath := filepath.Join(t.TempDir(), "1.txt")
+	if err := ioutil.WriteFile(plainPath, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	utu := &UploadTaskUnit{
+		LocalFileChecksum: localfile.NewLocalFileEntity(plainPath),
+		EncryptKey:        make([]byte, 32),
+	}
+	utu.SetTaskInfo(&taskframework.TaskInfo{})
+	if err := utu.encryptFile(); err != nil {
+		t.Fatal(err)
+	}
+	encPath := utu.LocalFileChecksum.Path
+
+	// 重试时保留加密的临时文件
+	result := &taskframework.TaskUnitRunResult{ResultMessage: "上传失败", NeedRetry: true}
+	utu.OnRetry(result)
+	utu.OnComplete(result)
+	if _, err := os.Stat(encPath); err != nil {
+		t.Fatalf("temp file removed on retry: %s", err)
+	}
+
+	// 任务结束后删除
+	utu.OnComplete(nil)
+	if _, err := os.Stat(encPath); !os.IsNotExist(err) {
+		t.Fatalf("temp file not removed: %v", err)
+	}
+	if utu.LocalFileChecksum.Path != plainPath || utu.plainFile != nil {
+		t.Fatalf("plain file not restored: %s", utu.LocalFileChecksum.Path)
+	}
+}
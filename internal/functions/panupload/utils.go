@@ -14,6 +14,9 @@
 package panupload
 
 import (
+	"strings"
+	"time"
+
 	"github.com/phpc0de/ctpango/internal/config"
 	"github.com/phpc0de/ctlibgo/converter"
 	"github.com/phpc0de/ctlibgo/logger"
@@ -30,14 +33,49 @@ const (
 	UploadingFileName = "cloud189_uploading.json"
 )
 
+const (
+	// UploadModeAuto 先检测秒传, 秒传失败再正常上传
+	UploadModeAuto = "auto"
+	// UploadModeRapid 只使用秒传, 网盘中不存在该文件则上传失败
+	UploadModeRapid = "rapid"
+	// UploadModeMultipart 不检测秒传, 直接正常上传
+	UploadModeMultipart = "multipart"
+)
+
 var (
 	cmdUploadVerbose = logger.New("CLOUD189_UPLOAD", config.EnvVerbose)
 )
 
+// getBlockSize 返回上传分片大小, 分片数量不超过999, 分片大小在 MinUploadBlockSize 和 MaxUploadBlockSize 之间
 func getBlockSize(fileSize int64) int64 {
-	blockNum := fileSize / MinUploadBlockSize
+	blockNum := (fileSize + MinUploadBlockSize - 1) / MinUploadBlockSize
 	if blockNum > 999 {
-		return fileSize/999 + 1
+		blockSize := fileSize/999 + 1
+		if blockSize > MaxUploadBlockSize {
+			return MaxUploadBlockSize
+		}
+		return blockSize
 	}
 	return MinUploadBlockSize
 }
+
+// uploadRateSchedule 返回按时间段限速的函数, 没有设置限速计划时返回nil
+func uploadRateSchedule() func(now time.Time) int64 {
+	rs := config.Config.RateSchedule
+	if len(rs) == 0 {
+		return nil
+	}
+	maxRate := config.Config.MaxUploadRate
+	return func(now time.Time) int64 {
+		return rs.RateAt(now, maxRate)
+	}
+}
+
+// IsUploadModeSupported 是否支持该上传模式
+func IsUploadModeSupported(mode string) bool {
+	switch strings.ToLower(mode) {
+	case UploadModeAuto, UploadModeRapid, UploadModeMultipart:
+		return true
+	}
+	return false
+}
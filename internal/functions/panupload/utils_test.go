@@ -0,0 +1,65 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/phpc0de/ctlibgo/converter"
+	"github.com/phpc0de/ctpango/internal/file/uploader"
+)
+
+func TestGetBlockSizeLargeFile(t *testing.T) {
+	// 稀疏文件, 不实际占用 3GB 磁盘空间
+	name := filepath.Join(t.TempDir(), "3GB.bin")
+	file, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err = file.Truncate(3 * converter.GB); err != nil {
+		t.Skipf("create 3GB file: %s", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileSize := info.Size()
+	blockSize := getBlockSize(fileSize)
+	if blockSize > MaxUploadBlockSize || blockSize < MinUploadBlockSize {
+		t.Fatalf("block size: %d", blockSize)
+	}
+	blockList := uploader.SplitBlock(fileSize, blockSize)
+	if len(blockList) > 999 {
+		t.Fatalf("parts: %d", len(blockList))
+	}
+	if last := blockList[len(blockList)-1]; last.Range.End != fileSize {
+		t.Fatalf("last part end: %d, file size: %d", last.Range.End, fileSize)
+	}
+}
+
+func TestGetBlockSizeMax(t *testing.T) {
+	for _, fileSize := range []int64{0, MinUploadBlockSize * 999, MinUploadBlockSize*999 + 1, 999 * MaxUploadBlockSize, 3 * converter.TB} {
+		blockSize := getBlockSize(fileSize)
+		if blockSize > MaxUploadBlockSize || blockSize < MinUploadBlockSize {
+			t.Errorf("file size: %d, block size: %d", fileSize, blockSize)
+		}
+		if fileSize <= 999*MaxUploadBlockSize && (fileSize+blockSize-1)/blockSize > 999 {
+			t.Errorf("file size: %d, block size: %d, parts > 999", fileSize, blockSize)
+		}
+	}
+}
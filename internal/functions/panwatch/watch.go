@@ -0,0 +1,154 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panwatch
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/phpc0de/ctlibgo/logger"
+)
+
+const (
+	EventCreate = "create"
+	EventWrite  = "write"
+	EventRename = "rename"
+	EventDelete = "delete"
+	EventChmod  = "chmod"
+)
+
+type (
+	// Event 文件系统事件日志, 每个事件输出一行JSON
+	Event struct {
+		Time  string `json:"time"`
+		Event string `json:"event"`
+		Path  string `json:"path"`
+		Size  int64  `json:"size"` // 文件大小, 文件不存在(已删除或重命名)或是目录时为0
+	}
+
+	// Logger 监控本地目录, 把所有文件系统事件以JSON格式写入 Out, 不上传任何文件
+	Logger struct {
+		Out     io.Writer
+		watcher *fsnotify.Watcher
+		encoder *json.Encoder
+	}
+)
+
+// opNames fsnotify 操作对应的事件名称, 一个 fsnotify 事件可能包含多个操作
+var opNames = []struct {
+	op   fsnotify.Op
+	name string
+}{
+	{fsnotify.Create, EventCreate},
+	{fsnotify.Write, EventWrite},
+	{fsnotify.Rename, EventRename},
+	{fsnotify.Remove, EventDelete},
+	{fsnotify.Chmod, EventChmod},
+}
+
+// NewEvents 把 fsnotify 事件转换为日志记录
+func NewEvents(ev fsnotify.Event, now time.Time) []*Event {
+	var size int64
+	if fi, err := os.Stat(ev.Name); err == nil && !fi.IsDir() {
+		size = fi.Size()
+	}
+
+	events := make([]*Event, 0, 1)
+	for _, o := range opNames {
+		if ev.Op&o.op == 0 {
+			continue
+		}
+		events = append(events, &Event{
+			Time:  now.Format(time.RFC3339),
+			Event: o.name,
+			Path:  ev.Name,
+			Size:  size,
+		})
+	}
+	return events
+}
+
+// NewLogger 创建 Logger
+func NewLogger(out io.Writer) (*Logger, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &Logger{
+		Out:     out,
+		watcher: watcher,
+		encoder: json.NewEncoder(out),
+	}, nil
+}
+
+// AddRecursive 监控 root 目录及其所有子目录, fsnotify 不支持递归监控, 需要逐个添加子目录
+func (l *Logger) AddRecursive(root string) error {
+	return filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			// 子目录可能已被删除或没有权限, 跳过
+			logger.Verbosef("watch: skip %s, %s\n", p, err)
+			return nil
+		}
+		if !fi.IsDir() {
+			return nil
+		}
+		return l.watcher.Add(p)
+	})
+}
+
+// Close 停止监控
+func (l *Logger) Close() error {
+	return l.watcher.Close()
+}
+
+// Run 开始输出事件, 直到 ctx 结束
+func (l *Logger) Run(ctx context.Context) error {
+	defer l.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-l.watcher.Events:
+			if !ok {
+				return nil
+			}
+			for _, e := range NewEvents(ev, time.Now()) {
+				if err := l.encoder.Encode(e); err != nil {
+					return err
+				}
+			}
+			if ev.Op&fsnotify.Create != 0 {
+				// 新建的目录也需要监控
+				if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+					if err = l.AddRecursive(ev.Name); err != nil {
+						logger.Verbosef("watch: add %s error, %s\n", ev.Name, err)
+					}
+				}
+			}
+		case err, ok := <-l.watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Verbosef("watch error: %s\n", err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panwatch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// syncBuffer 并发安全的 bytes.Buffer
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buf.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buf.String()
+}
+
+func (sb *syncBuffer) events(t *testing.T) []*Event {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	var events []*Event
+	for _, line := range strings.Split(strings.TrimSpace(sb.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		e := &Event{}
+		if err := json.Unmarshal([]byte(line), e); err != nil {
+			t.Fatalf("invalid json line: %s, %s", line, err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestNewEvents(t *testing.T) {
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	events := NewEvents(fsnotify.Event{Name: "/not/exist", Op: fsnotify.Create | fsnotify.Chmod}, now)
+	if len(events) != 2 || events[0].Event != EventCreate || events[1].Event != EventChmod {
+		t.Fatalf("events: %v", events)
+	}
+	if events[0].Time != "2021-03-04T05:06:07Z" || events[0].Size != 0 || events[0].Path != "/not/exist" {
+		t.Fatalf("event: %+v", events[0])
+	}
+}
+
+func TestLoggerRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "panwatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := &syncBuffer{}
+	l, err := NewLogger(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = l.AddRecursive(dir); err != nil {
+		l.Close()
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		l.Run(ctx)
+		close(done)
+	}()
+
+	// 新建的子目录也会被监控
+	sub := filepath.Join(dir, "sub")
+	if err = os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	file := filepath.Join(sub, "a.txt")
+	if err = ioutil.WriteFile(file, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	renamed := filepath.Join(sub, "b.txt")
+	if err = os.Rename(file, renamed); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(renamed); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		sub:     EventCreate,
+		file:    EventRename,
+		renamed: EventDelete,
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		found := map[string]bool{}
+		for _, e := range out.events(t) {
+			if expected[e.Path] == e.Event {
+				found[e.Path] = true
+			}
+		}
+		if len(found) == len(expected) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("missing events, got: %s", out)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+}
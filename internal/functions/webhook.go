@@ -0,0 +1,140 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package functions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/phpc0de/ctlibgo/requester"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+const (
+	// WebhookTimeout 调用 webhook 的超时时间
+	WebhookTimeout = 10 * time.Second
+
+	// WebhookTypeDownload 下载完成的通知
+	WebhookTypeDownload = "download"
+	// WebhookTypeUpload 上传完成的通知
+	WebhookTypeUpload = "upload"
+
+	// WebhookResultSuccess 任务成功
+	WebhookResultSuccess = "success"
+	// WebhookResultFailure 任务失败
+	WebhookResultFailure = "failure"
+)
+
+type (
+	// WebhookPayload 调用 webhook 时 POST 的 JSON 数据
+	WebhookPayload struct {
+		Type     string  `json:"type"`            // download 或 upload
+		TaskId   string  `json:"taskId"`          // 任务ID
+		FilePath string  `json:"filePath"`        // 网盘文件路径
+		SavePath string  `json:"savePath"`        // 下载时为本地保存路径, 上传时为本地文件路径
+		Result   string  `json:"result"`          // success 或 failure
+		Error    string  `json:"error,omitempty"` // 失败的原因
+		Size     int64   `json:"size"`            // 文件大小, 单位 B
+		Elapsed  float64 `json:"elapsed"`         // 耗时, 单位秒
+	}
+
+	// Webhook 任务完成时调用用户设置的URL, 调用失败不影响任务的结果
+	Webhook struct {
+		URL       string
+		OnSuccess bool // 任务成功时调用
+		OnFailure bool // 任务失败时调用
+		Client    *requester.HTTPClient
+
+		once sync.Once
+		wg   sync.WaitGroup
+	}
+)
+
+// NewWebhookPayload 返回 WebhookPayload, err 不为 nil 时结果为失败
+func NewWebhookPayload(typ, taskId, filePath, savePath string, size int64, elapsed time.Duration, err error) *WebhookPayload {
+	payload := &WebhookPayload{
+		Type:     typ,
+		TaskId:   taskId,
+		FilePath: filePath,
+		SavePath: savePath,
+		Result:   WebhookResultSuccess,
+		Size:     size,
+		Elapsed:  elapsed.Seconds(),
+	}
+	if err != nil {
+		payload.Result = WebhookResultFailure
+		payload.Error = err.Error()
+	}
+	return payload
+}
+
+// Enabled 是否需要调用 webhook
+func (wh *Webhook) Enabled(succeed bool) bool {
+	if wh == nil || wh.URL == "" {
+		return false
+	}
+	if succeed {
+		return wh.OnSuccess
+	}
+	return wh.OnFailure
+}
+
+// Notify 在后台调用 webhook, 不阻塞任务
+func (wh *Webhook) Notify(payload *WebhookPayload) {
+	if !wh.Enabled(payload.Result == WebhookResultSuccess) {
+		return
+	}
+	wh.wg.Add(1)
+	go func() {
+		defer wh.wg.Done()
+		if err := wh.post(payload); err != nil {
+			fmt.Printf("[%s] 调用 webhook 失败: %s\n", payload.TaskId, err)
+		}
+	}()
+}
+
+// Wait 等待正在进行的 webhook 调用结束, 每个调用最多等待 WebhookTimeout
+func (wh *Webhook) Wait() {
+	if wh == nil {
+		return
+	}
+	wh.wg.Wait()
+}
+
+func (wh *Webhook) post(payload *WebhookPayload) error {
+	wh.once.Do(func() {
+		if wh.Client == nil {
+			wh.Client = requester.NewHTTPClient()
+		}
+		wh.Client.SetTimeout(WebhookTimeout)
+	})
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := wh.Client.Post(wh.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP状态码: %d", resp.StatusCode)
+	}
+	return nil
+}
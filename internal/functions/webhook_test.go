@@ -0,0 +1,103 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package functions
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newWebhookTestServer(t *testing.T, status int) (*httptest.Server, chan *WebhookPayload) {
+	ch := make(chan *WebhookPayload, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method: %s", r.Method)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("content type: %s", ct)
+		}
+		payload := &WebhookPayload{}
+		if err := json.NewDecoder(r.Body).Decode(payload); err != nil {
+			t.Errorf("decode payload: %s", err)
+		}
+		ch <- payload
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, ch
+}
+
+func TestWebhookNotify(t *testing.T) {
+	srv, ch := newWebhookTestServer(t, http.StatusOK)
+	wh := &Webhook{URL: srv.URL, OnSuccess: true, OnFailure: true}
+
+	wh.Notify(NewWebhookPayload(WebhookTypeDownload, "1", "/我的资源/1.mp4", "/tmp/1.mp4", 1024, 1500*time.Millisecond, nil))
+	wh.Notify(NewWebhookPayload(WebhookTypeUpload, "2", "/我的资源/2.mp4", "/tmp/2.mp4", 2048, time.Second, errors.New("上传文件错误")))
+	wh.Wait()
+	close(ch)
+
+	payloads := map[string]*WebhookPayload{}
+	for p := range ch {
+		payloads[p.TaskId] = p
+	}
+	if len(payloads) != 2 {
+		t.Fatalf("got %d payloads, want 2", len(payloads))
+	}
+
+	p := payloads["1"]
+	if p.Type != WebhookTypeDownload || p.FilePath != "/我的资源/1.mp4" || p.SavePath != "/tmp/1.mp4" ||
+		p.Result != WebhookResultSuccess || p.Error != "" || p.Size != 1024 || p.Elapsed != 1.5 {
+		t.Errorf("unexpected success payload: %+v", p)
+	}
+	p = payloads["2"]
+	if p.Type != WebhookTypeUpload || p.Result != WebhookResultFailure || p.Error != "上传文件错误" || p.Size != 2048 {
+		t.Errorf("unexpected failure payload: %+v", p)
+	}
+}
+
+func TestWebhookNotifyFilter(t *testing.T) {
+	srv, ch := newWebhookTestServer(t, http.StatusOK)
+	wh := &Webhook{URL: srv.URL, OnFailure: true}
+
+	wh.Notify(NewWebhookPayload(WebhookTypeDownload, "1", "/1.mp4", "", 0, 0, nil))
+	wh.Notify(NewWebhookPayload(WebhookTypeDownload, "2", "/2.mp4", "", 0, 0, errors.New("下载文件错误")))
+	wh.Wait()
+	close(ch)
+
+	var ids []string
+	for p := range ch {
+		ids = append(ids, p.TaskId)
+	}
+	if len(ids) != 1 || ids[0] != "2" {
+		t.Fatalf("only failures should be notified, got %v", ids)
+	}
+
+	var nilWebhook *Webhook
+	if nilWebhook.Enabled(true) || (&Webhook{OnSuccess: true}).Enabled(true) {
+		t.Fatal("webhook without url should be disabled")
+	}
+	nilWebhook.Wait()
+}
+
+func TestWebhookPostStatus(t *testing.T) {
+	srv, _ := newWebhookTestServer(t, http.StatusInternalServerError)
+	wh := &Webhook{URL: srv.URL, OnSuccess: true}
+	if err := wh.post(NewWebhookPayload(WebhookTypeDownload, "1", "/1.mp4", "", 0, 0, nil)); err == nil {
+		t.Fatal("expected error for non-2xx status")
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package history 记录下载和上传的历史, 每条记录以一行 JSON 追加到历史文件
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/phpc0de/ctlibgo/logger"
+	"github.com/phpc0de/ctpango/internal/config"
+)
+
+const (
+	// OperationDownload 下载
+	OperationDownload = "download"
+	// OperationUpload 上传
+	OperationUpload = "upload"
+
+	// ResultSuccess 成功
+	ResultSuccess = "success"
+	// ResultFailure 失败
+	ResultFailure = "failure"
+)
+
+type (
+	// Record 一条下载或上传的历史记录
+	Record struct {
+		Time      time.Time `json:"time"`
+		Operation string    `json:"operation"`       // download 或 upload
+		CloudPath string    `json:"cloudPath"`       // 网盘文件路径
+		LocalPath string    `json:"localPath"`       // 本地文件路径
+		Result    string    `json:"result"`          // success 或 failure
+		Error     string    `json:"error,omitempty"` // 失败的原因
+		Size      int64     `json:"size"`            // 文件大小, 单位 B
+		Duration  float64   `json:"duration"`        // 耗时, 单位秒
+	}
+
+	// Store 只追加的 JSON Lines 历史文件
+	Store struct {
+		path string
+	}
+)
+
+var (
+	historyVerbose = logger.New("HISTORY", config.EnvVerbose)
+
+	// fileMu 同时有多个文件下载或上传时, 保证每条记录完整写入
+	fileMu sync.Mutex
+)
+
+// NewRecord 返回 Record, err 不为 nil 时结果为失败
+func NewRecord(operation, cloudPath, localPath string, size int64, elapsed time.Duration, err error) *Record {
+	r := &Record{
+		Time:      time.Now(),
+		Operation: operation,
+		CloudPath: cloudPath,
+		LocalPath: localPath,
+		Result:    ResultSuccess,
+		Size:      size,
+		Duration:  elapsed.Seconds(),
+	}
+	if err != nil {
+		r.Result = ResultFailure
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// NewStore 返回保存在 path 的 Store
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// DefaultStore 返回配置中的历史文件
+func DefaultStore() *Store {
+	return NewStore(config.Config.HistoryFilePath())
+}
+
+// Append 追加一条记录到配置中的历史文件, 写入失败不影响下载和上传, 只输出调试信息
+func Append(r *Record) {
+	if err := DefaultStore().Append(r); err != nil {
+		historyVerbose.Warnf("write history error: %s\n", err)
+	}
+}
+
+// Path 返回历史文件的路径
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Append 追加一条记录
+func (s *Store) Append(r *Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	if err = os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Last 返回最近的 n 条记录, 按时间从旧到新排列, n 小于等于0时返回所有记录.
+// 历史文件不存在时返回空, 无法解析的行会被忽略
+func (s *Store) Last(n int) ([]*Record, error) {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []*Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		r := &Record{}
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			continue
+		}
+		records = append(records, r)
+		if n > 0 && len(records) > 2*n {
+			// 只保留需要的记录, 避免历史文件很大时占用过多内存
+			records = append(records[:0], records[len(records)-n:]...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if n > 0 && len(records) > n {
+		records = records[len(records)-n:]
+	}
+	return records, nil
+}
+
+// Clear 清空历史记录
+func (s *Store) Clear() error {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	err := os.Remove(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package history
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewStore(filepath.Join(dir, "sub", "history.jsonl"))
+	records, err := store.Last(10)
+	if err != nil || len(records) != 0 {
+		t.Fatalf("empty store: %v, %v", records, err)
+	}
+
+	ok := NewRecord(OperationDownload, "/我的资源/1.mp4", "/tmp/1.mp4", 1024, 1500*time.Millisecond, nil)
+	failed := NewRecord(OperationUpload, "/备份/2.txt", "/tmp/2.txt", 10, time.Second, errors.New("网络错误"))
+	for _, r := range []*Record{ok, failed} {
+		if err := store.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err = store.Last(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records", len(records))
+	}
+	for i, want := range []*Record{ok, failed} {
+		got := records[i]
+		if !got.Time.Equal(want.Time) {
+			t.Errorf("%d time: got %s, want %s", i, got.Time, want.Time)
+		}
+		got.Time = want.Time
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d: got %+v, want %+v", i, got, want)
+		}
+	}
+	if records[0].Result != ResultSuccess || records[1].Result != ResultFailure || records[1].Error != "网络错误" {
+		t.Errorf("result: %+v, %+v", records[0], records[1])
+	}
+	if records[0].Duration != 1.5 {
+		t.Errorf("duration: %v", records[0].Duration)
+	}
+}
+
+func TestStoreLast(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewStore(filepath.Join(dir, "history.jsonl"))
+	for i := 0; i < 20; i++ {
+		store.Append(&Record{Operation: OperationDownload, Size: int64(i)})
+	}
+	// 无法解析的行被忽略
+	f, _ := os.OpenFile(store.Path(), os.O_WRONLY|os.O_APPEND, 0600)
+	f.WriteString("not json\n")
+	f.Close()
+	store.Append(&Record{Operation: OperationUpload, Size: 20})
+
+	records, err := store.Last(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("got %d records", len(records))
+	}
+	for i, r := range records {
+		if r.Size != int64(16+i) {
+			t.Errorf("%d: got size %d", i, r.Size)
+		}
+	}
+}
+
+func TestStoreClear(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewStore(filepath.Join(dir, "history.jsonl"))
+	// 历史文件不存在时清空不报错
+	if err := store.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	store.Append(&Record{Operation: OperationDownload})
+	if err := store.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	records, err := store.Last(0)
+	if err != nil || len(records) != 0 {
+		t.Fatalf("after clear: %v, %v", records, err)
+	}
+	// 清空后可以继续追加
+	store.Append(&Record{Operation: OperationUpload})
+	if records, _ := store.Last(0); len(records) != 1 {
+		t.Fatalf("append after clear: %v", records)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package jsonlog 把调试日志转换为 JSON 格式输出, 便于日志收集系统处理
+package jsonlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phpc0de/ctlibgo/logger"
+)
+
+const (
+	// EnvLogFormat 调试日志格式的环境变量, 交互模式下每条命令都会重新解析全局参数
+	EnvLogFormat = "CLOUD189_LOG_FORMAT"
+
+	// FormatText 纯文本格式, 默认
+	FormatText = "text"
+	// FormatJSON JSON 格式, 每行一条日志
+	FormatJSON = "json"
+
+	// LevelDebug 未注明级别的调试日志
+	LevelDebug = "DEBUG"
+)
+
+var (
+	// timePrefixPattern 匹配 logger.TimePrefix 输出的时间前缀
+	timePrefixPattern = regexp.MustCompile(`^\[[^\]]*\] ?`)
+	// modulePattern 匹配 logger.CmdVerbose 输出的 "DEBUG: 模块 级别: " 前缀
+	modulePattern = regexp.MustCompile(`^DEBUG: (\S+) ([A-Z]+): `)
+	// levelPattern 匹配直接调用 logger.Verbosef 时的 "级别: " 前缀
+	levelPattern = regexp.MustCompile(`^(DEBUG|INFO|WARN|ERROR): ?`)
+)
+
+type (
+	// Entry 一条 JSON 格式的日志
+	Entry struct {
+		Level  string `json:"level"`
+		Msg    string `json:"msg"`
+		Ts     string `json:"ts"` // RFC3339 格式的时间
+		Module string `json:"module"`
+	}
+
+	// JSONLogWriter 把 logger 输出的文本日志转换为 JSON 格式, 可作为 logger.Outputs 使用
+	JSONLogWriter struct {
+		out     io.Writer
+		mu      sync.Mutex
+		pending bool // 只收到了时间前缀, 日志内容在下一次写入中, 见 logger.Verboseln
+		now     func() time.Time
+	}
+)
+
+// NewJSONLogWriter 返回输出到 out 的 JSONLogWriter
+func NewJSONLogWriter(out io.Writer) *JSONLogWriter {
+	return &JSONLogWriter{
+		out: out,
+		now: time.Now,
+	}
+}
+
+// ParseEntry 解析 logger 输出的一条文本日志, 不包含时间
+func ParseEntry(text string) *Entry {
+	text = strings.TrimRight(timePrefixPattern.ReplaceAllString(text, ""), "\r\n")
+	e := &Entry{Level: LevelDebug}
+	if m := modulePattern.FindStringSubmatch(text); m != nil {
+		e.Module, e.Level = m[1], m[2]
+		text = text[len(m[0]):]
+	} else if m := levelPattern.FindStringSubmatch(text); m != nil {
+		e.Level = m[1]
+		text = text[len(m[0]):]
+	}
+	e.Msg = text
+	return e
+}
+
+// Write 把一次写入的日志转换为一行 JSON 输出
+func (w *JSONLogWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	text := string(p)
+	if !w.pending && timePrefixPattern.ReplaceAllString(text, "") == "" {
+		// 只有时间前缀
+		w.pending = true
+		return len(p), nil
+	}
+	w.pending = false
+
+	e := ParseEntry(text)
+	e.Ts = w.now().Format(time.RFC3339Nano)
+	data, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+	_, err = w.out.Write(append(data, '\n'))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// SetFormat 设置调试日志的输出格式, 所有模块的调试日志都输出到标准错误
+func SetFormat(format string) error {
+	switch strings.ToLower(format) {
+	case "", FormatText:
+		logger.Outputs = []io.Writer{os.Stderr}
+	case FormatJSON:
+		logger.Outputs = []io.Writer{NewJSONLogWriter(os.Stderr)}
+	default:
+		return fmt.Errorf("不支持的日志格式: %s, 可选值: %s, %s", format, FormatText, FormatJSON)
+	}
+	return nil
+}
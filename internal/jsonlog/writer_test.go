@@ -0,0 +1,98 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package jsonlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/phpc0de/ctlibgo/logger"
+)
+
+func TestJSONLogWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	defer func(outputs []io.Writer, verbose bool) {
+		logger.Outputs, logger.IsVerbose = outputs, verbose
+	}(logger.Outputs, logger.IsVerbose)
+	logger.Outputs = []io.Writer{NewJSONLogWriter(buf)}
+	logger.IsVerbose = true
+
+	start := time.Now().Add(-time.Second)
+	verbose := &logger.CmdVerbose{Module: "PANCOMMAND"}
+	verbose.Infof("upload file: %s\n", "/a.txt")
+	verbose.Warn("retry")
+	logger.Verbosef("DEBUG: prealloc file strategy: %s\n", "None")
+	logger.Verboseln("work id:", 1)
+
+	expected := []Entry{
+		{Level: "INFO", Module: "PANCOMMAND", Msg: "upload file: /a.txt"},
+		{Level: "WARN", Module: "PANCOMMAND", Msg: "retry"},
+		{Level: "DEBUG", Msg: "prealloc file strategy: None"},
+		{Level: "DEBUG", Msg: "work id: 1"},
+	}
+	scanner := bufio.NewScanner(buf)
+	for i := 0; scanner.Scan(); i++ {
+		if i >= len(expected) {
+			t.Fatalf("unexpected line: %s", scanner.Text())
+		}
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(scanner.Bytes(), &fields); err != nil {
+			t.Fatalf("line %d: %s, %s", i, err, scanner.Text())
+		}
+		for _, name := range []string{"level", "msg", "ts", "module"} {
+			if _, ok := fields[name]; !ok {
+				t.Errorf("line %d: missing field %s: %s", i, name, scanner.Text())
+			}
+		}
+
+		e := &Entry{}
+		json.Unmarshal(scanner.Bytes(), e)
+		ts, err := time.Parse(time.RFC3339Nano, e.Ts)
+		if err != nil {
+			t.Errorf("line %d: parse ts: %s", i, err)
+		} else if ts.Before(start) || ts.After(time.Now()) {
+			t.Errorf("line %d: ts out of range: %s", i, e.Ts)
+		}
+		e.Ts = ""
+		if *e != expected[i] {
+			t.Errorf("line %d: got %+v, want %+v", i, *e, expected[i])
+		}
+	}
+}
+
+func TestSetFormat(t *testing.T) {
+	defer func(outputs []io.Writer) {
+		logger.Outputs = outputs
+	}(logger.Outputs)
+
+	if err := SetFormat("JSON"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := logger.Outputs[0].(*JSONLogWriter); !ok {
+		t.Errorf("json output: %T", logger.Outputs[0])
+	}
+	if err := SetFormat(FormatText); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := logger.Outputs[0].(*JSONLogWriter); ok {
+		t.Errorf("text output: %T", logger.Outputs[0])
+	}
+	if err := SetFormat("xml"); err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+}
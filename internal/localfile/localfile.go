@@ -237,6 +237,7 @@ func (lfc *LocalFileEntity) Sum(checkSumFlag int) (err error) {
 		defer d(err)
 	}
 
+
 	err = lfc.repeatRead(wus...)
 	return
 }
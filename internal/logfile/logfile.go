@@ -0,0 +1,306 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package logfile 把标准输出和调试日志同时写入日志文件, 日志文件超过大小上限时自动轮转
+package logfile
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/phpc0de/ctlibgo/converter"
+)
+
+const (
+	// EnvLogFile 日志文件路径的环境变量, 交互模式下每条命令都会重新解析全局参数
+	EnvLogFile = "CLOUD189_LOG_FILE"
+
+	// DefaultMaxSize 默认的日志文件大小上限
+	DefaultMaxSize = 10 * converter.MB
+
+	// RotatedSuffix 轮转后旧日志文件的后缀, 只保留一份旧日志
+	RotatedSuffix = ".1"
+
+	// TimeLayout 写入日志文件的每一行输出的时间格式
+	TimeLayout = "2006-01-02 15:04:05"
+)
+
+type (
+	// RotatingFile 以追加方式打开的日志文件, 写入后超过 maxSize 时把当前文件重命名为 path + RotatedSuffix, 并重新创建日志文件
+	RotatingFile struct {
+		path    string
+		maxSize int64
+		mu      sync.Mutex
+		file    *os.File
+		size    int64
+	}
+
+	// LineWriter 按行写入 out, 每行前加上时间. 以 '\r' 刷新的进度输出只保留最后的内容
+	LineWriter struct {
+		out       io.Writer
+		mu        sync.Mutex
+		buf       bytes.Buffer
+		pendingCR bool
+		now       func() time.Time
+	}
+
+	// stdoutTee 把标准输出同时写入日志文件
+	stdoutTee struct {
+		stdout *os.File
+		pipeW  *os.File
+		done   chan struct{}
+	}
+)
+
+var (
+	mu      sync.Mutex
+	current *RotatingFile
+	tee     *stdoutTee
+)
+
+// Open 以追加方式打开日志文件, maxSize <= 0 时使用 DefaultMaxSize
+func Open(path string, maxSize int64) (*RotatingFile, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	rf := &RotatingFile{
+		path:    path,
+		maxSize: maxSize,
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rf.file, rf.size = file, info.Size()
+	return nil
+}
+
+// Path 返回日志文件路径
+func (rf *RotatingFile) Path() string {
+	return rf.path
+}
+
+// Write 写入日志文件, 写入后超过大小上限则轮转
+func (rf *RotatingFile) Write(p []byte) (n int, err error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+	n, err = rf.file.Write(p)
+	rf.size += int64(n)
+	if err != nil {
+		return
+	}
+	if rf.size >= rf.maxSize {
+		err = rf.rotate()
+	}
+	return
+}
+
+// rotate 把当前日志文件重命名为旧日志, 并重新创建日志文件
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+	rf.file = nil
+	if err := os.Rename(rf.path, rf.path+RotatedSuffix); err != nil {
+		return err
+	}
+	return rf.open()
+}
+
+// Close 关闭日志文件
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file == nil {
+		return nil
+	}
+	err := rf.file.Close()
+	rf.file = nil
+	return err
+}
+
+// NewLineWriter 返回按行写入 out 的 LineWriter
+func NewLineWriter(out io.Writer) *LineWriter {
+	return &LineWriter{
+		out: out,
+		now: time.Now,
+	}
+}
+
+// Write 缓存不完整的行, 每遇到 '\n' 输出一行, 空行不输出
+func (lw *LineWriter) Write(p []byte) (n int, err error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	for _, b := range p {
+		if lw.pendingCR {
+			lw.pendingCR = false
+			if b != '\n' {
+				// 进度刷新, 丢弃之前的内容
+				lw.buf.Reset()
+			}
+		}
+		switch b {
+		case '\n':
+			if err = lw.flushLine(); err != nil {
+				return 0, err
+			}
+		case '\r':
+			lw.pendingCR = true
+		default:
+			lw.buf.WriteByte(b)
+		}
+	}
+	return len(p), nil
+}
+
+func (lw *LineWriter) flushLine() error {
+	defer lw.buf.Reset()
+	if lw.buf.Len() == 0 {
+		return nil
+	}
+	line := make([]byte, 0, len(TimeLayout)+lw.buf.Len()+4)
+	line = append(line, '[')
+	line = append(line, lw.now().Format(TimeLayout)...)
+	line = append(line, "] "...)
+	line = append(line, lw.buf.Bytes()...)
+	line = append(line, '\n')
+	_, err := lw.out.Write(line)
+	return err
+}
+
+// Flush 输出缓存中不完整的行
+func (lw *LineWriter) Flush() error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.flushLine()
+}
+
+// Setup 打开日志文件, 并把标准输出同时写入日志文件. 重复调用时, 路径相同则复用已打开的日志文件.
+// path 为空时关闭已打开的日志文件
+func Setup(path string, maxSize int64) (*RotatingFile, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if current != nil && current.path == path {
+		return current, nil
+	}
+	closeLocked()
+	if path == "" {
+		return nil, nil
+	}
+
+	rf, err := Open(path, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	t, err := teeStdout(rf)
+	if err != nil {
+		rf.Close()
+		return nil, err
+	}
+	current, tee = rf, t
+	return rf, nil
+}
+
+// Current 返回已打开的日志文件, 未设置时返回 nil
+func Current() *RotatingFile {
+	mu.Lock()
+	defer mu.Unlock()
+	return current
+}
+
+// Stdout 返回原来的标准输出, 写入的内容不记录到日志文件
+func Stdout() *os.File {
+	mu.Lock()
+	defer mu.Unlock()
+	if tee != nil {
+		return tee.stdout
+	}
+	return os.Stdout
+}
+
+// Close 恢复标准输出, 等待输出全部写入后关闭日志文件
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+	return closeLocked()
+}
+
+func closeLocked() error {
+	if current == nil {
+		return nil
+	}
+	tee.close()
+	err := current.Close()
+	current, tee = nil, nil
+	return err
+}
+
+// teeStdout 用管道替换 os.Stdout, 写入管道的内容同时输出到原来的标准输出和 rf
+func teeStdout(rf *RotatingFile) (*stdoutTee, error) {
+	pipeR, pipeW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	t := &stdoutTee{
+		stdout: os.Stdout,
+		pipeW:  pipeW,
+		done:   make(chan struct{}),
+	}
+	lw := NewLineWriter(rf)
+	go func() {
+		defer close(t.done)
+		defer pipeR.Close()
+		buf := make([]byte, 4096)
+		for {
+			n, err := pipeR.Read(buf)
+			if n > 0 {
+				// 优先保证终端输出, 写入日志文件的错误忽略
+				t.stdout.Write(buf[:n])
+				lw.Write(buf[:n])
+			}
+			if err != nil {
+				lw.Flush()
+				return
+			}
+		}
+	}()
+	os.Stdout = pipeW
+	return t, nil
+}
+
+func (t *stdoutTee) close() {
+	os.Stdout = t.stdout
+	t.pipeW.Close()
+	<-t.done
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package logfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phpc0de/ctapi/cloudpan"
+	"github.com/phpc0de/ctlibgo/converter"
+	"github.com/phpc0de/ctlibgo/logger"
+	"github.com/phpc0de/ctpango/internal/apistat"
+	"github.com/phpc0de/ctpango/internal/file/downloader"
+	"github.com/phpc0de/ctpango/library/requester/transfer"
+)
+
+// slowReader 每次最多读取64KB, 并等待一段时间, 使下载持续超过1秒, 输出下载进度
+type slowReader struct {
+	*bytes.Reader
+}
+
+func (sr *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(300 * time.Millisecond)
+	if len(p) > 64*1024 {
+		p = p[:64*1024]
+	}
+	return sr.Reader.Read(p)
+}
+
+func TestSetupDownloadOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cloudpan189.log")
+	stdout := os.Stdout
+	rf, err := Setup(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Current() != rf {
+		t.Fatal("current log file not set")
+	}
+	if Stdout() != stdout || os.Stdout == stdout {
+		t.Fatal("stdout not replaced")
+	}
+
+	isVerbose, outputs := logger.IsVerbose, logger.Outputs
+	logger.IsVerbose, logger.Outputs = true, []io.Writer{ioutil.Discard, rf}
+	defer func() {
+		logger.IsVerbose, logger.Outputs = isVerbose, outputs
+	}()
+
+	// 从模拟的下载服务器下载文件, 输出与下载任务相同格式的进度
+	content := bytes.Repeat([]byte("0123456789abcdef"), 16*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "a.bin", time.Time{}, &slowReader{bytes.NewReader(content)})
+	}))
+	defer server.Close()
+
+	savePath := filepath.Join(t.TempDir(), "a.bin")
+	file, err := os.Create(savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	cfg := downloader.NewConfig()
+	cfg.MaxParallel = 1
+	cfg.CacheSize = 1024
+	der := downloader.NewDownloader(file, cfg, apistat.NewPanClient(cloudpan.NewPanClient(cloudpan.WebLoginToken{}, cloudpan.AppLoginToken{})))
+	der.SetFileInfo(&cloudpan.AppFileEntity{FileId: "1", FileSize: int64(len(content))})
+	der.SetDownloadUrlFunc(func(familyId int64, fileId string) (string, error) {
+		return server.URL + "/a.bin", nil
+	})
+	der.OnExecute(func() {
+		fmt.Printf("[%d] 下载开始\n\n", 1)
+	})
+	der.OnDownloadStatusEvent(func(status transfer.DownloadStatuser, workersCallback func(downloader.RangeWorkerFunc)) {
+		fmt.Printf("\r[%d] ↓ %s/%s %s/s in %s ...", 1,
+			converter.ConvertFileSize(status.Downloaded(), 2),
+			converter.ConvertFileSize(status.TotalSize(), 2),
+			converter.ConvertFileSize(status.SpeedsPerSecond(), 2),
+			status.TimeElapsed()/1e7*1e7)
+	})
+	fmt.Printf("[%d] 加入下载队列: %s\n", 1, "/test/a.bin")
+	if err = der.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Printf("\n[%d] 下载完成, 保存位置: %s\n", 1, savePath)
+	logger.Verbosef("DEBUG: [%d] connections: %s\n", 1, "opened 1")
+	// 写入 Stdout 的内容不记录到日志文件
+	fmt.Fprintf(Stdout(), "secret-download-url\n")
+
+	if err = Close(); err != nil {
+		t.Fatal(err)
+	}
+	if Current() != nil {
+		t.Fatal("log file not closed")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logContent := string(data)
+	timestamp := `\[\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\] `
+	for _, pattern := range []string{
+		timestamp + `\[1\] 加入下载队列: /test/a\.bin\n`,
+		timestamp + `\[1\] 下载开始\n`,
+		timestamp + `\[1\] ↓ [\d.]+KB/256\.00KB .*\n`,
+		timestamp + `\[1\] 下载完成, 保存位置: ` + regexp.QuoteMeta(savePath) + `\n`,
+		`\] DEBUG: \[1\] connections: opened 1\n`,
+	} {
+		if !regexp.MustCompile(pattern).MatchString(logContent) {
+			t.Errorf("log file does not match %q:\n%s", pattern, logContent)
+		}
+	}
+	if strings.Contains(logContent, "secret-download-url") {
+		t.Errorf("output written to Stdout should not be logged:\n%s", logContent)
+	}
+	// 以 '\r' 刷新的进度只保留最后一次
+	if n := strings.Count(logContent, "↓"); n != 1 {
+		t.Errorf("progress logged %d times:\n%s", n, logContent)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cloudpan189.log")
+	rf, err := Open(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	rf.Write([]byte("first\n"))
+	rf.Write([]byte("second\n")) // 超过 10 字节, 轮转
+	rf.Write([]byte("third\n"))
+
+	rotated, err := ioutil.ReadFile(path + RotatedSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rotated) != "first\nsecond\n" {
+		t.Fatalf("rotated: %q", rotated)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "third\n" {
+		t.Fatalf("current: %q", data)
+	}
+
+	// 重新打开时追加, 并从已有大小开始计算
+	rf.Close()
+	rf, err = Open(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	rf.Write([]byte("fourth\n"))
+	if _, err = os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+	rotated, _ = ioutil.ReadFile(path + RotatedSuffix)
+	if string(rotated) != "third\nfourth\n" {
+		t.Fatalf("rotated after reopen: %q", rotated)
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lw := NewLineWriter(buf)
+	lw.now = func() time.Time {
+		return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	}
+	lw.Write([]byte("a\r\nb"))
+	lw.Write([]byte("c\n\rprogress 1\rprogress 2\n\nlast"))
+	lw.Flush()
+
+	expected := "[2020-01-02 03:04:05] a\n[2020-01-02 03:04:05] bc\n[2020-01-02 03:04:05] progress 2\n[2020-01-02 03:04:05] last\n"
+	if buf.String() != expected {
+		t.Fatalf("got %q", buf.String())
+	}
+}
@@ -15,7 +15,10 @@ package panupdate
 
 import (
 	"archive/zip"
+	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/phpc0de/ctpango/cmder/cmdliner"
 	"github.com/phpc0de/ctpango/cmder/cmdutil"
@@ -29,6 +32,8 @@ import (
 	"github.com/phpc0de/ctlibgo/logger"
 	"github.com/phpc0de/ctlibgo/requester"
 	"github.com/phpc0de/ctpango/library/requester/transfer"
+	"hash/crc32"
+	"io"
 	"net/http"
 	"path/filepath"
 	"regexp"
@@ -41,6 +46,8 @@ import (
 
 const (
 	ReleaseName = "cloudpan189-go"
+	// ManifestFileName 更新文件中记录每个文件 SHA256 的清单, 每行格式为: <hash>  <filename>
+	ManifestFileName = "sha256sums.txt"
 )
 
 type info struct {
@@ -346,6 +353,13 @@ func CheckUpdate(version string, yes bool) {
 		return
 	}
 
+	// 校验文件, 避免使用不完整的更新文件替换程序
+	err = verifyZip(buf[:downloadSize], target.size)
+	if err != nil {
+		fmt.Printf("校验更新文件失败, 已取消更新: %s\n", err)
+		return
+	}
+
 	// 读取文件
 	reader, err := zip.NewReader(bytes.NewReader(buf), target.size)
 	if err != nil {
@@ -353,6 +367,16 @@ func CheckUpdate(version string, yes bool) {
 		return
 	}
 
+	// 按清单校验每个文件的 SHA256, 任何文件校验失败都不更新
+	hasManifest, err := verifyZipManifest(reader)
+	if err != nil {
+		fmt.Printf("SHA256 校验失败, 已取消更新: %s\n", err)
+		return
+	}
+	if !hasManifest {
+		fmt.Printf("警告: 更新文件中没有 %s, 无法校验文件的 SHA256\n", ManifestFileName)
+	}
+
 	execPath := cmdutil.ExecutablePath()
 
 	var fileNum, errTimes int
@@ -363,7 +387,7 @@ func CheckUpdate(version string, yes bool) {
 
 		info := zipFile.FileInfo()
 
-		if info.IsDir() {
+		if info.IsDir() || isManifestFile(zipFile.Name) {
 			continue
 		}
 
@@ -375,7 +399,7 @@ func CheckUpdate(version string, yes bool) {
 
 		fileNum++
 
-		name := zipFile.Name[strings.Index(zipFile.Name, "/")+1:]
+		name := zipEntryName(zipFile.Name)
 		if name == ReleaseName {
 			err = update(cmdutil.Executable(), rc)
 		} else {
@@ -396,3 +420,119 @@ func CheckUpdate(version string, yes bool) {
 
 	fmt.Printf("更新完毕, 请重启程序\n")
 }
+
+// verifyZip 校验下载的更新文件: 大小需要和发布信息一致, 并且 zip 内每个文件的 CRC32 都需要和 zip 头中记录的一致
+func verifyZip(data []byte, size int64) error {
+	if int64(len(data)) != size {
+		return fmt.Errorf("文件大小不一致, 期望 %d, 实际 %d", size, len(data))
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(data), size)
+	if err != nil {
+		return err
+	}
+	for _, zipFile := range reader.File {
+		if zipFile == nil || zipFile.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := zipFile.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %s", zipFile.Name, err)
+		}
+		h := crc32.NewIEEE()
+		_, err = io.Copy(h, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", zipFile.Name, err)
+		}
+		if h.Sum32() != zipFile.CRC32 {
+			return fmt.Errorf("%s: CRC32 校验失败", zipFile.Name)
+		}
+	}
+	return nil
+}
+
+// zipEntryName 去掉 zip 内文件路径的第一级目录, 即解压后相对于程序目录的路径
+func zipEntryName(name string) string {
+	return name[strings.Index(name, "/")+1:]
+}
+
+// isManifestFile 是否为 SHA256 清单文件
+func isManifestFile(name string) bool {
+	return zipEntryName(name) == ManifestFileName
+}
+
+// parseManifest 解析 SHA256 清单, 返回文件名到小写 hash 的映射.
+// 兼容 sha256sum 的二进制模式输出, 即文件名前带 *
+func parseManifest(r io.Reader) (map[string]string, error) {
+	manifest := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, fmt.Errorf("%s 第 %d 行格式错误", ManifestFileName, lineNum)
+		}
+		if _, err := hex.DecodeString(fields[0]); err != nil {
+			return nil, fmt.Errorf("%s 第 %d 行格式错误", ManifestFileName, lineNum)
+		}
+		manifest[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	return manifest, scanner.Err()
+}
+
+// verifyZipManifest 按 zip 内的 SHA256 清单校验其他所有文件, 清单中没有记录的文件视为校验失败.
+// 没有清单时返回 false
+func verifyZipManifest(reader *zip.Reader) (bool, error) {
+	var manifestFile *zip.File
+	for _, zipFile := range reader.File {
+		if zipFile != nil && !zipFile.FileInfo().IsDir() && isManifestFile(zipFile.Name) {
+			manifestFile = zipFile
+			break
+		}
+	}
+	if manifestFile == nil {
+		return false, nil
+	}
+
+	rc, err := manifestFile.Open()
+	if err != nil {
+		return true, err
+	}
+	manifest, err := parseManifest(rc)
+	rc.Close()
+	if err != nil {
+		return true, err
+	}
+
+	for _, zipFile := range reader.File {
+		if zipFile == nil || zipFile.FileInfo().IsDir() || zipFile == manifestFile {
+			continue
+		}
+		expected, ok := manifest[zipEntryName(zipFile.Name)]
+		if !ok {
+			// 清单中也可能记录 zip 内的完整路径
+			expected, ok = manifest[zipFile.Name]
+		}
+		if !ok {
+			return true, fmt.Errorf("%s: 清单中没有该文件的 SHA256", zipFile.Name)
+		}
+		rc, err := zipFile.Open()
+		if err != nil {
+			return true, fmt.Errorf("%s: %s", zipFile.Name, err)
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, rc)
+		rc.Close()
+		if err != nil {
+			return true, fmt.Errorf("%s: %s", zipFile.Name, err)
+		}
+		if hex.EncodeToString(h.Sum(nil)) != expected {
+			return true, fmt.Errorf("%s: SHA256 与清单不一致", zipFile.Name)
+		}
+	}
+	return true, nil
+}
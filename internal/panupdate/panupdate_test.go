@@ -0,0 +1,148 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupdate
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func newTestZip(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	f, err := w.CreateHeader(&zip.FileHeader{Name: "cloudpan189-go-v0.0.1/cloudpan189-go", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(bytes.Repeat([]byte("cloudpan189-go"), 1024))
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestVerifyZip(t *testing.T) {
+	data := newTestZip(t)
+	if err := verifyZip(data, int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyZipTruncated(t *testing.T) {
+	data := newTestZip(t)
+	truncated := data[:len(data)/2]
+	if err := verifyZip(truncated, int64(len(data))); err == nil {
+		t.Errorf("expected size error for truncated zip")
+	}
+	if err := verifyZip(truncated, int64(len(truncated))); err == nil {
+		t.Errorf("expected error for truncated zip")
+	}
+}
+
+func TestVerifyZipCorrupted(t *testing.T) {
+	data := newTestZip(t)
+	corrupted := make([]byte, len(data))
+	copy(corrupted, data)
+	// 修改文件内容, zip 结构完整但 CRC32 不一致
+	i := bytes.LastIndex(corrupted, []byte("cloudpan189-gocloudpan189-go"))
+	corrupted[i] ^= 0xff
+	if err := verifyZip(corrupted, int64(len(corrupted))); err == nil {
+		t.Errorf("expected crc32 error for corrupted zip")
+	}
+}
+
+// newTestManifestZip 创建包含 SHA256 清单的 zip, 清单按 files 的内容生成, tampered 中的文件写入被篡改后的内容
+func newTestManifestZip(t *testing.T, files map[string][]byte, tampered map[string][]byte) []byte {
+	manifest := &bytes.Buffer{}
+	for name, content := range files {
+		sum := sha256.Sum256(content)
+		fmt.Fprintf(manifest, "%s  %s\n", hex.EncodeToString(sum[:]), name)
+	}
+
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	write := func(name string, content []byte) {
+		f, err := w.Create("cloudpan189-go-v0.0.1/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(content)
+	}
+	for name, content := range files {
+		if c, ok := tampered[name]; ok {
+			content = c
+		}
+		write(name, content)
+	}
+	write(ManifestFileName, manifest.Bytes())
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func openTestZip(t *testing.T, data []byte) *zip.Reader {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reader
+}
+
+func TestVerifyZipManifest(t *testing.T) {
+	files := map[string][]byte{
+		"cloudpan189-go": bytes.Repeat([]byte("cloudpan189-go"), 1024),
+		"README.md":      []byte("readme"),
+	}
+	found, err := verifyZipManifest(openTestZip(t, newTestManifestZip(t, files, nil)))
+	if !found || err != nil {
+		t.Fatalf("found: %v, err: %v", found, err)
+	}
+
+	// 篡改程序文件, zip 的 CRC32 正确但 SHA256 与清单不一致
+	data := newTestManifestZip(t, files, map[string][]byte{
+		"cloudpan189-go": bytes.Repeat([]byte("tampered-binary"), 1024),
+	})
+	if err = verifyZip(data, int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	if found, err = verifyZipManifest(openTestZip(t, data)); !found || err == nil {
+		t.Fatalf("expected tampered binary to be rejected, found: %v, err: %v", found, err)
+	}
+
+	// 没有清单
+	if found, err = verifyZipManifest(openTestZip(t, newTestZip(t))); found || err != nil {
+		t.Fatalf("found: %v, err: %v", found, err)
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	hash := strings.Repeat("ab", sha256.Size)
+	manifest, err := parseManifest(strings.NewReader(hash + "  cloudpan189-go\n\n" + strings.ToUpper(hash) + " *README.md\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest) != 2 || manifest["cloudpan189-go"] != hash || manifest["README.md"] != hash {
+		t.Fatalf("manifest: %v", manifest)
+	}
+
+	if _, err = parseManifest(strings.NewReader("not-a-hash  cloudpan189-go\n")); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -28,10 +28,19 @@ type (
 		deque    *lane.Deque      // 队列
 		parallel int              // 任务的最大并发量
 		locker   sync.Mutex
+		stopped  bool // 已停止, 不再开始新的任务
 
 		// 是否统计失败队列
 		IsFailedDeque bool
 		failedDeque   *lane.Deque
+
+		// 未完成的任务, 包括队列中和正在执行的任务
+		pending map[*TaskInfoItem]struct{}
+
+		// 任务队列持久化
+		PersistInterval time.Duration // 保存任务队列的时间间隔, 默认为 DefaultPersistInterval
+		persistPath     string
+		persistLocker   sync.Mutex
 	}
 )
 
@@ -52,6 +61,9 @@ func (te *TaskExecutor) lazyInit() {
 	if te.IsFailedDeque {
 		te.failedDeque = lane.NewDeque()
 	}
+	if te.pending == nil {
+		te.pending = map[*TaskInfoItem]struct{}{}
+	}
 }
 
 // 设置任务的最大并发量
@@ -67,11 +79,13 @@ func (te *TaskExecutor) Append(unit TaskUnit, maxRetry int) *TaskInfo {
 		maxRetry: maxRetry,
 	}
 	unit.SetTaskInfo(taskInfo)
-	te.locker.Lock()
-	te.deque.Append(&TaskInfoItem{
+	item := &TaskInfoItem{
 		Info: taskInfo,
 		Unit: unit,
-	})
+	}
+	te.locker.Lock()
+	te.deque.Append(item)
+	te.pending[item] = struct{}{}
 	te.locker.Unlock()
 	return taskInfo
 }
@@ -92,11 +106,17 @@ func (te *TaskExecutor) Count() int {
 //Execute 执行任务
 func (te *TaskExecutor) Execute() {
 	te.lazyInit()
+	stopPersist := te.startPersist()
+	defer stopPersist()
 
 	for {
 		wg := waitgroup.NewWaitGroup(te.parallel)
 		for {
 			te.locker.Lock()
+			if te.stopped {
+				te.locker.Unlock()
+				break
+			}
 			e := te.deque.Shift()
 			te.locker.Unlock()
 			if e == nil { // 任务为空
@@ -114,6 +134,17 @@ func (te *TaskExecutor) Execute() {
 				defer wg.Done()
 
 				result := task.Unit.Run()
+				if result != nil && !result.Succeed && te.isStopped() {
+					// 已停止, 未完成的任务保留在队列中, 可以通过持久化文件恢复
+					te.locker.Lock()
+					te.deque.Append(task)
+					te.locker.Unlock()
+					return
+				}
+				if result == nil || result.Succeed || !result.NeedRetry || (task.Info.IsExceedRetry() && !result.NoRetryCount) {
+					// 任务结束, 不会再重试
+					defer te.done(task)
+				}
 
 				// 返回结果为空
 				if result == nil {
@@ -131,7 +162,7 @@ func (te *TaskExecutor) Execute() {
 				if result.NeedRetry {
 					// 重试次数超出限制
 					// 执行失败
-					if task.Info.IsExceedRetry() {
+					if task.Info.IsExceedRetry() && !result.NoRetryCount {
 						task.Unit.OnFailed(result)
 						if te.IsFailedDeque {
 							// 加入失败队列
@@ -141,7 +172,9 @@ func (te *TaskExecutor) Execute() {
 						return
 					}
 
-					task.Info.retry++         // 增加重试次数
+					if !result.NoRetryCount {
+						task.Info.retry++ // 增加重试次数
+					}
 					task.Unit.OnRetry(result) // 调用重试
 					task.Unit.OnComplete(result)
 
@@ -164,21 +197,38 @@ func (te *TaskExecutor) Execute() {
 
 		wg.Wait()
 
-		// 没有任务了
-		if te.deque.Size() == 0 {
+		// 没有任务了, 或已停止
+		if te.deque.Size() == 0 || te.isStopped() {
 			break
 		}
 	}
 }
 
+// done 任务执行结束
+func (te *TaskExecutor) done(task *TaskInfoItem) {
+	te.locker.Lock()
+	delete(te.pending, task)
+	te.locker.Unlock()
+}
+
 //FailedDeque 获取失败队列
 func (te *TaskExecutor) FailedDeque() *lane.Deque {
 	return te.failedDeque
 }
 
-//Stop 停止执行
+// Stop 停止执行, 不再开始新的任务, 正在执行的任务需要自行结束.
+// 停止后未成功的任务不会重试, 保留在队列中, 可以通过持久化文件恢复
 func (te *TaskExecutor) Stop() {
+	te.locker.Lock()
+	te.stopped = true
+	te.locker.Unlock()
+}
 
+// isStopped 是否已停止
+func (te *TaskExecutor) isStopped() bool {
+	te.locker.Lock()
+	defer te.locker.Unlock()
+	return te.stopped
 }
 
 //Pause 暂停执行
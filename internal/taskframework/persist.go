@@ -0,0 +1,204 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package taskframework
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phpc0de/ctlibgo/jsonhelper"
+)
+
+type (
+	// PersistableTaskUnit 支持持久化的任务单元
+	PersistableTaskUnit interface {
+		TaskUnit
+		// PersistedTask 返回恢复该任务所需的信息
+		PersistedTask() *PersistedTask
+	}
+
+	// PersistedTask 持久化的任务信息
+	PersistedTask struct {
+		PanPath      string `json:"pan_path"`               // 网盘路径
+		SavePath     string `json:"save_path"`              // 本地保存路径
+		SaveRootPath string `json:"save_root_path"`         // 本地保存的根目录, 用于目录展开
+		PanRootDir   string `json:"pan_root_dir,omitempty"` // 目录展开时去掉的网盘路径前缀
+		FamilyId     int64  `json:"family_id"`              // 家庭云ID, 个人云为0
+		Retry        int    `json:"retry"`                  // 已重试的次数
+		MaxRetry     int    `json:"max_retry"`              // 最大重试次数
+	}
+
+	// PersistedQueue 持久化的任务队列
+	PersistedQueue struct {
+		Tasks     []*PersistedTask `json:"tasks"`
+		Timestamp int64            `json:"timestamp"`
+	}
+)
+
+const (
+	// DefaultPersistInterval 默认保存任务队列的时间间隔
+	DefaultPersistInterval = 5 * time.Second
+)
+
+// PersistQueue 设置任务队列的持久化文件.
+// Execute 执行期间会定时把未完成的任务(包括正在执行的任务)保存到该文件, 执行结束时再保存一次,
+// 所有任务都已完成时删除该文件. 只有实现了 PersistableTaskUnit 的任务会被保存.
+func (te *TaskExecutor) PersistQueue(path string) {
+	te.persistPath = path
+}
+
+// AppendPersisted 将持久化的任务加到任务队列末尾, 恢复已重试的次数
+func (te *TaskExecutor) AppendPersisted(unit TaskUnit, task *PersistedTask) *TaskInfo {
+	info := te.Append(unit, task.MaxRetry)
+	info.retry = task.Retry
+	return info
+}
+
+// PersistedTasks 返回所有未完成的任务, 按任务id排序
+func (te *TaskExecutor) PersistedTasks() []*PersistedTask {
+	te.locker.Lock()
+	items := make([]*TaskInfoItem, 0, len(te.pending))
+	for item := range te.pending {
+		items = append(items, item)
+	}
+	te.locker.Unlock()
+
+	sort.Slice(items, func(i, j int) bool {
+		a, _ := strconv.Atoi(items[i].Info.id)
+		b, _ := strconv.Atoi(items[j].Info.id)
+		return a < b
+	})
+
+	tasks := make([]*PersistedTask, 0, len(items))
+	for _, item := range items {
+		unit, ok := item.Unit.(PersistableTaskUnit)
+		if !ok {
+			continue
+		}
+		task := unit.PersistedTask()
+		if task == nil {
+			continue
+		}
+		task.Retry = item.Info.Retry()
+		task.MaxRetry = item.Info.MaxRetry()
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+// SaveQueue 保存未完成的任务到持久化文件, 没有未完成的任务时删除该文件
+func (te *TaskExecutor) SaveQueue() error {
+	if te.persistPath == "" {
+		return nil
+	}
+
+	te.persistLocker.Lock()
+	defer te.persistLocker.Unlock()
+
+	tasks := te.PersistedTasks()
+	if len(tasks) == 0 {
+		err := os.Remove(te.persistPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return SavePersistedQueue(te.persistPath, &PersistedQueue{
+		Tasks:     tasks,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// startPersist 定时保存任务队列, 返回停止的函数
+func (te *TaskExecutor) startPersist() (stop func()) {
+	if te.persistPath == "" {
+		return func() {}
+	}
+
+	interval := te.PersistInterval
+	if interval <= 0 {
+		interval = DefaultPersistInterval
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				te.SaveQueue()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+		te.SaveQueue()
+	}
+}
+
+// SavePersistedQueue 保存任务队列到文件, 先写入临时文件再重命名, 避免程序中断导致文件损坏
+func SavePersistedQueue(path string, queue *PersistedQueue) error {
+	builder := &strings.Builder{}
+	err := jsonhelper.MarshalData(builder, queue)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(builder.String())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// LoadPersistedQueue 读取持久化的任务队列, 文件不存在时返回 nil
+func LoadPersistedQueue(path string) (*PersistedQueue, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	queue := &PersistedQueue{}
+	err = jsonhelper.UnmarshalData(file, queue)
+	if err != nil {
+		return nil, err
+	}
+	return queue, nil
+}
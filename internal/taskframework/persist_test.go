@@ -0,0 +1,130 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package taskframework_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/phpc0de/ctpango/internal/taskframework"
+)
+
+type (
+	PersistUnit struct {
+		TestUnit
+		panPath string
+	}
+)
+
+func (pu *PersistUnit) Run() (result *taskframework.TaskUnitRunResult) {
+	return &taskframework.TaskUnitRunResult{Succeed: true}
+}
+
+func (pu *PersistUnit) RetryWait() time.Duration {
+	return 0
+}
+
+func (pu *PersistUnit) PersistedTask() *taskframework.PersistedTask {
+	return &taskframework.PersistedTask{
+		PanPath:      pu.panPath,
+		SavePath:     filepath.Join("download", pu.panPath),
+		SaveRootPath: "download",
+		FamilyId:     123,
+	}
+}
+
+func persistTempPath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "taskframework")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "queue.json")
+}
+
+func TestPersistedQueueRoundTrip(t *testing.T) {
+	queuePath := persistTempPath(t)
+	queue := &taskframework.PersistedQueue{
+		Tasks: []*taskframework.PersistedTask{
+			{PanPath: "/a/1.mp4", SavePath: "/tmp/a/1.mp4", SaveRootPath: "/tmp", FamilyId: 0, Retry: 1, MaxRetry: 3},
+			{PanPath: "/b", SavePath: "/tmp/b", SaveRootPath: "/tmp", FamilyId: 456, Retry: 0, MaxRetry: 3},
+		},
+		Timestamp: 1600000000,
+	}
+	if err := taskframework.SavePersistedQueue(queuePath, queue); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := taskframework.LoadPersistedQueue(queuePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(queue, loaded) {
+		t.Fatalf("round trip mismatch: %+v", loaded)
+	}
+
+	// 文件不存在
+	loaded, err = taskframework.LoadPersistedQueue(queuePath + ".notexist")
+	if err != nil || loaded != nil {
+		t.Fatalf("not exist: %v %v", loaded, err)
+	}
+}
+
+func TestTaskExecutorPersistQueue(t *testing.T) {
+	queuePath := persistTempPath(t)
+	te := taskframework.NewTaskExecutor()
+	te.PersistQueue(queuePath)
+	te.Append(&PersistUnit{panPath: "/1.mp4"}, 3)
+	te.AppendPersisted(&PersistUnit{panPath: "/2.mp4"}, &taskframework.PersistedTask{Retry: 2, MaxRetry: 5})
+	te.Append(&TestUnit{}, 1) // 不支持持久化的任务会被忽略
+
+	if err := te.SaveQueue(); err != nil {
+		t.Fatal(err)
+	}
+	queue, err := taskframework.LoadPersistedQueue(queuePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue == nil || len(queue.Tasks) != 2 {
+		t.Fatalf("unexpected queue: %+v", queue)
+	}
+	if queue.Tasks[0].PanPath != "/1.mp4" || queue.Tasks[0].MaxRetry != 3 || queue.Tasks[0].Retry != 0 {
+		t.Fatalf("task 0: %+v", queue.Tasks[0])
+	}
+	if queue.Tasks[1].PanPath != "/2.mp4" || queue.Tasks[1].MaxRetry != 5 || queue.Tasks[1].Retry != 2 || queue.Tasks[1].FamilyId != 123 {
+		t.Fatalf("task 1: %+v", queue.Tasks[1])
+	}
+}
+
+func TestTaskExecutorPersistQueueDone(t *testing.T) {
+	queuePath := persistTempPath(t)
+	te := taskframework.NewTaskExecutor()
+	te.PersistQueue(queuePath)
+	te.SetParallel(2)
+	for _, p := range []string{"/1.mp4", "/2.mp4", "/3.mp4"} {
+		te.Append(&PersistUnit{panPath: p}, 1)
+	}
+	if err := te.SaveQueue(); err != nil {
+		t.Fatal(err)
+	}
+	te.Execute()
+
+	// 所有任务已完成, 删除队列文件
+	if _, err := os.Stat(queuePath); !os.IsNotExist(err) {
+		t.Fatalf("queue file should be removed: %v", err)
+	}
+}
@@ -35,8 +35,9 @@ type (
 
 	// 任务单元执行结果
 	TaskUnitRunResult struct {
-		Succeed       bool        // 是否执行成功
-		NeedRetry     bool        // 是否需要重试
+		Succeed      bool // 是否执行成功
+		NeedRetry    bool // 是否需要重试
+		NoRetryCount bool // 重试时不计入重试次数, 由任务单元自行限制重试次数
 
 		// 以下是额外的信息
 		Err           error       // 错误信息
@@ -70,3 +70,124 @@ func TestTaskExecutor(t *testing.T) {
 	}
 	te.Execute()
 }
+
+type (
+	// noRetryCountUnit 前 noCount 次失败不计入重试次数, 之后的失败计入
+	noRetryCountUnit struct {
+		taskInfo *taskframework.TaskInfo
+		noCount  int
+		runs     int
+		failed   bool
+	}
+)
+
+func (u *noRetryCountUnit) SetTaskInfo(taskInfo *taskframework.TaskInfo) {
+	u.taskInfo = taskInfo
+}
+
+func (u *noRetryCountUnit) Run() (result *taskframework.TaskUnitRunResult) {
+	u.runs++
+	return &taskframework.TaskUnitRunResult{
+		NeedRetry:    true,
+		NoRetryCount: u.runs <= u.noCount,
+	}
+}
+
+func (u *noRetryCountUnit) OnRetry(lastRunResult *taskframework.TaskUnitRunResult) {}
+
+func (u *noRetryCountUnit) OnSuccess(lastRunResult *taskframework.TaskUnitRunResult) {}
+
+func (u *noRetryCountUnit) OnFailed(lastRunResult *taskframework.TaskUnitRunResult) {
+	u.failed = true
+}
+
+func (u *noRetryCountUnit) OnComplete(lastRunResult *taskframework.TaskUnitRunResult) {}
+
+func (u *noRetryCountUnit) RetryWait() time.Duration {
+	return 0
+}
+
+func TestTaskExecutorNoRetryCount(t *testing.T) {
+	te := taskframework.NewTaskExecutor()
+	unit := &noRetryCountUnit{noCount: 2}
+	te.Append(unit, 1)
+	te.Execute()
+
+	// 2 次不计数的重试 + 1 次执行 + 1 次计数的重试
+	if unit.runs != 4 {
+		t.Errorf("runs = %d, want 4", unit.runs)
+	}
+	if unit.taskInfo.Retry() != 1 {
+		t.Errorf("Retry() = %d, want 1", unit.taskInfo.Retry())
+	}
+	if !unit.failed {
+		t.Error("unit should fail after exhausting retries")
+	}
+}
+
+type (
+	// stopUnit 执行时停止 executor, 模拟收到退出信号
+	stopUnit struct {
+		taskInfo *taskframework.TaskInfo
+		executor *taskframework.TaskExecutor
+		stop     bool
+		runs     int
+		callback bool
+	}
+)
+
+func (u *stopUnit) SetTaskInfo(taskInfo *taskframework.TaskInfo) {
+	u.taskInfo = taskInfo
+}
+
+func (u *stopUnit) Run() (result *taskframework.TaskUnitRunResult) {
+	u.runs++
+	if u.stop {
+		u.executor.Stop()
+	}
+	return &taskframework.TaskUnitRunResult{NeedRetry: true}
+}
+
+func (u *stopUnit) OnRetry(lastRunResult *taskframework.TaskUnitRunResult) {
+	u.callback = true
+}
+
+func (u *stopUnit) OnSuccess(lastRunResult *taskframework.TaskUnitRunResult) {
+	u.callback = true
+}
+
+func (u *stopUnit) OnFailed(lastRunResult *taskframework.TaskUnitRunResult) {
+	u.callback = true
+}
+
+func (u *stopUnit) OnComplete(lastRunResult *taskframework.TaskUnitRunResult) {
+	u.callback = true
+}
+
+func (u *stopUnit) RetryWait() time.Duration {
+	return 0
+}
+
+func TestTaskExecutorStop(t *testing.T) {
+	te := taskframework.NewTaskExecutor()
+	first := &stopUnit{executor: te, stop: true}
+	te.Append(first, 3)
+	for i := 0; i < 2; i++ {
+		te.Append(&stopUnit{executor: te}, 3)
+	}
+	te.Execute()
+
+	if first.runs != 1 {
+		t.Errorf("stopped unit runs = %d, want 1", first.runs)
+	}
+	if first.callback {
+		t.Error("stopped unit should not be retried or failed")
+	}
+	if first.taskInfo.Retry() != 0 {
+		t.Errorf("stopped unit Retry() = %d, want 0", first.taskInfo.Retry())
+	}
+	// 未完成的任务保留在队列中
+	if te.Count() != 3 {
+		t.Errorf("Count() = %d, want 3", te.Count())
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // TrimPathPrefix 去除目录的前缀
@@ -42,6 +43,21 @@ func ContainsString(ss []string, s string) bool {
 	return false
 }
 
+// TruncateName 文件名超过 maxLength 个字符时截断中间的部分, 以 ... 代替, 截断后的长度为 maxLength,
+// 保留开头和结尾, 使扩展名和路径中的文件名仍然可见. maxLength 小于等于0时不截断
+func TruncateName(name string, maxLength int) string {
+	if maxLength <= 0 || utf8.RuneCountInString(name) <= maxLength {
+		return name
+	}
+	runes := []rune(name)
+	if maxLength <= 3 {
+		return string(runes[:maxLength])
+	}
+	head := (maxLength - 3 + 1) / 2
+	tail := maxLength - 3 - head
+	return string(runes[:head]) + "..." + string(runes[len(runes)-tail:])
+}
+
 // GetURLCookieString 返回cookie字串
 func GetURLCookieString(urlString string, jar *cookiejar.Jar) string {
 	u, _ := url.Parse(urlString)
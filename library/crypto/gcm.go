@@ -0,0 +1,322 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// 分段 AES-256-GCM 加密格式:
+//
+//	文件头: 魔数(8字节) + 随机nonce前缀(7字节)
+//	数据段: 每段明文 GCMSegmentSize 字节, 加密后追加16字节校验tag, 最后一段可以不足 GCMSegmentSize
+//
+// 每段的nonce为 nonce前缀(7字节) + 段序号(4字节, 大端) + 是否最后一段(1字节),
+// 可以检测数据段被截断, 重排或篡改.
+const (
+	// GCMKeySize AES-256-GCM 密钥长度
+	GCMKeySize = 32
+	// GCMSegmentSize 每个加密段的明文长度
+	GCMSegmentSize = 64 * 1024
+	// GCMEncryptedSuffix 加密文件的后缀
+	GCMEncryptedSuffix = ".enc"
+
+	gcmNoncePrefixSize = 7
+)
+
+var (
+	gcmMagic      = []byte("CP189GCM")
+	gcmHeaderSize = len(gcmMagic) + gcmNoncePrefixSize
+
+	// ErrGCMKeySize 密钥长度错误
+	ErrGCMKeySize = errors.New("密钥长度错误, 需要32字节的密钥或64位的十六进制字符串")
+	// ErrGCMHeader 文件头错误, 不是加密文件
+	ErrGCMHeader = errors.New("不是有效的加密文件")
+	// ErrGCMTruncated 加密数据不完整
+	ErrGCMTruncated = errors.New("加密数据不完整")
+	// ErrGCMAuthFailed 解密失败, 密钥错误或数据被篡改
+	ErrGCMAuthFailed = errors.New("解密失败, 密钥错误或数据已损坏")
+)
+
+type (
+	gcmEncryptReader struct {
+		aead    cipher.AEAD
+		src     *bufio.Reader
+		prefix  []byte
+		counter uint32
+		plain   []byte
+		out     []byte
+		done    bool
+	}
+
+	gcmDecryptWriter struct {
+		aead    cipher.AEAD
+		dst     io.Writer
+		prefix  []byte
+		counter uint32
+		buf     []byte
+		closed  bool
+	}
+)
+
+// LoadGCMKeyFile 从文件读取 AES-256-GCM 密钥, 文件内容为32字节的原始密钥, 或64位的十六进制字符串
+func LoadGCMKeyFile(keyFile string) ([]byte, error) {
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == GCMKeySize {
+		return data, nil
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == GCMKeySize*2 {
+		key, err := hex.DecodeString(string(trimmed))
+		if err == nil {
+			return key, nil
+		}
+	}
+	return nil, ErrGCMKeySize
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != GCMKeySize {
+		return nil, ErrGCMKeySize
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func gcmNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, gcmNoncePrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[gcmNoncePrefixSize:], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// GCMEncryptedSize 返回明文长度为 size 时加密后的数据长度
+func GCMEncryptedSize(size int64) int64 {
+	segments := (size + GCMSegmentSize - 1) / GCMSegmentSize
+	if segments == 0 {
+		// 空文件也会加密一个空的数据段
+		segments = 1
+	}
+	return int64(gcmHeaderSize) + size + segments*16
+}
+
+// NewGCMEncryptReader 返回一个 io.Reader, 读取 src 的数据并使用 AES-256-GCM 分段加密
+func NewGCMEncryptReader(key []byte, src io.Reader) (io.Reader, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, gcmNoncePrefixSize)
+	if _, err = io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, gcmHeaderSize)
+	out = append(out, gcmMagic...)
+	out = append(out, prefix...)
+	return &gcmEncryptReader{
+		aead:   aead,
+		src:    bufio.NewReaderSize(src, GCMSegmentSize),
+		prefix: prefix,
+		plain:  make([]byte, GCMSegmentSize),
+		out:    out,
+	}, nil
+}
+
+func (er *gcmEncryptReader) Read(p []byte) (int, error) {
+	for len(er.out) == 0 {
+		if er.done {
+			return 0, io.EOF
+		}
+		if err := er.sealSegment(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, er.out)
+	er.out = er.out[n:]
+	return n, nil
+}
+
+// sealSegment 读取并加密下一段数据
+func (er *gcmEncryptReader) sealSegment() error {
+	n, err := io.ReadFull(er.src, er.plain)
+	last := false
+	switch err {
+	case nil:
+		// 预读一个字节, 判断是否为最后一段
+		if _, peekErr := er.src.Peek(1); peekErr == io.EOF {
+			last = true
+		} else if peekErr != nil {
+			return peekErr
+		}
+	case io.EOF, io.ErrUnexpectedEOF:
+		last = true
+	default:
+		return err
+	}
+
+	er.out = er.aead.Seal(er.out[:0], gcmNonce(er.prefix, er.counter, last), er.plain[:n], nil)
+	er.counter++
+	er.done = last
+	return nil
+}
+
+// NewGCMDecryptWriter 返回一个 io.WriteCloser, 写入的加密数据解密后写入 dst,
+// 写入完成后必须调用 Close, 以解密最后一段数据并检测数据是否完整
+func NewGCMDecryptWriter(key []byte, dst io.Writer) (io.WriteCloser, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &gcmDecryptWriter{
+		aead: aead,
+		dst:  dst,
+	}, nil
+}
+
+func (dw *gcmDecryptWriter) Write(p []byte) (int, error) {
+	if dw.closed {
+		return 0, os.ErrClosed
+	}
+	dw.buf = append(dw.buf, p...)
+	if dw.prefix == nil {
+		if len(dw.buf) < gcmHeaderSize {
+			return len(p), nil
+		}
+		if !bytes.Equal(dw.buf[:len(gcmMagic)], gcmMagic) {
+			return 0, ErrGCMHeader
+		}
+		dw.prefix = append([]byte{}, dw.buf[len(gcmMagic):gcmHeaderSize]...)
+		dw.buf = dw.buf[gcmHeaderSize:]
+	}
+
+	// 至少多出一个字节时才能确定当前段不是最后一段
+	segSize := GCMSegmentSize + dw.aead.Overhead()
+	for len(dw.buf) > segSize {
+		if err := dw.openSegment(dw.buf[:segSize], false); err != nil {
+			return 0, err
+		}
+		dw.buf = dw.buf[segSize:]
+	}
+	return len(p), nil
+}
+
+// Close 解密最后一段数据
+func (dw *gcmDecryptWriter) Close() error {
+	if dw.closed {
+		return nil
+	}
+	dw.closed = true
+	if dw.prefix == nil {
+		if len(dw.buf) >= len(gcmMagic) && !bytes.Equal(dw.buf[:len(gcmMagic)], gcmMagic) {
+			return ErrGCMHeader
+		}
+		return ErrGCMTruncated
+	}
+	if len(dw.buf) < dw.aead.Overhead() {
+		return ErrGCMTruncated
+	}
+	return dw.openSegment(dw.buf, true)
+}
+
+func (dw *gcmDecryptWriter) openSegment(segment []byte, last bool) error {
+	plain, err := dw.aead.Open(nil, gcmNonce(dw.prefix, dw.counter, last), segment, nil)
+	if err != nil {
+		return ErrGCMAuthFailed
+	}
+	dw.counter++
+	_, err = dw.dst.Write(plain)
+	return err
+}
+
+// EncryptFileGCM 使用 AES-256-GCM 加密 srcPath, 保存到 dstPath
+func EncryptFileGCM(key []byte, srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	r, err := NewGCMEncryptReader(key, src)
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, r)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// DecryptFileGCM 解密由 EncryptFileGCM 加密的 srcPath, 保存到 dstPath.
+// 先解密到同目录下的临时文件, 全部数据校验通过后才替换 dstPath,
+// 所以解密失败时不会覆盖已存在的 dstPath
+func DecryptFileGCM(key []byte, srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := ioutil.TempFile(filepath.Dir(dstPath), "."+filepath.Base(dstPath)+".*.decrypting")
+	if err != nil {
+		return err
+	}
+	tmpPath := dst.Name()
+	w, err := NewGCMDecryptWriter(key, dst)
+	if err == nil {
+		_, err = io.Copy(w, src)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// ioutil.TempFile 创建的文件权限为 0600
+		err = os.Chmod(tmpPath, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, dstPath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	return err
+}
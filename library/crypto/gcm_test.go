@@ -0,0 +1,187 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypto_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/phpc0de/ctpango/library/crypto"
+)
+
+var testGCMKey = bytes.Repeat([]byte{0x42}, crypto.GCMKeySize)
+
+func gcmEncrypt(t *testing.T, key, plain []byte) []byte {
+	r, err := crypto.NewGCMEncryptReader(key, bytes.NewReader(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// gcmDecrypt 每次写入 chunk 字节, 模拟分块写入
+func gcmDecrypt(key, data []byte, chunk int) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w, err := crypto.NewGCMDecryptWriter(key, buf)
+	if err != nil {
+		return nil, err
+	}
+	for len(data) > 0 {
+		n := chunk
+		if n > len(data) {
+			n = len(data)
+		}
+		if _, err = w.Write(data[:n]); err != nil {
+			return nil, err
+		}
+		data = data[n:]
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func TestGCMRoundTrip(t *testing.T) {
+	sizes := []int{0, 1, 100, crypto.GCMSegmentSize - 1, crypto.GCMSegmentSize, crypto.GCMSegmentSize + 1, 3*crypto.GCMSegmentSize + 17}
+	for _, size := range sizes {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		data := gcmEncrypt(t, testGCMKey, plain)
+		if int64(len(data)) != crypto.GCMEncryptedSize(int64(size)) {
+			t.Fatalf("size %d: encrypted size %d, want %d", size, len(data), crypto.GCMEncryptedSize(int64(size)))
+		}
+		for _, chunk := range []int{1000, 4096, len(data)} {
+			got, err := gcmDecrypt(testGCMKey, data, chunk)
+			if err != nil {
+				t.Fatalf("size %d chunk %d: %s", size, chunk, err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Fatalf("size %d chunk %d: plaintext mismatch", size, chunk)
+			}
+		}
+	}
+}
+
+func TestGCMDecryptErrors(t *testing.T) {
+	plain := make([]byte, 2*crypto.GCMSegmentSize+10)
+	rand.Read(plain)
+	data := gcmEncrypt(t, testGCMKey, plain)
+
+	wrongKey := bytes.Repeat([]byte{0x24}, crypto.GCMKeySize)
+	if _, err := gcmDecrypt(wrongKey, data, len(data)); err != crypto.ErrGCMAuthFailed {
+		t.Fatalf("wrong key: got %v", err)
+	}
+
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)/2] ^= 0xff
+	if _, err := gcmDecrypt(testGCMKey, tampered, len(tampered)); err != crypto.ErrGCMAuthFailed {
+		t.Fatalf("tampered: got %v", err)
+	}
+
+	// 在段边界截断, 最后一段标记不匹配
+	truncated := data[:len(data)-(10+16)]
+	if _, err := gcmDecrypt(testGCMKey, truncated, len(truncated)); err != crypto.ErrGCMAuthFailed {
+		t.Fatalf("truncated: got %v", err)
+	}
+
+	if _, err := gcmDecrypt(testGCMKey, plain, len(plain)); err != crypto.ErrGCMHeader {
+		t.Fatalf("not encrypted: got %v", err)
+	}
+	if _, err := gcmDecrypt(testGCMKey, data[:5], 5); err != crypto.ErrGCMTruncated {
+		t.Fatalf("header only: got %v", err)
+	}
+}
+
+func TestLoadGCMKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcmkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rawFile := filepath.Join(dir, "raw.key")
+	ioutil.WriteFile(rawFile, testGCMKey, 0600)
+	if key, err := crypto.LoadGCMKeyFile(rawFile); err != nil || !bytes.Equal(key, testGCMKey) {
+		t.Fatalf("raw key: %v", err)
+	}
+
+	hexFile := filepath.Join(dir, "hex.key")
+	ioutil.WriteFile(hexFile, []byte("4242424242424242424242424242424242424242424242424242424242424242\n"), 0600)
+	if key, err := crypto.LoadGCMKeyFile(hexFile); err != nil || !bytes.Equal(key, testGCMKey) {
+		t.Fatalf("hex key: %v", err)
+	}
+
+	shortFile := filepath.Join(dir, "short.key")
+	ioutil.WriteFile(shortFile, []byte("short"), 0600)
+	if _, err := crypto.LoadGCMKeyFile(shortFile); err != crypto.ErrGCMKeySize {
+		t.Fatalf("short key: got %v", err)
+	}
+}
+
+func TestGCMFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcmfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plain := make([]byte, crypto.GCMSegmentSize*2+123)
+	rand.Read(plain)
+	src := filepath.Join(dir, "1.bin")
+	ioutil.WriteFile(src, plain, 0600)
+
+	enc := src + crypto.GCMEncryptedSuffix
+	if err = crypto.EncryptFileGCM(testGCMKey, src, enc); err != nil {
+		t.Fatal(err)
+	}
+	dec := filepath.Join(dir, "2.bin")
+	if err = crypto.DecryptFileGCM(testGCMKey, enc, dec); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadFile(dec)
+	if !bytes.Equal(got, plain) {
+		t.Fatal("plaintext mismatch")
+	}
+
+	// 解密失败时不保留不完整的文件
+	wrongKey := bytes.Repeat([]byte{0x24}, crypto.GCMKeySize)
+	bad := filepath.Join(dir, "3.bin")
+	if err = crypto.DecryptFileGCM(wrongKey, enc, bad); err != crypto.ErrGCMAuthFailed {
+		t.Fatalf("wrong key: got %v", err)
+	}
+	if _, err = os.Stat(bad); !os.IsNotExist(err) {
+		t.Fatal("partial file not removed")
+	}
+
+	// 解密失败时不覆盖已存在的文件
+	if err = crypto.DecryptFileGCM(wrongKey, enc, dec); err != crypto.ErrGCMAuthFailed {
+		t.Fatalf("wrong key: got %v", err)
+	}
+	if got, _ = ioutil.ReadFile(dec); !bytes.Equal(got, plain) {
+		t.Fatal("existing file overwritten")
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 3 {
+		t.Fatalf("temp file left: %d files", len(files))
+	}
+}
@@ -30,6 +30,12 @@ type (
 		TimeLeft() time.Duration    // 预计剩余时间, 负数代表未知
 	}
 
+	// speedsSample 速度采样, 记录采样时的累计数据量
+	speedsSample struct {
+		time  time.Time
+		total int64
+	}
+
 	//DownloadStatus 下载状态及统计信息
 	DownloadStatus struct {
 		totalSize        int64         // 总大小
@@ -41,7 +47,12 @@ type (
 
 		startTime time.Time // 开始下载的时间
 
-		rateLimit *speeds.RateLimit // 限速控制
+		rateLimit RateLimiter // 限速控制
+
+		speedsTotal   int64          // 用于计算滑动窗口平均速度的累计数据量
+		speedsWindow  time.Duration  // 计算速度的滑动窗口, 0为只统计最近1秒
+		speedsSamples []speedsSample // 滑动窗口内的采样
+		speedsMu      sync.Mutex
 
 		gen *RangeListGen // Range生成状态
 		mu  sync.Mutex
@@ -56,7 +67,7 @@ func NewDownloadStatus() *DownloadStatus {
 }
 
 // SetRateLimit 设置限速
-func (ds *DownloadStatus) SetRateLimit(rl *speeds.RateLimit) {
+func (ds *DownloadStatus) SetRateLimit(rl RateLimiter) {
 	ds.rateLimit = rl
 }
 
@@ -81,6 +92,16 @@ func (ds *DownloadStatus) AddSpeedsDownloaded(d int64) {
 		ds.rateLimit.Add(d)
 	}
 	ds.speedsStat.Add(d)
+	atomic.AddInt64(&ds.speedsTotal, d)
+}
+
+// SetSpeedsWindow 设置计算速度的滑动窗口, 显示的速度为窗口内的平均速度.
+// 窗口越小速度变化越及时但波动越大, 窗口越大速度越平滑但反映网络变化越慢
+func (ds *DownloadStatus) SetSpeedsWindow(window time.Duration) {
+	ds.speedsMu.Lock()
+	defer ds.speedsMu.Unlock()
+	ds.speedsWindow = window
+	ds.speedsSamples = nil
 }
 
 //SetMaxSpeeds 设置最大速度, 原子操作
@@ -107,7 +128,28 @@ func (ds *DownloadStatus) Downloaded() int64 {
 
 // UpdateSpeeds 更新speeds
 func (ds *DownloadStatus) UpdateSpeeds() {
-	atomic.StoreInt64(&ds.tmpSpeeds, ds.speedsStat.GetSpeeds())
+	ds.updateSpeedsAt(time.Now())
+}
+
+func (ds *DownloadStatus) updateSpeedsAt(now time.Time) {
+	speeds := ds.speedsStat.GetSpeeds()
+
+	ds.speedsMu.Lock()
+	if ds.speedsWindow > 0 {
+		ds.speedsSamples = append(ds.speedsSamples, speedsSample{time: now, total: atomic.LoadInt64(&ds.speedsTotal)})
+		// 去掉窗口外的采样, 保留一个窗口起点之前的采样作为计算的起点
+		i := 0
+		for i+1 < len(ds.speedsSamples) && !ds.speedsSamples[i+1].time.After(now.Add(-ds.speedsWindow)) {
+			i++
+		}
+		ds.speedsSamples = ds.speedsSamples[i:]
+		if first, last := ds.speedsSamples[0], ds.speedsSamples[len(ds.speedsSamples)-1]; last.time.After(first.time) {
+			speeds = int64(float64(last.total-first.total) / last.time.Sub(first.time).Seconds())
+		}
+	}
+	ds.speedsMu.Unlock()
+
+	atomic.StoreInt64(&ds.tmpSpeeds, speeds)
 }
 
 //SpeedsPerSecond 返回每秒速度
@@ -0,0 +1,44 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package transfer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDownloadStatusSpeedsWindow(t *testing.T) {
+	ds := NewDownloadStatus()
+	ds.SetSpeedsWindow(3 * time.Second)
+
+	// 每秒下载量: 100, 100, 100, 400
+	start := time.Now()
+	ds.updateSpeedsAt(start)
+	for i, n := range []int64{100, 100, 100, 400} {
+		ds.AddSpeedsDownloaded(n)
+		ds.updateSpeedsAt(start.Add(time.Duration(i+1) * time.Second))
+	}
+	// 最近3秒的平均速度: (100+100+400)/3
+	if speeds := ds.SpeedsPerSecond(); speeds != 200 {
+		t.Errorf("3s window speeds: %d, want 200", speeds)
+	}
+
+	ds.SetSpeedsWindow(time.Second)
+	ds.updateSpeedsAt(start.Add(5 * time.Second))
+	ds.AddSpeedsDownloaded(50)
+	ds.updateSpeedsAt(start.Add(6 * time.Second))
+	if speeds := ds.SpeedsPerSecond(); speeds != 50 {
+		t.Errorf("1s window speeds: %d, want 50", speeds)
+	}
+}
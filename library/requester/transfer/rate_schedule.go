@@ -0,0 +1,131 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package transfer
+
+import (
+	"context"
+	"github.com/phpc0de/ctlibgo/requester/rio/speeds"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// RateScheduleCheckInterval 检查限速计划的时间间隔
+	RateScheduleCheckInterval = 1 * time.Minute
+)
+
+// RateLimitValue 将限速值转换为 speeds.RateLimit 使用的值, 小于等于0代表不限制
+func RateLimitValue(rate int64) int64 {
+	if rate <= 0 {
+		return math.MaxInt64
+	}
+	return rate
+}
+
+type (
+	// RateLimiter 限速器, Add 在超出限速时阻塞
+	RateLimiter interface {
+		Add(count int64)
+	}
+
+	// ScheduledRateLimit 按时间段限速, 进入限速值不同的时间段时换用新的 speeds.RateLimit.
+	// speeds.RateLimit 按开始以来的平均速度限速, 且 MaxRate 不能在使用中修改, 所以每个时间段单独计算
+	ScheduledRateLimit struct {
+		rateAt  func(now time.Time) int64
+		current atomic.Value        // *scheduledLimit
+		retired []*speeds.RateLimit // 已换下的限速器, 可能仍有阻塞的 Add, Stop 时再停止
+		mu      sync.Mutex
+	}
+
+	scheduledLimit struct {
+		rate int64             // 小于等于0代表不限制
+		rl   *speeds.RateLimit // 不限制时为nil
+	}
+)
+
+// NewScheduledRateLimit 初始化, 使用 rateAt 返回的当前时间的限速值, rateAt 返回小于等于0代表不限制
+func NewScheduledRateLimit(rateAt func(now time.Time) int64) *ScheduledRateLimit {
+	srl := &ScheduledRateLimit{
+		rateAt: rateAt,
+	}
+	srl.current.Store(newScheduledLimit(rateAt(time.Now())))
+	return srl
+}
+
+func newScheduledLimit(rate int64) *scheduledLimit {
+	if rate <= 0 {
+		return &scheduledLimit{}
+	}
+	return &scheduledLimit{rate: rate, rl: speeds.NewRateLimit(rate)}
+}
+
+// Add 按当前时间段的限速值限速
+func (srl *ScheduledRateLimit) Add(count int64) {
+	if l := srl.current.Load().(*scheduledLimit); l.rl != nil {
+		l.rl.Add(count)
+	}
+}
+
+// Rate 返回当前的限速值, 0代表不限制
+func (srl *ScheduledRateLimit) Rate() int64 {
+	return srl.current.Load().(*scheduledLimit).rate
+}
+
+// update 限速值改变时换用新的限速器
+func (srl *ScheduledRateLimit) update(now time.Time) {
+	rate := srl.rateAt(now)
+	if rate < 0 {
+		rate = 0
+	}
+
+	srl.mu.Lock()
+	defer srl.mu.Unlock()
+	old := srl.current.Load().(*scheduledLimit)
+	if old.rate == rate {
+		return
+	}
+	srl.current.Store(newScheduledLimit(rate))
+	if old.rl != nil {
+		srl.retired = append(srl.retired, old.rl)
+	}
+}
+
+// Run 定时检查限速计划, 直到 ctx 结束
+func (srl *ScheduledRateLimit) Run(ctx context.Context) {
+	ticker := time.NewTicker(RateScheduleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			srl.update(now)
+		}
+	}
+}
+
+// Stop 停止所有限速器, 传输结束后调用
+func (srl *ScheduledRateLimit) Stop() {
+	srl.mu.Lock()
+	defer srl.mu.Unlock()
+	if l := srl.current.Load().(*scheduledLimit); l.rl != nil {
+		l.rl.Stop()
+	}
+	for _, rl := range srl.retired {
+		rl.Stop()
+	}
+	srl.retired = nil
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package transfer
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduledRateLimit(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		rate int64 = 1000
+	)
+	srl := NewScheduledRateLimit(func(now time.Time) int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return rate
+	})
+	defer srl.Stop()
+
+	first := srl.current.Load().(*scheduledLimit)
+	if srl.Rate() != 1000 || first.rl == nil {
+		t.Fatalf("rate = %d", srl.Rate())
+	}
+
+	// 限速值不变时继续使用原来的限速器
+	srl.update(time.Now())
+	if srl.current.Load().(*scheduledLimit) != first {
+		t.Fatal("rate limit replaced without rate change")
+	}
+
+	// 进入新的时间段, 换用新的限速器, 不修改正在使用的限速器
+	mu.Lock()
+	rate = 2000
+	mu.Unlock()
+	srl.update(time.Now())
+	if srl.Rate() != 2000 || srl.current.Load().(*scheduledLimit) == first || first.rl.MaxRate != 1000 {
+		t.Fatalf("rate = %d", srl.Rate())
+	}
+
+	// 不限速
+	mu.Lock()
+	rate = 0
+	mu.Unlock()
+	srl.update(time.Now())
+	if srl.Rate() != 0 || len(srl.retired) != 2 {
+		t.Fatalf("rate = %d, retired = %d", srl.Rate(), len(srl.retired))
+	}
+	srl.Add(1 << 40) // 不限速时不会阻塞
+}
+
+func TestScheduledRateLimitConcurrent(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		rate int64
+	)
+	srl := NewScheduledRateLimit(func(now time.Time) int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return rate
+	})
+	defer srl.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				srl.Add(1)
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		mu.Lock()
+		rate = int64(i%2) * (1 << 30)
+		mu.Unlock()
+		srl.update(time.Now())
+	}
+	wg.Wait()
+}
@@ -13,6 +13,10 @@ fi
 
 output="out"
 
+commit=$(git rev-parse --short HEAD 2>/dev/null || echo unknown)
+build_date=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+buildinfo="-X main.Version=$version -X github.com/phpc0de/ctpango/internal/config.BuildCommit=$commit -X github.com/phpc0de/ctpango/internal/config.BuildDate=$build_date"
+
 default_golang() {
   export GOROOT=/usr/local/go
   go=$GOROOT/bin/go
@@ -27,7 +31,7 @@ Build() {
 
   echo "Building $1..."
   export GOOS=$2 GOARCH=$3 GO386=sse2 CGO_ENABLED=0 GOARM=$4
-  $go build -ldflags "-X main.Version=$version -s -w" -o "$output/$1/$name"
+  $go build -ldflags "$buildinfo -s -w" -o "$output/$1/$name"
   RicePack $1 $name
 
   Pack $1 $2
@@ -30,8 +30,11 @@ import (
 	"github.com/phpc0de/ctpango/cmder/cmdliner/args"
 	"github.com/phpc0de/ctpango/cmder/cmdutil"
 	"github.com/phpc0de/ctpango/cmder/cmdutil/escaper"
+	"github.com/phpc0de/ctpango/internal/apistat"
 	"github.com/phpc0de/ctpango/internal/command"
 	"github.com/phpc0de/ctpango/internal/config"
+	"github.com/phpc0de/ctpango/internal/jsonlog"
+	"github.com/phpc0de/ctpango/internal/logfile"
 	"github.com/phpc0de/ctpango/internal/panupdate"
 	"github.com/phpc0de/ctpango/internal/utils"
 	"github.com/phpc0de/ctlibgo/converter"
@@ -81,8 +84,13 @@ func checkLoginExpiredAndRelogin() {
 func main() {
 	defer config.Config.Close()
 
+	// bash 自动补全时只输出补全候选项
+	isBashCompletion := command.IsBashCompletionRequest()
+
 	// check & relogin
-	checkLoginExpiredAndRelogin()
+	if !isBashCompletion {
+		checkLoginExpiredAndRelogin()
+	}
 
 	app := cli.NewApp()
 	cmder.SetApp(app)
@@ -112,6 +120,67 @@ func main() {
 			EnvVar:      config.EnvVerbose,
 			Destination: &logger.IsVerbose,
 		},
+		cli.BoolFlag{
+			Name:        "show-api-calls",
+			Usage:       "调试, 命令执行结束后输出调用网盘接口的次数, 同时启用调试时输出每次调用的耗时",
+			EnvVar:      apistat.EnvShowAPICalls,
+			Destination: &apistat.ShowAPICalls,
+		},
+		cli.StringFlag{
+			Name:   "log-format",
+			Usage:  "调试日志的输出格式, 可选值: text, json. json 格式每行输出一条包含 level, msg, ts, module 的日志, 便于日志收集系统处理",
+			EnvVar: jsonlog.EnvLogFormat,
+			Value:  jsonlog.FormatText,
+		},
+		cli.StringFlag{
+			Name:   "log-file",
+			Usage:  "日志文件路径, 标准输出和调试日志在输出的同时追加写入该文件, 每行带有时间, 超过 log_max_size 时自动轮转, 登录凭证和下载链接不写入. 未设置时使用配置项 log_file",
+			EnvVar: logfile.EnvLogFile,
+		},
+		cli.StringSliceFlag{
+			Name:  "set-config",
+			Usage: "覆盖配置项, 格式为 key=value, 可以指定多个, 只在本次运行中生效, 不保存到配置文件. 也可以使用环境变量 " + config.EnvConfigOverridePrefix + "<配置项名称>",
+		},
+	}
+
+	// 设置调试日志的输出格式
+	app.Before = func(c *cli.Context) error {
+		// 应用 --set-config 覆盖的配置项, 交互模式下在整个会话中生效
+		if setConfigs := c.GlobalStringSlice("set-config"); len(setConfigs) > 0 {
+			if err := config.Config.SetConfigOverrides(setConfigs); err != nil {
+				fmt.Printf("覆盖配置项错误: %s\n", err)
+			}
+		}
+
+		if err := jsonlog.SetFormat(c.GlobalString("log-format")); err != nil {
+			fmt.Printf("%s, 使用 text 格式\n", err)
+			jsonlog.SetFormat(jsonlog.FormatText)
+		}
+
+		// 标准输出和调试日志同时写入日志文件
+		logFilePath := c.GlobalString("log-file")
+		if logFilePath == "" {
+			logFilePath = config.Config.LogFile
+		}
+		rf, err := logfile.Setup(logFilePath, config.Config.LogMaxSize)
+		if err != nil {
+			fmt.Printf("打开日志文件失败: %s\n", err)
+			return nil
+		}
+		if rf != nil {
+			if strings.EqualFold(c.GlobalString("log-format"), jsonlog.FormatJSON) {
+				logger.Outputs = append(logger.Outputs, jsonlog.NewJSONLogWriter(rf))
+			} else {
+				logger.Outputs = append(logger.Outputs, rf)
+			}
+		}
+		return nil
+	}
+
+	// 输出网盘接口调用次数, 交互模式下每条命令执行结束后都会输出
+	app.After = func(c *cli.Context) error {
+		apistat.PrintAndReset()
+		return nil
 	}
 
 	// 进入交互CLI命令行界面
@@ -122,7 +191,11 @@ func main() {
 		}
 
 		os.Setenv(config.EnvVerbose, c.String("verbose"))
+		os.Setenv(apistat.EnvShowAPICalls, c.String("show-api-calls"))
+		os.Setenv(jsonlog.EnvLogFormat, c.String("log-format"))
+		os.Setenv(logfile.EnvLogFile, c.String("log-file"))
 		isCli = true
+		cmder.SetInteractive(true)
 		logger.Verbosef("提示: 你已经开启VERBOSE调试日志\n\n")
 
 		var (
@@ -149,7 +222,7 @@ func main() {
 				acceptCompleteFileCommands = []string{
 					"cd", "cp", "xcp", "download", "ls", "mkdir", "mv", "pwd", "rename", "rm", "share", "upload", "login", "loglist", "logout",
 					"clear", "quit", "exit", "quota", "who", "sign", "update", "who", "su", "config",
-					"family", "export", "import", "backup",
+					"family", "export", "import", "backup", "batchrm", "bench", "tree",
 				}
 				closed = strings.LastIndex(line, " ") == len(line)-1
 			)
@@ -328,9 +401,15 @@ func main() {
 		// 获取当前帐号 who
 		command.CmdWho(),
 
+		// 输出当前帐号的登录凭证 token
+		command.CmdToken(),
+
 		// 切换家庭云 family
 		command.CmdFamily(),
 
+		// 显示家庭云的详细信息 familyinfo
+		command.CmdFamilyInfo(),
+
 		// 获取当前帐号空间配额 quota
 		command.CmdQuota(),
 
@@ -346,12 +425,45 @@ func main() {
 		// 列出目录 ls
 		command.CmdLs(),
 
+		// 以树形结构列出目录 tree
+		command.CmdTree(),
+
+		// 对比本地目录和云盘目录 diff
+		command.CmdDiff(),
+
+		// 校验本地已下载的文件 check
+		command.CmdCheck(),
+
+		// 统计目录的空间占用 du
+		command.CmdDu(),
+
+		// 清理遗留的断点续传文件 clean
+		command.CmdClean(),
+
+		// 检查云盘路径是否存在 exists
+		command.CmdExists(),
+
+		// 输出 shell 自动补全脚本 completion
+		command.CmdCompletion(),
+
+		// 显示程序的版本和构建信息 version
+		command.CmdVersion(),
+
+		// 显示最近的下载和上传记录 history
+		command.CmdHistory(),
+
+		// 以 FUSE 文件系统挂载云盘目录 mount
+		command.CmdMount(),
+
 		// 创建目录 mkdir
 		command.CmdMkdir(),
 
 		// 删除文件/目录 rm
 		command.CmdRm(),
 
+		// 根据列表文件批量删除文件/目录 batchrm
+		command.CmdBatchDelete(),
+
 		// 拷贝文件/目录 cp
 		command.CmdCp(),
 
@@ -364,6 +476,9 @@ func main() {
 		// 重命名文件 rename
 		command.CmdRename(),
 
+		// 批量重命名文件 batchrename
+		command.CmdBatchRename(),
+
 		// 分享文件/目录 share
 		command.CmdShare(),
 
@@ -373,12 +488,24 @@ func main() {
 		// 上传文件/目录 upload
 		command.CmdUpload(),
 
+		// 监控本地目录的文件变化 watch
+		command.CmdWatch(),
+
 		// 手动秒传
 		command.CmdRapidUpload(),
 
 		// 下载文件/目录 download
 		command.CmdDownload(),
 
+		// 输出文件内容到标准输出 cat
+		command.CmdCat(),
+
+		// 查看文件标签 gettags
+		command.CmdGetTags(),
+
+		// 查看和下载相册 album
+		command.CmdAlbum(),
+
 		// 导出文件/目录元数据 export
 		command.CmdExport(),
 
@@ -388,6 +515,9 @@ func main() {
 		// 回收站
 		command.CmdRecycle(),
 
+		// 测试下载/上传速度 bench
+		command.CmdBench(),
+
 		// 显示和修改程序配置项 config
 		command.CmdConfig(),
 
@@ -474,5 +604,15 @@ func main() {
 
 	sort.Sort(cli.FlagsByName(app.Flags))
 	sort.Sort(cli.CommandsByName(app.Commands))
-	app.Run(os.Args)
+	if isBashCompletion {
+		command.RunBashCompletion(app)
+		return
+	}
+	err := app.Run(os.Args)
+
+	// 等待标准输出全部写入日志文件
+	logfile.Close()
+	if err == command.ErrShutdown {
+		os.Exit(command.ShutdownExitCode)
+	}
 }
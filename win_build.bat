@@ -10,6 +10,9 @@ set currentDir=%CD%
 set output=out
 set name=cloudpan189-go
 set version=%1
+for /f %%i in ('git rev-parse --short HEAD') do set commit=%%i
+for /f %%i in ('powershell -NoProfile -Command "(Get-Date).ToUniversalTime().ToString('yyyy-MM-ddTHH:mm:ssZ')"') do set buildDate=%%i
+set buildinfo=-X main.Version=%version% -X github.com/phpc0de/ctpango/internal/config.BuildCommit=%commit% -X github.com/phpc0de/ctpango/internal/config.BuildDate=%buildDate%
 
 REM ============= build action ================
 call :build_task %name%-%version%-windows-x86 windows 386
@@ -38,10 +41,10 @@ echo "Building %targetName% ..."
 if %GOOS% == windows (
   goversioninfo -o=resource_windows_386.syso
   goversioninfo -64 -o=resource_windows_amd64.syso
-  go build -ldflags "-linkmode internal -X main.Version=%version% -s -w" -o "%output%/%1/%name%.exe"
+  go build -ldflags "-linkmode internal %buildinfo% -s -w" -o "%output%/%1/%name%.exe"
 ) ^
 else (
-  go build -ldflags "-X main.Version=%version% -s -w" -o "%output%/%1/%name%"
+  go build -ldflags "%buildinfo% -s -w" -o "%output%/%1/%name%"
 )
 
 copy README.md %output%\%1